@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// bootstrap is the setup shared by subcommands: the environment, the configuration and
+// a context cancelled on interrupt
+type bootstrap struct {
+	ctx    context.Context
+	config *types.Config
+	stop   context.CancelFunc
+
+	stopping <-chan struct{} // Closed at the first interrupt, before ctx is cancelled
+	grace    atomic.Int64    // Nanoseconds between the first interrupt and cancelling ctx
+}
+
+// newBootstrap loads .env and the configuration at configPath and starts watching for
+// interrupts. Call close when the subcommand is done.
+func newBootstrap(configPath string) (*bootstrap, error) {
+	// Load .env file (ignore error if file doesn't exist)
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(config.Retry.StatusCodes) > 0 || len(config.Retry.RPCCodes) > 0 {
+		retry.RegisterClassifier(retry.Codes(config.Retry.StatusCodes, config.Retry.RPCCodes))
+	}
+
+	// Setup signal handling for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	stopping := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, shutdownSignals...)
+	b := &bootstrap{
+		ctx:      ctx,
+		config:   config,
+		stopping: stopping,
+		stop: func() {
+			signal.Stop(sigChan)
+			cancel()
+		},
+	}
+	go func() {
+		select {
+		case <-sigChan:
+			close(stopping)
+			b.waitGracePeriod(ctx, sigChan)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return b, nil
+}
+
+// setGracePeriod lets work in progress run for grace after the first interrupt before
+// the context is cancelled. A second interrupt cancels it at once.
+func (b *bootstrap) setGracePeriod(grace time.Duration) {
+	b.grace.Store(int64(grace))
+}
+
+// waitGracePeriod waits out the grace period after the first interrupt, cut short by a
+// second interrupt or ctx ending
+func (b *bootstrap) waitGracePeriod(ctx context.Context, sigChan <-chan os.Signal) {
+	grace := time.Duration(b.grace.Load())
+	if grace <= 0 {
+		log.Println("Received interrupt signal, shutting down...")
+		return
+	}
+	log.Printf("Received interrupt signal, letting the current stage finish for up to %s (interrupt again to stop now)...", grace)
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		log.Println("Shutdown grace period over, cancelling the current stage...")
+	case <-sigChan:
+		log.Println("Received second interrupt signal, shutting down now...")
+	case <-ctx.Done():
+	}
+}
+
+// close stops watching for interrupts and cancels the context
+func (b *bootstrap) close() {
+	b.stop()
+}
+
+// manifestPath returns the manifest of pipelineID: explicit when set, else one file per
+// pipeline ID when manifest_dir is configured, else the shared manifest_path
+func (b *bootstrap) manifestPath(explicit, pipelineID string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	if b.config.Pipeline.ManifestDir == "" {
+		return b.config.Pipeline.ManifestPath, nil
+	}
+	path, err := pipeline.ManifestPathFor(b.config.Pipeline.ManifestDir, pipelineID)
+	if err != nil {
+		return "", fmt.Errorf("invalid pipeline config: %w", err)
+	}
+	return path, nil
+}
+
+// loadConfig reads and parses the YAML configuration file
+func loadConfig(path string) (*types.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Expand environment variables in the config file
+	expandedData := os.ExpandEnv(string(data))
+
+	var config types.Config
+	if err := yaml.Unmarshal([]byte(expandedData), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	// Keep the unexpanded headers so HTTP servers can re-read rotated tokens
+	var raw struct {
+		Servers map[string]struct {
+			Headers map[string]string `yaml:"headers"`
+		} `yaml:"servers"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err == nil {
+		for name, server := range config.Servers {
+			server.HeaderTemplates = raw.Servers[name].Headers
+			config.Servers[name] = server
+		}
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is an "agent <name>" subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int // Returns the process exit code
+}
+
+// commands lists the subcommands in the order usage shows them
+var commands = []command{
+	{"run", "Run the pipeline on an image (the default: 'agent --image ...' is 'agent run --image ...')", runCommand},
+	{"serve", "Accept pipeline submissions over REST", serveCommand},
+	{"status", "Show the stages of a pipeline from its manifest", statusCommand},
+	{"list-runs", "List the pipelines in the manifest directory with their status", listRunsCommand},
+	{"report", "Print the JSON report of a pipeline from its manifest", reportCommand},
+	{"tail", "Show a pipeline's event log, following it until the run finishes", runTail},
+	{"clean", "Remove a pipeline's temporary files and manifest", cleanCommand},
+	{"doctor", "Check the config, ffmpeg, MCP servers and LLM provider", doctorCommand},
+	{"selftest", "Run the pipeline on a bundled sample with fake MCP servers to check ffmpeg", selftestCommand},
+	{"list-tools", "List the tools each configured MCP server offers", listToolsCommand},
+}
+
+// usageOutput is where usage and router errors are written
+var usageOutput io.Writer = os.Stderr
+
+// route runs the subcommand named by args[0] with the remaining arguments. Flags
+// without a subcommand run the pipeline, as before subcommands existed.
+func route(args []string) int {
+	if len(args) == 0 {
+		usage(usageOutput)
+		return 2
+	}
+
+	name := args[0]
+	switch {
+	case name == "help" || name == "-h" || name == "--help" || name == "-help":
+		usage(usageOutput)
+		return 0
+	case strings.HasPrefix(name, "-"):
+		return runCommand(args)
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+	fmt.Fprintf(usageOutput, "agent: unknown command %q\n\n", name)
+	usage(usageOutput)
+	return 2
+}
+
+// usage lists the subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: agent <command> [flags]")
+	fmt.Fprintln(w, "       agent --image photo.jpg [flags]   (same as 'agent run')")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'agent <command> -h' for the flags of a command.")
+}
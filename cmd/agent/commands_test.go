@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// captureOutput redirects command and usage output for the test
+func captureOutput(t *testing.T) (stdout, stderr *bytes.Buffer) {
+	t.Helper()
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	savedStdout, savedStderr := commandOutput, usageOutput
+	commandOutput, usageOutput = stdout, stderr
+	t.Cleanup(func() { commandOutput, usageOutput = savedStdout, savedStderr })
+	return stdout, stderr
+}
+
+// TestRoute verifies subcommands are dispatched, bare flags run the pipeline and
+// unknown commands are rejected
+func TestRoute(t *testing.T) {
+	_, stderr := captureOutput(t)
+
+	if code := route([]string{"help"}); code != 0 {
+		t.Errorf("Expected help to succeed, got exit code %d", code)
+	}
+	for _, cmd := range commands {
+		if !strings.Contains(stderr.String(), cmd.name) {
+			t.Errorf("Expected usage to list %s, got:\n%s", cmd.name, stderr)
+		}
+	}
+
+	stderr.Reset()
+	if code := route([]string{"render"}); code != 2 || !strings.Contains(stderr.String(), `unknown command "render"`) {
+		t.Errorf("Expected an unknown command error, got exit code %d and %q", code, stderr)
+	}
+
+	// A bare flag is "run", which needs --image before touching any config
+	if code := route([]string{"--duration", "5"}); code != 2 {
+		t.Errorf("Expected run without --image to fail with exit code 2, got %d", code)
+	}
+	if code := route([]string{"run", "--duration", "5"}); code != 2 {
+		t.Errorf("Expected 'run' without --image to fail with exit code 2, got %d", code)
+	}
+}
+
+// TestManifestCommands verifies status, report and clean read the pipeline's manifest
+func TestManifestCommands(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	stdout, _ := captureOutput(t)
+
+	configPath := filepath.Join(dir, "agent.yaml")
+	config := "pipeline:\n  manifest_dir: manifests\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	manifest := pipeline.NewManifest("run-1", types.PipelineInput{ImagePath: "photo.jpg"})
+	manifest.Result = &pipeline.PipelineResult{SegmentedImagePath: "segmented.png"}
+	manifest.CompleteStage(types.StageSegmentPerson, map[string]string{})
+	manifest.FailStage(types.StageLandmarks, errors.New("yolo crashed"))
+	manifestPath, err := pipeline.ManifestPathFor("manifests", "run-1")
+	if err != nil {
+		t.Fatalf("ManifestPathFor failed: %v", err)
+	}
+	os.MkdirAll("manifests", 0755)
+	if err := manifest.Save(manifestPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	os.MkdirAll(filepath.Join(tempRoot, "run-1"), 0755)
+
+	if code := route([]string{"status", "--config", configPath, "--id", "run-1"}); code != 0 {
+		t.Fatalf("status failed with exit code %d", code)
+	}
+	status := stdout.String()
+	if !strings.Contains(status, "segment_person") || !strings.Contains(status, "yolo crashed") ||
+		strings.Index(status, "segment_person") > strings.Index(status, "estimate_landmarks") {
+		t.Errorf("Expected the stages in pipeline order, got:\n%s", status)
+	}
+
+	stdout.Reset()
+	if code := route([]string{"report", "--config", configPath, "--id", "run-1"}); code != 0 {
+		t.Fatalf("report failed with exit code %d", code)
+	}
+	var report runReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Expected a JSON report, got %q: %v", stdout, err)
+	}
+	if report.Status != "failed" || !strings.Contains(report.Error, "estimate_landmarks") || report.Result.SegmentedImagePath != "segmented.png" {
+		t.Errorf("Expected a failed report with the result, got %+v", report)
+	}
+
+	if code := route([]string{"status", "--config", configPath, "--id", "run-2"}); code != exitFailure {
+		t.Errorf("Expected status of an unknown pipeline to fail, got exit code %d", code)
+	}
+
+	if code := route([]string{"clean", "--config", configPath, "--id", "run-1"}); code != 0 {
+		t.Fatalf("clean failed with exit code %d", code)
+	}
+	for _, path := range []string{manifestPath, filepath.Join(tempRoot, "run-1")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected clean to remove %s, got %v", path, err)
+		}
+	}
+}
+
+// TestListRunsCommand verifies list-runs lists every manifest in manifest_dir with its
+// status, newest first, and filters by status
+func TestListRunsCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	stdout, _ := captureOutput(t)
+
+	configPath := filepath.Join(dir, "agent.yaml")
+	if err := os.WriteFile(configPath, []byte("pipeline:\n  manifest_dir: manifests\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	os.MkdirAll("manifests", 0755)
+	save := func(manifest *pipeline.Manifest) string {
+		path, _ := pipeline.ManifestPathFor("manifests", manifest.PipelineID)
+		if err := manifest.Save(path); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		return path
+	}
+
+	done := pipeline.NewManifest("run-done", types.PipelineInput{})
+	done.CurrentStage = types.StageComplete
+	save(done)
+	failed := pipeline.NewManifest("run-failed", types.PipelineInput{})
+	failed.FailStage(types.StageLandmarks, errors.New("yolo crashed"))
+	save(failed)
+	running := pipeline.NewManifest("run-running", types.PipelineInput{})
+	running.StartStage(types.StageSegmentPerson)
+	os.WriteFile(pipeline.RunLockPath(save(running)), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join("manifests", "notes.json"), []byte("[]"), 0644)
+
+	if code := route([]string{"list-runs", "--config", configPath}); code != 0 {
+		t.Fatalf("list-runs failed with exit code %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	expected := [][]string{{"PIPELINE"}, {"run-running", "running"}, {"run-failed", "failed"}, {"run-done", "completed"}}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got:\n%s", len(expected), stdout)
+	}
+	for i, fields := range expected {
+		for _, field := range fields {
+			if !strings.Contains(lines[i], field) {
+				t.Errorf("Expected line %d to contain %q, got %q", i, field, lines[i])
+			}
+		}
+	}
+
+	stdout.Reset()
+	if code := route([]string{"list-runs", "--config", configPath, "--status", "failed"}); code != 0 {
+		t.Fatalf("list-runs --status failed with exit code %d", code)
+	}
+	if out := stdout.String(); !strings.Contains(out, "run-failed") || strings.Contains(out, "run-done") {
+		t.Errorf("Expected only the failed run, got:\n%s", out)
+	}
+
+	if code := route([]string{"list-runs", "--config", configPath, "--status", "lost"}); code != 2 {
+		t.Errorf("Expected an unknown status to fail with exit code 2, got %d", code)
+	}
+}
+
+// TestOverrideFullAILimits verifies flags win over the config, which wins over the
+// built-in defaults
+func TestOverrideFullAILimits(t *testing.T) {
+	config := types.FullAIConfig{MaxRounds: 12, MaxCostUSD: 1, HistoryCompaction: types.HistoryCompactionConfig{Disabled: true}}
+	overrideFullAILimits(&config, types.FullAIConfig{MaxRounds: 5, MaxTokens: 0, MaxCostUSD: 0.1})
+
+	if config.MaxRounds != 5 || config.MaxCostUSD != 0.1 {
+		t.Errorf("Expected the flags to override rounds and cost, got %+v", config)
+	}
+	if config.MaxTokens != 0 || config.TimeoutSeconds != 0 || !config.HistoryCompaction.Disabled {
+		t.Errorf("Expected the other settings to be left alone, got %+v", config)
+	}
+
+	effective := pipeline.ResolveFullAILimits(config)
+	if effective.MaxTokens != pipeline.DefaultFullAIMaxTokens || effective.TimeoutSeconds != pipeline.DefaultFullAITimeoutSeconds {
+		t.Errorf("Expected unset limits to fall back to the defaults, got %+v", effective)
+	}
+}
+
+func TestParseVersionLine(t *testing.T) {
+	tests := map[string]string{
+		"ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc": "6.1.1-3ubuntu5",
+		"ffprobe version n7.0 Copyright (c) 2007-2024":                                                "n7.0",
+		"garbage": "unknown version",
+		"":        "unknown version",
+	}
+	for out, want := range tests {
+		if got := parseVersionLine(out); got != want {
+			t.Errorf("parseVersionLine(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
+
+// TestPrintHealth verifies the readiness table lists every component and a failure is
+// reported
+func TestPrintHealth(t *testing.T) {
+	rows := []healthRow{
+		{"ffmpeg", healthOK, "6.1.1 (/usr/bin/ffmpeg)"},
+		{"server music", healthSkipped, "no planned stage needs it"},
+		llmRow(types.LLMConfig{}, nil, nil),
+	}
+	if healthFailed(rows) {
+		t.Error("Expected no failure")
+	}
+	var out bytes.Buffer
+	printHealth(&out, rows)
+	for _, want := range []string{"COMPONENT", "ffmpeg        ok", "server music  skipped", "llm           disabled"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the table, got:\n%s", want, out.String())
+		}
+	}
+
+	rows = append(rows, llmRow(types.LLMConfig{Enabled: true}, nil, errors.New("unknown provider")))
+	if !healthFailed(rows) || rows[3].detail != "unknown provider" {
+		t.Errorf("Expected the LLM failure to be reported, got %+v", rows[3])
+	}
+}
+
+// TestCheckLLMIgnoresUnusedProviders verifies a stale secret reference in a provider
+// section the run doesn't use neither fails the check nor gets resolved
+func TestCheckLLMIgnoresUnusedProviders(t *testing.T) {
+	config := &types.Config{LLM: types.LLMConfig{
+		Enabled:    true,
+		Provider:   "anthropic",
+		Anthropic:  types.AnthropicConfig{APIKey: "anthropic-key"},
+		OpenRouter: types.OpenRouterConfig{APIKey: "secret://vault/retired/openrouter"},
+	}}
+	b := &bootstrap{ctx: context.Background(), config: config}
+	if err := checkLLM(b); err != nil {
+		t.Fatalf("Expected the unused openrouter key to be ignored, got: %v", err)
+	}
+	if config.LLM.OpenRouter.APIKey != "secret://vault/retired/openrouter" {
+		t.Errorf("Expected the unused key left unresolved, got %q", config.LLM.OpenRouter.APIKey)
+	}
+
+	config.LLM.Provider = "openrouter"
+	if err := checkLLM(b); err == nil {
+		t.Error("Expected the selected provider's stale key to fail the check")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/secrets"
+)
+
+// doctorCommand implements "agent doctor": it checks the config, the ffmpeg binaries,
+// every configured MCP server and the LLM provider, and exits non-zero when any check
+// fails. Returns the process exit code.
+func doctorCommand(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := flags.String("config", "configs/agent.yaml", "Path to configuration file")
+	timeout := flags.Duration("timeout", 30*time.Second, "Time allowed to connect to each server")
+	flags.Parse(args)
+
+	failed := false
+	report := func(name string, err error, detail string) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(commandOutput, "[FAIL] %s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(commandOutput, "[ok]   %s: %s\n", name, detail)
+	}
+
+	b, err := newBootstrap(*configPath)
+	report("config", err, *configPath)
+	if err != nil {
+		return exitFailure
+	}
+	defer b.close()
+
+	_, err = pipelineFactory(b.config, &runtime{}, runtimeOptions{noCache: true})
+	report("pipeline config", err, "valid")
+
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		path, err := exec.LookPath(binary)
+		report(binary, err, path)
+	}
+
+	for _, name := range serverNames(b, "") {
+		ctx, cancel := context.WithTimeout(b.ctx, *timeout)
+		mcpClient, err := createAndInitClient(ctx, b.config.Servers[name], name)
+		if err != nil {
+			cancel()
+			report("server "+name, err, "")
+			continue
+		}
+		tools, err := validateServerTools(ctx, mcpClient, b.config.Servers[name])
+		serverName, serverVersion := mcpClient.GetServerInfo()
+		mcpClient.Close()
+		cancel()
+		report("server "+name, err, fmt.Sprintf("%s v%s, %d tools", serverName, serverVersion, len(tools)))
+	}
+
+	report("llm", checkLLM(b), llmDetail(b))
+
+	if failed {
+		return exitFailure
+	}
+	return 0
+}
+
+// checkLLM checks the configured LLM provider can be created and has an API key
+func checkLLM(b *bootstrap) error {
+	if !b.config.LLM.Enabled {
+		return nil
+	}
+	if err := secrets.ResolveLLMConfig(b.ctx, &b.config.LLM); err != nil {
+		return err
+	}
+	provider, err := createLLMProvider(b.config.LLM)
+	if err != nil {
+		return err
+	}
+	if !provider.IsEnabled() {
+		return fmt.Errorf("%s provider has no API key", provider.Name())
+	}
+	return nil
+}
+
+// llmDetail describes the configured LLM for doctor
+func llmDetail(b *bootstrap) string {
+	if !b.config.LLM.Enabled {
+		return "disabled (stages run with the default decision)"
+	}
+	return fmt.Sprintf("%s %s (mode: %s)", b.config.LLM.Provider, configuredModel(b.config.LLM), b.config.LLM.Mode)
+}
+
+// listToolsCommand implements "agent list-tools": it connects to each configured MCP
+// server, or just --server, and prints its tools. Returns the process exit code.
+func listToolsCommand(args []string) int {
+	flags := flag.NewFlagSet("list-tools", flag.ExitOnError)
+	configPath := flags.String("config", "configs/agent.yaml", "Path to configuration file")
+	only := flags.String("server", "", "Only list the tools of this server")
+	flags.Parse(args)
+
+	b, err := newBootstrap(*configPath)
+	if err != nil {
+		log.Printf("list-tools: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+
+	names := serverNames(b, *only)
+	if len(names) == 0 {
+		log.Printf("list-tools: no server %q in %s", *only, *configPath)
+		return exitFailure
+	}
+
+	exitCode := 0
+	for _, name := range names {
+		mcpClient, err := createAndInitClient(b.ctx, b.config.Servers[name], name)
+		if err != nil {
+			log.Printf("list-tools: %s: %v", name, err)
+			exitCode = exitFailure
+			continue
+		}
+		tools, err := mcpClient.ListTools(b.ctx)
+		serverName, serverVersion := mcpClient.GetServerInfo()
+		mcpClient.Close()
+		if err != nil {
+			log.Printf("list-tools: %s: %v", name, err)
+			exitCode = exitFailure
+			continue
+		}
+
+		fmt.Fprintf(commandOutput, "%s (%s v%s):\n", name, serverName, serverVersion)
+		sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+		for _, tool := range tools {
+			description, _, _ := strings.Cut(strings.TrimSpace(tool.Description), "\n")
+			fmt.Fprintf(commandOutput, "  %-32s %s\n", tool.Name, description)
+		}
+	}
+	return exitCode
+}
+
+// serverNames returns the configured servers by name, or just only when set
+func serverNames(b *bootstrap, only string) []string {
+	var names []string
+	for name := range b.config.Servers {
+		if only == "" || name == only {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
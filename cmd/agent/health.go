@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/internal/secrets"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Statuses in the readiness table
+const (
+	healthOK       = "ok"
+	healthFail     = "FAIL"
+	healthSkipped  = "skipped"
+	healthDisabled = "disabled"
+)
+
+// healthCheckTimeout bounds connecting to and listing the tools of each server with --check
+const healthCheckTimeout = 30 * time.Second
+
+// healthRow is one component of the readiness table
+type healthRow struct {
+	component string
+	status    string
+	detail    string
+}
+
+// runtimeHealth describes a runtime setupRuntime connected: the ffmpeg binaries, each
+// MCP server and the LLM provider
+func runtimeHealth(config *types.Config, rt *runtime, stages []types.PipelineStage, fullAI bool) []healthRow {
+	required := requiredNames(stages, fullAI)
+	rows := binaryRows(required)
+
+	tools := make(map[string]int)
+	for _, target := range rt.warmupTargets {
+		tools[target.name] = len(target.tools)
+	}
+	for _, server := range pipeline.AllServers() {
+		mcpClient := rt.mcpClients[server]
+		if mcpClient == nil {
+			rows = append(rows, healthRow{"server " + server, healthSkipped, "no planned stage needs it"})
+			continue
+		}
+		name, version := mcpClient.GetServerInfo()
+		rows = append(rows, healthRow{"server " + server, healthOK, fmt.Sprintf("%s v%s, %d tools", name, version, tools[server])})
+	}
+
+	return append(rows, llmRow(config.LLM, rt.llmProvider, nil))
+}
+
+// checkHealth probes everything a run of stages needs, reporting every problem rather
+// than stopping at the first like setupRuntime. Servers are disconnected afterwards.
+func checkHealth(b *bootstrap, stages []types.PipelineStage, fullAI bool, model string) []healthRow {
+	required := requiredNames(stages, fullAI)
+	rows := binaryRows(required)
+
+	for _, server := range pipeline.AllServers() {
+		if !required[server] {
+			rows = append(rows, healthRow{"server " + server, healthSkipped, "no planned stage needs it"})
+			continue
+		}
+		config, ok := b.config.Servers[server]
+		if !ok {
+			rows = append(rows, healthRow{"server " + server, healthFail, "not configured"})
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(b.ctx, healthCheckTimeout)
+		mcpClient, err := createAndInitClient(ctx, config, server)
+		if err != nil {
+			cancel()
+			rows = append(rows, healthRow{"server " + server, healthFail, err.Error()})
+			continue
+		}
+		tools, err := validateServerTools(ctx, mcpClient, config)
+		name, version := mcpClient.GetServerInfo()
+		mcpClient.Close()
+		cancel()
+		if err != nil {
+			rows = append(rows, healthRow{"server " + server, healthFail, err.Error()})
+			continue
+		}
+		rows = append(rows, healthRow{"server " + server, healthOK, fmt.Sprintf("%s v%s, %d tools", name, version, len(tools))})
+	}
+
+	llmConfig := b.config.LLM
+	if model != "" {
+		llmConfig.Google.Model, llmConfig.Anthropic.Model = model, model
+		llmConfig.OpenAI.Model, llmConfig.OpenRouter.Model = model, model
+	}
+	var provider llm.Provider
+	var err error
+	if llmConfig.Enabled {
+		if err = secrets.ResolveLLMConfig(b.ctx, &llmConfig); err == nil {
+			provider, err = createLLMProvider(llmConfig)
+		}
+	}
+	return append(rows, llmRow(llmConfig, provider, err))
+}
+
+// requiredNames returns the names of the servers and binaries a run of stages needs
+func requiredNames(stages []types.PipelineStage, fullAI bool) map[string]bool {
+	names := make(map[string]bool)
+	requirements, _ := pipeline.RequiredServers(fullAI, stages)
+	for _, req := range requirements {
+		names[req.Name] = true
+	}
+	return names
+}
+
+// binaryRows reports the path and version of ffmpeg and ffprobe; a missing binary fails
+// only when the run needs it
+func binaryRows(required map[string]bool) []healthRow {
+	var rows []healthRow
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		path, err := exec.LookPath(binary)
+		switch {
+		case err != nil && required[binary]:
+			rows = append(rows, healthRow{binary, healthFail, "not found in PATH"})
+		case err != nil:
+			rows = append(rows, healthRow{binary, healthSkipped, "not found in PATH, no planned stage needs it"})
+		default:
+			rows = append(rows, healthRow{binary, healthOK, binaryVersion(path) + " (" + path + ")"})
+		}
+	}
+	return rows
+}
+
+// binaryVersion returns the version ffmpeg or ffprobe at path reports, "unknown version"
+// when it can't be run
+func binaryVersion(path string) string {
+	out, err := exec.Command(path, "-hide_banner", "-version").Output()
+	if err != nil {
+		return "unknown version"
+	}
+	return parseVersionLine(string(out))
+}
+
+// parseVersionLine extracts the version from the first line of "ffmpeg -version",
+// e.g. "ffmpeg version 6.1.1-3ubuntu5 Copyright ..." gives "6.1.1-3ubuntu5"
+func parseVersionLine(out string) string {
+	line, _, _ := strings.Cut(out, "\n")
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "version" {
+			return fields[i+1]
+		}
+	}
+	return "unknown version"
+}
+
+// llmRow describes the LLM provider: disabled in the config, failed to be created
+// (createErr), or enabled with its model. A provider without an API key only fails
+// full AI mode; lightweight runs fall back to the default decision.
+func llmRow(config types.LLMConfig, provider llm.Provider, createErr error) healthRow {
+	switch {
+	case !config.Enabled:
+		return healthRow{"llm", healthDisabled, "stages run with the default decision"}
+	case createErr != nil:
+		return healthRow{"llm", healthFail, createErr.Error()}
+	case provider == nil:
+		return healthRow{"llm", healthFail, "no provider created"}
+	}
+
+	mode := config.Mode
+	if mode == "" {
+		mode = "lightweight"
+	}
+	detail := fmt.Sprintf("%s %s (mode: %s)", provider.Name(), configuredModel(config), mode)
+	if provider.IsEnabled() {
+		return healthRow{"llm", healthOK, detail}
+	}
+	if mode == "full_ai" {
+		return healthRow{"llm", healthFail, detail + ", no API key"}
+	}
+	return healthRow{"llm", healthDisabled, detail + ", no API key: stages run with the default decision"}
+}
+
+// healthFailed reports whether any component failed
+func healthFailed(rows []healthRow) bool {
+	for _, row := range rows {
+		if row.status == healthFail {
+			return true
+		}
+	}
+	return false
+}
+
+// printHealth writes the readiness table
+func printHealth(w io.Writer, rows []healthRow) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tSTATUS\tDETAIL")
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", row.component, row.status, row.detail)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// commandOutput is where subcommands print their results
+var commandOutput io.Writer = os.Stdout
+
+// manifestFlags are the flags locating a pipeline's manifest
+type manifestFlags struct {
+	configPath   *string
+	pipelineID   *string
+	manifestPath *string
+}
+
+// addManifestFlags defines the flags locating a pipeline's manifest
+func addManifestFlags(flags *flag.FlagSet) manifestFlags {
+	return manifestFlags{
+		configPath:   flags.String("config", "configs/agent.yaml", "Path to configuration file"),
+		pipelineID:   flags.String("id", "", "Pipeline ID"),
+		manifestPath: flags.String("manifest", "", "Path to pipeline manifest (default: from config)"),
+	}
+}
+
+// load reads the manifest the flags point at. It fails when there is none, or when the
+// shared manifest holds another pipeline than --id.
+func (f manifestFlags) load(b *bootstrap) (*pipeline.Manifest, string, error) {
+	if *f.pipelineID == "" && *f.manifestPath == "" && b.config.Pipeline.ManifestDir != "" {
+		return nil, "", fmt.Errorf("--id is required with manifest_dir")
+	}
+	path, err := b.manifestPath(*f.manifestPath, *f.pipelineID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest, err := pipeline.LoadManifest(path)
+	switch {
+	case err != nil:
+		return nil, path, err
+	case manifest == nil:
+		return nil, path, fmt.Errorf("no manifest at %s", path)
+	case *f.pipelineID != "" && manifest.PipelineID != *f.pipelineID:
+		return nil, path, fmt.Errorf("manifest %s holds pipeline %s, not %s", path, manifest.PipelineID, *f.pipelineID)
+	}
+	return manifest, path, nil
+}
+
+// statusCommand implements "agent status": it shows the state of each stage of a
+// pipeline from its manifest. Returns the process exit code.
+func statusCommand(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	locate := addManifestFlags(flags)
+	flags.Parse(args)
+
+	b, err := newBootstrap(*locate.configPath)
+	if err != nil {
+		log.Printf("status: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+
+	manifest, path, err := locate.load(b)
+	if err != nil {
+		log.Printf("status: %v", err)
+		return exitFailure
+	}
+
+	w := commandOutput
+	fmt.Fprintf(w, "Pipeline: %s\n", manifest.PipelineID)
+	fmt.Fprintf(w, "Manifest: %s\n", path)
+	fmt.Fprintf(w, "Updated:  %s\n", manifest.UpdatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "Current stage: %s\n", manifest.CurrentStage)
+	for _, stage := range manifestStages(manifest, b.config.Pipeline.Stages) {
+		state := manifest.Stages[stage]
+		line := fmt.Sprintf("  %-20s %-10s", stage, state.Status)
+		if state.Attempt > 1 {
+			line += fmt.Sprintf(" attempt %d", state.Attempt)
+		}
+		if state.Error != "" {
+			line += " " + state.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+	if manifest.Result != nil && manifest.Result.FinalOutputPath != "" {
+		fmt.Fprintf(w, "Final output: %s\n", manifest.Result.FinalOutputPath)
+	}
+	return 0
+}
+
+// manifestStages returns the stages recorded in manifest, in the configured order
+// followed by any others by name
+func manifestStages(manifest *pipeline.Manifest, order []types.PipelineStage) []types.PipelineStage {
+	if len(order) == 0 {
+		order = pipeline.GetStageOrder()
+	}
+	var stages, others []types.PipelineStage
+	seen := make(map[types.PipelineStage]bool)
+	for _, stage := range order {
+		if manifest.Stages[stage] != nil {
+			stages = append(stages, stage)
+			seen[stage] = true
+		}
+	}
+	for stage := range manifest.Stages {
+		if !seen[stage] {
+			others = append(others, stage)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i] < others[j] })
+	return append(stages, others...)
+}
+
+// reportCommand implements "agent report": it prints the JSON report of a pipeline from
+// its manifest, as a --json run would. Returns the process exit code.
+func reportCommand(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	locate := addManifestFlags(flags)
+	flags.Parse(args)
+
+	b, err := newBootstrap(*locate.configPath)
+	if err != nil {
+		log.Printf("report: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+
+	manifest, _, err := locate.load(b)
+	if err != nil {
+		log.Printf("report: %v", err)
+		return exitFailure
+	}
+
+	manifestReport(manifest).write(commandOutput)
+	return 0
+}
+
+// manifestReport builds a run report from a manifest: completed, failed with the
+// failed stage's error, or incomplete
+func manifestReport(manifest *pipeline.Manifest) runReport {
+	report := runReport{PipelineID: manifest.PipelineID, Status: "incomplete", Result: manifest.Result}
+	if manifest.CurrentStage == types.StageComplete {
+		report.Status = "completed"
+		return report
+	}
+	for _, stage := range manifestStages(manifest, nil) {
+		if state := manifest.Stages[stage]; state.Status == types.StatusFailed {
+			report.Status = "failed"
+			report.Error = fmt.Sprintf("stage %s failed: %s", stage, state.Error)
+			break
+		}
+	}
+	return report
+}
+
+// runStatuses are the statuses list-runs reports and filters by
+var runStatuses = []string{"completed", "failed", "running", "incomplete"}
+
+// listRunsCommand implements "agent list-runs": it lists the pipelines with a manifest
+// in manifest_dir, most recently updated first. Returns the process exit code.
+func listRunsCommand(args []string) int {
+	flags := flag.NewFlagSet("list-runs", flag.ExitOnError)
+	configPath := flags.String("config", "configs/agent.yaml", "Path to configuration file")
+	dir := flags.String("dir", "", "Manifest directory to scan (default: pipeline.manifest_dir from config)")
+	status := flags.String("status", "", "Only list runs with this status: "+strings.Join(runStatuses, ", "))
+	flags.Parse(args)
+
+	if *status != "" && !slices.Contains(runStatuses, *status) {
+		fmt.Fprintf(usageOutput, "list-runs: unknown status %q (expected one of: %s)\n", *status, strings.Join(runStatuses, ", "))
+		return 2
+	}
+
+	b, err := newBootstrap(*configPath)
+	if err != nil {
+		log.Printf("list-runs: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+
+	manifests, err := loadRuns(b, *dir)
+	if err != nil {
+		log.Printf("list-runs: %v", err)
+		return exitFailure
+	}
+
+	w := tabwriter.NewWriter(commandOutput, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PIPELINE\tCREATED\tUPDATED\tSTAGE\tSTATUS")
+	for _, run := range manifests {
+		if *status != "" && run.status != *status {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", run.manifest.PipelineID,
+			run.manifest.CreatedAt.Format("2006-01-02 15:04:05"), run.manifest.UpdatedAt.Format("2006-01-02 15:04:05"),
+			run.manifest.CurrentStage, run.status)
+	}
+	w.Flush()
+	return 0
+}
+
+// listedRun is a manifest found by list-runs with its status
+type listedRun struct {
+	manifest *pipeline.Manifest
+	status   string
+}
+
+// loadRuns reads the manifests in dir, or in manifest_dir when dir is empty. Without a
+// manifest directory it reads the shared manifest_path.
+func loadRuns(b *bootstrap, dir string) ([]listedRun, error) {
+	if dir == "" {
+		dir = b.config.Pipeline.ManifestDir
+	}
+
+	var manifests []*pipeline.Manifest
+	var paths []string
+	if dir == "" {
+		manifest, err := pipeline.LoadManifest(b.config.Pipeline.ManifestPath)
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			manifests, paths = append(manifests, manifest), append(paths, b.config.Pipeline.ManifestPath)
+		}
+	} else {
+		var err error
+		if manifests, err = pipeline.ListManifests(dir); err != nil {
+			return nil, err
+		}
+		for _, manifest := range manifests {
+			path, _ := pipeline.ManifestPathFor(dir, manifest.PipelineID)
+			paths = append(paths, path)
+		}
+	}
+
+	runs := make([]listedRun, len(manifests))
+	for i, manifest := range manifests {
+		runs[i] = listedRun{manifest: manifest, status: runStatus(manifest, paths[i])}
+	}
+	return runs, nil
+}
+
+// runStatus is the manifest's report status, or running while a process holds the
+// lock on an unfinished manifest at path
+func runStatus(manifest *pipeline.Manifest, path string) string {
+	status := manifestReport(manifest).Status
+	if status == "incomplete" {
+		if _, err := os.Stat(pipeline.RunLockPath(path)); err == nil {
+			status = "running"
+		}
+	}
+	return status
+}
+
+// cleanCommand implements "agent clean": it removes a pipeline's temporary directory
+// and manifest, or every temporary directory with --all. Returns the process exit code.
+func cleanCommand(args []string) int {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	locate := addManifestFlags(flags)
+	all := flags.Bool("all", false, "Remove the temporary files of every pipeline ("+tempRoot+")")
+	keepManifest := flags.Bool("keep-manifest", false, "Keep the manifest, so the run can still be inspected")
+	flags.Parse(args)
+
+	if *all {
+		if err := os.RemoveAll(tempRoot); err != nil {
+			log.Printf("clean: %v", err)
+			return exitFailure
+		}
+		fmt.Fprintf(commandOutput, "Removed %s\n", tempRoot)
+		return 0
+	}
+	if *locate.pipelineID == "" {
+		fmt.Fprintln(usageOutput, "Usage: agent clean --id <pipeline> [--keep-manifest] | --all")
+		return 2
+	}
+
+	tempDir := filepath.Join(tempRoot, *locate.pipelineID)
+	if _, err := os.Stat(tempDir); err == nil {
+		if err := os.RemoveAll(tempDir); err != nil {
+			log.Printf("clean: %v", err)
+			return exitFailure
+		}
+		fmt.Fprintf(commandOutput, "Removed %s\n", tempDir)
+	}
+	if *keepManifest {
+		return 0
+	}
+
+	// Only remove a manifest that belongs to the pipeline
+	b, err := newBootstrap(*locate.configPath)
+	if err != nil {
+		log.Printf("clean: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+	_, path, err := locate.load(b)
+	if err != nil {
+		fmt.Fprintf(commandOutput, "No manifest removed: %v\n", err)
+		return 0
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("clean: %v", err)
+		return exitFailure
+	}
+	// A lock left by a crashed run goes with its manifest
+	if err := os.Remove(pipeline.RunLockPath(path)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: clean: %v", err)
+	}
+	fmt.Fprintf(commandOutput, "Removed %s\n", path)
+	return 0
+}
@@ -2,22 +2,20 @@ package main
 
 import (
 	"context"
-	"flag"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
-	"time"
-
-	"github.com/joho/godotenv"
-	"gopkg.in/yaml.v3"
+	"strings"
+	"sync"
 
 	"github.com/zhe.chen/agent-funpic-act/internal/client"
 	"github.com/zhe.chen/agent-funpic-act/internal/llm"
 	"github.com/zhe.chen/agent-funpic-act/internal/llm/providers/claude"
 	"github.com/zhe.chen/agent-funpic-act/internal/llm/providers/gemini"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm/providers/mock"
 	"github.com/zhe.chen/agent-funpic-act/internal/llm/providers/openai"
 	"github.com/zhe.chen/agent-funpic-act/internal/llm/providers/openrouter"
 	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
@@ -39,241 +37,200 @@ func createLLMProvider(config types.LLMConfig) (llm.Provider, error) {
 	case "openrouter":
 		return openrouter.NewProvider(config.OpenRouter)
 
+	case "mock":
+		return mock.NewProvider(config.Mock)
+
 	case "":
 		return nil, fmt.Errorf("llm.provider not specified in config")
 
 	default:
-		return nil, fmt.Errorf("unsupported LLM provider: %s (supported: anthropic, google, openai, openrouter)", config.Provider)
+		return nil, fmt.Errorf("unsupported LLM provider: %s (supported: anthropic, google, openai, openrouter, mock)", config.Provider)
 	}
 }
 
 func main() {
-	// Load .env file (ignore error if file doesn't exist)
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
-	}
-
-	// Parse command-line flags
-	var (
-		configPath   = flag.String("config", "configs/agent.yaml", "Path to configuration file")
-		imagePath    = flag.String("image", "", "Path to input image (required)")
-		duration     = flag.Float64("duration", 10.0, "Target duration in seconds")
-		userPrompt   = flag.String("prompt", "", "Your request (e.g., 'make a shake animation')")
-		manifestPath = flag.String("manifest", "", "Path to pipeline manifest (default: from config)")
-		pipelineID   = flag.String("id", "", "Pipeline ID for resume (default: auto-generate)")
-		outputDir    = flag.String("output", "output", "Output directory for generated files")
-		model        = flag.String("model", "", "Override LLM model (e.g., 'gemini-1.5-flash')")
-	)
-	flag.Parse()
-
-	// Validate required flags
-	if *imagePath == "" {
-		log.Fatal("Error: --image flag is required")
-	}
-
-	// Setup signal handling for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	dumpStatusOnSignal()
+	os.Exit(route(os.Args[1:]))
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		log.Println("Received interrupt signal, shutting down...")
-		cancel()
-	}()
+// Exit codes that let scripted callers route inputs without parsing logs
+const (
+	exitFailure       = 1
+	exitNoSubject     = 3
+	exitLowConfidence = 4
+	exitInterrupted   = 5 // Stopped by a signal; the manifest was saved, so --id resumes it
+)
 
-	// Load configuration
-	config, err := loadConfig(*configPath)
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+// exitCodeFor maps a pipeline error to the process exit code
+func exitCodeFor(err error) int {
+	switch pipeline.FailureKind(err) {
+	case pipeline.FailureNoSubject:
+		return exitNoSubject
+	case pipeline.FailureLowConfidence:
+		return exitLowConfidence
+	case pipeline.FailureInterrupted:
+		return exitInterrupted
+	default:
+		return exitFailure
 	}
+}
 
-	// Validate prompt requirement for Full AI mode
-	if config.LLM.Mode == "full_ai" && *userPrompt == "" {
-		log.Fatal("Error: --prompt flag is required in Full AI mode.\nExample: --prompt \"Generate a shake animation with the character's head moving left and right\"")
+// describeProvenance formats a provenance record, e.g. "imagesorcery fill v0.9.1"
+func describeProvenance(source *types.ToolProvenance) string {
+	parts := []string{}
+	if source.Server != "" {
+		parts = append(parts, source.Server)
 	}
-
-	// Set manifest path
-	if *manifestPath == "" {
-		*manifestPath = config.Pipeline.ManifestPath
+	parts = append(parts, source.Tool)
+	if source.ServerVersion != "" {
+		parts = append(parts, "v"+strings.TrimPrefix(source.ServerVersion, "v"))
 	}
-
-	// Generate pipeline ID if not provided
-	if *pipelineID == "" {
-		*pipelineID = fmt.Sprintf("pipeline-%d", time.Now().Unix())
+	if source.ServerName != "" && source.ServerName != source.Server {
+		parts = append(parts, "("+source.ServerName+")")
 	}
+	if source.TrackID != "" {
+		parts = append(parts, "track "+source.TrackID)
+	}
+	return strings.Join(parts, " ")
+}
 
-	log.Printf("Starting agent-funpic-act")
-	log.Printf("Pipeline ID: %s", *pipelineID)
-	log.Printf("Image: %s", *imagePath)
-	log.Printf("Duration: %.1fs", *duration)
-	log.Printf("Output Directory: %s", *outputDir)
+// runReport is the JSON report printed with --json
+type runReport struct {
+	PipelineID  string                   `json:"pipeline_id"`
+	Status      string                   `json:"status"`
+	Error       string                   `json:"error,omitempty"`
+	FailureKind string                   `json:"failure_kind,omitempty"`
+	Result      *pipeline.PipelineResult `json:"result,omitempty"`
+	Warmup      map[string]float64       `json:"warmup_seconds,omitempty"` // Server -> warmup duration
+}
 
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(*outputDir, 0755); err != nil {
-		log.Fatalf("Failed to create output directory: %v", err)
-	}
+// writeReport prints the run outcome as JSON to stdout
+func writeReport(pipelineID string, result *pipeline.PipelineResult, warmups []client.WarmupResult, err error) {
+	newRunReport(pipelineID, result, warmups, err).write(os.Stdout)
+}
 
-	// Create temporary directory for intermediate files
-	tempDir := fmt.Sprintf(".pipeline_tmp/%s", *pipelineID)
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		log.Fatalf("Failed to create temporary directory: %v", err)
+// newRunReport builds the report of a run that returned result and err
+func newRunReport(pipelineID string, result *pipeline.PipelineResult, warmups []client.WarmupResult, err error) runReport {
+	report := runReport{
+		PipelineID: pipelineID,
+		Status:     "completed",
+		Result:     result,
 	}
-	log.Printf("Temporary Directory: %s", tempDir)
-
-	// Create and initialize MCP clients
-	imagesorceryClient, err := createAndInitClient(ctx, config.Servers["imagesorcery"], "imagesorcery")
-	if err != nil {
-		log.Fatalf("Failed to initialize imagesorcery client: %v", err)
+	for _, warmup := range warmups {
+		if warmup.Tool == "" {
+			continue
+		}
+		if report.Warmup == nil {
+			report.Warmup = make(map[string]float64)
+		}
+		report.Warmup[warmup.Server] = warmup.Duration.Seconds()
 	}
-	defer imagesorceryClient.Close()
-
-	yoloClient, err := createAndInitClient(ctx, config.Servers["yolo"], "yolo")
 	if err != nil {
-		log.Fatalf("Failed to initialize yolo client: %v", err)
+		report.Status = "failed"
+		report.Error = err.Error()
+		report.FailureKind = pipeline.FailureKind(err)
 	}
-	defer yoloClient.Close()
+	return report
+}
 
-	videoClient, err := createAndInitClient(ctx, config.Servers["video"], "video")
-	if err != nil {
-		log.Fatalf("Failed to initialize video client: %v", err)
+// write prints the report as indented JSON
+func (report runReport) write(w io.Writer) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("Warning: failed to write JSON report: %v", err)
 	}
-	defer videoClient.Close()
+}
 
-	musicClient, err := createAndInitClient(ctx, config.Servers["music"], "music")
+// printCostEstimate builds the full AI prompt and tool schemas exactly as a run would
+// and prints the estimated cost range next to the configured budget
+func printCostEstimate(ctx context.Context, config types.LLMConfig, mcpClients map[string]client.MCPClient, exposed map[string][]string, toolSnapshot *llm.ToolSnapshot,
+	imagePath string, duration float64, userPrompt, outputDir, historyPattern string) error {
+	absImagePath, err := filepath.Abs(imagePath)
 	if err != nil {
-		log.Fatalf("Failed to initialize music client: %v", err)
-	}
-	defer musicClient.Close()
-
-	// Validate tools availability
-	if err := validateServerTools(ctx, imagesorceryClient, config.Servers["imagesorcery"]); err != nil {
-		log.Fatalf("ImageSorcery server validation failed: %v", err)
+		return fmt.Errorf("failed to resolve image path: %w", err)
 	}
-
-	if err := validateServerTools(ctx, yoloClient, config.Servers["yolo"]); err != nil {
-		log.Fatalf("YOLO server validation failed: %v", err)
+	width, height, err := llm.ImageSize(absImagePath)
+	if err != nil {
+		return err
 	}
 
-	if err := validateServerTools(ctx, videoClient, config.Servers["video"]); err != nil {
-		log.Fatalf("Video server validation failed: %v", err)
+	toolAdapter := llm.NewToolAdapter(mcpClients)
+	toolAdapter.SetToolNameSeparator(config.FullAI.ToolNameSeparator)
+	toolAdapter.SetDiscoveryConcurrency(config.FullAI.DiscoveryConcurrency)
+	toolAdapter.SetExposedTools(exposed)
+	if toolSnapshot != nil {
+		toolAdapter.SetToolSnapshot(toolSnapshot)
 	}
-
-	if err := validateServerTools(ctx, musicClient, config.Servers["music"]); err != nil {
-		log.Fatalf("Music server validation failed: %v", err)
+	tools, err := toolAdapter.DiscoverAndConvertTools(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Initialize LLM provider (AI Agent feature)
-	var llmProvider llm.Provider
-	if config.LLM.Enabled {
-		// Model override priority: CLI flag > ENV var > config file
-		if *model != "" {
-			// Command-line flag has highest priority
-			config.LLM.Google.Model = *model
-			config.LLM.Anthropic.Model = *model
-			config.LLM.OpenAI.Model = *model
-			log.Printf("[AI Agent] Using model from CLI flag: %s", *model)
-		} else if envModel := os.Getenv("GEMINI_MODEL"); envModel != "" {
-			// Environment variable has second priority (Gemini-specific)
-			config.LLM.Google.Model = envModel
-			log.Printf("[AI Agent] Using model from GEMINI_MODEL env: %s", envModel)
-		}
+	absTempDir, _ := filepath.Abs(tempRoot)
+	absOutputDir, _ := filepath.Abs(outputDir)
+	systemPrompt := llm.CreateVideoGenerationPrompt(duration, absImagePath, toolAdapter.GetToolDescription(), absTempDir, absOutputDir)
 
-		log.Printf("[AI Agent] Initializing LLM provider: %s...", config.LLM.Provider)
-		provider, err := createLLMProvider(config.LLM)
-		if err != nil {
-			log.Fatalf("Failed to create LLM provider: %v", err)
+	var rounds []int
+	if historyPattern != "" {
+		if rounds, err = llm.HistoricalRounds(historyPattern); err != nil {
+			return err
 		}
-		llmProvider = provider
-		if llmProvider.IsEnabled() {
-			log.Printf("[AI Agent] %s enabled (mode: %s)", llmProvider.Name(), config.LLM.Mode)
-		} else {
-			log.Printf("[AI Agent] %s disabled (no API key)", llmProvider.Name())
-		}
-	} else {
-		log.Println("[AI Agent] LLM features disabled in config")
-		// Create disabled Claude provider as fallback
-		llmProvider, _ = createLLMProvider(types.LLMConfig{
-			Provider:  "anthropic",
-			Anthropic: types.AnthropicConfig{APIKey: ""},
-		})
-	}
-
-	// Determine AI mode (default to "lightweight" if not specified)
-	aiMode := config.LLM.Mode
-	if aiMode == "" {
-		aiMode = "lightweight"
 	}
 
-	// Create pipeline with all 4 MCP clients + LLM provider
-	pipe := pipeline.NewPipeline(
-		imagesorceryClient,
-		yoloClient,
-		videoClient,
-		musicClient,
-		llmProvider,
-		config.Pipeline.EnableMotion,
-		config.Pipeline.MaxRetries,
-		*manifestPath,
-		aiMode,
-	)
-
-	// Convert image path to absolute path (required for MCP servers)
-	absImagePath, err := filepath.Abs(*imagePath)
+	limits := pipeline.ResolveFullAILimits(config.FullAI)
+	maxRounds, maxCost := limits.MaxRounds, limits.MaxCostUSD
+
+	model := configuredModel(config)
+	estimate, err := llm.EstimateCost(llm.CostEstimateInput{
+		Provider:     config.Provider,
+		Model:        model,
+		ImageWidth:   width,
+		ImageHeight:  height,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Tools:        tools,
+		MaxRounds:    maxRounds,
+		Rounds:       rounds,
+	})
 	if err != nil {
-		log.Fatalf("Failed to convert image path to absolute: %v", err)
-	}
-
-	// Prepare input
-	input := types.PipelineInput{
-		ImagePath:  absImagePath,
-		Duration:   *duration,
-		UserPrompt: *userPrompt,
-		OutputDir:  *outputDir,
-		TempDir:    tempDir,
-	}
-
-	// Validate input
-	if err := pipeline.ValidateInput(input); err != nil {
-		log.Fatalf("Invalid input: %v", err)
+		return err
 	}
 
-	// Execute pipeline
-	log.Println("Starting pipeline execution...")
-	result, err := pipe.Execute(ctx, input, *pipelineID)
-	if err != nil {
-		log.Fatalf("Pipeline execution failed: %v", err)
+	roundsSource := "default assumption"
+	if len(rounds) > 0 {
+		roundsSource = fmt.Sprintf("from %d past traces", len(rounds))
 	}
 
-	// Display results
-	log.Println("\n=== Pipeline Completed Successfully ===")
-	log.Printf("Segmented Image: %s", result.SegmentedImagePath)
-	log.Printf("Landmarks Data: %s", result.LandmarksData)
-	if result.MotionVideoPath != "" {
-		log.Printf("Motion Video: %s", result.MotionVideoPath)
+	log.Println("\n=== Full AI Cost Estimate (no LLM calls made) ===")
+	log.Printf("Provider: %s (model: %s), $%.3f/$%.3f per 1M input/output tokens",
+		config.Provider, model, estimate.Pricing.InputPerMTok, estimate.Pricing.OutputPerMTok)
+	log.Printf("Image: %dx%d, ~%d tokens", width, height, estimate.ImageTokens)
+	log.Printf("Prompts: ~%d tokens, tool schemas: ~%d tokens (%d tools)", estimate.PromptTokens, estimate.ToolTokens, len(tools))
+	log.Printf("Rounds: %d-%d (%s)", estimate.RoundsLow, estimate.RoundsHigh, roundsSource)
+	log.Printf("Tokens: ~%d-%d", estimate.TokensLow, estimate.TokensHigh)
+	log.Printf("Estimated cost: $%.4f - $%.4f", estimate.LowUSD, estimate.HighUSD)
+	if estimate.HighUSD > maxCost {
+		log.Printf("Max cost: $%.2f (the high estimate exceeds it; the run may stop early)", maxCost)
+	} else {
+		log.Printf("Max cost: $%.2f", maxCost)
 	}
-	log.Printf("Music Tracks: %v", result.MusicTracks)
-	log.Printf("Final Output: %s", result.FinalOutputPath)
-	log.Println("=======================================")
+	log.Println("=================================================")
+	return nil
 }
 
-// loadConfig reads and parses the YAML configuration file
-func loadConfig(path string) (*types.Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	// Expand environment variables in the config file
-	expandedData := os.ExpandEnv(string(data))
-
-	var config types.Config
-	if err := yaml.Unmarshal([]byte(expandedData), &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+// configuredModel returns the model set for the configured provider
+func configuredModel(config types.LLMConfig) string {
+	switch config.Provider {
+	case "anthropic", "claude":
+		return config.Anthropic.Model
+	case "google", "gemini":
+		return config.Google.Model
+	case "openrouter":
+		return config.OpenRouter.Model
+	default:
+		return config.OpenAI.Model
 	}
-
-	return &config, nil
 }
 
 // createAndInitClient creates an MCP client, connects, and initializes
@@ -302,20 +259,83 @@ func createAndInitClient(ctx context.Context, config types.ServerConfig, name st
 	return mcpClient, nil
 }
 
-// validateServerTools checks if required tools are available
-func validateServerTools(ctx context.Context, mcpClient client.MCPClient, config types.ServerConfig) error {
+// validateServerTools checks if required tools are available and returns the server's tools
+func validateServerTools(ctx context.Context, mcpClient client.MCPClient, config types.ServerConfig) ([]types.Tool, error) {
 	tools, err := mcpClient.ListTools(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list tools: %w", err)
+		return nil, fmt.Errorf("failed to list tools: %w", err)
 	}
 
 	log.Printf("Server provides %d tools", len(tools))
 
 	// Validate required tools
 	if err := client.ValidateTools(tools, config.Capabilities.Tools); err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Printf("All required tools available: %v", config.Capabilities.Tools)
-	return nil
+
+	// An exposed tool the server lacks just isn't advertised, so the run goes on
+	if err := client.ValidateTools(tools, config.ExposeTools); err != nil {
+		log.Printf("Warning: expose_tools: %v", err)
+	}
+	return tools, nil
+}
+
+// exposedTools returns each server's expose_tools list, for servers that have one
+func exposedTools(servers map[string]types.ServerConfig) map[string][]string {
+	exposed := make(map[string][]string)
+	for name, server := range servers {
+		if len(server.ExposeTools) > 0 {
+			exposed[name] = server.ExposeTools
+		}
+	}
+	return exposed
+}
+
+// warmupTarget is a connected server to warm up
+type warmupTarget struct {
+	name   string
+	client client.MCPClient
+	tools  []types.Tool
+}
+
+// warmupServers warms all servers concurrently. Failures are logged, not fatal: the
+// stages retry against a server that is still cold.
+func warmupServers(ctx context.Context, targets []warmupTarget, servers map[string]types.ServerConfig) []client.WarmupResult {
+	canaryDir, err := os.MkdirTemp("", "agent-warmup-")
+	if err != nil {
+		log.Printf("Warning: skipping warmup: %v", err)
+		return nil
+	}
+	defer os.RemoveAll(canaryDir)
+
+	canaryPath, err := client.WriteCanaryImage(canaryDir)
+	if err != nil {
+		log.Printf("Warning: skipping warmup: %v", err)
+		return nil
+	}
+
+	results := make([]client.WarmupResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target warmupTarget) {
+			defer wg.Done()
+			results[i] = client.Warmup(ctx, target.client, target.name, target.tools, servers[target.name].Warmup, canaryPath)
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		switch {
+		case result.Tool == "":
+			continue
+		case result.Err != nil:
+			log.Printf("Warning: %s warmup failed after %.1fs: %v", result.Server, result.Duration.Seconds(), result.Err)
+		default:
+			log.Printf("Warmed up %s with %s in %.1fs", result.Server, result.Tool, result.Duration.Seconds())
+		}
+	}
+	return results
 }
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/internal/server"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// runCommand implements "agent run", also used for a bare "agent --image ...": it runs
+// one pipeline on an image. Returns the process exit code.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	var (
+		configPath   = flags.String("config", "configs/agent.yaml", "Path to configuration file")
+		imagePath    = flags.String("image", "", "Path to input image (required)")
+		duration     = flags.Float64("duration", 10.0, "Target duration in seconds")
+		userPrompt   = flags.String("prompt", "", "Your request (e.g., 'make a shake animation')")
+		manifestPath = flags.String("manifest", "", "Path to pipeline manifest (default: from config)")
+		pipelineID   = flags.String("id", "", "Pipeline ID for resume (default: auto-generate)")
+		outputDir    = flags.String("output", "output", "Output directory for generated files")
+		model        = flags.String("model", "", "Override LLM model (e.g., 'gemini-1.5-flash')")
+		serve        = flags.Bool("serve", false, "Run as a REST server accepting pipeline submissions (same as 'agent serve')")
+		noCache      = flags.Bool("no-cache", false, "Disable the segmentation/landmarks stage cache")
+		noCompaction = flags.Bool("no-history-compaction", false, "Resend the full conversation history every round in full AI mode")
+		jsonOutput   = flags.Bool("json", false, "Print a machine-readable JSON report to stdout")
+		noWarmup     = flags.Bool("no-warmup", false, "Skip warming up MCP server models before running")
+		traceFile    = flags.String("trace-file", "", "Write the full AI conversation to this JSON trace file")
+		traceJSON    = flags.String("trace-json", "", "Write a timeline of stages, tool calls and LLM rounds to this Chrome trace JSON file")
+		llmDebugDir  = flags.String("llm-debug-dir", "", "Dump sanitized LLM API requests and responses per round under this directory")
+		batchSummary = flags.String("batch-summary", "", "Append this run's outcome to batch_summary.csv and batch_summary.json in this directory")
+		allowAnyPath = flags.Bool("allow-any-path", false, "Let full AI tool calls write files outside the temp and output directories")
+		audio        = flags.String("audio", "", "Use this audio file as the soundtrack instead of searching for music")
+		animation    = flags.String("animation", "", "Animation sequence as type:seconds[:intensity], e.g. 'nod:5,zoom:5,shake:5'")
+		customFilter = flags.String("custom-filter", "", "FFmpeg filter chain of --animation's custom segments, with t as the time in seconds, e.g. \"rotate='0.1*sin(2*PI*t)'\"")
+		intensity    = flags.Float64("intensity", 0, "Intensity of rotate (degrees), shake and nod (pixels) segments without their own (default: scaled to the subject's size)")
+		estimateCost = flags.Bool("estimate-cost", false, "Print a rough full AI cost estimate and exit without calling the LLM")
+		estimateFrom = flags.String("estimate-history", "", "Glob of past trace files used to estimate the number of rounds")
+		snapshotOut  = flags.String("tools-snapshot", "", "Write the tools offered to the model in full AI mode to this JSON file")
+		snapshotIn   = flags.String("tools-from-snapshot", "", "Offer the tools from this JSON snapshot instead of discovering them live")
+		skipStages   = flags.String("skip-stages", "", "Comma-separated stages to skip, e.g. 'estimate_landmarks'; their servers aren't required")
+		composeOnly  = flags.Bool("compose-only", false, "Only run the compose stage on --video (or the --id manifest's motion video) with --audio")
+		videoPath    = flags.String("video", "", "Motion video to compose in --compose-only mode")
+		reanalyze    = flags.Bool("reanalyze", false, "When resuming --id, discard the stored decision and recompute it, rerunning only the stages it changes")
+		maxRounds    = flags.Int("max-rounds", 0, "Max full AI conversation rounds for this run (default: from config)")
+		maxTokens    = flags.Int("max-tokens", 0, "Max full AI tokens for this run (default: from config)")
+		maxCost      = flags.Float64("max-cost", 0, "Max full AI cost in USD for this run (default: from config)")
+		llmTimeout   = flags.Int("llm-timeout", 0, "Full AI conversation timeout in seconds for this run (default: from config)")
+		outputName   = flags.String("output-name", "", "Final output name: 'fixed' (final_output.<ext>), 'content-hash' (<sha256 prefix>.<ext> plus latest.<ext>) or a template like '{id}_{animation}_{mood}' (default: from config)")
+		comparison   = flags.Bool("comparison", false, "Also write a before/after video of the original beside the result (<output>_comparison.mp4)")
+		check        = flags.Bool("check", false, "Only check ffmpeg, the MCP servers and the LLM provider the run needs, print a readiness table and exit")
+	)
+	flags.Parse(args)
+
+	// The server flags predate the serve subcommand; pass on the ones it takes
+	if *serve {
+		serveFlags, _ := newServeFlags()
+		var serveArgs []string
+		flags.Visit(func(f *flag.Flag) {
+			if serveFlags.Lookup(f.Name) != nil {
+				serveArgs = append(serveArgs, "--"+f.Name+"="+f.Value.String())
+			}
+		})
+		return serveCommand(serveArgs)
+	}
+
+	// Validate required flags
+	if *composeOnly {
+		if *estimateCost {
+			fmt.Fprintln(usageOutput, "Error: --compose-only can't be combined with --estimate-cost")
+			return 2
+		}
+		if *videoPath == "" && *pipelineID == "" {
+			fmt.Fprintln(usageOutput, "Error: --compose-only needs --video, or --id of a run whose motion video to reuse")
+			return 2
+		}
+	} else if *imagePath == "" && !*check {
+		fmt.Fprintln(usageOutput, "Error: --image flag is required")
+		return 2
+	}
+
+	b, err := newBootstrap(*configPath)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+	config := b.config
+	b.setGracePeriod(pipeline.ResolveShutdownGracePeriod(config.Pipeline.ShutdownGracePeriod))
+	runCtx := pipeline.WithShutdown(b.ctx, b.stopping)
+
+	if *outputName != "" {
+		config.Pipeline.Output.Name = *outputName
+	}
+	if *comparison {
+		config.Pipeline.Comparison.Enabled = true
+	}
+
+	limits := types.FullAIConfig{MaxRounds: *maxRounds, MaxTokens: *maxTokens, MaxCostUSD: *maxCost, TimeoutSeconds: *llmTimeout}
+	if limits.MaxRounds < 0 || limits.MaxTokens < 0 || limits.MaxCostUSD < 0 || limits.TimeoutSeconds < 0 {
+		fmt.Fprintln(usageOutput, "Error: --max-rounds, --max-tokens, --max-cost and --llm-timeout must not be negative")
+		return 2
+	}
+	if config.LLM.Mode == "full_ai" || *estimateCost {
+		overrideFullAILimits(&config.LLM.FullAI, limits)
+	}
+
+	// Validate prompt requirement for Full AI mode
+	if config.LLM.Mode == "full_ai" && *userPrompt == "" && !*estimateCost && !*composeOnly && !*check {
+		fmt.Fprintln(usageOutput, "Error: --prompt flag is required in Full AI mode.\nExample: --prompt \"Generate a shake animation with the character's head moving left and right\"")
+		return 2
+	}
+
+	toolSnapshot, err := loadToolSnapshot(*snapshotIn)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFailure
+	}
+
+	// Plan the stages up front so a run only requires the servers its stages call
+	stageOrder, err := pipeline.ResolveStageOrder(config.Pipeline.Stages, pipeline.ParseStageList(*skipStages))
+	if err != nil {
+		log.Printf("Error: invalid --skip-stages: %v", err)
+		return 2
+	}
+	fullAI := config.LLM.Mode == "full_ai" || *estimateCost
+	if *composeOnly {
+		// Compose only needs ffmpeg, whatever the mode and stage list
+		stageOrder, fullAI = []types.PipelineStage{types.StageCompose}, false
+	}
+
+	// Diagnose the environment without running anything
+	if *check {
+		rows := checkHealth(b, stageOrder, fullAI, *model)
+		printHealth(commandOutput, rows)
+		if healthFailed(rows) {
+			return exitFailure
+		}
+		return 0
+	}
+
+	rt, err := setupRuntime(b, runtimeOptions{
+		stages:       stageOrder,
+		fullAI:       fullAI,
+		noWarmup:     *noWarmup || *estimateCost,
+		noCache:      *noCache,
+		noCompaction: *noCompaction,
+		model:        *model,
+		toolSnapshot: toolSnapshot,
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFailure
+	}
+	defer rt.close()
+
+	// Estimate the bill for a full AI run and stop before any LLM request
+	if *estimateCost {
+		if err := printCostEstimate(b.ctx, config.LLM, rt.mcpClients, exposedTools(config.Servers), toolSnapshot, *imagePath, *duration, *userPrompt, *outputDir, *estimateFrom); err != nil {
+			log.Printf("Cost estimate failed: %v", err)
+			return exitFailure
+		}
+		return 0
+	}
+
+	// Generate pipeline ID if not provided
+	if *pipelineID == "" {
+		*pipelineID = fmt.Sprintf("pipeline-%d", time.Now().Unix())
+	}
+
+	*manifestPath, err = b.manifestPath(*manifestPath, *pipelineID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return 2
+	}
+	if config.Pipeline.ManifestDir != "" {
+		if err := os.MkdirAll(config.Pipeline.ManifestDir, 0755); err != nil {
+			log.Printf("Failed to create manifest directory: %v", err)
+			return exitFailure
+		}
+	}
+
+	log.Printf("Readiness:")
+	printHealth(log.Writer(), runtimeHealth(config, rt, stageOrder, fullAI))
+
+	log.Printf("Starting agent-funpic-act")
+	log.Printf("Pipeline ID: %s", *pipelineID)
+	log.Printf("Manifest: %s", *manifestPath)
+	log.Printf("Image: %s", *imagePath)
+	log.Printf("Duration: %.1fs", *duration)
+	log.Printf("Output Directory: %s", *outputDir)
+
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		log.Printf("Failed to create output directory: %v", err)
+		return exitFailure
+	}
+
+	// Create temporary directory for intermediate files
+	tempDir := filepath.Join(tempRoot, *pipelineID)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("Failed to create temporary directory: %v", err)
+		return exitFailure
+	}
+	log.Printf("Temporary Directory: %s", tempDir)
+
+	pipe := rt.newPipeline(*manifestPath)
+	pipe.SetTraceFile(*traceFile)
+	pipe.SetTraceJSONFile(*traceJSON)
+	pipe.SetLLMDebugDir(*llmDebugDir)
+	pipe.SetAllowAnyPath(*allowAnyPath)
+	pipe.SetToolSnapshotFile(*snapshotOut)
+	pipe.SetReanalyze(*reanalyze)
+
+	// Convert image path to absolute path (required for MCP servers)
+	var absImagePath string
+	if *imagePath != "" {
+		absImagePath, err = filepath.Abs(*imagePath)
+		if err != nil {
+			log.Printf("Failed to convert image path to absolute: %v", err)
+			return exitFailure
+		}
+	}
+
+	// Prepare input
+	input := types.PipelineInput{
+		ImagePath:  absImagePath,
+		Duration:   *duration,
+		UserPrompt: *userPrompt,
+		OutputDir:  *outputDir,
+		TempDir:    tempDir,
+		Intensity:  *intensity,
+	}
+
+	if *audio != "" {
+		absAudioPath, err := filepath.Abs(*audio)
+		if err != nil {
+			log.Printf("Failed to convert audio path to absolute: %v", err)
+			return exitFailure
+		}
+		input.AudioPath = absAudioPath
+	}
+
+	if *animation != "" {
+		plan, err := pipeline.ParseAnimationPlan(*animation, *customFilter)
+		if err != nil {
+			log.Printf("Invalid --animation: %v", err)
+			return 2
+		}
+		input.AnimationPlan = plan
+	}
+
+	var result *pipeline.PipelineResult
+	if *composeOnly {
+		var absVideoPath string
+		if *videoPath != "" {
+			absVideoPath, err = filepath.Abs(*videoPath)
+			if err != nil {
+				log.Printf("Failed to convert video path to absolute: %v", err)
+				return exitFailure
+			}
+		}
+		log.Println("Starting compose-only run...")
+		result, err = pipe.ComposeOnly(runCtx, input, absVideoPath, *pipelineID)
+	} else {
+		// Validate input
+		if err := pipeline.ValidateInput(input); err != nil {
+			log.Printf("Invalid input: %v", err)
+			appendBatchSummary(*batchSummary, nil, input, *pipelineID, err, 0)
+			return exitFailure
+		}
+
+		// Execute pipeline
+		log.Println("Starting pipeline execution...")
+		started := time.Now()
+		result, err = pipe.Execute(runCtx, input, *pipelineID)
+		appendBatchSummary(*batchSummary, pipe, input, *pipelineID, err, time.Since(started))
+	}
+	if *jsonOutput {
+		writeReport(*pipelineID, result, rt.warmups, err)
+	}
+	if err != nil {
+		log.Printf("Pipeline execution failed: %v", err)
+		return exitCodeFor(err)
+	}
+
+	printResult(result, rt.warmups)
+	return 0
+}
+
+// appendBatchSummary adds the outcome of a run to the batch summary in dir, when set.
+// A summary that can't be written doesn't fail the run; pipe is nil for a run that never started, which has no manifest to read.
+func appendBatchSummary(dir string, pipe *pipeline.Pipeline, input types.PipelineInput, pipelineID string, err error, elapsed time.Duration) {
+	if dir == "" {
+		return
+	}
+	var manifest *pipeline.Manifest
+	if pipe != nil {
+		var loadErr error
+		if manifest, loadErr = pipe.SavedManifest(context.Background()); loadErr != nil {
+			log.Printf("Warning: batch summary without the manifest: %v", loadErr)
+		}
+	}
+	row := pipeline.NewBatchSummaryRow(input, pipelineID, manifest, err, elapsed)
+	if err := pipeline.AppendBatchSummary(dir, row); err != nil {
+		log.Printf("Warning: failed to write batch summary: %v", err)
+		return
+	}
+	log.Printf("Batch summary updated: %s", filepath.Join(dir, pipeline.BatchSummaryCSVName))
+}
+
+// overrideFullAILimits replaces the configured full AI limits with the positive ones in
+// overrides, then logs the effective limits and where each came from
+func overrideFullAILimits(config *types.FullAIConfig, overrides types.FullAIConfig) {
+	source := func(flagSet, configSet bool) string {
+		switch {
+		case flagSet:
+			return "flag"
+		case configSet:
+			return "config"
+		}
+		return "default"
+	}
+	sources := []string{
+		source(overrides.MaxRounds > 0, config.MaxRounds > 0),
+		source(overrides.MaxTokens > 0, config.MaxTokens > 0),
+		source(overrides.MaxCostUSD > 0, config.MaxCostUSD > 0),
+		source(overrides.TimeoutSeconds > 0, config.TimeoutSeconds > 0),
+	}
+
+	if overrides.MaxRounds > 0 {
+		config.MaxRounds = overrides.MaxRounds
+	}
+	if overrides.MaxTokens > 0 {
+		config.MaxTokens = overrides.MaxTokens
+	}
+	if overrides.MaxCostUSD > 0 {
+		config.MaxCostUSD = overrides.MaxCostUSD
+	}
+	if overrides.TimeoutSeconds > 0 {
+		config.TimeoutSeconds = overrides.TimeoutSeconds
+	}
+
+	effective := pipeline.ResolveFullAILimits(*config)
+	log.Printf("Full AI limits: %d rounds (%s), %d tokens (%s), $%.2f (%s), %ds timeout (%s)",
+		effective.MaxRounds, sources[0], effective.MaxTokens, sources[1],
+		effective.MaxCostUSD, sources[2], effective.TimeoutSeconds, sources[3])
+}
+
+// serveOptions are the flags of "agent serve"
+type serveOptions struct {
+	configPath   *string
+	model        *string
+	noCache      *bool
+	noCompaction *bool
+	noWarmup     *bool
+	snapshotIn   *string
+	skipStages   *string
+}
+
+// newServeFlags defines the flags of "agent serve"
+func newServeFlags() (*flag.FlagSet, *serveOptions) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	return flags, &serveOptions{
+		configPath:   flags.String("config", "configs/agent.yaml", "Path to configuration file"),
+		model:        flags.String("model", "", "Override LLM model (e.g., 'gemini-1.5-flash')"),
+		noCache:      flags.Bool("no-cache", false, "Disable the segmentation/landmarks stage cache"),
+		noCompaction: flags.Bool("no-history-compaction", false, "Resend the full conversation history every round in full AI mode"),
+		noWarmup:     flags.Bool("no-warmup", false, "Skip warming up MCP server models before serving"),
+		snapshotIn:   flags.String("tools-from-snapshot", "", "Offer the tools from this JSON snapshot instead of discovering them live"),
+		skipStages:   flags.String("skip-stages", "", "Comma-separated stages to skip, e.g. 'estimate_landmarks'; their servers aren't required"),
+	}
+}
+
+// serveCommand implements "agent serve": it accepts pipeline submissions over REST
+// until interrupted. Returns the process exit code.
+func serveCommand(args []string) int {
+	flags, opts := newServeFlags()
+	flags.Parse(args)
+
+	b, err := newBootstrap(*opts.configPath)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFailure
+	}
+	defer b.close()
+
+	toolSnapshot, err := loadToolSnapshot(*opts.snapshotIn)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFailure
+	}
+	stageOrder, err := pipeline.ResolveStageOrder(b.config.Pipeline.Stages, pipeline.ParseStageList(*opts.skipStages))
+	if err != nil {
+		log.Printf("Error: invalid --skip-stages: %v", err)
+		return 2
+	}
+
+	rt, err := setupRuntime(b, runtimeOptions{
+		stages:       stageOrder,
+		fullAI:       b.config.LLM.Mode == "full_ai",
+		noWarmup:     *opts.noWarmup,
+		noCache:      *opts.noCache,
+		noCompaction: *opts.noCompaction,
+		model:        *opts.model,
+		toolSnapshot: toolSnapshot,
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFailure
+	}
+	defer rt.close()
+
+	// Run drains in-flight pipelines before returning, so the deferred MCP client
+	// closes happen last
+	srv, err := server.New(b.config.Serve, rt.newPipeline)
+	if err != nil {
+		log.Printf("Failed to create server: %v", err)
+		return exitFailure
+	}
+	for _, target := range rt.warmupTargets {
+		srv.AddDependency(target.name, func(ctx context.Context) error {
+			return client.Ping(ctx, target.client)
+		})
+	}
+	if b.config.LLM.Enabled {
+		srv.AddDependency("llm", func(ctx context.Context) error {
+			if !rt.llmProvider.IsEnabled() {
+				return fmt.Errorf("%s provider has no API key", rt.llmProvider.Name())
+			}
+			return nil
+		})
+	}
+	if err := srv.Run(b.ctx); err != nil {
+		log.Printf("Server failed: %v", err)
+		return exitFailure
+	}
+	return 0
+}
+
+// loadToolSnapshot loads the pinned tool set before connecting, so a bad snapshot
+// fails fast. An empty path returns nil.
+func loadToolSnapshot(path string) (*llm.ToolSnapshot, error) {
+	if path == "" {
+		return nil, nil
+	}
+	snapshot, err := llm.LoadToolSnapshot(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tool snapshot: %w", err)
+	}
+	log.Printf("[AI Agent] Using %d tools from snapshot %s (taken %s)",
+		len(snapshot.Tools), path, snapshot.CreatedAt.Format(time.RFC3339))
+	return snapshot, nil
+}
+
+// printResult displays a finished run's artifacts
+func printResult(result *pipeline.PipelineResult, warmups []client.WarmupResult) {
+	log.Println("\n=== Pipeline Completed Successfully ===")
+	if result.ImageDescription != "" {
+		log.Printf("Image Description: %s", result.ImageDescription)
+	}
+	log.Printf("Segmented Image: %s", result.SegmentedImagePath)
+	log.Printf("Landmarks Data: %s", result.LandmarksData)
+	if result.MotionVideoPath != "" {
+		log.Printf("Motion Video: %s", result.MotionVideoPath)
+	}
+	log.Printf("Music Tracks: %v", result.MusicTracks)
+	if result.MusicQuality != "" {
+		log.Printf("Music Quality: %s", result.MusicQuality)
+	}
+	log.Printf("Final Output: %s", result.FinalOutputPath)
+	if result.LLMDebugDir != "" {
+		log.Printf("LLM Debug Dumps: %s", result.LLMDebugDir)
+	}
+	if len(result.Provenance) > 0 {
+		log.Println("Provenance:")
+		artifacts := make([]string, 0, len(result.Provenance))
+		for artifact := range result.Provenance {
+			artifacts = append(artifacts, artifact)
+		}
+		sort.Strings(artifacts)
+		for _, artifact := range artifacts {
+			log.Printf("  %s: %s", artifact, describeProvenance(result.Provenance[artifact]))
+		}
+	}
+	if result.TotalArtifactBytes > 0 {
+		var stages []string
+		for _, stage := range pipeline.GetStageOrder() {
+			if bytes, ok := result.ArtifactBytes[stage]; ok {
+				stages = append(stages, fmt.Sprintf("%s %s", stage, pipeline.FormatBytes(bytes)))
+			}
+		}
+		log.Printf("Artifacts: %s (%s)", pipeline.FormatBytes(result.TotalArtifactBytes), strings.Join(stages, ", "))
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	for _, warmup := range warmups {
+		if warmup.Tool != "" {
+			log.Printf("Warmup %s: %.1fs (%s)", warmup.Server, warmup.Duration.Seconds(), warmup.Tool)
+		}
+	}
+	log.Println("=======================================")
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/internal/secrets"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// runtimeOptions selects what setupRuntime connects and how pipelines are configured
+type runtimeOptions struct {
+	stages       []types.PipelineStage // Planned stages; only their servers are connected
+	fullAI       bool                  // Connect every server full AI mode offers the model
+	noWarmup     bool
+	noCache      bool
+	noCompaction bool
+	model        string // Overrides the configured LLM model
+	toolSnapshot *llm.ToolSnapshot
+}
+
+// runtime holds the connected servers and LLM provider that pipelines are built from
+type runtime struct {
+	mcpClients    map[string]client.MCPClient
+	warmupTargets []warmupTarget
+	warmups       []client.WarmupResult
+	llmProvider   llm.Provider
+	aiMode        string
+
+	// newPipeline creates a pipeline with all 4 MCP clients + LLM provider
+	newPipeline func(manifestPath string) *pipeline.Pipeline
+}
+
+// close disconnects the MCP servers
+func (r *runtime) close() {
+	for _, mcpClient := range r.mcpClients {
+		mcpClient.Close()
+	}
+}
+
+// setupRuntime connects the servers the planned stages need, warms them up, creates the
+// LLM provider and validates the pipeline config. Call close on the result when done.
+func setupRuntime(b *bootstrap, opts runtimeOptions) (*runtime, error) {
+	config := b.config
+	requirements, err := pipeline.RequiredServers(opts.fullAI, opts.stages)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	// Create, initialize and validate the required MCP clients
+	rt := &runtime{mcpClients: make(map[string]client.MCPClient)}
+	for _, req := range requirements {
+		if req.Binary {
+			if _, err := exec.LookPath(req.Name); err != nil {
+				rt.close()
+				return nil, fmt.Errorf("%s not found (%s): %w", req.Name, req.NeededBy(), err)
+			}
+			continue
+		}
+
+		mcpClient, err := createAndInitClient(b.ctx, config.Servers[req.Name], req.Name)
+		if err != nil {
+			rt.close()
+			return nil, fmt.Errorf("failed to initialize %s client (%s): %w", req.Name, req.NeededBy(), err)
+		}
+		rt.mcpClients[req.Name] = mcpClient
+
+		tools, err := validateServerTools(b.ctx, mcpClient, config.Servers[req.Name])
+		if err != nil {
+			rt.close()
+			return nil, fmt.Errorf("%s server validation failed (%s): %w", req.Name, req.NeededBy(), err)
+		}
+		rt.warmupTargets = append(rt.warmupTargets, warmupTarget{req.Name, mcpClient, tools})
+	}
+	for _, server := range pipeline.AllServers() {
+		if rt.mcpClients[server] == nil {
+			log.Printf("Skipping %s server: no planned stage needs it", server)
+		}
+	}
+
+	// Warm up servers so the first real stage doesn't wait on model downloads
+	if !opts.noWarmup {
+		rt.warmups = warmupServers(b.ctx, rt.warmupTargets, config.Servers)
+	}
+
+	// Initialize LLM provider (AI Agent feature); without one the pipeline runs its
+	// stages with the default decision
+	if config.LLM.Enabled {
+		if err := secrets.ResolveLLMConfig(b.ctx, &config.LLM); err != nil {
+			rt.close()
+			return nil, fmt.Errorf("invalid llm config: %w", err)
+		}
+
+		// Model override priority: CLI flag > ENV var > config file
+		if opts.model != "" {
+			// Command-line flag has highest priority
+			config.LLM.Google.Model = opts.model
+			config.LLM.Anthropic.Model = opts.model
+			config.LLM.OpenAI.Model = opts.model
+			log.Printf("[AI Agent] Using model from CLI flag: %s", opts.model)
+		} else if envModel := os.Getenv("GEMINI_MODEL"); envModel != "" {
+			// Environment variable has second priority (Gemini-specific)
+			config.LLM.Google.Model = envModel
+			log.Printf("[AI Agent] Using model from GEMINI_MODEL env: %s", envModel)
+		}
+
+		log.Printf("[AI Agent] Initializing LLM provider: %s...", config.LLM.Provider)
+		provider, err := createLLMProvider(config.LLM)
+		if err != nil {
+			rt.close()
+			return nil, fmt.Errorf("failed to create LLM provider: %w", err)
+		}
+		rt.llmProvider = provider
+		if provider.IsEnabled() {
+			log.Printf("[AI Agent] %s enabled (mode: %s)", provider.Name(), config.LLM.Mode)
+		} else {
+			log.Printf("[AI Agent] %s disabled (no API key)", provider.Name())
+		}
+	}
+
+	// Determine AI mode (default to "lightweight" if not specified)
+	rt.aiMode = config.LLM.Mode
+	if rt.aiMode == "" {
+		rt.aiMode = "lightweight"
+	}
+
+	rt.newPipeline, err = pipelineFactory(config, rt, opts)
+	if err != nil {
+		rt.close()
+		return nil, err
+	}
+	return rt, nil
+}
+
+// pipelineFactory validates the pipeline config and returns a function creating
+// pipelines configured with it
+func pipelineFactory(config *types.Config, rt *runtime, opts runtimeOptions) (func(string) *pipeline.Pipeline, error) {
+	// Reject impossible container/codec combinations before any work starts
+	outputConfig, err := pipeline.ResolveOutputConfig(config.Pipeline.Output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.output config: %w", err)
+	}
+	renderConfig, err := pipeline.ResolveRenderConfig(config.Pipeline.Render, outputConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.render config: %w", err)
+	}
+
+	composeFailure, err := pipeline.ResolveComposeFailure(config.Pipeline.ComposeFailure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	durationSource, err := pipeline.ResolveDurationSource(config.Pipeline.DurationSource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	jpegQuality, err := pipeline.ResolveJPEGQuality(config.Pipeline.JPEGQuality)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	if err := pipeline.ValidateMaxPolygonPoints(config.Pipeline.MaxPolygonPoints); err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	segmentFormat, err := pipeline.ResolveSegmentOutputFormat(config.Pipeline.SegmentOutputFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	subjectConfig, err := pipeline.ResolveSubjectConfig(config.Pipeline.Subjects)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.subjects config: %w", err)
+	}
+
+	placementConfig, err := pipeline.ResolvePlacementConfig(config.Pipeline.Placement)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.placement config: %w", err)
+	}
+	if placementConfig.Background != "" && subjectConfig.Mode == pipeline.SubjectModePerPerson {
+		return nil, fmt.Errorf("invalid pipeline.placement config: a background can't be combined with subjects mode %s", pipeline.SubjectModePerPerson)
+	}
+
+	landmarksConfig, err := pipeline.ResolveLandmarksConfig(config.Pipeline.Landmarks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.landmarks config: %w", err)
+	}
+
+	if _, err := pipeline.ResolveMusicSelection(config.Pipeline.Music.Selection); err != nil {
+		return nil, fmt.Errorf("invalid pipeline.music config: %w", err)
+	}
+	if err := pipeline.ValidateCaptionConfig(config.Pipeline.Caption); err != nil {
+		return nil, fmt.Errorf("invalid pipeline.caption config: %w", err)
+	}
+	comparisonConfig, err := pipeline.ResolveComparisonConfig(config.Pipeline.Comparison)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.comparison config: %w", err)
+	}
+	captionsConfig, err := pipeline.ResolveCaptionsConfig(config.Pipeline.Captions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline.captions config: %w", err)
+	}
+
+	// Stage cache is shared by every pipeline this process runs
+	var stageCache *pipeline.StageCache
+	if config.Pipeline.CacheDir != "" && !opts.noCache {
+		stageCache, err = pipeline.NewStageCache(config.Pipeline.CacheDir, int64(config.Pipeline.CacheMaxMB)<<20)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stage cache: %w", err)
+		}
+		log.Printf("Stage cache: %s", config.Pipeline.CacheDir)
+	}
+
+	if opts.noCompaction {
+		config.LLM.FullAI.HistoryCompaction.Disabled = true
+	}
+
+	return func(manifestPath string) *pipeline.Pipeline {
+		pipe := pipeline.NewPipeline(
+			rt.mcpClients[pipeline.ServerImageSorcery],
+			rt.mcpClients[pipeline.ServerYOLO],
+			rt.mcpClients[pipeline.ServerVideo],
+			rt.mcpClients[pipeline.ServerMusic],
+			rt.llmProvider,
+			config.Pipeline.EnableMotion,
+			config.Pipeline.MaxRetries,
+			manifestPath,
+			rt.aiMode,
+		)
+		pipe.SetFullAIConfig(config.LLM.FullAI)
+		pipe.SetMaxProcessDimension(config.Pipeline.MaxProcessDimension)
+		pipe.SetJPEGQuality(jpegQuality)
+		pipe.SetMaxPolygonPoints(config.Pipeline.MaxPolygonPoints)
+		pipe.SetSegmentOutputFormat(segmentFormat)
+		pipe.SetMinSubjectConfidence(config.Pipeline.MinSubjectConfidence)
+		pipe.SetMusicConfig(config.Pipeline.Music)
+		pipe.SetStageCache(stageCache)
+		pipe.SetTitleMetadata(config.Pipeline.TitleMetadata)
+		pipe.SetEventLog(!config.Pipeline.DisableEventLog)
+		pipe.SetStageOrder(opts.stages)
+		pipe.SetParallelAnalysis(config.Pipeline.ParallelAnalysis)
+		pipe.SetOutputConfig(outputConfig)
+		pipe.SetRenderConfig(renderConfig)
+		pipe.SetCaptionConfig(config.Pipeline.Caption)
+		pipe.SetCaptionsConfig(captionsConfig)
+		pipe.SetComparisonConfig(comparisonConfig)
+		pipe.SetSubjectConfig(subjectConfig)
+		pipe.SetPlacementConfig(placementConfig)
+		pipe.SetLandmarksConfig(landmarksConfig)
+		pipe.SetComposeFailure(composeFailure)
+		pipe.SetDurationSource(durationSource)
+		pipe.SetStageTimeout(config.Pipeline.StageTimeout)
+		pipe.SetOrphanedStageAge(config.Pipeline.OrphanedStageAge)
+		pipe.SetRepairConfig(config.Pipeline.Repair)
+		pipe.SetToolSnapshot(opts.toolSnapshot)
+		pipe.SetExposedTools(exposedTools(config.Servers))
+		return pipe
+	}, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/internal/selftest"
+)
+
+// selftestCommand implements "agent selftest": it runs the lightweight pipeline on a
+// bundled sample image with in-process fake MCP servers and the real ffmpeg, and checks
+// the video with ffprobe. It needs no config, server or API key. Returns the process
+// exit code.
+func selftestCommand(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	keep := flags.Bool("keep", false, "Keep the self-test directory with its output video")
+	duration := flags.Float64("duration", selftest.DefaultDuration, "Seconds of video to render")
+	verbose := flags.Bool("verbose", false, "Show the pipeline's log")
+	flags.Parse(args)
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := selftest.Run(ctx, selftest.Options{Duration: *duration, Keep: *keep})
+	if err != nil {
+		fmt.Fprintf(commandOutput, "[FAIL] selftest: %v\n", err)
+		if *keep && report != nil {
+			fmt.Fprintf(commandOutput, "Files kept in %s\n", report.Dir)
+		}
+		return exitFailure
+	}
+
+	fmt.Fprintf(commandOutput, "[ok]   selftest: %.2fs video with %s streams, %s, in %s\n",
+		report.Duration, strings.Join(report.Streams, "+"), pipeline.FormatBytes(report.OutputBytes),
+		report.Elapsed.Round(100*time.Millisecond))
+	if *keep {
+		fmt.Fprintf(commandOutput, "Output kept at %s\n", report.OutputPath)
+	}
+	return 0
+}
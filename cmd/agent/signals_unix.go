@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals stop the agent gracefully
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
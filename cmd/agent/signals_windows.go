@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// shutdownSignals stop the agent gracefully. Windows delivers Ctrl+C and Ctrl+Break as
+// os.Interrupt; there is no SIGTERM to subscribe to.
+var shutdownSignals = []os.Signal{os.Interrupt}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/activity"
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+)
+
+// writeStatusDump writes what every running pipeline is doing and where the MCP
+// transport goroutines are blocked
+func writeStatusDump(w io.Writer) {
+	fmt.Fprintf(w, "=== Status dump at %s ===\n", time.Now().Format("15:04:05.000"))
+	activity.Default.WriteStatus(w)
+	fmt.Fprintln(w, "--- Transport goroutines ---")
+	activity.WriteGoroutines(w, client.TransportGoroutines...)
+	fmt.Fprintln(w, "=== End of status dump ===")
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// dumpStatusOnSignal is a no-op where SIGUSR1 doesn't exist
+func dumpStatusOnSignal() {}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// dumpStatusOnSignal writes a status dump to stderr each time the process receives
+// SIGUSR1, e.g. from "kill -USR1 <pid>" when a pipeline seems stuck
+func dumpStatusOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			writeStatusDump(os.Stderr)
+		}
+	}()
+}
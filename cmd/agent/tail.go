@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+)
+
+// tempRoot holds the per-pipeline temporary directories of CLI runs
+const tempRoot = ".pipeline_tmp"
+
+// runTail implements "agent tail": it pretty-prints a pipeline's event log and, by
+// default, follows it until the run finishes. Returns the process exit code.
+func runTail(args []string) int {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	pipelineID := flags.String("id", "", "Pipeline ID whose events to show")
+	file := flags.String("file", "", "Event log to show (default: "+filepath.Join(tempRoot, "<id>", pipeline.EventLogFileName)+")")
+	follow := flags.Bool("follow", true, "Wait for new events until the run finishes")
+	flags.Parse(args)
+
+	path := *file
+	if path == "" {
+		if *pipelineID == "" {
+			fmt.Fprintln(os.Stderr, "Usage: agent tail --id <pipeline> [--file events.jsonl] [--follow=false]")
+			return 2
+		}
+		path = filepath.Join(tempRoot, *pipelineID, pipeline.EventLogFileName)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+	if err := pipeline.TailEvents(ctx, path, *follow, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "tail: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,200 @@
+// Package activity tracks what each running pipeline is doing right now: its stage,
+// in-flight tool calls and LLM round, so a process that seems stuck can dump its status
+package activity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ToolCall is an MCP tool call that hasn't returned yet
+type ToolCall struct {
+	Server  string
+	Tool    string
+	Started time.Time
+}
+
+// Pipeline is the current activity of one pipeline
+type Pipeline struct {
+	ID           string
+	Stage        string
+	StageStarted time.Time
+	ToolCalls    []ToolCall // In flight, oldest first
+	LLMRound     int        // Last completed model round in full AI mode
+	LLMTokens    int        // Input and output tokens used so far
+}
+
+// Registry holds the activity of the running pipelines. It is safe for concurrent use.
+type Registry struct {
+	mu        sync.Mutex
+	pipelines map[string]*pipelineState
+	nextCall  uint64
+	now       func() time.Time
+}
+
+// pipelineState is a pipeline's activity with its in-flight calls by ID
+type pipelineState struct {
+	Pipeline
+	calls map[uint64]ToolCall
+}
+
+// Default is the registry the pipeline and tool adapter report to
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		pipelines: make(map[string]*pipelineState),
+		now:       time.Now,
+	}
+}
+
+// state returns the entry for id, creating it. Must be called with r.mu held.
+func (r *Registry) state(id string) *pipelineState {
+	state, ok := r.pipelines[id]
+	if !ok {
+		state = &pipelineState{Pipeline: Pipeline{ID: id}, calls: make(map[uint64]ToolCall)}
+		r.pipelines[id] = state
+	}
+	return state
+}
+
+// Finish forgets a pipeline once its run has ended
+func (r *Registry) Finish(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pipelines, id)
+}
+
+// SetStage records the stage a pipeline has started
+func (r *Registry) SetStage(id, stage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.state(id)
+	state.Stage = stage
+	state.StageStarted = r.now()
+}
+
+// StartToolCall records a call to tool on server; the returned function marks it done
+func (r *Registry) StartToolCall(id, server, tool string) (done func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextCall++
+	callID := r.nextCall
+	r.state(id).calls[callID] = ToolCall{Server: server, Tool: tool, Started: r.now()}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		state, ok := r.pipelines[id]
+		if !ok {
+			return
+		}
+		delete(state.calls, callID)
+		// A call made outside a tracked pipeline leaves nothing worth reporting
+		if len(state.calls) == 0 && state.Stage == "" && state.LLMRound == 0 {
+			delete(r.pipelines, id)
+		}
+	}
+}
+
+// RecordLLMRound records a completed model round and the tokens it used
+func (r *Registry) RecordLLMRound(id string, round, tokens int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.state(id)
+	state.LLMRound = round
+	state.LLMTokens += tokens
+}
+
+// Snapshot returns the activity of every running pipeline, by ID
+func (r *Registry) Snapshot() []Pipeline {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pipelines := make([]Pipeline, 0, len(r.pipelines))
+	for _, state := range r.pipelines {
+		pipeline := state.Pipeline
+		pipeline.ToolCalls = make([]ToolCall, 0, len(state.calls))
+		for _, call := range state.calls {
+			pipeline.ToolCalls = append(pipeline.ToolCalls, call)
+		}
+		sort.Slice(pipeline.ToolCalls, func(i, j int) bool {
+			return pipeline.ToolCalls[i].Started.Before(pipeline.ToolCalls[j].Started)
+		})
+		pipelines = append(pipelines, pipeline)
+	}
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].ID < pipelines[j].ID })
+	return pipelines
+}
+
+// WriteStatus writes the activity of every running pipeline, with elapsed times
+func (r *Registry) WriteStatus(w io.Writer) {
+	now := r.now()
+	pipelines := r.Snapshot()
+	if len(pipelines) == 0 {
+		fmt.Fprintln(w, "No pipeline running")
+		return
+	}
+	for _, p := range pipelines {
+		fmt.Fprintf(w, "Pipeline %s\n", p.ID)
+		if p.Stage != "" {
+			fmt.Fprintf(w, "  stage:     %s, running for %s\n", p.Stage, elapsed(now, p.StageStarted))
+		}
+		for _, call := range p.ToolCalls {
+			fmt.Fprintf(w, "  tool call: %s/%s, running for %s\n", call.Server, call.Tool, elapsed(now, call.Started))
+		}
+		if p.LLMRound > 0 {
+			fmt.Fprintf(w, "  llm:       round %d, %d tokens\n", p.LLMRound, p.LLMTokens)
+		}
+	}
+}
+
+// elapsed formats the time since start to the millisecond
+func elapsed(now, start time.Time) time.Duration {
+	return now.Sub(start).Round(time.Millisecond)
+}
+
+// WriteGoroutines writes the stacks of the goroutines whose stack mentions any of
+// markers, e.g. a transport's read loop, to show where they are blocked
+func WriteGoroutines(w io.Writer, markers ...string) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		for _, marker := range markers {
+			if strings.Contains(string(stack), marker) {
+				fmt.Fprintf(w, "%s\n\n", stack)
+				break
+			}
+		}
+	}
+}
+
+// pipelineKey is the context key of the running pipeline's ID
+type pipelineKey struct{}
+
+// WithPipeline returns a context reporting activity for pipeline id
+func WithPipeline(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, pipelineKey{}, id)
+}
+
+// PipelineID returns the pipeline set with WithPipeline, or "" outside a pipeline
+func PipelineID(ctx context.Context) string {
+	id, _ := ctx.Value(pipelineKey{}).(string)
+	return id
+}
@@ -0,0 +1,104 @@
+package activity
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRegistry verifies stages, tool calls and LLM rounds are tracked per pipeline
+func TestRegistry(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	r := NewRegistry()
+	r.now = func() time.Time { return now }
+
+	r.SetStage("run-1", "render_motion")
+	doneDetect := r.StartToolCall("run-1", "imagesorcery", "detect")
+	now = now.Add(2 * time.Second)
+	doneFill := r.StartToolCall("run-1", "imagesorcery", "fill")
+	r.RecordLLMRound("run-2", 1, 1200)
+	r.RecordLLMRound("run-2", 2, 800)
+	now = now.Add(3 * time.Second)
+
+	snapshot := r.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].ID != "run-1" || snapshot[1].ID != "run-2" {
+		t.Fatalf("Expected run-1 and run-2, got %+v", snapshot)
+	}
+	run1 := snapshot[0]
+	if run1.Stage != "render_motion" || len(run1.ToolCalls) != 2 || run1.ToolCalls[0].Tool != "detect" {
+		t.Errorf("Expected render_motion with detect then fill in flight, got %+v", run1)
+	}
+	if run2 := snapshot[1]; run2.LLMRound != 2 || run2.LLMTokens != 2000 {
+		t.Errorf("Expected round 2 with 2000 tokens, got %+v", run2)
+	}
+
+	var status bytes.Buffer
+	r.WriteStatus(&status)
+	for _, want := range []string{
+		"stage:     render_motion, running for 5s",
+		"tool call: imagesorcery/detect, running for 5s",
+		"tool call: imagesorcery/fill, running for 3s",
+		"llm:       round 2, 2000 tokens",
+	} {
+		if !strings.Contains(status.String(), want) {
+			t.Errorf("Expected %q in the status, got:\n%s", want, status.String())
+		}
+	}
+
+	doneDetect()
+	doneFill()
+	doneFill() // Calling done twice is harmless
+	if calls := r.Snapshot()[0].ToolCalls; len(calls) != 0 {
+		t.Errorf("Expected no call in flight, got %+v", calls)
+	}
+
+	r.Finish("run-1")
+	r.Finish("run-2")
+	status.Reset()
+	r.WriteStatus(&status)
+	if !strings.Contains(status.String(), "No pipeline running") {
+		t.Errorf("Expected no pipeline after Finish, got:\n%s", status.String())
+	}
+}
+
+// TestRegistryUntrackedCall verifies a call made outside a pipeline is forgotten once done
+func TestRegistryUntrackedCall(t *testing.T) {
+	r := NewRegistry()
+	done := r.StartToolCall(PipelineID(context.Background()), "yolo", "list_models")
+	if snapshot := r.Snapshot(); len(snapshot) != 1 || len(snapshot[0].ToolCalls) != 1 {
+		t.Fatalf("Expected the call to be in flight, got %+v", snapshot)
+	}
+	done()
+	if snapshot := r.Snapshot(); len(snapshot) != 0 {
+		t.Errorf("Expected nothing left after the call, got %+v", snapshot)
+	}
+}
+
+func TestPipelineID(t *testing.T) {
+	ctx := WithPipeline(context.Background(), "run-1")
+	if id := PipelineID(ctx); id != "run-1" {
+		t.Errorf("PipelineID = %q, want run-1", id)
+	}
+	if id := PipelineID(context.Background()); id != "" {
+		t.Errorf("PipelineID = %q outside a pipeline, want empty", id)
+	}
+}
+
+func TestWriteGoroutines(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	go blockedForStatusDump(block)
+	time.Sleep(10 * time.Millisecond)
+
+	var out bytes.Buffer
+	WriteGoroutines(&out, "blockedForStatusDump")
+	if !strings.Contains(out.String(), "blockedForStatusDump") || strings.Contains(out.String(), "activity.WriteGoroutines(") {
+		t.Errorf("Expected only the matching goroutine, got:\n%s", out.String())
+	}
+}
+
+func blockedForStatusDump(block chan struct{}) {
+	<-block
+}
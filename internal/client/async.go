@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/jsonpath"
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Async tool defaults used when the config leaves them unset
+const (
+	DefaultAsyncPollInterval = 2 * time.Second
+	DefaultAsyncMaxWait      = 10 * time.Minute
+)
+
+var (
+	defaultDoneStatuses   = []string{"completed", "succeeded", "done"}
+	defaultFailedStatuses = []string{"failed", "error", "cancelled"}
+)
+
+// ResolveAsyncToolConfig fills in the defaults of an async tool declaration and
+// rejects incomplete ones
+func ResolveAsyncToolConfig(tool string, config types.AsyncToolConfig) (types.AsyncToolConfig, error) {
+	if config.PollTool == "" {
+		return config, fmt.Errorf("async tool %s: poll_tool is required", tool)
+	}
+	if config.PollInterval < 0 || config.MaxWait < 0 {
+		return config, fmt.Errorf("async tool %s: poll_interval and max_wait must not be negative", tool)
+	}
+	if config.JobIDField == "" {
+		config.JobIDField = "job_id"
+	}
+	if config.JobIDArgument == "" {
+		config.JobIDArgument = "job_id"
+	}
+	if config.StatusField == "" {
+		config.StatusField = "status"
+	}
+	if config.ErrorField == "" {
+		config.ErrorField = "error"
+	}
+	if len(config.DoneStatuses) == 0 {
+		config.DoneStatuses = defaultDoneStatuses
+	}
+	if len(config.FailedStatuses) == 0 {
+		config.FailedStatuses = defaultFailedStatuses
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = DefaultAsyncPollInterval
+	}
+	if config.MaxWait == 0 {
+		config.MaxWait = DefaultAsyncMaxWait
+	}
+	return config, nil
+}
+
+// AsyncClient wraps an MCPClient so calls to asynchronous tools return once their job
+// has finished. Other calls pass through.
+type AsyncClient struct {
+	MCPClient
+	tools map[string]types.AsyncToolConfig
+}
+
+// NewAsyncClient wraps mcpClient, polling the declared async tools until done.
+// Declarations are resolved with ResolveAsyncToolConfig.
+func NewAsyncClient(mcpClient MCPClient, tools map[string]types.AsyncToolConfig) (*AsyncClient, error) {
+	resolved := make(map[string]types.AsyncToolConfig, len(tools))
+	for name, config := range tools {
+		config, err := ResolveAsyncToolConfig(name, config)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = config
+	}
+	return &AsyncClient{MCPClient: mcpClient, tools: resolved}, nil
+}
+
+// CallTool invokes a tool, polling for the result when it is declared async
+func (c *AsyncClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	result, err := c.MCPClient.CallTool(ctx, name, arguments)
+	config, async := c.tools[name]
+	if err != nil || !async {
+		return result, err
+	}
+
+	jobID, ok := jsonpath.Lookup(resultDocument(result), config.JobIDField)
+	if !ok || jobID == nil || jobID == "" {
+		return result, nil // Finished synchronously
+	}
+	return c.waitForJob(ctx, name, jobID, config)
+}
+
+// waitForJob polls a job started by tool until it is done, failed or MaxWait passes
+func (c *AsyncClient) waitForJob(ctx context.Context, tool string, jobID interface{}, config types.AsyncToolConfig) (*types.ToolCallResult, error) {
+	log.Printf("Tool %s started job %v, polling %s every %s", tool, jobID, config.PollTool, config.PollInterval)
+	deadline := time.Now().Add(config.MaxWait)
+	arguments := map[string]interface{}{config.JobIDArgument: jobID}
+
+	for {
+		if time.Now().Add(config.PollInterval).After(deadline) {
+			return nil, fmt.Errorf("%s job %v did not finish within %s", tool, jobID, config.MaxWait)
+		}
+		if err := retry.Sleep(ctx, config.PollInterval); err != nil {
+			return nil, fmt.Errorf("waiting for %s job %v: %w", tool, jobID, err)
+		}
+
+		poll, err := c.MCPClient.CallTool(ctx, config.PollTool, arguments)
+		if err != nil {
+			if ctx.Err() == nil && retry.IsRetryable(err) {
+				log.Printf("Warning: polling %s job %v failed, retrying: %v", tool, jobID, err)
+				continue
+			}
+			return nil, fmt.Errorf("polling %s job %v failed: %w", tool, jobID, err)
+		}
+
+		doc := resultDocument(poll)
+		status, _ := jsonpath.Lookup(doc, config.StatusField)
+		switch {
+		case hasStatus(config.DoneStatuses, status):
+			return jobResult(poll, doc, config.ResultField)
+		case hasStatus(config.FailedStatuses, status):
+			message, _ := jsonpath.Lookup(doc, config.ErrorField)
+			if message == nil {
+				message = "no error details"
+			}
+			return poll, fmt.Errorf("%s job %v %v: %v", tool, jobID, status, message)
+		}
+	}
+}
+
+// resultDocument parses a tool result's first text block as JSON, or returns nil
+func resultDocument(result *types.ToolCallResult) interface{} {
+	if result == nil || len(result.Content) == 0 {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+// hasStatus reports whether status is one of statuses, ignoring case
+func hasStatus(statuses []string, status interface{}) bool {
+	if status == nil {
+		return false
+	}
+	value := fmt.Sprint(status)
+	for _, s := range statuses {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobResult returns a finished job's result: the value at field as a text block, or
+// the whole poll result when field is empty
+func jobResult(poll *types.ToolCallResult, doc interface{}, field string) (*types.ToolCallResult, error) {
+	if field == "" {
+		return poll, nil
+	}
+	value, ok := jsonpath.Lookup(doc, field)
+	if !ok {
+		return nil, fmt.Errorf("result field %s not found in finished job", field)
+	}
+	text, isString := value.(string)
+	if !isString {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode job result: %w", err)
+		}
+		text = string(data)
+	}
+	return &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: text}}}, nil
+}
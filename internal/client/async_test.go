@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// jobMCPClient answers a start tool with a job ID and a status tool with scripted polls
+type jobMCPClient struct {
+	recordingMCPClient
+	start string   // Result of the start tool
+	polls []string // Results of successive status polls; the last repeats
+	calls int      // Status polls made
+}
+
+func (j *jobMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	j.recordingMCPClient.CallTool(ctx, name, arguments)
+	text := j.start
+	if name == "job_status" {
+		text = j.polls[min(j.calls, len(j.polls)-1)]
+		j.calls++
+	}
+	return &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: text}}}, nil
+}
+
+// TestAsyncClient verifies async tools are polled until their job finishes, fails or
+// runs out of time, and that other results pass through
+func TestAsyncClient(t *testing.T) {
+	config := types.AsyncToolConfig{
+		PollTool:     "job_status",
+		ResultField:  "output.video_path",
+		PollInterval: time.Millisecond,
+		MaxWait:      time.Second,
+	}
+
+	tests := []struct {
+		name      string
+		start     string
+		polls     []string
+		maxWait   time.Duration
+		expected  string
+		expectErr string
+		pollCalls int
+	}{
+		{
+			name:      "polls until done",
+			start:     `{"job_id": "j1"}`,
+			polls:     []string{`{"status": "running"}`, `{"status": "Completed", "output": {"video_path": "/out/a.mp4"}}`},
+			expected:  "/out/a.mp4",
+			pollCalls: 2,
+		},
+		{
+			name:      "failed job",
+			start:     `{"job_id": 7}`,
+			polls:     []string{`{"status": "failed", "error": "gpu quota exceeded"}`},
+			expectErr: "gpu quota exceeded",
+			pollCalls: 1,
+		},
+		{
+			name:      "synchronous result",
+			start:     `{"video_path": "/out/sync.mp4"}`,
+			expected:  `{"video_path": "/out/sync.mp4"}`,
+			pollCalls: 0,
+		},
+		{
+			name:      "max wait",
+			start:     `{"job_id": "j2"}`,
+			polls:     []string{`{"status": "running"}`},
+			maxWait:   20 * time.Millisecond,
+			expectErr: "did not finish within 20ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &jobMCPClient{start: tt.start, polls: tt.polls}
+			toolConfig := config
+			if tt.maxWait > 0 {
+				toolConfig.MaxWait = tt.maxWait
+			}
+			asyncClient, err := NewAsyncClient(inner, map[string]types.AsyncToolConfig{"generate": toolConfig})
+			if err != nil {
+				t.Fatalf("NewAsyncClient failed: %v", err)
+			}
+
+			result, err := asyncClient.CallTool(context.Background(), "generate", map[string]interface{}{"prompt": "wave"})
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			} else if result.Content[0].Text != tt.expected {
+				t.Errorf("Expected result %q, got %q", tt.expected, result.Content[0].Text)
+			}
+
+			if tt.pollCalls > 0 && inner.calls != tt.pollCalls {
+				t.Errorf("Expected %d polls, got %d", tt.pollCalls, inner.calls)
+			}
+			if inner.calls > 0 {
+				if jobID := inner.arguments[1]["job_id"]; jobID == nil {
+					t.Errorf("Expected the job ID passed to the poll tool, got %v", inner.arguments[1])
+				}
+			}
+		})
+	}
+
+	// Tools that aren't declared async are not polled
+	inner := &jobMCPClient{start: `{"job_id": "j3"}`}
+	asyncClient, _ := NewAsyncClient(inner, map[string]types.AsyncToolConfig{"generate": config})
+	if _, err := asyncClient.CallTool(context.Background(), "other", nil); err != nil || inner.calls != 0 {
+		t.Errorf("Expected a pass-through call, got %d polls (err: %v)", inner.calls, err)
+	}
+}
+
+// TestResolveAsyncToolConfig verifies defaults and required fields
+func TestResolveAsyncToolConfig(t *testing.T) {
+	if _, err := ResolveAsyncToolConfig("generate", types.AsyncToolConfig{}); err == nil {
+		t.Error("Expected a missing poll_tool to be rejected")
+	}
+
+	config, err := ResolveAsyncToolConfig("generate", types.AsyncToolConfig{PollTool: "job_status"})
+	if err != nil {
+		t.Fatalf("ResolveAsyncToolConfig failed: %v", err)
+	}
+	if config.JobIDField != "job_id" || config.StatusField != "status" ||
+		config.PollInterval != DefaultAsyncPollInterval || config.MaxWait != DefaultAsyncMaxWait {
+		t.Errorf("Expected defaults, got %+v", config)
+	}
+}
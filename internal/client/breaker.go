@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Circuit breaker defaults used when the config leaves them unset
+const (
+	DefaultCircuitWindow   = time.Minute
+	DefaultCircuitCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned, wrapped, for calls short-circuited by an open breaker
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// ResolveCircuitBreakerConfig fills in the defaults of a circuit breaker config and
+// rejects negative settings
+func ResolveCircuitBreakerConfig(config types.CircuitBreakerConfig) (types.CircuitBreakerConfig, error) {
+	if config.FailureThreshold < 0 || config.Window < 0 || config.Cooldown < 0 {
+		return config, fmt.Errorf("circuit_breaker: failure_threshold, window and cooldown must not be negative")
+	}
+	if config.Window == 0 {
+		config.Window = DefaultCircuitWindow
+	}
+	if config.Cooldown == 0 {
+		config.Cooldown = DefaultCircuitCooldown
+	}
+	return config, nil
+}
+
+// CircuitBreaker stops calls to a server that keeps failing. It opens after the
+// configured number of consecutive failures within the window, rejects calls for the
+// cooldown, then half-opens to let one call through: its success closes the circuit,
+// its failure opens it again.
+type CircuitBreaker struct {
+	server string
+	config types.CircuitBreakerConfig
+
+	mu           sync.Mutex
+	state        string
+	failures     int       // Consecutive failures while closed
+	firstFailure time.Time // Start of the current run of failures
+	openedAt     time.Time
+	probing      bool // A half-open test call is in flight
+	now          func() time.Time
+}
+
+// NewCircuitBreaker creates a breaker for server from a config resolved with
+// ResolveCircuitBreakerConfig
+func NewCircuitBreaker(server string, config types.CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		server: server,
+		config: config,
+		state:  circuitClosed,
+		now:    time.Now,
+	}
+}
+
+// Allow reports whether a call may go ahead. Callers that are allowed must report the
+// outcome with Record.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		remaining := b.openedAt.Add(b.config.Cooldown).Sub(b.now())
+		if remaining > 0 {
+			return fmt.Errorf("%w: %s failed %d times in a row, not calling it for another %s",
+				ErrCircuitOpen, b.server, b.config.FailureThreshold, remaining.Round(time.Second))
+		}
+		log.Printf("Circuit for %s half-open, testing the server", b.server)
+		b.state = circuitHalfOpen
+		b.probing = true
+		return nil
+	case circuitHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: %s is being tested after repeated failures", ErrCircuitOpen, b.server)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record reports the outcome of an allowed call
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if err == nil {
+		if b.state != circuitClosed {
+			log.Printf("Circuit for %s closed, the server recovered", b.server)
+		}
+		b.state = circuitClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	if b.state == circuitHalfOpen {
+		log.Printf("Warning: circuit for %s opened again, the test call failed: %v", b.server, err)
+		b.trip(now)
+		return
+	}
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.config.Window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.config.FailureThreshold {
+		log.Printf("Warning: circuit for %s opened after %d consecutive failures, pausing calls for %s",
+			b.server, b.failures, b.config.Cooldown)
+		b.trip(now)
+	}
+}
+
+// trip opens the circuit
+func (b *CircuitBreaker) trip(now time.Time) {
+	b.state = circuitOpen
+	b.openedAt = now
+	b.failures = 0
+	b.probing = false
+}
+
+// State returns "closed", "open" or "half-open"
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// call runs fn through the breaker. Failures caused by the caller's own context
+// ending say nothing about the server and are not counted.
+func (b *CircuitBreaker) call(ctx context.Context, fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	if err != nil && ctx.Err() != nil {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return err
+	}
+	b.Record(err)
+	return err
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestCircuitBreaker walks the breaker from closed to open, half-open and back
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	breaker := NewCircuitBreaker("yolo", types.CircuitBreakerConfig{
+		FailureThreshold: 3,
+		Window:           time.Minute,
+		Cooldown:         30 * time.Second,
+	})
+	breaker.now = func() time.Time { return now }
+	failure := errors.New("connection refused")
+
+	// Failures spread wider than the window never open the circuit
+	for i := 0; i < 4; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("Expected the call to be allowed, got %v", err)
+		}
+		breaker.Record(failure)
+		now = now.Add(40 * time.Second)
+	}
+	if state := breaker.State(); state != circuitClosed {
+		t.Fatalf("Expected failures outside the window to keep the circuit closed, got %s", state)
+	}
+
+	// A success resets the count
+	breaker.Record(failure)
+	breaker.Record(nil)
+	breaker.Record(failure)
+	breaker.Record(failure)
+	if state := breaker.State(); state != circuitClosed {
+		t.Fatalf("Expected a success to reset the count, got %s", state)
+	}
+
+	breaker.Record(failure)
+	err := breaker.Allow()
+	if !errors.Is(err, ErrCircuitOpen) || !strings.Contains(err.Error(), "yolo") {
+		t.Fatalf("Expected a circuit open error naming the server, got %v", err)
+	}
+
+	// After the cooldown one test call goes through while others are still rejected
+	now = now.Add(31 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected the half-open test call to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected calls during the test call to be rejected, got %v", err)
+	}
+	breaker.Record(failure)
+	if state := breaker.State(); state != circuitOpen {
+		t.Fatalf("Expected a failed test call to reopen the circuit, got %s", state)
+	}
+
+	now = now.Add(31 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected the half-open test call to be allowed, got %v", err)
+	}
+	breaker.Record(nil)
+	if state := breaker.State(); state != circuitClosed {
+		t.Fatalf("Expected a successful test call to close the circuit, got %s", state)
+	}
+}
+
+// TestClientCircuitBreaker verifies transport failures open the circuit and tool errors don't
+func TestClientCircuitBreaker(t *testing.T) {
+	transport := NewMockTransport()
+	transport.RequestResponses["tools/call"] = map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": "bad arguments"}},
+		"isError": true,
+	}
+	c := NewClient(transport)
+	config, err := ResolveCircuitBreakerConfig(types.CircuitBreakerConfig{FailureThreshold: 2})
+	if err != nil {
+		t.Fatalf("ResolveCircuitBreakerConfig failed: %v", err)
+	}
+	c.SetCircuitBreaker(NewCircuitBreaker("video", config))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.CallTool(ctx, "convert", nil); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected tool errors not to open the circuit, got %v", err)
+		}
+	}
+
+	transport.RequestErr = errors.New("broken pipe")
+	for i := 0; i < 2; i++ {
+		if _, err := c.CallTool(ctx, "convert", nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected the transport error, got %v", err)
+		}
+	}
+	sent := len(transport.SentRequests)
+	if _, err := c.CallTool(ctx, "convert", nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the call to be short-circuited, got %v", err)
+	}
+	if len(transport.SentRequests) != sent {
+		t.Error("Expected a short-circuited call not to reach the transport")
+	}
+
+	if _, err := ResolveCircuitBreakerConfig(types.CircuitBreakerConfig{FailureThreshold: 2, Cooldown: -time.Second}); err == nil {
+		t.Error("Expected a negative cooldown to be rejected")
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+// pipeTransport returns a started-looking stdio transport whose requests can be read
+// from the returned reader
+func pipeTransport(cancelRequests bool) (*StdioTransport, *bufio.Scanner) {
+	reader, writer := io.Pipe()
+	transport := NewStdioTransport([]string{"unused"}, time.Minute)
+	transport.stdin = writer
+	transport.SetCancelRequests(cancelRequests)
+	return transport, bufio.NewScanner(reader)
+}
+
+// readMessage reads one JSON-RPC message written by the transport
+func readMessage(t *testing.T, scanner *bufio.Scanner) map[string]interface{} {
+	t.Helper()
+	if !scanner.Scan() {
+		t.Fatalf("no message written: %v", scanner.Err())
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+		t.Fatalf("invalid message %q: %v", scanner.Text(), err)
+	}
+	return msg
+}
+
+func TestSendRequestCancelNotification(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		cancelRequests bool
+		wantCancel     bool
+	}{
+		{"enabled", "tools/call", true, true},
+		{"disabled", "tools/call", false, false},
+		{"initialize never cancelled", "initialize", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, scanner := pipeTransport(tt.cancelRequests)
+			defer transport.stdin.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := transport.SendRequest(ctx, tt.method, nil)
+				done <- err
+			}()
+
+			request := readMessage(t, scanner)
+			cancel()
+
+			messages := make(chan map[string]interface{}, 1)
+			go func() {
+				if scanner.Scan() {
+					var msg map[string]interface{}
+					json.Unmarshal(scanner.Bytes(), &msg)
+					messages <- msg
+				}
+			}()
+
+			if err := <-done; err == nil {
+				t.Fatal("expected an error after cancel")
+			}
+
+			select {
+			case msg := <-messages:
+				if !tt.wantCancel {
+					t.Fatalf("unexpected message after cancel: %v", msg)
+				}
+				if msg["method"] != CancelNotificationMethod {
+					t.Errorf("method = %v, want %s", msg["method"], CancelNotificationMethod)
+				}
+				params, _ := msg["params"].(map[string]interface{})
+				if params["requestId"] != request["id"] {
+					t.Errorf("requestId = %v, want %v", params["requestId"], request["id"])
+				}
+				if _, ok := msg["id"]; ok {
+					t.Error("cancel must be a notification without an id")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantCancel {
+					t.Fatal("no cancel notification sent")
+				}
+			}
+		})
+	}
+}
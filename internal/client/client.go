@@ -4,11 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
 	"github.com/zhe.chen/agent-funpic-act/pkg/types"
 )
 
-// MCPClient defines the interface for interacting with MCP servers
+// Retries of idempotent requests (tools/list) that fail transiently. Tool calls are not
+// retried here: they may have side effects, so the pipeline retries the whole stage.
+const (
+	listToolsAttempts = 3
+	listToolsBackoff  = 500 * time.Millisecond
+)
+
+// MCPClient defines the interface for interacting with MCP servers.
+// Implementations must allow ListTools, CallTool and GetServerInfo to be called
+// concurrently from multiple goroutines once Initialize has returned.
 type MCPClient interface {
 	// Connect establishes connection to the MCP server
 	Connect(ctx context.Context) error
@@ -29,7 +41,9 @@ type MCPClient interface {
 	GetServerInfo() (name, version string)
 }
 
-// Transport defines the interface for MCP transport layers
+// Transport defines the interface for MCP transport layers.
+// SendRequest and SendNotification must be safe for concurrent use; each
+// transport assigns its own request IDs.
 type Transport interface {
 	// Start initializes the transport
 	Start(ctx context.Context) error
@@ -71,6 +85,11 @@ func (e *JSONRPCError) Error() string {
 	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
 }
 
+// RPCCode returns the error code for retry classification
+func (e *JSONRPCError) RPCCode() int {
+	return e.Code
+}
+
 // InitializeRequest represents MCP initialize request parameters
 type InitializeRequest struct {
 	ProtocolVersion string                 `json:"protocolVersion"`
@@ -134,17 +153,18 @@ type CallToolRequest struct {
 
 // Client implements MCPClient interface
 type Client struct {
-	transport  Transport
+	transport Transport
+	breaker   *CircuitBreaker // nil when calls are never short-circuited
+
+	mu         sync.RWMutex // guards server info set by Initialize
 	serverName string
 	serverVer  string
-	nextID     int
 }
 
 // NewClient creates a new MCP client with the given transport
 func NewClient(transport Transport) *Client {
 	return &Client{
 		transport: transport,
-		nextID:    1,
 	}
 }
 
@@ -179,8 +199,10 @@ func (c *Client) Initialize(ctx context.Context) error {
 		return fmt.Errorf("failed to parse initialize response: %w", err)
 	}
 
+	c.mu.Lock()
 	c.serverName = initResp.ServerInfo.Name
 	c.serverVer = initResp.ServerInfo.Version
+	c.mu.Unlock()
 
 	// Send initialized notification
 	if err := c.transport.SendNotification(ctx, "notifications/initialized", nil); err != nil {
@@ -192,7 +214,12 @@ func (c *Client) Initialize(ctx context.Context) error {
 
 // ListTools retrieves available tools from the server
 func (c *Client) ListTools(ctx context.Context) ([]types.Tool, error) {
-	resultBytes, err := c.transport.SendRequest(ctx, "tools/list", map[string]interface{}{})
+	var resultBytes json.RawMessage
+	err := retry.Do(ctx, "tools/list", listToolsAttempts, listToolsBackoff, func() error {
+		var err error
+		resultBytes, err = c.transport.SendRequest(ctx, "tools/list", map[string]interface{}{})
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("tools/list request failed: %w", err)
 	}
@@ -212,7 +239,11 @@ func (c *Client) CallTool(ctx context.Context, name string, arguments map[string
 		Arguments: arguments,
 	}
 
-	resultBytes, err := c.transport.SendRequest(ctx, "tools/call", req)
+	var resultBytes json.RawMessage
+	err := c.sendToolCall(ctx, func() (err error) {
+		resultBytes, err = c.transport.SendRequest(ctx, "tools/call", req)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("tools/call request failed: %w", err)
 	}
@@ -224,12 +255,30 @@ func (c *Client) CallTool(ctx context.Context, name string, arguments map[string
 
 	// Check if the tool returned an error
 	if result.IsError {
-		return &result, fmt.Errorf("tool execution failed: %s", result.Content[0].Text)
+		message := "no error details"
+		if len(result.Content) > 0 {
+			message = result.Content[0].Text
+		}
+		return &result, fmt.Errorf("tool execution failed: %s", message)
 	}
 
 	return &result, nil
 }
 
+// SetCircuitBreaker routes tool calls through breaker; nil removes it
+func (c *Client) SetCircuitBreaker(breaker *CircuitBreaker) {
+	c.breaker = breaker
+}
+
+// sendToolCall runs send through the circuit breaker, if any. Only failures to get a
+// response count against the server; a tool reporting an error is still a response.
+func (c *Client) sendToolCall(ctx context.Context, send func() error) error {
+	if c.breaker == nil {
+		return send()
+	}
+	return c.breaker.call(ctx, send)
+}
+
 // Close terminates the connection
 func (c *Client) Close() error {
 	return c.transport.Close()
@@ -237,5 +286,7 @@ func (c *Client) Close() error {
 
 // GetServerInfo returns server name and version
 func (c *Client) GetServerInfo() (name, version string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.serverName, c.serverVer
 }
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package client
+
+// resolveCommand returns name unchanged: exec finds commands on PATH itself
+func resolveCommand(name string) string {
+	return name
+}
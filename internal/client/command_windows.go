@@ -0,0 +1,33 @@
+//go:build windows
+
+package client
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// resolveCommand finds the executable of a stdio server command. exec.LookPath tries the
+// PATHEXT extensions, so "npx" finds npx.cmd; a Python virtualenv script configured
+// Unix-style as <venv>/bin/<name> is looked up in <venv>\Scripts. Unresolved commands
+// are returned unchanged so starting them reports the error.
+func resolveCommand(name string) string {
+	for _, candidate := range commandCandidates(name) {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path
+		}
+	}
+	return name
+}
+
+// commandCandidates returns the names to look up for a command, in order
+func commandCandidates(name string) []string {
+	candidates := []string{name}
+	dir, base := filepath.Split(filepath.FromSlash(name))
+	dir = filepath.Clean(dir)
+	if base != "" && strings.EqualFold(filepath.Base(dir), "bin") {
+		candidates = append(candidates, filepath.Join(filepath.Dir(dir), "Scripts", base))
+	}
+	return candidates
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandCandidates(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected []string
+	}{
+		{"bare name", "npx", []string{"npx"}},
+		{"venv script", `C:/envs/imagesorcery/bin/imagesorcery-mcp`, []string{
+			`C:/envs/imagesorcery/bin/imagesorcery-mcp`,
+			`C:\envs\imagesorcery\Scripts\imagesorcery-mcp`,
+		}},
+		{"other directory", `C:\tools\server.exe`, []string{`C:\tools\server.exe`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandCandidates(tt.command); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("commandCandidates(%q) = %v, want %v", tt.command, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestResolveCommandVenvScript verifies a Unix-style venv path finds the Windows script
+func TestResolveCommandVenvScript(t *testing.T) {
+	venv := t.TempDir()
+	scripts := filepath.Join(venv, "Scripts")
+	if err := os.MkdirAll(scripts, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(scripts, "server.exe")
+	if err := os.WriteFile(script, []byte("MZ"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := resolveCommand(filepath.ToSlash(filepath.Join(venv, "bin", "server")))
+	if !strings.EqualFold(got, script) {
+		t.Errorf("resolveCommand = %q, want %q", got, script)
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServerEnv makes the test binary act as a fake stdio MCP server
+const fakeServerEnv = "AGENT_FAKE_MCP_SERVER"
+
+// TestMain runs the fake server instead of the tests when launched as a subprocess
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		runFakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeServer answers JSON-RPC requests on stdin concurrently and out of order.
+// tools/call echoes the "id" argument so callers can check responses are routed correctly.
+func runFakeServer() {
+	var writeMu sync.Mutex
+	respond := func(id int, result interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+		writeMu.Lock()
+		os.Stdout.Write(append(data, '\n'))
+		writeMu.Unlock()
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var req struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue // notification
+		}
+
+		go func(id int, method string, params json.RawMessage) {
+			time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+			switch method {
+			case "initialize":
+				respond(id, map[string]interface{}{
+					"protocolVersion": "2025-03-26",
+					"serverInfo":      map[string]interface{}{"name": "fake", "version": "1.0.0"},
+				})
+			case "tools/list":
+				respond(id, map[string]interface{}{
+					"tools": []map[string]interface{}{{"name": "echo"}},
+				})
+			case "tools/call":
+				var call CallToolRequest
+				json.Unmarshal(params, &call)
+				respond(id, map[string]interface{}{
+					"content": []map[string]interface{}{
+						{"type": "text", "text": fmt.Sprintf("%v", call.Arguments["id"])},
+					},
+				})
+			}
+		}(*req.ID, req.Method, req.Params)
+	}
+}
+
+// TestClientConcurrentCalls hammers one client from 20 goroutines against the fake
+// server and checks every response reaches its caller (run with -race)
+func TestClientConcurrentCalls(t *testing.T) {
+	t.Setenv(fakeServerEnv, "1")
+
+	mcpClient := NewClient(NewStdioTransport([]string{os.Args[0]}, 10*time.Second))
+	ctx := context.Background()
+	if err := mcpClient.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer mcpClient.Close()
+
+	if err := mcpClient.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	const goroutines = 20
+	const callsPerGoroutine = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*callsPerGoroutine)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < callsPerGoroutine; i++ {
+				want := fmt.Sprintf("%d-%d", g, i)
+
+				if i%3 == 0 {
+					if _, err := mcpClient.ListTools(ctx); err != nil {
+						errs <- fmt.Errorf("ListTools failed: %w", err)
+						continue
+					}
+				}
+				if name, _ := mcpClient.GetServerInfo(); name != "fake" {
+					errs <- fmt.Errorf("unexpected server name %q", name)
+				}
+
+				result, err := mcpClient.CallTool(ctx, "echo", map[string]interface{}{"id": want})
+				if err != nil {
+					errs <- fmt.Errorf("CallTool %s failed: %w", want, err)
+					continue
+				}
+				if got := result.Content[0].Text; got != want {
+					errs <- fmt.Errorf("response routed to wrong caller: want %s, got %s", want, got)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+)
+
+// CredentialRefresher is implemented by clients and transports that can reload their
+// credentials after the server rejected them
+type CredentialRefresher interface {
+	// RefreshCredentials reloads the credentials and reports whether they changed
+	RefreshCredentials(ctx context.Context) (bool, error)
+}
+
+// authErrorMarkers are the fragments of rejected-credential errors: HTTP 401/403
+// responses as the HTTP transport reports them, and tool errors saying so
+var authErrorMarkers = []string{
+	"status 401",
+	"status 403",
+	"unauthorized",
+	"unauthenticated",
+	"forbidden",
+}
+
+// IsAuthError reports whether err says the server rejected the client's credentials
+func IsAuthError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, marker := range authErrorMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshCredentials asks mcpClient to reload its credentials. It reports false when
+// the client can't refresh them or they didn't change.
+func RefreshCredentials(ctx context.Context, mcpClient MCPClient) (bool, error) {
+	refresher, ok := mcpClient.(CredentialRefresher)
+	if !ok {
+		return false, nil
+	}
+	return refresher.RefreshCredentials(ctx)
+}
+
+// RefreshCredentials reloads the transport's credentials when it supports it
+func (c *Client) RefreshCredentials(ctx context.Context) (bool, error) {
+	refresher, ok := c.transport.(CredentialRefresher)
+	if !ok {
+		return false, nil
+	}
+	return refresher.RefreshCredentials(ctx)
+}
+
+// RefreshCredentials reloads the wrapped client's credentials
+func (c *AsyncClient) RefreshCredentials(ctx context.Context) (bool, error) {
+	return RefreshCredentials(ctx, c.MCPClient)
+}
+
+// expandHeaders expands environment variable references in header templates
+func expandHeaders(templates map[string]string) map[string]string {
+	headers := make(map[string]string, len(templates))
+	for name, value := range templates {
+		headers[name] = os.ExpandEnv(value)
+	}
+	return headers
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestIsAuthError verifies rejected credentials are recognised in transport and tool errors
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{errors.New("call tool failed: request failed with status 401: {}"), true},
+		{errors.New("request failed with status 403: forbidden"), true},
+		{fmt.Errorf("tools/call request failed: %w", errors.New("tool execution failed: Unauthorized: token expired")), true},
+		{errors.New("request failed with status 500: boom"), false},
+		{context.Canceled, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsAuthError(tt.err); got != tt.expected {
+			t.Errorf("IsAuthError(%v) = %v, expected %v", tt.err, got, tt.expected)
+		}
+	}
+}
+
+// TestMark3LabsTransportRefreshCredentials verifies headers are re-read from the environment
+func TestMark3LabsTransportRefreshCredentials(t *testing.T) {
+	t.Setenv("TEST_MUSIC_TOKEN", "old")
+	transport := NewMark3LabsTransport("http://localhost", 0, map[string]string{"Authorization": "Bearer old"})
+	transport.SetHeaderTemplates(map[string]string{"Authorization": "Bearer ${TEST_MUSIC_TOKEN}"})
+
+	if refreshed, err := transport.RefreshCredentials(context.Background()); err != nil || refreshed {
+		t.Errorf("Expected no refresh while the token is unchanged, got %v (err: %v)", refreshed, err)
+	}
+
+	t.Setenv("TEST_MUSIC_TOKEN", "new")
+	refreshed, err := transport.RefreshCredentials(context.Background())
+	if err != nil || !refreshed {
+		t.Fatalf("Expected a refresh after rotating the token, got %v (err: %v)", refreshed, err)
+	}
+	if header := transport.headers["Authorization"]; header != "Bearer new" {
+		t.Errorf("Expected the rotated header, got %q", header)
+	}
+
+	// Clients over transports without templates can't refresh
+	if refreshed, _ := RefreshCredentials(context.Background(), NewClient(NewMark3LabsTransport("http://localhost", 0, nil))); refreshed {
+		t.Error("Expected no refresh without header templates")
+	}
+}
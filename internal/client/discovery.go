@@ -2,15 +2,51 @@ package client
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/zhe.chen/agent-funpic-act/pkg/types"
 )
 
-// ValidateTools checks if required tools are available on the server
+// maxListedTools caps the available tool names quoted in a MissingToolsError
+const maxListedTools = 20
+
+// MissingToolsError reports required tools a server doesn't offer, with the tools it
+// does offer and, for each missing name, the offered names that look like a typo of it
+type MissingToolsError struct {
+	Missing     []string
+	Available   []string            // Sorted
+	Suggestions map[string][]string // Missing name -> close available names, best first
+}
+
+func (e *MissingToolsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "missing required tools: %v", e.Missing)
+	for _, name := range e.Missing {
+		if close := e.Suggestions[name]; len(close) > 0 {
+			fmt.Fprintf(&b, "; %s: did you mean %s?", name, strings.Join(close, " or "))
+		}
+	}
+	switch {
+	case len(e.Available) == 0:
+		b.WriteString(" (server offers no tools)")
+	case len(e.Available) > maxListedTools:
+		fmt.Fprintf(&b, " (available: %s and %d more)",
+			strings.Join(e.Available[:maxListedTools], ", "), len(e.Available)-maxListedTools)
+	default:
+		fmt.Fprintf(&b, " (available: %s)", strings.Join(e.Available, ", "))
+	}
+	return b.String()
+}
+
+// ValidateTools checks if required tools are available on the server. When some are
+// missing it returns a *MissingToolsError naming what the server offers instead.
 func ValidateTools(available []types.Tool, required []string) error {
 	toolMap := make(map[string]bool)
+	names := make([]string, 0, len(available))
 	for _, tool := range available {
 		toolMap[tool.Name] = true
+		names = append(names, tool.Name)
 	}
 
 	var missing []string
@@ -21,12 +57,68 @@ func ValidateTools(available []types.Tool, required []string) error {
 	}
 
 	if len(missing) > 0 {
-		return fmt.Errorf("missing required tools: %v", missing)
+		sort.Strings(names)
+		suggestions := make(map[string][]string)
+		for _, name := range missing {
+			if close := closeToolNames(name, names); len(close) > 0 {
+				suggestions[name] = close
+			}
+		}
+		return &MissingToolsError{Missing: missing, Available: names, Suggestions: suggestions}
 	}
 
 	return nil
 }
 
+// closeToolNames returns the names that contain name, or are within a third of its
+// length in edit distance, ignoring case: closest first, at most 3
+func closeToolNames(name string, names []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+	lower := strings.ToLower(name)
+	limit := max(1, len(name)/3)
+
+	var matches []match
+	for _, candidate := range names {
+		candidateLower := strings.ToLower(candidate)
+		distance := editDistance(lower, candidateLower)
+		if distance <= limit || strings.Contains(candidateLower, lower) || strings.Contains(lower, candidateLower) {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+
+	var close []string
+	for i := 0; i < len(matches) && i < 3; i++ {
+		close = append(close, matches[i].name)
+	}
+	return close
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
 // CreateClient creates an MCP client from server configuration
 func CreateClient(config types.ServerConfig) (MCPClient, error) {
 	var transport Transport
@@ -36,18 +128,53 @@ func CreateClient(config types.ServerConfig) (MCPClient, error) {
 		if len(config.Command) == 0 {
 			return nil, fmt.Errorf("command required for stdio transport")
 		}
-		transport = NewStdioTransport(config.Command, config.Timeout)
+		minLevel, enabled, err := ParseStderrLevel(config.StderrLevel)
+		if err != nil {
+			return nil, err
+		}
+		stdio := NewStdioTransport(config.Command, config.Timeout)
+		stdio.SetCancelRequests(config.CancelRequests)
+		server := config.Name
+		if server == "" {
+			server = serverLabel(config.Command)
+		}
+		stdio.SetStderrLog(server, minLevel, enabled)
+		transport = stdio
 
 	case "http":
 		if config.URL == "" {
 			return nil, fmt.Errorf("url required for http transport")
 		}
 		// Use mark3labs/mcp-go library for reliable Streamable HTTP support
-		transport = NewMark3LabsTransport(config.URL, config.Timeout, config.Headers)
+		httpTransport := NewMark3LabsTransport(config.URL, config.Timeout, config.Headers)
+		httpTransport.SetHeaderTemplates(config.HeaderTemplates)
+		transport = httpTransport
 
 	default:
 		return nil, fmt.Errorf("unsupported transport type: %s", config.Transport)
 	}
 
-	return NewClient(transport), nil
+	mcpClient := NewClient(transport)
+	if config.CircuitBreaker.FailureThreshold != 0 {
+		breakerConfig, err := ResolveCircuitBreakerConfig(config.CircuitBreaker)
+		if err != nil {
+			return nil, err
+		}
+		server := config.Name
+		switch {
+		case server == "" && config.URL != "":
+			server = config.URL
+		case server == "":
+			server = serverLabel(config.Command)
+		}
+		mcpClient.SetCircuitBreaker(NewCircuitBreaker(server, breakerConfig))
+	}
+	if len(config.AsyncTools) > 0 {
+		asyncClient, err := NewAsyncClient(mcpClient, config.AsyncTools)
+		if err != nil {
+			return nil, err
+		}
+		return asyncClient, nil
+	}
+	return mcpClient, nil
 }
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PingMethod is the MCP request servers answer with an empty result when alive
+const PingMethod = "ping"
+
+// DefaultHealthMaxAge is how long a health check result is reused when none is set
+const DefaultHealthMaxAge = 15 * time.Second
+
+// healthCheckTimeout bounds a single health check
+const healthCheckTimeout = 5 * time.Second
+
+// Pinger is implemented by clients that can send an MCP ping
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping sends an MCP ping request to the server
+func (c *Client) Ping(ctx context.Context) error {
+	if _, err := c.transport.SendRequest(ctx, PingMethod, map[string]interface{}{}); err != nil {
+		return fmt.Errorf("ping request failed: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that mcpClient's server answers, with an MCP ping when the client
+// supports it and a tools/list request otherwise
+func Ping(ctx context.Context, mcpClient MCPClient) error {
+	if mcpClient == nil {
+		return fmt.Errorf("client not initialized")
+	}
+	if pinger, ok := mcpClient.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	_, err := mcpClient.ListTools(ctx)
+	return err
+}
+
+// HealthChecker runs a health check at most once per maxAge and reuses the result
+// in between, so frequent probes don't load the servers they check
+type HealthChecker struct {
+	check  func(ctx context.Context) error
+	maxAge time.Duration
+
+	mu        sync.Mutex // held during a check so concurrent probes share it
+	checkedAt time.Time
+	lastErr   error
+	now       func() time.Time
+}
+
+// NewHealthChecker creates a checker for check; maxAge <= 0 uses DefaultHealthMaxAge
+func NewHealthChecker(check func(ctx context.Context) error, maxAge time.Duration) *HealthChecker {
+	if maxAge <= 0 {
+		maxAge = DefaultHealthMaxAge
+	}
+	return &HealthChecker{
+		check:  check,
+		maxAge: maxAge,
+		now:    time.Now,
+	}
+}
+
+// Check returns the last result if it is younger than maxAge, otherwise runs the check.
+// checkedAt is when the returned result was produced.
+func (h *HealthChecker) Check(ctx context.Context) (checkedAt time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.checkedAt.IsZero() && h.now().Sub(h.checkedAt) < h.maxAge {
+		return h.checkedAt, h.lastErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	h.lastErr = h.check(ctx)
+	h.checkedAt = h.now()
+	return h.checkedAt, h.lastErr
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerMaxAge(t *testing.T) {
+	calls := 0
+	checkErr := errors.New("down")
+	checker := NewHealthChecker(func(ctx context.Context) error {
+		calls++
+		return checkErr
+	}, time.Minute)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+
+	for _, step := range []struct {
+		advance   time.Duration
+		wantCalls int
+	}{
+		{0, 1},
+		{30 * time.Second, 1}, // still fresh
+		{31 * time.Second, 2}, // stale, checked again
+	} {
+		now = now.Add(step.advance)
+		checkedAt, err := checker.Check(context.Background())
+		if !errors.Is(err, checkErr) {
+			t.Errorf("err = %v, want %v", err, checkErr)
+		}
+		if calls != step.wantCalls {
+			t.Errorf("after %s: %d checks, want %d", step.advance, calls, step.wantCalls)
+		}
+		if checkedAt.After(now) {
+			t.Errorf("checkedAt %s is in the future", checkedAt)
+		}
+	}
+}
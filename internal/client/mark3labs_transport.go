@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
@@ -16,10 +19,13 @@ import (
 type Mark3LabsTransport struct {
 	url         string
 	timeout     time.Duration
-	headers     map[string]string
 	httpTrans   *transport.StreamableHTTP
 	mcpClient   *client.Client
-	initialized bool
+	initialized atomic.Bool // set once initialize succeeds; read by concurrent requests
+
+	mu              sync.RWMutex      // guards headers, which RefreshCredentials replaces
+	headers         map[string]string // Sent with every request
+	headerTemplates map[string]string // Headers before environment expansion, for RefreshCredentials
 }
 
 // NewMark3LabsTransport creates a transport using mark3labs/mcp-go library
@@ -35,13 +41,40 @@ func NewMark3LabsTransport(url string, timeout time.Duration, headers map[string
 	}
 }
 
+// SetHeaderTemplates sets the headers as written in the config, with their ${VAR}
+// references unexpanded, so RefreshCredentials can pick up rotated environment values
+func (t *Mark3LabsTransport) SetHeaderTemplates(templates map[string]string) {
+	t.headerTemplates = templates
+}
+
+// RefreshCredentials re-reads the header templates' environment variables and reports
+// whether the headers changed. Requests sent afterwards carry the new values.
+func (t *Mark3LabsTransport) RefreshCredentials(ctx context.Context) (bool, error) {
+	if len(t.headerTemplates) == 0 {
+		return false, nil
+	}
+	headers := expandHeaders(t.headerTemplates)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if maps.Equal(headers, t.headers) {
+		return false, nil
+	}
+	t.headers = headers
+	return true, nil
+}
+
 // Start initializes the transport
 func (t *Mark3LabsTransport) Start(ctx context.Context) error {
 	// Create Streamable HTTP transport with headers
 	httpTransport, err := transport.NewStreamableHTTP(
 		t.url,
 		transport.WithContinuousListening(),
-		transport.WithHTTPHeaders(t.headers),
+		transport.WithHTTPHeaderFunc(func(context.Context) map[string]string {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			return t.headers
+		}),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create transport: %w", err)
@@ -61,7 +94,12 @@ func (t *Mark3LabsTransport) Start(ctx context.Context) error {
 }
 
 // SendRequest sends a JSON-RPC request and waits for response
+// Safe for concurrent use after Start; the underlying mcp-go client serializes the wire protocol.
 func (t *Mark3LabsTransport) SendRequest(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	if t.mcpClient == nil {
+		return nil, fmt.Errorf("transport not started")
+	}
+
 	// Handle initialize specially
 	if method == "initialize" {
 		initParams, ok := params.(InitializeRequest)
@@ -85,7 +123,7 @@ func (t *Mark3LabsTransport) SendRequest(ctx context.Context, method string, par
 			return nil, fmt.Errorf("initialize failed: %w", err)
 		}
 
-		t.initialized = true
+		t.initialized.Store(true)
 
 		// Convert InitializeResult to our format
 		response := InitializeResponse{
@@ -101,7 +139,7 @@ func (t *Mark3LabsTransport) SendRequest(ctx context.Context, method string, par
 
 	// Handle tools/list
 	if method == "tools/list" {
-		if !t.initialized {
+		if !t.initialized.Load() {
 			return nil, fmt.Errorf("client not initialized")
 		}
 
@@ -136,7 +174,7 @@ func (t *Mark3LabsTransport) SendRequest(ctx context.Context, method string, par
 
 	// Handle tools/call
 	if method == "tools/call" {
-		if !t.initialized {
+		if !t.initialized.Load() {
 			return nil, fmt.Errorf("client not initialized")
 		}
 
@@ -160,6 +198,14 @@ func (t *Mark3LabsTransport) SendRequest(ctx context.Context, method string, par
 		return json.Marshal(result)
 	}
 
+	// Handle ping
+	if method == PingMethod {
+		if err := t.mcpClient.Ping(ctx); err != nil {
+			return nil, fmt.Errorf("ping failed: %w", err)
+		}
+		return json.RawMessage("{}"), nil
+	}
+
 	return nil, fmt.Errorf("unsupported method: %s", method)
 }
 
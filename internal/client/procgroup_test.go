@@ -0,0 +1,55 @@
+//go:build linux
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processAlive reports whether pid is running; zombies count as exited
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+// TestCloseKillsProcessGroup verifies Close kills children the server left running
+func TestCloseKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	transport := NewStdioTransport([]string{"sh", "-c", "sleep 60 & echo $! > " + pidFile + "; cat"}, time.Minute)
+	if err := transport.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	var childPid int
+	deadline := time.Now().Add(5 * time.Second)
+	for childPid == 0 && time.Now().Before(deadline) {
+		if data, err := os.ReadFile(pidFile); err == nil {
+			childPid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if childPid == 0 {
+		t.Fatal("child never started")
+	}
+
+	transport.Close()
+
+	deadline = time.Now().Add(5 * time.Second)
+	for processAlive(childPid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("child %d still running after Close", childPid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
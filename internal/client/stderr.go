@@ -0,0 +1,50 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// StderrLevelOff in a server's stderr_level drops all of its stderr output
+const StderrLevelOff = "off"
+
+// ParseStderrLevel parses a server's stderr_level: debug, info (the default when
+// empty), warn, error or off. enabled is false for off.
+func ParseStderrLevel(level string) (minLevel slog.Level, enabled bool, err error) {
+	switch strings.ToLower(level) {
+	case "":
+		return slog.LevelInfo, true, nil
+	case StderrLevelOff:
+		return 0, false, nil
+	}
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return 0, false, fmt.Errorf("invalid stderr_level %q (supported: debug, info, warn, error, off)", level)
+	}
+	return minLevel, true, nil
+}
+
+// newStderrLogger returns the logger a server's stderr lines are written to: text
+// records on w carrying a server attribute, dropping lines below minLevel
+func newStderrLogger(w io.Writer, server string, minLevel slog.Level) *slog.Logger {
+	handler := slog.NewTextHandler(w, &slog.HandlerOptions{Level: minLevel})
+	return slog.New(handler).With("server", server)
+}
+
+// stderrLineLevel guesses a stderr line's level from the markers Python logging
+// and uvicorn print; unmarked lines are info
+func stderrLineLevel(line string) slog.Level {
+	upper := strings.ToUpper(line)
+	switch {
+	case strings.Contains(upper, "CRITICAL"), strings.Contains(upper, "ERROR"),
+		strings.Contains(upper, "TRACEBACK"), strings.Contains(upper, "EXCEPTION"):
+		return slog.LevelError
+	case strings.Contains(upper, "WARNING"), strings.Contains(upper, "WARN"):
+		return slog.LevelWarn
+	case strings.Contains(upper, "DEBUG"):
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStderrLevel(t *testing.T) {
+	tests := []struct {
+		level       string
+		wantLevel   slog.Level
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{"", slog.LevelInfo, true, false},
+		{"debug", slog.LevelDebug, true, false},
+		{"WARN", slog.LevelWarn, true, false},
+		{"error", slog.LevelError, true, false},
+		{"off", 0, false, false},
+		{"loud", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			level, enabled, err := ParseStderrLevel(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if level != tt.wantLevel || enabled != tt.wantEnabled {
+				t.Errorf("got %v/%v, want %v/%v", level, enabled, tt.wantLevel, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+// TestLogStderr verifies stderr lines are logged with the server name and level,
+// and lines below the minimum level are dropped
+func TestLogStderr(t *testing.T) {
+	var out bytes.Buffer
+	reader, writer := io.Pipe()
+	transport := NewStdioTransport([]string{"unused"}, time.Minute)
+	transport.stderr = reader
+	transport.stderrLog = newStderrLogger(&out, "yolo-mcp-server", slog.LevelWarn)
+
+	done := make(chan struct{})
+	go func() {
+		transport.logStderr()
+		close(done)
+	}()
+	io.WriteString(writer, "INFO: loading yolov8n-pose.pt\nWARNING: low confidence\nTraceback (most recent call last):\n")
+	writer.Close()
+	<-done
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	for i, want := range []string{"level=WARN", "level=ERROR"} {
+		if !strings.Contains(lines[i], want) || !strings.Contains(lines[i], "server=yolo-mcp-server") {
+			t.Errorf("line %d = %q, want %s with the server name", i, lines[i], want)
+		}
+	}
+}
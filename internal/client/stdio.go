@@ -6,17 +6,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"log/slog"
+	"os"
 	"os/exec"
+	"runtime"
 	"sync"
 	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
 )
 
+// CancelNotificationMethod is the MCP notification asking a server to abandon a request
+const CancelNotificationMethod = "notifications/cancelled"
+
 // StdioTransport implements Transport interface using stdio
 type StdioTransport struct {
 	command []string
 	timeout time.Duration
 
+	// cancelRequests sends CancelNotificationMethod for requests the caller gave up on
+	cancelRequests bool
+
+	// stderrLog receives the server's stderr lines; nil drops them
+	stderrLog *slog.Logger
+
 	cmd    *exec.Cmd
+	reaper runtime.Cleanup // kills the process group if the transport is dropped without Close
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr io.ReadCloser
@@ -26,6 +42,9 @@ type StdioTransport struct {
 	pendingReqs map[int]chan *JSONRPCResponse
 	mu          sync.Mutex
 
+	// writeMu keeps concurrent messages from interleaving on stdin
+	writeMu sync.Mutex
+
 	// Background reader
 	readerCtx    context.Context
 	readerCancel context.CancelFunc
@@ -40,7 +59,24 @@ func NewStdioTransport(command []string, timeout time.Duration) *StdioTransport
 		pendingReqs: make(map[int]chan *JSONRPCResponse),
 		nextID:      1,
 		readerDone:  make(chan struct{}),
+		stderrLog:   newStderrLogger(os.Stderr, serverLabel(command), slog.LevelInfo),
+	}
+}
+
+// SetStderrLog sets where the server's stderr lines go: records at or above minLevel on
+// os.Stderr carrying the server name. Disabled drops stderr entirely.
+func (t *StdioTransport) SetStderrLog(server string, minLevel slog.Level, enabled bool) {
+	if !enabled {
+		t.stderrLog = nil
+		return
 	}
+	t.stderrLog = newStderrLogger(os.Stderr, server, minLevel)
+}
+
+// SetCancelRequests enables telling the server to stop work on requests that were
+// abandoned because the caller's context was cancelled or the request timed out
+func (t *StdioTransport) SetCancelRequests(enabled bool) {
+	t.cancelRequests = enabled
 }
 
 // Start launches the subprocess and starts reading
@@ -49,8 +85,9 @@ func (t *StdioTransport) Start(ctx context.Context) error {
 		return fmt.Errorf("command cannot be empty")
 	}
 
-	// Create command
-	t.cmd = exec.CommandContext(ctx, t.command[0], t.command[1:]...)
+	// Create command in its own process group; cancelling ctx kills the whole group
+	t.cmd = procgroup.CommandContext(ctx, resolveCommand(t.command[0]), t.command[1:]...)
+	cmd := t.cmd
 
 	// Setup pipes
 	var err error
@@ -74,6 +111,10 @@ func (t *StdioTransport) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 
+	// Safety net for callers that never Close: once the transport is unreachable
+	// (the server exited and the readers stopped), kill whatever it left behind
+	t.reaper = runtime.AddCleanup(t, reapProcessGroup, cmd.Process.Pid)
+
 	// Start background reader
 	t.readerCtx, t.readerCancel = context.WithCancel(context.Background())
 	go t.readLoop()
@@ -113,12 +154,12 @@ func (t *StdioTransport) SendRequest(ctx context.Context, method string, params
 	}
 
 	data = append(data, '\n')
-	if _, err := t.stdin.Write(data); err != nil {
+	if err := t.write(data); err != nil {
 		return nil, fmt.Errorf("failed to write request: %w", err)
 	}
 
-	// Wait for response with timeout
-	timeoutCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	// Wait for response with timeout (callers may extend it with WithRequestTimeout)
+	timeoutCtx, cancel := context.WithTimeout(ctx, requestTimeout(ctx, t.timeout))
 	defer cancel()
 
 	select {
@@ -128,6 +169,10 @@ func (t *StdioTransport) SendRequest(ctx context.Context, method string, params
 		}
 		return resp.Result, nil
 	case <-timeoutCtx.Done():
+		// The initialize request must not be cancelled (MCP spec)
+		if t.cancelRequests && method != "initialize" {
+			t.sendCancel(id, timeoutCtx.Err())
+		}
 		return nil, fmt.Errorf("request timeout: %w", timeoutCtx.Err())
 	case <-t.readerDone:
 		return nil, fmt.Errorf("transport closed")
@@ -150,13 +195,34 @@ func (t *StdioTransport) SendNotification(ctx context.Context, method string, pa
 	}
 
 	data = append(data, '\n')
-	if _, err := t.stdin.Write(data); err != nil {
+	if err := t.write(data); err != nil {
 		return fmt.Errorf("failed to write notification: %w", err)
 	}
 
 	return nil
 }
 
+// sendCancel notifies the server that request id was abandoned. It is best effort:
+// servers that don't support cancellation ignore the notification and the late
+// response is dropped by readLoop.
+func (t *StdioTransport) sendCancel(id int, reason error) {
+	params := map[string]interface{}{
+		"requestId": id,
+		"reason":    reason.Error(),
+	}
+	if err := t.SendNotification(context.Background(), CancelNotificationMethod, params); err != nil {
+		log.Printf("Warning: failed to cancel request %d: %v", id, err)
+	}
+}
+
+// write sends one newline-terminated message to the server
+func (t *StdioTransport) write(data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err := t.stdin.Write(data)
+	return err
+}
+
 // Close shuts down the transport
 func (t *StdioTransport) Close() error {
 	// Cancel reader
@@ -169,8 +235,10 @@ func (t *StdioTransport) Close() error {
 		t.stdin.Close()
 	}
 
-	// Wait for process with timeout
+	// Wait for process with timeout, then kill its group so no child outlives it
 	if t.cmd != nil && t.cmd.Process != nil {
+		t.reaper.Stop()
+
 		done := make(chan error, 1)
 		go func() {
 			done <- t.cmd.Wait()
@@ -180,8 +248,10 @@ func (t *StdioTransport) Close() error {
 		case <-done:
 			// Process exited
 		case <-time.After(5 * time.Second):
-			// Force kill
-			t.cmd.Process.Kill()
+			log.Printf("Warning: MCP server %s did not exit, killing its process group", t.command[0])
+		}
+		if err := procgroup.Kill(t.cmd.Process.Pid); err != nil {
+			log.Printf("Warning: failed to kill MCP server %s process group: %v", t.command[0], err)
 		}
 	}
 
@@ -221,25 +291,57 @@ func (t *StdioTransport) readLoop() {
 			continue
 		}
 
-		// Route to pending request
+		// Route to pending request; a duplicate response must not block the reader
 		t.mu.Lock()
 		if ch, ok := t.pendingReqs[resp.ID]; ok {
-			ch <- &resp
+			select {
+			case ch <- &resp:
+			default:
+			}
 		}
 		t.mu.Unlock()
 	}
 
 	if err := scanner.Err(); err != nil {
 		// Log error (could add structured logging here)
-		fmt.Printf("Error reading stdout: %v\n", err)
+		log.Printf("Error reading stdout: %v", err)
 	}
 }
 
-// logStderr reads and logs stderr output
+// logStderr routes stderr lines to the stderr logger, keeping stdout free for --json.
+// Lines are drained even when dropped so the server never blocks on a full pipe.
 func (t *StdioTransport) logStderr() {
 	scanner := bufio.NewScanner(t.stderr)
 	for scanner.Scan() {
-		// Could integrate with structured logging
-		fmt.Printf("[SERVER STDERR] %s\n", scanner.Text())
+		if t.stderrLog == nil {
+			continue
+		}
+		line := scanner.Text()
+		t.stderrLog.Log(context.Background(), stderrLineLevel(line), line)
+	}
+}
+
+// TransportGoroutines match the stacks of the goroutines reading from MCP servers, for
+// status dumps: the stdio read loops and the HTTP transport's
+var TransportGoroutines = []string{
+	"(*StdioTransport).readLoop",
+	"(*StdioTransport).logStderr",
+	"mcp-go/client/transport.",
+}
+
+// serverLabel names a server by its executable until a configured name is set
+func serverLabel(command []string) string {
+	if len(command) == 0 {
+		return "stdio"
+	}
+	return command[0]
+}
+
+// reapProcessGroup kills the process group of a transport that was never closed
+func reapProcessGroup(pid int) {
+	if err := procgroup.Kill(pid); err != nil {
+		log.Printf("Warning: failed to reap orphaned MCP server process group %d: %v", pid, err)
+		return
 	}
+	log.Printf("Reaped process group %d of an MCP server transport that was never closed", pid)
 }
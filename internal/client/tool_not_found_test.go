@@ -3,8 +3,12 @@ package client
 import (
 	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
 )
 
 // TestToolNotFound verifies proper handling of tool not found errors
@@ -249,3 +253,60 @@ func TestToolNotFoundAfterList(t *testing.T) {
 		t.Errorf("Expected error code -32000, got %d", jsonRPCErr.Code)
 	}
 }
+
+// TestValidateToolsSuggestions verifies the error names the offered tools and close
+// matches for each missing one
+func TestValidateToolsSuggestions(t *testing.T) {
+	available := []types.Tool{{Name: "fill"}, {Name: "detect_objects"}, {Name: "crop"}, {Name: "resize"}}
+
+	err := ValidateTools(available, []string{"detect", "fil", "blur"})
+	var missingErr *MissingToolsError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("Expected a *MissingToolsError, got %v", err)
+	}
+	if !reflect.DeepEqual(missingErr.Missing, []string{"detect", "fil", "blur"}) {
+		t.Errorf("Missing = %v", missingErr.Missing)
+	}
+	if got := missingErr.Suggestions["detect"]; !reflect.DeepEqual(got, []string{"detect_objects"}) {
+		t.Errorf("Suggestions for detect = %v, want [detect_objects]", got)
+	}
+	if got := missingErr.Suggestions["fil"]; !reflect.DeepEqual(got, []string{"fill"}) {
+		t.Errorf("Suggestions for fil = %v, want [fill]", got)
+	}
+	if _, ok := missingErr.Suggestions["blur"]; ok {
+		t.Errorf("Expected no suggestion for blur, got %v", missingErr.Suggestions["blur"])
+	}
+
+	message := err.Error()
+	for _, want := range []string{
+		"missing required tools: [detect fil blur]",
+		"detect: did you mean detect_objects?",
+		"(available: crop, detect_objects, fill, resize)",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected %q in %q", want, message)
+		}
+	}
+
+	if err := ValidateTools(nil, []string{"detect"}); err == nil || !strings.Contains(err.Error(), "server offers no tools") {
+		t.Errorf("Expected an error saying the server offers no tools, got %v", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"fill", "fill", 0},
+		{"fil", "fill", 1},
+		{"detect", "detcet", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.distance {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.distance)
+		}
+	}
+}
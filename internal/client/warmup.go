@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultWarmupTimeout bounds a warmup call when the server config sets none.
+// Cold servers may download model weights before answering.
+const DefaultWarmupTimeout = 5 * time.Minute
+
+// CanaryImagePlaceholder in warmup arguments is replaced with the canary image path
+const CanaryImagePlaceholder = "{canary_image}"
+
+// prepareToolNames are tools servers commonly expose to fetch or load their models.
+// They are called without arguments when no warmup tool is configured.
+var prepareToolNames = []string{"download_models", "prepare_models", "warmup"}
+
+// WarmupResult records the outcome of warming up one server
+type WarmupResult struct {
+	Server   string
+	Tool     string // Empty if the server had nothing to warm up
+	Duration time.Duration
+	Err      error
+}
+
+type requestTimeoutKey struct{}
+
+// WithRequestTimeout overrides the transport's per-request timeout for calls made with ctx
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+// requestTimeout returns the timeout set by WithRequestTimeout, or fallback
+func requestTimeout(ctx context.Context, fallback time.Duration) time.Duration {
+	if timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+		return timeout
+	}
+	return fallback
+}
+
+// Warmup calls the server's configured warmup tool, or a known model-preparation tool if
+// it exposes one, so later stages run against loaded models. tools is the server's tool
+// list; canaryPath replaces CanaryImagePlaceholder in configured arguments.
+func Warmup(ctx context.Context, mcpClient MCPClient, server string, tools []types.Tool, config types.WarmupConfig, canaryPath string) WarmupResult {
+	result := WarmupResult{Server: server}
+	if config.Disabled {
+		return result
+	}
+
+	arguments := map[string]interface{}{}
+	if config.Tool != "" {
+		result.Tool = config.Tool
+		for key, value := range config.Arguments {
+			if value == CanaryImagePlaceholder {
+				value = canaryPath
+			}
+			arguments[key] = value
+		}
+	} else {
+		result.Tool = findPrepareTool(tools)
+	}
+	if result.Tool == "" {
+		return result
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWarmupTimeout
+	}
+	ctx, cancel := context.WithTimeout(WithRequestTimeout(ctx, timeout), timeout)
+	defer cancel()
+
+	start := time.Now()
+	callResult, err := mcpClient.CallTool(ctx, result.Tool, arguments)
+	result.Duration = time.Since(start)
+	if err == nil && callResult.IsError {
+		err = fmt.Errorf("tool reported an error")
+		if len(callResult.Content) > 0 {
+			err = fmt.Errorf("tool reported an error: %s", callResult.Content[0].Text)
+		}
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("warmup %s failed: %w", result.Tool, err)
+	}
+	return result
+}
+
+// findPrepareTool returns the first known model-preparation tool in tools
+func findPrepareTool(tools []types.Tool) string {
+	available := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		available[tool.Name] = true
+	}
+	for _, name := range prepareToolNames {
+		if available[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// WriteCanaryImage writes a small 32x32 PNG into dir for canary tool calls
+func WriteCanaryImage(dir string) (string, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 8), G: uint8(y * 8), B: 128, A: 255})
+		}
+	}
+
+	path, err := filepath.Abs(filepath.Join(dir, "warmup_canary.png"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve canary path: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create canary image: %w", err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to encode canary image: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write canary image: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"image/png"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// recordingMCPClient records tool calls and answers with a fixed result
+type recordingMCPClient struct {
+	result    *types.ToolCallResult
+	err       error
+	calls     []string
+	arguments []map[string]interface{}
+	timeouts  []time.Duration
+}
+
+func (r *recordingMCPClient) Connect(ctx context.Context) error                   { return nil }
+func (r *recordingMCPClient) Initialize(ctx context.Context) error                { return nil }
+func (r *recordingMCPClient) Close() error                                        { return nil }
+func (r *recordingMCPClient) GetServerInfo() (string, string)                     { return "recording", "1.0.0" }
+func (r *recordingMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) { return nil, nil }
+
+func (r *recordingMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	r.calls = append(r.calls, name)
+	r.arguments = append(r.arguments, arguments)
+	r.timeouts = append(r.timeouts, requestTimeout(ctx, 0))
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.result, nil
+}
+
+func TestWarmup(t *testing.T) {
+	okResult := &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: "ok"}}}
+
+	tests := []struct {
+		name          string
+		tools         []types.Tool
+		config        types.WarmupConfig
+		callErr       error
+		result        *types.ToolCallResult
+		expectTool    string
+		expectErr     bool
+		expectTimeout time.Duration
+	}{
+		{
+			name:          "configured canary",
+			tools:         []types.Tool{{Name: "detect"}},
+			config:        types.WarmupConfig{Tool: "detect", Arguments: map[string]interface{}{"input_path": CanaryImagePlaceholder, "confidence": 0.5}, Timeout: time.Minute},
+			expectTool:    "detect",
+			expectTimeout: time.Minute,
+		},
+		{
+			name:          "prepare tool discovered",
+			tools:         []types.Tool{{Name: "detect"}, {Name: "download_models"}},
+			expectTool:    "download_models",
+			expectTimeout: DefaultWarmupTimeout,
+		},
+		{
+			name:  "nothing to warm up",
+			tools: []types.Tool{{Name: "detect"}},
+		},
+		{
+			name:   "disabled",
+			tools:  []types.Tool{{Name: "download_models"}},
+			config: types.WarmupConfig{Disabled: true},
+		},
+		{
+			name:          "call fails",
+			tools:         []types.Tool{{Name: "warmup"}},
+			callErr:       fmt.Errorf("request timeout"),
+			expectTool:    "warmup",
+			expectErr:     true,
+			expectTimeout: DefaultWarmupTimeout,
+		},
+		{
+			name:          "tool error",
+			tools:         []types.Tool{{Name: "warmup"}},
+			result:        &types.ToolCallResult{IsError: true, Content: []types.ContentBlock{{Type: "text", Text: "no GPU"}}},
+			expectTool:    "warmup",
+			expectErr:     true,
+			expectTimeout: DefaultWarmupTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcpClient := &recordingMCPClient{result: okResult, err: tt.callErr}
+			if tt.result != nil {
+				mcpClient.result = tt.result
+			}
+
+			result := Warmup(context.Background(), mcpClient, "test", tt.tools, tt.config, "/tmp/canary.png")
+
+			if result.Tool != tt.expectTool {
+				t.Errorf("Expected tool %q, got %q", tt.expectTool, result.Tool)
+			}
+			if (result.Err != nil) != tt.expectErr {
+				t.Errorf("Expected error=%v, got %v", tt.expectErr, result.Err)
+			}
+			if tt.expectTool == "" {
+				if len(mcpClient.calls) != 0 {
+					t.Errorf("Expected no calls, got %v", mcpClient.calls)
+				}
+				return
+			}
+			if len(mcpClient.calls) != 1 || mcpClient.calls[0] != tt.expectTool {
+				t.Fatalf("Expected one call to %s, got %v", tt.expectTool, mcpClient.calls)
+			}
+			if mcpClient.timeouts[0] != tt.expectTimeout {
+				t.Errorf("Expected request timeout %v, got %v", tt.expectTimeout, mcpClient.timeouts[0])
+			}
+			if path, ok := tt.config.Arguments["input_path"]; ok && path == CanaryImagePlaceholder {
+				if got := mcpClient.arguments[0]["input_path"]; got != "/tmp/canary.png" {
+					t.Errorf("Expected canary path substituted, got %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteCanaryImage(t *testing.T) {
+	path, err := WriteCanaryImage(t.TempDir())
+	if err != nil {
+		t.Fatalf("WriteCanaryImage failed: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open canary: %v", err)
+	}
+	defer file.Close()
+
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("Canary is not a PNG: %v", err)
+	}
+	if config.Width != 32 || config.Height != 32 {
+		t.Errorf("Expected 32x32 canary, got %dx%d", config.Width, config.Height)
+	}
+}
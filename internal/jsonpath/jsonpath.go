@@ -0,0 +1,86 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lookup resolves a dotted path against a decoded JSON document.
+// Segments are object keys, optionally followed by an array index, e.g.
+// "data.recordings.nodes[0].recording.title". An empty path returns doc itself.
+func Lookup(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		key, indexes, err := parseSegment(segment)
+		if err != nil {
+			return nil, false
+		}
+
+		if key != "" {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if current, ok = obj[key]; !ok {
+				return nil, false
+			}
+		}
+
+		for _, index := range indexes {
+			arr, ok := current.([]interface{})
+			if !ok || index < 0 || index >= len(arr) {
+				return nil, false
+			}
+			current = arr[index]
+		}
+	}
+
+	return current, true
+}
+
+// LookupString resolves a path and returns the value if it is a non-empty string
+func LookupString(doc interface{}, path string) (string, bool) {
+	value, ok := Lookup(doc, path)
+	if !ok {
+		return "", false
+	}
+	str, ok := value.(string)
+	if !ok || str == "" {
+		return "", false
+	}
+	return str, true
+}
+
+// parseSegment splits "nodes[0][1]" into ("nodes", [0, 1])
+func parseSegment(segment string) (string, []int, error) {
+	open := strings.Index(segment, "[")
+	if open < 0 {
+		return segment, nil, nil
+	}
+
+	key := segment[:open]
+	var indexes []int
+	rest := segment[open:]
+	for rest != "" {
+		if rest[0] != '[' {
+			return "", nil, fmt.Errorf("invalid path segment: %s", segment)
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated index in path segment: %s", segment)
+		}
+		index, err := strconv.Atoi(rest[1:end])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid index in path segment %s: %w", segment, err)
+		}
+		indexes = append(indexes, index)
+		rest = rest[end+1:]
+	}
+
+	return key, indexes, nil
+}
@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxAdviceTokens caps the reply to a question asked through an Advisor
+const MaxAdviceTokens = 512
+
+// Advisor is implemented by providers that can answer a single text question without
+// tools or images, e.g. how to adjust a stage's parameters after it failed
+type Advisor interface {
+	Ask(ctx context.Context, question string) (*Advice, error)
+}
+
+// Advice is an Advisor's answer with the tokens it cost
+type Advice struct {
+	Text         string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+// CostUSD prices the advice at the list price of provider's model
+func (a *Advice) CostUSD(provider string) float64 {
+	pricing := PricingFor(provider, a.Model)
+	return (float64(a.InputTokens)*pricing.InputPerMTok + float64(a.OutputTokens)*pricing.OutputPerMTok) / 1e6
+}
+
+// EstimateAdviceCostUSD is the most a question may cost with provider's default model:
+// the question's tokens and a reply of MaxAdviceTokens
+func EstimateAdviceCostUSD(provider, question string) float64 {
+	advice := Advice{
+		InputTokens:  EstimatorFor(provider, "").TextTokens(question),
+		OutputTokens: MaxAdviceTokens,
+	}
+	return advice.CostUSD(provider)
+}
+
+// DecodeAdvice decodes the JSON object in an answer into v. Models often wrap it in a
+// markdown code fence or a sentence, so the outermost braces are decoded.
+func DecodeAdvice(text string, v interface{}) error {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object in answer %q", text)
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), v); err != nil {
+		return fmt.Errorf("malformed JSON in answer: %w", err)
+	}
+	return nil
+}
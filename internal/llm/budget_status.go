@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultBudgetStatusFormat is used when no format is configured
+const DefaultBudgetStatusFormat = "Round {round}/{max_rounds}, {tokens}/{max_tokens} tokens, ${cost}/${max_cost} spent - {remaining} rounds remaining, prioritize finishing the workflow."
+
+// Markers wrapping the injected status so it can be stripped from model output
+const (
+	budgetStatusOpen  = "<budget_status>"
+	budgetStatusClose = "</budget_status>"
+)
+
+var budgetStatusPattern = regexp.MustCompile(`(?s)\s*` + regexp.QuoteMeta(budgetStatusOpen) + `.*?` + regexp.QuoteMeta(budgetStatusClose))
+
+// BudgetSnapshot captures conversation usage at the end of a round
+type BudgetSnapshot struct {
+	Round      int // Rounds completed so far (1-based)
+	MaxRounds  int
+	TokensUsed int
+	MaxTokens  int
+	CostUSD    float64
+	MaxCostUSD float64
+}
+
+// NewBudgetSnapshot captures a conversation's usage after round rounds and tokensUsed
+// tokens against config's limits. costUSD is the cost the conversation's metrics report.
+func NewBudgetSnapshot(config *FullAIConversationConfig, round, tokensUsed int, costUSD float64) BudgetSnapshot {
+	return BudgetSnapshot{
+		Round:      round,
+		MaxRounds:  config.MaxRounds,
+		TokensUsed: tokensUsed,
+		MaxTokens:  config.MaxTokens,
+		CostUSD:    costUSD,
+		MaxCostUSD: config.MaxCostUSD,
+	}
+}
+
+// FormatBudgetStatus renders the status line for a round.
+// Returns "" when the reminder is disabled or the round is below the start threshold.
+func FormatBudgetStatus(config types.BudgetStatusConfig, snapshot BudgetSnapshot) string {
+	if config.Disabled {
+		return ""
+	}
+
+	startRound := config.StartRound
+	if startRound <= 0 {
+		startRound = 1
+	}
+	if snapshot.Round < startRound {
+		return ""
+	}
+
+	format := config.Format
+	if format == "" {
+		format = DefaultBudgetStatusFormat
+	}
+
+	remaining := snapshot.MaxRounds - snapshot.Round
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	replacer := strings.NewReplacer(
+		"{round}", strconv.Itoa(snapshot.Round),
+		"{max_rounds}", strconv.Itoa(snapshot.MaxRounds),
+		"{tokens}", formatTokenCount(snapshot.TokensUsed),
+		"{max_tokens}", formatTokenCount(snapshot.MaxTokens),
+		"{cost}", fmt.Sprintf("%.2f", snapshot.CostUSD),
+		"{max_cost}", fmt.Sprintf("%.2f", snapshot.MaxCostUSD),
+		"{remaining}", strconv.Itoa(remaining),
+	)
+
+	return budgetStatusOpen + replacer.Replace(format) + budgetStatusClose
+}
+
+// StripBudgetStatus removes any injected status lines the model may have echoed back
+func StripBudgetStatus(text string) string {
+	return strings.TrimSpace(budgetStatusPattern.ReplaceAllString(text, ""))
+}
+
+// formatTokenCount renders token counts compactly (e.g. 38000 -> "38k")
+func formatTokenCount(tokens int) string {
+	if tokens >= 1000 {
+		return fmt.Sprintf("%dk", tokens/1000)
+	}
+	return strconv.Itoa(tokens)
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestFormatBudgetStatusThreshold verifies the reminder appears starting at the configured round
+func TestFormatBudgetStatusThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     types.BudgetStatusConfig
+		round      int
+		expectText bool
+	}{
+		{
+			name:       "default threshold includes first round",
+			config:     types.BudgetStatusConfig{},
+			round:      1,
+			expectText: true,
+		},
+		{
+			name:       "before configured threshold",
+			config:     types.BudgetStatusConfig{StartRound: 5},
+			round:      4,
+			expectText: false,
+		},
+		{
+			name:       "at configured threshold",
+			config:     types.BudgetStatusConfig{StartRound: 5},
+			round:      5,
+			expectText: true,
+		},
+		{
+			name:       "after configured threshold",
+			config:     types.BudgetStatusConfig{StartRound: 5},
+			round:      12,
+			expectText: true,
+		},
+		{
+			name:       "disabled",
+			config:     types.BudgetStatusConfig{Disabled: true},
+			round:      12,
+			expectText: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := FormatBudgetStatus(tt.config, BudgetSnapshot{
+				Round:      tt.round,
+				MaxRounds:  20,
+				TokensUsed: 38000,
+				MaxTokens:  100000,
+				CostUSD:    0.21,
+				MaxCostUSD: 0.50,
+			})
+
+			if tt.expectText && status == "" {
+				t.Fatal("Expected budget status, got empty string")
+			}
+			if !tt.expectText && status != "" {
+				t.Fatalf("Expected no budget status, got %q", status)
+			}
+		})
+	}
+}
+
+// TestFormatBudgetStatusDefaultFormat verifies the default status line contents
+func TestFormatBudgetStatusDefaultFormat(t *testing.T) {
+	status := FormatBudgetStatus(types.BudgetStatusConfig{}, BudgetSnapshot{
+		Round:      7,
+		MaxRounds:  20,
+		TokensUsed: 38000,
+		MaxTokens:  100000,
+		CostUSD:    0.21,
+		MaxCostUSD: 0.50,
+	})
+
+	for _, want := range []string{"Round 7/20", "38k/100k tokens", "$0.21/$0.50 spent", "13 rounds remaining"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("Expected status to contain %q, got %q", want, status)
+		}
+	}
+}
+
+// TestFormatBudgetStatusCustomFormat verifies a configured format is honored
+func TestFormatBudgetStatusCustomFormat(t *testing.T) {
+	status := FormatBudgetStatus(types.BudgetStatusConfig{Format: "{remaining} left"}, BudgetSnapshot{
+		Round:     18,
+		MaxRounds: 20,
+	})
+
+	if StripBudgetStatus("prefix "+status) != "prefix" {
+		t.Errorf("Expected status to be strippable, got %q", status)
+	}
+	if !strings.Contains(status, "2 left") {
+		t.Errorf("Expected custom format, got %q", status)
+	}
+}
+
+// TestStripBudgetStatus verifies injected status lines are removed from final output
+func TestStripBudgetStatus(t *testing.T) {
+	status := FormatBudgetStatus(types.BudgetStatusConfig{}, BudgetSnapshot{Round: 3, MaxRounds: 20})
+	text := "Final video: /out/final.mp4\n" + status
+
+	if got := StripBudgetStatus(text); got != "Final video: /out/final.mp4" {
+		t.Errorf("Expected status stripped, got %q", got)
+	}
+}
+
+func TestNewBudgetSnapshot(t *testing.T) {
+	config := &FullAIConversationConfig{MaxRounds: 10, MaxTokens: 50000, MaxCostUSD: 0.5}
+	expected := BudgetSnapshot{Round: 3, MaxRounds: 10, TokensUsed: 12000, MaxTokens: 50000, CostUSD: 0.06, MaxCostUSD: 0.5}
+	if got := NewBudgetSnapshot(config, 3, 12000, 0.06); got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
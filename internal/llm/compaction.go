@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Defaults for history compaction
+const (
+	DefaultCompactAfterRound = 6 // First round whose request is compacted
+	DefaultCompactKeepRounds = 3 // Rounds whose tool results are always sent verbatim
+)
+
+// HistoryCompactor keeps the input tokens of long conversations in check by replacing
+// the tool results of old rounds with short placeholders. Providers track each tool
+// result they add to their history with a callback that rewrites its content; the
+// messages themselves, their tool call IDs and the original image and prompts are
+// never removed, so every tool call keeps its paired result. A nil compactor does nothing.
+type HistoryCompactor struct {
+	afterRound int
+	keepRounds int
+	results    []trackedResult
+	elided     int
+}
+
+// trackedResult is a tool result in a provider's history that can still be elided
+type trackedResult struct {
+	round int
+	tool  string
+	elide func(placeholder string)
+}
+
+// NewHistoryCompactor creates a compactor from config, or returns nil when disabled
+func NewHistoryCompactor(config types.HistoryCompactionConfig) *HistoryCompactor {
+	if config.Disabled {
+		return nil
+	}
+	h := &HistoryCompactor{
+		afterRound: config.AfterRound,
+		keepRounds: config.KeepRounds,
+	}
+	if h.afterRound <= 0 {
+		h.afterRound = DefaultCompactAfterRound
+	}
+	if h.keepRounds <= 0 {
+		h.keepRounds = DefaultCompactKeepRounds
+	}
+	return h
+}
+
+// Track registers a tool result added to the history in answer to round (1-based).
+// elide replaces the result's content in place, keeping its tool call ID.
+func (h *HistoryCompactor) Track(round int, tool string, elide func(placeholder string)) {
+	if h == nil {
+		return
+	}
+	h.results = append(h.results, trackedResult{round: round, tool: tool, elide: elide})
+}
+
+// Compact elides tracked results older than the last keep_rounds rounds once
+// completedRounds reaches the threshold. Call it before each API request.
+// Returns the number of results elided by this call.
+func (h *HistoryCompactor) Compact(completedRounds int) int {
+	if h == nil || completedRounds+1 < h.afterRound {
+		return 0
+	}
+	cutoff := completedRounds - h.keepRounds
+
+	kept := h.results[:0]
+	count := 0
+	for _, result := range h.results {
+		if result.round > cutoff {
+			kept = append(kept, result)
+			continue
+		}
+		result.elide(ElidedResultText(result.tool, result.round))
+		count++
+	}
+	h.results = kept
+	h.elided += count
+
+	if count > 0 {
+		log.Printf("[History] Elided %d tool results from rounds 1-%d (%d total)", count, cutoff, h.elided)
+	}
+	return count
+}
+
+// Elided returns the number of tool results elided so far
+func (h *HistoryCompactor) Elided() int {
+	if h == nil {
+		return 0
+	}
+	return h.elided
+}
+
+// ElidedResultText is the placeholder that replaces an elided tool result
+func ElidedResultText(tool string, round int) string {
+	return fmt.Sprintf("[%s result from round %d elided to save context. Call the tool again if you still need it.]", tool, round)
+}
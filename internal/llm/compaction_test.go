@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestHistoryCompactor(t *testing.T) {
+	if NewHistoryCompactor(types.HistoryCompactionConfig{Disabled: true}) != nil {
+		t.Error("Expected a disabled compactor to be nil")
+	}
+	var disabled *HistoryCompactor
+	disabled.Track(1, "video__animate", func(string) { t.Error("Nil compactor elided a result") })
+	if disabled.Compact(10) != 0 || disabled.Elided() != 0 {
+		t.Error("Expected a nil compactor to do nothing")
+	}
+
+	compactor := NewHistoryCompactor(types.HistoryCompactionConfig{AfterRound: 3, KeepRounds: 2})
+	contents := make(map[int]string)
+	for round := 1; round <= 5; round++ {
+		contents[round] = "full result"
+		compactor.Track(round, "imagesorcery__detect", func(placeholder string) {
+			contents[round] = placeholder
+		})
+	}
+
+	tests := []struct {
+		completedRounds int
+		elided          int
+		verbatimFrom    int // First round whose result is still verbatim
+	}{
+		{1, 0, 1}, // Request for round 2 is below after_round
+		{2, 0, 1}, // Rounds 1 and 2 are the last keep_rounds
+		{3, 1, 2},
+		{3, 0, 2}, // Already elided results aren't elided again
+		{5, 2, 4},
+	}
+
+	for _, tt := range tests {
+		if got := compactor.Compact(tt.completedRounds); got != tt.elided {
+			t.Errorf("Compact(%d) elided %d, want %d", tt.completedRounds, got, tt.elided)
+		}
+		for round := 1; round <= 5; round++ {
+			expected := "full result"
+			if round < tt.verbatimFrom {
+				expected = ElidedResultText("imagesorcery__detect", round)
+			}
+			if contents[round] != expected {
+				t.Errorf("After Compact(%d), round %d result is %q, want %q", tt.completedRounds, round, contents[round], expected)
+			}
+		}
+	}
+	if compactor.Elided() != 3 {
+		t.Errorf("Expected 3 elided results, got %d", compactor.Elided())
+	}
+}
+
+func TestNewHistoryCompactorDefaults(t *testing.T) {
+	compactor := NewHistoryCompactor(types.HistoryCompactionConfig{})
+	if compactor.afterRound != DefaultCompactAfterRound || compactor.keepRounds != DefaultCompactKeepRounds {
+		t.Errorf("Expected defaults %d/%d, got %d/%d", DefaultCompactAfterRound, DefaultCompactKeepRounds,
+			compactor.afterRound, compactor.keepRounds)
+	}
+}
@@ -0,0 +1,16 @@
+package llm
+
+import (
+	"log"
+	"os"
+)
+
+// DebugLogging enables verbose diagnostic logs; set AGENT_DEBUG=1 to turn it on
+var DebugLogging = os.Getenv("AGENT_DEBUG") != ""
+
+// debugf logs only when DebugLogging is enabled
+func debugf(format string, args ...interface{}) {
+	if DebugLogging {
+		log.Printf("[debug] "+format, args...)
+	}
+}
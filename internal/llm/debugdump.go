@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Placeholders written in place of stripped values
+const (
+	redactedValue = "[redacted]"
+	elidedFormat  = "[%d base64 chars elided]"
+)
+
+// minElidedBase64 is the length from which an unlabelled base64 string is treated as
+// binary data (e.g. an image returned by a tool) and elided
+const minElidedBase64 = 1024
+
+// secretKeys are JSON keys whose string values are always redacted
+var secretKeys = map[string]bool{
+	"api_key":        true,
+	"apikey":         true,
+	"authorization":  true,
+	"x-api-key":      true,
+	"x-goog-api-key": true,
+	"access_token":   true,
+	"refresh_token":  true,
+	"token":          true,
+	"secret":         true,
+	"password":       true,
+}
+
+// mediaTypeKeys mark an object whose "data" field holds inline media bytes
+var mediaTypeKeys = []string{"media_type", "mimeType", "mime_type", "MIMEType"}
+
+// DebugDumper writes the raw request and response of every provider API call as
+// sanitized JSON files, numbered in call order. A nil dumper does nothing.
+type DebugDumper struct {
+	dir      string
+	provider string
+
+	mu    sync.Mutex
+	calls int
+}
+
+// NewDebugDumper creates a dumper writing into dir, creating it if needed
+func NewDebugDumper(dir, provider string) (*DebugDumper, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create LLM debug directory: %w", err)
+	}
+	return &DebugDumper{dir: dir, provider: provider}, nil
+}
+
+// Dir returns the directory dumps are written to
+func (d *DebugDumper) Dir() string {
+	if d == nil {
+		return ""
+	}
+	return d.dir
+}
+
+// Dump writes one API call of the given round as <call>-round<round>-request.json and
+// -response.json. A failed call writes its error in place of the response.
+func (d *DebugDumper) Dump(round int, request, response interface{}, callErr error) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	d.calls++
+	prefix := filepath.Join(d.dir, fmt.Sprintf("%03d-round%02d", d.calls, round))
+	d.mu.Unlock()
+
+	if err := d.write(prefix+"-request.json", request); err != nil {
+		return err
+	}
+	if callErr != nil {
+		response = map[string]string{"error": callErr.Error()}
+	}
+	return d.write(prefix+"-response.json", response)
+}
+
+// write sanitizes payload and writes it to path
+func (d *DebugDumper) write(path string, payload interface{}) error {
+	sanitized, err := SanitizeDebugPayload(payload)
+	if err != nil {
+		return fmt.Errorf("failed to sanitize %s payload: %w", d.provider, err)
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"provider": d.provider,
+		"payload":  sanitized,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s payload: %w", d.provider, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write LLM debug dump: %w", err)
+	}
+	return nil
+}
+
+// SanitizeDebugPayload round-trips payload through JSON, redacting secrets and
+// eliding image bytes so the result is safe to share
+func SanitizeDebugPayload(payload interface{}) (interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return sanitizeValue(decoded), nil
+}
+
+// sanitizeValue walks a decoded JSON value, replacing secrets and binary data
+func sanitizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		inlineMedia := false
+		for _, key := range mediaTypeKeys {
+			if _, ok := v[key]; ok {
+				inlineMedia = true
+			}
+		}
+		for key, field := range v {
+			s, isString := field.(string)
+			switch {
+			case isString && secretKeys[strings.ToLower(key)]:
+				v[key] = redactedValue
+			case isString && inlineMedia && key == "data":
+				v[key] = fmt.Sprintf(elidedFormat, len(s))
+			default:
+				v[key] = sanitizeValue(field)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = sanitizeValue(item)
+		}
+		return v
+	case string:
+		return sanitizeString(v)
+	default:
+		return v
+	}
+}
+
+// sanitizeString elides base64 data URLs and long base64 strings
+func sanitizeString(s string) string {
+	if strings.HasPrefix(s, "data:") {
+		if i := strings.Index(s, ";base64,"); i >= 0 {
+			header := s[:i+len(";base64,")]
+			return header + fmt.Sprintf(elidedFormat, len(s)-len(header))
+		}
+	}
+	if len(s) >= minElidedBase64 && isBase64(s) {
+		return fmt.Sprintf(elidedFormat, len(s))
+	}
+	return s
+}
+
+// isBase64 reports whether s only contains standard or URL-safe base64 characters
+func isBase64(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '+', r == '/', r == '-', r == '_', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
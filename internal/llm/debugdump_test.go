@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeDebugPayload(t *testing.T) {
+	longBase64 := strings.Repeat("iVBORw0KGgo", 200)
+	payload := map[string]interface{}{
+		"model": "claude-sonnet",
+		"messages": []interface{}{
+			map[string]interface{}{
+				"role": "user",
+				"content": []interface{}{
+					map[string]interface{}{"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo"},
+					map[string]interface{}{"inlineData": map[string]interface{}{"mimeType": "image/jpeg", "data": "/9j/4AAQ"}},
+					map[string]interface{}{"image_url": map[string]interface{}{"url": "data:image/png;base64,iVBORw0KGgo"}},
+					map[string]interface{}{"type": "text", "text": "Animate this photo"},
+				},
+			},
+			map[string]interface{}{"role": "tool", "content": longBase64},
+		},
+		"headers":     map[string]interface{}{"Authorization": "Bearer sk-secret", "x-api-key": "sk-ant-secret"},
+		"usage":       map[string]interface{}{"input_tokens": 1200, "output_tokens": 80},
+		"stop_reason": "tool_use",
+	}
+
+	sanitized, err := SanitizeDebugPayload(payload)
+	if err != nil {
+		t.Fatalf("SanitizeDebugPayload failed: %v", err)
+	}
+	data, err := json.Marshal(sanitized)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	dump := string(data)
+
+	for _, leaked := range []string{"sk-secret", "sk-ant-secret", "iVBORw0KGgo", "/9j/4AAQ"} {
+		if strings.Contains(dump, leaked) {
+			t.Errorf("Expected %q to be stripped, got %s", leaked, dump)
+		}
+	}
+	for _, kept := range []string{"Animate this photo", "data:image/png;base64,", `"stop_reason":"tool_use"`, `"input_tokens":1200`, `"media_type":"image/png"`} {
+		if !strings.Contains(dump, kept) {
+			t.Errorf("Expected %q to be kept, got %s", kept, dump)
+		}
+	}
+}
+
+func TestDebugDumperFiles(t *testing.T) {
+	var nilDumper *DebugDumper
+	if err := nilDumper.Dump(1, "request", "response", nil); err != nil {
+		t.Errorf("Expected a nil dumper to do nothing, got %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "debug")
+	dumper, err := NewDebugDumper(dir, "Claude")
+	if err != nil {
+		t.Fatalf("NewDebugDumper failed: %v", err)
+	}
+	if err := dumper.Dump(1, map[string]string{"model": "m"}, map[string]string{"stop_reason": "tool_use"}, nil); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if err := dumper.Dump(2, map[string]string{"model": "m"}, nil, errors.New("overloaded")); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{
+		"001-round01-request.json", "001-round01-response.json",
+		"002-round02-request.json", "002-round02-response.json",
+	}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected files %v, got %v", expected, names)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "002-round02-response.json"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(data), "overloaded") || !strings.Contains(string(data), `"provider": "Claude"`) {
+		t.Errorf("Expected the call error and provider in the response dump, got %s", data)
+	}
+}
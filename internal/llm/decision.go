@@ -1,5 +1,7 @@
 package llm
 
+import "github.com/zhe.chen/agent-funpic-act/pkg/types"
+
 // PipelineDecision represents LLM's decision on how to execute the pipeline
 type PipelineDecision struct {
 	// Stage execution decisions
@@ -19,6 +21,9 @@ type PipelineDecision struct {
 	MusicMood        string   `json:"music_mood"`        // Suggested music mood (happy, calm, energetic, etc.)
 	MusicGenres      []string `json:"music_genres"`      // Suggested music genres
 	MusicCount       int      `json:"music_count"`       // Number of music tracks to search
+
+	// Motion sequence for render_motion (e.g. nod, zoom, shake); empty renders a single head shake
+	AnimationPlan []types.AnimationSegment `json:"animation_plan,omitempty"`
 }
 
 // LLMAnalysis stores the complete LLM analysis result for the pipeline
@@ -33,11 +38,13 @@ type LLMAnalysis struct {
 	ConfidenceScores map[string]float64 `json:"confidence_scores,omitempty"`
 
 	// Model information
-	Model      string `json:"model"`       // Claude model used (e.g., "claude-3-5-sonnet-20241022")
+	Model      string `json:"model"`       // Model used (e.g., "claude-3-5-sonnet-20241022")
 	TokensUsed int    `json:"tokens_used"` // Total tokens consumed
 }
 
-// GetDefaultDecision returns default pipeline decision when LLM is unavailable
+// GetDefaultDecision returns the pipeline decision lightweight mode runs with, and the
+// fallback when no LLM is configured. Full AI mode makes its own through a provider
+// Conversation instead.
 func GetDefaultDecision() *PipelineDecision {
 	return &PipelineDecision{
 		NeedSegment:      true,
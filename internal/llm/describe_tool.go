@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DescribeToolName is the synthetic tool the model calls for a tool's parameter schema
+// when schemas are advertised lazily. It is handled by ToolAdapter directly and never
+// routed to an MCP server.
+const DescribeToolName = "agent__describe_tool"
+
+// MaxToolSummaryLength bounds the one-line description of a tool advertised without
+// its schema
+const MaxToolSummaryLength = 120
+
+// SetLazySchemas advertises MCP tools by name and a one-line description only, without
+// their parameter schemas. The model fetches a tool's schema with DescribeToolName when
+// it needs it, which keeps every request small when servers offer many large tools.
+// Must be called before discovery.
+func (a *ToolAdapter) SetLazySchemas(enabled bool) {
+	a.lazySchemas = enabled
+}
+
+// describeToolTool returns the unified definition of the synthetic describe tool
+func describeToolTool() UnifiedTool {
+	return UnifiedTool{
+		Name:        DescribeToolName,
+		Description: "[agent] Get the full description and parameter schema of a tool. Call this before the first call to any tool whose parameters you don't know.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "Tool name as listed, e.g. \"imagesorcery__fill\"",
+				},
+			},
+			"required": []interface{}{"name"},
+		},
+	}
+}
+
+// lazyTool returns tool as advertised without its schema: the tool accepts any
+// arguments and its description is shortened to one line
+func lazyTool(tool UnifiedTool) UnifiedTool {
+	return UnifiedTool{
+		Name:        tool.Name,
+		Description: toolSummary(tool.Description),
+		Parameters:  map[string]interface{}{},
+	}
+}
+
+// toolSummary returns the first line of a tool description, at most MaxToolSummaryLength
+// characters long
+func toolSummary(description string) string {
+	summary, _, _ := strings.Cut(strings.TrimSpace(description), "\n")
+	summary = strings.TrimSpace(summary)
+	if runes := []rune(summary); len(runes) > MaxToolSummaryLength {
+		summary = strings.TrimSpace(string(runes[:MaxToolSummaryLength-3])) + "..."
+	}
+	return summary
+}
+
+// handleDescribeTool returns the full definition of an advertised tool as JSON
+func (a *ToolAdapter) handleDescribeTool(arguments map[string]interface{}) (string, error) {
+	name, _ := arguments["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+
+	a.mu.Lock()
+	tool, ok := a.describedTools[name]
+	a.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q: use a tool name from the tool list", name)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name":        tool.Name,
+		"description": tool.Description,
+		"parameters":  tool.Parameters,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	log.Printf("[Tool Adapter] Described %s (%d bytes)", name, len(data))
+	return string(data), nil
+}
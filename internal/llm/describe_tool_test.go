@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// schemaMCPClient offers one tool with a long description and schema, recording calls
+type schemaMCPClient struct {
+	replayMCPClient
+	calls []string
+}
+
+var fillSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"input_path": map[string]interface{}{"type": "string"},
+		"areas":      map[string]interface{}{"type": "array"},
+	},
+	"required": []interface{}{"input_path", "areas"},
+}
+
+func (c *schemaMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	return []types.Tool{{
+		Name:        "fill",
+		Description: "Fill areas of an image with a color or make them transparent.\n\nLong usage notes follow.",
+		InputSchema: fillSchema,
+	}}, nil
+}
+
+func (c *schemaMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	c.calls = append(c.calls, name)
+	return textResult("filled"), nil
+}
+
+// TestLazySchemas verifies tools are advertised without schemas and described locally,
+// without a call to any MCP server
+func TestLazySchemas(t *testing.T) {
+	server := &schemaMCPClient{}
+	adapter := NewToolAdapter(map[string]client.MCPClient{"imagesorcery": server})
+	adapter.SetLazySchemas(true)
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	advertised := make(map[string]UnifiedTool)
+	for _, tool := range tools {
+		advertised[tool.Name] = tool
+	}
+	fill, ok := advertised["imagesorcery__fill"]
+	if !ok || len(fill.Parameters) != 0 || fill.Description != "[imagesorcery] Fill areas of an image with a color or make them transparent." {
+		t.Errorf("Expected fill advertised with one line and no schema, got %+v", fill)
+	}
+	if _, ok := advertised[DescribeToolName]; !ok {
+		t.Fatalf("Expected %s to be advertised, got %v", DescribeToolName, tools)
+	}
+
+	description := adapter.GetToolDescription()
+	if !strings.Contains(description, "fill: Fill areas of an image") || !strings.Contains(description, "describe_tool") {
+		t.Errorf("Expected the prompt to list summaries and the describe tool, got:\n%s", description)
+	}
+
+	result, err := adapter.ExecuteToolCall(context.Background(), DescribeToolName, map[string]interface{}{"name": "imagesorcery__fill"})
+	if err != nil {
+		t.Fatalf("%s failed: %v", DescribeToolName, err)
+	}
+	var described struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	}
+	if err := json.Unmarshal([]byte(result), &described); err != nil {
+		t.Fatalf("Malformed description %q: %v", result, err)
+	}
+	if described.Name != "imagesorcery__fill" || !strings.Contains(described.Description, "Long usage notes") {
+		t.Errorf("Expected the full description, got %+v", described)
+	}
+	if !reflect.DeepEqual(described.Parameters["required"], fillSchema["required"]) {
+		t.Errorf("Expected the full schema, got %v", described.Parameters)
+	}
+
+	if _, err := adapter.ExecuteToolCall(context.Background(), DescribeToolName, map[string]interface{}{"name": "imagesorcery__crop"}); err == nil {
+		t.Error("Expected an unknown tool to be rejected")
+	}
+	if len(server.calls) != 0 {
+		t.Errorf("Expected %s handled locally, server got %v", DescribeToolName, server.calls)
+	}
+
+	// Lazily advertised tools still route to their server
+	if result, err := adapter.ExecuteToolCall(context.Background(), "imagesorcery__fill", map[string]interface{}{"input_path": "a.png"}); err != nil || result != "filled" {
+		t.Errorf("Expected fill routed to its server, got %q (err: %v)", result, err)
+	}
+}
+
+// TestLazySchemasDisabled verifies full schemas are advertised by default
+func TestLazySchemasDisabled(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{"imagesorcery": &schemaMCPClient{}})
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	for _, tool := range tools {
+		if tool.Name == DescribeToolName {
+			t.Errorf("Expected no %s without lazy schemas", DescribeToolName)
+		}
+		if tool.Name == "imagesorcery__fill" && !reflect.DeepEqual(tool.Parameters, fillSchema) {
+			t.Errorf("Expected the full fill schema, got %v", tool.Parameters)
+		}
+	}
+}
+
+func TestToolSummary(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+	tests := []struct {
+		description string
+		expected    string
+	}{
+		{"Detect objects.", "Detect objects."},
+		{"  First line\nSecond line", "First line"},
+		{long, strings.TrimSpace(long[:MaxToolSummaryLength-3]) + "..."},
+	}
+	for _, tt := range tests {
+		if summary := toolSummary(tt.description); summary != tt.expected {
+			t.Errorf("toolSummary(%q) = %q, expected %q", tt.description, summary, tt.expected)
+		}
+		if len([]rune(toolSummary(tt.description))) > MaxToolSummaryLength {
+			t.Errorf("toolSummary(%q) exceeds %d characters", tt.description, MaxToolSummaryLength)
+		}
+	}
+}
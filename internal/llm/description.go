@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxImageDescriptionLength is the longest image description kept, in characters
+const MaxImageDescriptionLength = 200
+
+// SanitizeDescription collapses whitespace (including newlines) to single spaces, drops
+// control characters and truncates to maxLength characters so the description is safe
+// for logs and container metadata. maxLength <= 0 uses MaxImageDescriptionLength.
+func SanitizeDescription(description string, maxLength int) string {
+	if maxLength <= 0 {
+		maxLength = MaxImageDescriptionLength
+	}
+
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, description)
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+
+	if utf8.RuneCountInString(cleaned) <= maxLength {
+		return cleaned
+	}
+	runes := []rune(cleaned)
+	return strings.TrimSpace(string(runes[:maxLength-1])) + "…"
+}
@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeDescription(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxLength int
+		expected  string
+	}{
+		{name: "unchanged", input: "woman in red jacket laughing outdoors", expected: "woman in red jacket laughing outdoors"},
+		{name: "newlines collapsed", input: "  dog\r\non a\n\nbeach  ", expected: "dog on a beach"},
+		{name: "control characters dropped", input: "cat\x00 on\x1b a sofa", expected: "cat on a sofa"},
+		{name: "truncated", input: "one two three four", maxLength: 9, expected: "one two…"},
+		{name: "truncated multibyte", input: "日本の桜の木の下", maxLength: 4, expected: "日本の…"},
+		{name: "empty", input: " \n ", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeDescription(tt.input, tt.maxLength)
+			if got != tt.expected {
+				t.Errorf("SanitizeDescription(%q, %d) = %q, expected %q", tt.input, tt.maxLength, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSanitizeDescriptionDefaultLength(t *testing.T) {
+	got := SanitizeDescription(strings.Repeat("a ", MaxImageDescriptionLength), 0)
+	if n := utf8.RuneCountInString(got); n > MaxImageDescriptionLength {
+		t.Errorf("Expected at most %d characters, got %d", MaxImageDescriptionLength, n)
+	}
+}
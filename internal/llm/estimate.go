@@ -0,0 +1,348 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Round assumptions used when no historical traces are available. The standard
+// workflow is find, fill, animate, search, compose and report, one call per round.
+const (
+	DefaultEstimateRoundsLow  = 6
+	DefaultEstimateRoundsHigh = 12
+)
+
+// Per-round growth assumptions: each round adds the model's reply and the tool
+// results to the context that is re-sent on every following round
+var (
+	estimateOutputTokens = [2]int{150, 400}  // low, high output tokens per round
+	estimateResultTokens = [2]int{300, 1200} // low, high tool result tokens per round
+)
+
+// TokenEstimator approximates a provider's token counts without calling its API
+type TokenEstimator interface {
+	TextTokens(text string) int
+	ImageTokens(width, height int) int
+}
+
+// EstimatorFor returns the token estimator for a provider name. OpenRouter models
+// are estimated with the tokenizer of the upstream provider in the model name.
+func EstimatorFor(provider, model string) TokenEstimator {
+	switch provider {
+	case "anthropic", "claude":
+		return claudeEstimator{}
+	case "google", "gemini":
+		return geminiEstimator{}
+	case "openrouter":
+		upstream, _, _ := strings.Cut(model, "/")
+		return EstimatorFor(upstream, "")
+	default:
+		return openAIEstimator{}
+	}
+}
+
+// claudeEstimator follows Anthropic's published image sizing: the long edge is
+// capped at 1568px and about 1.15 megapixels, then one token per 750 pixels
+type claudeEstimator struct{}
+
+func (claudeEstimator) TextTokens(text string) int {
+	return approxTokens(text, 3.5)
+}
+
+func (claudeEstimator) ImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	w, h := scaleToFit(float64(width), float64(height), 1568)
+	if pixels := w * h; pixels > 1_150_000 {
+		scale := math.Sqrt(1_150_000 / pixels)
+		w, h = w*scale, h*scale
+	}
+	return int(math.Ceil(math.Round(w) * math.Round(h) / 750))
+}
+
+// geminiEstimator charges 258 tokens for small images and 258 per 768px tile otherwise
+type geminiEstimator struct{}
+
+func (geminiEstimator) TextTokens(text string) int {
+	return approxTokens(text, 4)
+}
+
+func (geminiEstimator) ImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	if width <= 384 && height <= 384 {
+		return 258
+	}
+	tiles := ceilDiv(width, 768) * ceilDiv(height, 768)
+	return 258 * tiles
+}
+
+// openAIEstimator uses the high-detail tile formula: fit in 2048x2048, scale the
+// short side to 768, then 85 base tokens plus 170 per 512px tile
+type openAIEstimator struct{}
+
+func (openAIEstimator) TextTokens(text string) int {
+	return approxTokens(text, 4)
+}
+
+func (openAIEstimator) ImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	w, h := scaleToFit(float64(width), float64(height), 2048)
+	if short := math.Min(w, h); short > 768 {
+		scale := 768 / short
+		w, h = w*scale, h*scale
+	}
+	tiles := ceilDiv(int(math.Round(w)), 512) * ceilDiv(int(math.Round(h)), 512)
+	return 85 + 170*tiles
+}
+
+// approxTokens counts word runs as one token per charsPerToken characters and
+// every other non-space character as a token of its own, which tracks BPE
+// tokenizers closely enough for prose and JSON schemas
+func approxTokens(text string, charsPerToken float64) int {
+	tokens := 0
+	run := 0
+	flush := func() {
+		if run > 0 {
+			tokens += int(math.Ceil(float64(run) / charsPerToken))
+			run = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			run++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// scaleToFit scales w and h down so the longest side is at most maxSide
+func scaleToFit(w, h, maxSide float64) (float64, float64) {
+	if longest := math.Max(w, h); longest > maxSide {
+		scale := maxSide / longest
+		return w * scale, h * scale
+	}
+	return w, h
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// ModelPricing is the price in USD per million tokens
+type ModelPricing struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// modelPricing maps model name prefixes to list prices; the longest prefix wins
+var modelPricing = map[string]ModelPricing{
+	"claude-3-5-sonnet": {3, 15},
+	"claude-3-7-sonnet": {3, 15},
+	"claude-sonnet":     {3, 15},
+	"claude-3-5-haiku":  {0.8, 4},
+	"claude-3-haiku":    {0.25, 1.25},
+	"claude-3-opus":     {15, 75},
+	"claude-opus":       {15, 75},
+	"gemini-2.0-flash":  {0.10, 0.40},
+	"gemini-1.5-flash":  {0.075, 0.30},
+	"gemini-1.5-pro":    {1.25, 5},
+	"gemini-2.5-pro":    {1.25, 10},
+	"gpt-4o":            {2.5, 10},
+	"gpt-4o-mini":       {0.15, 0.60},
+	"gpt-4-turbo":       {10, 30},
+}
+
+// defaultPricing is used when the model is unset or unknown
+var defaultPricing = map[string]ModelPricing{
+	"anthropic": {3, 15},
+	"google":    {0.10, 0.40},
+	"openai":    {2.5, 10},
+}
+
+// PricingFor returns the pricing for a model, falling back to the provider default.
+// OpenRouter model names ("anthropic/claude-3.5-sonnet") are matched on the part
+// after the slash with dots normalized to dashes.
+func PricingFor(provider, model string) ModelPricing {
+	if provider == "openrouter" {
+		upstream, name, _ := strings.Cut(model, "/")
+		return PricingFor(upstream, strings.ReplaceAll(name, ".", "-"))
+	}
+
+	best := ""
+	for prefix := range modelPricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return modelPricing[best]
+	}
+
+	switch provider {
+	case "anthropic", "claude":
+		return defaultPricing["anthropic"]
+	case "google", "gemini":
+		return defaultPricing["google"]
+	default:
+		return defaultPricing["openai"]
+	}
+}
+
+// CostEstimateInput describes a planned full AI run
+type CostEstimateInput struct {
+	Provider     string
+	Model        string
+	ImageWidth   int
+	ImageHeight  int
+	SystemPrompt string
+	UserPrompt   string
+	Tools        []UnifiedTool
+	MaxRounds    int   // Caps the assumed rounds (0 = no cap)
+	Rounds       []int // Rounds used by past runs; empty uses the defaults
+}
+
+// CostEstimate is a rough bill for a full AI run
+type CostEstimate struct {
+	Pricing      ModelPricing
+	ImageTokens  int
+	PromptTokens int // System and user prompt
+	ToolTokens   int // Tool schemas
+	RoundsLow    int
+	RoundsHigh   int
+	TokensLow    int
+	TokensHigh   int
+	LowUSD       float64
+	HighUSD      float64
+}
+
+// BaseTokens returns the tokens sent with every request before any history
+func (e CostEstimate) BaseTokens() int {
+	return e.ImageTokens + e.PromptTokens + e.ToolTokens
+}
+
+// EstimateCost computes a low/high cost range for a full AI run. Every round
+// re-sends the base context plus the history accumulated in earlier rounds.
+func EstimateCost(input CostEstimateInput) (CostEstimate, error) {
+	estimator := EstimatorFor(input.Provider, input.Model)
+
+	toolData, err := json.Marshal(toolSchemas(input.Tools))
+	if err != nil {
+		return CostEstimate{}, fmt.Errorf("failed to marshal tool schemas: %w", err)
+	}
+
+	estimate := CostEstimate{
+		Pricing:      PricingFor(input.Provider, input.Model),
+		ImageTokens:  estimator.ImageTokens(input.ImageWidth, input.ImageHeight),
+		PromptTokens: estimator.TextTokens(input.SystemPrompt) + estimator.TextTokens(input.UserPrompt),
+		ToolTokens:   estimator.TextTokens(string(toolData)),
+	}
+	estimate.RoundsLow, estimate.RoundsHigh = roundsRange(input.Rounds, input.MaxRounds)
+
+	var low, high float64
+	estimate.TokensLow, low = conversationCost(estimate.BaseTokens(), estimate.RoundsLow, 0, estimate.Pricing)
+	estimate.TokensHigh, high = conversationCost(estimate.BaseTokens(), estimate.RoundsHigh, 1, estimate.Pricing)
+	estimate.LowUSD, estimate.HighUSD = low, high
+	return estimate, nil
+}
+
+// conversationCost returns total tokens and cost for rounds using the low (0) or
+// high (1) per-round growth assumptions
+func conversationCost(baseTokens, rounds, bound int, pricing ModelPricing) (int, float64) {
+	output := estimateOutputTokens[bound]
+	growth := output + estimateResultTokens[bound]
+
+	inputTokens := rounds*baseTokens + growth*rounds*(rounds-1)/2
+	outputTokens := rounds * output
+	cost := (float64(inputTokens)*pricing.InputPerMTok + float64(outputTokens)*pricing.OutputPerMTok) / 1e6
+	return inputTokens + outputTokens, cost
+}
+
+// roundsRange returns the smallest and largest historical round counts, or the
+// defaults when there is no history, capped at maxRounds
+func roundsRange(history []int, maxRounds int) (int, int) {
+	low, high := DefaultEstimateRoundsLow, DefaultEstimateRoundsHigh
+	var rounds []int
+	for _, r := range history {
+		if r > 0 {
+			rounds = append(rounds, r)
+		}
+	}
+	if len(rounds) > 0 {
+		sort.Ints(rounds)
+		low, high = rounds[0], rounds[len(rounds)-1]
+	}
+	if maxRounds > 0 {
+		low = min(low, maxRounds)
+		high = min(high, maxRounds)
+	}
+	return low, high
+}
+
+// toolSchemas returns the tool definitions roughly as providers send them
+func toolSchemas(tools []UnifiedTool) []map[string]interface{} {
+	schemas := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		schemas = append(schemas, map[string]interface{}{
+			"name":         tool.Name,
+			"description":  tool.Description,
+			"input_schema": tool.Parameters,
+		})
+	}
+	return schemas
+}
+
+// HistoricalRounds reads the rounds used by past runs from trace files matching pattern.
+// Unreadable traces are skipped.
+func HistoricalRounds(pattern string) ([]int, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace pattern: %w", err)
+	}
+
+	var rounds []int
+	for _, path := range paths {
+		trace, err := LoadTrace(path)
+		if err != nil || trace.Metrics.Rounds <= 0 {
+			continue
+		}
+		rounds = append(rounds, trace.Metrics.Rounds)
+	}
+	return rounds, nil
+}
+
+// ImageSize decodes only the image header to get its dimensions
+func ImageSize(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode image header: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImageTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		estimator     TokenEstimator
+		width, height int
+		want          int
+	}{
+		{"claude small", claudeEstimator{}, 200, 200, 54},
+		{"claude 1000x1000", claudeEstimator{}, 1000, 1000, 1334},
+		{"claude capped at 1.15MP", claudeEstimator{}, 4000, 4000, 1533},
+		{"gemini small", geminiEstimator{}, 384, 384, 258},
+		{"gemini tiled", geminiEstimator{}, 1024, 1024, 1032},
+		{"openai single tile", openAIEstimator{}, 512, 512, 255},
+		{"openai 1024 square", openAIEstimator{}, 1024, 1024, 765},
+		{"openai 2048x4096", openAIEstimator{}, 2048, 4096, 1105},
+		{"unknown size", openAIEstimator{}, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.estimator.ImageTokens(tt.width, tt.height); got != tt.want {
+				t.Errorf("ImageTokens(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApproxTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 4},
+		{`{"a": 1}`, 7},
+		{strings.Repeat("abcd ", 100), 100},
+	}
+
+	for _, tt := range tests {
+		if got := approxTokens(tt.text, 4); got != tt.want {
+			t.Errorf("approxTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPricingFor(t *testing.T) {
+	tests := []struct {
+		provider, model string
+		want            ModelPricing
+	}{
+		{"anthropic", "claude-3-5-sonnet-20241022", ModelPricing{3, 15}},
+		{"openai", "gpt-4o-mini-2024-07-18", ModelPricing{0.15, 0.60}},
+		{"openai", "gpt-4o", ModelPricing{2.5, 10}},
+		{"google", "", ModelPricing{0.10, 0.40}},
+		{"openrouter", "anthropic/claude-3.5-sonnet", ModelPricing{3, 15}},
+		{"openrouter", "openai/unknown-model", ModelPricing{2.5, 10}},
+	}
+
+	for _, tt := range tests {
+		if got := PricingFor(tt.provider, tt.model); got != tt.want {
+			t.Errorf("PricingFor(%q, %q) = %+v, want %+v", tt.provider, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	estimate, err := EstimateCost(CostEstimateInput{
+		Provider:     "openai",
+		Model:        "gpt-4o",
+		ImageWidth:   512,
+		ImageHeight:  512,
+		SystemPrompt: strings.Repeat("abcd ", 1000),
+		Rounds:       []int{5, 3, 4},
+	})
+	if err != nil {
+		t.Fatalf("EstimateCost failed: %v", err)
+	}
+
+	if estimate.PromptTokens != 1000 || estimate.ImageTokens != 255 || estimate.ToolTokens != 2 {
+		t.Errorf("base tokens = prompt %d, image %d, tools %d; want 1000, 255, 2",
+			estimate.PromptTokens, estimate.ImageTokens, estimate.ToolTokens)
+	}
+	if estimate.RoundsLow != 3 || estimate.RoundsHigh != 5 {
+		t.Errorf("rounds = %d-%d, want 3-5", estimate.RoundsLow, estimate.RoundsHigh)
+	}
+	// Low: 3 rounds of 1257 base tokens plus 450 tokens of history growth per round
+	if math.Abs(estimate.LowUSD-0.0173025) > 1e-9 {
+		t.Errorf("LowUSD = %f, want 0.0173025", estimate.LowUSD)
+	}
+	// High: 5 rounds with 1600 tokens of history growth per round
+	if math.Abs(estimate.HighUSD-0.0757125) > 1e-9 {
+		t.Errorf("HighUSD = %f, want 0.0757125", estimate.HighUSD)
+	}
+}
+
+func TestEstimateCostCountsToolSchemas(t *testing.T) {
+	tools := []UnifiedTool{reportResultTool()}
+	without, err := EstimateCost(CostEstimateInput{Provider: "anthropic"})
+	if err != nil {
+		t.Fatalf("EstimateCost failed: %v", err)
+	}
+	with, err := EstimateCost(CostEstimateInput{Provider: "anthropic", Tools: tools})
+	if err != nil {
+		t.Fatalf("EstimateCost failed: %v", err)
+	}
+	if with.ToolTokens <= without.ToolTokens || with.HighUSD <= without.HighUSD {
+		t.Errorf("tool schemas not counted: %d tokens ($%f) vs %d tokens ($%f)",
+			with.ToolTokens, with.HighUSD, without.ToolTokens, without.HighUSD)
+	}
+}
+
+func TestRoundsRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		history   []int
+		maxRounds int
+		low, high int
+	}{
+		{"defaults", nil, 0, DefaultEstimateRoundsLow, DefaultEstimateRoundsHigh},
+		{"defaults capped", nil, 8, DefaultEstimateRoundsLow, 8},
+		{"history", []int{7, 0, 4, 9}, 20, 4, 9},
+		{"history capped", []int{7, 25}, 20, 7, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			low, high := roundsRange(tt.history, tt.maxRounds)
+			if low != tt.low || high != tt.high {
+				t.Errorf("roundsRange = %d-%d, want %d-%d", low, high, tt.low, tt.high)
+			}
+		})
+	}
+}
+
+func TestHistoricalRounds(t *testing.T) {
+	dir := t.TempDir()
+	for i, rounds := range []int{4, 7} {
+		trace := NewTraceRecorder("gemini", "/work/input.png", 5)
+		trace.Finish("/work/out.mp4", nil, FullAIConversationMetrics{Rounds: rounds})
+		if err := trace.Save(filepath.Join(dir, "trace"+string(rune('a'+i))+".json")); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	rounds, err := HistoricalRounds(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatalf("HistoricalRounds failed: %v", err)
+	}
+	if len(rounds) != 2 || rounds[0] != 4 || rounds[1] != 7 {
+		t.Errorf("rounds = %v, want [4 7]", rounds)
+	}
+}
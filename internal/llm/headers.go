@@ -0,0 +1,34 @@
+package llm
+
+import "net/http"
+
+// HeaderTransport adds fixed headers, such as a gateway's trace ID or billing tag, to
+// every request before passing it to Base
+type HeaderTransport struct {
+	Base    http.RoundTripper // http.DefaultTransport when nil
+	Headers map[string]string
+}
+
+// RoundTrip sends req with the transport's headers set
+func (t *HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, value := range t.Headers {
+		req.Header.Set(name, value)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// NewHeaderClient returns an HTTP client sending headers with every request, or nil
+// when there are none so the SDK keeps its default client
+func NewHeaderClient(headers map[string]string) *http.Client {
+	if len(headers) == 0 {
+		return nil
+	}
+	return &http.Client{Transport: &HeaderTransport{Headers: headers}}
+}
@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestNewHeaderClient verifies configured headers reach the server without changing
+// the caller's request
+func TestNewHeaderClient(t *testing.T) {
+	if NewHeaderClient(nil) != nil {
+		t.Error("Expected no client without headers")
+	}
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	client := NewHeaderClient(map[string]string{"X-Trace-Id": "trace-1", "X-Billing-Tag": "team-a"})
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("X-Billing-Tag", "caller")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if received.Get("X-Trace-Id") != "trace-1" || received.Get("X-Billing-Tag") != "team-a" {
+		t.Errorf("Expected the configured headers, got %v", received)
+	}
+	if req.Header.Get("X-Billing-Tag") != "caller" || req.Header.Get("X-Trace-Id") != "" {
+		t.Errorf("Expected the caller's request unchanged, got %v", req.Header)
+	}
+}
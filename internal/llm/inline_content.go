@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// inlineContentExtensions maps the MIME types of inline tool content to file extensions
+var inlineContentExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+	"audio/mpeg": ".mp3",
+	"audio/wav":  ".wav",
+	"audio/ogg":  ".ogg",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// unsafeFileNameChars are replaced in tool names used as file name prefixes
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// saveInlineContent decodes a content block carrying base64 data, e.g. an image a tool
+// generated without writing a file, into the scratch directory. It returns the line
+// added to the result text so the model can pass the file to later tools.
+func (a *ToolAdapter) saveInlineContent(toolName string, block types.ContentBlock) (string, error) {
+	if len(a.pathRoots) == 0 {
+		return "", fmt.Errorf("no scratch directory to save %s content to", block.Type)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(block.Data))
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 %s content: %w", block.Type, err)
+	}
+
+	prefix := unsafeFileNameChars.ReplaceAllString(toolName, "_") + "_*" + inlineContentExtension(block.MimeType, data)
+	file, err := os.CreateTemp(a.pathRoots[0], prefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to save %s content: %w", block.Type, err)
+	}
+	_, writeErr := file.Write(data)
+	if closeErr := file.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to save %s content: %w", block.Type, writeErr)
+	}
+
+	log.Printf("[Tool Adapter] Saved %d bytes of %s content from %s to %s", len(data), block.Type, toolName, file.Name())
+	return fmt.Sprintf("Saved %s content to %s", block.Type, file.Name()), nil
+}
+
+// inlineContentExtension returns the file extension of inline content: from its MIME
+// type when known, else from the data itself
+func inlineContentExtension(mimeType string, data []byte) string {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	if ext, ok := inlineContentExtensions[mimeType]; ok {
+		return ext
+	}
+	sniffed := strings.Split(http.DetectContentType(data), ";")[0]
+	if ext, ok := inlineContentExtensions[sniffed]; ok {
+		return ext
+	}
+	return ".bin"
+}
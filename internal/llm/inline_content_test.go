@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestExecuteToolCallSavesInlineImage verifies a base64 image in a tool result is
+// written to the scratch directory and its path returned to the model
+func TestExecuteToolCallSavesInlineImage(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	data := base64.StdEncoding.EncodeToString(encoded.Bytes())
+
+	tests := []struct {
+		name     string
+		mimeType string
+	}{
+		{"declared type", "image/png"},
+		{"sniffed type", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scratch := t.TempDir()
+			adapter := NewToolAdapter(map[string]client.MCPClient{
+				"imagegen": &replayMCPClient{results: map[string]*types.ToolCallResult{
+					"generate": {Content: []types.ContentBlock{
+						{Type: "text", Text: "Generated 1 image"},
+						{Type: "image", Data: data, MimeType: tt.mimeType},
+					}},
+				}},
+			})
+			adapter.SetPathRoots(scratch)
+
+			result, err := adapter.ExecuteToolCall(context.Background(), "imagegen__generate", nil)
+			if err != nil {
+				t.Fatalf("ExecuteToolCall failed: %v", err)
+			}
+			lines := strings.Split(result, "\n")
+			if len(lines) != 2 || lines[0] != "Generated 1 image" || !strings.HasPrefix(lines[1], "Saved image content to ") {
+				t.Fatalf("Expected the text and the saved path, got %q", result)
+			}
+
+			path := strings.TrimPrefix(lines[1], "Saved image content to ")
+			if filepath.Dir(path) != scratch || filepath.Ext(path) != ".png" {
+				t.Errorf("Expected a .png in %s, got %s", scratch, path)
+			}
+			saved, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(saved, encoded.Bytes()) {
+				t.Errorf("Expected the decoded image saved to %s (err: %v)", path, err)
+			}
+		})
+	}
+}
+
+// TestExecuteToolCallInvalidInlineData verifies content that can't be decoded is
+// skipped without failing the call
+func TestExecuteToolCallInvalidInlineData(t *testing.T) {
+	scratch := t.TempDir()
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"imagegen": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"generate": {Content: []types.ContentBlock{
+				{Type: "text", Text: "done"},
+				{Type: "image", Data: "not base64!", MimeType: "image/png"},
+			}},
+		}},
+	})
+	adapter.SetPathRoots(scratch)
+
+	result, err := adapter.ExecuteToolCall(context.Background(), "imagegen__generate", nil)
+	if err != nil || result != "done" {
+		t.Errorf("Expected only the text result, got %q (err: %v)", result, err)
+	}
+	if entries, _ := os.ReadDir(scratch); len(entries) != 0 {
+		t.Errorf("Expected nothing saved, got %d files", len(entries))
+	}
+}
@@ -0,0 +1,30 @@
+// Package llmtest provides fakes shared by the LLM provider tests
+package llmtest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// EchoMCPClient is an MCPClient with a single fill tool that echoes back its
+// output_path argument
+type EchoMCPClient struct{}
+
+func (e *EchoMCPClient) Connect(ctx context.Context) error    { return nil }
+func (e *EchoMCPClient) Initialize(ctx context.Context) error { return nil }
+func (e *EchoMCPClient) Close() error                         { return nil }
+func (e *EchoMCPClient) GetServerInfo() (string, string)      { return "echo", "1.0.0" }
+
+func (e *EchoMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	return []types.Tool{{Name: "fill"}}, nil
+}
+
+func (e *EchoMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	return &types.ToolCallResult{
+		Content: []types.ContentBlock{
+			{Type: "text", Text: fmt.Sprintf("%v", arguments["output_path"])},
+		},
+	}, nil
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SetArgumentNormalization enables or disables schema-based coercion of tool arguments
+func (a *ToolAdapter) SetArgumentNormalization(enabled bool) {
+	a.normalizeArgs = enabled
+}
+
+// normalizeArguments coerces argument values to the types declared in the tool's input schema.
+// Models often send numbers or booleans as strings ("0.3", "true"), which MCP servers reject.
+func (a *ToolAdapter) normalizeArguments(toolName string, arguments map[string]interface{}) map[string]interface{} {
+	if !a.normalizeArgs || arguments == nil {
+		return arguments
+	}
+
+	a.mu.Lock()
+	schema, ok := a.toolSchemas[toolName]
+	a.mu.Unlock()
+	if !ok {
+		return arguments
+	}
+
+	normalized, _ := normalizeValue(toolName, schema, arguments).(map[string]interface{})
+	if normalized == nil {
+		return arguments
+	}
+	return normalized
+}
+
+// normalizeValue coerces a single value to its schema type, recursing into objects and arrays
+func normalizeValue(path string, schema map[string]interface{}, value interface{}) interface{} {
+	schemaType, _ := schema["type"].(string)
+
+	switch schemaType {
+	case "object":
+		obj, ok := decodeJSONString(value).(map[string]interface{})
+		if !ok {
+			return value
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		result := make(map[string]interface{}, len(obj))
+		for key, val := range obj {
+			propSchema, ok := props[key].(map[string]interface{})
+			if !ok {
+				result[key] = val
+				continue
+			}
+			result[key] = normalizeValue(path+"."+key, propSchema, val)
+		}
+		return result
+
+	case "array":
+		arr, ok := decodeJSONString(value).([]interface{})
+		if !ok {
+			return value
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		result := make([]interface{}, len(arr))
+		for i, item := range arr {
+			if items == nil {
+				result[i] = item
+				continue
+			}
+			result[i] = normalizeValue(path+"["+strconv.Itoa(i)+"]", items, item)
+		}
+		return result
+
+	case "number":
+		if str, ok := value.(string); ok {
+			if num, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+				debugf("[Tool Adapter] Coerced %s: %q -> %v", path, str, num)
+				return num
+			}
+		}
+
+	case "integer":
+		num, ok := value.(float64)
+		if str, isStr := value.(string); isStr {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+			if err != nil {
+				return value
+			}
+			num, ok = parsed, true
+		}
+		if ok {
+			rounded := int64(math.Round(num))
+			if float64(rounded) != num || value != num {
+				debugf("[Tool Adapter] Coerced %s: %v -> %d", path, value, rounded)
+			}
+			return rounded
+		}
+
+	case "boolean":
+		if str, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				debugf("[Tool Adapter] Coerced %s: %q -> %v", path, str, b)
+				return b
+			}
+		}
+
+	case "string":
+		switch v := value.(type) {
+		case float64:
+			str := strconv.FormatFloat(v, 'f', -1, 64)
+			debugf("[Tool Adapter] Coerced %s: %v -> %q", path, v, str)
+			return str
+		case bool:
+			str := strconv.FormatBool(v)
+			debugf("[Tool Adapter] Coerced %s: %v -> %q", path, v, str)
+			return str
+		}
+	}
+
+	return value
+}
+
+// decodeJSONString decodes values that arrive as JSON-encoded strings (e.g. "[1, 2]")
+func decodeJSONString(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(str), &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
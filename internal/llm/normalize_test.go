@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestNormalizeArguments verifies argument values are coerced to their schema types
+func TestNormalizeArguments(t *testing.T) {
+	adapter := NewToolAdapter(nil)
+	adapter.toolSchemas["imagesorcery__detect"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"input_path":      map[string]interface{}{"type": "string"},
+			"confidence":      map[string]interface{}{"type": "number"},
+			"max_results":     map[string]interface{}{"type": "integer"},
+			"return_geometry": map[string]interface{}{"type": "boolean"},
+			"label":           map[string]interface{}{"type": "string"},
+			"areas": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"opacity": map[string]interface{}{"type": "number"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		value    interface{}
+		expected interface{}
+	}{
+		{"number from string", "confidence", "0.3", 0.3},
+		{"number untouched", "confidence", 0.25, 0.25},
+		{"integer from string", "max_results", "5", int64(5)},
+		{"integer rounded", "max_results", 2.7, int64(3)},
+		{"boolean from string", "return_geometry", "true", true},
+		{"invalid boolean untouched", "return_geometry", "maybe", "maybe"},
+		{"string from number", "label", 42.0, "42"},
+		{"unknown argument untouched", "extra", "0.3", "0.3"},
+		{
+			"nested array from JSON string",
+			"areas",
+			`[{"opacity": "0"}]`,
+			[]interface{}{map[string]interface{}{"opacity": 0.0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]interface{}{tt.key: tt.value}
+			normalized := adapter.normalizeArguments("imagesorcery__detect", args)
+
+			if !reflect.DeepEqual(normalized[tt.key], tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, normalized[tt.key])
+			}
+		})
+	}
+}
+
+// TestNormalizeArgumentsDisabled verifies arguments pass through when normalization is off
+func TestNormalizeArgumentsDisabled(t *testing.T) {
+	adapter := NewToolAdapter(nil)
+	adapter.SetArgumentNormalization(false)
+	adapter.toolSchemas["imagesorcery__detect"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"confidence": map[string]interface{}{"type": "number"},
+		},
+	}
+
+	normalized := adapter.normalizeArguments("imagesorcery__detect", map[string]interface{}{"confidence": "0.3"})
+	if normalized["confidence"] != "0.3" {
+		t.Errorf("Expected argument unchanged, got %#v", normalized["confidence"])
+	}
+}
@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"encoding/json"
+	"log"
+	"path"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/jsonpath"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Result fields that extraction rules can populate
+const (
+	ResultFieldSegmentedImage = "segmented_image_path"
+	ResultFieldMotionVideo    = "motion_video_path"
+	ResultFieldFinalOutput    = "final_output_path"
+)
+
+// ObservedToolCall describes a completed tool call for observers
+type ObservedToolCall struct {
+	ToolName  string                 // Prefixed tool name (e.g. "imagesorcery__fill")
+	Server    string                 // MCP server the call was routed to
+	Tool      string                 // Tool name on that server
+	Arguments map[string]interface{} // Arguments as sent to the tool
+	Result    string                 // Combined text result
+	Err       error                  // Non-nil if the call failed
+	Started   time.Time              // When the call was sent to the server
+	Duration  time.Duration          // Until the server answered
+
+	PathRewrites []PathRewrite // Path arguments changed from what the model sent
+
+	ServerName    string // Name the server reported at initialization
+	ServerVersion string // Version the server reported at initialization
+}
+
+// Provenance returns the server and tool that made the call, for recording with its artifacts
+func (c ObservedToolCall) Provenance() *types.ToolProvenance {
+	return &types.ToolProvenance{
+		Server:        c.Server,
+		ServerName:    c.ServerName,
+		ServerVersion: c.ServerVersion,
+		Tool:          c.Tool,
+	}
+}
+
+// ToolCallObserver is notified after every tool call routed through the adapter
+type ToolCallObserver func(call ObservedToolCall)
+
+// AddObserver registers an observer for tool calls
+func (a *ToolAdapter) AddObserver(observer ToolCallObserver) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.observers = append(a.observers, observer)
+}
+
+// notifyObservers passes a completed tool call to all observers
+func (a *ToolAdapter) notifyObservers(call ObservedToolCall) {
+	a.mu.Lock()
+	observers := a.observers
+	a.mu.Unlock()
+
+	for _, observer := range observers {
+		observer(call)
+	}
+}
+
+// DefaultResultExtractionRules returns the built-in rules for the standard workflow
+func DefaultResultExtractionRules() []types.ResultExtractionRule {
+	return []types.ResultExtractionRule{
+		{Tool: "*__fill", Field: ResultFieldSegmentedImage, Path: "result.output_path"},
+		{Tool: "*__fill", Field: ResultFieldSegmentedImage, Path: "args.output_path"},
+		{Tool: "*__generate_animation_from_image", Field: ResultFieldMotionVideo, Path: "result.output_video_path"},
+		{Tool: "*__generate_animation_from_image", Field: ResultFieldMotionVideo, Path: "args.output_video_path"},
+		{Tool: "*__add_audio_to_video", Field: ResultFieldFinalOutput, Path: "result.output_video_path"},
+		{Tool: "*__add_audio_to_video", Field: ResultFieldFinalOutput, Path: "args.output_video_path"},
+		{Tool: "*__add_audio_to_video", Field: ResultFieldFinalOutput, Path: "args.output_path"},
+	}
+}
+
+// ResultExtractor records result fields from successful tool calls using extraction rules
+type ResultExtractor struct {
+	rules    []types.ResultExtractionRule
+	onUpdate ResultUpdateFunc
+}
+
+// ResultUpdateFunc receives an extracted result field with the tool call it came from
+type ResultUpdateFunc func(field, value string, source *types.ToolProvenance)
+
+// NewResultExtractor creates an extractor; empty rules use DefaultResultExtractionRules.
+// onUpdate is called each time a field is extracted.
+func NewResultExtractor(rules []types.ResultExtractionRule, onUpdate ResultUpdateFunc) *ResultExtractor {
+	if len(rules) == 0 {
+		rules = DefaultResultExtractionRules()
+	}
+	return &ResultExtractor{
+		rules:    rules,
+		onUpdate: onUpdate,
+	}
+}
+
+// Observe applies the extraction rules to a tool call; it is a ToolCallObserver
+func (e *ResultExtractor) Observe(call ObservedToolCall) {
+	if call.Err != nil {
+		return
+	}
+
+	doc := map[string]interface{}{
+		"args":   argumentsDocument(call.Arguments),
+		"result": resultDocument(call.Result),
+	}
+
+	extracted := make(map[string]bool)
+	for _, rule := range e.rules {
+		if extracted[rule.Field] {
+			continue
+		}
+		if matched, err := path.Match(rule.Tool, canonicalToolName(call)); err != nil || !matched {
+			continue
+		}
+
+		value, ok := jsonpath.LookupString(doc, rule.Path)
+		if !ok {
+			continue
+		}
+
+		extracted[rule.Field] = true
+		log.Printf("[Tool Adapter] Recorded %s from %s: %s", rule.Field, call.ToolName, value)
+		if e.onUpdate != nil {
+			e.onUpdate(rule.Field, value, call.Provenance())
+		}
+	}
+}
+
+// canonicalToolName returns "server__tool" for a call regardless of the configured
+// separator, so extraction rules keep matching when the separator changes
+func canonicalToolName(call ObservedToolCall) string {
+	if call.Server == "" || call.Tool == "" {
+		return call.ToolName
+	}
+	return call.Server + DefaultToolNameSeparator + call.Tool
+}
+
+// argumentsDocument converts arguments to a generic JSON document for path lookups
+func argumentsDocument(arguments map[string]interface{}) interface{} {
+	doc := make(map[string]interface{}, len(arguments))
+	for k, v := range arguments {
+		doc[k] = v
+	}
+	return doc
+}
+
+// resultDocument parses a tool result as JSON, falling back to the raw text
+func resultDocument(result string) interface{} {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(result), &parsed); err == nil {
+		return parsed
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// replayMCPClient returns recorded results for tool calls by tool name
+type replayMCPClient struct {
+	results map[string]*types.ToolCallResult
+}
+
+func (r *replayMCPClient) Connect(ctx context.Context) error    { return nil }
+func (r *replayMCPClient) Initialize(ctx context.Context) error { return nil }
+func (r *replayMCPClient) Close() error                         { return nil }
+func (r *replayMCPClient) GetServerInfo() (string, string)      { return "replay", "1.0.0" }
+
+func (r *replayMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	var tools []types.Tool
+	for name := range r.results {
+		tools = append(tools, types.Tool{Name: name})
+	}
+	return tools, nil
+}
+
+func (r *replayMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	result, ok := r.results[name]
+	if !ok {
+		return nil, fmt.Errorf("no recorded result for %s", name)
+	}
+	if result.IsError {
+		return result, fmt.Errorf("tool execution failed: %s", result.Content[0].Text)
+	}
+	return result, nil
+}
+
+func textResult(text string) *types.ToolCallResult {
+	return &types.ToolCallResult{
+		Content: []types.ContentBlock{{Type: "text", Text: text}},
+	}
+}
+
+// TestResultExtractorReplay replays a recorded full AI tool sequence and checks the extracted fields
+func TestResultExtractorReplay(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"find": textResult(`{"found_objects": [{"polygon": [[1, 2], [3, 4]]}]}`),
+			"fill": textResult(`{"output_path": "/work/tmp/segmented_person.png"}`),
+		}},
+		"video": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"generate_animation_from_image": textResult("Animation created successfully"),
+			"add_audio_to_video": {
+				Content: []types.ContentBlock{{Type: "text", Text: "ffmpeg failed"}},
+				IsError: true,
+			},
+		}},
+	})
+
+	extracted := make(map[string]string)
+	sources := make(map[string]*types.ToolProvenance)
+	extractor := NewResultExtractor(nil, func(field, value string, source *types.ToolProvenance) {
+		extracted[field] = value
+		sources[field] = source
+	})
+	adapter.AddObserver(extractor.Observe)
+
+	sequence := []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"imagesorcery__find", map[string]interface{}{"input_path": "/in/photo.jpg", "description": "person"}},
+		{"imagesorcery__fill", map[string]interface{}{"input_path": "/in/photo.jpg", "output_path": "/ignored.png"}},
+		{"video__generate_animation_from_image", map[string]interface{}{
+			"image_path":        "/work/tmp/segmented_person.png",
+			"output_video_path": "/work/tmp/animation.mp4",
+		}},
+		{"video__add_audio_to_video", map[string]interface{}{"output_video_path": "/work/output/final.mp4"}},
+	}
+
+	for _, call := range sequence {
+		adapter.ExecuteToolCall(context.Background(), call.tool, call.args)
+	}
+
+	expected := map[string]string{
+		ResultFieldSegmentedImage: "/work/tmp/segmented_person.png", // result JSON wins over args
+		ResultFieldMotionVideo:    "/work/tmp/animation.mp4",        // plain-text result falls back to args
+	}
+	for field, want := range expected {
+		if extracted[field] != want {
+			t.Errorf("Expected %s=%q, got %q", field, want, extracted[field])
+		}
+	}
+	if _, ok := extracted[ResultFieldFinalOutput]; ok {
+		t.Errorf("Expected failed add_audio_to_video to be ignored, got %q", extracted[ResultFieldFinalOutput])
+	}
+
+	expectedSources := map[string]types.ToolProvenance{
+		ResultFieldSegmentedImage: {Server: "imagesorcery", ServerName: "replay", ServerVersion: "1.0.0", Tool: "fill"},
+		ResultFieldMotionVideo:    {Server: "video", ServerName: "replay", ServerVersion: "1.0.0", Tool: "generate_animation_from_image"},
+	}
+	for field, want := range expectedSources {
+		if got := sources[field]; got == nil || *got != want {
+			t.Errorf("Expected %s provenance %+v, got %+v", field, want, got)
+		}
+	}
+}
+
+// TestResultExtractorCustomRules verifies configured rules replace the defaults
+func TestResultExtractorCustomRules(t *testing.T) {
+	extracted := make(map[string]string)
+	extractor := NewResultExtractor([]types.ResultExtractionRule{
+		{Tool: "video__mux", Field: ResultFieldFinalOutput, Path: "result.files[1].path"},
+	}, func(field, value string, source *types.ToolProvenance) {
+		extracted[field] = value
+	})
+
+	extractor.Observe(ObservedToolCall{
+		ToolName: "video__mux",
+		Result:   `{"files": [{"path": "/tmp/a.mp4"}, {"path": "/out/final.mp4"}]}`,
+	})
+	extractor.Observe(ObservedToolCall{
+		ToolName:  "imagesorcery__fill",
+		Arguments: map[string]interface{}{"output_path": "/tmp/seg.png"},
+	})
+
+	if extracted[ResultFieldFinalOutput] != "/out/final.mp4" {
+		t.Errorf("Expected final output from custom rule, got %q", extracted[ResultFieldFinalOutput])
+	}
+	if _, ok := extracted[ResultFieldSegmentedImage]; ok {
+		t.Error("Expected default rules to be replaced by custom rules")
+	}
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// ErrPathOutsideRoots is returned for an output path argument that lies outside every
+// path root, unless any path is allowed
+var ErrPathOutsideRoots = errors.New("output path outside the scratch and output directories")
+
+// PathRewrite records a path argument the adapter changed before calling a tool
+type PathRewrite struct {
+	Argument string `json:"argument"`
+	From     string `json:"from"` // As sent by the model
+	To       string `json:"to"`   // As sent to the tool
+}
+
+// DefaultOutputPathRules returns the built-in rules for arguments naming files tools write
+func DefaultOutputPathRules() []types.PathArgumentRule {
+	return []types.PathArgumentRule{
+		{Tool: "*", Argument: "output*path"},
+	}
+}
+
+// SetPathRoots restricts file path arguments in tool calls to the given directories.
+// The first root is the scratch directory that relative paths resolve to.
+func (a *ToolAdapter) SetPathRoots(roots ...string) {
+	a.pathRoots = nil
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			log.Printf("[Tool Adapter] Warning: ignoring path root %s: %v", root, err)
+			continue
+		}
+		a.pathRoots = append(a.pathRoots, absRoot)
+	}
+}
+
+// SetOutputPathRules sets the tool arguments treated as files the tool writes; empty
+// rules use DefaultOutputPathRules
+func (a *ToolAdapter) SetOutputPathRules(rules []types.PathArgumentRule) {
+	if len(rules) == 0 {
+		rules = DefaultOutputPathRules()
+	}
+	a.outputPathRules = rules
+}
+
+// SetAllowAnyPath lets output path arguments name files outside the path roots instead
+// of rejecting the call
+func (a *ToolAdapter) SetAllowAnyPath(allow bool) {
+	a.allowAnyPath = allow
+}
+
+// sanitizePathArguments returns a copy of arguments with path values resolved to the path
+// roots, and the rewrites made. Relative paths resolve against the scratch directory.
+// Output paths that escape every root are rejected unless any path is allowed; input paths
+// outside the roots (e.g. the user's image) are left untouched. toolName is matched against
+// the output path rules as "server__tool".
+func (a *ToolAdapter) sanitizePathArguments(toolName string, arguments map[string]interface{}) (map[string]interface{}, []PathRewrite, error) {
+	if len(a.pathRoots) == 0 || arguments == nil {
+		return arguments, nil, nil
+	}
+
+	sanitized := make(map[string]interface{}, len(arguments))
+	var rewrites []PathRewrite
+	for key, value := range arguments {
+		sanitized[key] = value
+
+		path, ok := value.(string)
+		if !ok || path == "" {
+			continue
+		}
+		isOutput := a.isOutputArgument(toolName, key)
+		if !isOutput && !isPathArgument(key) {
+			continue
+		}
+
+		resolved, err := a.resolvePath(path, isOutput)
+		if err != nil {
+			log.Printf("[Tool Adapter] Rejected %s of %s: %v", key, toolName, err)
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if resolved != path {
+			log.Printf("[Tool Adapter] Rewrote %s: %s -> %s", key, path, resolved)
+			rewrites = append(rewrites, PathRewrite{Argument: key, From: path, To: resolved})
+		}
+		sanitized[key] = resolved
+	}
+
+	sort.Slice(rewrites, func(i, j int) bool { return rewrites[i].Argument < rewrites[j].Argument })
+	return sanitized, rewrites, nil
+}
+
+// resolvePath maps a single path argument onto the configured roots
+func (a *ToolAdapter) resolvePath(path string, isOutput bool) (string, error) {
+	scratch := a.pathRoots[0]
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(scratch, path)
+	}
+	path = filepath.Clean(path)
+
+	if !isOutput || a.allowAnyPath || a.withinRoots(path) {
+		return path, nil
+	}
+	return "", fmt.Errorf("%w: %s; write under %s or use a relative path", ErrPathOutsideRoots, path, strings.Join(a.pathRoots, " or "))
+}
+
+// withinRoots reports whether path lies inside one of the path roots
+func (a *ToolAdapter) withinRoots(path string) bool {
+	for _, root := range a.pathRoots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOutputArgument reports whether a tool argument names a file the tool writes,
+// according to the output path rules
+func (a *ToolAdapter) isOutputArgument(toolName, key string) bool {
+	rules := a.outputPathRules
+	if rules == nil {
+		rules = DefaultOutputPathRules()
+	}
+	for _, rule := range rules {
+		if matched, err := path.Match(rule.Tool, toolName); err != nil || !matched {
+			continue
+		}
+		if matched, err := path.Match(rule.Argument, key); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isPathArgument reports whether a tool argument name refers to a file path
+func isPathArgument(key string) bool {
+	return key == "path" || strings.HasSuffix(key, "_path")
+}
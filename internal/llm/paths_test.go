@@ -0,0 +1,172 @@
+// Unix paths: "/work" is not absolute on Windows
+//go:build !windows
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestSanitizePathArguments verifies tool path arguments are confined to the path roots
+func TestSanitizePathArguments(t *testing.T) {
+	adapter := NewToolAdapter(nil)
+	adapter.SetPathRoots("/work/tmp", "/work/output")
+
+	tests := []struct {
+		name     string
+		key      string
+		value    interface{}
+		expected interface{} // nil when the call is rejected
+	}{
+		{
+			name:     "relative output resolves to scratch",
+			key:      "output_path",
+			value:    "segmented.png",
+			expected: "/work/tmp/segmented.png",
+		},
+		{
+			name:     "absolute output inside output root is kept",
+			key:      "output_video_path",
+			value:    "/work/output/final.mp4",
+			expected: "/work/output/final.mp4",
+		},
+		{
+			name:  "absolute output outside roots is rejected",
+			key:   "output_path",
+			value: "/etc/final.mp4",
+		},
+		{
+			name:  "relative output escaping scratch is rejected",
+			key:   "output_path",
+			value: "../../escape.png",
+		},
+		{
+			name:     "absolute input outside roots is kept",
+			key:      "input_path",
+			value:    "/home/user/photo.jpg",
+			expected: "/home/user/photo.jpg",
+		},
+		{
+			name:     "relative input resolves to scratch",
+			key:      "image_path",
+			value:    "segmented.png",
+			expected: "/work/tmp/segmented.png",
+		},
+		{
+			name:     "non-path argument is untouched",
+			key:      "description",
+			value:    "person.png",
+			expected: "person.png",
+		},
+		{
+			name:     "non-string path argument is untouched",
+			key:      "output_path",
+			value:    42,
+			expected: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]interface{}{tt.key: tt.value}
+			sanitized, _, err := adapter.sanitizePathArguments("imagesorcery__fill", args)
+			if tt.expected == nil {
+				if !errors.Is(err, ErrPathOutsideRoots) {
+					t.Errorf("Expected ErrPathOutsideRoots, got %v (%v)", err, sanitized)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sanitizePathArguments failed: %v", err)
+			}
+			if sanitized[tt.key] != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, sanitized[tt.key])
+			}
+			if args[tt.key] != tt.value {
+				t.Errorf("Original arguments were mutated: %v", args[tt.key])
+			}
+		})
+	}
+}
+
+// TestSanitizePathArgumentsWithoutRoots verifies arguments pass through when no roots are set
+func TestSanitizePathArgumentsWithoutRoots(t *testing.T) {
+	adapter := NewToolAdapter(nil)
+	args := map[string]interface{}{"output_path": "relative.png"}
+
+	sanitized, rewrites, err := adapter.sanitizePathArguments("imagesorcery__fill", args)
+	if err != nil || sanitized["output_path"] != "relative.png" || len(rewrites) != 0 {
+		t.Errorf("Expected path unchanged, got %v %v (err: %v)", sanitized["output_path"], rewrites, err)
+	}
+}
+
+// TestAllowAnyPath verifies output paths outside the roots are kept when any path is allowed
+func TestAllowAnyPath(t *testing.T) {
+	adapter := NewToolAdapter(nil)
+	adapter.SetPathRoots("/work/tmp", "/work/output")
+	adapter.SetAllowAnyPath(true)
+
+	sanitized, _, err := adapter.sanitizePathArguments("imagesorcery__fill", map[string]interface{}{"output_path": "/srv/final.mp4"})
+	if err != nil || sanitized["output_path"] != "/srv/final.mp4" {
+		t.Errorf("Expected the path kept, got %v (err: %v)", sanitized["output_path"], err)
+	}
+}
+
+// TestOutputPathRules verifies configured rules decide which arguments are outputs
+func TestOutputPathRules(t *testing.T) {
+	adapter := NewToolAdapter(nil)
+	adapter.SetPathRoots("/work/tmp", "/work/output")
+	adapter.SetOutputPathRules([]types.PathArgumentRule{{Tool: "video__*", Argument: "destination"}})
+
+	sanitized, rewrites, err := adapter.sanitizePathArguments("video__render", map[string]interface{}{"destination": "clip.mp4"})
+	if err != nil || sanitized["destination"] != "/work/tmp/clip.mp4" {
+		t.Errorf("Expected destination rooted in scratch, got %v (err: %v)", sanitized["destination"], err)
+	}
+	if expected := []PathRewrite{{Argument: "destination", From: "clip.mp4", To: "/work/tmp/clip.mp4"}}; !reflect.DeepEqual(rewrites, expected) {
+		t.Errorf("Expected rewrites %v, got %v", expected, rewrites)
+	}
+	if _, _, err := adapter.sanitizePathArguments("video__render", map[string]interface{}{"destination": "/home/user/clip.mp4"}); !errors.Is(err, ErrPathOutsideRoots) {
+		t.Errorf("Expected a destination outside the roots rejected, got %v", err)
+	}
+
+	// Other tools' arguments aren't outputs under these rules
+	if _, _, err := adapter.sanitizePathArguments("imagesorcery__fill", map[string]interface{}{"destination": "/home/user/clip.mp4"}); err != nil {
+		t.Errorf("Expected an unmatched tool's argument untouched, got %v", err)
+	}
+}
+
+// TestExecuteToolCallRecordsPathRewrites verifies observers see rewritten and rejected
+// path arguments, and rejected calls never reach the server
+func TestExecuteToolCallRecordsPathRewrites(t *testing.T) {
+	server := &schemaMCPClient{}
+	adapter := NewToolAdapter(map[string]client.MCPClient{"imagesorcery": server})
+	adapter.SetPathRoots("/work/tmp", "/work/output")
+	var observed []ObservedToolCall
+	adapter.AddObserver(func(call ObservedToolCall) { observed = append(observed, call) })
+
+	if _, err := adapter.ExecuteToolCall(context.Background(), "imagesorcery__fill", map[string]interface{}{"output_path": "person.png"}); err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+	if _, err := adapter.ExecuteToolCall(context.Background(), "imagesorcery__fill", map[string]interface{}{"output_path": "/home/user/person.png"}); !errors.Is(err, ErrPathOutsideRoots) {
+		t.Errorf("Expected the call rejected, got %v", err)
+	}
+
+	if len(server.calls) != 1 {
+		t.Errorf("Expected only the accepted call to reach the server, got %v", server.calls)
+	}
+	if len(observed) != 2 {
+		t.Fatalf("Expected both calls observed, got %d", len(observed))
+	}
+	if rewrites := observed[0].PathRewrites; len(rewrites) != 1 || rewrites[0].To != "/work/tmp/person.png" || observed[0].Arguments["output_path"] != "/work/tmp/person.png" {
+		t.Errorf("Expected the rewrite recorded, got %v %v", rewrites, observed[0].Arguments)
+	}
+	if !errors.Is(observed[1].Err, ErrPathOutsideRoots) {
+		t.Errorf("Expected the rejection observed, got %v", observed[1].Err)
+	}
+}
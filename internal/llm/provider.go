@@ -2,8 +2,28 @@ package llm
 
 import (
 	"context"
+	"errors"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Retries of LLM API calls that fail transiently (rate limits, 5xx, timeouts)
+const (
+	APICallAttempts = 3
+	APICallBackoff  = 2 * time.Second
 )
 
+// CallWithRetry calls a provider API, retrying failures retry.IsRetryable accepts
+func CallWithRetry(ctx context.Context, provider string, call func() error) error {
+	return retry.Do(ctx, provider+" API call", APICallAttempts, APICallBackoff, call)
+}
+
+// ErrMalformedResponse is returned when the model keeps sending unusable responses,
+// such as malformed function calls, after being asked to repeat them
+var ErrMalformedResponse = errors.New("model kept returning malformed responses")
+
 // Provider abstracts different LLM providers (Claude, Gemini, OpenAI)
 type Provider interface {
 	// Name returns the provider name
@@ -39,15 +59,31 @@ type FullAIConversationConfig struct {
 	MaxCostUSD     float64 // Maximum cost in USD
 	TimeoutSeconds int     // Global timeout
 	Model          string  // Model name (provider-specific)
+	TempDir        string  // Absolute scratch directory for intermediate files
+	OutputDir      string  // Absolute directory for final outputs
+
+	BudgetStatus types.BudgetStatusConfig // Per-round budget reminder injected into the context
+
+	HistoryCompaction types.HistoryCompactionConfig // Eliding of old tool results from the history
+
+	MaxToolResultsPerTurn int // Tool calls run per model response, the rest deferred (0 = default, negative = no limit)
+
+	Trace *TraceRecorder // Records prompts and model turns when set (may be nil)
+	Debug *DebugDumper   // Dumps sanitized API requests and responses when set (may be nil)
 }
 
-// FullAIConversationMetrics tracks conversation performance for full AI mode
+// FullAIConversationMetrics tracks conversation performance for full AI mode.
+// The totals are the sums over RoundMetrics (CostUSD is the last round's cumulative cost).
 type FullAIConversationMetrics struct {
-	Rounds     int
-	ToolCalls  int
-	TokensUsed int
-	Duration   float64 // seconds
-	CostUSD    float64
+	Rounds     int     `json:"rounds"`
+	ToolCalls  int     `json:"tool_calls"`
+	TokensUsed int     `json:"tokens_used"`
+	Duration   float64 `json:"duration"` // seconds
+	CostUSD    float64 `json:"cost_usd"`
+
+	MalformedResponses int `json:"malformed_responses,omitempty"` // Responses the model was asked to repeat
+
+	RoundMetrics []RoundMetric `json:"round_metrics,omitempty"`
 }
 
 // NewProvider factory has been moved to cmd/agent/main.go to avoid import cycles.
@@ -0,0 +1,40 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+)
+
+// Ask answers a single question with the provider's model, without tools
+func (p *Provider) Ask(ctx context.Context, question string) (*llm.Advice, error) {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(p.model),
+		MaxTokens: llm.MaxAdviceTokens,
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(question))},
+	}
+	var response *anthropic.Message
+	err := llm.CallWithRetry(ctx, "Claude", func() error {
+		var err error
+		response, err = p.client.Messages.New(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Claude API error: %w", err)
+	}
+
+	var text string
+	for _, content := range response.Content {
+		if content.Type == "text" {
+			text += content.Text
+		}
+	}
+	return &llm.Advice{
+		Text:         text,
+		Model:        string(response.Model),
+		InputTokens:  int(response.Usage.InputTokens),
+		OutputTokens: int(response.Usage.OutputTokens),
+	}, nil
+}
@@ -17,9 +17,12 @@ type Conversation struct {
 	config      *llm.FullAIConversationConfig
 	toolAdapter *llm.ToolAdapter
 	messages    []anthropic.MessageParam
+	rounds      int
 	toolCalls   int
 	tokensUsed  int
 	startTime   time.Time
+	roundStats  *llm.RoundTracker
+	compactor   *llm.HistoryCompactor
 }
 
 // NewConversation creates a new Claude conversation
@@ -29,6 +32,8 @@ func NewConversation(provider *Provider, config *llm.FullAIConversationConfig) *
 		config:     config,
 		messages:   make([]anthropic.MessageParam, 0),
 		startTime:  time.Now(),
+		roundStats: llm.NewModelRoundTracker("anthropic", provider.model),
+		compactor:  llm.NewHistoryCompactor(config.HistoryCompaction),
 	}
 }
 
@@ -59,7 +64,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 
 	// 4. Create system prompt
 	toolsDesc := c.toolAdapter.GetToolDescription()
-	systemPrompt := llm.CreateVideoGenerationPrompt(duration, imagePath, toolsDesc)
+	systemPrompt := llm.CreateVideoGenerationPrompt(duration, imagePath, toolsDesc, c.config.TempDir, c.config.OutputDir)
 
 	// 5. Create initial message
 	var initialPrompt string
@@ -68,6 +73,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 	} else {
 		initialPrompt = fmt.Sprintf("Please generate a %.1f-second animated video for this image.", duration)
 	}
+	c.config.Trace.RecordPrompts(systemPrompt, initialPrompt)
 	initialMessage := anthropic.NewUserMessage(
 		anthropic.NewImageBlockBase64(mediaType, imageBase64),
 		anthropic.NewTextBlock(initialPrompt),
@@ -89,7 +95,8 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		}
 
 		// Call Claude API
-		response, err := c.provider.client.Messages.New(ctx, anthropic.MessageNewParams{
+		c.compactor.Compact(c.rounds)
+		params := anthropic.MessageNewParams{
 			Model:     anthropic.Model(c.config.Model),
 			MaxTokens: 4096,
 			System: []anthropic.TextBlockParam{
@@ -97,19 +104,33 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 			},
 			Messages: c.messages,
 			Tools:    claudeTools,
+		}
+		var response *anthropic.Message
+		err := llm.CallWithRetry(ctx, "Claude", func() error {
+			var err error
+			response, err = c.provider.client.Messages.New(ctx, params)
+			return err
 		})
+		if dumpErr := c.config.Debug.Dump(round+1, params, response, err); dumpErr != nil {
+			log.Printf("[Claude] Warning: %v", dumpErr)
+		}
 
 		if err != nil {
 			return "", fmt.Errorf("Claude API error at round %d: %w", round+1, err)
 		}
 
 		// Update metrics
+		c.rounds++
 		c.tokensUsed += int(response.Usage.InputTokens + response.Usage.OutputTokens)
+		c.roundStats.StartRound()
+		c.roundStats.AddUsage(int(response.Usage.InputTokens), int(response.Usage.OutputTokens))
 		log.Printf("[Claude] Tokens: +%d input, +%d output (total: %d)",
 			response.Usage.InputTokens, response.Usage.OutputTokens, c.tokensUsed)
+		c.config.Trace.RecordTurn(c.responseText(response),
+			int(response.Usage.InputTokens), int(response.Usage.OutputTokens))
 
 		// Check cost limit
-		estimatedCost := float64(c.tokensUsed) * 0.000003
+		estimatedCost := c.roundStats.CostUSD()
 		if estimatedCost > c.config.MaxCostUSD {
 			return "", fmt.Errorf("exceeded cost limit: $%.4f", estimatedCost)
 		}
@@ -126,6 +147,10 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 			if err != nil {
 				log.Printf("[Claude] Tool execution error: %v", err)
 			}
+			if reported := c.toolAdapter.ReportedResult(); reported != nil {
+				log.Println("[Claude] Final result reported")
+				return reported.VideoPath, nil
+			}
 			continue
 
 		case "end_turn":
@@ -150,10 +175,18 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 // handleToolUse processes tool execution requests
 func (c *Conversation) handleToolUse(ctx context.Context, response *anthropic.Message) error {
 	var toolResultBlocks []anthropic.ContentBlockParamUnion
+	messageIndex := len(c.messages) // Where the tool results message is appended
+	turn := llm.NewToolTurn(c.config.MaxToolResultsPerTurn)
 
 	for _, content := range response.Content {
 		if content.Type == "tool_use" {
+			if turn.Defer() {
+				toolResultBlocks = append(toolResultBlocks,
+					anthropic.NewToolResultBlock(content.ID, turn.DeferredToolResultText(content.Name), true))
+				continue
+			}
 			c.toolCalls++
+			c.roundStats.AddToolCall(content.Name)
 
 			log.Printf("[Claude] Tool Call #%d: %s", c.toolCalls, content.Name)
 
@@ -168,34 +201,50 @@ func (c *Conversation) handleToolUse(ctx context.Context, response *anthropic.Me
 
 			isError := err != nil
 			if isError {
-				result = fmt.Sprintf("Error: %v", err)
 				log.Printf("[Claude] Tool execution failed: %v", err)
 			} else {
 				log.Printf("[Claude] Tool result: %d bytes", len(result))
 			}
 
 			// Add result
+			blockIndex, toolUseID := len(toolResultBlocks), content.ID
+			c.compactor.Track(c.rounds, content.Name, func(placeholder string) {
+				c.messages[messageIndex].Content[blockIndex] = anthropic.NewToolResultBlock(toolUseID, placeholder, isError)
+			})
 			toolResultBlocks = append(toolResultBlocks,
 				anthropic.NewToolResultBlock(content.ID, result, isError))
 		}
 	}
 
-	// Add all tool results
+	if deferred := turn.Deferred(); deferred > 0 {
+		log.Printf("[Claude] Deferred %d tool calls beyond the limit of %d per turn", deferred, turn.Limit())
+	}
+
+	// Add all tool results, followed by the budget reminder
 	if len(toolResultBlocks) > 0 {
+		if status := llm.FormatBudgetStatus(c.config.BudgetStatus, llm.NewBudgetSnapshot(c.config, c.rounds, c.tokensUsed, c.GetMetrics().CostUSD)); status != "" {
+			toolResultBlocks = append(toolResultBlocks, anthropic.NewTextBlock(status))
+		}
 		c.messages = append(c.messages, anthropic.NewUserMessage(toolResultBlocks...))
 	}
 
 	return nil
 }
 
-// extractFinalResult extracts text from Claude's response
-func (c *Conversation) extractFinalResult(response *anthropic.Message) string {
+// responseText concatenates the text blocks of Claude's response
+func (c *Conversation) responseText(response *anthropic.Message) string {
 	var result string
 	for _, content := range response.Content {
 		if content.Type == "text" {
 			result += content.Text
 		}
 	}
+	return result
+}
+
+// extractFinalResult extracts text from Claude's response
+func (c *Conversation) extractFinalResult(response *anthropic.Message) string {
+	result := llm.StripBudgetStatus(c.responseText(response))
 	if result == "" {
 		result = "Task completed (no text output)"
 	}
@@ -238,18 +287,9 @@ func (c *Conversation) convertToolsToClaudeFormat(tools []llm.UnifiedTool) []ant
 	return claudeTools
 }
 
-// GetMetrics returns conversation metrics
+// GetMetrics returns conversation metrics, at the model's list pricing
 func (c *Conversation) GetMetrics() llm.FullAIConversationMetrics {
-	duration := time.Since(c.startTime).Seconds()
-	costUSD := float64(c.tokensUsed) * 0.000003 // $3 per 1M tokens
-
-	return llm.FullAIConversationMetrics{
-		Rounds:     len(c.messages) / 2,
-		ToolCalls:  c.toolCalls,
-		TokensUsed: c.tokensUsed,
-		Duration:   duration,
-		CostUSD:    costUSD,
-	}
+	return c.roundStats.Metrics()
 }
 
 // GetState returns current state (for debugging)
@@ -0,0 +1,91 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm/llmtest"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// toolUseMessage returns an assistant message requesting two fill calls
+func toolUseMessage(t *testing.T, round int) *anthropic.Message {
+	t.Helper()
+	raw := fmt.Sprintf(`{"id": "msg_%[1]d", "type": "message", "role": "assistant", "stop_reason": "tool_use",
+		"content": [
+			{"type": "text", "text": "Filling round %[1]d"},
+			{"type": "tool_use", "id": "toolu_%[1]da", "name": "imagesorcery__fill", "input": {"output_path": "/tmp/%[1]da.png"}},
+			{"type": "tool_use", "id": "toolu_%[1]db", "name": "imagesorcery__fill", "input": {"output_path": "/tmp/%[1]db.png"}}
+		]}`, round)
+	var message anthropic.Message
+	if err := json.Unmarshal([]byte(raw), &message); err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	return &message
+}
+
+// TestHistoryCompactionKeepsToolPairs verifies compaction only rewrites tool result
+// content: every tool_use is still answered by a tool_result with its ID in the next message
+func TestHistoryCompactionKeepsToolPairs(t *testing.T) {
+	conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{
+		HistoryCompaction: types.HistoryCompactionConfig{AfterRound: 2, KeepRounds: 1},
+	})
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+	conv.messages = append(conv.messages, anthropic.NewUserMessage(
+		anthropic.NewImageBlockBase64("image/png", "iVBORw0KGgo"),
+		anthropic.NewTextBlock("Animate this photo"),
+	))
+
+	for round := 1; round <= 3; round++ {
+		conv.rounds = round
+		response := toolUseMessage(t, round)
+		conv.messages = append(conv.messages, anthropic.NewAssistantMessage(conv.convertContentBlocks(response.Content)...))
+		if err := conv.handleToolUse(context.Background(), response); err != nil {
+			t.Fatalf("handleToolUse failed: %v", err)
+		}
+	}
+	conv.compactor.Compact(conv.rounds)
+
+	if conv.messages[0].Content[0].OfImage == nil {
+		t.Error("Expected the original image to be kept")
+	}
+	for i := 1; i < len(conv.messages); i += 2 {
+		round := (i + 1) / 2
+		var toolUseIDs []string
+		for _, block := range conv.messages[i].Content {
+			if block.OfToolUse != nil {
+				toolUseIDs = append(toolUseIDs, block.OfToolUse.ID)
+			}
+		}
+
+		var results []*anthropic.ToolResultBlockParam
+		for _, block := range conv.messages[i+1].Content {
+			if block.OfToolResult != nil {
+				results = append(results, block.OfToolResult)
+			}
+		}
+		if len(results) != len(toolUseIDs) {
+			t.Fatalf("Round %d: %d tool_use blocks answered by %d tool_result blocks", round, len(toolUseIDs), len(results))
+		}
+		for j, result := range results {
+			if result.ToolUseID != toolUseIDs[j] {
+				t.Errorf("Round %d: result %d answers %s, want %s", round, j, result.ToolUseID, toolUseIDs[j])
+			}
+			expected := fmt.Sprintf("/tmp/%d%c.png", round, 'a'+j)
+			if round < 3 {
+				expected = llm.ElidedResultText("imagesorcery__fill", round)
+			}
+			if got := result.Content[0].OfText.Text; got != expected {
+				t.Errorf("Round %d: result %d is %q, want %q", round, j, got, expected)
+			}
+		}
+	}
+}
@@ -23,8 +23,14 @@ func NewProvider(config types.AnthropicConfig) (*Provider, error) {
 		return &Provider{enabled: false}, nil
 	}
 
+	// Retries follow the shared policy in llm.CallWithRetry
+	options := []option.RequestOption{option.WithAPIKey(config.APIKey), option.WithMaxRetries(0)}
+	if httpClient := llm.NewHeaderClient(config.Headers); httpClient != nil {
+		options = append(options, option.WithHTTPClient(httpClient))
+	}
+
 	return &Provider{
-		client:  anthropic.NewClient(option.WithAPIKey(config.APIKey)),
+		client:  anthropic.NewClient(options...),
 		model:   config.Model,
 		timeout: config.Timeout,
 		enabled: true,
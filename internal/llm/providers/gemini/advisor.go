@@ -0,0 +1,30 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genai"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+)
+
+// Ask answers a single question with the provider's model, without tools
+func (p *Provider) Ask(ctx context.Context, question string) (*llm.Advice, error) {
+	config := &genai.GenerateContentConfig{MaxOutputTokens: llm.MaxAdviceTokens}
+	var resp *genai.GenerateContentResponse
+	err := llm.CallWithRetry(ctx, "Gemini", func() error {
+		var err error
+		resp, err = p.client.Models.GenerateContent(ctx, p.model, genai.Text(question), config)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Gemini API error: %w", err)
+	}
+
+	advice := &llm.Advice{Text: resp.Text(), Model: p.model}
+	if resp.UsageMetadata != nil {
+		advice.InputTokens = int(resp.UsageMetadata.PromptTokenCount)
+		advice.OutputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+	return advice, nil
+}
@@ -3,6 +3,7 @@ package gemini
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -11,23 +12,42 @@ import (
 	"github.com/zhe.chen/agent-funpic-act/internal/llm"
 )
 
+// chatSession is the subset of *genai.Chat used by the conversation loop
+type chatSession interface {
+	SendMessage(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error)
+	History(curated bool) []*genai.Content
+}
+
+// maxMalformedRepairs bounds how many times in a row Gemini is asked to repeat a
+// malformed or empty response before the conversation fails
+const maxMalformedRepairs = 2
+
+// malformedRepairPrompt asks Gemini to repeat an unusable response; %s is the reason
+const malformedRepairPrompt = "Your previous response %s. Re-issue the function call with its arguments as valid JSON matching the tool's parameter schema, or reply with text if the workflow is complete."
+
 // Conversation implements llm.Conversation for Gemini
 type Conversation struct {
 	provider    *Provider
 	config      *llm.FullAIConversationConfig
 	toolAdapter *llm.ToolAdapter
-	chat        *genai.Chat
+	chat        chatSession
+	rounds      int
 	toolCalls   int
 	tokensUsed  int
 	startTime   time.Time
+	roundStats  *llm.RoundTracker
+	compactor   *llm.HistoryCompactor
+	unrecorded  []genai.Part // Last sent parts, when the chat dropped them from its history
 }
 
 // NewConversation creates a new Gemini conversation
 func NewConversation(provider *Provider, config *llm.FullAIConversationConfig) *Conversation {
 	return &Conversation{
-		provider:  provider,
-		config:    config,
-		startTime: time.Now(),
+		provider:   provider,
+		config:     config,
+		startTime:  time.Now(),
+		roundStats: llm.NewModelRoundTracker("google", provider.model),
+		compactor:  llm.NewHistoryCompactor(config.HistoryCompaction),
 	}
 }
 
@@ -60,7 +80,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 
 	// 4. Create system instruction
 	toolsDesc := c.toolAdapter.GetToolDescription()
-	systemPrompt := llm.CreateVideoGenerationPrompt(duration, imagePath, toolsDesc)
+	systemPrompt := llm.CreateVideoGenerationPrompt(duration, imagePath, toolsDesc, c.config.TempDir, c.config.OutputDir)
 
 	// 5. Create chat configuration
 	chatConfig := &genai.GenerateContentConfig{
@@ -78,11 +98,11 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		log.Printf("[Gemini] Using provider's default model: %s", model)
 	}
 
-	var chatErr error
-	c.chat, chatErr = c.provider.client.Chats.Create(ctx, model, chatConfig, []*genai.Content{})
-	if chatErr != nil {
-		return "", fmt.Errorf("failed to create chat: %w", chatErr)
+	chat, err := c.provider.client.Chats.Create(ctx, model, chatConfig, []*genai.Content{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create chat: %w", err)
 	}
+	c.chat = chat
 
 	// 7. Prepare initial message with image
 	var initialPrompt string
@@ -99,12 +119,19 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		return "", fmt.Errorf("failed to decode image: %w", err)
 	}
 
+	c.config.Trace.RecordPrompts(systemPrompt, initialPrompt)
 	initialParts := []genai.Part{
 		*genai.NewPartFromBytes(imageData, mediaType),
 		*genai.NewPartFromText(initialPrompt),
 	}
 
 	// 8. Conversation loop
+	return c.converse(ctx, initialParts)
+}
+
+// converse sends the initial message and processes responses until the model finishes,
+// reports a result or a limit is hit
+func (c *Conversation) converse(ctx context.Context, initialParts []genai.Part) (string, error) {
 	maxRounds := c.config.MaxRounds
 	if maxRounds == 0 {
 		maxRounds = 20
@@ -128,7 +155,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		var err error
 
 		if round == 0 {
-			resp, err = c.chat.SendMessage(ctx, initialParts...)
+			resp, err = c.send(ctx, initialParts, "")
 			if err != nil {
 				return "", fmt.Errorf("Gemini API error at round %d: %w", round+1, err)
 			}
@@ -138,22 +165,49 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		}
 
 		// Process responses in a loop (for handling multiple tool call rounds)
+		repairs := 0
 		for {
 			// Update token usage
+			c.rounds++
+			c.roundStats.StartRound()
+			var inputTokens, outputTokens int
 			if resp.UsageMetadata != nil {
-				inputTokens := int(resp.UsageMetadata.PromptTokenCount)
-				outputTokens := int(resp.UsageMetadata.CandidatesTokenCount)
+				inputTokens = int(resp.UsageMetadata.PromptTokenCount)
+				outputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
 				c.tokensUsed += inputTokens + outputTokens
+				c.roundStats.AddUsage(inputTokens, outputTokens)
 				log.Printf("[Gemini] Tokens: +%d input, +%d output (total: %d)",
 					inputTokens, outputTokens, c.tokensUsed)
 			}
+			if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+				c.config.Trace.RecordTurn(c.extractTextFromParts(resp.Candidates[0].Content.Parts), inputTokens, outputTokens)
+			} else {
+				c.config.Trace.RecordTurn("", inputTokens, outputTokens)
+			}
 
 			// Check cost limit
-			estimatedCost := float64(c.tokensUsed) * 0.000001
+			estimatedCost := c.roundStats.CostUSD()
 			if estimatedCost > c.config.MaxCostUSD {
 				return "", fmt.Errorf("exceeded cost limit: $%.4f", estimatedCost)
 			}
 
+			// Ask again for malformed function calls and empty responses, a bounded
+			// number of times in a row
+			if reason := malformedReason(resp); reason != "" {
+				c.roundStats.AddMalformedResponse()
+				if repairs >= maxMalformedRepairs {
+					return "", fmt.Errorf("%w: response %s after %d repair attempts", llm.ErrMalformedResponse, reason, repairs)
+				}
+				repairs++
+				log.Printf("[Gemini] Warning: response %s, asking the model to try again (%d/%d)", reason, repairs, maxMalformedRepairs)
+				resp, err = c.send(ctx, c.unrecorded, fmt.Sprintf(malformedRepairPrompt, reason))
+				if err != nil {
+					return "", fmt.Errorf("Gemini API error at round %d: %w", c.rounds+1, err)
+				}
+				continue
+			}
+			repairs = 0
+
 			// Check if we have a valid candidate
 			if len(resp.Candidates) == 0 {
 				return "", fmt.Errorf("no candidates in response")
@@ -183,6 +237,10 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 					log.Printf("[Gemini] Tool execution error: %v", err)
 					return "", fmt.Errorf("tool execution failed: %w", err)
 				}
+				if reported := c.toolAdapter.ReportedResult(); reported != nil {
+					log.Println("[Gemini] Final result reported")
+					return reported.VideoPath, nil
+				}
 				if nextResp == nil {
 					return "", fmt.Errorf("no response after tool execution")
 				}
@@ -192,7 +250,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 			}
 
 			// No tool calls - extract final result
-			result := c.extractTextFromParts(candidate.Content.Parts)
+			result := llm.StripBudgetStatus(c.extractTextFromParts(candidate.Content.Parts))
 			if result != "" {
 				log.Println("[Gemini] Conversation completed")
 				return result, nil
@@ -206,15 +264,80 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 	return "", fmt.Errorf("exceeded max conversation rounds: %d", maxRounds)
 }
 
+// send sends input, followed by note when set, as the next user message. The chat
+// leaves a message out of its history when the response is unusable, so the input is
+// kept in c.unrecorded to be sent again with a repair request.
+func (c *Conversation) send(ctx context.Context, input []genai.Part, note string) (*genai.GenerateContentResponse, error) {
+	parts := append([]genai.Part(nil), input...)
+	if note != "" {
+		parts = append(parts, *genai.NewPartFromText(note))
+	}
+
+	recorded := len(c.chat.History(true))
+	var resp *genai.GenerateContentResponse
+	err := llm.CallWithRetry(ctx, "Gemini", func() error {
+		var err error
+		resp, err = c.chat.SendMessage(ctx, parts...)
+		return err
+	})
+	if dumpErr := c.config.Debug.Dump(c.rounds+1, parts, resp, err); dumpErr != nil {
+		log.Printf("[Gemini] Warning: %v", dumpErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.unrecorded = nil
+	if len(c.chat.History(true)) == recorded {
+		c.unrecorded = input
+	}
+	return resp, nil
+}
+
+// malformedReason describes a response Gemini should be asked to repeat: a malformed
+// function call or a candidate without content. Returns "" for usable responses and
+// for blocked or truncated ones, which fail the conversation as before.
+func malformedReason(resp *genai.GenerateContentResponse) string {
+	if len(resp.Candidates) == 0 {
+		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+			return ""
+		}
+		return "had no candidates"
+	}
+
+	candidate := resp.Candidates[0]
+	switch candidate.FinishReason {
+	case genai.FinishReasonMalformedFunctionCall:
+		return "contained a malformed function call"
+	case "", genai.FinishReasonUnspecified, genai.FinishReasonStop:
+		if candidate.Content == nil || len(candidate.Content.Parts) == 0 {
+			return "was empty"
+		}
+	}
+	return ""
+}
+
 // handleToolCalls processes tool calls from Gemini and sends results back
-// Returns Gemini's response after seeing the function results
+// Returns Gemini's response after seeing the function results.
+// Responses are sent in call order and carry the call ID when Gemini provides one,
+// so repeated calls to the same tool in one turn stay associated with their results.
 func (c *Conversation) handleToolCalls(ctx context.Context, parts []*genai.Part) (*genai.GenerateContentResponse, error) {
 	var functionResponses []genai.Part
+	turn := llm.NewToolTurn(c.config.MaxToolResultsPerTurn)
 
 	for _, part := range parts {
 		if part.FunctionCall != nil {
+			if turn.Defer() {
+				response := *genai.NewPartFromFunctionResponse(part.FunctionCall.Name, map[string]interface{}{
+					"error": turn.DeferredToolResultText(part.FunctionCall.Name),
+				})
+				response.FunctionResponse.ID = part.FunctionCall.ID
+				functionResponses = append(functionResponses, response)
+				continue
+			}
 			c.toolCalls++
 			toolName := part.FunctionCall.Name
+			c.roundStats.AddToolCall(toolName)
 			log.Printf("[Gemini] Tool Call #%d: %s", c.toolCalls, toolName)
 
 			// Convert args to map
@@ -229,25 +352,47 @@ func (c *Conversation) handleToolCalls(ctx context.Context, parts []*genai.Part)
 			// Create function response
 			var response genai.Part
 			if err != nil {
+				// The result is the adapter's JSON error payload, passed as the response object
 				log.Printf("[Gemini] Tool execution failed: %v", err)
-				response = *genai.NewPartFromFunctionResponse(toolName, map[string]interface{}{
-					"error":  err.Error(),
-					"result": result,
-				})
+				payload := map[string]interface{}{}
+				if jsonErr := json.Unmarshal([]byte(result), &payload); jsonErr != nil {
+					payload = map[string]interface{}{"error": true, "message": err.Error()}
+				}
+				response = *genai.NewPartFromFunctionResponse(toolName, payload)
 			} else {
 				log.Printf("[Gemini] Tool result: %d bytes", len(result))
 				response = *genai.NewPartFromFunctionResponse(toolName, map[string]interface{}{
 					"result": result,
 				})
 			}
+			response.FunctionResponse.ID = part.FunctionCall.ID
+			// The chat history keeps copies of the sent parts that share this
+			// FunctionResponse, so replacing its payload compacts the history
+			functionResponse := response.FunctionResponse
+			c.compactor.Track(c.rounds, toolName, func(placeholder string) {
+				functionResponse.Response = map[string]interface{}{"result": placeholder}
+			})
 
 			functionResponses = append(functionResponses, response)
 		}
 	}
 
-	// Send all function responses back to Gemini and get its response
+	if deferred := turn.Deferred(); deferred > 0 {
+		log.Printf("[Gemini] Deferred %d tool calls beyond the limit of %d per turn", deferred, turn.Limit())
+	}
+
+	// The conversation ends once the final result is reported; no need to reply
+	if c.toolAdapter.ReportedResult() != nil {
+		return nil, nil
+	}
+
+	// Send all function responses back to Gemini (with the budget reminder) and get its response
 	if len(functionResponses) > 0 {
-		resp, err := c.chat.SendMessage(ctx, functionResponses...)
+		if status := llm.FormatBudgetStatus(c.config.BudgetStatus, llm.NewBudgetSnapshot(c.config, c.rounds, c.tokensUsed, c.GetMetrics().CostUSD)); status != "" {
+			functionResponses = append(functionResponses, *genai.NewPartFromText(status))
+		}
+		c.compactor.Compact(c.rounds)
+		resp, err := c.send(ctx, functionResponses, "")
 		if err != nil {
 			return nil, fmt.Errorf("failed to send function responses: %w", err)
 		}
@@ -396,18 +541,9 @@ func (c *Conversation) mapJSONTypeToGemini(jsonType string) genai.Type {
 	}
 }
 
-// GetMetrics returns conversation metrics
+// GetMetrics returns conversation metrics, at the model's list pricing
 func (c *Conversation) GetMetrics() llm.FullAIConversationMetrics {
-	duration := time.Since(c.startTime).Seconds()
-	costUSD := float64(c.tokensUsed) * 0.000001 // Approximate Gemini pricing
-
-	return llm.FullAIConversationMetrics{
-		Rounds:     1, // Simplified for now
-		ToolCalls:  c.toolCalls,
-		TokensUsed: c.tokensUsed,
-		Duration:   duration,
-		CostUSD:    costUSD,
-	}
+	return c.roundStats.Metrics()
 }
 
 // GetState returns current state (for debugging)
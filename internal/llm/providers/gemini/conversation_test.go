@@ -0,0 +1,353 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm/llmtest"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// scriptedChat is a chatSession that records sent parts and replays canned responses.
+// Like genai.Chat, its curated history leaves out messages whose response has no content.
+type scriptedChat struct {
+	responses []*genai.GenerateContentResponse
+	sent      [][]genai.Part
+	history   []*genai.Content
+}
+
+func (s *scriptedChat) SendMessage(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	s.sent = append(s.sent, parts)
+	if len(s.responses) == 0 {
+		return nil, fmt.Errorf("no scripted response left")
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil && len(resp.Candidates[0].Content.Parts) > 0 {
+		input := &genai.Content{Role: genai.RoleUser}
+		for i := range parts {
+			input.Parts = append(input.Parts, &parts[i])
+		}
+		s.history = append(s.history, input, resp.Candidates[0].Content)
+	}
+	return resp, nil
+}
+
+func (s *scriptedChat) History(curated bool) []*genai.Content {
+	return s.history
+}
+
+// TestHandleToolCallsPreservesCallIDs verifies that two same-named calls in one turn
+// get responses carrying their own call IDs, in call order, with distinct results
+func TestHandleToolCallsPreservesCallIDs(t *testing.T) {
+	chat := &scriptedChat{
+		responses: []*genai.GenerateContentResponse{{}},
+	}
+	conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{})
+	conv.chat = chat
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+
+	parts := []*genai.Part{
+		{FunctionCall: &genai.FunctionCall{
+			ID:   "call-1",
+			Name: "imagesorcery__fill",
+			Args: map[string]any{"output_path": "/tmp/first.png"},
+		}},
+		genai.NewPartFromText("filling both areas"),
+		{FunctionCall: &genai.FunctionCall{
+			ID:   "call-2",
+			Name: "imagesorcery__fill",
+			Args: map[string]any{"output_path": "/tmp/second.png"},
+		}},
+	}
+
+	if _, err := conv.handleToolCalls(context.Background(), parts); err != nil {
+		t.Fatalf("handleToolCalls failed: %v", err)
+	}
+
+	if len(chat.sent) != 1 {
+		t.Fatalf("Expected 1 message sent, got %d", len(chat.sent))
+	}
+
+	expected := []struct {
+		id     string
+		result string
+	}{
+		{"call-1", "/tmp/first.png"},
+		{"call-2", "/tmp/second.png"},
+	}
+
+	sent := chat.sent[0]
+	if len(sent) != len(expected) {
+		t.Fatalf("Expected %d function responses, got %d", len(expected), len(sent))
+	}
+
+	for i, want := range expected {
+		fr := sent[i].FunctionResponse
+		if fr == nil {
+			t.Fatalf("Part %d is not a function response", i)
+		}
+		if fr.ID != want.id {
+			t.Errorf("Response %d: expected ID %q, got %q", i, want.id, fr.ID)
+		}
+		if fr.Name != "imagesorcery__fill" {
+			t.Errorf("Response %d: expected name imagesorcery__fill, got %q", i, fr.Name)
+		}
+		if got := fr.Response["result"]; got != want.result {
+			t.Errorf("Response %d: expected result %q, got %v", i, want.result, got)
+		}
+	}
+}
+
+// TestHandleToolCallsWithoutIDs verifies responses still work when Gemini omits call IDs
+func TestHandleToolCallsWithoutIDs(t *testing.T) {
+	chat := &scriptedChat{
+		responses: []*genai.GenerateContentResponse{{}},
+	}
+	conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{})
+	conv.chat = chat
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+
+	parts := []*genai.Part{
+		genai.NewPartFromFunctionCall("imagesorcery__fill", map[string]any{"output_path": "/tmp/only.png"}),
+	}
+
+	if _, err := conv.handleToolCalls(context.Background(), parts); err != nil {
+		t.Fatalf("handleToolCalls failed: %v", err)
+	}
+
+	fr := chat.sent[0][0].FunctionResponse
+	if fr.ID != "" {
+		t.Errorf("Expected empty ID, got %q", fr.ID)
+	}
+	if got := fr.Response["result"]; got != "/tmp/only.png" {
+		t.Errorf("Expected result /tmp/only.png, got %v", got)
+	}
+}
+
+// TestHandleToolCallsInjectsBudgetStatus verifies the budget reminder is sent once the threshold is reached
+func TestHandleToolCallsInjectsBudgetStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		rounds       int
+		expectStatus bool
+	}{
+		{name: "before threshold", rounds: 2, expectStatus: false},
+		{name: "at threshold", rounds: 3, expectStatus: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := &scriptedChat{
+				responses: []*genai.GenerateContentResponse{{}},
+			}
+			conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{
+				MaxRounds:    20,
+				BudgetStatus: types.BudgetStatusConfig{StartRound: 3},
+			})
+			conv.chat = chat
+			conv.rounds = tt.rounds
+			conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+				"imagesorcery": &llmtest.EchoMCPClient{},
+			}))
+
+			parts := []*genai.Part{
+				genai.NewPartFromFunctionCall("imagesorcery__fill", map[string]any{"output_path": "/tmp/a.png"}),
+			}
+			if _, err := conv.handleToolCalls(context.Background(), parts); err != nil {
+				t.Fatalf("handleToolCalls failed: %v", err)
+			}
+
+			sent := chat.sent[0]
+			hasStatus := false
+			for _, part := range sent {
+				if part.Text != "" && llm.StripBudgetStatus(part.Text) == "" {
+					hasStatus = true
+				}
+			}
+			if hasStatus != tt.expectStatus {
+				t.Errorf("Expected status=%v, got %v (parts: %d)", tt.expectStatus, hasStatus, len(sent))
+			}
+			if sent[0].FunctionResponse == nil {
+				t.Error("Expected function response to come before the status text")
+			}
+		})
+	}
+}
+
+// TestHandleToolCallsCompactsHistory verifies old function responses are elided in the
+// chat history while keeping the call ID and name they answer
+func TestHandleToolCallsCompactsHistory(t *testing.T) {
+	chat := &scriptedChat{
+		responses: []*genai.GenerateContentResponse{{}, {}, {}},
+	}
+	conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{
+		HistoryCompaction: types.HistoryCompactionConfig{AfterRound: 2, KeepRounds: 1},
+	})
+	conv.chat = chat
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+
+	for round := 1; round <= 3; round++ {
+		conv.rounds = round
+		parts := []*genai.Part{
+			{FunctionCall: &genai.FunctionCall{
+				ID:   fmt.Sprintf("call-%d", round),
+				Name: "imagesorcery__fill",
+				Args: map[string]any{"output_path": fmt.Sprintf("/tmp/round%d.png", round)},
+			}},
+		}
+		if _, err := conv.handleToolCalls(context.Background(), parts); err != nil {
+			t.Fatalf("handleToolCalls failed: %v", err)
+		}
+	}
+
+	for i, sent := range chat.sent {
+		round := i + 1
+		fr := sent[0].FunctionResponse
+		if fr.ID != fmt.Sprintf("call-%d", round) || fr.Name != "imagesorcery__fill" {
+			t.Errorf("Round %d: expected the response to keep its call, got %s %s", round, fr.ID, fr.Name)
+		}
+		expected := interface{}(fmt.Sprintf("/tmp/round%d.png", round))
+		if round < 3 {
+			expected = llm.ElidedResultText("imagesorcery__fill", round)
+		}
+		if got := fr.Response["result"]; got != expected {
+			t.Errorf("Round %d: expected result %v, got %v", round, expected, got)
+		}
+	}
+}
+
+// limitedConfig returns conversation limits that scripted conversations stay within
+func limitedConfig() *llm.FullAIConversationConfig {
+	return &llm.FullAIConversationConfig{MaxRounds: 10, MaxTokens: 100000, MaxCostUSD: 1, TimeoutSeconds: 60}
+}
+
+// textResponse returns a finished response with the given text
+func textResponse(text string) *genai.GenerateContentResponse {
+	return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content:      genai.NewContentFromText(text, genai.RoleModel),
+		FinishReason: genai.FinishReasonStop,
+	}}}
+}
+
+// TestConverseRepairsMalformedFunctionCall verifies a MALFORMED_FUNCTION_CALL on the
+// first round resends the initial message, which the chat dropped, with a repair request
+func TestConverseRepairsMalformedFunctionCall(t *testing.T) {
+	chat := &scriptedChat{responses: []*genai.GenerateContentResponse{
+		{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonMalformedFunctionCall}}},
+		textResponse("Video saved to /out/final.mp4"),
+	}}
+	conv := NewConversation(&Provider{}, limitedConfig())
+	conv.chat = chat
+
+	initialParts := []genai.Part{*genai.NewPartFromText("Please generate a 5.0-second animated video for this image.")}
+	result, err := conv.converse(context.Background(), initialParts)
+	if err != nil {
+		t.Fatalf("converse failed: %v", err)
+	}
+	if result != "Video saved to /out/final.mp4" {
+		t.Errorf("Unexpected result %q", result)
+	}
+
+	if len(chat.sent) != 2 {
+		t.Fatalf("Expected the initial message and one repair, got %d sends", len(chat.sent))
+	}
+	repair := chat.sent[1]
+	if len(repair) != 2 || repair[0].Text != initialParts[0].Text {
+		t.Fatalf("Expected the repair to resend the initial message, got %+v", repair)
+	}
+	if repair[1].Text != fmt.Sprintf(malformedRepairPrompt, "contained a malformed function call") {
+		t.Errorf("Unexpected repair request %q", repair[1].Text)
+	}
+	if metrics := conv.GetMetrics(); metrics.MalformedResponses != 1 {
+		t.Errorf("Expected 1 malformed response in metrics, got %d", metrics.MalformedResponses)
+	}
+}
+
+// TestConverseFailsOnPersistentEmptyResponses verifies empty responses to function
+// results are repaired at most maxMalformedRepairs times before a distinct error
+func TestConverseFailsOnPersistentEmptyResponses(t *testing.T) {
+	empty := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content:      &genai.Content{Role: genai.RoleModel},
+		FinishReason: genai.FinishReasonStop,
+	}}}
+	chat := &scriptedChat{responses: []*genai.GenerateContentResponse{
+		{Candidates: []*genai.Candidate{{
+			Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+				{FunctionCall: &genai.FunctionCall{ID: "call-1", Name: "imagesorcery__fill", Args: map[string]any{"output_path": "/tmp/a.png"}}},
+			}},
+			FinishReason: genai.FinishReasonStop,
+		}}},
+		empty, empty, empty,
+	}}
+	config := limitedConfig()
+	config.BudgetStatus = types.BudgetStatusConfig{Disabled: true}
+	conv := NewConversation(&Provider{}, config)
+	conv.chat = chat
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+
+	_, err := conv.converse(context.Background(), []genai.Part{*genai.NewPartFromText("Animate")})
+	if !errors.Is(err, llm.ErrMalformedResponse) {
+		t.Fatalf("Expected ErrMalformedResponse, got %v", err)
+	}
+
+	// Initial message, function responses, then two repairs resending them
+	if len(chat.sent) != 2+maxMalformedRepairs {
+		t.Fatalf("Expected %d sends, got %d", 2+maxMalformedRepairs, len(chat.sent))
+	}
+	for _, repair := range chat.sent[2:] {
+		if len(repair) != 2 || repair[0].FunctionResponse == nil || repair[0].FunctionResponse.ID != "call-1" {
+			t.Errorf("Expected the repair to resend the function response, got %+v", repair)
+		}
+		if repair[1].Text != fmt.Sprintf(malformedRepairPrompt, "was empty") {
+			t.Errorf("Unexpected repair request %q", repair[1].Text)
+		}
+	}
+	if metrics := conv.GetMetrics(); metrics.MalformedResponses != 3 {
+		t.Errorf("Expected 3 malformed responses in metrics, got %d", metrics.MalformedResponses)
+	}
+}
+
+func TestMalformedReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     *genai.GenerateContentResponse
+		expected string
+	}{
+		{"no candidates", &genai.GenerateContentResponse{}, "had no candidates"},
+		{"blocked prompt", &genai.GenerateContentResponse{
+			PromptFeedback: &genai.GenerateContentResponsePromptFeedback{BlockReason: genai.BlockedReasonSafety},
+		}, ""},
+		{"malformed function call", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{
+			{FinishReason: genai.FinishReasonMalformedFunctionCall},
+		}}, "contained a malformed function call"},
+		{"empty parts", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{
+			{Content: &genai.Content{Role: genai.RoleModel}, FinishReason: genai.FinishReasonStop},
+		}}, "was empty"},
+		{"safety stop", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{
+			{FinishReason: genai.FinishReasonSafety},
+		}}, ""},
+		{"text", textResponse("done"), ""},
+	}
+
+	for _, tt := range tests {
+		if got := malformedReason(tt.resp); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -25,7 +25,8 @@ func NewProvider(config types.GoogleConfig) (*Provider, error) {
 
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey: config.APIKey,
+		APIKey:     config.APIKey,
+		HTTPClient: llm.NewHeaderClient(config.Headers),
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,101 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+)
+
+// Conversation implements llm.Conversation by replaying the tool calls of a trace
+// against the real tool adapter, turn by turn
+type Conversation struct {
+	provider    *Provider
+	config      *llm.FullAIConversationConfig
+	toolAdapter *llm.ToolAdapter
+	rounds      int
+	toolCalls   int
+	tokensUsed  int
+	startTime   time.Time
+	roundStats  *llm.RoundTracker
+}
+
+// NewConversation creates a new replay conversation
+func NewConversation(provider *Provider, config *llm.FullAIConversationConfig) *Conversation {
+	return &Conversation{
+		provider:   provider,
+		config:     config,
+		startTime:  time.Now(),
+		roundStats: llm.NewRoundTracker(0),
+	}
+}
+
+// SetToolAdapter sets the tool adapter for MCP tool integration
+func (c *Conversation) SetToolAdapter(adapter *llm.ToolAdapter) {
+	c.toolAdapter = adapter
+}
+
+// Execute replays the recorded turns. Tool calls are executed for real, so the MCP
+// servers (or fakes) see the same requests as in the recorded run.
+func (c *Conversation) Execute(ctx context.Context, imagePath string, duration float64, userPrompt string) (string, error) {
+	trace := c.provider.trace
+	log.Printf("[Mock] Replaying %d turns recorded from %s", len(trace.Turns), trace.Provider)
+
+	if _, err := c.toolAdapter.DiscoverAndConvertTools(ctx); err != nil {
+		return "", fmt.Errorf("failed to discover tools: %w", err)
+	}
+	c.config.Trace.RecordPrompts(trace.SystemPrompt, trace.UserPrompt)
+
+	for _, turn := range trace.Turns {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		c.rounds++
+		c.tokensUsed += turn.InputTokens + turn.OutputTokens
+		c.roundStats.StartRound()
+		c.roundStats.AddUsage(turn.InputTokens, turn.OutputTokens)
+		c.config.Trace.RecordTurn(turn.Text, turn.InputTokens, turn.OutputTokens)
+		log.Printf("[Mock] Round %d/%d", c.rounds, len(trace.Turns))
+
+		for _, call := range turn.ToolCalls {
+			c.toolCalls++
+			c.roundStats.AddToolCall(call.Name)
+			log.Printf("[Mock] Tool Call #%d: %s", c.toolCalls, call.Name)
+
+			arguments := make(map[string]interface{}, len(call.Arguments))
+			for k, v := range call.Arguments {
+				arguments[k] = v
+			}
+			if _, err := c.toolAdapter.ExecuteToolCall(ctx, call.Name, arguments); err != nil {
+				log.Printf("[Mock] Tool execution failed: %v", err)
+			}
+
+			if reported := c.toolAdapter.ReportedResult(); reported != nil {
+				log.Println("[Mock] Final result reported")
+				return reported.VideoPath, nil
+			}
+		}
+	}
+
+	if trace.Error != "" {
+		return "", fmt.Errorf("recorded conversation failed: %s", trace.Error)
+	}
+	return llm.StripBudgetStatus(trace.FinalOutput), nil
+}
+
+// GetMetrics returns conversation metrics; cost is always zero
+func (c *Conversation) GetMetrics() llm.FullAIConversationMetrics {
+	return c.roundStats.Metrics()
+}
+
+// GetState returns current state (for debugging)
+func (c *Conversation) GetState() interface{} {
+	return map[string]interface{}{
+		"rounds":      c.rounds,
+		"tool_calls":  c.toolCalls,
+		"tokens_used": c.tokensUsed,
+	}
+}
@@ -0,0 +1,151 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// recordingMCPClient records tool calls and returns their output_path argument
+type recordingMCPClient struct {
+	calls []string
+}
+
+func (r *recordingMCPClient) Connect(ctx context.Context) error    { return nil }
+func (r *recordingMCPClient) Initialize(ctx context.Context) error { return nil }
+func (r *recordingMCPClient) Close() error                         { return nil }
+func (r *recordingMCPClient) GetServerInfo() (string, string)      { return "recording", "1.0.0" }
+
+func (r *recordingMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	return []types.Tool{{Name: "fill"}, {Name: "generate_animation_from_image"}}, nil
+}
+
+func (r *recordingMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	r.calls = append(r.calls, name)
+	return &types.ToolCallResult{
+		Content: []types.ContentBlock{{Type: "text", Text: fmt.Sprintf("%v", arguments["output_path"])}},
+	}, nil
+}
+
+// TestConversationReplaysTrace verifies recorded tool calls are replayed in order and
+// the run ends at the reported result
+func TestConversationReplaysTrace(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "final.mp4")
+	if err := os.WriteFile(videoPath, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to create video: %v", err)
+	}
+
+	trace := &llm.Trace{
+		Provider: "gemini",
+		Turns: []llm.TraceTurn{
+			{Text: "Segmenting", InputTokens: 100, OutputTokens: 10, ToolCalls: []llm.TraceToolCall{
+				{Name: "imagesorcery__fill", Arguments: map[string]interface{}{"output_path": filepath.Join(dir, "seg.png")}},
+			}},
+			{InputTokens: 200, OutputTokens: 20, ToolCalls: []llm.TraceToolCall{
+				{Name: "video__generate_animation_from_image", Arguments: map[string]interface{}{"output_path": filepath.Join(dir, "anim.mp4")}},
+				{Name: llm.ReportResultToolName, Arguments: map[string]interface{}{"video_path": videoPath, "image_description": "a dog"}},
+			}},
+			{Text: "never reached", InputTokens: 999},
+		},
+	}
+
+	imagesorcery := &recordingMCPClient{}
+	video := &recordingMCPClient{}
+	adapter := llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": imagesorcery,
+		"video":        video,
+	})
+	adapter.SetPathRoots(dir)
+
+	recorder := llm.NewTraceRecorder("mock", "", 0)
+	conv := NewConversation(NewProviderFromTrace(trace), &llm.FullAIConversationConfig{Trace: recorder})
+	conv.SetToolAdapter(adapter)
+
+	result, err := conv.Execute(context.Background(), filepath.Join(dir, "input.png"), 5, "")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result != videoPath {
+		t.Errorf("Expected reported video %s, got %s", videoPath, result)
+	}
+	if !reflect.DeepEqual(imagesorcery.calls, []string{"fill"}) || !reflect.DeepEqual(video.calls, []string{"generate_animation_from_image"}) {
+		t.Errorf("Unexpected replayed calls: imagesorcery=%v video=%v", imagesorcery.calls, video.calls)
+	}
+
+	metrics := conv.GetMetrics()
+	if metrics.Rounds != 2 || metrics.ToolCalls != 3 || metrics.TokensUsed != 330 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+	wantRounds := []llm.RoundMetric{
+		{Round: 1, InputTokens: 100, OutputTokens: 10, ToolCalls: []string{"imagesorcery__fill"}},
+		{Round: 2, InputTokens: 200, OutputTokens: 20, ToolCalls: []string{"video__generate_animation_from_image", llm.ReportResultToolName}},
+	}
+	if len(metrics.RoundMetrics) != len(wantRounds) {
+		t.Fatalf("Expected %d round metrics, got %d", len(wantRounds), len(metrics.RoundMetrics))
+	}
+	for i, want := range wantRounds {
+		got := metrics.RoundMetrics[i]
+		got.Duration = 0
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Round %d = %+v, expected %+v", i+1, got, want)
+		}
+	}
+}
+
+// TestConversationRecordedFailure verifies a trace that ended in an error replays as one
+func TestConversationRecordedFailure(t *testing.T) {
+	trace := &llm.Trace{
+		Turns: []llm.TraceTurn{{Text: "thinking"}},
+		Error: "exceeded max rounds: 20",
+	}
+
+	conv := NewConversation(NewProviderFromTrace(trace), &llm.FullAIConversationConfig{})
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{}))
+
+	if _, err := conv.Execute(context.Background(), "input.png", 5, ""); err == nil {
+		t.Fatal("Expected recorded error to be returned")
+	}
+}
+
+// TestConversationDescribeTool verifies describe_tool calls are counted in the metrics
+// and answered by the adapter without reaching an MCP server
+func TestConversationDescribeTool(t *testing.T) {
+	dir := t.TempDir()
+	trace := &llm.Trace{
+		Turns: []llm.TraceTurn{
+			{InputTokens: 100, OutputTokens: 10, ToolCalls: []llm.TraceToolCall{
+				{Name: llm.DescribeToolName, Arguments: map[string]interface{}{"name": "imagesorcery__fill"}},
+			}},
+			{InputTokens: 200, OutputTokens: 20, ToolCalls: []llm.TraceToolCall{
+				{Name: "imagesorcery__fill", Arguments: map[string]interface{}{"output_path": filepath.Join(dir, "seg.png")}},
+			}},
+		},
+	}
+
+	imagesorcery := &recordingMCPClient{}
+	adapter := llm.NewToolAdapter(map[string]client.MCPClient{"imagesorcery": imagesorcery})
+	adapter.SetPathRoots(dir)
+	adapter.SetLazySchemas(true)
+
+	conv := NewConversation(NewProviderFromTrace(trace), &llm.FullAIConversationConfig{})
+	conv.SetToolAdapter(adapter)
+	if _, err := conv.Execute(context.Background(), filepath.Join(dir, "input.png"), 5, ""); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(imagesorcery.calls, []string{"fill"}) {
+		t.Errorf("Expected only fill to reach the server, got %v", imagesorcery.calls)
+	}
+	metrics := conv.GetMetrics()
+	if metrics.ToolCalls != 2 || !reflect.DeepEqual(metrics.RoundMetrics[0].ToolCalls, []string{llm.DescribeToolName}) {
+		t.Errorf("Expected %s counted as a tool call, got %+v", llm.DescribeToolName, metrics)
+	}
+}
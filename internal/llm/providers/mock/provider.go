@@ -0,0 +1,46 @@
+package mock
+
+import (
+	"fmt"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Provider implements llm.Provider by replaying a recorded conversation trace.
+// It makes no API calls, so full AI pipeline changes can be tested deterministically.
+type Provider struct {
+	trace *llm.Trace
+}
+
+// NewProvider creates a provider that replays the trace file in config
+func NewProvider(config types.MockConfig) (*Provider, error) {
+	if config.TraceFile == "" {
+		return nil, fmt.Errorf("mock provider requires llm.mock.trace_file")
+	}
+	trace, err := llm.LoadTrace(config.TraceFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewProviderFromTrace(trace), nil
+}
+
+// NewProviderFromTrace creates a provider that replays an in-memory trace
+func NewProviderFromTrace(trace *llm.Trace) *Provider {
+	return &Provider{trace: trace}
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return "mock"
+}
+
+// IsEnabled returns true; a mock provider needs no credentials
+func (p *Provider) IsEnabled() bool {
+	return true
+}
+
+// CreateConversation creates a conversation that replays the trace
+func (p *Provider) CreateConversation(config *llm.FullAIConversationConfig) (llm.Conversation, error) {
+	return NewConversation(p, config), nil
+}
@@ -0,0 +1,41 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+)
+
+// Ask answers a single question with the provider's model, without tools
+func (p *Provider) Ask(ctx context.Context, question string) (*llm.Advice, error) {
+	request := openai.ChatCompletionRequest{
+		Model:               p.model,
+		MaxCompletionTokens: llm.MaxAdviceTokens,
+		Messages:            []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: question}},
+	}
+	var resp openai.ChatCompletionResponse
+	err := llm.CallWithRetry(ctx, "OpenAI", func() error {
+		var err error
+		resp, err = p.client.CreateChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API error: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in OpenAI response")
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = p.model
+	}
+	return &llm.Advice{
+		Text:         resp.Choices[0].Message.Content,
+		Model:        model,
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/llm/llmtest"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestHistoryCompactionKeepsToolPairs verifies compaction only rewrites tool message
+// content: every tool call is still followed by a tool message with its ID
+func TestHistoryCompactionKeepsToolPairs(t *testing.T) {
+	conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{
+		HistoryCompaction: types.HistoryCompactionConfig{AfterRound: 2, KeepRounds: 1},
+	})
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+
+	for round := 1; round <= 3; round++ {
+		conv.rounds = round
+		var toolCalls []openai.ToolCall
+		for _, suffix := range []string{"a", "b"} {
+			toolCalls = append(toolCalls, openai.ToolCall{
+				ID:   fmt.Sprintf("call_%d%s", round, suffix),
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      "imagesorcery__fill",
+					Arguments: fmt.Sprintf(`{"output_path": "/tmp/%d%s.png"}`, round, suffix),
+				},
+			})
+		}
+		conv.messages = append(conv.messages, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			ToolCalls: toolCalls,
+		})
+		if err := conv.handleToolCalls(context.Background(), toolCalls); err != nil {
+			t.Fatalf("handleToolCalls failed: %v", err)
+		}
+	}
+	conv.compactor.Compact(conv.rounds)
+
+	round := 0
+	for i, message := range conv.messages {
+		if message.Role != openai.ChatMessageRoleAssistant {
+			continue
+		}
+		round++
+		for j, call := range message.ToolCalls {
+			result := conv.messages[i+1+j]
+			if result.Role != openai.ChatMessageRoleTool || result.ToolCallID != call.ID {
+				t.Fatalf("Round %d: call %s answered by %s message for %q", round, call.ID, result.Role, result.ToolCallID)
+			}
+			expected := fmt.Sprintf("/tmp/%d%c.png", round, 'a'+j)
+			if round < 3 {
+				expected = llm.ElidedResultText("imagesorcery__fill", round)
+			}
+			if result.Content != expected {
+				t.Errorf("Round %d: result %d is %q, want %q", round, j, result.Content, expected)
+			}
+		}
+	}
+	if round != 3 {
+		t.Errorf("Expected 3 assistant turns, got %d", round)
+	}
+}
+
+// TestToolResultsPerTurnLimit verifies calls beyond the per-turn limit aren't run but
+// still get a result, so the request stays valid
+func TestToolResultsPerTurnLimit(t *testing.T) {
+	conv := NewConversation(&Provider{}, &llm.FullAIConversationConfig{MaxToolResultsPerTurn: 2})
+	conv.SetToolAdapter(llm.NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &llmtest.EchoMCPClient{},
+	}))
+
+	var toolCalls []openai.ToolCall
+	for i := 1; i <= 4; i++ {
+		toolCalls = append(toolCalls, openai.ToolCall{
+			ID:   fmt.Sprintf("call_%d", i),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      "imagesorcery__fill",
+				Arguments: fmt.Sprintf(`{"output_path": "/tmp/%d.png"}`, i),
+			},
+		})
+	}
+	if err := conv.handleToolCalls(context.Background(), toolCalls); err != nil {
+		t.Fatalf("handleToolCalls failed: %v", err)
+	}
+
+	if len(conv.messages) < 4 {
+		t.Fatalf("Expected a tool message per call, got %d messages", len(conv.messages))
+	}
+	for i, call := range toolCalls {
+		message := conv.messages[i]
+		if message.Role != openai.ChatMessageRoleTool || message.ToolCallID != call.ID {
+			t.Fatalf("Call %s answered by %s message for %q", call.ID, message.Role, message.ToolCallID)
+		}
+		deferred := strings.HasPrefix(message.Content, "Not executed")
+		if deferred != (i >= 2) {
+			t.Errorf("Call %d: result %q, deferred = %v", i+1, message.Content, deferred)
+		}
+	}
+	if conv.toolCalls != 2 {
+		t.Errorf("Expected 2 tool calls to run, got %d", conv.toolCalls)
+	}
+}
@@ -26,6 +26,9 @@ func NewProvider(config types.OpenAIConfig) (*Provider, error) {
 	if config.Organization != "" {
 		clientConfig.OrgID = config.Organization
 	}
+	if httpClient := llm.NewHeaderClient(config.Headers); httpClient != nil {
+		clientConfig.HTTPClient = httpClient
+	}
 
 	return &Provider{
 		client:  openai.NewClientWithConfig(clientConfig),
@@ -17,18 +17,23 @@ type Conversation struct {
 	config      *llm.FullAIConversationConfig
 	toolAdapter *llm.ToolAdapter
 	messages    []openai.ChatCompletionMessage
+	rounds      int
 	toolCalls   int
 	tokensUsed  int
 	startTime   time.Time
+	roundStats  *llm.RoundTracker
+	compactor   *llm.HistoryCompactor
 }
 
 // NewConversation creates a new OpenRouter conversation
 func NewConversation(provider *Provider, config *llm.FullAIConversationConfig) *Conversation {
 	return &Conversation{
-		provider:  provider,
-		config:    config,
-		messages:  make([]openai.ChatCompletionMessage, 0),
-		startTime: time.Now(),
+		provider:   provider,
+		config:     config,
+		messages:   make([]openai.ChatCompletionMessage, 0),
+		startTime:  time.Now(),
+		roundStats: llm.NewModelRoundTracker("openrouter", provider.model),
+		compactor:  llm.NewHistoryCompactor(config.HistoryCompaction),
 	}
 }
 
@@ -43,7 +48,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 	log.Printf("[OpenRouter] User request: %s", userPrompt)
 
 	// 1. Read and encode image
-	imageBase64, _, err := llm.ReadAndEncodeImage(imagePath)
+	imageBase64, mediaType, err := llm.ReadAndEncodeImage(imagePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read image: %w", err)
 	}
@@ -59,7 +64,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 
 	// 4. Create system message
 	toolsDesc := c.toolAdapter.GetToolDescription()
-	systemPrompt := llm.CreateVideoGenerationPrompt(duration, imagePath, toolsDesc)
+	systemPrompt := llm.CreateVideoGenerationPrompt(duration, imagePath, toolsDesc, c.config.TempDir, c.config.OutputDir)
 	c.messages = append(c.messages, openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleSystem,
 		Content: systemPrompt,
@@ -72,13 +77,14 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 	} else {
 		initialPrompt = fmt.Sprintf("Please generate a %.1f-second animated video for this image.", duration)
 	}
+	c.config.Trace.RecordPrompts(systemPrompt, initialPrompt)
 	c.messages = append(c.messages, openai.ChatCompletionMessage{
 		Role: openai.ChatMessageRoleUser,
 		MultiContent: []openai.ChatMessagePart{
 			{
 				Type: openai.ChatMessagePartTypeImageURL,
 				ImageURL: &openai.ChatMessageImageURL{
-					URL: fmt.Sprintf("data:image/jpeg;base64,%s", imageBase64),
+					URL: llm.ImageDataURL(mediaType, imageBase64),
 				},
 			},
 			{
@@ -103,21 +109,40 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		}
 
 		// Call OpenRouter API (using OpenAI-compatible client)
-		resp, err := c.provider.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		c.compactor.Compact(c.rounds)
+		request := openai.ChatCompletionRequest{
 			Model:    c.provider.model,
 			Messages: c.messages,
 			Tools:    openaiTools,
+		}
+		var resp openai.ChatCompletionResponse
+		err := llm.CallWithRetry(ctx, "OpenRouter", func() error {
+			var err error
+			resp, err = c.provider.client.CreateChatCompletion(ctx, request)
+			return err
 		})
+		if dumpErr := c.config.Debug.Dump(round+1, request, resp, err); dumpErr != nil {
+			log.Printf("[OpenRouter] Warning: %v", dumpErr)
+		}
 
 		if err != nil {
 			return "", fmt.Errorf("OpenRouter API error at round %d: %w", round+1, err)
 		}
 
 		// Update metrics
+		c.rounds++
 		c.tokensUsed += resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+		c.roundStats.StartRound()
+		c.roundStats.AddUsage(resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 		log.Printf("[OpenRouter] Tokens: +%d input, +%d output (total: %d)",
 			resp.Usage.PromptTokens, resp.Usage.CompletionTokens, c.tokensUsed)
 
+		// Check cost limit
+		estimatedCost := c.roundStats.CostUSD()
+		if estimatedCost > c.config.MaxCostUSD {
+			return "", fmt.Errorf("exceeded cost limit: $%.4f", estimatedCost)
+		}
+
 		// Process response
 		if len(resp.Choices) == 0 {
 			return "", fmt.Errorf("no choices in response at round %d", round+1)
@@ -125,6 +150,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 
 		choice := resp.Choices[0]
 		c.messages = append(c.messages, choice.Message)
+		c.config.Trace.RecordTurn(choice.Message.Content, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 
 		// Check for tool calls
 		if len(choice.Message.ToolCalls) > 0 {
@@ -133,6 +159,10 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 			if err != nil {
 				log.Printf("[OpenRouter] Tool execution error: %v", err)
 			}
+			if reported := c.toolAdapter.ReportedResult(); reported != nil {
+				log.Println("[OpenRouter] Final result reported")
+				return reported.VideoPath, nil
+			}
 			continue
 		}
 
@@ -140,7 +170,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		switch choice.FinishReason {
 		case openai.FinishReasonStop:
 			log.Println("[OpenRouter] Conversation completed")
-			return choice.Message.Content, nil
+			return llm.StripBudgetStatus(choice.Message.Content), nil
 
 		case openai.FinishReasonLength:
 			return "", fmt.Errorf("hit max tokens at round %d", round+1)
@@ -151,7 +181,7 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 		default:
 			// Continue conversation
 			if choice.Message.Content != "" {
-				return choice.Message.Content, nil
+				return llm.StripBudgetStatus(choice.Message.Content), nil
 			}
 		}
 	}
@@ -162,9 +192,19 @@ func (c *Conversation) Execute(ctx context.Context, imagePath string, duration f
 // handleToolCalls processes tool execution requests
 func (c *Conversation) handleToolCalls(ctx context.Context, toolCalls []openai.ToolCall) error {
 	var toolMessages []openai.ChatCompletionMessage
+	turn := llm.NewToolTurn(c.config.MaxToolResultsPerTurn)
 
 	for _, toolCall := range toolCalls {
+		if turn.Defer() {
+			toolMessages = append(toolMessages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    turn.DeferredToolResultText(toolCall.Function.Name),
+				ToolCallID: toolCall.ID,
+			})
+			continue
+		}
 		c.toolCalls++
+		c.roundStats.AddToolCall(toolCall.Function.Name)
 		log.Printf("[OpenRouter] Tool Call #%d: %s", c.toolCalls, toolCall.Function.Name)
 
 		// Parse arguments
@@ -179,13 +219,16 @@ func (c *Conversation) handleToolCalls(ctx context.Context, toolCalls []openai.T
 
 		// Format result
 		if err != nil {
-			result = fmt.Sprintf("Error: %v", err)
 			log.Printf("[OpenRouter] Tool execution failed: %v", err)
 		} else {
 			log.Printf("[OpenRouter] Tool result: %d bytes", len(result))
 		}
 
 		// Add tool response message
+		messageIndex := len(c.messages) + len(toolMessages)
+		c.compactor.Track(c.rounds, toolCall.Function.Name, func(placeholder string) {
+			c.messages[messageIndex].Content = placeholder
+		})
 		toolMessages = append(toolMessages, openai.ChatCompletionMessage{
 			Role:       openai.ChatMessageRoleTool,
 			Content:    result,
@@ -193,8 +236,18 @@ func (c *Conversation) handleToolCalls(ctx context.Context, toolCalls []openai.T
 		})
 	}
 
-	// Add all tool responses to conversation
+	if deferred := turn.Deferred(); deferred > 0 {
+		log.Printf("[OpenRouter] Deferred %d tool calls beyond the limit of %d per turn", deferred, turn.Limit())
+	}
+
+	// Add all tool responses to conversation, followed by the budget reminder
 	c.messages = append(c.messages, toolMessages...)
+	if status := llm.FormatBudgetStatus(c.config.BudgetStatus, llm.NewBudgetSnapshot(c.config, c.rounds, c.tokensUsed, c.GetMetrics().CostUSD)); status != "" {
+		c.messages = append(c.messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: status,
+		})
+	}
 	return nil
 }
 
@@ -225,18 +278,9 @@ func (c *Conversation) convertToolsToOpenAIFormat(tools []llm.UnifiedTool) []ope
 	return openaiTools
 }
 
-// GetMetrics returns conversation metrics
-// Note: Cost is set to $0.00 as OpenRouter pricing varies by model
+// GetMetrics returns conversation metrics, at the list pricing of the upstream model
 func (c *Conversation) GetMetrics() llm.FullAIConversationMetrics {
-	duration := time.Since(c.startTime).Seconds()
-
-	return llm.FullAIConversationMetrics{
-		Rounds:     len(c.messages) / 2,
-		ToolCalls:  c.toolCalls,
-		TokensUsed: c.tokensUsed,
-		Duration:   duration,
-		CostUSD:    0.00, // OpenRouter pricing varies by model, not tracked
-	}
+	return c.roundStats.Metrics()
 }
 
 // GetState returns current state (for debugging)
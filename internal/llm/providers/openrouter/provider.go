@@ -1,7 +1,7 @@
 package openrouter
 
 import (
-	"net/http"
+	"maps"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
@@ -37,17 +37,13 @@ func NewProvider(config types.OpenRouterConfig) (*Provider, error) {
 	clientConfig := openai.DefaultConfig(config.APIKey)
 	clientConfig.BaseURL = openRouterBaseURL
 
-	// Create custom HTTP client with OpenRouter-specific headers
-	customClient := &http.Client{
-		Transport: &headerTransport{
-			Base: http.DefaultTransport,
-			Headers: map[string]string{
-				"HTTP-Referer": httpReferer,
-				"X-Title":      appTitle,
-			},
-		},
+	// Send the OpenRouter-specific headers, which configured headers may override
+	headers := map[string]string{
+		"HTTP-Referer": httpReferer,
+		"X-Title":      appTitle,
 	}
-	clientConfig.HTTPClient = customClient
+	maps.Copy(headers, config.Headers)
+	clientConfig.HTTPClient = llm.NewHeaderClient(headers)
 
 	return &Provider{
 		client:  openai.NewClientWithConfig(clientConfig),
@@ -71,19 +67,3 @@ func (p *Provider) IsEnabled() bool {
 func (p *Provider) CreateConversation(config *llm.FullAIConversationConfig) (llm.Conversation, error) {
 	return NewConversation(p, config), nil
 }
-
-// headerTransport adds custom headers to HTTP requests
-type headerTransport struct {
-	Base    http.RoundTripper
-	Headers map[string]string
-}
-
-func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Add custom headers to the request
-	for k, v := range t.Headers {
-		req.Header.Set(k, v)
-	}
-
-	// Delegate to base transport
-	return t.Base.RoundTrip(req)
-}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// ReportResultToolName is the synthetic tool the model calls to report the final video.
+// It is handled by ToolAdapter directly and never routed to an MCP server.
+const ReportResultToolName = "agent__report_result"
+
+// ReportedResult is the final result the model reported via ReportResultToolName
+type ReportedResult struct {
+	VideoPath        string // Path to the final video with music
+	Summary          string // Optional short description of what was produced
+	ImageDescription string // One-sentence description of the input image, sanitized
+}
+
+// reportResultTool returns the unified definition of the synthetic report tool
+func reportResultTool() UnifiedTool {
+	return UnifiedTool{
+		Name:        ReportResultToolName,
+		Description: "[agent] Report the final video once the workflow is complete. Calling this ends the conversation.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"video_path": map[string]interface{}{
+					"type":        "string",
+					"description": "Absolute path to the final video file with music",
+				},
+				"summary": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional one-line summary of the generated video",
+				},
+				"image_description": map[string]interface{}{
+					"type":        "string",
+					"description": "One sentence describing the input image (e.g. \"woman in red jacket laughing outdoors\")",
+				},
+			},
+			"required": []interface{}{"video_path", "image_description"},
+		},
+	}
+}
+
+// ReportedResult returns the result reported by the model, or nil if none was reported yet
+func (a *ToolAdapter) ReportedResult() *ReportedResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reportedResult
+}
+
+// handleReportResult records the final result reported by the model
+func (a *ToolAdapter) handleReportResult(arguments map[string]interface{}) (string, error) {
+	videoPath, _ := arguments["video_path"].(string)
+	if videoPath == "" {
+		return "", fmt.Errorf("video_path is required")
+	}
+
+	if _, err := os.Stat(videoPath); err != nil {
+		return "", fmt.Errorf("reported video not found: %w", err)
+	}
+
+	rawDescription, _ := arguments["image_description"].(string)
+	description := SanitizeDescription(rawDescription, MaxImageDescriptionLength)
+	if description == "" {
+		return "", fmt.Errorf("image_description is required: describe the input image in one sentence")
+	}
+
+	summary, _ := arguments["summary"].(string)
+	a.mu.Lock()
+	a.reportedResult = &ReportedResult{
+		VideoPath:        videoPath,
+		Summary:          summary,
+		ImageDescription: description,
+	}
+	a.mu.Unlock()
+
+	log.Printf("[Tool Adapter] Final result reported: %s", videoPath)
+	log.Printf("[Tool Adapter] Image description: %s", description)
+	return fmt.Sprintf("Result recorded: %s", videoPath), nil
+}
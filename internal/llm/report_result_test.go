@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+)
+
+// TestReportResultTool verifies the synthetic report tool records the final result locally
+func TestReportResultTool(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "final.mp4")
+	if err := os.WriteFile(videoPath, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to create video: %v", err)
+	}
+
+	adapter := NewToolAdapter(map[string]client.MCPClient{})
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	found := false
+	for _, tool := range tools {
+		if tool.Name == ReportResultToolName {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected %s in discovered tools", ReportResultToolName)
+	}
+
+	if adapter.ReportedResult() != nil {
+		t.Fatal("Expected no reported result before the tool is called")
+	}
+
+	_, err = adapter.ExecuteToolCall(context.Background(), ReportResultToolName, map[string]interface{}{
+		"video_path":        videoPath,
+		"summary":           "shake animation",
+		"image_description": "Woman in red jacket\nlaughing outdoors",
+	})
+	if err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+
+	reported := adapter.ReportedResult()
+	if reported == nil {
+		t.Fatal("Expected reported result")
+	}
+	if reported.VideoPath != videoPath {
+		t.Errorf("Expected video path %s, got %s", videoPath, reported.VideoPath)
+	}
+	if reported.Summary != "shake animation" {
+		t.Errorf("Expected summary 'shake animation', got %q", reported.Summary)
+	}
+	if reported.ImageDescription != "Woman in red jacket laughing outdoors" {
+		t.Errorf("Expected sanitized image description, got %q", reported.ImageDescription)
+	}
+}
+
+// TestReportResultToolErrors verifies invalid reports are returned to the model as errors
+func TestReportResultToolErrors(t *testing.T) {
+	videoPath := filepath.Join(t.TempDir(), "final.mp4")
+	if err := os.WriteFile(videoPath, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to create video: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+	}{
+		{
+			name:      "missing video path",
+			arguments: map[string]interface{}{},
+		},
+		{
+			name:      "nonexistent video",
+			arguments: map[string]interface{}{"video_path": "/nonexistent/final.mp4", "image_description": "a cat"},
+		},
+		{
+			name:      "missing image description",
+			arguments: map[string]interface{}{"video_path": videoPath},
+		},
+		{
+			name:      "blank image description",
+			arguments: map[string]interface{}{"video_path": videoPath, "image_description": " \n\t"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := NewToolAdapter(map[string]client.MCPClient{})
+
+			if _, err := adapter.ExecuteToolCall(context.Background(), ReportResultToolName, tt.arguments); err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if adapter.ReportedResult() != nil {
+				t.Error("Expected no reported result after a failed report")
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RoundMetric is the usage of one conversation round: a model response and the tool
+// calls it requested
+type RoundMetric struct {
+	Round        int      `json:"round"`
+	InputTokens  int      `json:"input_tokens"`
+	OutputTokens int      `json:"output_tokens"`
+	ToolCalls    []string `json:"tool_calls,omitempty"` // Tool names in call order
+	Duration     float64  `json:"duration"`             // seconds, until the next round started
+	CostUSD      float64  `json:"cost_usd"`             // Cumulative cost at the end of the round
+}
+
+// RoundTracker collects per-round metrics for a conversation. Providers call StartRound
+// when a model response arrives, then AddUsage and AddToolCall for that round.
+// Rounds cover the whole conversation: the first starts when the tracker is created
+// and each lasts until the next one starts.
+type RoundTracker struct {
+	pricing      ModelPricing
+	start        time.Time
+	roundStart   time.Time
+	rounds       []RoundMetric
+	inputTokens  int
+	outputTokens int
+	malformed    int
+	now          func() time.Time
+}
+
+// NewRoundTracker creates a tracker pricing every token at costPerToken USD
+func NewRoundTracker(costPerToken float64) *RoundTracker {
+	return NewPricedRoundTracker(ModelPricing{InputPerMTok: costPerToken * 1e6, OutputPerMTok: costPerToken * 1e6})
+}
+
+// NewModelRoundTracker creates a tracker priced like the cost estimate: at the model's
+// list pricing from PricingFor
+func NewModelRoundTracker(provider, model string) *RoundTracker {
+	return NewPricedRoundTracker(PricingFor(provider, model))
+}
+
+// NewPricedRoundTracker creates a tracker pricing input and output tokens separately
+func NewPricedRoundTracker(pricing ModelPricing) *RoundTracker {
+	t := &RoundTracker{pricing: pricing, now: time.Now}
+	t.start = t.now()
+	t.roundStart = t.start
+	return t
+}
+
+// StartRound begins a new round and closes the previous one
+func (t *RoundTracker) StartRound() {
+	now := t.now()
+	if len(t.rounds) > 0 {
+		t.rounds[len(t.rounds)-1].Duration = now.Sub(t.roundStart).Seconds()
+		t.roundStart = now
+	}
+	t.rounds = append(t.rounds, RoundMetric{Round: len(t.rounds) + 1, CostUSD: t.cost()})
+}
+
+// AddUsage adds token usage to the current round, starting one if none has
+func (t *RoundTracker) AddUsage(inputTokens, outputTokens int) {
+	round := t.current()
+	round.InputTokens += inputTokens
+	round.OutputTokens += outputTokens
+	t.inputTokens += inputTokens
+	t.outputTokens += outputTokens
+	round.CostUSD = t.cost()
+}
+
+// AddToolCall records a tool call in the current round, starting one if none has
+func (t *RoundTracker) AddToolCall(name string) {
+	round := t.current()
+	round.ToolCalls = append(round.ToolCalls, name)
+}
+
+// AddMalformedResponse counts a response the model had to be asked to repeat
+func (t *RoundTracker) AddMalformedResponse() {
+	t.malformed++
+}
+
+// Metrics returns the per-round breakdown and totals summed from it. The last round
+// is still open and lasts until now; without rounds, Duration is the time since the
+// tracker was created.
+func (t *RoundTracker) Metrics() FullAIConversationMetrics {
+	rounds := make([]RoundMetric, len(t.rounds))
+	copy(rounds, t.rounds)
+	if len(rounds) > 0 {
+		rounds[len(rounds)-1].Duration = t.now().Sub(t.roundStart).Seconds()
+	}
+
+	metrics := FullAIConversationMetrics{Rounds: len(rounds), MalformedResponses: t.malformed, RoundMetrics: rounds}
+	for _, round := range rounds {
+		metrics.ToolCalls += len(round.ToolCalls)
+		metrics.TokensUsed += round.InputTokens + round.OutputTokens
+		metrics.Duration += round.Duration
+		metrics.CostUSD = round.CostUSD
+	}
+	if len(rounds) == 0 {
+		metrics.Duration = t.now().Sub(t.start).Seconds()
+	}
+	return metrics
+}
+
+func (t *RoundTracker) current() *RoundMetric {
+	if len(t.rounds) == 0 {
+		t.StartRound()
+	}
+	return &t.rounds[len(t.rounds)-1]
+}
+
+// CostUSD returns the cost of every token used so far
+func (t *RoundTracker) CostUSD() float64 {
+	return t.cost()
+}
+
+func (t *RoundTracker) cost() float64 {
+	return (float64(t.inputTokens)*t.pricing.InputPerMTok + float64(t.outputTokens)*t.pricing.OutputPerMTok) / 1e6
+}
+
+// FormatRoundTable renders the per-round breakdown as a text table
+func FormatRoundTable(metrics FullAIConversationMetrics) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%5s %8s %8s %8s %10s  %s\n", "Round", "Input", "Output", "Seconds", "Cost", "Tools")
+	for _, round := range metrics.RoundMetrics {
+		fmt.Fprintf(&b, "%5d %8d %8d %8.2f %10s  %s\n", round.Round, round.InputTokens, round.OutputTokens,
+			round.Duration, fmt.Sprintf("$%.4f", round.CostUSD), strings.Join(round.ToolCalls, ", "))
+	}
+	fmt.Fprintf(&b, "%5s %8d tokens  %8.2f %10s  %d tool calls", "Total", metrics.TokensUsed,
+		metrics.Duration, fmt.Sprintf("$%.4f", metrics.CostUSD), metrics.ToolCalls)
+	if metrics.MalformedResponses > 0 {
+		fmt.Fprintf(&b, ", %d malformed responses repeated", metrics.MalformedResponses)
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRoundTrackerTotals verifies the totals equal the sums over the rounds
+func TestRoundTrackerTotals(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewRoundTracker(0.001)
+	tracker.now = func() time.Time { return now }
+	tracker.start, tracker.roundStart = now, now
+
+	rounds := []struct {
+		input, output int
+		tools         []string
+		elapsed       time.Duration
+	}{
+		{100, 10, []string{"imagesorcery__fill"}, 3 * time.Second},
+		{200, 20, []string{"yolo__detect", "video__generate_animation_from_image"}, 5 * time.Second},
+		{300, 30, nil, 2 * time.Second},
+	}
+	for _, round := range rounds {
+		now = now.Add(round.elapsed)
+		tracker.StartRound()
+		tracker.AddUsage(round.input, round.output)
+		for _, tool := range round.tools {
+			tracker.AddToolCall(tool)
+		}
+	}
+	now = now.Add(4 * time.Second)
+
+	metrics := tracker.Metrics()
+	if metrics.Rounds != len(metrics.RoundMetrics) {
+		t.Errorf("Rounds = %d, want %d", metrics.Rounds, len(metrics.RoundMetrics))
+	}
+
+	var tokens, toolCalls int
+	var duration float64
+	for i, round := range metrics.RoundMetrics {
+		if round.Round != i+1 {
+			t.Errorf("round %d numbered %d", i+1, round.Round)
+		}
+		tokens += round.InputTokens + round.OutputTokens
+		toolCalls += len(round.ToolCalls)
+		duration += round.Duration
+		if want := float64(tokens) * 0.001; math.Abs(round.CostUSD-want) > 1e-9 {
+			t.Errorf("round %d cumulative cost = %f, want %f", i+1, round.CostUSD, want)
+		}
+	}
+	if metrics.TokensUsed != tokens || metrics.TokensUsed != 660 {
+		t.Errorf("TokensUsed = %d, sum of rounds = %d", metrics.TokensUsed, tokens)
+	}
+	if metrics.ToolCalls != toolCalls || metrics.ToolCalls != 3 {
+		t.Errorf("ToolCalls = %d, sum of rounds = %d", metrics.ToolCalls, toolCalls)
+	}
+	if metrics.Duration != duration || metrics.Duration != 14 {
+		t.Errorf("Duration = %f, sum of rounds = %f", metrics.Duration, duration)
+	}
+	if last := metrics.RoundMetrics[len(metrics.RoundMetrics)-1]; metrics.CostUSD != last.CostUSD {
+		t.Errorf("CostUSD = %f, last round = %f", metrics.CostUSD, last.CostUSD)
+	}
+
+	table := FormatRoundTable(metrics)
+	if lines := strings.Split(table, "\n"); len(lines) != 5 {
+		t.Errorf("table has %d lines, want header, 3 rounds and total:\n%s", len(lines), table)
+	}
+	if !strings.Contains(table, "yolo__detect, video__generate_animation_from_image") {
+		t.Errorf("table is missing the round 2 tools:\n%s", table)
+	}
+}
+
+func TestRoundTrackerEmpty(t *testing.T) {
+	metrics := NewRoundTracker(0.001).Metrics()
+	if metrics.Rounds != 0 || len(metrics.RoundMetrics) != 0 || metrics.CostUSD != 0 {
+		t.Errorf("unexpected metrics: %+v", metrics)
+	}
+}
+
+// TestModelRoundTrackerPricing verifies input and output tokens are priced separately at
+// the model's list pricing, the same pricing the cost estimate uses
+func TestModelRoundTrackerPricing(t *testing.T) {
+	tracker := NewModelRoundTracker("anthropic", "claude-3-5-sonnet-20241022")
+	tracker.StartRound()
+	tracker.AddUsage(10000, 2000)
+
+	if cost := tracker.CostUSD(); math.Abs(cost-0.06) > 1e-9 {
+		t.Errorf("Expected $0.06 ($3/$15 per MTok), got $%f", cost)
+	}
+	if metrics := tracker.Metrics(); metrics.CostUSD != tracker.CostUSD() {
+		t.Errorf("Expected metrics cost $%f, got $%f", tracker.CostUSD(), metrics.CostUSD)
+	}
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// ToolSnapshot pins the tool set shown to the model. Servers holds each server's
+// tools exactly as ListTools returned them, which is what a loaded snapshot replays;
+// Tools is the resulting unified tool list, kept for review and diffing.
+type ToolSnapshot struct {
+	CreatedAt time.Time                 `json:"created_at"`
+	Separator string                    `json:"separator"`
+	Servers   map[string]SnapshotServer `json:"servers"`
+	Tools     []UnifiedTool             `json:"tools"`
+}
+
+// SnapshotServer is one MCP server's identity and tools at snapshot time
+type SnapshotServer struct {
+	Name    string       `json:"name,omitempty"`
+	Version string       `json:"version,omitempty"`
+	Tools   []types.Tool `json:"tools"`
+}
+
+// SetToolSnapshot makes discovery use the snapshot's tools instead of calling ListTools.
+// Tool calls are still routed to the live MCP clients. Must be called before discovery.
+func (a *ToolAdapter) SetToolSnapshot(snapshot *ToolSnapshot) {
+	a.snapshot = snapshot
+	if snapshot != nil && snapshot.Separator != "" && snapshot.Separator != a.separator {
+		log.Printf("[Tool Adapter] Warning: snapshot uses separator %q, adapter uses %q; tool names will differ",
+			snapshot.Separator, a.separator)
+	}
+}
+
+// Snapshot returns the discovered tool set, or an error before discovery
+func (a *ToolAdapter) Snapshot() (*ToolSnapshot, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.toolsCache == nil {
+		return nil, fmt.Errorf("tools have not been discovered yet")
+	}
+
+	snapshot := &ToolSnapshot{
+		CreatedAt: time.Now(),
+		Separator: a.separator,
+		Servers:   make(map[string]SnapshotServer, len(a.serverTools)),
+		Tools:     a.toolsCache,
+	}
+	for serverName, tools := range a.serverTools {
+		server := SnapshotServer{Tools: tools}
+		if mcpClient, ok := a.mcpClients[serverName]; ok && mcpClient != nil {
+			server.Name, server.Version = mcpClient.GetServerInfo()
+		} else if a.snapshot != nil {
+			pinned := a.snapshot.Servers[serverName]
+			server.Name, server.Version = pinned.Name, pinned.Version
+		}
+		snapshot.Servers[serverName] = server
+	}
+	return snapshot, nil
+}
+
+// discoveryServers returns the servers to discover tools from, in name order
+func (a *ToolAdapter) discoveryServers() []string {
+	var serverNames []string
+	if a.snapshot != nil {
+		for serverName := range a.snapshot.Servers {
+			serverNames = append(serverNames, serverName)
+		}
+	} else {
+		for serverName := range a.mcpClients {
+			serverNames = append(serverNames, serverName)
+		}
+	}
+	sort.Strings(serverNames)
+	return serverNames
+}
+
+// listServerTools returns a server's tools from the snapshot or its MCP client
+func (a *ToolAdapter) listServerTools(ctx context.Context, serverName string) ([]types.Tool, error) {
+	if a.snapshot != nil {
+		log.Printf("[Tool Adapter] Loading tools for %s from snapshot", serverName)
+		if _, ok := a.mcpClients[serverName]; !ok {
+			log.Printf("[Tool Adapter] Warning: snapshot server %s has no client; its tools cannot be called", serverName)
+		}
+		return a.snapshot.Servers[serverName].Tools, nil
+	}
+
+	log.Printf("[Tool Adapter] Discovering tools from %s...", serverName)
+	mcpClient := a.mcpClients[serverName]
+	if mcpClient == nil {
+		return nil, fmt.Errorf("no client")
+	}
+	return mcpClient.ListTools(ctx)
+}
+
+// Save writes the snapshot as JSON, replacing path atomically
+func (s *ToolSnapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tool snapshot: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tool snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save tool snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadToolSnapshot reads a snapshot written by ToolSnapshot.Save
+func LoadToolSnapshot(path string) (*ToolSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool snapshot: %w", err)
+	}
+
+	var snapshot ToolSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse tool snapshot: %w", err)
+	}
+	if len(snapshot.Servers) == 0 {
+		return nil, fmt.Errorf("tool snapshot %s has no servers", path)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestToolSnapshotRoundTrip(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &countingMCPClient{},
+	})
+	if _, err := adapter.Snapshot(); err == nil {
+		t.Fatal("expected an error before discovery")
+	}
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	snapshot, err := adapter.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tools.json")
+	if err := snapshot.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := LoadToolSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadToolSnapshot failed: %v", err)
+	}
+
+	server := loaded.Servers["imagesorcery"]
+	if server.Name != "replay" || server.Version != "1.0.0" {
+		t.Errorf("server info = %s %s, want replay 1.0.0", server.Name, server.Version)
+	}
+	if len(server.Tools) != 2 {
+		t.Errorf("snapshot has %d imagesorcery tools, want 2", len(server.Tools))
+	}
+	if len(loaded.Tools) != len(tools) {
+		t.Errorf("snapshot has %d unified tools, want %d", len(loaded.Tools), len(tools))
+	}
+}
+
+func TestLoadToolSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := &ToolSnapshot{}
+	emptyPath := filepath.Join(dir, "empty.json")
+	if err := empty.Save(emptyPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(dir, "missing.json")},
+		{"no servers", emptyPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadToolSnapshot(tt.path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// TestDiscoverFromSnapshot verifies a snapshot replaces ListTools while calls still
+// reach the live client
+func TestDiscoverFromSnapshot(t *testing.T) {
+	live := &countingMCPClient{}
+	live.results = map[string]*types.ToolCallResult{"fill": textResult("filled")}
+	adapter := NewToolAdapter(map[string]client.MCPClient{"imagesorcery": live})
+	adapter.SetToolSnapshot(&ToolSnapshot{
+		Servers: map[string]SnapshotServer{
+			"imagesorcery": {Tools: []types.Tool{
+				{Name: "fill", InputSchema: map[string]interface{}{"type": "object"}},
+			}},
+		},
+	})
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	if calls := live.listCalls.Load(); calls != 0 {
+		t.Errorf("ListTools called %d times, want 0", calls)
+	}
+
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	want := []string{"imagesorcery__fill", ReportResultToolName}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("tools = %v, want %v", names, want)
+	}
+
+	result, err := adapter.ExecuteToolCall(context.Background(), "imagesorcery__fill", nil)
+	if err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+	if result != "filled" {
+		t.Errorf("result = %q, want %q", result, "filled")
+	}
+}
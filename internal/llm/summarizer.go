@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/jsonpath"
+)
+
+// RawResultToolName is the synthetic tool the model calls to get a summarized tool
+// result in full. It is only offered when result summaries are enabled.
+const RawResultToolName = "agent__raw_result"
+
+// ToolResultSummarizer compresses a tool's raw text result for the model. It returns
+// false when it doesn't recognise the result, which is then passed through unchanged.
+type ToolResultSummarizer func(raw string) (string, bool)
+
+// summarizerRule applies a summarizer to tools matching a glob
+type summarizerRule struct {
+	pattern    string // Matched against "server__tool" whatever the separator
+	summarizer ToolResultSummarizer
+}
+
+// defaultSummarizers returns the built-in summarizers for verbose standard tools
+func defaultSummarizers() []summarizerRule {
+	return []summarizerRule{
+		{pattern: "*__detect", summarizer: summarizeDetections},
+		{pattern: "*__find", summarizer: summarizeDetections},
+		{pattern: "*__SearchRecordings", summarizer: summarizeRecordings},
+	}
+}
+
+// SetResultSummaries enables summarizing verbose tool results before they reach the model.
+// The raw results stay in the trace and can be fetched with RawResultToolName.
+// Must be called before discovery.
+func (a *ToolAdapter) SetResultSummaries(enabled bool) {
+	a.summarize = enabled
+}
+
+// RegisterSummarizer summarizes results of tools matching pattern, a glob matched against
+// "server__tool" whatever the separator (e.g. "imagesorcery__detect" or "*__find").
+// Registered summarizers take precedence over earlier ones and the built-ins.
+func (a *ToolAdapter) RegisterSummarizer(pattern string, summarizer ToolResultSummarizer) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid summarizer pattern %q: %w", pattern, err)
+	}
+	if summarizer == nil {
+		return fmt.Errorf("summarizer for %s is nil", pattern)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.summarizers = append([]summarizerRule{{pattern: pattern, summarizer: summarizer}}, a.summarizers...)
+	return nil
+}
+
+// rawResultTool returns the unified definition of the synthetic raw result tool
+func rawResultTool() UnifiedTool {
+	return UnifiedTool{
+		Name:        RawResultToolName,
+		Description: "[agent] Get the full output of a tool call whose result was summarized. Only call this when the summary lacks something you need.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"result_id": map[string]interface{}{
+					"type":        "string",
+					"description": "The result_id given in the summary",
+				},
+			},
+			"required": []interface{}{"result_id"},
+		},
+	}
+}
+
+// summarizeResult returns the summary of a tool result when a summarizer applies and
+// shortens it, storing the raw result for RawResultToolName. Otherwise result is returned.
+func (a *ToolAdapter) summarizeResult(toolName, result string) string {
+	if !a.summarize {
+		return result
+	}
+	serverName, mcpToolName, err := a.resolveToolName(toolName)
+	if err != nil {
+		return result
+	}
+	canonical := serverName + DefaultToolNameSeparator + mcpToolName
+
+	a.mu.Lock()
+	rules := a.summarizers
+	a.mu.Unlock()
+
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.pattern, canonical); !matched {
+			continue
+		}
+		summary, ok := rule.summarizer(result)
+		if !ok || len(summary) >= len(result) {
+			return result
+		}
+
+		a.mu.Lock()
+		a.rawResults = append(a.rawResults, result)
+		resultID := fmt.Sprintf("r%d", len(a.rawResults))
+		a.mu.Unlock()
+
+		log.Printf("[Tool Adapter] Summarized %s result: %d -> %d bytes (%s)", toolName, len(result), len(summary), resultID)
+		return fmt.Sprintf("%s\n[Summary of a %d-byte result. Call %s with result_id %q for the full output.]",
+			summary, len(result), RawResultToolName, resultID)
+	}
+	return result
+}
+
+// handleRawResult returns a stored raw result by the ID given in its summary
+func (a *ToolAdapter) handleRawResult(arguments map[string]interface{}) (string, error) {
+	resultID, _ := arguments["result_id"].(string)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var index int
+	if _, err := fmt.Sscanf(resultID, "r%d", &index); err != nil || index < 1 || index > len(a.rawResults) {
+		return "", fmt.Errorf("unknown result_id %q", resultID)
+	}
+	return a.rawResults[index-1], nil
+}
+
+// detectionListKeys are the fields holding the object list in detect and find results
+var detectionListKeys = []string{"detections", "found_objects"}
+
+// detectionGeometryKeys are per-object fields replaced by their point counts in summaries
+var detectionGeometryKeys = []string{"polygon", "mask", "segmentation"}
+
+// summarizeDetections keeps the count and each object's class, confidence and bounding
+// box from detect/find results, replacing polygons and masks with their point counts
+func summarizeDetections(raw string) (string, bool) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return "", false
+	}
+
+	for _, listKey := range detectionListKeys {
+		objects, ok := doc[listKey].([]interface{})
+		if !ok {
+			continue
+		}
+
+		summary := make(map[string]interface{})
+		for key, value := range doc {
+			switch value.(type) {
+			case string, float64, bool:
+				summary[key] = value
+			}
+		}
+		summary["count"] = len(objects)
+
+		compact := make([]interface{}, 0, len(objects))
+		for _, object := range objects {
+			fields, ok := object.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			kept := make(map[string]interface{}, len(fields))
+			for key, value := range fields {
+				kept[key] = value
+			}
+			for _, key := range detectionGeometryKeys {
+				if geometry, ok := kept[key].([]interface{}); ok {
+					delete(kept, key)
+					kept[key+"_points"] = len(geometry)
+				}
+			}
+			compact = append(compact, kept)
+		}
+		summary[listKey] = compact
+
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+	return "", false
+}
+
+// Epidemic Sound SearchRecordings fields kept in summaries
+var recordingSummaryFields = map[string]string{
+	"id":        "recording.id",
+	"title":     "recording.title",
+	"bpm":       "recording.bpm",
+	"url":       "recording.audioFile.lqmp3Url",
+	"hq_url":    "recording.audioFile.mp3Url",
+	"length_ms": "recording.length",
+}
+
+// summarizeRecordings keeps the count and each track's title, ID, tempo and audio URLs
+// from SearchRecordings results
+func summarizeRecordings(raw string) (string, bool) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return "", false
+	}
+	value, ok := jsonpath.Lookup(doc, "data.recordings.nodes")
+	if !ok {
+		return "", false
+	}
+	nodes, ok := value.([]interface{})
+	if !ok {
+		return "", false
+	}
+
+	tracks := make([]map[string]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		track := make(map[string]interface{})
+		for field, fieldPath := range recordingSummaryFields {
+			if value, ok := jsonpath.Lookup(node, fieldPath); ok && value != nil {
+				track[field] = value
+			}
+		}
+		tracks = append(tracks, track)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"count": len(tracks), "tracks": tracks})
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
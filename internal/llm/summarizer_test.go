@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestSummarizeDetections(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		ok       bool
+		expected string
+	}{
+		{
+			name:     "detect with masks",
+			raw:      `{"image_path": "/in.jpg", "detections": [{"class": "person", "confidence": 0.9, "bbox": [1, 2, 3, 4], "mask": [[1, 2], [3, 4], [5, 6]]}]}`,
+			ok:       true,
+			expected: `{"count":1,"detections":[{"bbox":[1,2,3,4],"class":"person","confidence":0.9,"mask_points":3}],"image_path":"/in.jpg"}`,
+		},
+		{
+			name:     "find with polygons",
+			raw:      `{"found_objects": [{"description": "person", "polygon": [[1, 2], [3, 4]]}, {"description": "dog", "polygon": [[5, 6]]}]}`,
+			ok:       true,
+			expected: `{"count":2,"found_objects":[{"description":"person","polygon_points":2},{"description":"dog","polygon_points":1}]}`,
+		},
+		{name: "no object list", raw: `{"output_path": "/out.png"}`},
+		{name: "not JSON", raw: "Found 2 objects"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, ok := summarizeDetections(tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%v, got %v", tt.ok, ok)
+			}
+			if summary != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, summary)
+			}
+		})
+	}
+}
+
+func TestSummarizeRecordings(t *testing.T) {
+	raw := `{"data": {"recordings": {"nodes": [{"recording": {"id": "7", "title": "Sunny", "bpm": 120, "length": 95000,
+		"moods": ["happy", "upbeat"], "audioFile": {"lqmp3Url": "https://cdn/lq.mp3", "mp3Url": "https://cdn/hq.mp3", "waveform": [1, 2, 3]}}}]}}}`
+
+	summary, ok := summarizeRecordings(raw)
+	if !ok {
+		t.Fatal("Expected SearchRecordings result to be summarized")
+	}
+	expected := `{"count":1,"tracks":[{"bpm":120,"hq_url":"https://cdn/hq.mp3","id":"7","length_ms":95000,"title":"Sunny","url":"https://cdn/lq.mp3"}]}`
+	if summary != expected {
+		t.Errorf("Expected %s, got %s", expected, summary)
+	}
+
+	if _, ok := summarizeRecordings(`{"data": {}}`); ok {
+		t.Error("Expected result without recordings to be passed through")
+	}
+}
+
+// TestResultSummaries verifies summarized results, raw_result lookups and custom summarizers
+func TestResultSummaries(t *testing.T) {
+	detect := `{"detections": [{"class": "person", "mask": [[1, 2], [3, 4], [5, 6], [7, 8]]}]}`
+	newAdapter := func() *ToolAdapter {
+		return NewToolAdapter(map[string]client.MCPClient{
+			"imagesorcery": &replayMCPClient{results: map[string]*types.ToolCallResult{
+				"detect": textResult(detect),
+				"fill":   textResult(`{"output_path": "/out.png"}`),
+			}},
+		})
+	}
+	ctx := context.Background()
+
+	t.Run("disabled", func(t *testing.T) {
+		adapter := newAdapter()
+		tools, err := adapter.DiscoverAndConvertTools(ctx)
+		if err != nil {
+			t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+		}
+		for _, tool := range tools {
+			if tool.Name == RawResultToolName {
+				t.Error("Expected raw_result tool to be offered only with summaries enabled")
+			}
+		}
+		result, err := adapter.ExecuteToolCall(ctx, "imagesorcery__detect", nil)
+		if err != nil || result != detect {
+			t.Errorf("Expected raw result, got %q (err: %v)", result, err)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		adapter := newAdapter()
+		adapter.SetResultSummaries(true)
+		tools, err := adapter.DiscoverAndConvertTools(ctx)
+		if err != nil {
+			t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+		}
+		if tools[len(tools)-1].Name != RawResultToolName {
+			t.Errorf("Expected raw_result tool to be offered, got %s last", tools[len(tools)-1].Name)
+		}
+
+		result, err := adapter.ExecuteToolCall(ctx, "imagesorcery__detect", nil)
+		if err != nil {
+			t.Fatalf("ExecuteToolCall failed: %v", err)
+		}
+		if !strings.Contains(result, `"mask_points":4`) || !strings.Contains(result, `result_id "r1"`) {
+			t.Errorf("Expected summary with a result_id, got %q", result)
+		}
+
+		raw, err := adapter.ExecuteToolCall(ctx, RawResultToolName, map[string]interface{}{"result_id": "r1"})
+		if err != nil || raw != detect {
+			t.Errorf("Expected raw_result to return the raw output, got %q (err: %v)", raw, err)
+		}
+		if _, err := adapter.ExecuteToolCall(ctx, RawResultToolName, map[string]interface{}{"result_id": "r2"}); err == nil {
+			t.Error("Expected unknown result_id to fail")
+		}
+
+		fill, err := adapter.ExecuteToolCall(ctx, "imagesorcery__fill", nil)
+		if err != nil || fill != `{"output_path": "/out.png"}` {
+			t.Errorf("Expected unsummarized fill result, got %q (err: %v)", fill, err)
+		}
+	})
+
+	t.Run("registered summarizer takes precedence", func(t *testing.T) {
+		adapter := newAdapter()
+		adapter.SetResultSummaries(true)
+		err := adapter.RegisterSummarizer("imagesorcery__detect", func(raw string) (string, bool) {
+			return "people", true
+		})
+		if err != nil {
+			t.Fatalf("RegisterSummarizer failed: %v", err)
+		}
+		if _, err := adapter.DiscoverAndConvertTools(ctx); err != nil {
+			t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+		}
+
+		result, err := adapter.ExecuteToolCall(ctx, "imagesorcery__detect", nil)
+		if err != nil || !strings.HasPrefix(result, "people\n") {
+			t.Errorf("Expected custom summary, got %q (err: %v)", result, err)
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if err := newAdapter().RegisterSummarizer("[", summarizeDetections); err == nil {
+			t.Error("Expected invalid pattern to be rejected")
+		}
+	})
+}
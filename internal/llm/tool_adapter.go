@@ -4,61 +4,281 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/zhe.chen/agent-funpic-act/internal/activity"
 	"github.com/zhe.chen/agent-funpic-act/internal/client"
 	"github.com/zhe.chen/agent-funpic-act/pkg/types"
 )
 
+// DefaultToolNameSeparator joins the server name and tool name in prefixed tool names
+const DefaultToolNameSeparator = "__"
+
+// toolRoute is the MCP server and tool a prefixed tool name refers to
+type toolRoute struct {
+	server string
+	tool   string
+}
+
 // ToolAdapter converts MCP tools to unified format for use with any LLM provider
 type ToolAdapter struct {
-	mcpClients map[string]client.MCPClient // server_name -> client
-	toolsCache []UnifiedTool               // cached unified tool definitions
+	discoverMu sync.Mutex // serializes discovery so concurrent callers discover once
+	mu         sync.Mutex // guards toolsCache, toolSchemas, toolRoutes, duplicateTools, serverTools, describedTools, reportedResult, observers, summarizers and rawResults
+
+	mcpClients  map[string]client.MCPClient       // server_name -> client
+	toolsCache  []UnifiedTool                     // cached unified tool definitions
+	toolSchemas map[string]map[string]interface{} // prefixed tool name -> input schema
+	toolRoutes  map[string]toolRoute              // prefixed tool name -> server and tool
+	separator   string                            // joins server and tool names
+	concurrency int                               // servers listed at once during discovery (0 = all)
+	pathRoots   []string                          // allowed roots for path arguments (first is the scratch dir)
+	exposed     map[string]map[string]bool        // server -> tools advertised to the model (absent = all)
+	trace       *TraceRecorder                    // records executed tool calls when set
+
+	duplicateTools map[string][]string // base tool name -> servers, for names exposed by several servers
+
+	snapshot    *ToolSnapshot           // when set, tools come from it instead of ListTools
+	serverTools map[string][]types.Tool // MCP tools per server as discovered, for snapshots
+
+	reportedResult *ReportedResult    // set when the model calls ReportResultToolName
+	observers      []ToolCallObserver // notified after each MCP tool call
+	normalizeArgs  bool               // coerce arguments to schema types before calling
+
+	outputPathRules []types.PathArgumentRule // arguments naming files tools write (nil = defaults)
+	allowAnyPath    bool                     // keep output paths outside the path roots
+
+	lazySchemas    bool                   // advertise tools without their schemas
+	describedTools map[string]UnifiedTool // full definitions of lazily advertised tools
+
+	summarize   bool             // summarize verbose results for the model
+	summarizers []summarizerRule // first match wins
+	rawResults  []string         // raw results of summarized calls; result_id "rN" is index N-1
 }
 
 // NewToolAdapter creates a new tool adapter
 func NewToolAdapter(clients map[string]client.MCPClient) *ToolAdapter {
 	return &ToolAdapter{
-		mcpClients: clients,
+		mcpClients:    clients,
+		toolSchemas:   make(map[string]map[string]interface{}),
+		toolRoutes:    make(map[string]toolRoute),
+		separator:     DefaultToolNameSeparator,
+		normalizeArgs: true,
+		summarizers:   defaultSummarizers(),
+	}
+}
+
+// SetToolNameSeparator sets the separator between server and tool names (default "__").
+// Must be called before discovery.
+func (a *ToolAdapter) SetToolNameSeparator(separator string) {
+	if separator == "" {
+		separator = DefaultToolNameSeparator
+	}
+	a.separator = separator
+}
+
+// SetExposedTools limits the tools advertised to the model to the listed ones, by server.
+// Servers without a list advertise all their tools. Unlisted tools are still routed
+// and can be called by name. Must be called before discovery.
+func (a *ToolAdapter) SetExposedTools(exposed map[string][]string) {
+	a.exposed = make(map[string]map[string]bool)
+	for serverName, tools := range exposed {
+		if len(tools) == 0 {
+			continue
+		}
+		a.exposed[serverName] = make(map[string]bool, len(tools))
+		for _, tool := range tools {
+			a.exposed[serverName][tool] = true
+		}
 	}
 }
 
 // DiscoverAndConvertTools discovers all MCP tools and converts them to unified format
+// Safe for concurrent use; only the first caller queries the MCP servers.
 func (a *ToolAdapter) DiscoverAndConvertTools(ctx context.Context) ([]UnifiedTool, error) {
-	if a.toolsCache != nil {
-		return a.toolsCache, nil
+	a.discoverMu.Lock()
+	defer a.discoverMu.Unlock()
+
+	if cached := a.cachedTools(); cached != nil {
+		return cached, nil
 	}
 
 	var unifiedTools []UnifiedTool
+	schemas := make(map[string]map[string]interface{})
+	routes := make(map[string]toolRoute)
 
-	// Discover tools from each MCP server
-	for serverName, mcpClient := range a.mcpClients {
-		log.Printf("[Tool Adapter] Discovering tools from %s...", serverName)
+	// Discover tools from all MCP servers concurrently, then merge them in server and
+	// tool name order so results are stable
+	serverNames := a.discoveryServers()
+	listings := a.listAllServerTools(ctx, serverNames)
 
-		// List available tools
-		tools, err := mcpClient.ListTools(ctx)
+	serverTools := make(map[string][]types.Tool)
+	providers := make(map[string][]string) // base tool name -> servers exposing it
+	for i, serverName := range serverNames {
+		tools, err := listings[i].tools, listings[i].err
 		if err != nil {
 			log.Printf("[Tool Adapter] Warning: Failed to list tools from %s: %v", serverName, err)
 			continue
 		}
+		tools = append([]types.Tool(nil), tools...)
+		sort.SliceStable(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
 
 		log.Printf("[Tool Adapter] Found %d tools from %s", len(tools), serverName)
-
-		// Convert each MCP tool to unified format
+		serverTools[serverName] = tools
 		for _, tool := range tools {
+			providers[tool.Name] = append(providers[tool.Name], serverName)
+		}
+	}
+
+	duplicates := make(map[string][]string)
+	for toolName, servers := range providers {
+		if len(servers) > 1 {
+			duplicates[toolName] = servers
+			log.Printf("[Tool Adapter] Warning: tool %s is provided by multiple servers: %s",
+				toolName, strings.Join(servers, ", "))
+		}
+	}
+
+	// Convert each MCP tool to unified format. Tools a server doesn't expose are routed
+	// but not advertised.
+	for _, serverName := range serverNames {
+		exposed, limited := a.exposed[serverName]
+		if limited {
+			log.Printf("[Tool Adapter] Advertising %d of %d tools from %s", countExposed(serverTools[serverName], exposed),
+				len(serverTools[serverName]), serverName)
+		}
+		for _, tool := range serverTools[serverName] {
 			unifiedTool := a.convertMCPToolToUnified(serverName, tool)
+			if existing, ok := routes[unifiedTool.Name]; ok {
+				log.Printf("[Tool Adapter] Warning: %s is ambiguous (%s.%s and %s.%s), skipping %s.%s",
+					unifiedTool.Name, existing.server, existing.tool, serverName, tool.Name, serverName, tool.Name)
+				continue
+			}
+			schemas[unifiedTool.Name] = tool.InputSchema
+			routes[unifiedTool.Name] = toolRoute{server: serverName, tool: tool.Name}
+			if limited && !exposed[tool.Name] {
+				continue
+			}
+			if servers, ok := duplicates[tool.Name]; ok {
+				unifiedTool.Description += duplicateToolNote(serverName, tool.Name, servers)
+			}
 			unifiedTools = append(unifiedTools, unifiedTool)
 		}
 	}
 
+	// Without schemas, tools are described on demand
+	var described map[string]UnifiedTool
+	if a.lazySchemas {
+		described = make(map[string]UnifiedTool, len(unifiedTools))
+		for i, tool := range unifiedTools {
+			described[tool.Name] = tool
+			unifiedTools[i] = lazyTool(tool)
+		}
+		unifiedTools = append(unifiedTools, describeToolTool())
+	}
+
+	// Synthetic tools for reporting the final result and expanding summaries
+	unifiedTools = append(unifiedTools, reportResultTool())
+	if a.summarize {
+		unifiedTools = append(unifiedTools, rawResultTool())
+	}
+
+	// Publish the complete result at once so readers never see a partial cache
+	a.mu.Lock()
 	a.toolsCache = unifiedTools
+	for name, schema := range schemas {
+		a.toolSchemas[name] = schema
+	}
+	for name, route := range routes {
+		a.toolRoutes[name] = route
+	}
+	a.duplicateTools = duplicates
+	a.serverTools = serverTools
+	a.describedTools = described
+	a.mu.Unlock()
+
 	log.Printf("[Tool Adapter] Total tools available: %d", len(unifiedTools))
 	return unifiedTools, nil
 }
 
+// SetDiscoveryConcurrency limits how many servers are listed at once during discovery.
+// 0 lists all servers at once; 1 lists them one after another. Must be called before discovery.
+func (a *ToolAdapter) SetDiscoveryConcurrency(concurrency int) {
+	a.concurrency = concurrency
+}
+
+// serverListing is the outcome of listing one server's tools
+type serverListing struct {
+	tools []types.Tool
+	err   error
+}
+
+// listAllServerTools lists the tools of each server concurrently, returning the
+// listings in serverNames order
+func (a *ToolAdapter) listAllServerTools(ctx context.Context, serverNames []string) []serverListing {
+	limit := a.concurrency
+	if limit <= 0 || limit > len(serverNames) {
+		limit = len(serverNames)
+	}
+
+	listings := make([]serverListing, len(serverNames))
+	slots := make(chan struct{}, max(limit, 1))
+	var wg sync.WaitGroup
+	for i, serverName := range serverNames {
+		wg.Add(1)
+		go func(i int, serverName string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			tools, err := a.listServerTools(ctx, serverName)
+			listings[i] = serverListing{tools: tools, err: err}
+		}(i, serverName)
+	}
+	wg.Wait()
+	return listings
+}
+
+// countExposed returns how many of tools are in exposed
+func countExposed(tools []types.Tool, exposed map[string]bool) int {
+	count := 0
+	for _, tool := range tools {
+		if exposed[tool.Name] {
+			count++
+		}
+	}
+	return count
+}
+
+// duplicateToolNote tells the model which server a tool name shared by several servers runs on
+func duplicateToolNote(serverName, toolName string, servers []string) string {
+	return fmt.Sprintf(" (Runs on the %s server. A different tool named %s is also provided by %s; choose by server.)",
+		serverName, toolName, strings.Join(otherServers(servers, serverName), ", "))
+}
+
+// otherServers returns servers without serverName
+func otherServers(servers []string, serverName string) []string {
+	var others []string
+	for _, other := range servers {
+		if other != serverName {
+			others = append(others, other)
+		}
+	}
+	return others
+}
+
+// cachedTools returns the discovered tools, or nil before discovery
+func (a *ToolAdapter) cachedTools() []UnifiedTool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.toolsCache
+}
+
 // convertMCPToolToUnified converts a single MCP tool to unified format
 func (a *ToolAdapter) convertMCPToolToUnified(serverName string, tool types.Tool) UnifiedTool {
 	// Prefix tool name with server name to avoid conflicts
-	toolName := fmt.Sprintf("%s__%s", serverName, tool.Name)
+	toolName := a.prefixedToolName(serverName, tool.Name)
 
 	// Add server context to description
 	description := fmt.Sprintf("[%s] %s", serverName, tool.Description)
@@ -70,10 +290,59 @@ func (a *ToolAdapter) convertMCPToolToUnified(serverName string, tool types.Tool
 	}
 }
 
-// ExecuteToolCall executes a Claude tool call by routing to the appropriate MCP client
+// SetTraceRecorder records every executed tool call, with its result and duration
+func (a *ToolAdapter) SetTraceRecorder(trace *TraceRecorder) {
+	a.trace = trace
+}
+
+// ExecuteToolCall executes a Claude tool call by routing to the appropriate MCP client.
+// With result summaries enabled, verbose results are summarized; the trace keeps them raw.
+// A failed call returns its error along with a ToolError JSON payload for the model as
+// the result.
 func (a *ToolAdapter) ExecuteToolCall(ctx context.Context, toolName string, arguments map[string]interface{}) (string, error) {
-	// Parse tool name: "server__tool"
-	serverName, mcpToolName, err := a.parseToolName(toolName)
+	result, err := a.executeAndTrace(ctx, toolName, arguments)
+	if err != nil {
+		return a.toolErrorResult(toolName, err), err
+	}
+	return a.summarizeResult(toolName, result), nil
+}
+
+// executeAndTrace executes a tool call and records it in the trace when one is set
+func (a *ToolAdapter) executeAndTrace(ctx context.Context, toolName string, arguments map[string]interface{}) (string, error) {
+	if a.trace == nil {
+		return a.executeToolCall(ctx, toolName, arguments)
+	}
+
+	// Record the arguments as the model sent them, before normalization and path rewriting
+	requested := make(map[string]interface{}, len(arguments))
+	for k, v := range arguments {
+		requested[k] = v
+	}
+	start := time.Now()
+	result, err := a.executeToolCall(ctx, toolName, arguments)
+	a.trace.RecordToolCall(toolName, requested, result, err, time.Since(start))
+	return result, err
+}
+
+// executeToolCall routes a tool call to the synthetic handler or its MCP client
+func (a *ToolAdapter) executeToolCall(ctx context.Context, toolName string, arguments map[string]interface{}) (string, error) {
+	// Synthetic tools are handled locally
+	if toolName == ReportResultToolName {
+		arguments, _, err := a.sanitizePathArguments(toolName, arguments)
+		if err != nil {
+			return "", err
+		}
+		return a.handleReportResult(arguments)
+	}
+	if toolName == RawResultToolName {
+		return a.handleRawResult(arguments)
+	}
+	if toolName == DescribeToolName {
+		return a.handleDescribeTool(arguments)
+	}
+
+	// Resolve tool name: "server__tool"
+	serverName, mcpToolName, err := a.resolveToolName(toolName)
 	if err != nil {
 		return "", err
 	}
@@ -86,6 +355,33 @@ func (a *ToolAdapter) ExecuteToolCall(ctx context.Context, toolName string, argu
 
 	log.Printf("[Tool Adapter] Executing %s.%s", serverName, mcpToolName)
 
+	arguments = a.normalizeArguments(toolName, arguments)
+	call := ObservedToolCall{
+		ToolName: toolName,
+		Server:   serverName,
+		Tool:     mcpToolName,
+		Started:  time.Now(),
+	}
+	call.ServerName, call.ServerVersion = mcpClient.GetServerInfo()
+	// A rejected path is reported to observers too, so the audit trail shows the attempt
+	call.Arguments, call.PathRewrites, call.Err = a.sanitizePathArguments(serverName+DefaultToolNameSeparator+mcpToolName, arguments)
+	if call.Err != nil {
+		call.Arguments = arguments
+		a.notifyObservers(call)
+		return "", call.Err
+	}
+
+	done := activity.Default.StartToolCall(activity.PipelineID(ctx), serverName, mcpToolName)
+	call.Started = time.Now()
+	call.Result, call.Err = a.callMCPTool(ctx, mcpClient, toolName, mcpToolName, call.Arguments)
+	done()
+	call.Duration = time.Since(call.Started)
+	a.notifyObservers(call)
+	return call.Result, call.Err
+}
+
+// callMCPTool invokes a tool on an MCP client and combines its text content
+func (a *ToolAdapter) callMCPTool(ctx context.Context, mcpClient client.MCPClient, toolName, mcpToolName string, arguments map[string]interface{}) (string, error) {
 	// Call MCP tool
 	result, err := mcpClient.CallTool(ctx, mcpToolName, arguments)
 	if err != nil {
@@ -105,11 +401,23 @@ func (a *ToolAdapter) ExecuteToolCall(ctx context.Context, toolName string, argu
 		return "", fmt.Errorf("tool returned no content")
 	}
 
-	// Combine all content blocks
+	// Combine all content blocks. Inline data, e.g. a generated image, is saved to the
+	// scratch directory and its path reported instead.
 	var resultText string
 	for _, block := range result.Content {
-		if block.Type == "text" {
+		switch {
+		case block.Type == "text":
 			resultText += block.Text
+		case block.Data != "":
+			saved, err := a.saveInlineContent(toolName, block)
+			if err != nil {
+				log.Printf("[Tool Adapter] Warning: %s: %v", toolName, err)
+				continue
+			}
+			if resultText != "" {
+				resultText += "\n"
+			}
+			resultText += saved
 		}
 	}
 
@@ -117,40 +425,87 @@ func (a *ToolAdapter) ExecuteToolCall(ctx context.Context, toolName string, argu
 	return resultText, nil
 }
 
-// parseToolName splits "server__tool" into ("server", "tool")
-func (a *ToolAdapter) parseToolName(toolName string) (string, string, error) {
-	// Find "__" separator
-	for i := 0; i < len(toolName)-1; i++ {
-		if toolName[i] == '_' && toolName[i+1] == '_' {
-			return toolName[:i], toolName[i+2:], nil
+// prefixedToolName joins a server and tool name with the configured separator
+func (a *ToolAdapter) prefixedToolName(serverName, toolName string) string {
+	return serverName + a.separator + toolName
+}
+
+// resolveToolName returns the server and MCP tool a prefixed name refers to.
+// Discovered tools are looked up directly, so server and tool names may contain the
+// separator. Names not seen during discovery fall back to the longest matching server prefix.
+func (a *ToolAdapter) resolveToolName(toolName string) (string, string, error) {
+	a.mu.Lock()
+	route, ok := a.toolRoutes[toolName]
+	a.mu.Unlock()
+	if ok {
+		return route.server, route.tool, nil
+	}
+
+	var serverName string
+	for name := range a.mcpClients {
+		prefix := name + a.separator
+		if strings.HasPrefix(toolName, prefix) && len(toolName) > len(prefix) && len(name) > len(serverName) {
+			serverName = name
 		}
 	}
-	return "", "", fmt.Errorf("invalid tool name format: %s (expected: server__tool)", toolName)
+	if serverName == "" {
+		return "", "", fmt.Errorf("unknown tool: %s (expected: server%stool)", toolName, a.separator)
+	}
+	return serverName, toolName[len(serverName)+len(a.separator):], nil
 }
 
 // GetToolDescription returns a human-readable description of all available tools
 func (a *ToolAdapter) GetToolDescription() string {
-	if a.toolsCache == nil {
+	tools := a.cachedTools()
+	if tools == nil {
 		return "No tools available"
 	}
 
-	desc := fmt.Sprintf("You have access to %d tools from MCP servers:\n\n", len(a.toolsCache))
+	desc := fmt.Sprintf("You have access to %d tools from MCP servers:\n\n", len(tools))
+
+	a.mu.Lock()
+	duplicates := a.duplicateTools
+	a.mu.Unlock()
 
 	// Group by server
 	servers := make(map[string][]string)
-	for _, tool := range a.toolsCache {
-		serverName, mcpName, _ := a.parseToolName(tool.Name)
-		servers[serverName] = append(servers[serverName], mcpName)
+	for _, tool := range tools {
+		if tool.Name == ReportResultToolName || tool.Name == DescribeToolName {
+			servers["agent"] = append(servers["agent"], strings.TrimPrefix(tool.Name, "agent__"))
+			continue
+		}
+		serverName, mcpName, err := a.resolveToolName(tool.Name)
+		if err != nil {
+			continue
+		}
+		entry := mcpName
+		if shared, ok := duplicates[mcpName]; ok {
+			entry = fmt.Sprintf("%s (call as %s; same name also on %s)", mcpName, tool.Name,
+				strings.Join(otherServers(shared, serverName), ", "))
+		}
+		if a.lazySchemas {
+			entry += ": " + strings.TrimPrefix(tool.Description, "["+serverName+"] ")
+		}
+		servers[serverName] = append(servers[serverName], entry)
+	}
+
+	serverNames := make([]string, 0, len(servers))
+	for server := range servers {
+		serverNames = append(serverNames, server)
 	}
+	sort.Strings(serverNames)
 
 	// Format description
-	for server, tools := range servers {
+	for _, server := range serverNames {
 		desc += fmt.Sprintf("**%s**:\n", server)
-		for _, tool := range tools {
+		for _, tool := range servers[server] {
 			desc += fmt.Sprintf("  - %s\n", tool)
 		}
 		desc += "\n"
 	}
+	if a.lazySchemas {
+		desc += fmt.Sprintf("Tool parameters are not listed. Call %s with a tool's name to get its parameters before you first call it.\n", DescribeToolName)
+	}
 
 	return desc
 }
@@ -0,0 +1,335 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// countingMCPClient counts ListTools calls and delays them to widen race windows
+type countingMCPClient struct {
+	replayMCPClient
+	listCalls atomic.Int32
+}
+
+func (c *countingMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	c.listCalls.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return []types.Tool{
+		{Name: "fill", InputSchema: map[string]interface{}{"type": "object"}},
+		{Name: "detect", InputSchema: map[string]interface{}{"type": "object"}},
+	}, nil
+}
+
+// TestDiscoverAndConvertToolsConcurrent verifies concurrent callers discover once and
+// all see the complete tool list (run with -race)
+func TestDiscoverAndConvertToolsConcurrent(t *testing.T) {
+	imagesorcery := &countingMCPClient{}
+	video := &countingMCPClient{}
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": imagesorcery,
+		"video":        video,
+	})
+
+	const callers = 20
+	// 2 tools per server plus the synthetic report tool
+	const expectedTools = 5
+
+	var wg sync.WaitGroup
+	counts := make([]int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tools, err := adapter.DiscoverAndConvertTools(context.Background())
+			if err != nil {
+				t.Errorf("DiscoverAndConvertTools failed: %v", err)
+				return
+			}
+			counts[i] = len(tools)
+			adapter.GetToolDescription()
+			adapter.normalizeArguments("imagesorcery__fill", map[string]interface{}{"x": "1"})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, count := range counts {
+		if count != expectedTools {
+			t.Errorf("Caller %d saw %d tools, expected %d", i, count, expectedTools)
+		}
+	}
+	if calls := imagesorcery.listCalls.Load(); calls != 1 {
+		t.Errorf("Expected imagesorcery to be listed once, got %d", calls)
+	}
+	if calls := video.listCalls.Load(); calls != 1 {
+		t.Errorf("Expected video to be listed once, got %d", calls)
+	}
+}
+
+// inFlightMCPClient lists its tools slowly, tracking how many listings run at once
+type inFlightMCPClient struct {
+	replayMCPClient
+	tools    []types.Tool
+	err      error
+	inFlight *atomic.Int32
+	maxSeen  *atomic.Int32
+}
+
+func (c *inFlightMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	current := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		seen := c.maxSeen.Load()
+		if current <= seen || c.maxSeen.CompareAndSwap(seen, current) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return c.tools, c.err
+}
+
+// TestDiscoveryListsServersConcurrently verifies servers are listed in parallel up to
+// the configured limit, merged in server and tool name order, skipping failed servers
+func TestDiscoveryListsServersConcurrently(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		maxInFlight int32
+	}{
+		{concurrency: 0, maxInFlight: 4},
+		{concurrency: 2, maxInFlight: 2},
+		{concurrency: 1, maxInFlight: 1},
+	}
+
+	for _, tt := range tests {
+		var inFlight, maxSeen atomic.Int32
+		server := func(err error, names ...string) *inFlightMCPClient {
+			c := &inFlightMCPClient{err: err, inFlight: &inFlight, maxSeen: &maxSeen}
+			for _, name := range names {
+				c.tools = append(c.tools, types.Tool{Name: name})
+			}
+			return c
+		}
+		adapter := NewToolAdapter(map[string]client.MCPClient{
+			"yolo":         server(nil, "analyze_image_from_path"),
+			"imagesorcery": server(nil, "fill", "detect"),
+			"video":        server(nil, "animate"),
+			"music":        server(errors.New("connection refused")),
+		})
+		adapter.SetDiscoveryConcurrency(tt.concurrency)
+
+		tools, err := adapter.DiscoverAndConvertTools(context.Background())
+		if err != nil {
+			t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+		}
+		var names []string
+		for _, tool := range tools {
+			names = append(names, tool.Name)
+		}
+		expected := []string{"imagesorcery__detect", "imagesorcery__fill", "video__animate", "yolo__analyze_image_from_path", ReportResultToolName}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("Concurrency %d: expected tools %v, got %v", tt.concurrency, expected, names)
+		}
+		got := maxSeen.Load()
+		if got > tt.maxInFlight {
+			t.Errorf("Concurrency %d: expected at most %d listings at once, got %d", tt.concurrency, tt.maxInFlight, got)
+		}
+		if tt.maxInFlight > 1 && got < 2 {
+			t.Errorf("Concurrency %d: expected servers to be listed concurrently", tt.concurrency)
+		}
+	}
+}
+
+// TestExecuteToolCallRouting verifies prefixed names route to the right server when
+// server or tool names contain underscores or the separator itself
+func TestExecuteToolCallRouting(t *testing.T) {
+	newClients := func() map[string]client.MCPClient {
+		return map[string]client.MCPClient{
+			"image_sorcery": &replayMCPClient{results: map[string]*types.ToolCallResult{
+				"fill": textResult("image_sorcery.fill"),
+			}},
+			"my": &replayMCPClient{results: map[string]*types.ToolCallResult{
+				"crop": textResult("my.crop"),
+			}},
+			"my__server": &replayMCPClient{results: map[string]*types.ToolCallResult{
+				"fill":   textResult("my__server.fill"),
+				"_crop_": textResult("my__server._crop_"),
+			}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		separator string
+		toolName  string
+		expected  string
+	}{
+		{name: "single underscore server", toolName: "image_sorcery__fill", expected: "image_sorcery.fill"},
+		{name: "double underscore server", toolName: "my__server__fill", expected: "my__server.fill"},
+		{name: "tool with underscores", toolName: "my__server___crop_", expected: "my__server._crop_"},
+		{name: "custom separator", separator: "-", toolName: "my__server-fill", expected: "my__server.fill"},
+		{name: "prefix of another server", toolName: "my__crop", expected: "my.crop"},
+		{name: "custom separator prefix server", separator: "-", toolName: "my-crop", expected: "my.crop"},
+	}
+
+	for _, tt := range tests {
+		for _, discover := range []bool{true, false} {
+			name := tt.name + " (fallback)"
+			if discover {
+				name = tt.name + " (discovered)"
+			}
+			t.Run(name, func(t *testing.T) {
+				adapter := NewToolAdapter(newClients())
+				adapter.SetToolNameSeparator(tt.separator)
+				if discover {
+					if _, err := adapter.DiscoverAndConvertTools(context.Background()); err != nil {
+						t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+					}
+				}
+
+				result, err := adapter.ExecuteToolCall(context.Background(), tt.toolName, nil)
+				if err != nil {
+					t.Fatalf("ExecuteToolCall(%s) failed: %v", tt.toolName, err)
+				}
+				if result != tt.expected {
+					t.Errorf("ExecuteToolCall(%s) = %q, expected %q", tt.toolName, result, tt.expected)
+				}
+			})
+		}
+	}
+}
+
+// TestExecuteToolCallUnknownTool verifies names matching no server are rejected
+func TestExecuteToolCallUnknownTool(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"image_sorcery": &replayMCPClient{},
+	})
+
+	for _, name := range []string{"fill", "image__fill", "image_sorcery__"} {
+		if _, err := adapter.ExecuteToolCall(context.Background(), name, nil); err == nil {
+			t.Errorf("Expected error for %q", name)
+		}
+	}
+}
+
+// TestExposedTools verifies only a server's exposed tools reach the model's tool list and
+// description, while its other tools stay callable by name
+func TestExposedTools(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"music": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"SearchRecordings":  textResult("search"),
+			"DownloadRecording": textResult("download"),
+			"ListCollections":   textResult("collections"),
+		}},
+		"video": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"concatenate_videos": textResult("concat"),
+		}},
+	})
+	adapter.SetExposedTools(map[string][]string{"music": {"SearchRecordings"}, "video": nil})
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	expected := []string{"music__SearchRecordings", "video__concatenate_videos", ReportResultToolName}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected tools %v, got %v", expected, names)
+	}
+
+	description := adapter.GetToolDescription()
+	if strings.Contains(description, "DownloadRecording") || strings.Contains(description, "ListCollections") {
+		t.Errorf("Expected unexposed tools left out of the description, got:\n%s", description)
+	}
+
+	result, err := adapter.ExecuteToolCall(context.Background(), "music__DownloadRecording", nil)
+	if err != nil || result != "download" {
+		t.Errorf("Expected the unexposed tool to be callable, got %q, %v", result, err)
+	}
+}
+
+// TestResultExtractorCustomSeparator verifies the default "*__tool" rules still match
+// when tools are exposed with a different separator
+func TestResultExtractorCustomSeparator(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"image_sorcery": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"fill": textResult(`{"output_path": "/work/tmp/segmented.png"}`),
+		}},
+	})
+	adapter.SetToolNameSeparator(".")
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+	if tools[0].Name != "image_sorcery.fill" {
+		t.Fatalf("Expected tool name image_sorcery.fill, got %s", tools[0].Name)
+	}
+
+	fields := make(map[string]string)
+	adapter.AddObserver(NewResultExtractor(nil, func(field, value string, source *types.ToolProvenance) {
+		fields[field] = value
+	}).Observe)
+
+	if _, err := adapter.ExecuteToolCall(context.Background(), "image_sorcery.fill", nil); err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+	if got := fields[ResultFieldSegmentedImage]; got != "/work/tmp/segmented.png" {
+		t.Errorf("Expected segmented image path to be extracted, got %q", got)
+	}
+}
+
+// TestDuplicateToolNamesAnnotated verifies a base name exposed by several servers is
+// disambiguated in tool descriptions and the tool overview
+func TestDuplicateToolNamesAnnotated(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"detect": textResult("objects"),
+			"fill":   textResult("filled"),
+		}},
+		"yolo": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"detect": textResult("poses"),
+		}},
+	})
+
+	tools, err := adapter.DiscoverAndConvertTools(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverAndConvertTools failed: %v", err)
+	}
+
+	descriptions := make(map[string]string)
+	for _, tool := range tools {
+		descriptions[tool.Name] = tool.Description
+	}
+	if desc := descriptions["imagesorcery__detect"]; !strings.Contains(desc, "also provided by yolo") {
+		t.Errorf("Expected imagesorcery detect to mention yolo, got %q", desc)
+	}
+	if desc := descriptions["yolo__detect"]; !strings.Contains(desc, "also provided by imagesorcery") {
+		t.Errorf("Expected yolo detect to mention imagesorcery, got %q", desc)
+	}
+	if desc := descriptions["imagesorcery__fill"]; strings.Contains(desc, "also provided") {
+		t.Errorf("Expected unique tool to be unannotated, got %q", desc)
+	}
+
+	overview := adapter.GetToolDescription()
+	if !strings.Contains(overview, "detect (call as yolo__detect; same name also on imagesorcery)") {
+		t.Errorf("Expected overview to disambiguate detect, got:\n%s", overview)
+	}
+
+	// Both still route to their own server
+	for name, expected := range map[string]string{"imagesorcery__detect": "objects", "yolo__detect": "poses"} {
+		result, err := adapter.ExecuteToolCall(context.Background(), name, nil)
+		if err != nil || result != expected {
+			t.Errorf("ExecuteToolCall(%s) = %q, %v; expected %q", name, result, err, expected)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
+)
+
+// rpcInvalidParams is the JSON-RPC error code for arguments a tool rejected
+const rpcInvalidParams = -32602
+
+// fileNotFoundMarkers are the fragments of errors about a missing input file
+var fileNotFoundMarkers = []string{
+	"no such file",
+	"file not found",
+	"filenotfounderror",
+	"does not exist",
+	"cannot find the file",
+}
+
+// ToolError is the JSON payload returned to the model in place of a failed tool's
+// result. Hint says what to do about known failure classes; Retryable whether calling
+// the tool again unchanged may succeed.
+type ToolError struct {
+	Error     bool   `json:"error"`
+	Tool      string `json:"tool"`
+	Message   string `json:"message"`
+	Hint      string `json:"hint,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// JSON returns the payload as the tool result text
+func (e ToolError) JSON() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", e.Message)
+	}
+	return string(data)
+}
+
+// newToolError describes err from toolName for the model. schema is the tool's input
+// schema, nil if unknown; its required fields are listed for rejected arguments.
+func newToolError(toolName string, err error, schema map[string]interface{}) ToolError {
+	toolError := ToolError{
+		Error:     true,
+		Tool:      toolName,
+		Message:   err.Error(),
+		Retryable: retry.IsRetryable(err),
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case client.IsAuthError(err):
+		toolError.Hint = "This tool is unavailable: its server rejected the credentials. Don't call it again; continue without it."
+		toolError.Retryable = false
+	case isInvalidParams(err, message):
+		toolError.Hint = "The arguments don't match the tool's input schema."
+		if required := requiredFields(schema); len(required) > 0 {
+			toolError.Hint += " Required fields: " + strings.Join(required, ", ") + "."
+		}
+		toolError.Hint += " Fix the arguments and call it again."
+	case containsAny(message, fileNotFoundMarkers):
+		toolError.Hint = "A file was not found. Use absolute paths, and only paths of files that exist or that an earlier tool call reported writing."
+	}
+	return toolError
+}
+
+// isInvalidParams reports whether a tool rejected its arguments
+func isInvalidParams(err error, message string) bool {
+	var rpcErr interface{ RPCCode() int }
+	if errors.As(err, &rpcErr) && rpcErr.RPCCode() == rpcInvalidParams {
+		return true
+	}
+	return strings.Contains(message, fmt.Sprint(rpcInvalidParams)) || strings.Contains(message, "invalid params")
+}
+
+// requiredFields returns the sorted required fields of an input schema
+func requiredFields(schema map[string]interface{}) []string {
+	var required []string
+	switch fields := schema["required"].(type) {
+	case []string:
+		required = append(required, fields...)
+	case []interface{}:
+		for _, field := range fields {
+			if name, ok := field.(string); ok {
+				required = append(required, name)
+			}
+		}
+	}
+	sort.Strings(required)
+	return required
+}
+
+// containsAny reports whether s contains any of the fragments
+func containsAny(s string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(s, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolErrorResult returns the JSON payload the model receives for a failed call
+func (a *ToolAdapter) toolErrorResult(toolName string, err error) string {
+	a.mu.Lock()
+	schema := a.toolSchemas[toolName]
+	a.mu.Unlock()
+	return newToolError(toolName, err, schema).JSON()
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+)
+
+// TestNewToolError verifies each failure class gets its hint and retryable flag
+func TestNewToolError(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"output_path", "input_path"},
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		hint      string
+		retryable bool
+	}{
+		{name: "auth", err: errors.New("HTTP status 401: unauthorized"), hint: "unavailable"},
+		{name: "invalid params", err: fmt.Errorf("call failed: %w", &client.JSONRPCError{Code: -32602, Message: "bad"}), hint: "Required fields: input_path, output_path."},
+		{name: "invalid params message", err: errors.New("Invalid params: missing input_path"), hint: "Required fields: input_path, output_path."},
+		{name: "file not found", err: errors.New("FileNotFoundError: /tmp/x.png"), hint: "absolute paths"},
+		{name: "timeout", err: context.DeadlineExceeded, retryable: true},
+		{name: "other", err: errors.New("tool crashed")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolError := newToolError("imagesorcery__fill", tt.err, schema)
+			if !toolError.Error || toolError.Tool != "imagesorcery__fill" || toolError.Message != tt.err.Error() {
+				t.Errorf("Unexpected payload %+v", toolError)
+			}
+			if tt.hint == "" && toolError.Hint != "" {
+				t.Errorf("Expected no hint, got %q", toolError.Hint)
+			}
+			if !strings.Contains(toolError.Hint, tt.hint) {
+				t.Errorf("Expected hint containing %q, got %q", tt.hint, toolError.Hint)
+			}
+			if toolError.Retryable != tt.retryable {
+				t.Errorf("Expected retryable %v, got %v", tt.retryable, toolError.Retryable)
+			}
+		})
+	}
+}
+
+// TestExecuteToolCallErrorPayload verifies a failed call returns the error as JSON
+func TestExecuteToolCallErrorPayload(t *testing.T) {
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"image_sorcery": &replayMCPClient{},
+	})
+
+	result, err := adapter.ExecuteToolCall(context.Background(), "fill", nil)
+	if err == nil {
+		t.Fatal("Expected error for an unknown tool")
+	}
+	var toolError ToolError
+	if jsonErr := json.Unmarshal([]byte(result), &toolError); jsonErr != nil {
+		t.Fatalf("Expected a JSON payload, got %q", result)
+	}
+	if !toolError.Error || toolError.Tool != "fill" || toolError.Message != err.Error() {
+		t.Errorf("Unexpected payload %+v", toolError)
+	}
+}
@@ -0,0 +1,54 @@
+package llm
+
+import "fmt"
+
+// DefaultMaxToolResultsPerTurn caps the tool calls executed from one model response
+const DefaultMaxToolResultsPerTurn = 8
+
+// ToolTurn limits the tool calls executed in answer to one model response, so a wide
+// fan-out doesn't feed every result back at once. Calls beyond the limit are deferred:
+// they are answered with DeferredToolResultText instead of being run, so every call
+// keeps its paired result and the model can repeat them in its next turn.
+type ToolTurn struct {
+	limit    int // 0 = no limit
+	executed int
+	deferred int
+}
+
+// NewToolTurn starts a turn from the configured limit: 0 uses
+// DefaultMaxToolResultsPerTurn and a negative limit disables it
+func NewToolTurn(limit int) *ToolTurn {
+	switch {
+	case limit == 0:
+		limit = DefaultMaxToolResultsPerTurn
+	case limit < 0:
+		limit = 0
+	}
+	return &ToolTurn{limit: limit}
+}
+
+// Defer reports whether the next tool call of the turn must be deferred. Calls are
+// counted as executed until the limit is reached.
+func (t *ToolTurn) Defer() bool {
+	if t.limit > 0 && t.executed >= t.limit {
+		t.deferred++
+		return true
+	}
+	t.executed++
+	return false
+}
+
+// Deferred returns the number of calls deferred so far
+func (t *ToolTurn) Deferred() int {
+	return t.deferred
+}
+
+// Limit returns the number of calls executed per turn, 0 when unlimited
+func (t *ToolTurn) Limit() int {
+	return t.limit
+}
+
+// DeferredToolResultText is the result sent in place of a deferred call to toolName
+func (t *ToolTurn) DeferredToolResultText(toolName string) string {
+	return fmt.Sprintf("Not executed: at most %d tool calls are run per turn. Call %s again in your next turn if you still need it.", t.limit, toolName)
+}
@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolTurn(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		calls    int
+		deferred int
+	}{
+		{"default limit", 0, DefaultMaxToolResultsPerTurn + 3, 3},
+		{"within limit", 4, 4, 0},
+		{"custom limit", 2, 5, 3},
+		{"unlimited", -1, 50, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turn := NewToolTurn(tt.limit)
+			deferred := 0
+			for i := 0; i < tt.calls; i++ {
+				if turn.Defer() {
+					deferred++
+				} else if deferred > 0 {
+					t.Fatalf("Call %d ran after a deferred call", i+1)
+				}
+			}
+			if deferred != tt.deferred || turn.Deferred() != tt.deferred {
+				t.Errorf("Expected %d deferred calls, got %d (Deferred() = %d)", tt.deferred, deferred, turn.Deferred())
+			}
+		})
+	}
+
+	text := NewToolTurn(2).DeferredToolResultText("imagesorcery__fill")
+	if !strings.Contains(text, "at most 2 tool calls") || !strings.Contains(text, "imagesorcery__fill") {
+		t.Errorf("Expected the limit and the tool in the deferred result, got %q", text)
+	}
+}
@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Trace is a recorded full AI conversation. It can be written to a file and replayed
+// by the mock provider to test pipeline changes without calling a real model.
+type Trace struct {
+	Provider     string      `json:"provider"`
+	StartedAt    time.Time   `json:"started_at"`
+	ImagePath    string      `json:"image_path"`
+	Duration     float64     `json:"duration"`
+	SystemPrompt string      `json:"system_prompt,omitempty"`
+	UserPrompt   string      `json:"user_prompt,omitempty"`
+	Turns        []TraceTurn `json:"turns"`
+	FinalOutput  string      `json:"final_output,omitempty"`
+	Error        string      `json:"error,omitempty"`
+
+	Metrics FullAIConversationMetrics `json:"metrics"`
+}
+
+// TraceTurn is one model response and the tool calls it requested
+type TraceTurn struct {
+	ElapsedMS    int64           `json:"elapsed_ms"` // Time since the conversation started
+	Text         string          `json:"text,omitempty"`
+	InputTokens  int             `json:"input_tokens"`
+	OutputTokens int             `json:"output_tokens"`
+	ToolCalls    []TraceToolCall `json:"tool_calls,omitempty"`
+}
+
+// TraceToolCall is a tool call as requested by the model and its outcome
+type TraceToolCall struct {
+	Name       string                 `json:"name"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	Result     string                 `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+}
+
+// TraceRecorder builds a Trace as a conversation runs. All methods are safe for
+// concurrent use and do nothing on a nil recorder, so callers need no checks.
+type TraceRecorder struct {
+	mu     sync.Mutex
+	trace  Trace
+	onTurn func(round int, turn TraceTurn) // Called after each recorded turn
+}
+
+// NewTraceRecorder starts recording a conversation
+func NewTraceRecorder(provider, imagePath string, duration float64) *TraceRecorder {
+	return &TraceRecorder{
+		trace: Trace{
+			Provider:  provider,
+			StartedAt: time.Now(),
+			ImagePath: imagePath,
+			Duration:  duration,
+		},
+	}
+}
+
+// SetTurnObserver registers a function called with the 1-based round number after each
+// model response is recorded. Must be called before the conversation starts.
+func (r *TraceRecorder) SetTurnObserver(observer func(round int, turn TraceTurn)) {
+	if r == nil {
+		return
+	}
+	r.onTurn = observer
+}
+
+// RecordPrompts records the system prompt and the initial user message
+func (r *TraceRecorder) RecordPrompts(systemPrompt, userPrompt string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trace.SystemPrompt = systemPrompt
+	r.trace.UserPrompt = userPrompt
+}
+
+// RecordTurn records a model response; tool calls that follow are attached to it
+func (r *TraceRecorder) RecordTurn(text string, inputTokens, outputTokens int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	turn := TraceTurn{
+		ElapsedMS:    time.Since(r.trace.StartedAt).Milliseconds(),
+		Text:         text,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+	}
+	r.trace.Turns = append(r.trace.Turns, turn)
+	round := len(r.trace.Turns)
+	r.mu.Unlock()
+
+	if r.onTurn != nil {
+		r.onTurn(round, turn)
+	}
+}
+
+// RecordToolCall records an executed tool call on the latest turn
+func (r *TraceRecorder) RecordToolCall(name string, arguments map[string]interface{}, result string, err error, duration time.Duration) {
+	if r == nil {
+		return
+	}
+	call := TraceToolCall{
+		Name:       name,
+		Arguments:  arguments,
+		Result:     result,
+		DurationMS: duration.Milliseconds(),
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.trace.Turns) == 0 {
+		r.trace.Turns = append(r.trace.Turns, TraceTurn{ElapsedMS: time.Since(r.trace.StartedAt).Milliseconds()})
+	}
+	turn := &r.trace.Turns[len(r.trace.Turns)-1]
+	turn.ToolCalls = append(turn.ToolCalls, call)
+}
+
+// Finish records the conversation outcome and metrics
+func (r *TraceRecorder) Finish(output string, err error, metrics FullAIConversationMetrics) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trace.FinalOutput = output
+	if err != nil {
+		r.trace.Error = err.Error()
+	}
+	r.trace.Metrics = metrics
+}
+
+// Save writes the trace as JSON, replacing path atomically
+func (r *TraceRecorder) Save(path string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.trace, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save trace: %w", err)
+	}
+	return nil
+}
+
+// LoadTrace reads a trace written by TraceRecorder.Save
+func LoadTrace(path string) (*Trace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	var trace Trace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("failed to parse trace: %w", err)
+	}
+	return &trace, nil
+}
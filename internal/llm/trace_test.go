@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestTraceRecorderRoundTrip records turns and tool calls through the adapter and
+// checks the saved trace loads back unchanged
+func TestTraceRecorderRoundTrip(t *testing.T) {
+	trace := NewTraceRecorder("gemini", "/work/input.png", 5)
+	adapter := NewToolAdapter(map[string]client.MCPClient{
+		"imagesorcery": &replayMCPClient{results: map[string]*types.ToolCallResult{
+			"fill": textResult(`{"output_path": "/work/tmp/segmented.png"}`),
+		}},
+	})
+	adapter.SetTraceRecorder(trace)
+
+	trace.RecordPrompts("system prompt", "make it shake")
+	trace.RecordTurn("Segmenting first", 100, 20)
+	if _, err := adapter.ExecuteToolCall(context.Background(), "imagesorcery__fill", map[string]interface{}{"confidence": "0.3"}); err != nil {
+		t.Fatalf("ExecuteToolCall failed: %v", err)
+	}
+	adapter.ExecuteToolCall(context.Background(), "imagesorcery__missing", nil)
+	trace.RecordTurn("Done", 150, 10)
+	trace.Finish("/work/output/final.mp4", nil, FullAIConversationMetrics{Rounds: 2, ToolCalls: 2, TokensUsed: 280})
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := trace.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := LoadTrace(path)
+	if err != nil {
+		t.Fatalf("LoadTrace failed: %v", err)
+	}
+
+	if loaded.Provider != "gemini" || loaded.SystemPrompt != "system prompt" || loaded.UserPrompt != "make it shake" {
+		t.Errorf("Unexpected trace header: %+v", loaded)
+	}
+	if len(loaded.Turns) != 2 {
+		t.Fatalf("Expected 2 turns, got %d", len(loaded.Turns))
+	}
+
+	calls := loaded.Turns[0].ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 tool calls on the first turn, got %d", len(calls))
+	}
+	if calls[0].Name != "imagesorcery__fill" || calls[0].Error != "" {
+		t.Errorf("Unexpected first call: %+v", calls[0])
+	}
+	if calls[0].Arguments["confidence"] != "0.3" {
+		t.Errorf("Expected arguments as sent by the model, got %v", calls[0].Arguments)
+	}
+	if calls[0].Result != `{"output_path": "/work/tmp/segmented.png"}` {
+		t.Errorf("Unexpected result: %q", calls[0].Result)
+	}
+	if calls[1].Error == "" {
+		t.Error("Expected the failed call to record its error")
+	}
+	if loaded.Turns[1].InputTokens != 150 || len(loaded.Turns[1].ToolCalls) != 0 {
+		t.Errorf("Unexpected second turn: %+v", loaded.Turns[1])
+	}
+	if loaded.FinalOutput != "/work/output/final.mp4" || loaded.Metrics.TokensUsed != 280 {
+		t.Errorf("Unexpected outcome: %q, %+v", loaded.FinalOutput, loaded.Metrics)
+	}
+}
+
+func TestTraceRecorderNil(t *testing.T) {
+	var trace *TraceRecorder
+	trace.RecordPrompts("system", "user")
+	trace.RecordTurn("text", 1, 1)
+	trace.RecordToolCall("tool", nil, "", fmt.Errorf("failed"), 0)
+	trace.Finish("", nil, FullAIConversationMetrics{})
+	if err := trace.Save(filepath.Join(t.TempDir(), "trace.json")); err != nil {
+		t.Errorf("Expected nil recorder to be a no-op, got %v", err)
+	}
+}
@@ -81,14 +81,14 @@ type ToolResult struct {
 // UnifiedTool represents a provider-agnostic tool definition
 type UnifiedTool struct {
 	// Tool name
-	Name string
+	Name string `json:"name"`
 
 	// Tool description
-	Description string
+	Description string `json:"description"`
 
 	// Input parameters as JSON schema
 	// This is a map representing a JSON Schema object
-	Parameters map[string]interface{}
+	Parameters map[string]interface{} `json:"parameters"`
 }
 
 // NewTextMessage creates a simple text message
@@ -1,15 +1,20 @@
 package llm
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 )
 
-// ReadAndEncodeImage reads an image file and converts it to base64
+// ReadAndEncodeImage reads an image file and converts it to base64, returning it with
+// the media type sniffed from its content
 func ReadAndEncodeImage(imagePath string) (string, string, error) {
 	// Read image file
 	data, err := os.ReadFile(imagePath)
@@ -18,7 +23,10 @@ func ReadAndEncodeImage(imagePath string) (string, string, error) {
 	}
 
 	// Detect media type
-	mediaType := detectMediaType(imagePath)
+	mediaType, err := detectMediaType(imagePath, data)
+	if err != nil {
+		return "", "", err
+	}
 
 	// Encode to base64
 	encoded := base64.StdEncoding.EncodeToString(data)
@@ -26,6 +34,11 @@ func ReadAndEncodeImage(imagePath string) (string, string, error) {
 	return encoded, mediaType, nil
 }
 
+// ImageDataURL returns a base64 image as a data URL, as OpenAI-compatible APIs expect
+func ImageDataURL(mediaType, imageBase64 string) string {
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, imageBase64)
+}
+
 // CreateVisionMessage creates a Claude message with image and text
 func CreateVisionMessage(imageBase64, mediaType, prompt string) anthropic.MessageParam {
 	return anthropic.NewUserMessage(
@@ -34,29 +47,69 @@ func CreateVisionMessage(imageBase64, mediaType, prompt string) anthropic.Messag
 	)
 }
 
-// detectMediaType returns the media type based on file extension
-func detectMediaType(path string) string {
-	lower := strings.ToLower(path)
+// SupportedImageTypes are the image media types every vision provider accepts
+var SupportedImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// imageExtensions maps file extensions to media types, for content that can't be sniffed
+var imageExtensions = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+}
 
-	if strings.HasSuffix(lower, ".png") {
-		return "image/png"
-	}
-	if strings.HasSuffix(lower, ".jpg") || strings.HasSuffix(lower, ".jpeg") {
-		return "image/jpeg"
+// detectMediaType returns the media type of an image from its first 512 bytes, so a PNG
+// saved as .jpg is still declared image/png. The extension is used only when the content
+// is inconclusive. Types the providers reject, such as BMP and TIFF, are errors.
+func detectMediaType(path string, data []byte) (string, error) {
+	mediaType := http.DetectContentType(data[:min(len(data), 512)])
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+
+	// net/http doesn't sniff TIFF
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		mediaType = "image/tiff"
 	}
-	if strings.HasSuffix(lower, ".gif") {
-		return "image/gif"
+
+	if !strings.HasPrefix(mediaType, "image/") {
+		extType, ok := imageExtensions[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return "", fmt.Errorf("cannot determine the image type of %s (detected %s); supported formats: %s",
+				path, mediaType, strings.Join(SupportedImageTypes, ", "))
+		}
+		mediaType = extType
 	}
-	if strings.HasSuffix(lower, ".webp") {
-		return "image/webp"
+
+	if !slices.Contains(SupportedImageTypes, mediaType) {
+		return "", fmt.Errorf("image %s is %s, which the LLM providers don't accept; convert it to one of: %s",
+			path, mediaType, strings.Join(SupportedImageTypes, ", "))
 	}
+	return mediaType, nil
+}
 
-	// Default to JPEG
-	return "image/jpeg"
+// workingDirectoriesSection describes where the model should write files.
+// Empty directories fall back to the process working directory.
+func workingDirectoriesSection(tempDir, outputDir string) string {
+	if tempDir == "" {
+		tempDir = "the current working directory"
+	}
+	if outputDir == "" {
+		outputDir = tempDir
+	}
+	return fmt.Sprintf(`## Working Directories
+- **Scratch Directory**: %s
+  - Write ALL intermediate files (segmented images, animations, downloaded audio) here
+- **Output Directory**: %s
+  - Write the FINAL video with music here
+- Every file you create MUST be inside one of these directories; relative paths are resolved against the scratch directory, and output paths elsewhere are rejected`, tempDir, outputDir)
 }
 
-// CreateVideoGenerationPrompt creates a prompt for video generation task
-func CreateVideoGenerationPrompt(duration float64, imagePath string, toolsDescription string) string {
+// CreateVideoGenerationPrompt creates a prompt for video generation task.
+// tempDir and outputDir should be absolute; they tell the model where to create files.
+func CreateVideoGenerationPrompt(duration float64, imagePath string, toolsDescription string, tempDir string, outputDir string) string {
 	return fmt.Sprintf(`You are a video generation assistant. Your task is to analyze the provided image and **ACTUALLY GENERATE** a %.1f-second animated video file with background music.
 
 **CRITICAL REQUIREMENTS**:
@@ -71,6 +124,8 @@ func CreateVideoGenerationPrompt(duration float64, imagePath string, toolsDescri
 
 %s
 
+%s
+
 ## Required Workflow (Execute ALL steps)
 
 ### Step 0: Segment Person (Background Removal)
@@ -88,7 +143,7 @@ func CreateVideoGenerationPrompt(duration float64, imagePath string, toolsDescri
   - input_path: Use the absolute path above
   - areas: [{"polygon": <polygon from find>, "opacity": 0.0}]
   - invert_areas: true
-  - output_path: Create unique filename (e.g., "segmented_person_<timestamp>.png")
+  - output_path: Create unique filename in the scratch directory (e.g., "segmented_person_<timestamp>.png")
 - Save the segmented image path for use in Step 1
 - **IMPORTANT**: Use the segmented image (not the original) in subsequent steps
 
@@ -96,7 +151,7 @@ func CreateVideoGenerationPrompt(duration float64, imagePath string, toolsDescri
 - Use video__generate_animation_from_image to create the animation
 - Parameters:
   - image_path: Use the SEGMENTED image path from Step 0 (not the original image)
-  - output_video_path: Create a unique filename in the working directory (e.g., "animation_nod_<timestamp>.mp4")
+  - output_video_path: Create a unique filename in the scratch directory (e.g., "animation_nod_<timestamp>.mp4")
   - duration: %.1f
   - animation_type: Choose appropriate camera effect:
     * "rotate": Rotates entire image left-right (simulates head shake), intensity in degrees
@@ -119,14 +174,20 @@ func CreateVideoGenerationPrompt(duration float64, imagePath string, toolsDescri
 - Use video__add_audio_to_video or similar tool to combine:
   - Video: The animation video from Step 1
   - Audio: The downloaded music track
-  - Output: A final video file with music (e.g., "final_video_with_music_<timestamp>.mp4")
+  - Output: A final video file with music in the output directory (e.g., "final_video_with_music_<timestamp>.mp4")
+
+### Step 4: Report the Result
+- Call agent__report_result with video_path set to the absolute path of the final video
+- Set image_description to one sentence describing the image (e.g. "woman in red jacket laughing outdoors")
+- This ends the conversation; do not call any tools afterwards
 
 ## Important Notes
 
 - **File Paths**: All tool calls MUST use complete absolute paths
 - **Do NOT skip steps**: Music is REQUIRED, not optional
-- **Output**: Return the path to the final video file that includes both animation and music
+- **Output**: Report the final video (animation and music) with agent__report_result
 - **Error Handling**: If music search fails, try again once before giving up
+- **Tool Errors**: A failed tool call returns JSON with "error": true, the message, a "hint" on what to do and whether it is "retryable"
 
-Now, please begin executing ALL THREE STEPS in order.`, duration, imagePath, toolsDescription, duration)
+Now, please begin executing ALL STEPS in order.`, duration, imagePath, workingDirectoriesSection(tempDir, outputDir), toolsDescription, duration)
 }
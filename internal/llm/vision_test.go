@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encodedImages returns a 2x2 image in each format the standard library can write
+func encodedImages(t *testing.T) map[string][]byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	images := make(map[string][]byte)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	images["png"] = append([]byte(nil), buf.Bytes()...)
+
+	buf.Reset()
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode failed: %v", err)
+	}
+	images["jpeg"] = append([]byte(nil), buf.Bytes()...)
+
+	buf.Reset()
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("gif.Encode failed: %v", err)
+	}
+	images["gif"] = append([]byte(nil), buf.Bytes()...)
+
+	images["webp"] = []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00")
+	images["bmp"] = append([]byte("BM"), make([]byte, 64)...)
+	images["tiff"] = append([]byte("II*\x00"), make([]byte, 64)...)
+	images["unknown"] = make([]byte, 64)
+	return images
+}
+
+func TestReadAndEncodeImageSniffsContent(t *testing.T) {
+	images := encodedImages(t)
+
+	tests := []struct {
+		name      string
+		fileName  string
+		content   string
+		mediaType string
+		wantErr   string
+	}{
+		{name: "png saved as jpg", fileName: "photo.jpg", content: "png", mediaType: "image/png"},
+		{name: "jpeg saved as png", fileName: "photo.PNG", content: "jpeg", mediaType: "image/jpeg"},
+		{name: "gif without extension", fileName: "photo", content: "gif", mediaType: "image/gif"},
+		{name: "webp saved as jpeg", fileName: "photo.jpeg", content: "webp", mediaType: "image/webp"},
+		{name: "matching extension", fileName: "photo.png", content: "png", mediaType: "image/png"},
+		{name: "inconclusive falls back to extension", fileName: "photo.webp", content: "unknown", mediaType: "image/webp"},
+		{name: "bmp saved as jpg", fileName: "photo.jpg", content: "bmp", wantErr: "image/bmp"},
+		{name: "tiff saved as png", fileName: "photo.png", content: "tiff", wantErr: "image/tiff"},
+		{name: "inconclusive tiff extension", fileName: "scan.tif", content: "unknown", wantErr: "image/tiff"},
+		{name: "inconclusive without extension", fileName: "photo.dat", content: "unknown", wantErr: "cannot determine"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+"_"+tt.fileName)
+			if err := os.WriteFile(path, images[tt.content], 0644); err != nil {
+				t.Fatalf("Failed to write image: %v", err)
+			}
+
+			encoded, mediaType, err := ReadAndEncodeImage(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if !strings.Contains(err.Error(), "image/png") {
+					t.Errorf("Expected the error to list the supported formats, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadAndEncodeImage failed: %v", err)
+			}
+			if mediaType != tt.mediaType {
+				t.Errorf("Expected %s, got %s", tt.mediaType, mediaType)
+			}
+			if encoded != base64.StdEncoding.EncodeToString(images[tt.content]) {
+				t.Error("Expected the file content to be base64 encoded")
+			}
+		})
+	}
+}
+
+func TestImageDataURL(t *testing.T) {
+	if got := ImageDataURL("image/png", "AAAA"); got != "data:image/png;base64,AAAA" {
+		t.Errorf("Unexpected data URL %s", got)
+	}
+}
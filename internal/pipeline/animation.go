@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Animation types render_motion can produce
+const (
+	AnimationRotate = "rotate" // Rotates the image left-right, intensity in degrees
+	AnimationShake  = "shake"  // Moves the image left-right, intensity in pixels
+	AnimationNod    = "nod"    // Moves the image up-down, intensity in pixels
+	AnimationZoom   = "zoom"   // Zooms in and out, intensity as scale factor (0.1 = 10%)
+	AnimationCustom = "custom" // Runs the segment's own ffmpeg filter chain, intensity unused
+)
+
+// motionFPS is the frame rate of every rendered segment, so segments concatenate without re-encoding
+const motionFPS = 15
+
+// defaultAnimationIntensity is used for segments without an intensity
+var defaultAnimationIntensity = map[string]float64{
+	AnimationRotate: 10,
+	AnimationShake:  10,
+	AnimationNod:    10,
+	AnimationZoom:   0.1,
+}
+
+// ParseAnimationPlan parses a plan like "nod:5,zoom:5,shake:5". Each segment is
+// type:seconds with an optional :intensity. customFilter is the ffmpeg filter chain
+// of the plan's custom segments.
+func ParseAnimationPlan(spec, customFilter string) ([]types.AnimationSegment, error) {
+	var plan []types.AnimationSegment
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid animation segment %q (want type:seconds[:intensity])", part)
+		}
+
+		segment := types.AnimationSegment{Type: strings.TrimSpace(fields[0])}
+		duration, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in animation segment %q: %w", part, err)
+		}
+		segment.Duration = duration
+		if len(fields) == 3 {
+			intensity, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid intensity in animation segment %q: %w", part, err)
+			}
+			segment.Intensity = intensity
+		}
+		if segment.Type == AnimationCustom {
+			segment.CustomFilter = strings.TrimSpace(customFilter)
+		}
+		plan = append(plan, segment)
+	}
+
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("animation plan is empty")
+	}
+	if customFilter != "" && !slices.ContainsFunc(plan, func(segment types.AnimationSegment) bool {
+		return segment.Type == AnimationCustom
+	}) {
+		return nil, fmt.Errorf("a custom filter needs a custom segment in the animation plan, e.g. custom:5")
+	}
+	if _, err := normalizeAnimationPlan(plan, 0); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// normalizeAnimationPlan validates a plan, fills in default intensities and scales
+// the segment durations proportionally so they sum to total (0 keeps them as given)
+func normalizeAnimationPlan(plan []types.AnimationSegment, total float64) ([]types.AnimationSegment, error) {
+	normalized := make([]types.AnimationSegment, len(plan))
+	sum := 0.0
+	for i, segment := range plan {
+		intensity, ok := defaultAnimationIntensity[segment.Type]
+		if !ok && segment.Type != AnimationCustom {
+			return nil, fmt.Errorf("unknown animation type %q (supported: rotate, shake, nod, zoom, custom)", segment.Type)
+		}
+		if segment.Type == AnimationCustom {
+			if err := ValidateCustomFilter(segment.CustomFilter); err != nil {
+				return nil, fmt.Errorf("animation segment %d: %w", i+1, err)
+			}
+		} else if segment.CustomFilter != "" {
+			return nil, fmt.Errorf("animation segment %d (%s) sets a custom_filter, which only custom segments use", i+1, segment.Type)
+		}
+		if segment.Duration <= 0 {
+			return nil, fmt.Errorf("animation segment %d (%s) needs a positive duration", i+1, segment.Type)
+		}
+		if segment.Intensity < 0 {
+			return nil, fmt.Errorf("animation segment %d (%s) has a negative intensity", i+1, segment.Type)
+		}
+		if segment.Intensity == 0 && segment.Type != AnimationCustom {
+			segment.Intensity = intensity
+		}
+		normalized[i] = segment
+		sum += segment.Duration
+	}
+
+	if total > 0 && math.Abs(sum-total) > 0.01 {
+		log.Printf("Animation plan lasts %.2fs, scaling segments to %.2fs", sum, total)
+		scale := total / sum
+		for i := range normalized {
+			normalized[i].Duration *= scale
+		}
+	}
+	return normalized, nil
+}
+
+// animationPlanFor returns the plan for render_motion, scaled to last total seconds:
+// the input's plan, then the decision's, and otherwise a single head shake. Segments
+// without an intensity get the input's, or one tuned to the subject's size.
+func animationPlanFor(manifest *Manifest, total float64) ([]types.AnimationSegment, IntensityTuning, error) {
+	plan := manifest.Input.AnimationPlan
+	if len(plan) == 0 && manifest.LLMAnalysis != nil && manifest.LLMAnalysis.Decision != nil {
+		plan = manifest.LLMAnalysis.Decision.AnimationPlan
+	}
+	if len(plan) == 0 {
+		plan = []types.AnimationSegment{{Type: AnimationRotate, Duration: total}}
+	}
+
+	var area float64
+	if manifest.Result != nil {
+		area = manifest.Result.SubjectArea
+	}
+	plan, tuning := withDefaultIntensities(plan, manifest.Input.Intensity, area)
+	normalized, err := normalizeAnimationPlan(plan, total)
+	return normalized, tuning, err
+}
+
+// animationPlanPrompt describes a plan for full AI mode, where the model renders
+// each segment with the video tools and joins them itself
+func animationPlanPrompt(plan []types.AnimationSegment) string {
+	parts := make([]string, len(plan))
+	for i, segment := range plan {
+		parts[i] = fmt.Sprintf("%d. %s for %.1f seconds (intensity %g)", i+1, segment.Type, segment.Duration, segment.Intensity)
+	}
+	return "Animate in this sequence, generating one animation per segment and concatenating them in order:\n" +
+		strings.Join(parts, "\n")
+}
+
+// animationFilter returns the ffmpeg filter for a segment. A non-zero width and height
+// pin the output size so segments can be concatenated.
+func animationFilter(segment types.AnimationSegment, width, height int) (string, error) {
+	a := strconv.FormatFloat(segment.Intensity, 'g', -1, 64)
+
+	var filter string
+	switch segment.Type {
+	case AnimationRotate:
+		// Two swings per second between -a and +a degrees
+		filter = fmt.Sprintf("rotate=%s*PI/180*sin(4*PI*t):c=none", a)
+	case AnimationShake:
+		filter = fmt.Sprintf("pad=iw+2*%[1]s:ih:%[1]s:0,crop=iw-2*%[1]s:ih:%[1]s+%[1]s*sin(4*PI*t):0", a)
+	case AnimationNod:
+		filter = fmt.Sprintf("pad=iw:ih+2*%[1]s:0:%[1]s,crop=iw:ih-2*%[1]s:0:%[1]s+%[1]s*sin(4*PI*t)", a)
+	case AnimationCustom:
+		if err := ValidateCustomFilter(segment.CustomFilter); err != nil {
+			return "", err
+		}
+		filter = strings.TrimSpace(segment.CustomFilter)
+	case AnimationZoom:
+		if width <= 0 || height <= 0 {
+			return "", fmt.Errorf("zoom animation needs the image size")
+		}
+		return fmt.Sprintf("zoompan=z='1+%s*abs(sin(PI*on/%d))':d=1:x='iw/2-(iw/zoom/2)':y='ih/2-(ih/zoom/2)':s=%dx%d:fps=%d",
+			a, motionFPS, width, height, motionFPS), nil
+	default:
+		return "", fmt.Errorf("unknown animation type %q", segment.Type)
+	}
+
+	if width > 0 && height > 0 {
+		filter += fmt.Sprintf(",scale=%d:%d", width, height)
+	}
+	return filter, nil
+}
+
+// segmentArgs builds the ffmpeg arguments rendering one animation segment from a still
+// image in the spec's size and pixel format
+func segmentArgs(imagePath, outputPath string, segment types.AnimationSegment, spec renderSpec) ([]string, error) {
+	filter, err := animationFilter(segment, spec.width, spec.height)
+	if err != nil {
+		return nil, err
+	}
+	if pad := spec.padFilter(); pad != "" {
+		filter += "," + pad
+	}
+
+	args := []string{
+		"-loop", "1",
+		"-i", imagePath,
+		"-vf", filter,
+		"-t", strconv.FormatFloat(segment.Duration, 'f', -1, 64),
+		"-r", strconv.Itoa(motionFPS),
+	}
+	args = append(args, spec.encoderArgs()...)
+	return append(args, "-y", outputPath), nil
+}
+
+// concatListContent returns a concat demuxer list of paths. Paths use forward slashes,
+// which ffmpeg accepts on Windows too; backslashes would be read as escapes.
+func concatListContent(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		// Single quotes are closed, escaped and reopened: it's -> 'it'\''s'
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(filepath.ToSlash(path), "'", `'\''`))
+	}
+	return b.String()
+}
+
+// concatArgs builds the ffmpeg arguments joining the segments in listPath. Segments share
+// codec, size and frame rate, so streams are copied.
+func concatArgs(listPath, outputPath string) []string {
+	return []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-c", "copy",
+		"-y",
+		outputPath,
+	}
+}
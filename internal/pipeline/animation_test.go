@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestParseAnimationPlan(t *testing.T) {
+	tests := []struct {
+		spec         string
+		customFilter string
+		expected     []types.AnimationSegment
+		expectErr    bool
+	}{
+		{
+			spec: "nod:5,zoom:5,shake:5",
+			expected: []types.AnimationSegment{
+				{Type: "nod", Duration: 5}, {Type: "zoom", Duration: 5}, {Type: "shake", Duration: 5},
+			},
+		},
+		{
+			spec:     " rotate:2.5:15 , nod:2 ",
+			expected: []types.AnimationSegment{{Type: "rotate", Duration: 2.5, Intensity: 15}, {Type: "nod", Duration: 2}},
+		},
+		{spec: "", expectErr: true},
+		{spec: "spin:5", expectErr: true},
+		{spec: "nod", expectErr: true},
+		{spec: "nod:0", expectErr: true},
+		{spec: "nod:five", expectErr: true},
+		{spec: "zoom:5:-1", expectErr: true},
+		{
+			spec:         "nod:2,custom:3",
+			customFilter: " rotate='0.1*sin(2*PI*t)' ",
+			expected: []types.AnimationSegment{
+				{Type: "nod", Duration: 2}, {Type: "custom", Duration: 3, CustomFilter: "rotate='0.1*sin(2*PI*t)'"},
+			},
+		},
+		{spec: "custom:3", expectErr: true},
+		{spec: "custom:3", customFilter: "movie=/etc/passwd", expectErr: true},
+		{spec: "nod:3", customFilter: "hflip", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		plan, err := ParseAnimationPlan(tt.spec, tt.customFilter)
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("ParseAnimationPlan(%q): expected error, got %v", tt.spec, plan)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAnimationPlan(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(plan, tt.expected) {
+			t.Errorf("ParseAnimationPlan(%q) = %+v, want %+v", tt.spec, plan, tt.expected)
+		}
+	}
+}
+
+func TestNormalizeAnimationPlanScalesDurations(t *testing.T) {
+	plan := []types.AnimationSegment{{Type: "nod", Duration: 2}, {Type: "zoom", Duration: 6, Intensity: 0.2}}
+
+	normalized, err := normalizeAnimationPlan(plan, 12)
+	if err != nil {
+		t.Fatalf("normalizeAnimationPlan failed: %v", err)
+	}
+	if math.Abs(normalized[0].Duration-3) > 1e-9 || math.Abs(normalized[1].Duration-9) > 1e-9 {
+		t.Errorf("Expected durations scaled to 3s and 9s, got %+v", normalized)
+	}
+	if normalized[0].Intensity != defaultAnimationIntensity["nod"] || normalized[1].Intensity != 0.2 {
+		t.Errorf("Expected default nod intensity and explicit zoom intensity, got %+v", normalized)
+	}
+	if plan[0].Duration != 2 {
+		t.Error("normalizeAnimationPlan must not modify its input")
+	}
+}
+
+func TestAnimationPlanFor(t *testing.T) {
+	decisionPlan := []types.AnimationSegment{{Type: "zoom", Duration: 10}}
+	inputPlan := []types.AnimationSegment{{Type: "nod", Duration: 5}, {Type: "shake", Duration: 5}}
+
+	tests := []struct {
+		name      string
+		input     []types.AnimationSegment
+		decision  []types.AnimationSegment
+		wantTypes []string
+	}{
+		{"default head shake", nil, nil, []string{"rotate"}},
+		{"decision plan", nil, decisionPlan, []string{"zoom"}},
+		{"input wins", inputPlan, decisionPlan, []string{"nod", "shake"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := NewManifest("test", types.PipelineInput{Duration: 10, AnimationPlan: tt.input})
+			manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: &llm.PipelineDecision{AnimationPlan: tt.decision}}
+
+			plan, _, err := animationPlanFor(manifest, manifest.Input.Duration)
+			if err != nil {
+				t.Fatalf("animationPlanFor failed: %v", err)
+			}
+			var gotTypes []string
+			total := 0.0
+			for _, segment := range plan {
+				gotTypes = append(gotTypes, segment.Type)
+				total += segment.Duration
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) || math.Abs(total-10) > 1e-9 {
+				t.Errorf("plan = %+v, want types %v over 10s", plan, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestSegmentArgs(t *testing.T) {
+	// The default plan renders the same head shake as before; with an unknown image
+	// size the frame is rounded up to even dimensions for yuv420p
+	spec := renderSpec{pixFmt: DefaultPixFmt, pad: true}
+	args, err := segmentArgs("/tmp/in.png", "/tmp/out.mp4", types.AnimationSegment{Type: "rotate", Duration: 10, Intensity: 10}, spec)
+	if err != nil {
+		t.Fatalf("segmentArgs failed: %v", err)
+	}
+	expected := []string{
+		"-loop", "1", "-i", "/tmp/in.png",
+		"-vf", "rotate=10*PI/180*sin(4*PI*t):c=none,pad=ceil(iw/2)*2:ceil(ih/2)*2:0:0:color=black",
+		"-t", "10", "-r", "15", "-pix_fmt", "yuv420p", "-y", "/tmp/out.mp4",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("segmentArgs = %v, want %v", args, expected)
+	}
+
+	// Every type pins the output size so segments concatenate
+	for _, animationType := range []string{"rotate", "shake", "nod", "zoom", "custom"} {
+		segment := types.AnimationSegment{Type: animationType, Duration: 1, Intensity: 5}
+		if animationType == "custom" {
+			segment.CustomFilter = "hflip"
+		}
+		filter, err := animationFilter(segment, 640, 480)
+		if err != nil {
+			t.Errorf("animationFilter(%s) failed: %v", animationType, err)
+			continue
+		}
+		if !strings.Contains(filter, "640") || !strings.Contains(filter, "480") {
+			t.Errorf("animationFilter(%s) = %q does not pin 640x480", animationType, filter)
+		}
+	}
+
+	if _, err := animationFilter(types.AnimationSegment{Type: "zoom", Duration: 1, Intensity: 0.1}, 0, 0); err == nil {
+		t.Error("Expected zoom without an image size to fail")
+	}
+}
+
+func TestConcatListContent(t *testing.T) {
+	got := concatListContent([]string{"/tmp/a.mp4", "/tmp/it's.mp4"})
+	expected := "file '/tmp/a.mp4'\nfile '/tmp/it'\\''s.mp4'\n"
+	if got != expected {
+		t.Errorf("concatListContent = %q, want %q", got, expected)
+	}
+}
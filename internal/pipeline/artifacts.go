@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// attemptFileName inserts the attempt number before the extension:
+// attemptFileName("segmented_person.png", 2) returns "segmented_person.attempt2.png"
+func attemptFileName(name string, attempt int) string {
+	if attempt < 1 {
+		attempt = 1
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s.attempt%d%s", strings.TrimSuffix(name, ext), attempt, ext)
+}
+
+// stageArtifactPath returns the absolute path for a stage artifact named after the
+// stage's current attempt, so a retry never reads a file left by an earlier attempt
+func stageArtifactPath(manifest *Manifest, stage types.PipelineStage, dir, name string) (string, error) {
+	attempt := 1
+	if state := manifest.Stages[stage]; state != nil {
+		attempt = state.Attempt
+	}
+	path, err := filepath.Abs(filepath.Join(dir, attemptFileName(name, attempt)))
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute output path: %w", err)
+	}
+	return path, nil
+}
+
+// partialPath returns the path a file is written to before it is complete. The
+// extension is kept so tools still infer the format from the name.
+func partialPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".partial" + ext
+}
+
+// commitArtifact moves a completely written partial file to its final path
+func commitArtifact(partial, path string) error {
+	if _, err := os.Stat(partial); err != nil {
+		return fmt.Errorf("artifact not written: %w", err)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to commit artifact %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// cleanSupersededAttempts removes the files of earlier attempts of name in dir,
+// including partial writes, keeping only keep
+func cleanSupersededAttempts(dir, name, keep string) {
+	ext := filepath.Ext(name)
+	pattern := filepath.Join(dir, glob(strings.TrimSuffix(name, ext))+".attempt*"+glob(ext))
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+
+	keep, _ = filepath.Abs(keep)
+	for _, match := range matches {
+		if abs, _ := filepath.Abs(match); abs == keep {
+			continue
+		}
+		if err := os.Remove(match); err != nil {
+			log.Printf("Warning: failed to remove superseded artifact %s: %v", match, err)
+		}
+	}
+}
+
+// glob escapes the glob metacharacters in s
+func glob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(s)
+}
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestAttemptFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempt  int
+		expected string
+	}{
+		{"segmented_person.png", 2, "segmented_person.attempt2.png"},
+		{"segmented_person.png", 0, "segmented_person.attempt1.png"},
+		{"music", 3, "music.attempt3"},
+	}
+
+	for _, tt := range tests {
+		if got := attemptFileName(tt.name, tt.attempt); got != tt.expected {
+			t.Errorf("attemptFileName(%q, %d) = %q, want %q", tt.name, tt.attempt, got, tt.expected)
+		}
+	}
+
+	if got := partialPath("/tmp/out/final.mp4"); got != "/tmp/out/final.partial.mp4" {
+		t.Errorf("partialPath = %q", got)
+	}
+}
+
+// TestSegmentRetryIgnoresTruncatedAttempt fails the first fill after it wrote part of
+// the image and checks the retry writes and reports a fresh file
+func TestSegmentRetryIgnoresTruncatedAttempt(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tools := newFakeToolClient()
+	tools.fillFailures = 1
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	manifest := newCacheTestManifest(t, imagePath, 0.3)
+	tempDir := manifest.Input.TempDir
+
+	manifest.StartStage(types.StageSegmentPerson)
+	err := ExecuteSegmentPerson(context.Background(), p, manifest)
+	if err == nil {
+		t.Fatal("Expected first attempt to fail")
+	}
+	manifest.FailStage(types.StageSegmentPerson, err)
+
+	firstPartial := partialPath(filepath.Join(tempDir, "segmented_person.attempt1.png"))
+	if data, err := os.ReadFile(firstPartial); err != nil || string(data) != "trunc" {
+		t.Fatalf("Expected truncated partial from the failed attempt, got %q (err: %v)", data, err)
+	}
+	if manifest.Result != nil && manifest.Result.SegmentedImagePath != "" {
+		t.Fatalf("Failed attempt must not record a path, got %s", manifest.Result.SegmentedImagePath)
+	}
+
+	manifest.StartStage(types.StageSegmentPerson)
+	if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+
+	want := filepath.Join(tempDir, "segmented_person.attempt2.png")
+	if manifest.Result.SegmentedImagePath != want {
+		t.Errorf("SegmentedImagePath = %s, want %s", manifest.Result.SegmentedImagePath, want)
+	}
+	if data, err := os.ReadFile(want); err != nil || string(data) != "segmented" {
+		t.Errorf("Expected complete image from the retry, got %q (err: %v)", data, err)
+	}
+
+	// The failed attempt's leftovers are cleaned once the retry succeeds
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(want) {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("Expected only %s in TempDir, got %v", filepath.Base(want), names)
+	}
+}
+
+func TestCleanSupersededAttempts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"segmented_person.attempt1.png",
+		"segmented_person.attempt2.partial.png",
+		"segmented_person.attempt3.png",
+		"headshake_animation.attempt1.mp4",
+		"segmented_person.png",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	cleanSupersededAttempts(dir, segmentedFileName, filepath.Join(dir, "segmented_person.attempt3.png"))
+
+	for name, wantExists := range map[string]bool{
+		"segmented_person.attempt1.png":         false,
+		"segmented_person.attempt2.partial.png": false,
+		"segmented_person.attempt3.png":         true,
+		"headshake_animation.attempt1.mp4":      true,
+		"segmented_person.png":                  true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("%s exists = %v, want %v", name, exists, wantExists)
+		}
+	}
+}
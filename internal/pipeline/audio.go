@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+)
+
+// Duration sources: what sets the length of the rendered motion
+const (
+	DurationSourceFixed      = "fixed"       // The requested --duration (default)
+	DurationSourceMatchAudio = "match_audio" // The length of the user-supplied audio
+)
+
+// MusicQualityUser marks user-supplied audio muxed into the final output
+const MusicQualityUser = "user"
+
+// ResolveDurationSource validates a duration source; empty selects fixed
+func ResolveDurationSource(source string) (string, error) {
+	switch source {
+	case "":
+		return DurationSourceFixed, nil
+	case DurationSourceFixed, DurationSourceMatchAudio:
+		return source, nil
+	default:
+		return "", fmt.Errorf("unknown duration_source %q (supported: %s, %s)",
+			source, DurationSourceFixed, DurationSourceMatchAudio)
+	}
+}
+
+// checkAudioFile verifies user-supplied audio is a readable file
+func checkAudioFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("audio file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("audio file %s is a directory", path)
+	}
+	return nil
+}
+
+// motionDuration returns how long render_motion renders and where that length came
+// from: the user-supplied audio with match_audio, otherwise the requested duration
+func (p *Pipeline) motionDuration(ctx context.Context, manifest *Manifest) (float64, string, error) {
+	if p.durationSource != DurationSourceMatchAudio {
+		return manifest.Input.Duration, DurationSourceFixed, nil
+	}
+	audioPath := manifest.Input.AudioPath
+	if audioPath == "" {
+		log.Printf("Warning: duration_source is %s but no audio was supplied, rendering %.1fs",
+			DurationSourceMatchAudio, manifest.Input.Duration)
+		return manifest.Input.Duration, DurationSourceFixed, nil
+	}
+
+	if err := checkAudioFile(audioPath); err != nil {
+		return 0, "", err
+	}
+	duration, err := probeMediaDuration(ctx, audioPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("cannot match the audio length: %w", err)
+	}
+	log.Printf("Rendering motion to the audio length: %.2fs", duration)
+	return duration, DurationSourceMatchAudio, nil
+}
+
+// probeMediaDuration returns the duration of a media file in seconds
+func probeMediaDuration(ctx context.Context, path string) (float64, error) {
+	cmd := procgroup.CommandContext(ctx, "ffprobe", probeDurationArgs(path)...)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseProbedDuration(output)
+}
+
+// probeDurationArgs returns the ffprobe arguments reporting a file's duration as JSON
+func probeDurationArgs(path string) []string {
+	return []string{
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "json",
+		path,
+	}
+}
+
+// parseProbedDuration reads the format duration from ffprobe JSON output
+func parseProbedDuration(probeJSON []byte) (float64, error) {
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(probeJSON, &probe); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if probe.Format.Duration == "" {
+		return 0, fmt.Errorf("ffprobe reported no duration")
+	}
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", probe.Format.Duration, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("audio has no length (%s seconds)", probe.Format.Duration)
+	}
+	return duration, nil
+}
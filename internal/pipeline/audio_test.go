@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveDurationSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+		wantErr  bool
+	}{
+		{"", DurationSourceFixed, false},
+		{"fixed", DurationSourceFixed, false},
+		{"match_audio", DurationSourceMatchAudio, false},
+		{"match_video", "", true},
+	}
+
+	for _, tt := range tests {
+		source, err := ResolveDurationSource(tt.source)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveDurationSource(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+		}
+		if source != tt.expected {
+			t.Errorf("ResolveDurationSource(%q) = %q, want %q", tt.source, source, tt.expected)
+		}
+	}
+}
+
+func TestParseProbedDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		probe    string
+		expected float64
+		wantErr  bool
+	}{
+		{"song", `{"format": {"filename": "song.mp3", "duration": "183.472000"}}`, 183.472, false},
+		{"no duration", `{"format": {"filename": "song.mp3"}}`, 0, true},
+		{"zero length", `{"format": {"duration": "0.000000"}}`, 0, true},
+		{"not a number", `{"format": {"duration": "N/A"}}`, 0, true},
+		{"not JSON", `Invalid data found when processing input`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := parseProbedDuration([]byte(tt.probe))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if duration != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, duration)
+			}
+		})
+	}
+}
+
+func TestMotionDuration(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.mp3")
+
+	tests := []struct {
+		name           string
+		durationSource string
+		audioPath      string
+		expected       float64
+		expectedSource string
+		wantErr        string
+	}{
+		{name: "fixed ignores audio", durationSource: DurationSourceFixed, audioPath: missing, expected: 10, expectedSource: DurationSourceFixed},
+		{name: "match_audio without audio", durationSource: DurationSourceMatchAudio, expected: 10, expectedSource: DurationSourceFixed},
+		{name: "match_audio checks the file first", durationSource: DurationSourceMatchAudio, audioPath: missing, wantErr: "audio file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+			p.SetDurationSource(tt.durationSource)
+			manifest := NewManifest("test", types.PipelineInput{Duration: 10, AudioPath: tt.audioPath})
+
+			duration, source, err := p.motionDuration(context.Background(), manifest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("motionDuration failed: %v", err)
+			}
+			if duration != tt.expected || source != tt.expectedSource {
+				t.Errorf("Expected %.1fs from %s, got %.1fs from %s", tt.expected, tt.expectedSource, duration, source)
+			}
+		})
+	}
+}
+
+// TestUserAudioSkipsMusicSearch verifies supplied audio is validated up front and
+// replaces the music search
+func TestUserAudioSkipsMusicSearch(t *testing.T) {
+	audioPath := filepath.Join(t.TempDir(), "song.mp3")
+	if err := os.WriteFile(audioPath, []byte("ID3"), 0644); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "in.png")
+	writePNG(t, imagePath, 4, 4)
+
+	input := types.PipelineInput{ImagePath: imagePath, Duration: 10, AudioPath: audioPath + ".missing"}
+	if err := ValidateInput(input); err == nil {
+		t.Error("Expected missing audio to fail validation")
+	}
+	input.AudioPath = audioPath
+	if err := ValidateInput(input); err != nil {
+		t.Fatalf("ValidateInput failed: %v", err)
+	}
+
+	// A nil music client would panic if the search ran
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+	manifest := NewManifest("test", input)
+	manifest.Result = &PipelineResult{}
+	if err := ExecuteSearchMusic(context.Background(), p, manifest); err != nil {
+		t.Fatalf("ExecuteSearchMusic failed: %v", err)
+	}
+	if state := manifest.Stages[types.StageSearchMusic]; state == nil || state.Status != types.StatusSkipped {
+		t.Errorf("Expected search_music to be skipped, got %+v", state)
+	}
+}
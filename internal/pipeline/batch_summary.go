@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Batch summary files, written in the batch's output directory
+const (
+	BatchSummaryCSVName  = "batch_summary.csv"
+	BatchSummaryJSONName = "batch_summary.json"
+)
+
+// Batch summary statuses
+const (
+	BatchStatusCompleted = "completed"
+	BatchStatusFailed    = "failed"
+)
+
+// BatchSummaryRow is one pipeline's outcome in a batch summary. The JSON names are also
+// the CSV columns, in field order, so both files always have the same fields.
+type BatchSummaryRow struct {
+	InputFile       string              `json:"input_file"`
+	PipelineID      string              `json:"pipeline_id"`
+	Status          string              `json:"status"`       // completed or failed
+	FailedStage     types.PipelineStage `json:"failed_stage"` // Empty unless a stage failed the run
+	Reason          string              `json:"reason"`       // Why the run failed
+	OutputPath      string              `json:"output_path"`
+	DurationSeconds float64             `json:"duration_seconds"` // Target video duration
+	ElapsedSeconds  float64             `json:"elapsed_seconds"`  // Wall time of the run
+	MusicTrack      string              `json:"music_track"`      // Title, or ID, of the track muxed in
+	CostUSD         float64             `json:"cost_usd"`         // Full AI conversation and repair questions
+}
+
+// NewBatchSummaryRow summarizes a run that returned err after elapsed. manifest is the
+// run's manifest as saved, or nil when the run failed before saving one.
+func NewBatchSummaryRow(input types.PipelineInput, pipelineID string, manifest *Manifest, err error, elapsed time.Duration) BatchSummaryRow {
+	row := BatchSummaryRow{
+		InputFile:       input.ImagePath,
+		PipelineID:      pipelineID,
+		Status:          BatchStatusCompleted,
+		DurationSeconds: input.Duration,
+		ElapsedSeconds:  elapsed.Round(time.Millisecond).Seconds(),
+	}
+	if err != nil {
+		row.Status, row.Reason = BatchStatusFailed, err.Error()
+		var stageErr *StageError
+		if errors.As(err, &stageErr) {
+			row.FailedStage, row.Reason = stageErr.Stage, stageErr.Err.Error()
+		}
+	}
+	if manifest == nil {
+		return row
+	}
+
+	for _, repair := range manifest.Repairs {
+		row.CostUSD += repair.CostUSD
+	}
+	if result := manifest.Result; result != nil {
+		if err == nil {
+			row.OutputPath = result.FinalOutputPath
+		}
+		if music := result.Provenance[ArtifactMusic]; music != nil {
+			row.MusicTrack = music.TrackTitle
+			if row.MusicTrack == "" {
+				row.MusicTrack = music.TrackID
+			}
+		}
+		if result.Conversation != nil {
+			row.CostUSD += result.Conversation.CostUSD
+		}
+	}
+	return row
+}
+
+// batchSummaryColumns returns the CSV header: the JSON names of BatchSummaryRow's fields
+func batchSummaryColumns() []string {
+	rowType := reflect.TypeOf(BatchSummaryRow{})
+	columns := make([]string, rowType.NumField())
+	for i := range columns {
+		columns[i], _, _ = strings.Cut(rowType.Field(i).Tag.Get("json"), ",")
+	}
+	return columns
+}
+
+// csvRecord returns the row's fields in column order
+func (r BatchSummaryRow) csvRecord() []string {
+	value := reflect.ValueOf(r)
+	record := make([]string, value.NumField())
+	for i := range record {
+		field := value.Field(i)
+		switch field.Kind() {
+		case reflect.Float64:
+			record[i] = strconv.FormatFloat(field.Float(), 'f', -1, 64)
+		default:
+			record[i] = field.String()
+		}
+	}
+	return record
+}
+
+// AppendBatchSummary adds row to the batch summary in dir: a line appended to
+// batch_summary.csv, with the header when the file is new, and batch_summary.json
+// rewritten with the row added. Each finished pipeline is appended as it finishes, so a
+// batch that stops early still leaves a usable summary. Pipelines of one batch must not
+// append concurrently.
+func AppendBatchSummary(dir string, row BatchSummaryRow) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create batch summary directory: %w", err)
+	}
+	if err := appendBatchSummaryCSV(filepath.Join(dir, BatchSummaryCSVName), row); err != nil {
+		return err
+	}
+	return appendBatchSummaryJSON(filepath.Join(dir, BatchSummaryJSONName), row)
+}
+
+// appendBatchSummaryCSV appends row to the CSV summary at path
+func appendBatchSummaryCSV(path string, row BatchSummaryRow) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open batch summary: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open batch summary: %w", err)
+	}
+	writer := csv.NewWriter(file)
+	if info.Size() == 0 {
+		writer.Write(batchSummaryColumns())
+	}
+	writer.Write(row.csvRecord())
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write batch summary: %w", err)
+	}
+	return file.Sync()
+}
+
+// appendBatchSummaryJSON adds row to the JSON summary at path, replacing it atomically
+func appendBatchSummaryJSON(path string, row BatchSummaryRow) error {
+	var rows []BatchSummaryRow
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return fmt.Errorf("malformed batch summary %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read batch summary: %w", err)
+	}
+	rows = append(rows, row)
+
+	data, err = json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch summary: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write batch summary: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save batch summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// batchToolClient is a fake MCP server for a batch: fill cuts nothing out but copies the
+// image, so ffmpeg renders it, and SearchRecordings offers one track served by musicURL
+type batchToolClient struct {
+	*fakeToolClient
+	musicURL string
+}
+
+func (c *batchToolClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	var text string
+	switch name {
+	case "fill":
+		outputPath := arguments["output_path"].(string)
+		if err := copyFile(arguments["input_path"].(string), outputPath); err != nil {
+			return nil, err
+		}
+		text = outputPath
+	case "SearchRecordings":
+		text = fmt.Sprintf(`{"data":{"recordings":{"nodes":[{"recording":{"id":"t1","title":"Sunny Day","audioFile":{"lqmp3Url":%q}}}]}}}`, c.musicURL)
+	default:
+		return c.fakeToolClient.CallTool(ctx, name, arguments)
+	}
+	return &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: text}}}, nil
+}
+
+// serveTestTrack skips the test without ffmpeg and ffprobe, and otherwise serves a
+// short encoded tone for batchToolClient's musicURL
+func serveTestTrack(t *testing.T) string {
+	t.Helper()
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(binary); err != nil {
+			t.Skipf("%s not installed", binary)
+		}
+	}
+
+	musicPath := filepath.Join(t.TempDir(), "track.mp3")
+	tone := exec.Command("ffmpeg", "-f", "lavfi", "-i", "sine=frequency=440:duration=4", "-y", musicPath)
+	if output, err := tone.CombinedOutput(); err != nil {
+		t.Skipf("ffmpeg can't encode the test track: %v, output: %s", err, output)
+	}
+	music := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, musicPath)
+	}))
+	t.Cleanup(music.Close)
+	return music.URL + "/track.mp3"
+}
+
+// TestBatchSummary runs a three-image batch through the real stages against fake MCP
+// servers, appending each outcome as its pipeline finishes, and checks both summaries
+// list every image. It needs ffmpeg and ffprobe.
+func TestBatchSummary(t *testing.T) {
+	musicURL := serveTestTrack(t)
+	root := t.TempDir()
+	summaryDir := filepath.Join(root, "batch")
+
+	// The image named "broken" isn't an image, so render_motion fails on it
+	images := []string{"beach", "broken", "park"}
+	for _, name := range images {
+		imagePath := filepath.Join(root, name+".png")
+		if name == "broken" {
+			if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+				t.Fatalf("Failed to write image: %v", err)
+			}
+		} else {
+			writePNG(t, imagePath, 64, 48)
+		}
+		tempDir := filepath.Join(root, name)
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		tools := &batchToolClient{fakeToolClient: newFakeToolClient(), musicURL: musicURL}
+		p := NewPipeline(tools, tools, tools, tools, nil, true, 1, "", "lightweight")
+		p.SetManifestStore(NewMemoryManifestStore())
+		p.SetOutputConfig(types.OutputConfig{Name: "{image}_final"})
+		p.SetEventLog(false)
+
+		input := types.PipelineInput{ImagePath: imagePath, Duration: 2, TempDir: tempDir, OutputDir: root}
+		started := time.Now()
+		_, err := p.Execute(context.Background(), input, "batch-"+name)
+		manifest, loadErr := p.SavedManifest(context.Background())
+		if loadErr != nil {
+			t.Fatalf("SavedManifest failed: %v", loadErr)
+		}
+		if err := AppendBatchSummary(summaryDir, NewBatchSummaryRow(input, "batch-"+name, manifest, err, time.Since(started))); err != nil {
+			t.Fatalf("AppendBatchSummary failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(summaryDir, BatchSummaryJSONName))
+	if err != nil {
+		t.Fatalf("Failed to read JSON summary: %v", err)
+	}
+	var rows []BatchSummaryRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatalf("Malformed JSON summary: %v", err)
+	}
+	if len(rows) != len(images) {
+		t.Fatalf("Expected %d rows, got %+v", len(images), rows)
+	}
+
+	beach, broken := rows[0], rows[1]
+	if beach.Status != BatchStatusCompleted || beach.OutputPath != filepath.Join(root, "beach_final.mp4") ||
+		beach.MusicTrack != "Sunny Day" || beach.DurationSeconds != 2 || beach.InputFile != filepath.Join(root, "beach.png") {
+		t.Errorf("Unexpected completed row %+v", beach)
+	}
+	if _, err := os.Stat(beach.OutputPath); err != nil {
+		t.Errorf("Expected the summary to point at the final video: %v", err)
+	}
+	if broken.Status != BatchStatusFailed || broken.FailedStage != types.StageRenderMotion || broken.Reason == "" || broken.OutputPath != "" {
+		t.Errorf("Unexpected failed row %+v", broken)
+	}
+	if rows[2].PipelineID != "batch-park" || rows[2].Status != BatchStatusCompleted {
+		t.Errorf("Expected the batch to go on after the failure, got %+v", rows[2])
+	}
+
+	file, err := os.Open(filepath.Join(summaryDir, BatchSummaryCSVName))
+	if err != nil {
+		t.Fatalf("Failed to open CSV summary: %v", err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Malformed CSV summary: %v", err)
+	}
+	if len(records) != len(images)+1 || !reflect.DeepEqual(records[0], batchSummaryColumns()) {
+		t.Fatalf("Expected a header and %d rows, got %v", len(images), records)
+	}
+	for i, row := range rows {
+		if !reflect.DeepEqual(records[i+1], row.csvRecord()) {
+			t.Errorf("CSV row %d %v doesn't match JSON row %+v", i+1, records[i+1], row)
+		}
+	}
+	if records[2][3] != "render_motion" || records[2][4] == "" {
+		t.Errorf("Expected the failed stage and reason in the CSV, got %v", records[2])
+	}
+}
+
+func TestBatchSummaryColumns(t *testing.T) {
+	expected := []string{"input_file", "pipeline_id", "status", "failed_stage", "reason", "output_path",
+		"duration_seconds", "elapsed_seconds", "music_track", "cost_usd"}
+	if columns := batchSummaryColumns(); !reflect.DeepEqual(columns, expected) {
+		t.Errorf("Expected columns %v, got %v", expected, columns)
+	}
+}
@@ -0,0 +1,305 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cacheEntryFile is the metadata file stored in each cache entry directory
+const cacheEntryFile = "entry.json"
+
+// CacheEntry is a cached stage result. Artifact is the file name of the cached
+// artifact inside the entry directory, if the stage produced one.
+type CacheEntry struct {
+	Tool     string            `json:"tool"`
+	Artifact string            `json:"artifact,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+	StoredAt time.Time         `json:"stored_at"`
+
+	dir string
+}
+
+// ArtifactPath returns the absolute path of the cached artifact
+func (e *CacheEntry) ArtifactPath() string {
+	if e.Artifact == "" {
+		return ""
+	}
+	return filepath.Join(e.dir, e.Artifact)
+}
+
+// StageCache is a content-addressed store of stage results shared across pipelines.
+// Entries are directories named by key; the least recently used are evicted once the
+// total size exceeds maxBytes.
+type StageCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+}
+
+// NewStageCache creates a cache rooted at dir. maxBytes <= 0 disables eviction.
+func NewStageCache(dir string, maxBytes int64) (*StageCache, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &StageCache{dir: absDir, maxBytes: maxBytes}, nil
+}
+
+// CacheKey derives an entry key from the input content hash, the tool and its parameters
+func CacheKey(contentHash, tool string, params map[string]interface{}) (string, error) {
+	// json.Marshal sorts map keys, so equal parameters always hash the same
+	paramData, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cache parameters: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(contentHash))
+	h.Write([]byte{0})
+	h.Write([]byte(tool))
+	h.Write([]byte{0})
+	h.Write(paramData)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashFile returns the hex SHA-256 of a file's content
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for hashing: %w", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Get returns the entry for key and marks it as recently used
+func (c *StageCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entryDir := filepath.Join(c.dir, key)
+	data, err := os.ReadFile(filepath.Join(entryDir, cacheEntryFile))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("Warning: ignoring corrupt cache entry %s: %v", key, err)
+		return nil, false
+	}
+	entry.dir = entryDir
+
+	if artifact := entry.ArtifactPath(); artifact != "" {
+		if _, err := os.Stat(artifact); err != nil {
+			return nil, false
+		}
+	}
+
+	now := time.Now()
+	os.Chtimes(filepath.Join(entryDir, cacheEntryFile), now, now)
+	return &entry, true
+}
+
+// Put stores a stage result under key, copying artifactPath into the entry if set
+func (c *StageCache) Put(key, tool, artifactPath string, data map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entryDir := filepath.Join(c.dir, key)
+	tempDir := entryDir + ".tmp"
+	os.RemoveAll(tempDir)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+
+	entry := CacheEntry{
+		Tool:     tool,
+		Data:     data,
+		StoredAt: time.Now(),
+	}
+	if artifactPath != "" {
+		entry.Artifact = "artifact" + filepath.Ext(artifactPath)
+		if err := copyFile(artifactPath, filepath.Join(tempDir, entry.Artifact)); err != nil {
+			os.RemoveAll(tempDir)
+			return err
+		}
+	}
+
+	entryData, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, cacheEntryFile), entryData, 0644); err != nil {
+		os.RemoveAll(tempDir)
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	// Swap the complete entry into place so readers never see a partial one
+	os.RemoveAll(entryDir)
+	if err := os.Rename(tempDir, entryDir); err != nil {
+		os.RemoveAll(tempDir)
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+
+	c.evict()
+	return nil
+}
+
+// evict removes least recently used entries until the cache fits maxBytes; caller must hold c.mu
+func (c *StageCache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	type entryInfo struct {
+		dir      string
+		size     int64
+		lastUsed time.Time
+	}
+
+	dirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("Warning: failed to read cache directory: %v", err)
+		return
+	}
+
+	var entries []entryInfo
+	var total int64
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.dir, d.Name())
+		info, err := os.Stat(filepath.Join(dir, cacheEntryFile))
+		if err != nil {
+			continue
+		}
+		size := dirSize(dir)
+		total += size
+		entries = append(entries, entryInfo{dir: dir, size: size, lastUsed: info.ModTime()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	for _, entry := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.RemoveAll(entry.dir); err != nil {
+			log.Printf("Warning: failed to evict cache entry %s: %v", entry.dir, err)
+			continue
+		}
+		total -= entry.size
+		log.Printf("Evicted cache entry %s (%d bytes)", filepath.Base(entry.dir), entry.size)
+	}
+}
+
+// dirSize returns the total size of regular files in dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// copyFile copies src to dst, replacing dst atomically
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tempPath := dst + ".tmp"
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tempPath, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write %s: %w", tempPath, err)
+	}
+
+	if err := os.Rename(tempPath, dst); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename %s: %w", tempPath, err)
+	}
+	return nil
+}
+
+// stageCacheKey returns the cache key for a stage run on inputPath, or "" when
+// caching is disabled or the input cannot be hashed
+func (p *Pipeline) stageCacheKey(inputPath, tool string, params map[string]interface{}) string {
+	if p.stageCache == nil {
+		return ""
+	}
+
+	contentHash, err := HashFile(inputPath)
+	if err != nil {
+		log.Printf("Warning: stage cache disabled for %s: %v", tool, err)
+		return ""
+	}
+
+	key, err := CacheKey(contentHash, tool, params)
+	if err != nil {
+		log.Printf("Warning: stage cache disabled for %s: %v", tool, err)
+		return ""
+	}
+	return key
+}
+
+// lookupStageCache returns the cached entry for key, if any
+func (p *Pipeline) lookupStageCache(key string) (*CacheEntry, bool) {
+	if p.stageCache == nil || key == "" {
+		return nil, false
+	}
+	entry, ok := p.stageCache.Get(key)
+	if ok {
+		log.Printf("Stage cache hit for %s (%s)", entry.Tool, key[:12])
+	}
+	return entry, ok
+}
+
+// storeStageCache saves a stage result; failures only disable caching for this run
+func (p *Pipeline) storeStageCache(key, tool, artifactPath string, data map[string]string) {
+	if p.stageCache == nil || key == "" {
+		return
+	}
+	if err := p.stageCache.Put(key, tool, artifactPath, data); err != nil {
+		log.Printf("Warning: failed to cache %s result: %v", tool, err)
+	}
+}
@@ -0,0 +1,298 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// fakeToolClient is an MCPClient that serves detect, fill and pose analysis and counts calls
+type fakeToolClient struct {
+	calls          map[string]int
+	detectResponse string                 // Overrides the default single-person detection
+	poseResponse   string                 // Overrides the default pose result
+	poseErr        error                  // Fails pose analysis when set
+	models         string                 // When set, list_available_models is exposed and returns it
+	fillFailures   int                    // Fill calls that leave a truncated file and fail
+	fillArgs       map[string]interface{} // Arguments of the last fill call
+	pathArgs       []string
+}
+
+func newFakeToolClient() *fakeToolClient {
+	return &fakeToolClient{calls: make(map[string]int)}
+}
+
+func (f *fakeToolClient) Connect(ctx context.Context) error    { return nil }
+func (f *fakeToolClient) Initialize(ctx context.Context) error { return nil }
+func (f *fakeToolClient) Close() error                         { return nil }
+func (f *fakeToolClient) GetServerInfo() (string, string)      { return "fake", "1.0.0" }
+
+func (f *fakeToolClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	if f.models != "" {
+		return []types.Tool{{Name: yoloListModelsTool}}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeToolClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	f.calls[name]++
+	for key, value := range arguments {
+		if path, ok := value.(string); ok && strings.HasSuffix(key, "path") {
+			f.pathArgs = append(f.pathArgs, path)
+		}
+	}
+
+	var text string
+	switch name {
+	case "detect":
+		text = `{"detections":[{"class":"person","polygon":[[0,0],[10,0],[10,10]]}]}`
+		if f.detectResponse != "" {
+			text = f.detectResponse
+		}
+	case "fill":
+		f.fillArgs = arguments
+		outputPath := arguments["output_path"].(string)
+		if f.fillFailures > 0 {
+			f.fillFailures--
+			os.WriteFile(outputPath, []byte("trunc"), 0644)
+			return nil, fmt.Errorf("fill crashed mid-write")
+		}
+		if err := os.WriteFile(outputPath, []byte("segmented"), 0644); err != nil {
+			return nil, err
+		}
+		text = outputPath
+	case "analyze_image_from_path":
+		if f.poseErr != nil {
+			return nil, f.poseErr
+		}
+		text = `{"keypoints":[[1,2]]}`
+		if f.poseResponse != "" {
+			text = f.poseResponse
+		}
+	case yoloListModelsTool:
+		text = f.models
+	default:
+		return nil, fmt.Errorf("unexpected tool: %s", name)
+	}
+
+	return &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: text}}}, nil
+}
+
+// newCacheTestManifest creates a manifest for an image in its own temp directory
+func newCacheTestManifest(t *testing.T, imagePath string, confidence float64) *Manifest {
+	t.Helper()
+	manifest := NewManifest("test", types.PipelineInput{ImagePath: imagePath, TempDir: t.TempDir()})
+	manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: &llm.PipelineDecision{
+		Parameters: map[string]interface{}{"detect_confidence": confidence},
+	}}
+	return manifest
+}
+
+// stageCacheHit reports whether the stage output carries the cache_hit marker
+func stageCacheHit(t *testing.T, manifest *Manifest, stage types.PipelineStage) bool {
+	t.Helper()
+	var output map[string]interface{}
+	if err := json.Unmarshal(manifest.Stages[stage].Output, &output); err != nil {
+		t.Fatalf("Failed to parse stage output: %v", err)
+	}
+	hit, _ := output["cache_hit"].(bool)
+	return hit
+}
+
+// TestStageCacheSegmentAndLandmarks verifies hit, miss and parameter-mismatch behaviour
+func TestStageCacheSegmentAndLandmarks(t *testing.T) {
+	cache, err := NewStageCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewStageCache failed: %v", err)
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tools := newFakeToolClient()
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetStageCache(cache)
+
+	run := func(confidence float64) *Manifest {
+		manifest := newCacheTestManifest(t, imagePath, confidence)
+		if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+			t.Fatalf("ExecuteSegmentPerson failed: %v", err)
+		}
+		if err := ExecuteEstimateLandmarks(context.Background(), p, manifest); err != nil {
+			t.Fatalf("ExecuteEstimateLandmarks failed: %v", err)
+		}
+		return manifest
+	}
+
+	// Miss: tools are called and results stored
+	first := run(0.3)
+	if tools.calls["fill"] != 1 || tools.calls["analyze_image_from_path"] != 1 {
+		t.Fatalf("Expected one call per tool on miss, got %v", tools.calls)
+	}
+	if stageCacheHit(t, first, types.StageSegmentPerson) {
+		t.Error("Expected first segmentation to miss the cache")
+	}
+
+	// Hit: same image and parameters reuse both results
+	second := run(0.3)
+	if tools.calls["detect"] != 1 || tools.calls["fill"] != 1 || tools.calls["analyze_image_from_path"] != 1 {
+		t.Errorf("Expected no tool calls on hit, got %v", tools.calls)
+	}
+	if !stageCacheHit(t, second, types.StageSegmentPerson) || !stageCacheHit(t, second, types.StageLandmarks) {
+		t.Error("Expected both stages to report a cache hit")
+	}
+	if filepath.Dir(second.Result.SegmentedImagePath) != second.Input.TempDir {
+		t.Errorf("Expected cached artifact copied into TempDir, got %s", second.Result.SegmentedImagePath)
+	}
+	if data, err := os.ReadFile(second.Result.SegmentedImagePath); err != nil || string(data) != "segmented" {
+		t.Errorf("Expected cached artifact content, got %q (err: %v)", data, err)
+	}
+	if second.Result.LandmarksData != first.Result.LandmarksData {
+		t.Errorf("Expected cached landmarks %q, got %q", first.Result.LandmarksData, second.Result.LandmarksData)
+	}
+
+	// Parameter mismatch: a different confidence recomputes segmentation
+	third := run(0.5)
+	if tools.calls["detect"] != 2 || tools.calls["fill"] != 2 {
+		t.Errorf("Expected segmentation to rerun with new parameters, got %v", tools.calls)
+	}
+	if stageCacheHit(t, third, types.StageSegmentPerson) {
+		t.Error("Expected segmentation with new parameters to miss the cache")
+	}
+}
+
+// TestStageCacheSubjectBounds verifies a segment cache hit restores the subject bounds
+// placement needs, and entries from before they were recorded miss
+func TestStageCacheSubjectBounds(t *testing.T) {
+	cache, err := NewStageCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewStageCache failed: %v", err)
+	}
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	writePNG(t, imagePath, 100, 80)
+
+	tools := newFakeToolClient()
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetStageCache(cache)
+
+	// An entry stored before the cache recorded subject bounds
+	legacyKey := p.stageCacheKey(imagePath, segmentCacheTool, map[string]interface{}{
+		"confidence":            0.3,
+		"max_process_dimension": p.maxProcessDimension,
+		"jpeg_quality":          p.jpegQuality,
+	})
+	legacyArtifact := filepath.Join(t.TempDir(), "segmented.png")
+	writePNG(t, legacyArtifact, 100, 80)
+	p.storeStageCache(legacyKey, segmentCacheTool, legacyArtifact, map[string]string{})
+
+	expected := &SubjectBounds{X: 0, Y: 0, Width: 10, Height: 10}
+	for i, expectHit := range []bool{false, true} {
+		manifest := newCacheTestManifest(t, imagePath, 0.3)
+		if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+			t.Fatalf("ExecuteSegmentPerson failed: %v", err)
+		}
+		if hit := stageCacheHit(t, manifest, types.StageSegmentPerson); hit != expectHit {
+			t.Errorf("Run %d: expected cache hit %v, got %v", i+1, expectHit, hit)
+		}
+		if !reflect.DeepEqual(manifest.Result.SubjectBounds, expected) {
+			t.Errorf("Run %d: expected subject bounds %+v, got %+v", i+1, expected, manifest.Result.SubjectBounds)
+		}
+	}
+	if tools.calls["detect"] != 1 {
+		t.Errorf("Expected one detect call, the legacy entry skipped and the new one reused, got %v", tools.calls)
+	}
+}
+
+// TestStageCacheRechecksSubjectConfidence verifies a segment cache hit is checked against
+// the current min_subject_confidence, which isn't part of the cache key
+func TestStageCacheRechecksSubjectConfidence(t *testing.T) {
+	cache, err := NewStageCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewStageCache failed: %v", err)
+	}
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tools := newFakeToolClient()
+	tools.detectResponse = `{"detections":[{"class":"person","confidence":0.35,"polygon":[[0,0],[10,0],[5,10]]}]}`
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetStageCache(cache)
+
+	if err := ExecuteSegmentPerson(context.Background(), p, newCacheTestManifest(t, imagePath, 0.3)); err != nil {
+		t.Fatalf("ExecuteSegmentPerson failed: %v", err)
+	}
+
+	p.SetMinSubjectConfidence(0.5)
+	err = ExecuteSegmentPerson(context.Background(), p, newCacheTestManifest(t, imagePath, 0.3))
+	if !errors.Is(err, ErrLowConfidenceDetection) {
+		t.Fatalf("Expected the cached detection to fail the raised threshold, got %v", err)
+	}
+	if tools.calls["detect"] != 1 {
+		t.Errorf("Expected the cached detection to be checked without detecting again, got %v", tools.calls)
+	}
+}
+
+// TestStageCacheDisabled verifies stages run normally without a cache
+func TestStageCacheDisabled(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	os.WriteFile(imagePath, []byte("photo"), 0644)
+
+	tools := newFakeToolClient()
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+
+	for i := 0; i < 2; i++ {
+		manifest := newCacheTestManifest(t, imagePath, 0.3)
+		if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+			t.Fatalf("ExecuteSegmentPerson failed: %v", err)
+		}
+	}
+	if tools.calls["fill"] != 2 {
+		t.Errorf("Expected fill on every run without a cache, got %d", tools.calls["fill"])
+	}
+}
+
+// TestStageCacheEviction verifies least recently used entries are evicted above the size limit
+func TestStageCacheEviction(t *testing.T) {
+	cache, err := NewStageCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewStageCache failed: %v", err)
+	}
+	if err := cache.Put("old", "tool", "", map[string]string{"v": "1"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	entry, ok := cache.Get("old")
+	if !ok {
+		t.Fatal("Expected entry to be stored")
+	}
+	entrySize := dirSize(entry.dir)
+
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(entry.dir, cacheEntryFile), past, past)
+
+	// Room for one entry only, so the older one must go
+	cache.maxBytes = entrySize + entrySize/2
+	if err := cache.Put("new", "tool", "", map[string]string{"v": "2"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if _, ok := cache.Get("old"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get("new"); !ok {
+		t.Error("Expected newest entry to be kept")
+	}
+}
@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Caption defaults for the drawtext filter
+const (
+	DefaultCaptionFontSize = 48
+	captionFontColor       = "white"
+)
+
+// drawtextOptionEscaper escapes a value inside a filter's option list, where ':' separates
+// options and quotes and backslashes are special
+var drawtextOptionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+
+// filtergraphEscaper escapes a filter's arguments inside a filtergraph (-vf), where
+// ',', ';' and brackets separate filters
+var filtergraphEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+
+// escapeDrawtextValue escapes a drawtext option value for use in an ffmpeg -vf argument.
+// Both escaping levels are applied: the option list, then the filtergraph.
+func escapeDrawtextValue(value string) string {
+	return filtergraphEscaper.Replace(drawtextOptionEscaper.Replace(value))
+}
+
+// ValidateCaptionConfig checks that the configured caption font can be read
+func ValidateCaptionConfig(config types.CaptionConfig) error {
+	if config.FontFile == "" {
+		return nil
+	}
+	_, err := loadFontCoverage(config.FontFile)
+	return err
+}
+
+// captionFilter returns the drawtext filter that renders text centred near the bottom
+// of the frame. Text must be valid UTF-8. With a font file, every character must have a
+// glyph in it, so captions never render as empty boxes; without one ffmpeg's fontconfig
+// default is used. Text expansion is disabled, so '%' is literal.
+func captionFilter(text string, config types.CaptionConfig) (string, error) {
+	if !utf8.ValidString(text) {
+		return "", fmt.Errorf("caption is not valid UTF-8: %q", text)
+	}
+	text = strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+
+	fontSize := config.FontSize
+	if fontSize <= 0 {
+		fontSize = DefaultCaptionFontSize
+	}
+
+	var options []string
+	if config.FontFile != "" {
+		coverage, err := loadFontCoverage(config.FontFile)
+		if err != nil {
+			return "", err
+		}
+		if missing := missingGlyphs(text, coverage); len(missing) > 0 {
+			return "", fmt.Errorf("font %s has no glyphs for %q; set pipeline.caption.font_file to a font that covers them",
+				config.FontFile, string(missing))
+		}
+		options = append(options, "fontfile="+escapeDrawtextValue(config.FontFile))
+	}
+	options = append(options,
+		"text="+escapeDrawtextValue(text),
+		"expansion=none",
+		fmt.Sprintf("fontsize=%d", fontSize),
+		"fontcolor="+captionFontColor,
+		"x=(w-text_w)/2",
+		fmt.Sprintf("y=h-text_h-%d", fontSize),
+	)
+	return "drawtext=" + strings.Join(options, ":"), nil
+}
+
+// missingGlyphs returns the distinct characters of text the font can't render. Line
+// breaks and invisible joiners and variation selectors need no glyph of their own.
+func missingGlyphs(text string, coverage *fontCoverage) []rune {
+	var missing []rune
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		if r == '\n' || r == '\u200d' || unicode.Is(unicode.Variation_Selector, r) || seen[r] {
+			continue
+		}
+		seen[r] = true
+		if !coverage.has(r) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
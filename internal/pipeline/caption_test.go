@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// writeTestFont writes a minimal sfnt file whose only table is a cmap with one Unicode
+// subtable of the given format (4 or 12) covering ranges
+func writeTestFont(t *testing.T, format int, ranges [][2]rune) string {
+	t.Helper()
+	be := binary.BigEndian
+
+	var subtable []byte
+	switch format {
+	case 4:
+		ranges = append(ranges, [2]rune{0xFFFF, 0xFFFF})
+		segCountX2 := 2 * len(ranges)
+		subtable = make([]byte, 16+4*segCountX2)
+		be.PutUint16(subtable[0:], 4)
+		be.PutUint16(subtable[2:], uint16(len(subtable)))
+		be.PutUint16(subtable[6:], uint16(segCountX2))
+		for i, r := range ranges {
+			be.PutUint16(subtable[14+2*i:], uint16(r[1]))
+			be.PutUint16(subtable[16+segCountX2+2*i:], uint16(r[0]))
+		}
+	case 12:
+		subtable = make([]byte, 16+12*len(ranges))
+		be.PutUint16(subtable[0:], 12)
+		be.PutUint32(subtable[4:], uint32(len(subtable)))
+		be.PutUint32(subtable[12:], uint32(len(ranges)))
+		for i, r := range ranges {
+			be.PutUint32(subtable[16+12*i:], uint32(r[0]))
+			be.PutUint32(subtable[20+12*i:], uint32(r[1]))
+		}
+	}
+
+	cmap := make([]byte, 12, 12+len(subtable))
+	be.PutUint16(cmap[2:], 1)  // One subtable
+	be.PutUint16(cmap[4:], 3)  // Windows platform
+	be.PutUint16(cmap[6:], 10) // Full Unicode encoding
+	be.PutUint32(cmap[8:], 12)
+	cmap = append(cmap, subtable...)
+
+	font := make([]byte, 28, 28+len(cmap))
+	be.PutUint32(font[0:], 0x00010000)
+	be.PutUint16(font[4:], 1) // One table
+	copy(font[12:], "cmap")
+	be.PutUint32(font[20:], 28)
+	be.PutUint32(font[24:], uint32(len(cmap)))
+	font = append(font, cmap...)
+
+	path := filepath.Join(t.TempDir(), "test.ttf")
+	if err := os.WriteFile(path, font, 0644); err != nil {
+		t.Fatalf("Failed to write font: %v", err)
+	}
+	return path
+}
+
+func TestEscapeDrawtextValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"Hello world", "Hello world"},
+		{"it's", `it\\\'s`},
+		{"Time: 10", `Time\\: 10`},
+		{"100% fun", "100% fun"},
+		{"one, two; [three]", `one\, two\; \[three\]`},
+		{`back\slash`, `back\\\\slash`},
+		{"派对 🎉", "派对 🎉"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeDrawtextValue(tt.value); got != tt.expected {
+			t.Errorf("escapeDrawtextValue(%q) = %q, want %q", tt.value, got, tt.expected)
+		}
+	}
+}
+
+// TestCaptionFilter verifies special characters survive and missing glyphs are reported
+func TestCaptionFilter(t *testing.T) {
+	ascii := [2]rune{0x20, 0x7E}
+	emoji := [2]rune{0x1F300, 0x1F5FF}
+	bmpFont := writeTestFont(t, 4, [][2]rune{ascii, {0x4E00, 0x9FFF}})
+	emojiFont := writeTestFont(t, 12, [][2]rune{ascii, emoji})
+
+	tests := []struct {
+		name        string
+		text        string
+		font        string
+		wantText    string // Escaped text option expected in the filter
+		wantMissing string // Characters the error must name
+	}{
+		{"colon", "Score: 10", bmpFont, `text=Score\\: 10:`, ""},
+		{"apostrophe", "Let's party", bmpFont, `text=Let\\\'s party:`, ""},
+		{"percent", "100% happy", bmpFont, "text=100% happy:expansion=none", ""},
+		{"cjk", "自拍照", bmpFont, "text=自拍照:", ""},
+		{"emoji covered", "Party 🎉", emojiFont, "text=Party 🎉:", ""},
+		{"emoji missing", "Party 🎉", bmpFont, "", "🎉"},
+		{"cjk missing", "自拍 🎉", emojiFont, "", "自拍"},
+		{"no font file", "Let's go: 100% 🎉", "", `text=Let\\\'s go\\: 100% 🎉:`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := captionFilter(tt.text, types.CaptionConfig{FontFile: tt.font})
+			if tt.wantMissing != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMissing) {
+					t.Errorf("Expected an error naming %q, got %v", tt.wantMissing, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("captionFilter failed: %v", err)
+			}
+			if !strings.HasPrefix(filter, "drawtext=") || !strings.Contains(filter, tt.wantText) {
+				t.Errorf("Expected %q in %q", tt.wantText, filter)
+			}
+			if tt.font != "" && !strings.Contains(filter, "fontfile="+escapeDrawtextValue(tt.font)) {
+				t.Errorf("Expected fontfile in %q", filter)
+			}
+		})
+	}
+}
+
+func TestCaptionFilterInvalidInput(t *testing.T) {
+	if _, err := captionFilter("bad \xff byte", types.CaptionConfig{}); err == nil {
+		t.Error("Expected an error for invalid UTF-8")
+	}
+	if _, err := captionFilter("hi", types.CaptionConfig{FontFile: filepath.Join(t.TempDir(), "missing.ttf")}); err == nil {
+		t.Error("Expected an error for a missing font file")
+	}
+
+	notFont := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(notFont, []byte("not a font"), 0644)
+	if err := ValidateCaptionConfig(types.CaptionConfig{FontFile: notFont}); err == nil {
+		t.Error("Expected an error for a file that is not a font")
+	}
+}
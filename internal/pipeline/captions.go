@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Sidecar caption formats (pipeline.captions.formats)
+const (
+	CaptionFormatSRT = "srt" // SubRip
+	CaptionFormatVTT = "vtt" // WebVTT
+)
+
+// blankLines matches the empty lines that end a cue in both formats
+var blankLines = regexp.MustCompile(`\n\s*\n`)
+
+// vttEscaper escapes cue text for WebVTT, where '<' starts a tag, '&' an entity and
+// "-->" separates timings
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// ResolveCaptionsConfig trims the caption text, checks the cue timings and fills in the
+// default formats when there is anything to caption
+func ResolveCaptionsConfig(config types.CaptionsConfig) (types.CaptionsConfig, error) {
+	config.Text = strings.TrimSpace(config.Text)
+	if config.Text != "" && len(config.Cues) > 0 {
+		return config, fmt.Errorf("set either captions text or cues, not both")
+	}
+
+	var cues []types.CaptionCue
+	for i, cue := range config.Cues {
+		cue.Text = strings.TrimSpace(cue.Text)
+		switch {
+		case cue.Text == "":
+			return config, fmt.Errorf("caption cue %d has no text", i+1)
+		case cue.Start < 0 || math.IsNaN(cue.Start):
+			return config, fmt.Errorf("caption cue %d starts at %g; must not be negative", i+1, cue.Start)
+		case cue.End != 0 && !(cue.End > cue.Start):
+			return config, fmt.Errorf("caption cue %d ends at %g, not after its start %g", i+1, cue.End, cue.Start)
+		}
+		cues = append(cues, cue)
+	}
+	config.Cues = cues
+
+	var formats []string
+	for _, format := range config.Formats {
+		format = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(format)), ".")
+		if format != CaptionFormatSRT && format != CaptionFormatVTT {
+			return config, fmt.Errorf("unsupported caption format %q (use %s or %s)", format, CaptionFormatSRT, CaptionFormatVTT)
+		}
+		if !containsString(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 && captionsEnabled(config) {
+		formats = []string{CaptionFormatSRT, CaptionFormatVTT}
+	}
+	config.Formats = formats
+	return config, nil
+}
+
+// captionsEnabled reports whether config has anything to caption
+func captionsEnabled(config types.CaptionsConfig) bool {
+	return config.Text != "" || len(config.Cues) > 0
+}
+
+// timedCaptionCues returns the cues of config for a clip lasting duration seconds: the
+// text for the whole clip, or the cues with open ends closed at the end of the clip.
+// Cues starting after the clip ends are dropped.
+func timedCaptionCues(config types.CaptionsConfig, duration float64) []types.CaptionCue {
+	if config.Text != "" {
+		return []types.CaptionCue{{Text: config.Text, Start: 0, End: duration}}
+	}
+
+	var cues []types.CaptionCue
+	for _, cue := range config.Cues {
+		if cue.Start >= duration {
+			log.Printf("Warning: dropping caption %q, which starts at %gs after the %.2fs clip ends", cue.Text, cue.Start, duration)
+			continue
+		}
+		if cue.End == 0 || cue.End > duration {
+			cue.End = duration
+		}
+		cues = append(cues, cue)
+	}
+	return cues
+}
+
+// formatCaptions renders cues as an SRT or WebVTT file
+func formatCaptions(cues []types.CaptionCue, format string) string {
+	var b strings.Builder
+	if format == CaptionFormatVTT {
+		b.WriteString("WEBVTT\n\n")
+	}
+	for i, cue := range cues {
+		// A blank line would end the cue early
+		text := blankLines.ReplaceAllString(strings.ReplaceAll(cue.Text, "\r\n", "\n"), "\n")
+		separator := ","
+		if format == CaptionFormatVTT {
+			text, separator = vttEscaper.Replace(text), "."
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1,
+			captionTimestamp(cue.Start, separator), captionTimestamp(cue.End, separator), text)
+	}
+	return b.String()
+}
+
+// captionTimestamp formats seconds as HH:MM:SS<separator>mmm
+func captionTimestamp(seconds float64, separator string) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+// captionPath returns where the captions of videoPath in format are written: beside
+// it, with the same name
+func captionPath(videoPath, format string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "." + format
+}
+
+// writeCaptions writes the configured sidecar captions for the final video at videoPath,
+// timed to its length, and returns their paths. Like the comparison video they are an
+// extra: a failure is recorded as a warning rather than failing the run.
+func (p *Pipeline) writeCaptions(ctx context.Context, manifest *Manifest, videoPath string) []string {
+	if !captionsEnabled(p.captionsConfig) {
+		return nil
+	}
+
+	duration, err := probeMediaDuration(ctx, videoPath)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: timing captions to the requested %.1fs, the video's length is unknown: %v", manifest.Input.Duration, err)
+		duration = manifest.Input.Duration
+	}
+	cues := timedCaptionCues(p.captionsConfig, duration)
+	if len(cues) == 0 {
+		return nil
+	}
+
+	var paths []string
+	for _, format := range p.captionsConfig.Formats {
+		path := captionPath(videoPath, format)
+		if err := os.WriteFile(path, []byte(formatCaptions(cues, format)), 0644); err != nil {
+			warning := fmt.Sprintf("The %s captions could not be written", strings.ToUpper(format))
+			log.Printf("Warning: %s: %v", warning, err)
+			manifest.Result.Warnings = append(manifest.Result.Warnings, warning)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) > 0 {
+		log.Printf("Wrote %d caption cue(s) to %s", len(cues), strings.Join(paths, ", "))
+	}
+	return paths
+}
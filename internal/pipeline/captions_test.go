@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveCaptionsConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    types.CaptionsConfig
+		expected  types.CaptionsConfig
+		expectErr bool
+	}{
+		{
+			name:     "empty writes nothing",
+			config:   types.CaptionsConfig{},
+			expected: types.CaptionsConfig{},
+		},
+		{
+			name:     "text gets both formats",
+			config:   types.CaptionsConfig{Text: "  Hello there "},
+			expected: types.CaptionsConfig{Text: "Hello there", Formats: []string{"srt", "vtt"}},
+		},
+		{
+			name:   "cues with formats normalized",
+			config: types.CaptionsConfig{Cues: []types.CaptionCue{{Text: " Hi ", Start: 0, End: 2}, {Text: "Bye", Start: 2}}, Formats: []string{"VTT", ".vtt"}},
+			expected: types.CaptionsConfig{
+				Cues:    []types.CaptionCue{{Text: "Hi", Start: 0, End: 2}, {Text: "Bye", Start: 2}},
+				Formats: []string{"vtt"},
+			},
+		},
+		{name: "text and cues", config: types.CaptionsConfig{Text: "Hi", Cues: []types.CaptionCue{{Text: "Bye"}}}, expectErr: true},
+		{name: "cue without text", config: types.CaptionsConfig{Cues: []types.CaptionCue{{Text: " ", End: 1}}}, expectErr: true},
+		{name: "negative start", config: types.CaptionsConfig{Cues: []types.CaptionCue{{Text: "Hi", Start: -1}}}, expectErr: true},
+		{name: "end before start", config: types.CaptionsConfig{Cues: []types.CaptionCue{{Text: "Hi", Start: 3, End: 2}}}, expectErr: true},
+		{name: "unknown format", config: types.CaptionsConfig{Text: "Hi", Formats: []string{"ass"}}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveCaptionsConfig(tt.config)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveCaptionsConfig failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestFormatCaptions verifies cues are timed to the clip and rendered in both formats
+func TestFormatCaptions(t *testing.T) {
+	config := types.CaptionsConfig{Cues: []types.CaptionCue{
+		{Text: "Say <cheese> & smile", Start: 0, End: 1.5},
+		{Text: "Line one\n\nLine two --> on", Start: 1.5},
+		{Text: "Too late", Start: 12},
+	}}
+	cues := timedCaptionCues(config, 3723.25)
+	if len(cues) != 3 || cues[1].End != 3723.25 {
+		t.Fatalf("Expected the open cue closed at the end of the clip, got %+v", cues)
+	}
+	cues = timedCaptionCues(config, 10)
+	if len(cues) != 2 || cues[1].End != 10 {
+		t.Fatalf("Expected the cue after the clip dropped, got %+v", cues)
+	}
+
+	srt := "1\n00:00:00,000 --> 00:00:01,500\nSay <cheese> & smile\n\n" +
+		"2\n00:00:01,500 --> 00:00:10,000\nLine one\nLine two --> on\n\n"
+	if got := formatCaptions(cues, CaptionFormatSRT); got != srt {
+		t.Errorf("Unexpected SRT:\n%s", got)
+	}
+	vtt := "WEBVTT\n\n" +
+		"1\n00:00:00.000 --> 00:00:01.500\nSay &lt;cheese&gt; &amp; smile\n\n" +
+		"2\n00:00:01.500 --> 00:00:10.000\nLine one\nLine two --&gt; on\n\n"
+	if got := formatCaptions(cues, CaptionFormatVTT); got != vtt {
+		t.Errorf("Unexpected WebVTT:\n%s", got)
+	}
+
+	if got := captionTimestamp(3723.2506, "."); got != "01:02:03.251" {
+		t.Errorf("Expected 01:02:03.251, got %s", got)
+	}
+}
+
+// TestWriteCaptions verifies captions are written beside the final video, timed to the
+// requested duration when the video can't be probed
+func TestWriteCaptions(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "final_output.mp4")
+	config, err := ResolveCaptionsConfig(types.CaptionsConfig{Text: "Happy birthday!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 1, "", "lightweight")
+	p.SetCaptionsConfig(config)
+	manifest := NewManifest("captions-test", types.PipelineInput{Duration: 4})
+	manifest.Result = &PipelineResult{}
+
+	paths := p.writeCaptions(context.Background(), manifest, videoPath)
+	expected := []string{filepath.Join(dir, "final_output.srt"), filepath.Join(dir, "final_output.vtt")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil || string(data) != "1\n00:00:00,000 --> 00:00:04,000\nHappy birthday!\n\n" {
+		t.Errorf("Unexpected SRT %q (err: %v)", data, err)
+	}
+
+	// Without text or cues nothing is written
+	p.SetCaptionsConfig(types.CaptionsConfig{})
+	if paths := p.writeCaptions(context.Background(), manifest, videoPath); paths != nil {
+		t.Errorf("Expected no captions, got %v", paths)
+	}
+}
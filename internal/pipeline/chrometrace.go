@@ -0,0 +1,283 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Span categories of a Chrome trace
+const (
+	SpanCategoryStage = "stage"
+	SpanCategoryTool  = "tool"
+	SpanCategoryLLM   = "llm"
+)
+
+// Span attributes, named after the OpenTelemetry semantic conventions so an OTLP
+// exporter can record the same spans with the same keys
+const (
+	SpanAttrPipelineID   = "pipeline.id"
+	SpanAttrStage        = "pipeline.stage"
+	SpanAttrAttempt      = "pipeline.stage.attempt"
+	SpanAttrToolServer   = "mcp.server"
+	SpanAttrToolName     = "mcp.tool"
+	SpanAttrLLMSystem    = "gen_ai.system"
+	SpanAttrLLMRound     = "gen_ai.round"
+	SpanAttrInputTokens  = "gen_ai.usage.input_tokens"
+	SpanAttrOutputTokens = "gen_ai.usage.output_tokens"
+	SpanAttrError        = "error.message"
+)
+
+// chromeTraceThreadBase is the first thread ID of each category; concurrent spans of
+// a category get consecutive IDs after it
+var chromeTraceThreadBase = map[string]int{
+	SpanCategoryStage: 1,
+	SpanCategoryTool:  100,
+	SpanCategoryLLM:   200,
+}
+
+// ChromeTraceEvent is an event of the Chrome trace event format read by chrome://tracing
+// and Perfetto: a complete span ("X") or thread metadata ("M")
+type ChromeTraceEvent struct {
+	Name     string                 `json:"name"`
+	Category string                 `json:"cat,omitempty"`
+	Phase    string                 `json:"ph"`
+	TS       int64                  `json:"ts"`            // Microseconds since the run started
+	Duration int64                  `json:"dur,omitempty"` // Microseconds
+	PID      int                    `json:"pid"`
+	TID      int                    `json:"tid"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTraceFile is the JSON object written by ChromeTrace.Save
+type ChromeTraceFile struct {
+	TraceEvents     []ChromeTraceEvent     `json:"traceEvents"`
+	DisplayTimeUnit string                 `json:"displayTimeUnit"`
+	OtherData       map[string]interface{} `json:"otherData,omitempty"`
+}
+
+// ChromeTrace records a run's stages, tool calls and LLM rounds as spans for a timeline.
+// Methods are safe for concurrent use and do nothing on a nil trace.
+type ChromeTrace struct {
+	mu         sync.Mutex
+	pipelineID string
+	started    time.Time
+	events     []ChromeTraceEvent
+	lanes      map[string][]time.Time // End of the last span on each thread, by category
+	provider   string                 // LLM provider of the conversation
+	roundStart time.Time              // When the model was last handed the conversation
+}
+
+// NewChromeTrace starts a trace of pipelineID's run
+func NewChromeTrace(pipelineID string) *ChromeTrace {
+	now := time.Now()
+	return &ChromeTrace{
+		pipelineID: pipelineID,
+		started:    now,
+		lanes:      make(map[string][]time.Time),
+		roundStart: now,
+	}
+}
+
+// stage records one attempt of a stage
+func (t *ChromeTrace) stage(stage types.PipelineStage, attempt int, start time.Time, err error) {
+	args := map[string]interface{}{SpanAttrStage: string(stage), SpanAttrAttempt: attempt}
+	t.span(string(stage), SpanCategoryStage, start, time.Now(), args, err)
+}
+
+// toolCall records an MCP tool call
+func (t *ChromeTrace) toolCall(server, tool string, start, end time.Time, err error) {
+	args := map[string]interface{}{SpanAttrToolServer: server, SpanAttrToolName: tool}
+	t.span(server+"/"+tool, SpanCategoryTool, start, end, args, err)
+	t.handBack(end)
+}
+
+// observeToolCall records a tool call made through the full AI tool adapter; it is an
+// llm.ToolCallObserver
+func (t *ChromeTrace) observeToolCall(call llm.ObservedToolCall) {
+	t.toolCall(call.Server, call.Tool, call.Started, call.Started.Add(call.Duration), call.Err)
+}
+
+// startConversation marks the start of a full AI conversation with provider
+func (t *ChromeTrace) startConversation(provider string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.provider = provider
+	t.roundStart = time.Now()
+}
+
+// llmRound records a model response, spanning from when the model was last handed the
+// conversation: its start, or the end of the round or tool call before
+func (t *ChromeTrace) llmRound(round int, turn llm.TraceTurn) {
+	if t == nil {
+		return
+	}
+	end := time.Now()
+	t.mu.Lock()
+	start, provider := t.roundStart, t.provider
+	t.mu.Unlock()
+
+	t.span(fmt.Sprintf("llm round %d", round), SpanCategoryLLM, start, end, map[string]interface{}{
+		SpanAttrLLMSystem:    provider,
+		SpanAttrLLMRound:     round,
+		SpanAttrInputTokens:  turn.InputTokens,
+		SpanAttrOutputTokens: turn.OutputTokens,
+	}, nil)
+	t.handBack(end)
+}
+
+// handBack moves the start of the next LLM round to at, when later
+func (t *ChromeTrace) handBack(at time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.After(t.roundStart) {
+		t.roundStart = at
+	}
+}
+
+// span records a complete span from start to end on the first thread of category free
+// since start, so concurrent spans never share a thread
+func (t *ChromeTrace) span(name, category string, start, end time.Time, args map[string]interface{}, err error) {
+	if t == nil {
+		return
+	}
+	args[SpanAttrPipelineID] = t.pipelineID
+	if err != nil {
+		args[SpanAttrError] = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lanes := t.lanes[category]
+	lane := 0
+	for lane < len(lanes) && lanes[lane].After(start) {
+		lane++
+	}
+	if lane == len(lanes) {
+		lanes = append(lanes, end)
+		t.events = append(t.events, threadNameEvent(category, lane))
+	} else if end.After(lanes[lane]) {
+		lanes[lane] = end
+	}
+	t.lanes[category] = lanes
+
+	t.events = append(t.events, ChromeTraceEvent{
+		Name:     name,
+		Category: category,
+		Phase:    "X",
+		TS:       start.Sub(t.started).Microseconds(),
+		Duration: end.Sub(start).Microseconds(),
+		PID:      1,
+		TID:      chromeTraceThreadBase[category] + lane,
+		Args:     args,
+	})
+}
+
+// threadNameEvent names the thread of a category's lane, e.g. "tool 2"
+func threadNameEvent(category string, lane int) ChromeTraceEvent {
+	name := category
+	if lane > 0 {
+		name = fmt.Sprintf("%s %d", category, lane+1)
+	}
+	return ChromeTraceEvent{
+		Name:  "thread_name",
+		Phase: "M",
+		PID:   1,
+		TID:   chromeTraceThreadBase[category] + lane,
+		Args:  map[string]interface{}{"name": name},
+	}
+}
+
+// File returns the trace in the Chrome trace event format
+func (t *ChromeTrace) File() *ChromeTraceFile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := append([]ChromeTraceEvent{{
+		Name:  "process_name",
+		Phase: "M",
+		PID:   1,
+		Args:  map[string]interface{}{"name": "pipeline " + t.pipelineID},
+	}}, t.events...)
+	return &ChromeTraceFile{
+		TraceEvents:     events,
+		DisplayTimeUnit: "ms",
+		OtherData: map[string]interface{}{
+			SpanAttrPipelineID: t.pipelineID,
+			"started_at":       t.started.UTC().Format(time.RFC3339Nano),
+		},
+	}
+}
+
+// Save writes the trace as JSON, replacing path atomically
+func (t *ChromeTrace) Save(path string) error {
+	if t == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(t.File(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save trace: %w", err)
+	}
+	return nil
+}
+
+// SetTraceJSONFile writes a timeline of each run's stages, tool calls and LLM rounds to
+// path in the Chrome trace event format, for chrome://tracing or Perfetto. Empty disables it.
+func (p *Pipeline) SetTraceJSONFile(path string) {
+	p.traceJSONFile = path
+}
+
+// startChromeTrace returns a trace of the run when a trace JSON file is set, else nil
+func (p *Pipeline) startChromeTrace(pipelineID string) *ChromeTrace {
+	if p.traceJSONFile == "" {
+		return nil
+	}
+	return NewChromeTrace(pipelineID)
+}
+
+// saveChromeTrace writes the run's trace to the trace JSON file. Failures are logged:
+// the trace must not fail the run it describes.
+func (p *Pipeline) saveChromeTrace(trace *ChromeTrace) {
+	if trace == nil {
+		return
+	}
+	if err := trace.Save(p.traceJSONFile); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	log.Printf("Timeline trace written to %s", p.traceJSONFile)
+}
+
+type chromeTraceKey struct{}
+
+// withChromeTrace returns ctx carrying the run's trace for stages and steps
+func withChromeTrace(ctx context.Context, trace *ChromeTrace) context.Context {
+	return context.WithValue(ctx, chromeTraceKey{}, trace)
+}
+
+// chromeTraceFrom returns the run's trace, or nil
+func chromeTraceFrom(ctx context.Context) *ChromeTrace {
+	trace, _ := ctx.Value(chromeTraceKey{}).(*ChromeTrace)
+	return trace
+}
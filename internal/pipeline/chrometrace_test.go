@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// readChromeTrace decodes a trace file written by ChromeTrace.Save
+func readChromeTrace(t *testing.T, path string) *ChromeTraceFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+	var file ChromeTraceFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("Malformed trace: %v", err)
+	}
+	return &file
+}
+
+// TestChromeTraceScriptedRun verifies a run's stages and tool calls become spans with
+// their attributes, each on a named thread
+func TestChromeTraceScriptedRun(t *testing.T) {
+	root := t.TempDir()
+	tools := newFakeToolClient()
+	registry := NewStepRegistry()
+	registry.Register(types.StageSegmentPerson, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		if _, err := callTool(ctx, "yolo", tools, "detect", map[string]interface{}{}); err != nil {
+			return err
+		}
+		return manifest.CompleteStage(types.StageSegmentPerson, map[string]string{})
+	})
+	registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		return errors.New("mux failed")
+	})
+
+	tracePath := filepath.Join(root, "trace.json")
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 1, filepath.Join(root, "manifest.json"), "lightweight")
+	p.SetStepRegistry(registry)
+	p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, types.StageCompose})
+	p.SetTraceJSONFile(tracePath)
+	input := types.PipelineInput{Duration: 3, TempDir: filepath.Join(root, "temp"), OutputDir: root}
+	if _, err := p.Execute(context.Background(), input, "trace-test"); err == nil {
+		t.Fatal("Expected the failing compose to fail the run")
+	}
+
+	file := readChromeTrace(t, tracePath)
+	if file.DisplayTimeUnit != "ms" || file.OtherData[SpanAttrPipelineID] != "trace-test" {
+		t.Errorf("Unexpected trace header %q %v", file.DisplayTimeUnit, file.OtherData)
+	}
+
+	threads := make(map[int]bool)
+	spans := make(map[string]ChromeTraceEvent)
+	for _, event := range file.TraceEvents {
+		if event.PID != 1 {
+			t.Errorf("Expected every event in process 1, got %+v", event)
+		}
+		switch event.Phase {
+		case "M":
+			if event.Name == "thread_name" {
+				threads[event.TID] = true
+			}
+		case "X":
+			if event.TS < 0 || event.Duration < 0 {
+				t.Errorf("Expected a span within the run, got %+v", event)
+			}
+			if event.Args[SpanAttrPipelineID] != "trace-test" {
+				t.Errorf("Expected span %s to carry the pipeline ID, got %v", event.Name, event.Args)
+			}
+			spans[event.Name] = event
+		default:
+			t.Errorf("Unexpected phase %q", event.Phase)
+		}
+	}
+	if len(spans) != 3 {
+		t.Fatalf("Expected spans for two stages and a tool call, got %v", spans)
+	}
+
+	segment, detect, compose := spans["segment_person"], spans["yolo/detect"], spans["compose"]
+	if segment.Category != SpanCategoryStage || segment.Args[SpanAttrStage] != "segment_person" || segment.Args[SpanAttrAttempt] != 1.0 {
+		t.Errorf("Unexpected stage span %+v", segment)
+	}
+	if detect.Category != SpanCategoryTool || detect.Args[SpanAttrToolServer] != "yolo" || detect.Args[SpanAttrToolName] != "detect" {
+		t.Errorf("Unexpected tool span %+v", detect)
+	}
+	if detect.TS < segment.TS || detect.TS+detect.Duration > segment.TS+segment.Duration {
+		t.Errorf("Expected the tool call within its stage, got %+v in %+v", detect, segment)
+	}
+	if compose.Args[SpanAttrError] != "mux failed" {
+		t.Errorf("Expected the failed stage to carry its error, got %v", compose.Args)
+	}
+	for _, span := range spans {
+		if !threads[span.TID] {
+			t.Errorf("Expected thread %d of span %s to be named", span.TID, span.Name)
+		}
+	}
+}
+
+// TestChromeTraceConversation verifies LLM rounds span from the end of the previous
+// tool call, and concurrent tool calls get their own threads
+func TestChromeTraceConversation(t *testing.T) {
+	trace := NewChromeTrace("conversation-test")
+	trace.startConversation("anthropic")
+	trace.llmRound(1, llm.TraceTurn{InputTokens: 900, OutputTokens: 40})
+
+	start := time.Now()
+	trace.observeToolCall(llm.ObservedToolCall{Server: "yolo", Tool: "detect", Started: start, Duration: 20 * time.Millisecond})
+	trace.observeToolCall(llm.ObservedToolCall{Server: "imagesorcery", Tool: "fill", Started: start, Duration: 30 * time.Millisecond})
+	trace.llmRound(2, llm.TraceTurn{InputTokens: 1200, OutputTokens: 10})
+
+	var rounds, calls []ChromeTraceEvent
+	for _, event := range trace.File().TraceEvents {
+		switch {
+		case event.Phase != "X":
+		case event.Category == SpanCategoryLLM:
+			rounds = append(rounds, event)
+		case event.Category == SpanCategoryTool:
+			calls = append(calls, event)
+		}
+	}
+	if len(rounds) != 2 || len(calls) != 2 {
+		t.Fatalf("Expected two rounds and two tool calls, got %v and %v", rounds, calls)
+	}
+	if rounds[0].Args[SpanAttrLLMSystem] != "anthropic" || rounds[0].Args[SpanAttrInputTokens] != 900 {
+		t.Errorf("Unexpected round attributes %v", rounds[0].Args)
+	}
+	if calls[0].TID == calls[1].TID {
+		t.Errorf("Expected concurrent tool calls on separate threads, both got %d", calls[0].TID)
+	}
+	if lastCallEnd := calls[1].TS + calls[1].Duration; rounds[1].TS != lastCallEnd {
+		t.Errorf("Expected round 2 to start when the last tool call ended at %d, got %d", lastCallEnd, rounds[1].TS)
+	}
+}
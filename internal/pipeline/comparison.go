@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Comparison layouts
+const (
+	ComparisonHorizontal = "horizontal" // Original left of the result (hstack)
+	ComparisonVertical   = "vertical"   // Original above the result (vstack)
+)
+
+// Comparison defaults
+const (
+	DefaultComparisonDividerWidth = 8
+	DefaultComparisonDividerColor = "white"
+	DefaultComparisonBeforeLabel  = "Before"
+	DefaultComparisonAfterLabel   = "After"
+)
+
+// comparisonSuffix is appended to the final output's name for the comparison video
+const comparisonSuffix = "_comparison.mp4"
+
+// ResolveComparisonConfig fills in the comparison defaults and checks the layout
+func ResolveComparisonConfig(config types.ComparisonConfig) (types.ComparisonConfig, error) {
+	config.Layout = strings.ToLower(strings.TrimSpace(config.Layout))
+	switch config.Layout {
+	case "":
+		config.Layout = ComparisonHorizontal
+	case ComparisonHorizontal, ComparisonVertical:
+	default:
+		return config, fmt.Errorf("unsupported comparison layout %q (use %s or %s)", config.Layout, ComparisonHorizontal, ComparisonVertical)
+	}
+
+	if config.DividerWidth < 0 {
+		return config, fmt.Errorf("comparison divider_width must not be negative")
+	}
+	if config.DividerWidth == 0 {
+		config.DividerWidth = DefaultComparisonDividerWidth
+	}
+	// Subsampled output needs even dimensions
+	config.DividerWidth += config.DividerWidth % 2
+
+	if config.DividerColor == "" {
+		config.DividerColor = DefaultComparisonDividerColor
+	}
+	if strings.ContainsAny(config.DividerColor, ":,;[]'\\") {
+		return config, fmt.Errorf("invalid comparison divider_color %q", config.DividerColor)
+	}
+	if config.BeforeLabel == "" {
+		config.BeforeLabel = DefaultComparisonBeforeLabel
+	}
+	if config.AfterLabel == "" {
+		config.AfterLabel = DefaultComparisonAfterLabel
+	}
+	return config, nil
+}
+
+// comparisonPath returns where the comparison video of outputPath is written
+func comparisonPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + comparisonSuffix
+}
+
+// comparisonArgs returns the ffmpeg arguments that place the still at imagePath beside
+// (or above) the width x height video at videoPath. The still is scaled to the video's
+// height (width when vertical) keeping its aspect, and the divider is padded onto it.
+// The video's audio is kept when it has any.
+func comparisonArgs(videoPath, imagePath, outputPath string, width, height int, config types.ComparisonConfig, caption types.CaptionConfig) ([]string, error) {
+	before := fmt.Sprintf("scale=-2:%d,setsar=1", height)
+	divider := fmt.Sprintf("pad=iw+%d:ih:0:0:color=%s", config.DividerWidth, config.DividerColor)
+	stack := "hstack"
+	if config.Layout == ComparisonVertical {
+		before = fmt.Sprintf("scale=%d:-2,setsar=1", width)
+		divider = fmt.Sprintf("pad=iw:ih+%d:0:0:color=%s", config.DividerWidth, config.DividerColor)
+		stack = "vstack"
+	}
+	after := "setsar=1"
+
+	if !config.DisableLabels {
+		if caption.FontSize <= 0 {
+			caption.FontSize = comparisonLabelSize(width, height, config.Layout)
+		}
+		beforeLabel, err := captionFilter(config.BeforeLabel, caption)
+		if err != nil {
+			return nil, err
+		}
+		afterLabel, err := captionFilter(config.AfterLabel, caption)
+		if err != nil {
+			return nil, err
+		}
+		before += "," + beforeLabel
+		after += "," + afterLabel
+	}
+
+	graph := fmt.Sprintf("[1:v]%s,%s[before];[0:v]%s[after];[before][after]%s=inputs=2:shortest=1,pad=ceil(iw/2)*2:ceil(ih/2)*2,format=yuv420p[v]",
+		before, divider, after, stack)
+	return []string{"-y",
+		"-i", videoPath,
+		"-loop", "1", "-i", imagePath,
+		"-filter_complex", graph,
+		"-map", "[v]",
+		"-map", "0:a:0?",
+		"-c:v", "libx264",
+		"-c:a", "aac",
+		"-shortest",
+		outputPath,
+	}, nil
+}
+
+// comparisonLabelSize returns a label font size in proportion to the panel's shorter side
+func comparisonLabelSize(width, height int, layout string) int {
+	side := height
+	if layout == ComparisonVertical && width < height {
+		side = width
+	}
+	if size := side / 12; size > 16 {
+		return size
+	}
+	return 16
+}
+
+// writeComparison renders the comparison video of the final output at videoPath with
+// the original still at imagePath. Returns its path.
+func writeComparison(ctx context.Context, videoPath, imagePath string, config types.ComparisonConfig, caption types.CaptionConfig) (string, error) {
+	width, height, err := probeVideoSize(ctx, videoPath)
+	if err != nil {
+		return "", err
+	}
+	outputPath := comparisonPath(videoPath)
+	partial := partialPath(outputPath)
+	args, err := comparisonArgs(videoPath, imagePath, partial, width, height, config, caption)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := procgroup.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("ffmpeg comparison failed: %w, output: %s", err, output)
+	}
+	if err := commitArtifact(partial, outputPath); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// probeVideoSize returns the width and height of a video's first video stream
+func probeVideoSize(ctx context.Context, path string) (int, int, error) {
+	cmd := procgroup.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "json",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseProbedSize(output)
+}
+
+// parseProbedSize reads the first stream's dimensions from ffprobe JSON output
+func parseProbedSize(probeJSON []byte) (int, int, error) {
+	var probe struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(probeJSON, &probe); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 || probe.Streams[0].Width <= 0 || probe.Streams[0].Height <= 0 {
+		return 0, 0, fmt.Errorf("video has no video stream with a size")
+	}
+	return probe.Streams[0].Width, probe.Streams[0].Height, nil
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveComparisonConfig(t *testing.T) {
+	config, err := ResolveComparisonConfig(types.ComparisonConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("ResolveComparisonConfig failed: %v", err)
+	}
+	expected := types.ComparisonConfig{Enabled: true, Layout: ComparisonHorizontal, DividerWidth: 8, DividerColor: "white", BeforeLabel: "Before", AfterLabel: "After"}
+	if config != expected {
+		t.Errorf("Expected %+v, got %+v", expected, config)
+	}
+
+	config, err = ResolveComparisonConfig(types.ComparisonConfig{Layout: " Vertical ", DividerWidth: 5, DividerColor: "0x336699"})
+	if err != nil || config.Layout != ComparisonVertical || config.DividerWidth != 6 || config.DividerColor != "0x336699" {
+		t.Errorf("Expected vertical with an even divider, got %+v (%v)", config, err)
+	}
+
+	for _, invalid := range []types.ComparisonConfig{
+		{Layout: "diagonal"},
+		{DividerWidth: -1},
+		{DividerColor: "white:x=0"},
+	} {
+		if _, err := ResolveComparisonConfig(invalid); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+// TestComparisonArgs verifies the still is scaled to the video's height (or width when
+// stacked), split from it by the divider and labeled
+func TestComparisonArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config types.ComparisonConfig
+		want   []string
+		absent []string
+	}{
+		{
+			name:   "horizontal",
+			config: types.ComparisonConfig{},
+			want: []string{"[1:v]scale=-2:720,setsar=1,drawtext=", "text=Before", "pad=iw+8:ih:0:0:color=white[before]",
+				"[0:v]setsar=1,drawtext=", "text=After", "fontsize=60", "[before][after]hstack=inputs=2:shortest=1"},
+		},
+		{
+			name:   "vertical without labels",
+			config: types.ComparisonConfig{Layout: "vertical", DisableLabels: true},
+			want:   []string{"[1:v]scale=1280:-2,setsar=1,pad=iw:ih+8:0:0:color=white[before]", "[0:v]setsar=1[after]", "vstack=inputs=2"},
+			absent: []string{"drawtext"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ResolveComparisonConfig(tt.config)
+			if err != nil {
+				t.Fatalf("ResolveComparisonConfig failed: %v", err)
+			}
+			args, err := comparisonArgs("/out/final_output.mp4", "/in/photo.png", "/out/final_output_comparison.mp4", 1280, 720, config, types.CaptionConfig{})
+			if err != nil {
+				t.Fatalf("comparisonArgs failed: %v", err)
+			}
+
+			joined := strings.Join(args, " ")
+			if !strings.Contains(joined, "-i /out/final_output.mp4 -loop 1 -i /in/photo.png") ||
+				!strings.Contains(joined, "-map [v] -map 0:a:0?") || args[len(args)-1] != "/out/final_output_comparison.mp4" {
+				t.Errorf("Unexpected inputs or outputs: %v", args)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(joined, want) {
+					t.Errorf("Expected %q in %s", want, joined)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(joined, absent) {
+					t.Errorf("Unexpected %q in %s", absent, joined)
+				}
+			}
+		})
+	}
+}
+
+func TestParseProbedSize(t *testing.T) {
+	width, height, err := parseProbedSize([]byte(`{"streams": [{"width": 640, "height": 480}]}`))
+	if err != nil || width != 640 || height != 480 {
+		t.Errorf("Expected 640x480, got %dx%d (%v)", width, height, err)
+	}
+	if _, _, err := parseProbedSize([]byte(`{"streams": []}`)); err == nil {
+		t.Error("Expected an error without a video stream")
+	}
+}
+
+func TestComparisonPath(t *testing.T) {
+	if got := comparisonPath("/out/3f2a9c0d1e4b5a6f.mkv"); got != "/out/3f2a9c0d1e4b5a6f_comparison.mp4" {
+		t.Errorf("Unexpected comparison path %s", got)
+	}
+}
@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/activity"
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Compose failure policies: what the compose stage does when muxing music into the video fails
+const (
+	ComposeFailureFallback = "fallback_no_audio" // Write the video without audio (default)
+	ComposeFailureFail     = "fail"              // Fail the compose stage
+	ComposeFailureRetry    = "retry"             // Retry the mux, then fail the compose stage
+)
+
+// composeMuxAttempts is how many times the retry policy runs the mux
+const composeMuxAttempts = 3
+
+// ResolveComposeFailure validates a compose failure policy; empty selects the fallback
+func ResolveComposeFailure(policy string) (string, error) {
+	switch policy {
+	case "":
+		return ComposeFailureFallback, nil
+	case ComposeFailureFallback, ComposeFailureFail, ComposeFailureRetry:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown compose_failure policy %q (supported: %s, %s, %s)",
+			policy, ComposeFailureFallback, ComposeFailureFail, ComposeFailureRetry)
+	}
+}
+
+// runMux runs ffmpeg with the given arguments and returns its combined output
+func runMux(ctx context.Context, args []string) ([]byte, error) {
+	return procgroup.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+}
+
+// muxWithPolicy runs mux according to policy. It returns fallback=true when the
+// caller should write the video without audio, and an error when the stage must fail.
+func muxWithPolicy(ctx context.Context, policy string, mux func() ([]byte, error)) (fallback bool, err error) {
+	attempts := 1
+	if policy == ComposeFailureRetry {
+		attempts = composeMuxAttempts
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		output, err := mux()
+		if err == nil {
+			return false, nil
+		}
+		lastErr = fmt.Errorf("ffmpeg mux failed: %w, output: %s", err, output)
+		log.Printf("Warning: adding music failed (attempt %d/%d): %v", attempt, attempts, lastErr)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+	}
+
+	if policy == ComposeFailureFail || policy == ComposeFailureRetry {
+		return false, lastErr
+	}
+	log.Printf("Warning: falling back to video without audio (compose_failure: %s)", ComposeFailureFallback)
+	return true, nil
+}
+
+// ComposeOnly runs just the compose stage, so a different soundtrack can be tried without
+// segmenting and rendering again. A manifest already in the store is reused: its motion
+// video, unless videoPath replaces it, and its music search results when input has no
+// AudioPath. Otherwise a minimal manifest is built around videoPath.
+func (p *Pipeline) ComposeOnly(ctx context.Context, input types.PipelineInput, videoPath, pipelineID string) (*PipelineResult, error) {
+	lock, err := p.acquireRunLock()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	events := p.openRunEventLog(input, pipelineID)
+	defer events.Close()
+	defer activity.Default.Finish(pipelineID)
+
+	trace := p.startChromeTrace(pipelineID)
+	defer p.saveChromeTrace(trace)
+
+	ctx = activity.WithPipeline(withChromeTrace(withEventLog(ctx, events), trace), pipelineID)
+	result, err := p.composeOnly(ctx, input, videoPath, pipelineID)
+	events.runFinished(result, err)
+	return result, err
+}
+
+// composeOnly builds or resumes the manifest and runs the compose stage for ComposeOnly
+func (p *Pipeline) composeOnly(ctx context.Context, input types.PipelineInput, videoPath, pipelineID string) (*PipelineResult, error) {
+	manifest, err := p.manifestStore.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	if manifest == nil {
+		manifest = NewManifest(pipelineID, input)
+		log.Printf("Created compose-only manifest: %s", pipelineID)
+	} else {
+		log.Printf("Composing pipeline %s again", manifest.PipelineID)
+		if err := p.repairOrphanedStages(ctx, manifest); err != nil {
+			return nil, err
+		}
+		manifest.Input.AudioPath = input.AudioPath
+		manifest.Input.OutputDir = input.OutputDir
+		manifest.Input.TempDir = input.TempDir
+	}
+	if events := eventLogFrom(ctx); events != nil {
+		manifest.EventsFile = events.Path()
+	}
+	if manifest.Result == nil {
+		manifest.Result = &PipelineResult{}
+	}
+	if videoPath != "" {
+		manifest.Result.MotionVideoPath = videoPath
+	}
+	if err := checkComposeVideo(manifest.Result.MotionVideoPath); err != nil {
+		return nil, err
+	}
+
+	// A finished run keeps its compose stage completed; reset it so compose runs again
+	// and picks its music afresh
+	manifest.Stages[types.StageCompose] = &StageState{Status: types.StatusPending}
+	manifest.Compose = nil
+	if err := p.executeStageWithRetry(ctx, types.StageCompose, manifest); err != nil {
+		manifest.FailStage(types.StageCompose, err)
+		if saveErr := p.saveManifest(ctx, manifest); saveErr != nil {
+			log.Printf("Warning: failed to save manifest after error: %v", saveErr)
+		}
+		return nil, &StageError{Stage: types.StageCompose, Err: err}
+	}
+
+	manifest.CurrentStage = types.StageComplete
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		return nil, fmt.Errorf("failed to save final manifest: %w", err)
+	}
+	return manifest.Result, nil
+}
+
+// checkComposeVideo checks the motion video handed to ComposeOnly is an existing file
+func checkComposeVideo(path string) error {
+	if path == "" {
+		return fmt.Errorf("compose-only needs a motion video: pass one or resume a manifest that has one")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("motion video not found: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("motion video %s is a directory", path)
+	}
+	return nil
+}
+
+// prepareComposeMusic selects the searched track compose muxes and downloads it. Both
+// sub-steps are recorded in progress, so a compose running again keeps the track while
+// the search still returns it and reuses a download that is still on disk. It returns
+// an empty path when there is no music to add; a failed download leaves the video
+// without music.
+func (p *Pipeline) prepareComposeMusic(ctx context.Context, manifest *Manifest, progress *ComposeProgress) (*MusicTrack, string, error) {
+	tracks := searchedMusicTracks(manifest, p.musicConfig)
+	if len(tracks) == 0 {
+		return nil, "", nil
+	}
+
+	if progress.Track != nil && containsTrack(tracks, *progress.Track) {
+		log.Printf("Reusing selected track: '%s' (%s quality)", progress.Track.Title, progress.Track.Quality)
+	} else {
+		// Pick a track with the configured selection strategy
+		track := selectMusicTrack(tracks, p.musicConfig, manifest.PipelineID)
+		progress.Track, progress.MusicPath = &track, ""
+		log.Printf("Selected track: '%s' (%s quality)", track.Title, track.Quality)
+	}
+	track := progress.Track
+
+	if progress.MusicPath != "" && fileExists(progress.MusicPath) {
+		log.Printf("Reusing downloaded music: %s", progress.MusicPath)
+		return track, progress.MusicPath, nil
+	}
+
+	log.Printf("Downloading music from: %s", track.URL)
+	musicPath, err := stageArtifactPath(manifest, types.StageCompose, manifest.Input.TempDir, musicFileName)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := downloadMusic(ctx, track.URL, musicPath); err != nil {
+		log.Printf("Failed to download music: %v, continuing without music", err)
+		return nil, "", nil
+	}
+	log.Println("Music downloaded successfully")
+
+	// Checkpoint, so not even a crash during the mux downloads the track again
+	progress.MusicPath = musicPath
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		log.Printf("Warning: failed to save manifest after music download: %v", err)
+	}
+	return track, musicPath, nil
+}
+
+// searchedMusicTracks returns the tracks in the search_music stage's output, none when
+// the stage didn't run or its results can't be read
+func searchedMusicTracks(manifest *Manifest, config types.MusicConfig) []MusicTrack {
+	stageData := manifest.Stages[types.StageSearchMusic]
+	if stageData == nil || len(stageData.Output) == 0 {
+		return nil
+	}
+
+	var stageOutput map[string]interface{}
+	if err := json.Unmarshal(stageData.Output, &stageOutput); err != nil {
+		log.Printf("Failed to parse stage output: %v", err)
+		return nil
+	}
+	musicData, ok := stageOutput["data"].(string)
+	if !ok || musicData == "" {
+		return nil
+	}
+	log.Println("Found music data, extracting track URL...")
+
+	// Parse the response using the configured field mapping
+	tracks, err := parseMusicTracks(musicData, config)
+	if err != nil {
+		log.Printf("Failed to parse music data: %v, continuing without music", err)
+		return nil
+	}
+	return tracks
+}
+
+// containsTrack reports whether tracks has one with the same URL as track
+func containsTrack(tracks []MusicTrack, track MusicTrack) bool {
+	for _, t := range tracks {
+		if t.URL == track.URL {
+			return true
+		}
+	}
+	return false
+}
+
+// musicProvenance records the searched track muxed into the final output
+func (p *Pipeline) musicProvenance(track MusicTrack) *types.ToolProvenance {
+	source := toolProvenance("music", p.musicClient, "SearchRecordings")
+	source.TrackID = track.ID
+	source.TrackTitle = track.Title
+	return source
+}
+
+// fileExists reports whether path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveComposeFailure(t *testing.T) {
+	tests := []struct {
+		policy    string
+		expected  string
+		expectErr bool
+	}{
+		{"", ComposeFailureFallback, false},
+		{"fallback_no_audio", ComposeFailureFallback, false},
+		{"fail", ComposeFailureFail, false},
+		{"retry", ComposeFailureRetry, false},
+		{"ignore", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveComposeFailure(tt.policy)
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("ResolveComposeFailure(%q): expected error", tt.policy)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("ResolveComposeFailure(%q) = %q, %v; want %q", tt.policy, got, err, tt.expected)
+		}
+	}
+}
+
+func TestMuxWithPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		failures     int // Mux calls that fail before one succeeds
+		wantCalls    int
+		wantFallback bool
+		wantErr      bool
+	}{
+		{"success", ComposeFailureFallback, 0, 1, false, false},
+		{"fallback", ComposeFailureFallback, 1, 1, true, false},
+		{"fail", ComposeFailureFail, 1, 1, false, true},
+		{"retry recovers", ComposeFailureRetry, 2, 3, false, false},
+		{"retry exhausted", ComposeFailureRetry, composeMuxAttempts, composeMuxAttempts, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			fallback, err := muxWithPolicy(context.Background(), tt.policy, func() ([]byte, error) {
+				calls++
+				if calls <= tt.failures {
+					return []byte("Invalid data found"), errors.New("exit status 1")
+				}
+				return nil, nil
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("mux calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if fallback != tt.wantFallback {
+				t.Errorf("fallback = %v, want %v", fallback, tt.wantFallback)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMuxWithPolicyStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := muxWithPolicy(ctx, ComposeFailureRetry, func() ([]byte, error) {
+		calls++
+		cancel()
+		return nil, errors.New("signal: killed")
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected one call and context.Canceled, got %d calls, err %v", calls, err)
+	}
+}
+
+// TestComposeOnly verifies compose runs alone on a given video, reusing a stored manifest
+// and rejecting a missing video
+func TestComposeOnly(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "motion.mp4")
+	if err := os.WriteFile(videoPath, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to write video: %v", err)
+	}
+
+	var composedVideo string
+	registry := NewStepRegistry()
+	registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		composedVideo = manifest.Result.MotionVideoPath
+		manifest.Result.FinalOutputPath = filepath.Join(manifest.Input.OutputDir, "final.mp4")
+		return manifest.CompleteStage(types.StageCompose, map[string]string{})
+	})
+
+	store := NewMemoryManifestStore()
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetManifestStore(store)
+	p.SetStepRegistry(registry)
+	p.SetEventLog(false)
+
+	input := types.PipelineInput{AudioPath: "/music/a.mp3", OutputDir: dir, TempDir: t.TempDir()}
+	if _, err := p.ComposeOnly(context.Background(), input, filepath.Join(dir, "missing.mp4"), "compose-test"); err == nil {
+		t.Fatal("Expected a missing video to be rejected")
+	}
+
+	result, err := p.ComposeOnly(context.Background(), input, videoPath, "compose-test")
+	if err != nil {
+		t.Fatalf("ComposeOnly failed: %v", err)
+	}
+	if composedVideo != videoPath || result.FinalOutputPath != filepath.Join(dir, "final.mp4") {
+		t.Errorf("Expected %s composed, got %q (result %+v)", videoPath, composedVideo, result)
+	}
+
+	// A second run reuses the stored manifest's video with a new soundtrack
+	composedVideo = ""
+	input.AudioPath = "/music/b.mp3"
+	if _, err := p.ComposeOnly(context.Background(), input, "", "compose-test"); err != nil {
+		t.Fatalf("ComposeOnly with the stored manifest failed: %v", err)
+	}
+	manifest, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if composedVideo != videoPath || manifest.Input.AudioPath != "/music/b.mp3" || !manifest.IsStageCompleted(types.StageCompose) {
+		t.Errorf("Expected the stored video composed with the new audio, got %q and %+v", composedVideo, manifest.Input)
+	}
+}
+
+// TestPrepareComposeMusicResumes verifies a compose running again keeps its selected track
+// and download, and selects afresh once the search results no longer have the track
+func TestPrepareComposeMusicResumes(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("ID3 track"))
+	}))
+	defer server.Close()
+
+	searchOutput := func(names ...string) json.RawMessage {
+		nodes := ""
+		for i, name := range names {
+			if i > 0 {
+				nodes += ","
+			}
+			nodes += fmt.Sprintf(`{"recording":{"title":%q,"audioFile":{"lqmp3Url":"%s/%s.mp3"}}}`, name, server.URL, name)
+		}
+		data, _ := json.Marshal(map[string]string{"data": `{"data":{"recordings":{"nodes":[` + nodes + `]}}}`})
+		return data
+	}
+
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetManifestStore(NewMemoryManifestStore())
+	manifest := NewManifest("compose-test", types.PipelineInput{TempDir: t.TempDir()})
+	manifest.Stages[types.StageSearchMusic] = &StageState{Status: types.StatusCompleted, Output: searchOutput("sunny", "bounce")}
+	manifest.StartStage(types.StageCompose)
+	progress := manifest.composeProgress()
+
+	track, musicPath, err := p.prepareComposeMusic(context.Background(), manifest, progress)
+	if err != nil || track == nil || track.Title != "sunny" || !fileExists(musicPath) {
+		t.Fatalf("Expected sunny downloaded, got %+v at %q (%v)", track, musicPath, err)
+	}
+
+	// A failed mux leaves the download for the next attempt
+	manifest.StartStage(types.StageCompose)
+	_, resumedPath, err := p.prepareComposeMusic(context.Background(), manifest, progress)
+	if err != nil || resumedPath != musicPath || downloads != 1 {
+		t.Errorf("Expected %s reused without downloading, got %q after %d downloads (%v)", musicPath, resumedPath, downloads, err)
+	}
+
+	// New search results without the track select and download again
+	manifest.Stages[types.StageSearchMusic].Output = searchOutput("bounce")
+	track, _, err = p.prepareComposeMusic(context.Background(), manifest, progress)
+	if err != nil || track == nil || track.Title != "bounce" || downloads != 2 {
+		t.Errorf("Expected bounce selected and downloaded, got %+v after %d downloads (%v)", track, downloads, err)
+	}
+
+	// Resetting compose discards its progress
+	manifest.ResetStage(types.StageCompose)
+	if manifest.Compose != nil {
+		t.Errorf("Expected the compose progress cleared, got %+v", manifest.Compose)
+	}
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// scriptedProvider starts conversations that fail with successive errors, then succeed
+type scriptedProvider struct {
+	errs    []error
+	started int
+}
+
+func (s *scriptedProvider) Name() string    { return "anthropic" }
+func (s *scriptedProvider) IsEnabled() bool { return true }
+func (s *scriptedProvider) CreateConversation(config *llm.FullAIConversationConfig) (llm.Conversation, error) {
+	var err error
+	if s.started < len(s.errs) {
+		err = s.errs[s.started]
+	}
+	s.started++
+	return &scriptedConversation{err: err}, nil
+}
+
+// scriptedConversation runs one round and returns its scripted error
+type scriptedConversation struct {
+	err error
+}
+
+func (c *scriptedConversation) SetToolAdapter(adapter *llm.ToolAdapter) {}
+func (c *scriptedConversation) Execute(ctx context.Context, imagePath string, duration float64, userPrompt string) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return "done", nil
+}
+func (c *scriptedConversation) GetMetrics() llm.FullAIConversationMetrics {
+	return llm.FullAIConversationMetrics{Rounds: 1}
+}
+func (c *scriptedConversation) GetState() interface{} { return nil }
+
+// TestExecuteConversationRetries verifies conversations failing with transient errors
+// are restarted within conversation_retries and other failures are returned at once
+func TestExecuteConversationRetries(t *testing.T) {
+	defer func(backoff time.Duration) { stageRetryBackoff = backoff }(stageRetryBackoff)
+	stageRetryBackoff = time.Millisecond
+
+	transient := fmt.Errorf("provider overloaded: %w", context.DeadlineExceeded)
+	permanent := errors.New("invalid API key")
+
+	tests := []struct {
+		name             string
+		retries          int
+		errs             []error
+		expectedAttempts int
+		expectErr        bool
+	}{
+		{"transient failure restarted", 2, []error{transient}, 2, false},
+		{"retries exhausted", 1, []error{transient, transient, transient}, 2, true},
+		{"disabled by default", 0, []error{transient}, 1, true},
+		{"permanent failure", 2, []error{permanent}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &scriptedProvider{errs: tt.errs}
+			p := NewPipeline(nil, nil, nil, nil, nil, false, 1, "", "full_ai")
+			p.llmProvider = provider
+			p.SetFullAIConfig(types.FullAIConfig{ConversationRetries: tt.retries})
+
+			result, metrics, attempts, err := p.executeConversation(context.Background(), &llm.FullAIConversationConfig{}, llm.NewToolAdapter(nil), "in.png", 3, "")
+			if attempts != tt.expectedAttempts || provider.started != tt.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d (%d conversations)", tt.expectedAttempts, attempts, provider.started)
+			}
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+			if err == nil && (result != "done" || metrics.Rounds != 1) {
+				t.Errorf("Expected the last attempt's result and metrics, got %q %+v", result, metrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxCustomFilterLength bounds a custom animation's filter chain
+const maxCustomFilterLength = 1024
+
+// customFilterForbiddenChars are shell metacharacters, and the ffmpeg escapes, stream
+// labels and chain separators that would let a filter reach beyond its single chain
+const customFilterForbiddenChars = ";|&$`<>\\\"[]\n\r"
+
+// customFilterAllowedFilters are the geometry, color and timing filters a custom
+// animation may use. None of them has an option reading or writing files, loading
+// plugins or opening sockets, which many other ffmpeg filters do.
+var customFilterAllowedFilters = map[string]bool{
+	"rotate": true, "zoompan": true, "scale": true, "crop": true, "pad": true,
+	"hflip": true, "vflip": true, "transpose": true,
+	"hue": true, "eq": true, "colorbalance": true, "colorchannelmixer": true, "negate": true,
+	"vignette": true, "boxblur": true, "gblur": true,
+	"setpts": true, "fade": true, "tpad": true, "fps": true,
+	"format": true, "setsar": true, "setdar": true, "null": true,
+}
+
+// ValidateCustomFilter checks the filter chain of a custom animation segment: a single
+// comma-separated chain of allowed filters without shell metacharacters or other
+// options. Commas inside an expression must be single-quoted, as in
+// "rotate='if(lt(t,1),0.1,0)'".
+func ValidateCustomFilter(filter string) error {
+	filter = strings.TrimSpace(filter)
+	switch {
+	case filter == "":
+		return fmt.Errorf("custom animation needs a custom_filter")
+	case len(filter) > maxCustomFilterLength:
+		return fmt.Errorf("custom_filter is longer than %d characters", maxCustomFilterLength)
+	case strings.HasPrefix(filter, "-"):
+		return fmt.Errorf("custom_filter must be a filter chain, not an ffmpeg option")
+	}
+	if i := strings.IndexAny(filter, customFilterForbiddenChars); i >= 0 {
+		return fmt.Errorf("custom_filter must not contain %q", filter[i])
+	}
+	for _, r := range filter {
+		if r < ' ' {
+			return fmt.Errorf("custom_filter must not contain control characters")
+		}
+	}
+
+	filters, err := splitUnquoted(filter, ',')
+	if err != nil {
+		return err
+	}
+	for _, f := range filters {
+		// ffmpeg drops the quotes before reading names, so the check does too
+		name, _, _ := strings.Cut(strings.ReplaceAll(f, "'", ""), "=")
+		name, _, _ = strings.Cut(strings.TrimSpace(name), "@")
+		if name == "" {
+			return fmt.Errorf("custom_filter has an empty filter in %q", filter)
+		}
+		if !customFilterAllowedFilters[name] {
+			return fmt.Errorf("custom_filter must not use the %s filter (allowed: %s)", name, allowedCustomFilters())
+		}
+	}
+	return nil
+}
+
+// allowedCustomFilters lists the allowed filter names in sorted order
+func allowedCustomFilters() string {
+	names := make([]string, 0, len(customFilterAllowedFilters))
+	for name := range customFilterAllowedFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// splitUnquoted splits s at sep outside single quotes
+func splitUnquoted(s string, sep rune) ([]string, error) {
+	var parts []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == sep && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if quoted {
+		return nil, fmt.Errorf("custom_filter has an unclosed quote")
+	}
+	return append(parts, current.String()), nil
+}
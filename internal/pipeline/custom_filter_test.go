@@ -0,0 +1,44 @@
+package pipeline
+
+import "testing"
+
+// TestValidateCustomFilter verifies chains of allowed filters pass and anything reaching
+// beyond a single chain, the shell or the file system is rejected
+func TestValidateCustomFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		valid  bool
+	}{
+		{filter: "rotate='0.1*sin(2*PI*t)':c=none", valid: true},
+		{filter: "hue=h='90*t',crop=iw-20:ih-20:10:10", valid: true},
+		{filter: "rotate='if(lt(t,1),0.1,0)'", valid: true},
+		{filter: "eq@fade=brightness='0.1*sin(t)'", valid: true},
+		{filter: "", valid: false},
+		{filter: "-i /etc/passwd", valid: false},
+		{filter: "hflip; rm -rf /", valid: false},
+		{filter: "hflip,$(whoami)", valid: false},
+		{filter: "hflip`id`", valid: false},
+		{filter: "hflip\nvflip", valid: false},
+		{filter: "[0:v]hflip[out]", valid: false},
+		{filter: `hflip\,vflip`, valid: false},
+		{filter: "movie=/etc/passwd", valid: false},
+		{filter: "hflip,'mov'ie=secret.mp4", valid: false},
+		{filter: "SendCmd=f=cmds.txt", valid: false},
+		{filter: "drawtext=textfile=/etc/passwd", valid: false},
+		{filter: "drawtext='x=1:fontfile=/tmp/f.ttf'", valid: false},
+		{filter: "curves=psfile=/any/file", valid: false},
+		{filter: "scale=iw:ih,libvmaf=log_path=/tmp/out.json", valid: false},
+		{filter: "drawtext=text=hi", valid: false},
+		{filter: "Rotate=0.1", valid: false},
+		{filter: "zoompan=z='min(zoom+0.001,1.2)':d=1,setpts=PTS-STARTPTS", valid: true},
+		{filter: "scale=640:-2,pad=640:480:0:60,format=yuv420p", valid: true},
+		{filter: "rotate='0.1*t", valid: false},
+		{filter: "hflip,,vflip", valid: false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateCustomFilter(tt.filter); (err == nil) != tt.valid {
+			t.Errorf("ValidateCustomFilter(%q): expected valid %v, got %v", tt.filter, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientDiskSpace matches any *DiskSpaceError via errors.Is
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// Disk space estimates are generous on purpose: overestimating only fails a run that
+// might have fitted, underestimating lets ffmpeg half-write a file on a full disk
+const (
+	diskSpaceMargin        = 16 << 20 // Headroom for manifests, logs and concat lists
+	motionBitsPerPixel     = 0.25     // Encoded bits per pixel per frame of a rendered segment
+	unknownFramePixels     = 1920 * 1080
+	audioBytesPerSecond    = 320_000 / 8 // The highest audio bitrate compose writes
+	musicDownloadAllowance = 32 << 20    // A downloaded track of unknown size
+)
+
+// DiskSpaceError reports that a directory has less free space than a stage needs
+type DiskSpaceError struct {
+	Dir  string
+	Need int64
+	Have int64
+}
+
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("%s in %s: need ~%s, have %s", ErrInsufficientDiskSpace, e.Dir, FormatBytes(e.Need), FormatBytes(e.Have))
+}
+
+// Is makes errors.Is(err, ErrInsufficientDiskSpace) match
+func (e *DiskSpaceError) Is(target error) bool {
+	return target == ErrInsufficientDiskSpace
+}
+
+// freeDiskSpace reports the bytes available to this process in the filesystem holding
+// dir; replaced in tests
+var freeDiskSpace = diskFree
+
+// checkDiskSpace returns a DiskSpaceError when dir has less than need bytes free. The
+// check is skipped, with a warning, where free space can't be read.
+func checkDiskSpace(dir string, need int64) error {
+	if dir == "" {
+		dir = "."
+	}
+	// The directory may not exist yet; its nearest existing parent is on the same disk
+	probe := dir
+	for {
+		if _, err := os.Stat(probe); err == nil || filepath.Dir(probe) == probe {
+			break
+		}
+		probe = filepath.Dir(probe)
+	}
+
+	have, err := freeDiskSpace(probe)
+	if err != nil {
+		log.Printf("Warning: cannot check free disk space in %s: %v", dir, err)
+		return nil
+	}
+	if have < need {
+		return &DiskSpaceError{Dir: dir, Need: need, Have: have}
+	}
+	return nil
+}
+
+// estimateMotionBytes estimates the temp space rendering a motion video takes: the
+// video, and as much again for the segments it is concatenated from
+func estimateMotionBytes(width, height int, duration float64, segments int) int64 {
+	pixels := float64(width * height)
+	if pixels <= 0 {
+		pixels = unknownFramePixels
+	}
+	video := int64(pixels * motionBitsPerPixel / 8 * motionFPS * duration)
+	if segments > 1 {
+		video *= 2
+	}
+	return video + diskSpaceMargin
+}
+
+// estimateComposeBytes estimates the output space composing videoPath takes: the
+// output with its audio, and a second copy while the title metadata is rewritten
+func estimateComposeBytes(videoPath string, duration float64, titleMetadata bool) int64 {
+	var video int64
+	if info, err := os.Stat(videoPath); err == nil {
+		video = info.Size()
+	}
+	output := video + int64(audioBytesPerSecond*duration)
+	if titleMetadata {
+		output *= 2
+	}
+	return output + diskSpaceMargin
+}
+
+// fileSizes returns the total size of the files at paths, skipping empty and
+// missing ones
+func fileSizes(paths ...string) int64 {
+	var total int64
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// FormatBytes formats n with a binary unit, e.g. "1.5 GiB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || openbsd || dragonfly) && !windows
+
+package pipeline
+
+import "errors"
+
+// diskFree is unsupported here, so disk space checks are skipped
+func diskFree(dir string) (int64, error) {
+	return 0, errors.New("free disk space is unavailable on this platform")
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	saved := freeDiskSpace
+	t.Cleanup(func() { freeDiskSpace = saved })
+	freeDiskSpace = func(dir string) (int64, error) { return 100 << 20, nil }
+
+	dir := t.TempDir()
+	if err := checkDiskSpace(dir, 50<<20); err != nil {
+		t.Errorf("Expected 50 MiB to fit in 100 MiB, got %v", err)
+	}
+
+	// A directory that doesn't exist yet is checked through its parent
+	err := checkDiskSpace(filepath.Join(dir, "out", "run-1"), 3<<30)
+	if !errors.Is(err, ErrInsufficientDiskSpace) {
+		t.Fatalf("err = %v, want ErrInsufficientDiskSpace", err)
+	}
+	if !strings.Contains(err.Error(), "need ~3.0 GiB, have 100.0 MiB") {
+		t.Errorf("Expected need and have in the error, got %q", err)
+	}
+	if kind := FailureKind(&StageError{Stage: types.StageRenderMotion, Err: err}); kind != FailureDiskSpace {
+		t.Errorf("FailureKind = %q, want %q", kind, FailureDiskSpace)
+	}
+
+	// Without a free space reading the check is skipped
+	freeDiskSpace = func(dir string) (int64, error) { return 0, errors.New("unsupported") }
+	if err := checkDiskSpace(dir, 3<<30); err != nil {
+		t.Errorf("Expected the check to be skipped, got %v", err)
+	}
+}
+
+func TestEstimateMotionBytes(t *testing.T) {
+	hd := estimateMotionBytes(1920, 1080, 10, 1)
+	if uhd := estimateMotionBytes(3840, 2160, 10, 1); uhd <= hd {
+		t.Errorf("Expected a 4K estimate above %d, got %d", hd, uhd)
+	}
+	if segmented := estimateMotionBytes(1920, 1080, 10, 3); segmented <= hd {
+		t.Errorf("Expected segments to need more than %d, got %d", hd, segmented)
+	}
+	if unknown := estimateMotionBytes(0, 0, 10, 1); unknown != hd {
+		t.Errorf("Expected an unknown size to be estimated as 1080p (%d), got %d", hd, unknown)
+	}
+}
+
+func TestSetArtifactBytes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "segmented.png")
+	if err := os.WriteFile(path, make([]byte, 1500), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var result PipelineResult
+	result.SetArtifactBytes(types.StageSegmentPerson, fileSizes(path, "", filepath.Join(dir, "missing.png")))
+	result.SetArtifactBytes(types.StageRenderMotion, 4000)
+	// A retried stage replaces its earlier attempt's size
+	result.SetArtifactBytes(types.StageRenderMotion, 2500)
+
+	if result.ArtifactBytes[types.StageSegmentPerson] != 1500 || result.TotalArtifactBytes != 4000 {
+		t.Errorf("Expected 1500 bytes for segment_person and 4000 in total, got %+v, %d", result.ArtifactBytes, result.TotalArtifactBytes)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		512:                    "512 B",
+		1536:                   "1.5 KiB",
+		5 << 20:                "5.0 MiB",
+		int64(2.5 * (1 << 30)): "2.5 GiB",
+	} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
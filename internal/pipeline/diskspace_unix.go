@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd || openbsd || dragonfly
+
+package pipeline
+
+import "golang.org/x/sys/unix"
+
+// diskFree reports the bytes available to unprivileged users in the filesystem holding dir
+func diskFree(dir string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
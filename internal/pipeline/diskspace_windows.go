@@ -0,0 +1,18 @@
+//go:build windows
+
+package pipeline
+
+import "golang.org/x/sys/windows"
+
+// diskFree reports the bytes available to the calling user on the volume holding dir
+func diskFree(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
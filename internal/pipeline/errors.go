@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// ErrNoSubjectDetected is returned when the image contains no person to animate.
+// Retrying will not help; callers should route the input to a different flow.
+var ErrNoSubjectDetected = errors.New("no subject detected in image")
+
+// ErrLowConfidenceDetection matches any *LowConfidenceError via errors.Is
+var ErrLowConfidenceDetection = errors.New("subject detected with low confidence")
+
+// ErrStageTimeout matches any *StageTimeoutError via errors.Is
+var ErrStageTimeout = errors.New("stage timed out")
+
+// Failure kinds reported to callers in machine-readable output
+const (
+	FailureNoSubject     = "no_subject"
+	FailureLowConfidence = "low_confidence"
+	FailureInterrupted   = "interrupted"
+	FailureTimeout       = "timeout"            // A stage hit its timeout; resuming retries it
+	FailureMalformed     = "malformed_response" // The model kept sending unusable responses
+	FailureDiskSpace     = "insufficient_disk_space"
+	FailureInternal      = "internal"
+)
+
+// LowConfidenceError reports that the best detection scored below the accepted minimum
+type LowConfidenceError struct {
+	Stage     types.PipelineStage
+	BestScore float64
+	Threshold float64
+}
+
+func (e *LowConfidenceError) Error() string {
+	return fmt.Sprintf("%s: best score %.2f below minimum %.2f", ErrLowConfidenceDetection, e.BestScore, e.Threshold)
+}
+
+// Is makes errors.Is(err, ErrLowConfidenceDetection) match
+func (e *LowConfidenceError) Is(target error) bool {
+	return target == ErrLowConfidenceDetection
+}
+
+// StageTimeoutError reports that a stage was stopped at its timeout, killing its
+// subprocesses. The stage counts as failed, so a resumed run retries it.
+type StageTimeoutError struct {
+	Stage   types.PipelineStage
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *StageTimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s exceeded its %s timeout: %v", ErrStageTimeout, e.Stage, e.Timeout, e.Err)
+}
+
+// Is makes errors.Is(err, ErrStageTimeout) match
+func (e *StageTimeoutError) Is(target error) bool {
+	return target == ErrStageTimeout
+}
+
+func (e *StageTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// StageError wraps an error returned by a pipeline stage
+type StageError struct {
+	Stage types.PipelineStage
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s failed: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// FailureKind classifies a pipeline error for callers; returns "" for nil
+func FailureKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNoSubjectDetected):
+		return FailureNoSubject
+	case errors.Is(err, ErrLowConfidenceDetection):
+		return FailureLowConfidence
+	case errors.Is(err, ErrStageTimeout):
+		return FailureTimeout
+	case errors.Is(err, ErrInsufficientDiskSpace):
+		return FailureDiskSpace
+	case errors.Is(err, llm.ErrMalformedResponse):
+		return FailureMalformed
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrShutdownRequested):
+		return FailureInterrupted
+	default:
+		return FailureInternal
+	}
+}
+
+// checkSubjectConfidence returns a LowConfidenceError when the best score is below
+// the pipeline's minimum subject confidence (0 disables the check)
+func (p *Pipeline) checkSubjectConfidence(stage types.PipelineStage, bestScore float64) error {
+	if p.minSubjectConfidence <= 0 || bestScore >= p.minSubjectConfidence {
+		return nil
+	}
+	return &LowConfidenceError{
+		Stage:     stage,
+		BestScore: bestScore,
+		Threshold: p.minSubjectConfidence,
+	}
+}
+
+// poseDetectionStats walks a pose estimation response and counts detections under any
+// "detections" key, tracking the best "confidence". Detections with fewer than
+// minKeypoints visible keypoints are not counted. ok is false if the response is not
+// JSON or has no detections list, in which case nothing can be concluded.
+func poseDetectionStats(doc interface{}, minKeypoints int) (count int, best float64, ok bool) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if list, isList := value.([]interface{}); isList && key == "detections" {
+				ok = true
+				for _, det := range list {
+					detMap, isMap := det.(map[string]interface{})
+					if minKeypoints > 0 && (!isMap || visibleKeypoints(detMap) < minKeypoints) {
+						continue
+					}
+					count++
+					if isMap {
+						if score, isScore := detMap["confidence"].(float64); isScore && score > best {
+							best = score
+						}
+					}
+				}
+				continue
+			}
+			c, b, found := poseDetectionStats(value, minKeypoints)
+			if found {
+				ok = true
+				count += c
+				if b > best {
+					best = b
+				}
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			c, b, found := poseDetectionStats(item, minKeypoints)
+			if found {
+				ok = true
+				count += c
+				if b > best {
+					best = b
+				}
+			}
+		}
+	}
+	return count, best, ok
+}
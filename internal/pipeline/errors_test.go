@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestFailureKind verifies errors are classified through wrapping
+func TestFailureKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "nil", err: nil, expected: ""},
+		{
+			name:     "no subject in stage error",
+			err:      &StageError{Stage: types.StageSegmentPerson, Err: fmt.Errorf("no detections: %w", ErrNoSubjectDetected)},
+			expected: FailureNoSubject,
+		},
+		{
+			name:     "low confidence in stage error",
+			err:      &StageError{Stage: types.StageLandmarks, Err: &LowConfidenceError{BestScore: 0.2, Threshold: 0.5}},
+			expected: FailureLowConfidence,
+		},
+		{
+			name:     "stage timeout",
+			err:      &StageTimeoutError{Stage: types.StageCompose, Timeout: time.Minute, Err: context.DeadlineExceeded},
+			expected: FailureTimeout,
+		},
+		{
+			name:     "malformed model responses",
+			err:      fmt.Errorf("AI conversation failed: %w", fmt.Errorf("%w: response was empty after 2 repair attempts", llm.ErrMalformedResponse)),
+			expected: FailureMalformed,
+		},
+		{
+			name:     "interrupted",
+			err:      fmt.Errorf("stage compose interrupted: %w", context.Canceled),
+			expected: FailureInterrupted,
+		},
+		{
+			name:     "tool failure",
+			err:      &StageError{Stage: types.StageSegmentPerson, Err: errors.New("detect tool failed: broken pipe")},
+			expected: FailureInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FailureKind(tt.err); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestLowConfidenceErrorCarriesScore verifies callers can read the best score with errors.As
+func TestLowConfidenceErrorCarriesScore(t *testing.T) {
+	err := error(&StageError{Stage: types.StageSegmentPerson, Err: &LowConfidenceError{BestScore: 0.25, Threshold: 0.6}})
+
+	var lowConfidence *LowConfidenceError
+	if !errors.As(err, &lowConfidence) {
+		t.Fatal("Expected LowConfidenceError in chain")
+	}
+	if lowConfidence.BestScore != 0.25 {
+		t.Errorf("Expected best score 0.25, got %v", lowConfidence.BestScore)
+	}
+}
+
+// TestSegmentSubjectErrors verifies the segmentation stage reports typed subject failures
+func TestSegmentSubjectErrors(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	os.WriteFile(imagePath, []byte("photo"), 0644)
+
+	tests := []struct {
+		name          string
+		detect        string
+		minConfidence float64
+		expected      error
+	}{
+		{
+			name:     "no detections",
+			detect:   `{"detections":[]}`,
+			expected: ErrNoSubjectDetected,
+		},
+		{
+			name:     "only non-person detections",
+			detect:   `{"detections":[{"class":"dog","confidence":0.9,"polygon":[[0,0],[1,1]]}]}`,
+			expected: ErrNoSubjectDetected,
+		},
+		{
+			name:          "person below minimum confidence",
+			detect:        `{"detections":[{"class":"person","confidence":0.35,"polygon":[[0,0],[1,1]]}]}`,
+			minConfidence: 0.5,
+			expected:      ErrLowConfidenceDetection,
+		},
+		{
+			name:          "person above minimum confidence",
+			detect:        `{"detections":[{"class":"person","confidence":0.8,"polygon":[[0,0],[10,0],[5,10]]}]}`,
+			minConfidence: 0.5,
+			expected:      nil,
+		},
+		{
+			name:     "degenerate person polygon",
+			detect:   `{"detections":[{"class":"person","confidence":0.8,"polygon":[[0,0],[1,1],[1,1]]}]}`,
+			expected: ErrDegeneratePolygon,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools := newFakeToolClient()
+			tools.detectResponse = tt.detect
+			p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+			p.SetMinSubjectConfidence(tt.minConfidence)
+
+			manifest := NewManifest("test", types.PipelineInput{ImagePath: imagePath, TempDir: t.TempDir()})
+			err := ExecuteSegmentPerson(context.Background(), p, manifest)
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestLandmarksNoSubject verifies an empty pose detection list is reported as no subject
+func TestLandmarksNoSubject(t *testing.T) {
+	tools := newFakeToolClient()
+	tools.poseResponse = `{"results":[{"detections":[]}]}`
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+
+	manifest := NewManifest("test", types.PipelineInput{TempDir: t.TempDir()})
+	manifest.Result = &PipelineResult{SegmentedImagePath: "/tmp/segmented.png"}
+
+	err := ExecuteEstimateLandmarks(context.Background(), p, manifest)
+	if !errors.Is(err, ErrNoSubjectDetected) {
+		t.Fatalf("Expected ErrNoSubjectDetected, got %v", err)
+	}
+}
+
+// TestLandmarksFailureSkipped verifies a failing pose estimation doesn't stop the run
+// when the stage's error recovery is "skip"
+func TestLandmarksFailureSkipped(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tools := newFakeToolClient()
+	tools.poseErr = errors.New("yolo crashed")
+
+	var composeSawLandmarks bool
+	registry := NewStepRegistry()
+	registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		composeSawLandmarks = manifest.Result.LandmarksData != ""
+		return manifest.CompleteStage(types.StageCompose, map[string]string{})
+	})
+
+	store := NewMemoryManifestStore()
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetManifestStore(store)
+	p.SetStepRegistry(registry)
+	p.SetEventLog(false)
+	p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageCompose})
+
+	input := types.PipelineInput{ImagePath: imagePath, Duration: 5, TempDir: t.TempDir()}
+	result, err := p.Execute(context.Background(), input, "skip-test")
+	if err != nil {
+		t.Fatalf("Expected the run to continue past the landmark failure, got %v", err)
+	}
+	if result.LandmarksData != "" || composeSawLandmarks {
+		t.Errorf("Expected empty landmarks, got %q", result.LandmarksData)
+	}
+
+	manifest, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	state := manifest.Stages[types.StageLandmarks]
+	if state.Status != types.StatusSkipped || state.RetryCount != 0 || !strings.Contains(state.Error, "yolo crashed") {
+		t.Errorf("Expected a skipped landmarks stage keeping its error, got %+v", state)
+	}
+	if !manifest.IsStageCompleted(types.StageCompose) {
+		t.Error("Expected compose to run after the skipped stage")
+	}
+}
+
+// TestPoseDetectionStats verifies detections are counted wherever they appear
+func TestPoseDetectionStats(t *testing.T) {
+	doc := map[string]interface{}{
+		"results": []interface{}{
+			map[string]interface{}{"detections": []interface{}{
+				map[string]interface{}{"confidence": 0.4},
+				map[string]interface{}{"confidence": 0.7},
+			}},
+		},
+	}
+
+	count, best, ok := poseDetectionStats(doc, 0)
+	if !ok || count != 2 || best != 0.7 {
+		t.Errorf("Expected (2, 0.7, true), got (%d, %v, %v)", count, best, ok)
+	}
+
+	if _, _, ok := poseDetectionStats(map[string]interface{}{"keypoints": []interface{}{}}, 0); ok {
+		t.Error("Expected no conclusion without a detections list")
+	}
+}
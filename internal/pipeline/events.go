@@ -0,0 +1,249 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// EventLogFileName is the per-pipeline event log written to the pipeline's TempDir
+const EventLogFileName = "events.jsonl"
+
+// Pipeline event types
+const (
+	EventStageStarted   = "stage_started"
+	EventStageCompleted = "stage_completed"
+	EventStageFailed    = "stage_failed"
+	EventStageRepaired  = "stage_repaired"
+	EventToolCalled     = "tool_called"
+	EventLLMRound       = "llm_round"
+	EventRunFinished    = "run_finished"
+)
+
+// tailPollInterval is how often TailEvents checks a followed file for new lines
+const tailPollInterval = 250 * time.Millisecond
+
+// PipelineEvent is one line of the event log
+type PipelineEvent struct {
+	Time       time.Time              `json:"time"`
+	PipelineID string                 `json:"pipeline_id"`
+	Type       string                 `json:"type"`
+	Stage      types.PipelineStage    `json:"stage,omitempty"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+}
+
+// EventLog appends pipeline events to a JSON lines file that external orchestrators
+// can tail. Each event is a single unbuffered append, so readers never see a partial
+// line. Methods do nothing on a nil log.
+type EventLog struct {
+	mu         sync.Mutex
+	file       *os.File
+	path       string
+	pipelineID string
+}
+
+// OpenEventLog opens path for appending, creating it if needed
+func OpenEventLog(path, pipelineID string) (*EventLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return &EventLog{file: file, path: path, pipelineID: pipelineID}, nil
+}
+
+// Path returns the log file path, or "" for a nil log
+func (l *EventLog) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Emit appends an event. Write failures are logged, never returned: the event log
+// must not fail the run it describes.
+func (l *EventLog) Emit(eventType string, stage types.PipelineStage, payload map[string]interface{}) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(PipelineEvent{
+		Time:       time.Now().UTC(),
+		PipelineID: l.pipelineID,
+		Type:       eventType,
+		Stage:      stage,
+		Payload:    payload,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Warning: failed to write %s event: %v", eventType, err)
+	}
+}
+
+// Close closes the log file
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// toolCalled emits a tool_called event for a call observed by the tool adapter
+func (l *EventLog) toolCalled(call llm.ObservedToolCall) {
+	payload := map[string]interface{}{
+		"tool_name": call.ToolName,
+		"server":    call.Server,
+		"tool":      call.Tool,
+		"arguments": call.Arguments,
+		"result":    call.Result,
+	}
+	if len(call.PathRewrites) > 0 {
+		payload["path_rewrites"] = call.PathRewrites
+	}
+	if call.Err != nil {
+		payload["error"] = call.Err.Error()
+	}
+	l.Emit(EventToolCalled, "", payload)
+}
+
+// llmRound emits an llm_round event for a recorded model response
+func (l *EventLog) llmRound(round int, turn llm.TraceTurn) {
+	l.Emit(EventLLMRound, "", map[string]interface{}{
+		"round":         round,
+		"text":          turn.Text,
+		"input_tokens":  turn.InputTokens,
+		"output_tokens": turn.OutputTokens,
+	})
+}
+
+// runFinished emits the run_finished event closing a run
+func (l *EventLog) runFinished(result *PipelineResult, err error) {
+	payload := map[string]interface{}{"status": "completed"}
+	if err != nil {
+		payload["status"] = "failed"
+		payload["error"] = err.Error()
+		payload["failure_kind"] = FailureKind(err)
+	}
+	if result != nil && result.FinalOutputPath != "" {
+		payload["final_output_path"] = result.FinalOutputPath
+	}
+	l.Emit(EventRunFinished, "", payload)
+}
+
+// openRunEventLog opens the event log in the run's TempDir. Failures are logged and
+// leave the run without an event log.
+func (p *Pipeline) openRunEventLog(input types.PipelineInput, pipelineID string) *EventLog {
+	if !p.eventLog || input.TempDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(input.TempDir, 0755); err != nil {
+		log.Printf("Warning: event log disabled: %v", err)
+		return nil
+	}
+	events, err := OpenEventLog(filepath.Join(input.TempDir, EventLogFileName), pipelineID)
+	if err != nil {
+		log.Printf("Warning: event log disabled: %v", err)
+		return nil
+	}
+	return events
+}
+
+type eventLogKey struct{}
+
+// withEventLog returns ctx carrying the run's event log for stages and steps
+func withEventLog(ctx context.Context, events *EventLog) context.Context {
+	return context.WithValue(ctx, eventLogKey{}, events)
+}
+
+// eventLogFrom returns the run's event log, or nil
+func eventLogFrom(ctx context.Context) *EventLog {
+	events, _ := ctx.Value(eventLogKey{}).(*EventLog)
+	return events
+}
+
+// TailEvents pretty-prints the events in path to w. With follow, it waits for new
+// events until the file ends with a run_finished event or ctx is done; earlier
+// run_finished events belong to runs that were later resumed.
+func TailEvents(ctx context.Context, path string, follow bool, w io.Writer) error {
+	file, err := os.Open(path)
+	for follow && os.IsNotExist(err) {
+		if sleepErr := retry.Sleep(ctx, tailPollInterval); sleepErr != nil {
+			return sleepErr
+		}
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var partial string
+	finished := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// Keep an incomplete line until the rest of it is written
+			partial += line
+			if !follow || (finished && partial == "") {
+				return nil
+			}
+			if sleepErr := retry.Sleep(ctx, tailPollInterval); sleepErr != nil {
+				return sleepErr
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read event log: %w", err)
+		}
+		line, partial = partial+line, ""
+
+		var event PipelineEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			fmt.Fprintf(w, "? %s", line)
+			continue
+		}
+		fmt.Fprintln(w, FormatEvent(event))
+		finished = event.Type == EventRunFinished
+	}
+}
+
+// FormatEvent renders an event as one human-readable line
+func FormatEvent(event PipelineEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-15s", event.Time.Local().Format("15:04:05.000"), event.Type)
+	if event.Stage != "" {
+		fmt.Fprintf(&b, "  %s", event.Stage)
+	}
+
+	keys := make([]string, 0, len(event.Payload))
+	for key := range event.Payload {
+		switch key {
+		case "arguments", "result", "text":
+			continue // Too long for one line; read the file for these
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "  %s=%v", key, event.Payload[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// readEvents decodes every line of an event log, failing on malformed lines
+func readEvents(t *testing.T, path string) []PipelineEvent {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open event log: %v", err)
+	}
+	defer file.Close()
+
+	var events []PipelineEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event PipelineEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Malformed event line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// runScriptedPipeline runs a lightweight pipeline whose stages are replaced by step,
+// returning the run's temp dir and error
+func runScriptedPipeline(t *testing.T, stages []types.PipelineStage, step StepFunc) (string, string, error) {
+	t.Helper()
+	root := t.TempDir()
+	imagePath := filepath.Join(root, "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	registry := NewStepRegistry()
+	for _, stage := range stages {
+		registry.Register(stage, step)
+	}
+	tools := newFakeToolClient()
+	manifestPath := filepath.Join(root, "manifest.json")
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 1, manifestPath, "lightweight")
+	p.SetStepRegistry(registry)
+	p.SetStageOrder(stages)
+
+	tempDir := filepath.Join(root, "temp")
+	input := types.PipelineInput{ImagePath: imagePath, Duration: 3, TempDir: tempDir, OutputDir: root}
+	_, err := p.Execute(context.Background(), input, "events-test")
+	return tempDir, manifestPath, err
+}
+
+func TestEventLogOrdering(t *testing.T) {
+	stages := []types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageCompose}
+	tempDir, manifestPath, err := runScriptedPipeline(t, stages, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		return manifest.CompleteStage(manifest.CurrentStage, map[string]string{})
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	events := readEvents(t, filepath.Join(tempDir, EventLogFileName))
+	var expected []string
+	for _, stage := range stages {
+		expected = append(expected, EventStageStarted+":"+string(stage), EventStageCompleted+":"+string(stage))
+	}
+	expected = append(expected, EventRunFinished+":")
+
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Type+":"+string(event.Stage))
+		if event.PipelineID != "events-test" {
+			t.Errorf("Expected pipeline_id events-test, got %q", event.PipelineID)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("Expected %s event to carry a time", event.Type)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected events %v, got %v", expected, got)
+	}
+
+	if attempt, ok := events[0].Payload["attempt"].(float64); !ok || attempt != 1 {
+		t.Errorf("Expected stage_started attempt 1, got %v", events[0].Payload["attempt"])
+	}
+	if _, ok := events[1].Payload["duration_ms"]; !ok {
+		t.Error("Expected stage_completed to carry duration_ms")
+	}
+	if status := events[len(events)-1].Payload["status"]; status != "completed" {
+		t.Errorf("Expected run_finished status completed, got %v", status)
+	}
+
+	manifest, err := LoadManifest(manifestPath)
+	if err != nil || manifest == nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if manifest.EventsFile != filepath.Join(tempDir, EventLogFileName) {
+		t.Errorf("Expected manifest to record the event log, got %q", manifest.EventsFile)
+	}
+}
+
+func TestEventLogFailedRun(t *testing.T) {
+	stages := []types.PipelineStage{types.StageSegmentPerson, types.StageCompose}
+	tempDir, _, err := runScriptedPipeline(t, stages, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		return errors.New("segmentation exploded")
+	})
+	if err == nil {
+		t.Fatal("Expected Execute to fail")
+	}
+
+	events := readEvents(t, filepath.Join(tempDir, EventLogFileName))
+	if len(events) != 3 {
+		t.Fatalf("Expected stage_started, stage_failed and run_finished, got %d events", len(events))
+	}
+	failed, finished := events[1], events[2]
+	if failed.Type != EventStageFailed || failed.Stage != types.StageSegmentPerson {
+		t.Errorf("Expected stage_failed for segment_person, got %s %s", failed.Type, failed.Stage)
+	}
+	if !strings.Contains(failed.Payload["error"].(string), "segmentation exploded") {
+		t.Errorf("Expected stage_failed to carry the error, got %v", failed.Payload["error"])
+	}
+	if finished.Type != EventRunFinished || finished.Payload["status"] != "failed" {
+		t.Errorf("Expected run_finished with status failed, got %s %v", finished.Type, finished.Payload["status"])
+	}
+	if _, ok := finished.Payload["failure_kind"]; !ok {
+		t.Error("Expected run_finished to carry failure_kind")
+	}
+}
+
+func TestTailEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), EventLogFileName)
+	events, err := OpenEventLog(path, "tail-test")
+	if err != nil {
+		t.Fatalf("OpenEventLog failed: %v", err)
+	}
+	defer events.Close()
+	events.Emit(EventStageStarted, types.StageSegmentPerson, map[string]interface{}{"attempt": 1})
+
+	t.Run("no follow", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := TailEvents(context.Background(), path, false, &out); err != nil {
+			t.Fatalf("TailEvents failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "stage_started") || !strings.Contains(out.String(), "segment_person  attempt=1") {
+			t.Errorf("Unexpected tail output %q", out.String())
+		}
+	})
+
+	t.Run("follow until run_finished", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		go func() {
+			time.Sleep(2 * tailPollInterval)
+			events.runFinished(nil, nil)
+		}()
+
+		var out bytes.Buffer
+		if err := TailEvents(ctx, path, true, &out); err != nil {
+			t.Fatalf("TailEvents failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "run_finished") {
+			t.Errorf("Expected tail to print run_finished, got %q", out.String())
+		}
+	})
+}
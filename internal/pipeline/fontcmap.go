@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// errMalformedFont is returned for font data the cmap reader can't follow
+var errMalformedFont = errors.New("malformed font file")
+
+// fontCoverage is the set of characters a TrueType/OpenType font maps to glyphs
+type fontCoverage struct {
+	ranges [][2]rune // Inclusive, sorted by start
+}
+
+// loadFontCoverage reads the character map of the font at path. For a font collection
+// the first font is used, as ffmpeg's drawtext does by default.
+func loadFontCoverage(path string) (*fontCoverage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	coverage, err := parseFontCoverage(data)
+	if err != nil {
+		return nil, fmt.Errorf("font %s: %w", path, err)
+	}
+	return coverage, nil
+}
+
+// has reports whether the font has a glyph for r
+func (c *fontCoverage) has(r rune) bool {
+	i := sort.Search(len(c.ranges), func(i int) bool { return c.ranges[i][1] >= r })
+	return i < len(c.ranges) && c.ranges[i][0] <= r
+}
+
+// parseFontCoverage extracts the Unicode ranges of the font's cmap table. Format 4
+// (BMP) and format 12 (full Unicode, needed for emoji) subtables are read.
+func parseFontCoverage(data []byte) (*fontCoverage, error) {
+	offset := 0
+	if len(data) >= 16 && string(data[:4]) == "ttcf" {
+		offset = int(binary.BigEndian.Uint32(data[12:]))
+	}
+	if offset+12 > len(data) {
+		return nil, errMalformedFont
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[offset+4:]))
+	cmap := -1
+	for i := 0; i < numTables; i++ {
+		record := offset + 12 + 16*i
+		if record+16 > len(data) {
+			return nil, errMalformedFont
+		}
+		if string(data[record:record+4]) == "cmap" {
+			cmap = int(binary.BigEndian.Uint32(data[record+8:]))
+			break
+		}
+	}
+	if cmap < 0 || cmap+4 > len(data) {
+		return nil, fmt.Errorf("%w: no cmap table", errMalformedFont)
+	}
+
+	coverage := &fontCoverage{}
+	numSubtables := int(binary.BigEndian.Uint16(data[cmap+2:]))
+	for i := 0; i < numSubtables; i++ {
+		record := cmap + 4 + 8*i
+		if record+8 > len(data) {
+			return nil, errMalformedFont
+		}
+		platform := binary.BigEndian.Uint16(data[record:])
+		encoding := binary.BigEndian.Uint16(data[record+2:])
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue // Not a Unicode subtable
+		}
+
+		subtable := cmap + int(binary.BigEndian.Uint32(data[record+4:]))
+		if subtable+2 > len(data) {
+			return nil, errMalformedFont
+		}
+		var err error
+		switch binary.BigEndian.Uint16(data[subtable:]) {
+		case 4:
+			err = coverage.addFormat4(data, subtable)
+		case 12:
+			err = coverage.addFormat12(data, subtable)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(coverage.ranges) == 0 {
+		return nil, fmt.Errorf("%w: no Unicode character map", errMalformedFont)
+	}
+
+	sort.Slice(coverage.ranges, func(i, j int) bool { return coverage.ranges[i][0] < coverage.ranges[j][0] })
+	return coverage, nil
+}
+
+// addFormat4 adds the segments of a format 4 subtable, skipping the final 0xFFFF marker
+func (c *fontCoverage) addFormat4(data []byte, subtable int) error {
+	if subtable+14 > len(data) {
+		return errMalformedFont
+	}
+	segCountX2 := int(binary.BigEndian.Uint16(data[subtable+6:]))
+	endCodes := subtable + 14
+	startCodes := endCodes + segCountX2 + 2
+	if startCodes+segCountX2 > len(data) {
+		return errMalformedFont
+	}
+	for i := 0; i < segCountX2; i += 2 {
+		start := rune(binary.BigEndian.Uint16(data[startCodes+i:]))
+		end := rune(binary.BigEndian.Uint16(data[endCodes+i:]))
+		if start == 0xFFFF {
+			continue
+		}
+		c.ranges = append(c.ranges, [2]rune{start, end})
+	}
+	return nil
+}
+
+// addFormat12 adds the sequential map groups of a format 12 subtable
+func (c *fontCoverage) addFormat12(data []byte, subtable int) error {
+	if subtable+16 > len(data) {
+		return errMalformedFont
+	}
+	numGroups := int(binary.BigEndian.Uint32(data[subtable+12:]))
+	groups := subtable + 16
+	if numGroups < 0 || groups+12*numGroups > len(data) {
+		return errMalformedFont
+	}
+	for i := 0; i < numGroups; i++ {
+		group := groups + 12*i
+		start := rune(binary.BigEndian.Uint32(data[group:]))
+		end := rune(binary.BigEndian.Uint32(data[group+4:]))
+		c.ranges = append(c.ranges, [2]rune{start, end})
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"os"
+)
+
+// ImageInfo describes the decoded header of an input image
+type ImageInfo struct {
+	Format string `json:"format"` // jpeg, png, gif or webp
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// CheckInputImage decodes the header of the input image, failing fast on missing,
+// corrupt or non-image files instead of deep inside segmentation
+func CheckInputImage(path string) (*ImageInfo, error) {
+	info, err := decodeImageInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("input image %s: %w", path, err)
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		return nil, fmt.Errorf("input image %s has no pixels (%dx%d)", path, info.Width, info.Height)
+	}
+	return info, nil
+}
+
+// recordInputImage stores the input image's format and dimensions in the manifest.
+// ValidateInput already rejects undecodable images, so failures are only logged.
+func (m *Manifest) recordInputImage() {
+	info, err := decodeImageInfo(m.Input.ImagePath)
+	if err != nil {
+		log.Printf("Warning: cannot read input image dimensions: %v", err)
+		return
+	}
+	m.InputImage = info
+	log.Printf("Input image: %s %dx%d", info.Format, info.Width, info.Height)
+}
+
+// decodeImageInfo reads the format and dimensions from an image header
+func decodeImageInfo(path string) (*ImageInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err == nil {
+		return &ImageInfo{Format: format, Width: config.Width, Height: config.Height}, nil
+	}
+	if !errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("failed to decode image header: %w", err)
+	}
+
+	// The standard library has no WebP decoder; read its dimensions directly
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, seekErr
+	}
+	header := make([]byte, 30)
+	n, _ := io.ReadFull(file, header)
+	if width, height, ok := webpSize(header[:n]); ok {
+		return &ImageInfo{Format: "webp", Width: width, Height: height}, nil
+	}
+	return nil, fmt.Errorf("not a decodable image (supported: JPEG, PNG, GIF, WebP)")
+}
+
+// webpSize parses the canvas size from the first 30 bytes of a WebP file
+func webpSize(header []byte) (int, int, bool) {
+	if len(header) < 30 || !bytes.Equal(header[0:4], []byte("RIFF")) || !bytes.Equal(header[8:12], []byte("WEBP")) {
+		return 0, 0, false
+	}
+	uint24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+
+	switch string(header[12:16]) {
+	case "VP8X": // Extended: 24-bit canvas width and height minus one
+		return 1 + uint24(header[24:27]), 1 + uint24(header[27:30]), true
+	case "VP8 ": // Lossy: 14-bit sizes after the frame tag and start code
+		if !bytes.Equal(header[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0, false
+		}
+		width := int(binary.LittleEndian.Uint16(header[26:28]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(header[28:30]) & 0x3fff)
+		return width, height, true
+	case "VP8L": // Lossless: 14-bit sizes minus one after the signature byte
+		if header[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		return 1 + int(bits&0x3fff), 1 + int(bits>>14&0x3fff), true
+	default:
+		return 0, 0, false
+	}
+}
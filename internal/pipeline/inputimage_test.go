@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// writePNG writes a blank width x height PNG to path
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+}
+
+// webpHeader returns a RIFF WebP header with the given chunk and chunk payload
+func webpHeader(chunk string, payload ...byte) []byte {
+	header := append([]byte("RIFF\x00\x00\x00\x00WEBP"+chunk+"\x00\x00\x00\x00"), payload...)
+	return append(header, make([]byte, 32)...)
+}
+
+func TestCheckInputImage(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "photo.png"), 40, 30)
+
+	// Canvas 640x480 (stored minus one), 1024x768 and 300x200
+	files := map[string][]byte{
+		"extended.webp": webpHeader("VP8X", 0, 0, 0, 0, 0x7f, 0x02, 0x00, 0xdf, 0x01, 0x00),
+		"lossy.webp":    webpHeader("VP8 ", 0, 0, 0, 0x9d, 0x01, 0x2a, 0x00, 0x04, 0x00, 0x03),
+		"lossless.webp": webpHeader("VP8L", 0x2f, 0x2b, 0xc1, 0x31, 0x00),
+		"notes.png":     []byte("these are not pixels"),
+		"truncated.png": []byte("\x89PNG\r\n\x1a\n\x00\x00"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		file     string
+		expected ImageInfo
+		wantErr  string
+	}{
+		{file: "photo.png", expected: ImageInfo{Format: "png", Width: 40, Height: 30}},
+		{file: "extended.webp", expected: ImageInfo{Format: "webp", Width: 640, Height: 480}},
+		{file: "lossy.webp", expected: ImageInfo{Format: "webp", Width: 1024, Height: 768}},
+		{file: "lossless.webp", expected: ImageInfo{Format: "webp", Width: 300, Height: 200}},
+		{file: "notes.png", wantErr: "not a decodable image"},
+		{file: "truncated.png", wantErr: "failed to decode image header"},
+		{file: "missing.jpg", wantErr: "no such file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			info, err := CheckInputImage(filepath.Join(dir, tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CheckInputImage failed: %v", err)
+			}
+			if *info != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *info)
+			}
+		})
+	}
+}
+
+func TestValidateInputRejectsCorruptImage(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(imagePath, []byte("<html>not found</html>"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	if err := ValidateInput(types.PipelineInput{ImagePath: imagePath, Duration: 5}); err == nil {
+		t.Fatal("Expected a corrupt image to fail validation")
+	}
+
+	writePNG(t, imagePath, 8, 6)
+	if err := ValidateInput(types.PipelineInput{ImagePath: imagePath, Duration: 5}); err != nil {
+		t.Fatalf("ValidateInput failed: %v", err)
+	}
+	manifest := NewManifest("test", types.PipelineInput{ImagePath: imagePath})
+	manifest.recordInputImage()
+	if manifest.InputImage == nil || manifest.InputImage.Width != 8 || manifest.InputImage.Height != 6 {
+		t.Errorf("Expected 8x6 dimensions in the manifest, got %+v", manifest.InputImage)
+	}
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SafeInput maps the user's input image to the copy handed to MCP tools and the model.
+// Names with non-ASCII characters, whitespace or quotes are mangled by some servers and
+// by models repeating them, so such inputs are copied into TempDir under a plain name.
+type SafeInput struct {
+	Original string `json:"original"` // User-facing path, kept in logs and results
+	Path     string `json:"path"`     // Sanitized copy in TempDir
+}
+
+// needsSafeCopy reports whether path contains characters that don't survive tool
+// arguments and prompts reliably
+func needsSafeCopy(path string) bool {
+	for _, r := range path {
+		if r > '~' || r < '!' || strings.ContainsRune("\"'`", r) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeInputName returns the sanitized file name for a copy of path. The name is derived
+// from the original path so a resumed run finds the same copy.
+func safeInputName(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	ext := strings.ToLower(filepath.Ext(path))
+	if needsSafeCopy(ext) {
+		ext = ""
+	}
+	return "input_" + hex.EncodeToString(sum[:6]) + ext
+}
+
+// copySafeInput copies imagePath into tempDir under a sanitized name when the path
+// needs one. Returns nil when imagePath can be passed to tools as-is.
+func copySafeInput(imagePath, tempDir string) (*SafeInput, error) {
+	original, err := filepath.Abs(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if !needsSafeCopy(original) {
+		return nil, nil
+	}
+
+	safePath, err := filepath.Abs(filepath.Join(tempDir, safeInputName(original)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if needsSafeCopy(safePath) {
+		log.Printf("Warning: temp directory %s is not tool-safe, passing %s unchanged", tempDir, original)
+		return nil, nil
+	}
+
+	if _, err := os.Stat(safePath); err != nil {
+		if err := copyFile(original, safePath); err != nil {
+			return nil, fmt.Errorf("failed to copy input image: %w", err)
+		}
+	}
+	log.Printf("Input %q copied to %s for tool calls", original, safePath)
+	return &SafeInput{Original: original, Path: safePath}, nil
+}
+
+// toolInputPath returns the absolute input image path to hand to MCP tools, copying the
+// input to a sanitized name on first use and recording the mapping on the manifest
+func toolInputPath(manifest *Manifest) (string, error) {
+	if si := manifest.SafeInput; si != nil {
+		if _, err := os.Stat(si.Path); err == nil {
+			return si.Path, nil
+		}
+	}
+
+	si, err := copySafeInput(manifest.Input.ImagePath, manifest.Input.TempDir)
+	if err != nil {
+		return "", err
+	}
+	if si == nil {
+		return filepath.Abs(manifest.Input.ImagePath)
+	}
+	manifest.SafeInput = si
+	return si.Path, nil
+}
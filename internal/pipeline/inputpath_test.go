@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestNeedsSafeCopy(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/data/photo_01.jpg", false},
+		{"/data/my photo.jpg", true},
+		{"/data/自拍照.jpg", true},
+		{`/data/it's "me".jpg`, true},
+		{"/data/tab\tname.png", true},
+	}
+
+	for _, tt := range tests {
+		if got := needsSafeCopy(tt.path); got != tt.expected {
+			t.Errorf("needsSafeCopy(%q) = %v, want %v", tt.path, got, tt.expected)
+		}
+	}
+}
+
+// TestLightweightPipelineUnicodePaths runs the lightweight pipeline on inputs whose names
+// contain spaces, CJK characters and quotes, checking the tools only see sanitized paths
+// while the manifest keeps the original
+func TestLightweightPipelineUnicodePaths(t *testing.T) {
+	names := map[string]string{
+		"spaces": "my holiday photo.png",
+		"cjk":    "自拍照.png",
+		"quotes": `it's "me".png`,
+	}
+
+	for testName, fileName := range names {
+		t.Run(testName, func(t *testing.T) {
+			root := t.TempDir()
+			inputDir := filepath.Join(root, "input photos")
+			tempDir := filepath.Join(root, "temp")
+			for _, dir := range []string{inputDir, tempDir} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", dir, err)
+				}
+			}
+			imagePath := filepath.Join(inputDir, fileName)
+			if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+				t.Fatalf("Failed to write image: %v", err)
+			}
+
+			registry := NewStepRegistry()
+			registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+				return manifest.CompleteStage(types.StageCompose, map[string]string{})
+			})
+
+			tools := newFakeToolClient()
+			manifestPath := filepath.Join(root, "manifest.json")
+			p := NewPipeline(tools, tools, nil, nil, nil, false, 3, manifestPath, "lightweight")
+			p.SetStepRegistry(registry)
+			p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageCompose})
+
+			input := types.PipelineInput{ImagePath: imagePath, Duration: 3, TempDir: tempDir, OutputDir: root}
+			if _, err := p.Execute(context.Background(), input, "unicode-test"); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+
+			if len(tools.pathArgs) == 0 {
+				t.Fatal("Expected tool calls with path arguments")
+			}
+			for _, path := range tools.pathArgs {
+				if needsSafeCopy(path) {
+					t.Errorf("Tool received unsanitized path %q", path)
+				}
+			}
+
+			saved, err := LoadManifest(manifestPath)
+			if err != nil {
+				t.Fatalf("Failed to load manifest: %v", err)
+			}
+			if saved.Input.ImagePath != imagePath {
+				t.Errorf("Expected manifest input %q, got %q", imagePath, saved.Input.ImagePath)
+			}
+			if saved.SafeInput == nil || saved.SafeInput.Original != imagePath {
+				t.Fatalf("Expected the mapping from %q to be recorded, got %+v", imagePath, saved.SafeInput)
+			}
+			if data, err := os.ReadFile(saved.SafeInput.Path); err != nil || string(data) != "photo" {
+				t.Errorf("Expected copy of the input at %s, got %q (err: %v)", saved.SafeInput.Path, data, err)
+			}
+		})
+	}
+}
+
+// TestToolInputPathPlainName verifies plainly named inputs are passed through uncopied
+func TestToolInputPathPlainName(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "photo.png")
+	manifest := NewManifest("test", types.PipelineInput{ImagePath: imagePath, TempDir: dir})
+
+	path, err := toolInputPath(manifest)
+	if err != nil {
+		t.Fatalf("toolInputPath failed: %v", err)
+	}
+	if path != imagePath || manifest.SafeInput != nil {
+		t.Errorf("Expected %s unchanged with no mapping, got %s (%+v)", imagePath, path, manifest.SafeInput)
+	}
+}
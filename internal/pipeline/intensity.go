@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"math"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Sources of the intensity given to segments that don't set their own
+const (
+	IntensitySourceDefault  = "default"  // The fixed defaultAnimationIntensity
+	IntensitySourceAuto     = "auto"     // Scaled from the subject's size in frame
+	IntensitySourceExplicit = "explicit" // PipelineInput.Intensity (--intensity)
+)
+
+// referenceSubjectSize is the subject size (square root of the share of the frame its
+// bounding box covers) that gets the default intensity unchanged
+const referenceSubjectSize = 0.5
+
+// Bounds of the auto-tuning factor, so extreme framings don't get extreme motion
+const (
+	minIntensityFactor = 0.4
+	maxIntensityFactor = 2.5
+)
+
+// intensityRanges are the safe ranges auto-tuned intensities are clamped to. Zoom
+// isn't tuned: its scale factor reads the same whatever the framing.
+var intensityRanges = map[string][2]float64{
+	AnimationRotate: {3, 15}, // Degrees
+	AnimationShake:  {4, 25}, // Pixels
+	AnimationNod:    {4, 25}, // Pixels
+}
+
+// IntensityTuning records how render_motion chose the intensity of segments without
+// their own, and the inputs of the formula
+type IntensityTuning struct {
+	Source      string             `json:"source"`
+	SubjectArea float64            `json:"subject_area,omitempty"` // Share of the frame covered by the subject's box
+	SubjectSize float64            `json:"subject_size,omitempty"` // Square root of SubjectArea
+	Factor      float64            `json:"factor,omitempty"`       // Applied to the default intensities
+	Intensities map[string]float64 `json:"intensities,omitempty"`  // Intensity given, by animation type
+}
+
+// tunedIntensity scales the default intensity of animation inversely with the subject's
+// size: a subject half the frame's width and height keeps the default, a smaller one
+// moves more and a close-up less. Returns the intensity and the factor applied.
+func tunedIntensity(animation string, subjectArea float64) (float64, float64) {
+	intensity := defaultAnimationIntensity[animation]
+	bounds, tuned := intensityRanges[animation]
+	if !tuned || subjectArea <= 0 {
+		return intensity, 1
+	}
+
+	size := math.Sqrt(math.Min(subjectArea, 1))
+	factor := clampFloat(referenceSubjectSize/size, minIntensityFactor, maxIntensityFactor)
+	return clampFloat(intensity*factor, bounds[0], bounds[1]), factor
+}
+
+// withDefaultIntensities sets the intensity of the rotate, shake and nod segments that
+// have none: explicit when positive, otherwise tuned from subjectArea when known.
+// Other segments are left for normalizeAnimationPlan's defaults.
+func withDefaultIntensities(plan []types.AnimationSegment, explicit, subjectArea float64) ([]types.AnimationSegment, IntensityTuning) {
+	tuning := IntensityTuning{Source: IntensitySourceDefault}
+	switch {
+	case explicit > 0:
+		tuning.Source = IntensitySourceExplicit
+	case subjectArea > 0:
+		tuning.Source = IntensitySourceAuto
+		tuning.SubjectArea = subjectArea
+		tuning.SubjectSize = math.Sqrt(math.Min(subjectArea, 1))
+	}
+	if tuning.Source == IntensitySourceDefault {
+		return plan, tuning
+	}
+
+	tuned := make([]types.AnimationSegment, len(plan))
+	for i, segment := range plan {
+		if _, ok := intensityRanges[segment.Type]; ok && segment.Intensity == 0 {
+			if explicit > 0 {
+				segment.Intensity = explicit
+			} else {
+				segment.Intensity, tuning.Factor = tunedIntensity(segment.Type, subjectArea)
+			}
+			if tuning.Intensities == nil {
+				tuning.Intensities = make(map[string]float64)
+			}
+			tuning.Intensities[segment.Type] = segment.Intensity
+		}
+		tuned[i] = segment
+	}
+	return tuned, tuning
+}
+
+// subjectArea returns the share of a width x height frame covered by a polygon's
+// bounding box, 0 when either is unknown
+func subjectArea(polygon []interface{}, width, height int) float64 {
+	minX, minY, maxX, maxY, ok := polygonBounds(polygon)
+	if !ok || width <= 0 || height <= 0 {
+		return 0
+	}
+	boxWidth := clampFloat(maxX, 0, float64(width)) - clampFloat(minX, 0, float64(width))
+	boxHeight := clampFloat(maxY, 0, float64(height)) - clampFloat(minY, 0, float64(height))
+	if boxWidth <= 0 || boxHeight <= 0 {
+		return 0
+	}
+	return boxWidth * boxHeight / (float64(width) * float64(height))
+}
+
+// clampFloat limits v to [lo, hi]
+func clampFloat(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
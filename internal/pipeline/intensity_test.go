@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"math"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestTunedIntensity verifies the intensity grows for small subjects, shrinks for
+// close-ups and stays within the safe ranges at the extremes
+func TestTunedIntensity(t *testing.T) {
+	tests := []struct {
+		name      string
+		animation string
+		area      float64
+		intensity float64
+		factor    float64
+	}{
+		{"reference size keeps the default", AnimationRotate, 0.25, 10, 1},
+		{"close-up rotates less", AnimationRotate, 0.64, 6.25, 0.625},
+		{"full frame clamps the factor", AnimationRotate, 1, 5, 0.5},
+		{"area above 1 is a full frame", AnimationRotate, 4, 5, 0.5},
+		{"small subject shakes more", AnimationShake, 0.04, 25, 2.5},
+		{"tiny subject clamps to the safe range", AnimationRotate, 0.0001, 15, 2.5},
+		{"tiny subject nods within range", AnimationNod, 0.0001, 25, 2.5},
+		{"medium subject nods more", AnimationNod, 0.16, 12.5, 1.25},
+		{"zoom isn't tuned", AnimationZoom, 0.01, 0.1, 1},
+		{"unknown size keeps the default", AnimationShake, 0, 10, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intensity, factor := tunedIntensity(tt.animation, tt.area)
+			if math.Abs(intensity-tt.intensity) > 1e-9 || math.Abs(factor-tt.factor) > 1e-9 {
+				t.Errorf("tunedIntensity(%s, %g) = %g (factor %g), want %g (factor %g)",
+					tt.animation, tt.area, intensity, factor, tt.intensity, tt.factor)
+			}
+			if bounds, ok := intensityRanges[tt.animation]; ok && (intensity < bounds[0] || intensity > bounds[1]) {
+				t.Errorf("Intensity %g outside the safe range %v", intensity, bounds)
+			}
+		})
+	}
+}
+
+func TestWithDefaultIntensities(t *testing.T) {
+	plan := []types.AnimationSegment{
+		{Type: AnimationRotate, Duration: 2},
+		{Type: AnimationShake, Duration: 2, Intensity: 3}, // Set by the user
+		{Type: AnimationZoom, Duration: 2},
+	}
+
+	tuned, tuning := withDefaultIntensities(plan, 0, 0.04)
+	if tuning.Source != IntensitySourceAuto || tuning.SubjectSize != 0.2 || tuning.Factor != 2.5 {
+		t.Errorf("Unexpected tuning: %+v", tuning)
+	}
+	if tuned[0].Intensity != 15 || tuned[1].Intensity != 3 || tuned[2].Intensity != 0 {
+		t.Errorf("Expected rotate tuned, shake kept and zoom left to the default, got %+v", tuned)
+	}
+	if plan[0].Intensity != 0 {
+		t.Error("withDefaultIntensities must not modify its input")
+	}
+
+	tuned, tuning = withDefaultIntensities(plan, 7, 0.04)
+	if tuning.Source != IntensitySourceExplicit || tuned[0].Intensity != 7 || tuned[1].Intensity != 3 {
+		t.Errorf("Expected the explicit intensity to win over tuning, got %+v (%+v)", tuned, tuning)
+	}
+
+	tuned, tuning = withDefaultIntensities(plan, 0, 0)
+	if tuning.Source != IntensitySourceDefault || tuned[0].Intensity != 0 {
+		t.Errorf("Expected the defaults without a subject size, got %+v (%+v)", tuned, tuning)
+	}
+}
+
+func TestSubjectArea(t *testing.T) {
+	polygon := []interface{}{
+		[]interface{}{10.0, 20.0}, []interface{}{60.0, 20.0}, []interface{}{60.0, 120.0},
+	}
+	if area := subjectArea(polygon, 100, 200); math.Abs(area-0.25) > 1e-9 {
+		t.Errorf("subjectArea = %g, want 0.25", area)
+	}
+	// Points beyond the frame are clipped to it
+	wide := []interface{}{[]interface{}{-50.0, -50.0}, []interface{}{500.0, 500.0}}
+	if area := subjectArea(wide, 100, 200); area != 1 {
+		t.Errorf("subjectArea = %g for a box beyond the frame, want 1", area)
+	}
+	if area := subjectArea(polygon, 0, 0); area != 0 {
+		t.Errorf("subjectArea = %g without the image size, want 0", area)
+	}
+}
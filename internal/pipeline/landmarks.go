@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Pose estimation defaults used when pipeline.landmarks leaves them unset
+const (
+	DefaultLandmarksModel      = "yolov8n-pose.pt"
+	DefaultLandmarksConfidence = 0.3
+)
+
+// cocoKeypoints is the number of keypoints in a COCO pose, the most min_keypoints can ask for
+const cocoKeypoints = 17
+
+// yoloListModelsTool lists the models the YOLO server can load, when it exposes it
+const yoloListModelsTool = "list_available_models"
+
+// ResolveLandmarksConfig fills in the default model and confidence and rejects
+// out-of-range values
+func ResolveLandmarksConfig(config types.LandmarksConfig) (types.LandmarksConfig, error) {
+	config.Model = strings.TrimSpace(config.Model)
+	if config.Model == "" {
+		config.Model = DefaultLandmarksModel
+	}
+	if config.Confidence < 0 || config.Confidence > 1 {
+		return config, fmt.Errorf("landmarks confidence must be between 0 and 1, got %v", config.Confidence)
+	}
+	if config.Confidence == 0 {
+		config.Confidence = DefaultLandmarksConfidence
+	}
+	if config.MinKeypoints < 0 || config.MinKeypoints > cocoKeypoints {
+		return config, fmt.Errorf("min_keypoints must be between 0 and %d, got %d", cocoKeypoints, config.MinKeypoints)
+	}
+	return config, nil
+}
+
+// landmarksParameters returns the pose model and confidence for a run: the configured
+// values, overridden by the decision's landmark_model and landmark_confidence parameters
+func (p *Pipeline) landmarksParameters(manifest *Manifest) (model string, confidence float64) {
+	model, confidence = p.landmarksConfig.Model, p.landmarksConfig.Confidence
+	if model == "" {
+		model = DefaultLandmarksModel
+	}
+	if confidence == 0 {
+		confidence = DefaultLandmarksConfidence
+	}
+
+	if manifest.LLMAnalysis != nil && manifest.LLMAnalysis.Decision != nil {
+		parameters := manifest.LLMAnalysis.Decision.Parameters
+		if conf, ok := parameters["landmark_confidence"].(float64); ok {
+			confidence = conf
+			if p.llmProvider != nil {
+				log.Printf("[AI Agent] Using LLM landmark confidence: %.2f", confidence)
+			}
+		}
+		if name, ok := parameters["landmark_model"].(string); ok && name != "" {
+			model = name
+			if p.llmProvider != nil {
+				log.Printf("[AI Agent] Using LLM landmark model: %s", model)
+			}
+		}
+	}
+	return model, confidence
+}
+
+// checkLandmarksModel fails when the YOLO server lists its available models and model
+// is not one of them. Servers without a listing tool are trusted to load the model.
+func (p *Pipeline) checkLandmarksModel(ctx context.Context, model string) error {
+	tools, err := p.yoloClient.ListTools(ctx)
+	if err != nil {
+		log.Printf("Warning: cannot list YOLO tools, not validating model %s: %v", model, err)
+		return nil
+	}
+	listed := false
+	for _, tool := range tools {
+		if tool.Name == yoloListModelsTool {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return nil
+	}
+
+	result, err := callTool(ctx, "yolo", p.yoloClient, yoloListModelsTool, map[string]interface{}{})
+	if err != nil {
+		log.Printf("Warning: %s failed, not validating model %s: %v", yoloListModelsTool, model, err)
+		return nil
+	}
+	var text strings.Builder
+	for _, block := range result.Content {
+		text.WriteString(block.Text)
+		text.WriteString("\n")
+	}
+	models := parseModelList(text.String())
+	if len(models) == 0 {
+		return nil
+	}
+	for _, available := range models {
+		if available == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("pose model %s is not available on the YOLO server (available: %s)",
+		model, strings.Join(models, ", "))
+}
+
+// parseModelList reads model file names from a listing result: a JSON list, an object
+// holding a list (e.g. {"models": [...]}), or plain text with one name per line or comma
+func parseModelList(text string) []string {
+	var doc interface{}
+	var names []string
+	if err := json.Unmarshal([]byte(text), &doc); err == nil {
+		names = modelNames(doc)
+	} else {
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' }) {
+			field = strings.Trim(strings.TrimSpace(field), `-*"'`)
+			if strings.HasSuffix(field, ".pt") {
+				names = append(names, strings.TrimSpace(field))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// modelNames collects the .pt file names in a parsed listing result
+func modelNames(doc interface{}) []string {
+	var names []string
+	switch v := doc.(type) {
+	case string:
+		if strings.HasSuffix(v, ".pt") {
+			names = append(names, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			names = append(names, modelNames(item)...)
+		}
+	case map[string]interface{}:
+		for _, value := range v {
+			names = append(names, modelNames(value)...)
+		}
+	}
+	return names
+}
+
+// visibleKeypoints counts the keypoints of a pose detection with a positive confidence.
+// Keypoints are [x, y] or [x, y, confidence] lists, or objects with a "confidence" or
+// "visibility"; those without a confidence count as visible.
+func visibleKeypoints(detection map[string]interface{}) int {
+	keypoints, _ := detection["keypoints"].([]interface{})
+	visible := 0
+	for _, keypoint := range keypoints {
+		score, scored := 1.0, false
+		switch kp := keypoint.(type) {
+		case []interface{}:
+			if len(kp) >= 3 {
+				score, scored = kp[2].(float64)
+			}
+		case map[string]interface{}:
+			if score, scored = kp["confidence"].(float64); !scored {
+				score, scored = kp["visibility"].(float64)
+			}
+		default:
+			continue
+		}
+		if !scored || score > 0 {
+			visible++
+		}
+	}
+	return visible
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestResolveLandmarksConfig verifies defaults and range checks
+func TestResolveLandmarksConfig(t *testing.T) {
+	config, err := ResolveLandmarksConfig(types.LandmarksConfig{})
+	if err != nil {
+		t.Fatalf("ResolveLandmarksConfig failed: %v", err)
+	}
+	if config.Model != DefaultLandmarksModel || config.Confidence != DefaultLandmarksConfidence {
+		t.Errorf("Expected defaults, got %+v", config)
+	}
+
+	invalid := []types.LandmarksConfig{
+		{Confidence: 1.5},
+		{Confidence: -0.1},
+		{MinKeypoints: 18},
+		{MinKeypoints: -1},
+	}
+	for _, config := range invalid {
+		if _, err := ResolveLandmarksConfig(config); err == nil {
+			t.Errorf("Expected %+v to be rejected", config)
+		}
+	}
+}
+
+// TestParseModelList verifies model names are read from JSON and plain text listings
+func TestParseModelList(t *testing.T) {
+	tests := map[string]string{
+		"json list":   `["yolov8n-pose.pt", "yolov8m-pose.pt"]`,
+		"json object": `{"models": ["yolov8n-pose.pt", "yolov8m-pose.pt"], "count": 2}`,
+		"plain text":  "Available models:\n- yolov8n-pose.pt\n- yolov8m-pose.pt\n",
+	}
+	expected := []string{"yolov8m-pose.pt", "yolov8n-pose.pt"}
+	for name, text := range tests {
+		if got := parseModelList(text); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+}
+
+// TestLandmarksModelConfig verifies the configured model is validated against the
+// server's listing, sent to the tool and recorded, and that the decision overrides it
+func TestLandmarksModelConfig(t *testing.T) {
+	run := func(tools *fakeToolClient, config types.LandmarksConfig, decision *llm.PipelineDecision) (*Manifest, error) {
+		p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+		p.SetLandmarksConfig(config)
+		manifest := NewManifest("test", types.PipelineInput{TempDir: t.TempDir()})
+		manifest.Result = &PipelineResult{SegmentedImagePath: "/tmp/segmented.png"}
+		if decision != nil {
+			manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: decision}
+		}
+		return manifest, ExecuteEstimateLandmarks(context.Background(), p, manifest)
+	}
+	stageModel := func(manifest *Manifest) string {
+		var output map[string]interface{}
+		json.Unmarshal(manifest.Stages[types.StageLandmarks].Output, &output)
+		model, _ := output["model_name"].(string)
+		return model
+	}
+
+	tools := newFakeToolClient()
+	tools.models = `["yolov8n-pose.pt", "yolov8m-pose.pt"]`
+	manifest, err := run(tools, types.LandmarksConfig{Model: "yolov8m-pose.pt"}, nil)
+	if err != nil {
+		t.Fatalf("ExecuteEstimateLandmarks failed: %v", err)
+	}
+	if got := stageModel(manifest); got != "yolov8m-pose.pt" {
+		t.Errorf("Expected model yolov8m-pose.pt in stage output, got %q", got)
+	}
+
+	_, err = run(tools, types.LandmarksConfig{Model: "yolov9x-pose.pt"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "yolov8m-pose.pt, yolov8n-pose.pt") {
+		t.Errorf("Expected an error listing the available models, got %v", err)
+	}
+	if tools.calls["analyze_image_from_path"] != 1 {
+		t.Errorf("Expected no pose call with an unavailable model, got %v", tools.calls)
+	}
+
+	// Without a listing tool the model is passed through; the decision wins over config
+	decision := &llm.PipelineDecision{Parameters: map[string]interface{}{"landmark_model": "custom-pose.pt"}}
+	manifest, err = run(newFakeToolClient(), types.LandmarksConfig{Model: "yolov8m-pose.pt"}, decision)
+	if err != nil {
+		t.Fatalf("ExecuteEstimateLandmarks failed: %v", err)
+	}
+	if got := stageModel(manifest); got != "custom-pose.pt" {
+		t.Errorf("Expected decision model custom-pose.pt, got %q", got)
+	}
+}
+
+// TestLandmarksMinKeypoints verifies people with too few visible keypoints are ignored
+func TestLandmarksMinKeypoints(t *testing.T) {
+	tools := newFakeToolClient()
+	tools.poseResponse = `{"detections":[{"confidence":0.9,"keypoints":[[1,2,0.9],[3,4,0.8],[5,6,0]]}]}`
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+
+	for _, tt := range []struct {
+		minKeypoints int
+		expectErr    bool
+	}{{2, false}, {3, true}} {
+		p.SetLandmarksConfig(types.LandmarksConfig{MinKeypoints: tt.minKeypoints})
+		manifest := NewManifest("test", types.PipelineInput{TempDir: t.TempDir()})
+		manifest.Result = &PipelineResult{SegmentedImagePath: "/tmp/segmented.png"}
+
+		err := ExecuteEstimateLandmarks(context.Background(), p, manifest)
+		if tt.expectErr != errors.Is(err, ErrNoSubjectDetected) {
+			t.Errorf("min_keypoints %d: expected no subject error: %v, got %v", tt.minKeypoints, tt.expectErr, err)
+		}
+	}
+}
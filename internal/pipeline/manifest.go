@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/zhe.chen/agent-funpic-act/internal/llm"
@@ -20,9 +21,30 @@ type Manifest struct {
 	// Input parameters
 	Input types.PipelineInput `json:"input"`
 
+	// Format and dimensions of the input image, for reference
+	InputImage *ImageInfo `json:"input_image,omitempty"`
+
+	// Working copy of the input image used for tool calls (set when downscaling is enabled)
+	ProcessImage *ProcessImage `json:"process_image,omitempty"`
+
+	// Sanitized copy of an input image whose path tools and models can't handle
+	SafeInput *SafeInput `json:"safe_input,omitempty"`
+
+	// Append-only event log of the run (see EventLogFileName)
+	EventsFile string `json:"events_file,omitempty"`
+
 	// LLM analysis and decision (AI Agent feature)
 	LLMAnalysis *llm.LLMAnalysis `json:"llm_analysis,omitempty"`
 
+	// Resumes that discarded the stored decision with --reanalyze, oldest first
+	Reanalyses []Reanalysis `json:"reanalyses,omitempty"`
+
+	// Parameter changes the LLM suggested for stages that ran out of retries, oldest first
+	Repairs []Repair `json:"repairs,omitempty"`
+
+	// Sub-steps of the compose stage that finished, reused when compose runs again
+	Compose *ComposeProgress `json:"compose,omitempty"`
+
 	// Current execution state
 	CurrentStage types.PipelineStage `json:"current_stage"`
 	Stages       map[types.PipelineStage]*StageState `json:"stages"`
@@ -37,17 +59,122 @@ type StageState struct {
 	StartedAt  *time.Time        `json:"started_at,omitempty"`
 	CompletedAt *time.Time       `json:"completed_at,omitempty"`
 	RetryCount int               `json:"retry_count"`
+	Attempt    int               `json:"attempt,omitempty"` // Incremented each time the stage starts; names its artifacts
 	Error      string            `json:"error,omitempty"`
 	Output     json.RawMessage   `json:"output,omitempty"` // Stage-specific output
+
+	// Process that last started the stage, to tell a crashed run from a live one
+	OwnerPID  int    `json:"owner_pid,omitempty"`
+	OwnerHost string `json:"owner_host,omitempty"`
+}
+
+// ComposeProgress records the compose sub-steps that finished (select the track,
+// download it, mux it into the partial output), so a compose that fails later skips
+// them when it runs again instead of downloading the music again
+type ComposeProgress struct {
+	Track        *MusicTrack `json:"track,omitempty"`         // Track selected from the search results
+	MusicPath    string      `json:"music_path,omitempty"`    // Downloaded track, until muxed
+	MuxedPath    string      `json:"muxed_path,omitempty"`    // Partial output the audio was muxed into
+	MusicQuality string      `json:"music_quality,omitempty"` // Quality of the muxed audio, empty without music
 }
 
 // PipelineResult contains the final output
 type PipelineResult struct {
 	SegmentedImagePath string   `json:"segmented_image_path,omitempty"`
 	LandmarksData      string   `json:"landmarks_data,omitempty"`
+	LandmarksScale     float64  `json:"landmarks_scale,omitempty"` // Divide landmark coordinates by this to map to the original image
 	MotionVideoPath    string   `json:"motion_video_path,omitempty"`
 	MusicTracks        []string `json:"music_tracks,omitempty"`
+	MusicQuality       string   `json:"music_quality,omitempty"` // Quality of the audio muxed into the final output
 	FinalOutputPath    string   `json:"final_output_path,omitempty"`
+	ContentHash        string   `json:"content_hash,omitempty"`       // SHA-256 of the final output, with the content-hash output name
+	LatestOutputPath   string   `json:"latest_output_path,omitempty"` // Stable link to the final output, with the content-hash output name
+	ComparisonPath     string   `json:"comparison_path,omitempty"`    // Before/after video, with pipeline.comparison enabled
+	CaptionPaths       []string `json:"caption_paths,omitempty"`      // Sidecar .srt/.vtt captions, with pipeline.captions set
+	ImageDescription   string   `json:"image_description,omitempty"` // One-sentence description of the input image
+
+	// People animated independently in per_person mode, and the layer of those beyond max_people
+	Subjects           []Subject `json:"subjects,omitempty"`
+	StaticSubjectsPath string    `json:"static_subjects_path,omitempty"`
+
+	// Share of the frame covered by the animated subject's bounding box, from segmentation
+	SubjectArea float64 `json:"subject_area,omitempty"`
+
+	// Animated subject's bounding box in the segmented image, and where pipeline.placement
+	// put it over the background
+	SubjectBounds   *SubjectBounds `json:"subject_bounds,omitempty"`
+	PlacedImagePath string         `json:"placed_image_path,omitempty"`
+
+	// Bytes of the files each stage produced and their total, for capacity planning
+	ArtifactBytes      map[types.PipelineStage]int64 `json:"artifact_bytes,omitempty"`
+	TotalArtifactBytes int64                         `json:"total_artifact_bytes,omitempty"`
+
+	// Problems that didn't stop the run, e.g. music left out because its credentials expired
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Server and tool that produced each artifact, keyed by Artifact* name
+	Provenance map[string]*types.ToolProvenance `json:"provenance,omitempty"`
+
+	// Full AI mode conversation usage, with the per-round breakdown
+	Conversation *llm.FullAIConversationMetrics `json:"conversation,omitempty"`
+	LLMDebugDir  string                         `json:"llm_debug_dir,omitempty"` // Sanitized provider payloads, with --llm-debug-dir
+
+	// Conversations started when earlier ones failed with transient errors; Conversation
+	// covers the last. Unset when the first conversation ran to the end.
+	ConversationAttempts int `json:"conversation_attempts,omitempty"`
+}
+
+// SetField sets a result field by its extraction name (see llm.ResultField* constants).
+// Paths are stored with the OS separator, whatever the tool reported.
+// Returns false if the field name is unknown.
+func (r *PipelineResult) SetField(field, value string) bool {
+	value = filepath.FromSlash(value)
+	switch field {
+	case llm.ResultFieldSegmentedImage:
+		r.SegmentedImagePath = value
+	case llm.ResultFieldMotionVideo:
+		r.MotionVideoPath = value
+	case llm.ResultFieldFinalOutput:
+		r.FinalOutputPath = value
+	default:
+		return false
+	}
+	return true
+}
+
+// Artifact names keying PipelineResult.Provenance. Those produced in full AI mode match
+// the extraction field they are recorded from.
+const (
+	ArtifactSegmentedImage = llm.ResultFieldSegmentedImage
+	ArtifactLandmarks      = "landmarks_data"
+	ArtifactMotionVideo    = llm.ResultFieldMotionVideo
+	ArtifactMusic          = "music"
+	ArtifactFinalOutput    = llm.ResultFieldFinalOutput
+)
+
+// SetProvenance records the tool that produced an artifact; a nil source clears it
+func (r *PipelineResult) SetProvenance(artifact string, source *types.ToolProvenance) {
+	if source == nil {
+		delete(r.Provenance, artifact)
+		return
+	}
+	if r.Provenance == nil {
+		r.Provenance = make(map[string]*types.ToolProvenance)
+	}
+	r.Provenance[artifact] = source
+}
+
+// SetArtifactBytes records the size of the files a stage produced, replacing those of
+// an earlier attempt, and updates the total
+func (r *PipelineResult) SetArtifactBytes(stage types.PipelineStage, n int64) {
+	if r.ArtifactBytes == nil {
+		r.ArtifactBytes = make(map[types.PipelineStage]int64)
+	}
+	r.ArtifactBytes[stage] = n
+	r.TotalArtifactBytes = 0
+	for _, bytes := range r.ArtifactBytes {
+		r.TotalArtifactBytes += bytes
+	}
 }
 
 // NewManifest creates a new pipeline manifest
@@ -121,6 +248,9 @@ func (m *Manifest) StartStage(stage types.PipelineStage) {
 	now := time.Now()
 	state.Status = types.StatusRunning
 	state.StartedAt = &now
+	state.Attempt++
+	state.OwnerPID = os.Getpid()
+	state.OwnerHost = hostname
 	m.CurrentStage = stage
 }
 
@@ -150,12 +280,51 @@ func (m *Manifest) FailStage(stage types.PipelineStage, err error) {
 	state.RetryCount++
 }
 
+// InterruptStage resets a running stage to pending so a resumed run starts it again.
+// Unlike FailStage it does not count towards the retry limit.
+func (m *Manifest) InterruptStage(stage types.PipelineStage) {
+	state := m.GetStageState(stage)
+	state.Status = types.StatusPending
+	state.Error = "interrupted"
+}
+
+// ResetStage returns a stage to pending so the run executes it again. Its attempt count
+// is kept, so the new artifacts don't overwrite the old ones.
+func (m *Manifest) ResetStage(stage types.PipelineStage) {
+	state := m.GetStageState(stage)
+	state.Status = types.StatusPending
+	state.StartedAt = nil
+	state.CompletedAt = nil
+	state.RetryCount = 0
+	state.Error = ""
+	state.Output = nil
+	if stage == types.StageCompose {
+		m.Compose = nil
+	}
+}
+
+// composeProgress returns the compose sub-step record, creating it if needed
+func (m *Manifest) composeProgress() *ComposeProgress {
+	if m.Compose == nil {
+		m.Compose = &ComposeProgress{}
+	}
+	return m.Compose
+}
+
 // SkipStage marks a stage as skipped
 func (m *Manifest) SkipStage(stage types.PipelineStage) {
 	state := m.GetStageState(stage)
 	state.Status = types.StatusSkipped
 }
 
+// SkipFailedStage marks a failed stage as skipped so the run continues, keeping its error.
+// Unlike FailStage it does not count towards the retry limit.
+func (m *Manifest) SkipFailedStage(stage types.PipelineStage, err error) {
+	state := m.GetStageState(stage)
+	state.Status = types.StatusSkipped
+	state.Error = err.Error()
+}
+
 // IsStageCompleted checks if a stage was already completed
 func (m *Manifest) IsStageCompleted(stage types.PipelineStage) bool {
 	state := m.Stages[stage]
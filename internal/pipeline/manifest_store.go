@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestStore persists one pipeline's manifest between stages and across resumes.
+// The default stores it in a JSON file; integrators can keep manifests in a database.
+type ManifestStore interface {
+	// Load returns the stored manifest, or nil when the pipeline hasn't saved one yet
+	Load(ctx context.Context) (*Manifest, error)
+	// Save replaces the stored manifest
+	Save(ctx context.Context, manifest *Manifest) error
+}
+
+// FileManifestStore stores the manifest as JSON at Path, replacing it atomically
+type FileManifestStore struct {
+	Path string
+}
+
+// NewFileManifestStore creates a store for the manifest file at path
+func NewFileManifestStore(path string) *FileManifestStore {
+	return &FileManifestStore{Path: path}
+}
+
+// Load reads the manifest file
+func (s *FileManifestStore) Load(ctx context.Context) (*Manifest, error) {
+	return LoadManifest(s.Path)
+}
+
+// Save writes the manifest file
+func (s *FileManifestStore) Save(ctx context.Context, manifest *Manifest) error {
+	return manifest.Save(s.Path)
+}
+
+// ManifestPathFor returns the manifest file of a pipeline in a directory keyed by
+// pipeline ID: <dir>/<pipelineID>.json
+func ManifestPathFor(dir, pipelineID string) (string, error) {
+	if pipelineID == "" || pipelineID == "." || pipelineID == ".." || strings.ContainsAny(pipelineID, `/\`) {
+		return "", fmt.Errorf("pipeline ID %q cannot be used as a manifest file name", pipelineID)
+	}
+	return filepath.Join(dir, pipelineID+".json"), nil
+}
+
+// ListManifests reads every manifest in a directory keyed by pipeline ID, most recently
+// updated first. Files that aren't manifests are skipped with a warning.
+func ListManifests(dir string) ([]*Manifest, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read manifest directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*Manifest
+	for _, path := range paths {
+		manifest, err := LoadManifest(path)
+		switch {
+		case err != nil:
+			log.Printf("Warning: skipping %s: %v", path, err)
+			continue
+		case manifest == nil || manifest.PipelineID == "":
+			log.Printf("Warning: skipping %s: not a pipeline manifest", path)
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].UpdatedAt.After(manifests[j].UpdatedAt)
+	})
+	return manifests, nil
+}
+
+// MemoryManifestStore keeps the manifest in memory, for tests that exercise resume
+// without touching disk. It stores the encoded JSON, so a loaded manifest is a fresh
+// copy just like one read back from a file.
+type MemoryManifestStore struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// NewMemoryManifestStore creates an empty in-memory store
+func NewMemoryManifestStore() *MemoryManifestStore {
+	return &MemoryManifestStore{}
+}
+
+// Load decodes the stored manifest
+func (s *MemoryManifestStore) Load(ctx context.Context) (*Manifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		return nil, nil
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(s.data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Save encodes and stores the manifest
+func (s *MemoryManifestStore) Save(ctx context.Context, manifest *Manifest) error {
+	manifest.UpdatedAt = time.Now()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestManifestStores(t *testing.T) {
+	stores := map[string]ManifestStore{
+		"file":   NewFileManifestStore(filepath.Join(t.TempDir(), "manifest.json")),
+		"memory": NewMemoryManifestStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			manifest, err := store.Load(ctx)
+			if err != nil || manifest != nil {
+				t.Fatalf("Expected no manifest before the first save, got %v (err: %v)", manifest, err)
+			}
+
+			saved := NewManifest("store-test", types.PipelineInput{ImagePath: "/in.png", Duration: 5})
+			saved.StartStage(types.StageSegmentPerson)
+			if err := store.Save(ctx, saved); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			// Later changes only reach the store when saved again
+			saved.CurrentStage = types.StageCompose
+
+			loaded, err := store.Load(ctx)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if loaded == saved {
+				t.Error("Expected Load to return a copy")
+			}
+			if loaded.PipelineID != "store-test" || loaded.CurrentStage != types.StageSegmentPerson {
+				t.Errorf("Unexpected manifest %s at %s", loaded.PipelineID, loaded.CurrentStage)
+			}
+			if state := loaded.Stages[types.StageSegmentPerson]; state == nil || state.Attempt != 1 {
+				t.Errorf("Expected the stage state to round-trip, got %+v", state)
+			}
+		})
+	}
+}
+
+func TestManifestPathFor(t *testing.T) {
+	tests := []struct {
+		pipelineID string
+		expected   string
+		wantErr    bool
+	}{
+		{"pipeline-1700000000", filepath.Join("manifests", "pipeline-1700000000.json"), false},
+		{"job.v2", filepath.Join("manifests", "job.v2.json"), false},
+		{"", "", true},
+		{"..", "", true},
+		{"../escape", "", true},
+		{`nested\id`, "", true},
+	}
+
+	for _, tt := range tests {
+		path, err := ManifestPathFor("manifests", tt.pipelineID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ManifestPathFor(%q) error = %v, wantErr %v", tt.pipelineID, err, tt.wantErr)
+		}
+		if path != tt.expected {
+			t.Errorf("ManifestPathFor(%q) = %q, want %q", tt.pipelineID, path, tt.expected)
+		}
+	}
+}
+
+// TestResumeWithMemoryStore resumes a failed run from an in-memory manifest, checking
+// completed stages aren't run again
+func TestResumeWithMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	calls := make(map[types.PipelineStage]int)
+	failCompose := true
+	registry := NewStepRegistry()
+	for _, stage := range []types.PipelineStage{types.StageSegmentPerson, types.StageCompose} {
+		registry.Register(stage, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+			calls[stage]++
+			if stage == types.StageCompose && failCompose {
+				return errors.New("mux failed")
+			}
+			return manifest.CompleteStage(stage, map[string]string{})
+		})
+	}
+
+	store := NewMemoryManifestStore()
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetManifestStore(store)
+	p.SetStepRegistry(registry)
+	p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, types.StageCompose})
+
+	input := types.PipelineInput{ImagePath: "/in.png", Duration: 5}
+	if _, err := p.Execute(context.Background(), input, "resume-test"); err == nil {
+		t.Fatal("Expected the first run to fail at compose")
+	}
+
+	failCompose = false
+	if _, err := p.Execute(context.Background(), input, "resume-test"); err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+	if calls[types.StageSegmentPerson] != 1 || calls[types.StageCompose] != 2 {
+		t.Errorf("Expected segment once and compose twice, got %v", calls)
+	}
+
+	manifest, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if manifest.CurrentStage != types.StageComplete || manifest.Stages[types.StageCompose].RetryCount != 1 {
+		t.Errorf("Expected a complete manifest with one compose retry, got %s with %+v",
+			manifest.CurrentStage, manifest.Stages[types.StageCompose])
+	}
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+)
+
+// titleMetadataArgs builds the ffmpeg arguments that copy videoPath to outputPath with
+// the title tag set. Streams are copied, not re-encoded.
+func titleMetadataArgs(videoPath, outputPath, title string) []string {
+	return []string{
+		"-y",
+		"-i", videoPath,
+		"-map", "0",
+		"-c", "copy",
+		"-metadata", "title=" + title,
+		outputPath,
+	}
+}
+
+// writeTitleMetadata sets the title tag of the video at videoPath in place. The title is
+// sanitized first so newlines and control characters never reach the container.
+func writeTitleMetadata(ctx context.Context, videoPath, title string) error {
+	title = llm.SanitizeDescription(title, llm.MaxImageDescriptionLength)
+	if title == "" {
+		return nil
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return fmt.Errorf("video not found: %w", err)
+	}
+
+	// Keep the extension so ffmpeg picks the same container for the temporary file
+	tempPath := filepath.Join(filepath.Dir(videoPath), ".title_"+filepath.Base(videoPath))
+	cmd := procgroup.CommandContext(ctx, "ffmpeg", titleMetadataArgs(videoPath, tempPath, title)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("ffmpeg metadata failed: %w, output: %s", err, output)
+	}
+
+	if err := os.Rename(tempPath, videoPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace video: %w", err)
+	}
+
+	log.Printf("Wrote title metadata to %s", videoPath)
+	return nil
+}
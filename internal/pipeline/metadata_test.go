@@ -0,0 +1,21 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTitleMetadataArgs(t *testing.T) {
+	got := titleMetadataArgs("/out/final.mp4", "/out/.title_final.mp4", "dog on a beach")
+	expected := []string{
+		"-y",
+		"-i", "/out/final.mp4",
+		"-map", "0",
+		"-c", "copy",
+		"-metadata", "title=dog on a beach",
+		"/out/.title_final.mp4",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("titleMetadataArgs() = %v, expected %v", got, expected)
+	}
+}
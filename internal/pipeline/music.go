@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/jsonpath"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Default field mapping for Epidemic Sound's SearchRecordings GraphQL response
+const (
+	DefaultMusicTracksPath = "data.recordings.nodes"
+	DefaultMusicURLField   = "recording.audioFile.lqmp3Url"
+	DefaultMusicTitleField = "recording.title"
+	DefaultMusicIDField    = "recording.id"
+	DefaultMusicHQURLField = "recording.audioFile.mp3Url"
+)
+
+// Music quality preferences
+const (
+	MusicQualityLow  = "low"
+	MusicQualityHigh = "high"
+)
+
+// MusicTrack is a downloadable track parsed from a music search response
+type MusicTrack struct {
+	ID      string `json:"id,omitempty"` // Provider's track ID, when the response has one
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Quality string `json:"quality"` // Quality of URL: "low" or "high"
+}
+
+// withMusicDefaults fills empty field mappings with the Epidemic Sound defaults
+func withMusicDefaults(config types.MusicConfig) types.MusicConfig {
+	if config.TracksPath == "" {
+		config.TracksPath = DefaultMusicTracksPath
+	}
+	if config.URLField == "" {
+		config.URLField = DefaultMusicURLField
+	}
+	if config.TitleField == "" {
+		config.TitleField = DefaultMusicTitleField
+	}
+	if config.IDField == "" {
+		config.IDField = DefaultMusicIDField
+	}
+	if config.HQURLField == "" {
+		config.HQURLField = DefaultMusicHQURLField
+	}
+	if config.Quality == "" {
+		config.Quality = MusicQualityLow
+	}
+	return config
+}
+
+// parseMusicTracks extracts tracks from a music search response using the configured
+// field mapping. With the high quality preference the high-quality URL is used when
+// present, falling back to the low-quality one. Tracks without a URL are skipped.
+func parseMusicTracks(data string, config types.MusicConfig) ([]MusicTrack, error) {
+	config = withMusicDefaults(config)
+	if config.Quality != MusicQualityLow && config.Quality != MusicQualityHigh {
+		return nil, fmt.Errorf("invalid music quality: %s (supported: low, high)", config.Quality)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse music data: %w", err)
+	}
+
+	value, ok := jsonpath.Lookup(doc, config.TracksPath)
+	if !ok {
+		return nil, fmt.Errorf("tracks path %s not found in music data", config.TracksPath)
+	}
+	nodes, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("tracks path %s is not a list", config.TracksPath)
+	}
+
+	var tracks []MusicTrack
+	for _, node := range nodes {
+		track := MusicTrack{}
+		if config.Quality == MusicQualityHigh {
+			if url, ok := jsonpath.LookupString(node, config.HQURLField); ok {
+				track.URL = url
+				track.Quality = MusicQualityHigh
+			}
+		}
+		if track.URL == "" {
+			url, ok := jsonpath.LookupString(node, config.URLField)
+			if !ok {
+				continue
+			}
+			track.URL = url
+			track.Quality = MusicQualityLow
+		}
+		track.Title, _ = jsonpath.LookupString(node, config.TitleField)
+		track.ID, _ = jsonpath.LookupString(node, config.IDField)
+		tracks = append(tracks, track)
+	}
+
+	return tracks, nil
+}
+
+// downloadMusic downloads url to path. The file is written under partialPath and only
+// renamed into place once the whole body, as announced by Content-Length, has arrived,
+// so an interrupted download never leaves a truncated track behind for compose.
+func downloadMusic(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid music URL: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("music download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("music download failed with status %d", resp.StatusCode)
+	}
+
+	partial := partialPath(path)
+	if err := writeDownload(partial, resp); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return commitArtifact(partial, path)
+}
+
+// writeDownload writes a response body to path, checking it is complete and non-empty
+func writeDownload(path string, resp *http.Response) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create music file: %w", err)
+	}
+	written, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		return fmt.Errorf("music download interrupted after %d bytes: %w", written, err)
+	case resp.ContentLength >= 0 && written != resp.ContentLength:
+		return fmt.Errorf("music download truncated: got %d of %d bytes", written, resp.ContentLength)
+	case written == 0:
+		return fmt.Errorf("music download is empty")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Music selection strategies
+const (
+	MusicSelectionFirst      = "first"       // Always the top search result (default)
+	MusicSelectionRandom     = "random"      // A random result, reproducible with a seed
+	MusicSelectionRoundRobin = "round_robin" // The first result not used recently
+)
+
+// Round robin defaults
+const (
+	DefaultMusicStateFile    = ".music_selection.json"
+	DefaultMusicRecentTracks = 5
+)
+
+// musicStateMu serializes round robin state updates from concurrent pipelines
+var musicStateMu sync.Mutex
+
+// musicSelectionState is the round robin state file: recently used tracks, oldest first
+type musicSelectionState struct {
+	Recent []string `json:"recent"`
+}
+
+// ResolveMusicSelection validates a music selection strategy; empty selects first
+func ResolveMusicSelection(selection string) (string, error) {
+	switch selection {
+	case "":
+		return MusicSelectionFirst, nil
+	case MusicSelectionFirst, MusicSelectionRandom, MusicSelectionRoundRobin:
+		return selection, nil
+	default:
+		return "", fmt.Errorf("invalid music selection %q (supported: %s, %s, %s)",
+			selection, MusicSelectionFirst, MusicSelectionRandom, MusicSelectionRoundRobin)
+	}
+}
+
+// selectMusicTrack picks the track compose uses from non-empty search results.
+// Random picks are derived from the seed and pipeline ID, so a seeded batch is
+// reproducible while its clips still get different tracks; seed 0 is unseeded.
+// Selection problems are logged and fall back to the first track.
+func selectMusicTrack(tracks []MusicTrack, config types.MusicConfig, pipelineID string) MusicTrack {
+	selection, err := ResolveMusicSelection(config.Selection)
+	if err != nil {
+		log.Printf("Warning: %v, using the first track", err)
+		return tracks[0]
+	}
+
+	switch selection {
+	case MusicSelectionRandom:
+		return tracks[musicRand(config.Seed, pipelineID).IntN(len(tracks))]
+	case MusicSelectionRoundRobin:
+		track, err := selectRoundRobin(tracks, config)
+		if err != nil {
+			log.Printf("Warning: round robin music selection failed, using the first track: %v", err)
+			return tracks[0]
+		}
+		return track
+	default:
+		return tracks[0]
+	}
+}
+
+// musicRand returns the random source for a pipeline's music pick
+func musicRand(seed int64, pipelineID string) *rand.Rand {
+	if seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(pipelineID))
+	return rand.New(rand.NewPCG(uint64(seed), h.Sum64()))
+}
+
+// selectRoundRobin picks the first track not among the recently used ones, or the
+// least recently used when all are recent, and records the pick in the state file
+func selectRoundRobin(tracks []MusicTrack, config types.MusicConfig) (MusicTrack, error) {
+	stateFile := config.StateFile
+	if stateFile == "" {
+		stateFile = DefaultMusicStateFile
+	}
+	keep := config.RecentTracks
+	if keep <= 0 {
+		keep = DefaultMusicRecentTracks
+	}
+
+	musicStateMu.Lock()
+	defer musicStateMu.Unlock()
+
+	state, err := loadMusicSelectionState(stateFile)
+	if err != nil {
+		return MusicTrack{}, err
+	}
+
+	lastUsed := make(map[string]int, len(state.Recent))
+	for i, key := range state.Recent {
+		lastUsed[key] = i + 1
+	}
+	// Unused tracks rank 0, so this is the first unused track or the least recently used
+	chosen := 0
+	for i, track := range tracks {
+		if lastUsed[trackKey(track)] < lastUsed[trackKey(tracks[chosen])] {
+			chosen = i
+		}
+	}
+	track := tracks[chosen]
+
+	recent := make([]string, 0, len(state.Recent)+1)
+	for _, key := range state.Recent {
+		if key != trackKey(track) {
+			recent = append(recent, key)
+		}
+	}
+	recent = append(recent, trackKey(track))
+	if len(recent) > keep {
+		recent = recent[len(recent)-keep:]
+	}
+	state.Recent = recent
+
+	if err := saveMusicSelectionState(stateFile, state); err != nil {
+		return MusicTrack{}, err
+	}
+	return track, nil
+}
+
+// trackKey identifies a track across searches: its title, or URL when untitled
+func trackKey(track MusicTrack) string {
+	if track.Title != "" {
+		return track.Title
+	}
+	return track.URL
+}
+
+// loadMusicSelectionState reads the round robin state; a missing file is empty state
+func loadMusicSelectionState(path string) (*musicSelectionState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &musicSelectionState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read music selection state: %w", err)
+	}
+
+	var state musicSelectionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse music selection state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveMusicSelectionState writes the round robin state atomically
+func saveMusicSelectionState(path string, state *musicSelectionState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal music selection state: %w", err)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write music selection state: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to save music selection state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+var selectionTracks = []MusicTrack{
+	{Title: "Sunny", URL: "https://cdn/sunny.mp3"},
+	{Title: "Bounce", URL: "https://cdn/bounce.mp3"},
+	{Title: "Drift", URL: "https://cdn/drift.mp3"},
+}
+
+func TestResolveMusicSelection(t *testing.T) {
+	tests := []struct {
+		selection string
+		expected  string
+		expectErr bool
+	}{
+		{"", MusicSelectionFirst, false},
+		{"first", MusicSelectionFirst, false},
+		{"random", MusicSelectionRandom, false},
+		{"round_robin", MusicSelectionRoundRobin, false},
+		{"shuffle", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveMusicSelection(tt.selection)
+		if (err != nil) != tt.expectErr || got != tt.expected {
+			t.Errorf("ResolveMusicSelection(%q) = %q, %v; want %q (error %v)", tt.selection, got, err, tt.expected, tt.expectErr)
+		}
+	}
+}
+
+// TestSelectMusicTrackRandomSeeded verifies seeded picks are reproducible per pipeline ID
+func TestSelectMusicTrackRandomSeeded(t *testing.T) {
+	config := types.MusicConfig{Selection: MusicSelectionRandom, Seed: 42}
+
+	picks := make(map[string]bool)
+	for _, id := range []string{"clip-1", "clip-2", "clip-3", "clip-4", "clip-5", "clip-6"} {
+		first := selectMusicTrack(selectionTracks, config, id)
+		if again := selectMusicTrack(selectionTracks, config, id); again != first {
+			t.Errorf("%s: picked %s then %s with the same seed", id, first.Title, again.Title)
+		}
+		picks[first.Title] = true
+	}
+	if len(picks) < 2 {
+		t.Errorf("Expected different tracks across pipelines, got only %v", picks)
+	}
+}
+
+// TestSelectMusicTrackRoundRobin verifies recently used tracks are skipped across runs
+func TestSelectMusicTrackRoundRobin(t *testing.T) {
+	config := types.MusicConfig{
+		Selection:    MusicSelectionRoundRobin,
+		StateFile:    filepath.Join(t.TempDir(), "music.json"),
+		RecentTracks: 2,
+	}
+
+	var picks []string
+	for i := 0; i < 5; i++ {
+		picks = append(picks, selectMusicTrack(selectionTracks, config, "clip").Title)
+	}
+
+	// With two tracks remembered, the third is always available
+	expected := []string{"Sunny", "Bounce", "Drift", "Sunny", "Bounce"}
+	if !reflect.DeepEqual(picks, expected) {
+		t.Errorf("Expected picks %v, got %v", expected, picks)
+	}
+
+	state, err := loadMusicSelectionState(config.StateFile)
+	if err != nil {
+		t.Fatalf("loadMusicSelectionState failed: %v", err)
+	}
+	if !reflect.DeepEqual(state.Recent, []string{"Sunny", "Bounce"}) {
+		t.Errorf("Expected recent [Sunny Bounce], got %v", state.Recent)
+	}
+}
+
+// TestSelectMusicTrackRoundRobinAllRecent verifies the least recently used track is
+// picked when every result was used recently
+func TestSelectMusicTrackRoundRobinAllRecent(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "music.json")
+	if err := saveMusicSelectionState(stateFile, &musicSelectionState{Recent: []string{"Bounce", "Sunny", "Drift"}}); err != nil {
+		t.Fatalf("saveMusicSelectionState failed: %v", err)
+	}
+
+	config := types.MusicConfig{Selection: MusicSelectionRoundRobin, StateFile: stateFile}
+	if track := selectMusicTrack(selectionTracks, config, "clip"); track.Title != "Bounce" {
+		t.Errorf("Expected least recently used Bounce, got %s", track.Title)
+	}
+}
+
+func TestSelectMusicTrackFirst(t *testing.T) {
+	for _, selection := range []string{"", MusicSelectionFirst, "bogus"} {
+		track := selectMusicTrack(selectionTracks, types.MusicConfig{Selection: selection}, "clip")
+		if track.Title != "Sunny" {
+			t.Errorf("selection %q: expected Sunny, got %s", selection, track.Title)
+		}
+	}
+}
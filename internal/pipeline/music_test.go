@@ -0,0 +1,228 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestParseMusicTracks verifies track extraction with default and custom field mappings
+func TestParseMusicTracks(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		config    types.MusicConfig
+		expected  []MusicTrack
+		expectErr bool
+	}{
+		{
+			name: "epidemic sound defaults",
+			data: `{"data":{"recordings":{"nodes":[
+				{"recording":{"id":"7","title":"Sunny","audioFile":{"lqmp3Url":"https://cdn/sunny.mp3"}}},
+				{"recording":{"title":"No Audio","audioFile":{}}},
+				{"recording":{"title":"Bounce","audioFile":{"lqmp3Url":"https://cdn/bounce.mp3"}}}
+			]}}}`,
+			expected: []MusicTrack{
+				{ID: "7", Title: "Sunny", URL: "https://cdn/sunny.mp3", Quality: MusicQualityLow},
+				{Title: "Bounce", URL: "https://cdn/bounce.mp3", Quality: MusicQualityLow},
+			},
+		},
+		{
+			name: "high quality with fallback to low",
+			data: `{"data":{"recordings":{"nodes":[
+				{"recording":{"title":"Sunny","audioFile":{"lqmp3Url":"https://cdn/sunny-lq.mp3","mp3Url":"https://cdn/sunny.mp3"}}},
+				{"recording":{"title":"Bounce","audioFile":{"lqmp3Url":"https://cdn/bounce-lq.mp3"}}}
+			]}}}`,
+			config: types.MusicConfig{Quality: MusicQualityHigh},
+			expected: []MusicTrack{
+				{Title: "Sunny", URL: "https://cdn/sunny.mp3", Quality: MusicQualityHigh},
+				{Title: "Bounce", URL: "https://cdn/bounce-lq.mp3", Quality: MusicQualityLow},
+			},
+		},
+		{
+			name: "low quality ignores high-quality url",
+			data: `{"data":{"recordings":{"nodes":[
+				{"recording":{"title":"Sunny","audioFile":{"lqmp3Url":"https://cdn/sunny-lq.mp3","mp3Url":"https://cdn/sunny.mp3"}}}
+			]}}}`,
+			config:   types.MusicConfig{Quality: MusicQualityLow},
+			expected: []MusicTrack{{Title: "Sunny", URL: "https://cdn/sunny-lq.mp3", Quality: MusicQualityLow}},
+		},
+		{
+			name:      "invalid quality",
+			data:      `{"data":{"recordings":{"nodes":[]}}}`,
+			config:    types.MusicConfig{Quality: "ultra"},
+			expectErr: true,
+		},
+		{
+			name: "custom mapping",
+			data: `{"results":[{"name":"Upbeat","preview":{"url":"https://other/upbeat.mp3"}}]}`,
+			config: types.MusicConfig{
+				TracksPath: "results",
+				URLField:   "preview.url",
+				TitleField: "name",
+			},
+			expected: []MusicTrack{{Title: "Upbeat", URL: "https://other/upbeat.mp3", Quality: MusicQualityLow}},
+		},
+		{
+			name:     "missing title is allowed",
+			data:     `{"items":[{"url":"https://other/a.mp3"}]}`,
+			config:   types.MusicConfig{TracksPath: "items", URLField: "url"},
+			expected: []MusicTrack{{URL: "https://other/a.mp3", Quality: MusicQualityLow}},
+		},
+		{
+			name:      "tracks path missing",
+			data:      `{"data":{}}`,
+			expectErr: true,
+		},
+		{
+			name:      "tracks path is not a list",
+			data:      `{"data":{"recordings":{"nodes":"none"}}}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid json",
+			data:      `not json`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracks, err := parseMusicTracks(tt.data, tt.config)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(tracks) != len(tt.expected) {
+				t.Fatalf("Expected %d tracks, got %d: %+v", len(tt.expected), len(tracks), tracks)
+			}
+			for i, want := range tt.expected {
+				if tracks[i] != want {
+					t.Errorf("Track %d: expected %+v, got %+v", i, want, tracks[i])
+				}
+			}
+		})
+	}
+}
+
+// expiringMusicClient rejects searches until its credentials are refreshed
+type expiringMusicClient struct {
+	*fakeToolClient
+	rotated   bool // Whether refreshing finds new credentials
+	refreshed bool
+	searches  int
+}
+
+func (c *expiringMusicClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	c.searches++
+	if !c.refreshed {
+		return nil, errors.New("tools/call request failed: call tool failed: request failed with status 401: Unauthorized")
+	}
+	return &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: `{"data":{"recordings":{"nodes":[]}}}`}}}, nil
+}
+
+func (c *expiringMusicClient) RefreshCredentials(ctx context.Context) (bool, error) {
+	c.refreshed = c.rotated
+	return c.rotated, nil
+}
+
+// TestSearchMusicRefreshesCredentials verifies an unauthorized search is retried once
+// with refreshed credentials, and skipped with a warning when they didn't change
+func TestSearchMusicRefreshesCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotated  bool
+		searches int
+		status   types.StageStatus
+		warned   bool
+	}{
+		{name: "rotated token", rotated: true, searches: 2, status: types.StatusCompleted},
+		{name: "expired token", rotated: false, searches: 1, status: types.StatusSkipped, warned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			music := &expiringMusicClient{fakeToolClient: newFakeToolClient(), rotated: tt.rotated}
+			p := NewPipeline(nil, nil, nil, music, nil, false, 3, "", "lightweight")
+			manifest := NewManifest("test", types.PipelineInput{Duration: 5})
+			manifest.Result = &PipelineResult{}
+
+			if err := ExecuteSearchMusic(context.Background(), p, manifest); err != nil {
+				t.Fatalf("ExecuteSearchMusic failed: %v", err)
+			}
+			if music.searches != tt.searches {
+				t.Errorf("Expected %d searches, got %d", tt.searches, music.searches)
+			}
+			if state := manifest.Stages[types.StageSearchMusic]; state == nil || state.Status != tt.status {
+				t.Errorf("Expected search_music %s, got %+v", tt.status, state)
+			}
+			if warned := len(manifest.Result.Warnings) > 0; warned != tt.warned {
+				t.Errorf("Expected warning %v, got %v", tt.warned, manifest.Result.Warnings)
+			}
+		})
+	}
+}
+
+// TestDownloadMusic verifies downloads land atomically and failed ones leave no file
+func TestDownloadMusic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/complete.mp3":
+			w.Write([]byte("ID3 complete track"))
+		case "/truncated.mp3":
+			// Announce more than is sent, as when the connection drops mid-download
+			w.Header().Set("Content-Length", "1000")
+			w.Write([]byte("ID3 partial"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		expectErr bool
+	}{
+		{name: "complete", path: "/complete.mp3"},
+		{name: "truncated", path: "/truncated.mp3", expectErr: true},
+		{name: "not found", path: "/missing.mp3", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			musicPath := filepath.Join(t.TempDir(), "music.mp3")
+			err := downloadMusic(context.Background(), server.URL+tt.path, musicPath)
+
+			if _, statErr := os.Stat(partialPath(musicPath)); !os.IsNotExist(statErr) {
+				t.Errorf("Expected no partial file left, got %v", statErr)
+			}
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("Expected the download to fail")
+				}
+				if _, statErr := os.Stat(musicPath); !os.IsNotExist(statErr) {
+					t.Errorf("Expected no music file after a failed download, got %v", statErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadMusic failed: %v", err)
+			}
+			if data, _ := os.ReadFile(musicPath); string(data) != "ID3 complete track" {
+				t.Errorf("Expected the full track, got %q", data)
+			}
+		})
+	}
+}
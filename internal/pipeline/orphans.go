@@ -0,0 +1,226 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultOrphanedStageAge is how long a stage may stay running before a resume treats it
+// as orphaned even though its owner can't be shown dead (another host, reused PID)
+const DefaultOrphanedStageAge = time.Hour
+
+// ErrOrphanedStage is the failure recorded for a stage whose process terminated while
+// running it
+var ErrOrphanedStage = errors.New("orphaned: previous process terminated")
+
+// ErrPipelineLocked matches any *RunLockedError via errors.Is
+var ErrPipelineLocked = errors.New("pipeline is locked by another run")
+
+// runLockSuffix is appended to the manifest path to name its run lock
+const runLockSuffix = ".lock"
+
+// unreadableLockAge is how old a lock file that can't be parsed must be before it is
+// released; younger ones may still be being written
+const unreadableLockAge = 10 * time.Second
+
+// hostname names this machine in stage owners and run locks, empty if unknown
+var hostname, _ = os.Hostname()
+
+// RunLockedError reports a manifest another live process is running
+type RunLockedError struct {
+	Path  string
+	Owner RunLockOwner
+}
+
+func (e *RunLockedError) Error() string {
+	return fmt.Sprintf("%s: %s is held by pid %d on %s since %s", ErrPipelineLocked, e.Path,
+		e.Owner.PID, e.Owner.Host, e.Owner.AcquiredAt.Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, ErrPipelineLocked) match
+func (e *RunLockedError) Is(target error) bool {
+	return target == ErrPipelineLocked
+}
+
+// RunLockOwner is the content of a run lock: the process running the manifest
+type RunLockOwner struct {
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// dead reports whether the owner is a process on this host that no longer exists
+func (o RunLockOwner) dead() bool {
+	return o.Host == hostname && !processAlive(o.PID)
+}
+
+// RunLock is a lock file next to a manifest held while a process runs it
+type RunLock struct {
+	path string
+}
+
+// AcquireRunLock locks the manifest at manifestPath for this process. A lock left by a
+// process on this host that no longer exists is released first; one held by a live
+// process, or by one on another host, fails with a *RunLockedError.
+func AcquireRunLock(manifestPath string) (*RunLock, error) {
+	path := RunLockPath(manifestPath)
+	owner := RunLockOwner{PID: os.Getpid(), Host: hostname, AcquiredAt: time.Now()}
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode run lock: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, writeErr := file.Write(data)
+			if closeErr := file.Close(); writeErr == nil {
+				writeErr = closeErr
+			}
+			if writeErr != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write run lock: %w", writeErr)
+			}
+			return &RunLock{path: path}, nil
+		}
+		if !os.IsExist(err) || attempt > 0 {
+			return nil, fmt.Errorf("failed to create run lock: %w", err)
+		}
+
+		if err := releaseStaleRunLock(path); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RunLockPath returns the run lock file of the manifest at manifestPath
+func RunLockPath(manifestPath string) string {
+	return manifestPath + runLockSuffix
+}
+
+// releaseStaleRunLock removes the lock at path when its owner is gone, and returns a
+// *RunLockedError when it is still held
+func releaseStaleRunLock(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Released meanwhile
+		}
+		return fmt.Errorf("failed to read run lock: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read run lock: %w", err)
+	}
+
+	var owner RunLockOwner
+	if err := json.Unmarshal(data, &owner); err != nil || owner.PID <= 0 {
+		if time.Since(info.ModTime()) < unreadableLockAge {
+			return &RunLockedError{Path: path, Owner: RunLockOwner{AcquiredAt: info.ModTime()}}
+		}
+		log.Printf("Released unreadable run lock %s", path)
+	} else if owner.dead() {
+		log.Printf("Released stale run lock %s: pid %d no longer exists", path, owner.PID)
+	} else {
+		return &RunLockedError{Path: path, Owner: owner}
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to release stale run lock: %w", err)
+	}
+	return nil
+}
+
+// Release removes the lock. Safe to call on a nil lock.
+func (l *RunLock) Release() {
+	if l == nil {
+		return
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to release run lock %s: %v", l.path, err)
+	}
+}
+
+// SetOrphanedStageAge sets how long a stage may stay running before a resume treats it
+// as orphaned; 0 uses DefaultOrphanedStageAge
+func (p *Pipeline) SetOrphanedStageAge(age time.Duration) {
+	p.orphanedStageAge = age
+}
+
+// acquireRunLock locks a file-backed manifest for the run; other stores aren't locked
+// and return a nil lock
+func (p *Pipeline) acquireRunLock() (*RunLock, error) {
+	store, ok := p.manifestStore.(*FileManifestStore)
+	if !ok || store.Path == "" {
+		return nil, nil
+	}
+	return AcquireRunLock(store.Path)
+}
+
+// RepairOrphanedStages fails the stages left running by a process that terminated: those
+// whose owner on this host no longer exists, and those started longer than maxAge ago.
+// Returns the repaired stages.
+func (m *Manifest) RepairOrphanedStages(maxAge time.Duration, now time.Time) []types.PipelineStage {
+	var repaired []types.PipelineStage
+	for _, stage := range sortedStages(m.Stages) {
+		state := m.Stages[stage]
+		if state.Status != types.StatusRunning {
+			continue
+		}
+		ownerDead := state.OwnerPID > 0 && state.OwnerHost == hostname && !processAlive(state.OwnerPID)
+		stuck := state.StartedAt == nil || now.Sub(*state.StartedAt) > maxAge
+		if ownerDead || stuck {
+			m.FailStage(stage, ErrOrphanedStage)
+			repaired = append(repaired, stage)
+		}
+	}
+	return repaired
+}
+
+// sortedStages returns the stages of a manifest in name order, for a stable log
+func sortedStages(stages map[types.PipelineStage]*StageState) []types.PipelineStage {
+	names := make([]types.PipelineStage, 0, len(stages))
+	for stage := range stages {
+		names = append(names, stage)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// repairOrphanedStages fails the stages a terminated process left running and saves the
+// manifest, so the resumed run reports and retries them
+func (p *Pipeline) repairOrphanedStages(ctx context.Context, manifest *Manifest) error {
+	maxAge := p.orphanedStageAge
+	if maxAge <= 0 {
+		maxAge = DefaultOrphanedStageAge
+	}
+	repaired := manifest.RepairOrphanedStages(maxAge, time.Now())
+	if len(repaired) == 0 {
+		return nil
+	}
+	for _, stage := range repaired {
+		state := manifest.Stages[stage]
+		log.Printf("Repaired orphaned stage %s: was running under pid %d since %s, marked failed",
+			stage, state.OwnerPID, formatStartedAt(state.StartedAt))
+	}
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		return fmt.Errorf("failed to save repaired manifest: %w", err)
+	}
+	return nil
+}
+
+// formatStartedAt formats a stage start time for the log
+func formatStartedAt(startedAt *time.Time) string {
+	if startedAt == nil {
+		return "an unknown time"
+	}
+	return startedAt.Format(time.RFC3339)
+}
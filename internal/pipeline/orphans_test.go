@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// deadPID returns the PID of a process that has exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run child process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+// writeRunLock writes a run lock for manifestPath owned by pid on this host
+func writeRunLock(t *testing.T, manifestPath string, pid int) {
+	t.Helper()
+	data, err := json.Marshal(RunLockOwner{PID: pid, Host: hostname, AcquiredAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath+runLockSuffix, data, 0644); err != nil {
+		t.Fatalf("Failed to write run lock: %v", err)
+	}
+}
+
+func TestAcquireRunLock(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	// A lock whose owner exited is released and taken over
+	writeRunLock(t, manifestPath, deadPID(t))
+	lock, err := AcquireRunLock(manifestPath)
+	if err != nil {
+		t.Fatalf("Expected the stale lock to be released, got %v", err)
+	}
+
+	// The lock this process holds keeps out a second run
+	if _, err := AcquireRunLock(manifestPath); !errors.Is(err, ErrPipelineLocked) {
+		t.Errorf("Expected ErrPipelineLocked while the lock is held, got %v", err)
+	}
+
+	lock.Release()
+	if _, err := os.Stat(manifestPath + runLockSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected Release to remove the lock file, got %v", err)
+	}
+
+	// A lock held by a live process is kept
+	writeRunLock(t, manifestPath, os.Getpid())
+	var locked *RunLockedError
+	if _, err := AcquireRunLock(manifestPath); !errors.As(err, &locked) || locked.Owner.PID != os.Getpid() {
+		t.Errorf("Expected a RunLockedError naming pid %d, got %v", os.Getpid(), err)
+	}
+}
+
+func TestRepairOrphanedStages(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	old := now.Add(-2 * time.Hour)
+
+	manifest := NewManifest("orphans-test", types.PipelineInput{})
+	manifest.Stages = map[types.PipelineStage]*StageState{
+		types.StageSegmentPerson: { // Its process crashed
+			Status: types.StatusRunning, StartedAt: &recent, OwnerPID: deadPID(t), OwnerHost: hostname,
+		},
+		types.StageLandmarks: { // Written before owners were recorded, and stuck
+			Status: types.StatusRunning, StartedAt: &old,
+		},
+		types.StageCompose: { // Still being run by this process
+			Status: types.StatusRunning, StartedAt: &recent, OwnerPID: os.Getpid(), OwnerHost: hostname,
+		},
+		types.StageSearchMusic: {Status: types.StatusCompleted, StartedAt: &old},
+	}
+
+	repaired := manifest.RepairOrphanedStages(time.Hour, now)
+	expected := []types.PipelineStage{types.StageLandmarks, types.StageSegmentPerson}
+	if !reflect.DeepEqual(repaired, expected) {
+		t.Fatalf("Expected repaired stages %v, got %v", expected, repaired)
+	}
+	for _, stage := range expected {
+		state := manifest.Stages[stage]
+		if state.Status != types.StatusFailed || state.Error != ErrOrphanedStage.Error() {
+			t.Errorf("Expected %s failed as orphaned, got %s: %q", stage, state.Status, state.Error)
+		}
+	}
+	if status := manifest.Stages[types.StageCompose].Status; status != types.StatusRunning {
+		t.Errorf("Expected the live stage to stay running, got %s", status)
+	}
+	if status := manifest.Stages[types.StageSearchMusic].Status; status != types.StatusCompleted {
+		t.Errorf("Expected the completed stage to be kept, got %s", status)
+	}
+}
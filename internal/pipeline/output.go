@@ -0,0 +1,460 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Output defaults; together they reproduce the original H.264 (copied) / AAC MP4 output
+const (
+	DefaultOutputContainer  = "mp4"
+	DefaultOutputVideoCodec = "copy"
+	DefaultOutputAudioCodec = "aac"
+)
+
+// Final output naming modes (pipeline.output.name)
+const (
+	OutputNameFixed       = "fixed"        // final_output.<container>, replaced by every run
+	OutputNameContentHash = "content-hash" // <sha256 prefix>.<container>, new whenever the content changes
+)
+
+// outputNamePlaceholders lists the placeholders of output name templates, e.g.
+// "{id}_{animation}_{mood}.mp4"
+var outputNamePlaceholders = []string{"id", "image", "animation", "mood", "duration", "hash"}
+
+// outputNamePlaceholder matches one placeholder of an output name template
+var outputNamePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// invalidFileNameChars can't appear in output names on every platform we support
+const invalidFileNameChars = `/\:*?"<>|`
+
+// contentHashNameLength is the number of hex digits of the SHA-256 in content-hash names
+const contentHashNameLength = 16
+
+// latestOutputName is the stable name pointing at the newest content-hash output
+const latestOutputName = "latest"
+
+// outputCodec describes a codec accepted in pipeline.output
+type outputCodec struct {
+	encoder   string // ffmpeg encoder name
+	probeName string // codec_name reported by ffprobe
+	crfMax    int    // highest CRF value; 0 means CRF is not supported
+	bitrate   bool   // accepts a target bitrate
+}
+
+var outputVideoCodecs = map[string]outputCodec{
+	"copy":   {encoder: "copy"},
+	"h264":   {encoder: "libx264", probeName: "h264", crfMax: 51, bitrate: true},
+	"h265":   {encoder: "libx265", probeName: "hevc", crfMax: 51, bitrate: true},
+	"vp9":    {encoder: "libvpx-vp9", probeName: "vp9", crfMax: 63, bitrate: true},
+	"prores": {encoder: "prores_ks", probeName: "prores"},
+}
+
+var outputAudioCodecs = map[string]outputCodec{
+	"aac":       {encoder: "aac", probeName: "aac"},
+	"mp3":       {encoder: "libmp3lame", probeName: "mp3"},
+	"opus":      {encoder: "libopus", probeName: "opus"},
+	"pcm_s16le": {encoder: "pcm_s16le", probeName: "pcm_s16le"},
+}
+
+// outputContainers lists the video and audio codecs known to work in each container
+var outputContainers = map[string]struct {
+	video []string
+	audio []string
+}{
+	"mp4":  {video: []string{"copy", "h264", "h265"}, audio: []string{"aac", "mp3"}},
+	"mov":  {video: []string{"copy", "h264", "h265", "prores"}, audio: []string{"aac", "pcm_s16le"}},
+	"mkv":  {video: []string{"copy", "h264", "h265", "vp9", "prores"}, audio: []string{"aac", "mp3", "opus", "pcm_s16le"}},
+	"webm": {video: []string{"vp9"}, audio: []string{"opus"}},
+}
+
+// codecAliases maps alternative spellings to the names used in the matrix
+var codecAliases = map[string]string{
+	"avc":  "h264",
+	"hevc": "h265",
+	"pcm":  "pcm_s16le",
+}
+
+// ResolveOutputConfig fills in defaults and rejects codec/container combinations that
+// ffmpeg cannot write or players cannot read
+func ResolveOutputConfig(config types.OutputConfig) (types.OutputConfig, error) {
+	normalize := func(value, fallback string) string {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if alias, ok := codecAliases[value]; ok {
+			value = alias
+		}
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	config.Container = normalize(config.Container, DefaultOutputContainer)
+	config.VideoCodec = normalize(config.VideoCodec, DefaultOutputVideoCodec)
+	config.AudioCodec = normalize(config.AudioCodec, DefaultOutputAudioCodec)
+
+	container, ok := outputContainers[config.Container]
+	if !ok {
+		return config, fmt.Errorf("unsupported output container %q", config.Container)
+	}
+
+	// Templates keep their case; the named modes are matched case-insensitively
+	if isOutputNameTemplate(config.Name) {
+		name, err := resolveOutputNameTemplate(strings.TrimSpace(config.Name), config.Container)
+		if err != nil {
+			return config, err
+		}
+		config.Name = name
+	} else {
+		config.Name = normalize(config.Name, OutputNameFixed)
+		if config.Name != OutputNameFixed && config.Name != OutputNameContentHash {
+			return config, fmt.Errorf("unsupported output name %q (use %s, %s or a template like \"{id}_{animation}_{mood}\")",
+				config.Name, OutputNameFixed, OutputNameContentHash)
+		}
+	}
+	video, ok := outputVideoCodecs[config.VideoCodec]
+	if !ok {
+		return config, fmt.Errorf("unsupported output video codec %q", config.VideoCodec)
+	}
+	if _, ok := outputAudioCodecs[config.AudioCodec]; !ok {
+		return config, fmt.Errorf("unsupported output audio codec %q", config.AudioCodec)
+	}
+	if !containsString(container.video, config.VideoCodec) {
+		return config, fmt.Errorf("video codec %s is not supported in %s (supported: %s)",
+			config.VideoCodec, config.Container, strings.Join(container.video, ", "))
+	}
+	if !containsString(container.audio, config.AudioCodec) {
+		return config, fmt.Errorf("audio codec %s is not supported in %s (supported: %s)",
+			config.AudioCodec, config.Container, strings.Join(container.audio, ", "))
+	}
+
+	if config.CRF != 0 && config.Bitrate != "" {
+		return config, fmt.Errorf("set either crf or bitrate, not both")
+	}
+	if config.CRF != 0 {
+		if video.crfMax == 0 {
+			return config, fmt.Errorf("crf is not supported for video codec %s", config.VideoCodec)
+		}
+		if config.CRF < 0 || config.CRF > video.crfMax {
+			return config, fmt.Errorf("crf %d out of range for %s (0-%d)", config.CRF, config.VideoCodec, video.crfMax)
+		}
+	}
+	if config.Bitrate != "" && !video.bitrate {
+		return config, fmt.Errorf("bitrate is not supported for video codec %s", config.VideoCodec)
+	}
+	return config, nil
+}
+
+// isDefaultOutput reports whether config produces the original output unchanged
+func isDefaultOutput(config types.OutputConfig) bool {
+	return config.Container == DefaultOutputContainer &&
+		config.VideoCodec == DefaultOutputVideoCodec &&
+		config.AudioCodec == DefaultOutputAudioCodec &&
+		config.CRF == 0 && config.Bitrate == ""
+}
+
+// outputFileName returns the final output file name for config
+func outputFileName(config types.OutputConfig) string {
+	return "final_output." + config.Container
+}
+
+// contentHashFileName returns the content-hash output name for a file with hash
+func contentHashFileName(hash string, config types.OutputConfig) string {
+	return hash[:contentHashNameLength] + "." + config.Container
+}
+
+// isOutputNameTemplate reports whether an output name is a template rather than a mode
+func isOutputNameTemplate(name string) bool {
+	return strings.ContainsAny(name, "{}")
+}
+
+// templateUsesHash reports whether an output name template needs the content hash
+func templateUsesHash(template string) bool {
+	return strings.Contains(template, "{hash}")
+}
+
+// resolveOutputNameTemplate validates an output name template and returns it ending in
+// the container's extension. Placeholders must be known and the literal text must not
+// contain path separators or characters file systems reject.
+func resolveOutputNameTemplate(template, container string) (string, error) {
+	for _, match := range outputNamePlaceholder.FindAllStringSubmatch(template, -1) {
+		if !containsString(outputNamePlaceholders, match[1]) {
+			return "", fmt.Errorf("unknown placeholder {%s} in output name %q (use {%s})",
+				match[1], template, strings.Join(outputNamePlaceholders, "}, {"))
+		}
+	}
+
+	literal := outputNamePlaceholder.ReplaceAllString(template, "")
+	if strings.ContainsAny(literal, "{}") {
+		return "", fmt.Errorf("unbalanced braces in output name %q", template)
+	}
+	if strings.ContainsAny(literal, invalidFileNameChars) || strings.IndexFunc(literal, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("output name %q must not contain path separators or any of %s", template, invalidFileNameChars)
+	}
+	if strings.HasPrefix(template, ".") {
+		return "", fmt.Errorf("output name %q must not start with a dot", template)
+	}
+
+	// An extension naming another container would mislabel the file
+	ext := strings.TrimPrefix(filepath.Ext(template), ".")
+	if ext == container {
+		return template, nil
+	}
+	if _, ok := outputContainers[strings.ToLower(ext)]; ok {
+		return "", fmt.Errorf("output name %q ends in .%s but the output container is %s", template, ext, container)
+	}
+	return template + "." + container, nil
+}
+
+// renderOutputName fills in an output name template. Values are made safe for file
+// names, so a placeholder can't add a directory to the path.
+func renderOutputName(template string, values map[string]string) string {
+	return outputNamePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value := strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(invalidFileNameChars, r) {
+				return '_'
+			}
+			return r
+		}, values[strings.Trim(placeholder, "{}")])
+		if value == "" || strings.Trim(value, ".") == "" {
+			return "none"
+		}
+		return value
+	})
+}
+
+// outputNameValues returns the placeholder values of a run's final output name.
+// musicQuality is empty when the output has no music.
+func outputNameValues(manifest *Manifest, musicQuality, contentHash string) map[string]string {
+	image := filepath.Base(manifest.Input.ImagePath)
+	values := map[string]string{
+		"id":        manifest.PipelineID,
+		"image":     strings.TrimSuffix(image, filepath.Ext(image)),
+		"animation": "static",
+		"duration":  strconv.FormatFloat(manifest.Input.Duration, 'f', -1, 64),
+	}
+	if contentHash != "" {
+		values["hash"] = contentHash[:contentHashNameLength]
+	}
+
+	var decision *llm.PipelineDecision
+	if manifest.LLMAnalysis != nil {
+		decision = manifest.LLMAnalysis.Decision
+	}
+	if decision == nil {
+		decision = llm.GetDefaultDecision()
+	}
+
+	// The animation names the motion segments rendered, in order, e.g. "nod-zoom"
+	if manifest.Result != nil && manifest.Result.MotionVideoPath != "" {
+		plan := manifest.Input.AnimationPlan
+		if len(plan) == 0 {
+			plan = decision.AnimationPlan
+		}
+		animations := []string{AnimationRotate}
+		if len(plan) > 0 {
+			animations = animations[:0]
+			for _, segment := range plan {
+				if n := len(animations); n == 0 || animations[n-1] != segment.Type {
+					animations = append(animations, segment.Type)
+				}
+			}
+		}
+		values["animation"] = strings.Join(animations, "-")
+	}
+
+	switch musicQuality {
+	case "":
+		values["mood"] = "silent"
+	case MusicQualityUser:
+		values["mood"] = "custom"
+	default:
+		values["mood"] = decision.MusicMood
+	}
+	return values
+}
+
+// linkLatestOutput points latest.<container> next to outputPath at it, with a relative
+// symlink or, where symlinks aren't available, a copy. The link is swapped into place,
+// so readers never find it missing. Returns its path.
+func linkLatestOutput(outputPath string, config types.OutputConfig) (string, error) {
+	latestPath := filepath.Join(filepath.Dir(outputPath), latestOutputName+"."+config.Container)
+	partial := partialPath(latestPath)
+	os.Remove(partial)
+
+	if err := os.Symlink(filepath.Base(outputPath), partial); err != nil {
+		if err := copyFile(outputPath, partial); err != nil {
+			os.Remove(partial)
+			return "", fmt.Errorf("failed to write %s: %w", filepath.Base(latestPath), err)
+		}
+	}
+	if err := os.Rename(partial, latestPath); err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("failed to write %s: %w", filepath.Base(latestPath), err)
+	}
+	return latestPath, nil
+}
+
+// videoCodecArgs returns the ffmpeg video encoding arguments for config
+func videoCodecArgs(config types.OutputConfig) []string {
+	args := []string{"-c:v", outputVideoCodecs[config.VideoCodec].encoder}
+	if config.CRF != 0 {
+		args = append(args, "-crf", strconv.Itoa(config.CRF))
+	}
+	if config.Bitrate != "" {
+		args = append(args, "-b:v", config.Bitrate)
+	}
+	// Apple players only recognize HEVC in MP4/MOV with the hvc1 tag
+	if config.VideoCodec == "h265" && (config.Container == "mp4" || config.Container == "mov") {
+		args = append(args, "-tag:v", "hvc1")
+	}
+	return args
+}
+
+// composeArgs returns the ffmpeg arguments that mux musicPath into videoSource
+func composeArgs(videoSource, musicPath, outputPath string, config types.OutputConfig) []string {
+	args := []string{"-y",
+		"-i", videoSource,
+		"-i", musicPath,
+	}
+	args = append(args, videoCodecArgs(config)...)
+	args = append(args,
+		"-c:a", outputAudioCodecs[config.AudioCodec].encoder,
+		"-shortest",
+		"-map", "0:v:0",
+		"-map", "1:a:0",
+		outputPath)
+	return args
+}
+
+// videoOnlyArgs returns the ffmpeg arguments that write videoSource without audio
+func videoOnlyArgs(videoSource, outputPath string, config types.OutputConfig) []string {
+	args := []string{"-y", "-i", videoSource}
+	args = append(args, videoCodecArgs(config)...)
+	args = append(args, "-an", outputPath)
+	return args
+}
+
+// transcodeArgs returns the ffmpeg arguments that convert a finished video, keeping
+// its audio track if it has one
+func transcodeArgs(videoPath, outputPath string, config types.OutputConfig) []string {
+	args := []string{"-y",
+		"-i", videoPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+	}
+	args = append(args, videoCodecArgs(config)...)
+	args = append(args, "-c:a", outputAudioCodecs[config.AudioCodec].encoder, outputPath)
+	return args
+}
+
+// convertOutput converts a video produced outside the compose stage (full AI mode) to
+// the configured format in outputDir and verifies it. Returns the converted path.
+func convertOutput(ctx context.Context, videoPath, outputDir string, config types.OutputConfig) (string, error) {
+	outputPath := filepath.Join(outputDir, outputFileName(config))
+	if outputPath == videoPath {
+		outputPath = filepath.Join(outputDir, "converted_"+outputFileName(config))
+	}
+
+	cmd := procgroup.CommandContext(ctx, "ffmpeg", transcodeArgs(videoPath, outputPath, config)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("ffmpeg output conversion failed: %w, output: %s", err, output)
+	}
+	if err := verifyOutputCodecs(ctx, outputPath, config, false); err != nil {
+		return "", fmt.Errorf("output verification failed: %w", err)
+	}
+	return outputPath, nil
+}
+
+// writeVideoOnly writes videoSource to outputPath without audio. The default output
+// is a plain copy, as it always was; other formats go through ffmpeg.
+func writeVideoOnly(ctx context.Context, videoSource, outputPath string, config types.OutputConfig) error {
+	if isDefaultOutput(config) {
+		if err := copyFile(videoSource, outputPath); err != nil {
+			return fmt.Errorf("failed to copy output: %w", err)
+		}
+		return nil
+	}
+
+	cmd := procgroup.CommandContext(ctx, "ffmpeg", videoOnlyArgs(videoSource, outputPath, config)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg output conversion failed: %w, output: %s", err, output)
+	}
+	return nil
+}
+
+// verifyOutputCodecs runs ffprobe on path and checks the requested codecs landed.
+// An audio stream, when present, must use the requested audio codec.
+func verifyOutputCodecs(ctx context.Context, path string, config types.OutputConfig, expectAudio bool) error {
+	cmd := procgroup.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "stream=codec_type,codec_name",
+		"-of", "json",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return checkProbedCodecs(output, config, expectAudio)
+}
+
+// checkProbedCodecs compares ffprobe JSON stream output with the requested codecs
+func checkProbedCodecs(probeJSON []byte, config types.OutputConfig, expectAudio bool) error {
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(probeJSON, &probe); err != nil {
+		return fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	found := make(map[string]string)
+	for _, stream := range probe.Streams {
+		if _, ok := found[stream.CodecType]; !ok {
+			found[stream.CodecType] = stream.CodecName
+		}
+	}
+
+	video, ok := found["video"]
+	if !ok {
+		return fmt.Errorf("output has no video stream")
+	}
+	if want := outputVideoCodecs[config.VideoCodec].probeName; want != "" && video != want {
+		return fmt.Errorf("output video codec is %s, expected %s", video, want)
+	}
+
+	audio, ok := found["audio"]
+	if !ok {
+		if expectAudio {
+			return fmt.Errorf("output has no audio stream")
+		}
+		return nil
+	}
+	if want := outputAudioCodecs[config.AudioCodec].probeName; audio != want {
+		return fmt.Errorf("output audio codec is %s, expected %s", audio, want)
+	}
+	return nil
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveOutputConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    types.OutputConfig
+		expected  types.OutputConfig
+		expectErr bool
+	}{
+		{
+			name:     "defaults",
+			config:   types.OutputConfig{},
+			expected: types.OutputConfig{Container: "mp4", VideoCodec: "copy", AudioCodec: "aac", Name: "fixed"},
+		},
+		{
+			name:     "h265 alias with crf",
+			config:   types.OutputConfig{VideoCodec: "HEVC", CRF: 28},
+			expected: types.OutputConfig{Container: "mp4", VideoCodec: "h265", AudioCodec: "aac", CRF: 28, Name: "fixed"},
+		},
+		{
+			name:     "prores in mov",
+			config:   types.OutputConfig{Container: "mov", VideoCodec: "prores", AudioCodec: "pcm"},
+			expected: types.OutputConfig{Container: "mov", VideoCodec: "prores", AudioCodec: "pcm_s16le", Name: "fixed"},
+		},
+		{
+			name:     "vp9 in webm with bitrate",
+			config:   types.OutputConfig{Container: "webm", VideoCodec: "vp9", AudioCodec: "opus", Bitrate: "2M"},
+			expected: types.OutputConfig{Container: "webm", VideoCodec: "vp9", AudioCodec: "opus", Bitrate: "2M", Name: "fixed"},
+		},
+		{
+			name:     "content-hash name",
+			config:   types.OutputConfig{Name: " Content-Hash "},
+			expected: types.OutputConfig{Container: "mp4", VideoCodec: "copy", AudioCodec: "aac", Name: "content-hash"},
+		},
+		{
+			name:     "template gets the container extension",
+			config:   types.OutputConfig{Container: "mkv", VideoCodec: "vp9", AudioCodec: "opus", Name: " {id}_{animation} "},
+			expected: types.OutputConfig{Container: "mkv", VideoCodec: "vp9", AudioCodec: "opus", Name: "{id}_{animation}.mkv"},
+		},
+		{
+			name:     "template keeps its case and extension",
+			config:   types.OutputConfig{Name: "Clip_{id}_{mood}.mp4"},
+			expected: types.OutputConfig{Container: "mp4", VideoCodec: "copy", AudioCodec: "aac", Name: "Clip_{id}_{mood}.mp4"},
+		},
+		{name: "template with unknown placeholder", config: types.OutputConfig{Name: "{id}_{date}.mp4"}, expectErr: true},
+		{name: "template with unbalanced brace", config: types.OutputConfig{Name: "{id.mp4"}, expectErr: true},
+		{name: "template with path separator", config: types.OutputConfig{Name: "runs/{id}.mp4"}, expectErr: true},
+		{name: "template with invalid char", config: types.OutputConfig{Name: "{id}:{mood}.mp4"}, expectErr: true},
+		{name: "template with another container's extension", config: types.OutputConfig{Name: "{id}.mov"}, expectErr: true},
+		{name: "prores in mp4 with opus", config: types.OutputConfig{VideoCodec: "prores", AudioCodec: "opus"}, expectErr: true},
+		{name: "opus in mp4", config: types.OutputConfig{AudioCodec: "opus"}, expectErr: true},
+		{name: "h264 in webm", config: types.OutputConfig{Container: "webm", VideoCodec: "h264", AudioCodec: "opus"}, expectErr: true},
+		{name: "unknown container", config: types.OutputConfig{Container: "avi"}, expectErr: true},
+		{name: "unknown codec", config: types.OutputConfig{VideoCodec: "av1"}, expectErr: true},
+		{name: "crf and bitrate", config: types.OutputConfig{VideoCodec: "h264", CRF: 23, Bitrate: "4M"}, expectErr: true},
+		{name: "crf with copy", config: types.OutputConfig{CRF: 23}, expectErr: true},
+		{name: "crf out of range", config: types.OutputConfig{VideoCodec: "h264", CRF: 60}, expectErr: true},
+		{name: "unknown name", config: types.OutputConfig{Name: "timestamp"}, expectErr: true},
+		{name: "bitrate with prores", config: types.OutputConfig{Container: "mov", VideoCodec: "prores", Bitrate: "50M"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveOutputConfig(tt.config)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveOutputConfig failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestComposeArgsDefault verifies the default config produces exactly the original command
+func TestComposeArgsDefault(t *testing.T) {
+	config, err := ResolveOutputConfig(types.OutputConfig{})
+	if err != nil {
+		t.Fatalf("ResolveOutputConfig failed: %v", err)
+	}
+	if !isDefaultOutput(config) {
+		t.Error("Expected zero config to be the default output")
+	}
+	if name := outputFileName(config); name != "final_output.mp4" {
+		t.Errorf("Expected final_output.mp4, got %s", name)
+	}
+
+	got := composeArgs("/tmp/anim.mp4", "/tmp/music.mp3", "/out/final_output.mp4", config)
+	expected := []string{"-y",
+		"-i", "/tmp/anim.mp4",
+		"-i", "/tmp/music.mp3",
+		"-c:v", "copy",
+		"-c:a", "aac",
+		"-shortest",
+		"-map", "0:v:0",
+		"-map", "1:a:0",
+		"/out/final_output.mp4",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("composeArgs() = %v, expected %v", got, expected)
+	}
+}
+
+func TestVideoCodecArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   types.OutputConfig
+		expected []string
+	}{
+		{
+			name:     "h265 in mp4",
+			config:   types.OutputConfig{Container: "mp4", VideoCodec: "h265", AudioCodec: "aac", CRF: 28},
+			expected: []string{"-c:v", "libx265", "-crf", "28", "-tag:v", "hvc1"},
+		},
+		{
+			name:     "h265 in mkv",
+			config:   types.OutputConfig{Container: "mkv", VideoCodec: "h265", AudioCodec: "aac", Bitrate: "3M"},
+			expected: []string{"-c:v", "libx265", "-b:v", "3M"},
+		},
+		{
+			name:     "prores",
+			config:   types.OutputConfig{Container: "mov", VideoCodec: "prores", AudioCodec: "pcm_s16le"},
+			expected: []string{"-c:v", "prores_ks"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := videoCodecArgs(tt.config); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("videoCodecArgs() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckProbedCodecs(t *testing.T) {
+	h265 := types.OutputConfig{Container: "mp4", VideoCodec: "h265", AudioCodec: "aac"}
+
+	tests := []struct {
+		name        string
+		probe       string
+		config      types.OutputConfig
+		expectAudio bool
+		expectErr   bool
+	}{
+		{
+			name:        "codecs match",
+			probe:       `{"streams": [{"codec_type": "video", "codec_name": "hevc"}, {"codec_type": "audio", "codec_name": "aac"}]}`,
+			config:      h265,
+			expectAudio: true,
+		},
+		{
+			name:      "wrong video codec",
+			probe:     `{"streams": [{"codec_type": "video", "codec_name": "h264"}]}`,
+			config:    h265,
+			expectErr: true,
+		},
+		{
+			name:      "wrong audio codec",
+			probe:     `{"streams": [{"codec_type": "video", "codec_name": "hevc"}, {"codec_type": "audio", "codec_name": "mp3"}]}`,
+			config:    h265,
+			expectErr: true,
+		},
+		{
+			name:        "missing audio",
+			probe:       `{"streams": [{"codec_type": "video", "codec_name": "hevc"}]}`,
+			config:      h265,
+			expectAudio: true,
+			expectErr:   true,
+		},
+		{
+			name:   "copied video accepts any codec",
+			probe:  `{"streams": [{"codec_type": "video", "codec_name": "h264"}]}`,
+			config: types.OutputConfig{Container: "mkv", VideoCodec: "copy", AudioCodec: "opus"},
+		},
+		{
+			name:      "no video",
+			probe:     `{"streams": []}`,
+			config:    h265,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProbedCodecs([]byte(tt.probe), tt.config, tt.expectAudio)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error=%v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+// TestLinkLatestOutput verifies latest.<container> follows the newest content-hash
+// output and the names only change with the content
+func TestLinkLatestOutput(t *testing.T) {
+	dir := t.TempDir()
+	config := types.OutputConfig{Container: "mp4", Name: OutputNameContentHash}
+
+	for i, content := range []string{"first render", "second render"} {
+		partial := filepath.Join(dir, "final_output.partial.mp4")
+		if err := os.WriteFile(partial, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write output: %v", err)
+		}
+		hash, err := HashFile(partial)
+		if err != nil {
+			t.Fatalf("HashFile failed: %v", err)
+		}
+		outputPath := filepath.Join(dir, contentHashFileName(hash, config))
+		if err := commitArtifact(partial, outputPath); err != nil {
+			t.Fatalf("commitArtifact failed: %v", err)
+		}
+
+		latest, err := linkLatestOutput(outputPath, config)
+		if err != nil {
+			t.Fatalf("linkLatestOutput failed: %v", err)
+		}
+		if latest != filepath.Join(dir, "latest.mp4") {
+			t.Errorf("Unexpected latest path %s", latest)
+		}
+		data, err := os.ReadFile(latest)
+		if err != nil || string(data) != content {
+			t.Errorf("Render %d: expected latest to hold %q, got %q (%v)", i, content, data, err)
+		}
+		if name := filepath.Base(outputPath); len(name) != contentHashNameLength+len(".mp4") || name[:contentHashNameLength] != hash[:contentHashNameLength] {
+			t.Errorf("Unexpected content-hash name %s for %s", name, hash)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("Expected both renders and latest.mp4, got %d files", len(entries))
+	}
+}
+
+// TestRenderOutputName verifies templates are filled from the run's parameters, with
+// values made safe for file names
+func TestRenderOutputName(t *testing.T) {
+	manifest := NewManifest("run-7", types.PipelineInput{
+		ImagePath:     "/photos/Beach Day.jpg",
+		Duration:      7.5,
+		AnimationPlan: []types.AnimationSegment{{Type: "nod", Duration: 3}, {Type: "nod", Duration: 2}, {Type: "zoom", Duration: 2.5}},
+	})
+	manifest.Result = &PipelineResult{MotionVideoPath: "/tmp/motion.mp4"}
+	manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: &llm.PipelineDecision{MusicMood: "calm/dreamy"}}
+
+	tests := []struct {
+		name         string
+		musicQuality string
+		expected     string
+	}{
+		{"searched music", "low", "run-7_Beach_Day_nod-zoom_calm_dreamy_7.5s_0123456789abcdef.mp4"},
+		{"user audio", MusicQualityUser, "run-7_Beach_Day_nod-zoom_custom_7.5s_0123456789abcdef.mp4"},
+		{"no music", "", "run-7_Beach_Day_nod-zoom_silent_7.5s_0123456789abcdef.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := outputNameValues(manifest, tt.musicQuality, "0123456789abcdef0123")
+			if name := renderOutputName("{id}_{image}_{animation}_{mood}_{duration}s_{hash}.mp4", values); name != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, name)
+			}
+		})
+	}
+
+	// Without a motion video or a decision the defaults name the run
+	still := NewManifest("run-8", types.PipelineInput{ImagePath: "photo.png"})
+	if name := renderOutputName("{animation}_{mood}_{hash}.mp4", outputNameValues(still, "low", "")); name != "static_happy_none.mp4" {
+		t.Errorf("Expected static_happy_none.mp4, got %s", name)
+	}
+}
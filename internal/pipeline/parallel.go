@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// RecoveryUseOriginal is the segment_person error recovery that renders the original
+// image when segmentation fails. Parallel analysis relies on it.
+const RecoveryUseOriginal = "use_original"
+
+// SetParallelAnalysis runs segment_person and estimate_landmarks concurrently on the
+// original image when they are planned back to back and the decision lets render_motion
+// fall back to the original. Landmarks then never wait on, or use, the segmentation.
+func (p *Pipeline) SetParallelAnalysis(enabled bool) {
+	p.parallelAnalysis = enabled
+}
+
+// parallelAnalysisGroup returns segment_person and estimate_landmarks when stages starts
+// with the two of them (in either order) and they may run concurrently, nil otherwise
+func (p *Pipeline) parallelAnalysisGroup(stages []types.PipelineStage, decision *llm.PipelineDecision) []types.PipelineStage {
+	if !p.parallelAnalysis || len(stages) < 2 || !fallsBackToOriginal(decision) {
+		return nil
+	}
+	pair := map[types.PipelineStage]bool{types.StageSegmentPerson: true, types.StageLandmarks: true}
+	if !pair[stages[0]] || !pair[stages[1]] || stages[0] == stages[1] {
+		return nil
+	}
+	return stages[:2]
+}
+
+// fallsBackToOriginal reports whether a failed segmentation leaves the run to carry on
+// with the original image
+func fallsBackToOriginal(decision *llm.PipelineDecision) bool {
+	if decision == nil {
+		return false
+	}
+	recovery := decision.ErrorRecovery[string(types.StageSegmentPerson)]
+	return recovery == RecoveryUseOriginal || recovery == RecoverySkip
+}
+
+// describePlan formats the planned stages for the log, marking the stages that run
+// concurrently, e.g. "[segment_person | estimate_landmarks] -> render_motion -> compose"
+func (p *Pipeline) describePlan(stages []types.PipelineStage, decision *llm.PipelineDecision) string {
+	var steps []string
+	for i := 0; i < len(stages); i++ {
+		if group := p.parallelAnalysisGroup(stages[i:], decision); group != nil {
+			steps = append(steps, fmt.Sprintf("[%s | %s]", group[0], group[1]))
+			i++
+			continue
+		}
+		steps = append(steps, string(stages[i]))
+	}
+	return strings.Join(steps, " -> ")
+}
+
+// executeParallelAnalysis runs the stages of a parallel analysis group concurrently.
+// Each runs on its own copy of the manifest, merged back into manifest under a lock
+// whenever it checkpoints and when it ends, so the stages never share state. Failures
+// are then handled in stage order as in a sequential run, except that a failed
+// segmentation is skipped: render_motion uses the original image instead.
+func (p *Pipeline) executeParallelAnalysis(ctx context.Context, group []types.PipelineStage, manifest *Manifest, decision *llm.PipelineDecision) error {
+	var pending []types.PipelineStage
+	for _, stage := range group {
+		if manifest.IsStageCompleted(stage) {
+			log.Printf("Stage %s already completed, skipping", stage)
+			continue
+		}
+		if !manifest.CanRetryStage(stage, p.maxRetries) {
+			return fmt.Errorf("stage %s exceeded max retries (%d)", stage, p.maxRetries)
+		}
+		pending = append(pending, stage)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Prepare the downscaled working copy once, rather than both stages racing to write it
+	if manifest.Result == nil {
+		manifest.Result = &PipelineResult{}
+	}
+	if _, err := prepareProcessImage(ctx, p, manifest); err != nil {
+		return err
+	}
+	if len(pending) > 1 {
+		log.Printf("Running %s and %s in parallel on the original image", pending[0], pending[1])
+	}
+
+	var mu sync.Mutex
+	errs := make([]error, len(pending))
+	var wg sync.WaitGroup
+	for i, stage := range pending {
+		own, err := manifest.clone()
+		if err != nil {
+			return err
+		}
+		// Landmarks are estimated on the original, never on a segmentation left by an
+		// earlier attempt
+		if stage == types.StageLandmarks {
+			own.Result.SegmentedImagePath = ""
+		}
+
+		merge := func() {
+			mu.Lock()
+			defer mu.Unlock()
+			mergeStage(manifest, own, stage)
+		}
+		wg.Add(1)
+		go func(i int, stage types.PipelineStage) {
+			defer wg.Done()
+			errs[i] = p.executeStage(ctx, stage, own, func() error {
+				merge()
+				mu.Lock()
+				defer mu.Unlock()
+				return p.saveManifest(ctx, manifest)
+			})
+			merge()
+		}(i, stage)
+	}
+	wg.Wait()
+
+	for i, stage := range pending {
+		if errs[i] != nil {
+			skippable := skipsOnFailure(decision, stage) || stage == types.StageSegmentPerson
+			if err := p.handleStageFailure(ctx, stage, manifest, errs[i], skippable); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("Stage %s completed successfully", stage)
+	}
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// clone returns a deep copy of the manifest
+func (m *Manifest) clone() (*Manifest, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy manifest: %w", err)
+	}
+	var copied Manifest
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("failed to copy manifest: %w", err)
+	}
+	if copied.Stages == nil {
+		copied.Stages = make(map[types.PipelineStage]*StageState)
+	}
+	if copied.Result == nil {
+		copied.Result = &PipelineResult{}
+	}
+	return &copied, nil
+}
+
+// mergeStage copies what stage recorded in from, its own copy of the manifest, into
+// manifest: its state and the result fields it writes. Only the stages that run in
+// parallel are merged.
+func mergeStage(manifest, from *Manifest, stage types.PipelineStage) {
+	if state := from.Stages[stage]; state != nil {
+		copied := *state
+		manifest.Stages[stage] = &copied
+	}
+	if from.Result == nil {
+		return
+	}
+	if manifest.Result == nil {
+		manifest.Result = &PipelineResult{}
+	}
+	result, source := manifest.Result, from.Result
+
+	switch stage {
+	case types.StageSegmentPerson:
+		result.SegmentedImagePath = source.SegmentedImagePath
+		result.Subjects = source.Subjects
+		result.StaticSubjectsPath = source.StaticSubjectsPath
+		result.SubjectArea = source.SubjectArea
+		result.SubjectBounds = source.SubjectBounds
+		result.SetProvenance(ArtifactSegmentedImage, source.Provenance[ArtifactSegmentedImage])
+		if bytes, ok := source.ArtifactBytes[stage]; ok {
+			result.SetArtifactBytes(stage, bytes)
+		}
+		// A cache hit restores the working copy's scale
+		if manifest.ProcessImage == nil && from.ProcessImage != nil {
+			pi := *from.ProcessImage
+			manifest.ProcessImage = &pi
+		}
+	case types.StageLandmarks:
+		result.LandmarksData = source.LandmarksData
+		result.LandmarksScale = source.LandmarksScale
+		result.SetProvenance(ArtifactLandmarks, source.Provenance[ArtifactLandmarks])
+	}
+
+	// Warnings are only ever appended; keep the ones the stage added
+	for _, warning := range source.Warnings {
+		if !containsString(result.Warnings, warning) {
+			result.Warnings = append(result.Warnings, warning)
+		}
+	}
+}
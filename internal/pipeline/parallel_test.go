@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestDescribePlan verifies the planned stages mark segment_person and
+// estimate_landmarks as concurrent only when parallel analysis applies
+func TestDescribePlan(t *testing.T) {
+	stages := []types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageRenderMotion, types.StageCompose}
+	failing := llm.GetDefaultDecision()
+	failing.ErrorRecovery = map[string]string{string(types.StageSegmentPerson): "fail"}
+
+	tests := []struct {
+		name     string
+		parallel bool
+		decision *llm.PipelineDecision
+		expected string
+	}{
+		{"sequential", false, llm.GetDefaultDecision(), "segment_person -> estimate_landmarks -> render_motion -> compose"},
+		{"parallel", true, llm.GetDefaultDecision(), "[segment_person | estimate_landmarks] -> render_motion -> compose"},
+		{"segmentation can't fall back", true, failing, "segment_person -> estimate_landmarks -> render_motion -> compose"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+			p.SetParallelAnalysis(tt.parallel)
+			if plan := p.describePlan(stages, tt.decision); plan != tt.expected {
+				t.Errorf("Expected plan %q, got %q", tt.expected, plan)
+			}
+		})
+	}
+}
+
+// TestParallelAnalysis verifies segment_person and estimate_landmarks run concurrently
+// on the original image, and a failed segmentation leaves the run to use the original
+func TestParallelAnalysis(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		segmentErr      error
+		expectSegmented string
+	}{
+		{"both succeed", nil, "/tmp/segmented.png"},
+		{"segmentation fails", errors.New("detect crashed"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each step waits for the other to start, so a sequential run times out
+			segmentStarted, landmarksStarted := make(chan struct{}), make(chan struct{})
+			wait := func(started chan struct{}) error {
+				select {
+				case <-started:
+					return nil
+				case <-time.After(5 * time.Second):
+					return errors.New("stages did not run concurrently")
+				}
+			}
+
+			var landmarksInput, renderInput string
+			registry := NewStepRegistry()
+			registry.Register(types.StageSegmentPerson, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+				close(segmentStarted)
+				if err := wait(landmarksStarted); err != nil {
+					return err
+				}
+				if tt.segmentErr != nil {
+					return tt.segmentErr
+				}
+				manifest.Result.SegmentedImagePath = "/tmp/segmented.png"
+				return manifest.CompleteStage(types.StageSegmentPerson, map[string]string{})
+			})
+			registry.Register(types.StageLandmarks, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+				close(landmarksStarted)
+				if err := wait(segmentStarted); err != nil {
+					return err
+				}
+				landmarksInput = manifest.Result.SegmentedImagePath
+				manifest.Result.LandmarksData = `{"results":[]}`
+				return manifest.CompleteStage(types.StageLandmarks, map[string]string{})
+			})
+			registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+				renderInput = manifest.Result.SegmentedImagePath
+				return manifest.CompleteStage(types.StageCompose, map[string]string{})
+			})
+
+			store := NewMemoryManifestStore()
+			p := NewPipeline(nil, nil, nil, nil, nil, false, 1, "", "lightweight")
+			p.SetManifestStore(store)
+			p.SetStepRegistry(registry)
+			p.SetEventLog(false)
+			p.SetParallelAnalysis(true)
+			p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageCompose})
+
+			input := types.PipelineInput{ImagePath: imagePath, Duration: 5, TempDir: t.TempDir()}
+			result, err := p.Execute(context.Background(), input, "parallel-test")
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if landmarksInput != "" {
+				t.Errorf("Expected landmarks on the original image, got %q", landmarksInput)
+			}
+			if renderInput != tt.expectSegmented || result.SegmentedImagePath != tt.expectSegmented {
+				t.Errorf("Expected segmented image %q, got %q", tt.expectSegmented, renderInput)
+			}
+			if result.LandmarksData == "" {
+				t.Error("Expected the landmarks to be merged into the result")
+			}
+
+			manifest, err := store.Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			expectStatus := types.StatusCompleted
+			if tt.segmentErr != nil {
+				expectStatus = types.StatusSkipped
+			}
+			if state := manifest.Stages[types.StageSegmentPerson]; state.Status != expectStatus {
+				t.Errorf("Expected segment_person %s, got %+v", expectStatus, state)
+			}
+			if !manifest.IsStageCompleted(types.StageLandmarks) {
+				t.Error("Expected estimate_landmarks completed")
+			}
+		})
+	}
+}
+
+// TestParallelAnalysisKeepsSubjectBounds verifies the subject bounds segment_person
+// records in its own copy of the manifest reach placement over a background
+func TestParallelAnalysisKeepsSubjectBounds(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "photo.png")
+	background := filepath.Join(dir, "beach.png")
+	writePNG(t, imagePath, 400, 300)
+	writePNG(t, background, 160, 90)
+
+	bounds := &SubjectBounds{X: 50, Y: 50, Width: 100, Height: 200}
+	var renderBounds *SubjectBounds
+	registry := NewStepRegistry()
+	registry.Register(types.StageSegmentPerson, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		manifest.Result.SegmentedImagePath = imagePath
+		manifest.Result.SubjectBounds = bounds
+		return manifest.CompleteStage(types.StageSegmentPerson, map[string]string{})
+	})
+	registry.Register(types.StageLandmarks, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		manifest.Result.LandmarksData = `{"results":[]}`
+		return manifest.CompleteStage(types.StageLandmarks, map[string]string{})
+	})
+	registry.Register(types.StageRenderMotion, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		renderBounds = manifest.Result.SubjectBounds
+		return manifest.CompleteStage(types.StageRenderMotion, map[string]string{})
+	})
+
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 1, "", "lightweight")
+	p.SetManifestStore(NewMemoryManifestStore())
+	p.SetStepRegistry(registry)
+	p.SetEventLog(false)
+	p.SetParallelAnalysis(true)
+	p.SetPlacementConfig(types.PlacementConfig{Background: background, SubjectFit: SubjectFitFit, SubjectScale: 1})
+	p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageRenderMotion})
+
+	input := types.PipelineInput{ImagePath: imagePath, Duration: 5, TempDir: t.TempDir()}
+	result, err := p.Execute(context.Background(), input, "parallel-bounds-test")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if renderBounds == nil || *renderBounds != *bounds {
+		t.Errorf("Expected render_motion to see subject bounds %+v, got %+v", bounds, renderBounds)
+	}
+	if result.SubjectBounds == nil || *result.SubjectBounds != *bounds {
+		t.Errorf("Expected subject bounds %+v in the result, got %+v", bounds, result.SubjectBounds)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+)
+
+func TestConcatListContentWindowsPaths(t *testing.T) {
+	got := concatListContent([]string{`C:\work\tmp\segment_0.mp4`})
+	expected := "file 'C:/work/tmp/segment_0.mp4'\n"
+	if got != expected {
+		t.Errorf("concatListContent = %q, want %q", got, expected)
+	}
+}
+
+func TestSetFieldWindowsSeparators(t *testing.T) {
+	var result PipelineResult
+	result.SetField(llm.ResultFieldFinalOutput, "C:/work/output/final.mp4")
+	if expected := `C:\work\output\final.mp4`; result.FinalOutputPath != expected {
+		t.Errorf("FinalOutputPath = %q, want %q", result.FinalOutputPath, expected)
+	}
+}
@@ -4,26 +4,70 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/zhe.chen/agent-funpic-act/internal/activity"
 	"github.com/zhe.chen/agent-funpic-act/internal/client"
 	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/internal/retry"
 	"github.com/zhe.chen/agent-funpic-act/pkg/types"
 )
 
+// stageRetryBackoff is the delay before the first in-run retry of a stage that failed
+// with a retryable error; it doubles for each further retry
+var stageRetryBackoff = 2 * time.Second
+
 // Pipeline orchestrates the execution of all stages
 type Pipeline struct {
-	imagesorceryClient client.MCPClient // Background removal
-	yoloClient         client.MCPClient // Pose estimation
-	videoClient        client.MCPClient // Video composition
-	musicClient        client.MCPClient // Music search
-	llmProvider        llm.Provider     // Multi-provider LLM support
-	enableMotion       bool
-	maxRetries         int
-	manifestPath       string
-	aiMode             string // "lightweight" or "full_ai"
-}
-
-// NewPipeline creates a new pipeline executor
+	imagesorceryClient   client.MCPClient // Background removal
+	yoloClient           client.MCPClient // Pose estimation
+	videoClient          client.MCPClient // Video composition
+	musicClient          client.MCPClient // Music search
+	llmProvider          llm.Provider     // Multi-provider LLM support; nil runs without an LLM
+	enableMotion         bool
+	maxRetries           int
+	maxProcessDimension  int
+	maxPolygonPoints     int
+	jpegQuality          int
+	manifestStore        ManifestStore
+	aiMode               string // "lightweight" or "full_ai"
+	fullAIConfig         types.FullAIConfig
+	musicConfig          types.MusicConfig
+	stageCache           *StageCache
+	minSubjectConfidence float64
+	titleMetadata        bool
+	stageOrder           []types.PipelineStage
+	stepRegistry         *StepRegistry
+	traceFile            string
+	traceJSONFile        string
+	llmDebugDir          string
+	allowAnyPath         bool // full AI tool calls may write outside the temp and output dirs
+	outputConfig         types.OutputConfig
+	renderConfig         types.RenderConfig
+	captionConfig        types.CaptionConfig
+	captionsConfig       types.CaptionsConfig
+	comparisonConfig     types.ComparisonConfig
+	composeFailure       string
+	toolSnapshot         *llm.ToolSnapshot
+	toolSnapshotFile     string
+	exposedTools         map[string][]string
+	stageTimeout         time.Duration
+	eventLog             bool
+	subjectConfig        types.SubjectConfig
+	placementConfig      types.PlacementConfig
+	landmarksConfig      types.LandmarksConfig
+	durationSource       string
+	reanalyze            bool
+	parallelAnalysis     bool
+	orphanedStageAge     time.Duration
+	repairConfig         types.RepairConfig
+	segmentOutputFormat  string
+}
+
+// NewPipeline creates a new pipeline executor. llmProvider may be nil when LLM features
+// are disabled; the pipeline then runs its stages with the default decision.
 func NewPipeline(
 	imagesorceryClient client.MCPClient,
 	yoloClient client.MCPClient,
@@ -43,13 +87,216 @@ func NewPipeline(
 		llmProvider:        llmProvider,
 		enableMotion:       enableMotion,
 		maxRetries:         maxRetries,
-		manifestPath:       manifestPath,
+		manifestStore:      NewFileManifestStore(manifestPath),
 		aiMode:             aiMode,
+		composeFailure:     ComposeFailureFallback,
+		eventLog:           true,
+	}
+}
+
+// SetFullAIConfig sets the conversation limits used in full AI mode.
+// Zero-valued limits fall back to the built-in defaults.
+func (p *Pipeline) SetFullAIConfig(config types.FullAIConfig) {
+	p.fullAIConfig = config
+}
+
+// SetMaxProcessDimension sets the longest side, in pixels, of the image handed to the
+// segment and landmark tools. Larger inputs are downscaled first; 0 disables.
+func (p *Pipeline) SetMaxProcessDimension(maxDimension int) {
+	p.maxProcessDimension = maxDimension
+}
+
+// SetJPEGQuality sets the encoding quality (1-100) of JPEG working copies written by
+// preprocessing. Validate it with ResolveJPEGQuality first; 0 uses DefaultJPEGQuality.
+func (p *Pipeline) SetJPEGQuality(quality int) {
+	p.jpegQuality = quality
+}
+
+// SetMusicConfig sets the field mapping used to read tracks from music search results.
+// Empty fields fall back to the Epidemic Sound response shape.
+func (p *Pipeline) SetMusicConfig(config types.MusicConfig) {
+	p.musicConfig = config
+}
+
+// SetStageCache sets the cache shared across pipelines for segmentation and landmark
+// results. A nil cache disables caching.
+func (p *Pipeline) SetStageCache(cache *StageCache) {
+	p.stageCache = cache
+}
+
+// SetMinSubjectConfidence sets the lowest person detection score accepted by the
+// segmentation and landmark stages; below it they fail with ErrLowConfidenceDetection.
+// 0 accepts any detection.
+func (p *Pipeline) SetMinSubjectConfidence(minConfidence float64) {
+	p.minSubjectConfidence = minConfidence
+}
+
+// SetTitleMetadata enables writing the image description into the final video's title metadata
+func (p *Pipeline) SetTitleMetadata(enabled bool) {
+	p.titleMetadata = enabled
+}
+
+// SetEventLog enables appending each run's events to EventLogFileName in its TempDir
+// for external orchestrators to tail. Enabled by default.
+func (p *Pipeline) SetEventLog(enabled bool) {
+	p.eventLog = enabled
+}
+
+// SetSubjectConfig sets how photos with several people are animated. Validate it with
+// ResolveSubjectConfig first; the zero config animates the whole frame.
+func (p *Pipeline) SetSubjectConfig(config types.SubjectConfig) {
+	p.subjectConfig = config
+}
+
+// SetPlacementConfig sets the background the segmented person is placed over before
+// render_motion. Validate it with ResolvePlacementConfig first; the zero config animates
+// the segmented image as is.
+func (p *Pipeline) SetPlacementConfig(config types.PlacementConfig) {
+	p.placementConfig = config
+}
+
+// SetLandmarksConfig sets the pose model, confidence and minimum visible keypoints of the
+// landmarks stage. Validate it with ResolveLandmarksConfig first; zero values use the defaults.
+func (p *Pipeline) SetLandmarksConfig(config types.LandmarksConfig) {
+	p.landmarksConfig = config
+}
+
+// SetDurationSource sets what decides the motion's length. Validate it with
+// ResolveDurationSource first; empty keeps the requested duration.
+func (p *Pipeline) SetDurationSource(source string) {
+	p.durationSource = source
+}
+
+// SetManifestStore replaces the manifest file at the pipeline's manifest path with
+// another store, such as a MemoryManifestStore in tests or a database
+func (p *Pipeline) SetManifestStore(store ManifestStore) {
+	p.manifestStore = store
+}
+
+// SavedManifest returns the manifest of the pipeline's last run as saved, or nil when
+// there is none
+func (p *Pipeline) SavedManifest(ctx context.Context) (*Manifest, error) {
+	return p.manifestStore.Load(ctx)
+}
+
+// SetStageOrder sets the order stages run in, which may include custom stages registered
+// with a StepRegistry. An empty order uses GetStageOrder.
+func (p *Pipeline) SetStageOrder(order []types.PipelineStage) {
+	p.stageOrder = order
+}
+
+// SetStepRegistry sets a registry consulted before DefaultStepRegistry and the built-in steps
+func (p *Pipeline) SetStepRegistry(registry *StepRegistry) {
+	p.stepRegistry = registry
+}
+
+// SetTraceFile records full AI conversations to path as a replayable JSON trace.
+// Empty disables tracing.
+func (p *Pipeline) SetTraceFile(path string) {
+	p.traceFile = path
+}
+
+// SetAllowAnyPath lets full AI tool calls write files outside the temp and output
+// directories instead of rejecting them
+func (p *Pipeline) SetAllowAnyPath(allow bool) {
+	p.allowAnyPath = allow
+}
+
+// SetLLMDebugDir dumps the sanitized API requests and responses of full AI
+// conversations under dir/<pipeline ID>. Empty disables dumping.
+func (p *Pipeline) SetLLMDebugDir(dir string) {
+	p.llmDebugDir = dir
+}
+
+// SetOutputConfig sets the container and codecs of the final video.
+// Validate it with ResolveOutputConfig first; zero values keep the default MP4 output.
+func (p *Pipeline) SetOutputConfig(config types.OutputConfig) {
+	p.outputConfig = config
+}
+
+// SetRenderConfig sets the pixel format and padding of the rendered motion video.
+// Validate it with ResolveRenderConfig first; an empty pix_fmt uses DefaultPixFmt.
+func (p *Pipeline) SetRenderConfig(config types.RenderConfig) {
+	p.renderConfig = config
+}
+
+// SetCaptionsConfig sets the sidecar captions written next to the final video. Resolve
+// it with ResolveCaptionsConfig first; without text or cues no captions are written.
+func (p *Pipeline) SetCaptionsConfig(config types.CaptionsConfig) {
+	p.captionsConfig = config
+}
+
+// SetCaptionConfig sets the font of text drawn onto videos, such as comparison labels.
+// Validate it with ValidateCaptionConfig first.
+func (p *Pipeline) SetCaptionConfig(config types.CaptionConfig) {
+	p.captionConfig = config
+}
+
+// SetComparisonConfig enables the before/after comparison video written by compose.
+// Validate it with ResolveComparisonConfig first.
+func (p *Pipeline) SetComparisonConfig(config types.ComparisonConfig) {
+	p.comparisonConfig = config
+}
+
+// SetComposeFailure sets what compose does when muxing music fails. Validate it with
+// ResolveComposeFailure first; empty keeps the fallback to video without audio.
+func (p *Pipeline) SetComposeFailure(policy string) {
+	if policy == "" {
+		policy = ComposeFailureFallback
 	}
+	p.composeFailure = policy
+}
+
+// SetStageTimeout bounds the render_motion and compose stages. When it passes, their
+// ffmpeg process trees are killed and the stage fails with a StageTimeoutError.
+// 0 uses DefaultStageTimeout.
+func (p *Pipeline) SetStageTimeout(timeout time.Duration) {
+	p.stageTimeout = timeout
+}
+
+// SetToolSnapshot makes full AI mode offer the snapshot's tools instead of discovering
+// them from the MCP servers. Tool calls still go to the live servers. Nil discovers live.
+func (p *Pipeline) SetToolSnapshot(snapshot *llm.ToolSnapshot) {
+	p.toolSnapshot = snapshot
+}
+
+// SetToolSnapshotFile writes the tools offered in full AI mode to path as a JSON snapshot
+// that SetToolSnapshot can replay. Empty disables.
+func (p *Pipeline) SetToolSnapshotFile(path string) {
+	p.toolSnapshotFile = path
+}
+
+// SetExposedTools limits the tools advertised in full AI mode to the listed ones, by
+// server name; servers without a list advertise all. The model can still call unlisted
+// tools by name.
+func (p *Pipeline) SetExposedTools(exposed map[string][]string) {
+	p.exposedTools = exposed
 }
 
-// Execute runs the pipeline with idempotent stage execution
+// Execute runs the pipeline with idempotent stage execution, appending its progress to
+// the run's event log
 func (p *Pipeline) Execute(ctx context.Context, input types.PipelineInput, pipelineID string) (*PipelineResult, error) {
+	lock, err := p.acquireRunLock()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	events := p.openRunEventLog(input, pipelineID)
+	defer events.Close()
+	defer activity.Default.Finish(pipelineID)
+
+	trace := p.startChromeTrace(pipelineID)
+	defer p.saveChromeTrace(trace)
+
+	ctx = activity.WithPipeline(withChromeTrace(withEventLog(ctx, events), trace), pipelineID)
+	result, err := p.execute(ctx, input, pipelineID)
+	events.runFinished(result, err)
+	return result, err
+}
+
+// execute runs the pipeline in full AI or lightweight mode
+func (p *Pipeline) execute(ctx context.Context, input types.PipelineInput, pipelineID string) (*PipelineResult, error) {
 	// Route to full AI mode if enabled
 	if p.aiMode == "full_ai" && p.llmProvider != nil && p.llmProvider.IsEnabled() {
 		log.Println("[AI Agent] Full AI mode enabled, routing to ExecuteWithAI")
@@ -57,52 +304,91 @@ func (p *Pipeline) Execute(ctx context.Context, input types.PipelineInput, pipel
 	}
 
 	// Load or create manifest
-	manifest, err := LoadManifest(p.manifestPath)
+	manifest, err := p.manifestStore.Load(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load manifest: %w", err)
 	}
 
-	if manifest == nil {
+	resumed := manifest != nil
+	if !resumed {
 		manifest = NewManifest(pipelineID, input)
+		manifest.recordInputImage()
 		log.Printf("Created new pipeline manifest: %s", pipelineID)
 	} else {
 		log.Printf("Resuming pipeline: %s from stage %s", manifest.PipelineID, manifest.CurrentStage)
+		if err := p.repairOrphanedStages(ctx, manifest); err != nil {
+			return nil, err
+		}
+	}
+	if events := eventLogFrom(ctx); events != nil {
+		manifest.EventsFile = events.Path()
+	}
+
+	// Re-analysis: forget the stored decision, then keep the stages it didn't affect
+	var inputsBefore map[types.PipelineStage]string
+	reanalyzing := p.reanalyze && resumed
+	if reanalyzing {
+		inputsBefore = discardDecision(manifest, input)
 	}
 
 	// Lightweight mode: Use default configuration
 	// Note: For AI-driven decisions, use full_ai mode which leverages Provider interface
 	var decision *llm.PipelineDecision
-	if manifest.LLMAnalysis != nil {
+	switch {
+	case manifest.LLMAnalysis != nil:
 		// Resume: use existing decision from manifest
 		decision = manifest.LLMAnalysis.Decision
-		log.Println("[AI Agent] Using existing decision from manifest")
-	} else {
-		// Use default configuration for all stages
-		decision = llm.GetDefaultDecision()
-		log.Println("[AI Agent] Using default configuration (lightweight mode)")
+		if p.llmProvider != nil {
+			log.Println("[AI Agent] Using existing decision from manifest")
+		} else {
+			log.Println("Using existing decision from manifest")
+		}
+		if description := llm.SanitizeDescription(decision.ImageDescription, llm.MaxImageDescriptionLength); description != "" {
+			if manifest.Result == nil {
+				manifest.Result = &PipelineResult{}
+			}
+			manifest.Result.ImageDescription = description
+			log.Printf("[AI Agent] Image description: %s", description)
+		}
+	default:
+		// Use default configuration for all stages, with what the prompt rules understand
+		decision = applyPromptRules(manifest, llm.GetDefaultDecision())
+		if p.llmProvider != nil {
+			log.Println("[AI Agent] Using default configuration (lightweight mode)")
+		}
 	}
 
-	// Dynamic stage planning based on LLM decision
-	stages := []types.PipelineStage{}
-	if decision.NeedSegment {
-		stages = append(stages, types.StageSegmentPerson)
-	}
-	if decision.NeedLandmarks {
-		stages = append(stages, types.StageLandmarks)
+	if reanalyzing {
+		resetStaleStages(manifest, inputsBefore, decision)
 	}
-	if decision.EnableMotion {
-		stages = append(stages, types.StageRenderMotion)
+
+	// Dynamic stage planning based on LLM decision and the configured stage order
+	stages, err := p.planStages(decision)
+	if err != nil {
+		return nil, err
 	}
-	if decision.NeedMusic {
-		stages = append(stages, types.StageSearchMusic)
+
+	if p.llmProvider == nil {
+		log.Printf("Executing %d stages: %s", len(stages), p.describePlan(stages, decision))
+	} else {
+		log.Printf("[AI Agent] Executing %d stages: %s", len(stages), p.describePlan(stages, decision))
 	}
-	// Always include compose stage
-	stages = append(stages, types.StageCompose)
 
-	log.Printf("[AI Agent] Executing %d stages: %v", len(stages), stages)
+	// Execute stages sequentially; with parallel analysis, segment_person and
+	// estimate_landmarks run side by side on the original image
+	for i := 0; i < len(stages); i++ {
+		stage := stages[i]
+		if err := p.stopIfShutdown(ctx, manifest, stage); err != nil {
+			return nil, err
+		}
+		if group := p.parallelAnalysisGroup(stages[i:], decision); group != nil {
+			if err := p.executeParallelAnalysis(ctx, group, manifest, decision); err != nil {
+				return nil, err
+			}
+			i += len(group) - 1
+			continue
+		}
 
-	// Execute stages sequentially
-	for _, stage := range stages {
 		// Check if stage already completed (idempotency)
 		if manifest.IsStageCompleted(stage) {
 			log.Printf("Stage %s already completed, skipping", stage)
@@ -116,16 +402,17 @@ func (p *Pipeline) Execute(ctx context.Context, input types.PipelineInput, pipel
 
 		// Execute stage with retry logic
 		if err := p.executeStageWithRetry(ctx, stage, manifest); err != nil {
-			// Save failed state
-			manifest.FailStage(stage, err)
-			if saveErr := manifest.Save(p.manifestPath); saveErr != nil {
-				log.Printf("Warning: failed to save manifest after error: %v", saveErr)
+			// Out of retries: the LLM may suggest parameters for one more attempt
+			if err = p.repairStage(ctx, stage, manifest, decision, err); err != nil {
+				if err := p.handleStageFailure(ctx, stage, manifest, err, skipsOnFailure(decision, stage)); err != nil {
+					return nil, err
+				}
+				continue
 			}
-			return nil, fmt.Errorf("stage %s failed: %w", stage, err)
 		}
 
 		// Save progress after each stage
-		if err := manifest.Save(p.manifestPath); err != nil {
+		if err := p.saveManifest(ctx, manifest); err != nil {
 			return nil, fmt.Errorf("failed to save manifest: %w", err)
 		}
 
@@ -134,7 +421,7 @@ func (p *Pipeline) Execute(ctx context.Context, input types.PipelineInput, pipel
 
 	// Mark pipeline as complete
 	manifest.CurrentStage = types.StageComplete
-	if err := manifest.Save(p.manifestPath); err != nil {
+	if err := p.saveManifest(ctx, manifest); err != nil {
 		return nil, fmt.Errorf("failed to save final manifest: %w", err)
 	}
 
@@ -142,9 +429,39 @@ func (p *Pipeline) Execute(ctx context.Context, input types.PipelineInput, pipel
 	return manifest.Result, nil
 }
 
+// Full AI conversation limits used when the config leaves them unset
+const (
+	DefaultFullAIMaxRounds      = 20     // Max 20 conversation rounds
+	DefaultFullAIMaxTokens      = 100000 // Max 100k tokens
+	DefaultFullAIMaxCostUSD     = 0.50   // Max $0.50
+	DefaultFullAITimeoutSeconds = 300    // 5 minute timeout
+)
+
+// ResolveFullAILimits returns config with its unset (zero or negative) conversation
+// limits replaced by the built-in defaults
+func ResolveFullAILimits(config types.FullAIConfig) types.FullAIConfig {
+	if config.MaxRounds <= 0 {
+		config.MaxRounds = DefaultFullAIMaxRounds
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = DefaultFullAIMaxTokens
+	}
+	if config.MaxCostUSD <= 0 {
+		config.MaxCostUSD = DefaultFullAIMaxCostUSD
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = DefaultFullAITimeoutSeconds
+	}
+	return config
+}
+
 // ExecuteWithAI executes pipeline with full AI control via conversation loop
 func (p *Pipeline) ExecuteWithAI(ctx context.Context, input types.PipelineInput, pipelineID string) (*PipelineResult, error) {
+	if p.llmProvider == nil {
+		return nil, fmt.Errorf("full AI mode requires an LLM provider")
+	}
 	log.Printf("[AI Agent] Starting full AI mode for pipeline: %s using provider: %s", pipelineID, p.llmProvider.Name())
+	activity.Default.SetStage(pipelineID, "full_ai")
 
 	// 1. Create tool adapter with all MCP clients
 	mcpClients := map[string]client.MCPClient{
@@ -155,64 +472,346 @@ func (p *Pipeline) ExecuteWithAI(ctx context.Context, input types.PipelineInput,
 	}
 	toolAdapter := llm.NewToolAdapter(mcpClients)
 
+	// Resolve working directories so the model writes files to predictable locations
+	absTempDir, err := filepath.Abs(input.TempDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve temp directory: %w", err)
+	}
+	absOutputDir, err := filepath.Abs(input.OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	toolAdapter.SetPathRoots(absTempDir, absOutputDir)
+	toolAdapter.SetOutputPathRules(p.fullAIConfig.OutputPathArguments)
+	toolAdapter.SetAllowAnyPath(p.allowAnyPath)
+	toolAdapter.SetArgumentNormalization(!p.fullAIConfig.DisableArgumentNormalization)
+	toolAdapter.SetResultSummaries(p.fullAIConfig.SummarizeResults)
+	toolAdapter.SetLazySchemas(p.fullAIConfig.LazyToolSchemas)
+	toolAdapter.SetToolNameSeparator(p.fullAIConfig.ToolNameSeparator)
+	toolAdapter.SetDiscoveryConcurrency(p.fullAIConfig.DiscoveryConcurrency)
+	toolAdapter.SetExposedTools(p.exposedTools)
+	if p.toolSnapshot != nil {
+		toolAdapter.SetToolSnapshot(p.toolSnapshot)
+	}
+	if p.toolSnapshotFile != "" {
+		if err := saveToolSnapshot(ctx, toolAdapter, p.toolSnapshotFile); err != nil {
+			log.Printf("[AI Agent] Warning: %v", err)
+		}
+	}
+
 	// 2. Create conversation config with limits
+	limits := ResolveFullAILimits(p.fullAIConfig)
 	conversationConfig := &llm.FullAIConversationConfig{
-		MaxRounds:      20,     // Max 20 conversation rounds
-		MaxTokens:      100000, // Max 100k tokens
-		MaxCostUSD:     0.50,   // Max $0.50
-		TimeoutSeconds: 300,    // 5 minute timeout
+		MaxRounds:      limits.MaxRounds,
+		MaxTokens:      limits.MaxTokens,
+		MaxCostUSD:     limits.MaxCostUSD,
+		TimeoutSeconds: limits.TimeoutSeconds,
 		Model:          "",     // Use provider's default model
+		TempDir:        absTempDir,
+		OutputDir:      absOutputDir,
+		BudgetStatus:   p.fullAIConfig.BudgetStatus,
+
+		HistoryCompaction:     p.fullAIConfig.HistoryCompaction,
+		MaxToolResultsPerTurn: p.fullAIConfig.MaxToolResultsPerTurn,
 	}
 
-	// 3. Create conversation from provider
-	conversation, err := p.llmProvider.CreateConversation(conversationConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	// Record the conversation for replay when a trace file is set, and report its
+	// rounds and tool calls to the event log
+	events, timeline := eventLogFrom(ctx), chromeTraceFrom(ctx)
+	var trace *llm.TraceRecorder
+	if p.traceFile != "" || events != nil || timeline != nil {
+		trace = llm.NewTraceRecorder(p.llmProvider.Name(), input.ImagePath, input.Duration)
+		conversationConfig.Trace = trace
+		toolAdapter.SetTraceRecorder(trace)
+	}
+	if events != nil {
+		toolAdapter.AddObserver(events.toolCalled)
+	}
+	if timeline != nil {
+		toolAdapter.AddObserver(timeline.observeToolCall)
 	}
+	trace.SetTurnObserver(func(round int, turn llm.TraceTurn) {
+		activity.Default.RecordLLMRound(pipelineID, round, turn.InputTokens+turn.OutputTokens)
+		events.llmRound(round, turn)
+		timeline.llmRound(round, turn)
+	})
 
-	// 4. Set tool adapter
-	conversation.SetToolAdapter(toolAdapter)
+	// Dump raw provider payloads for debugging response parsing
+	var debugDir string
+	if p.llmDebugDir != "" {
+		debug, err := llm.NewDebugDumper(filepath.Join(p.llmDebugDir, pipelineID), p.llmProvider.Name())
+		if err != nil {
+			return nil, err
+		}
+		conversationConfig.Debug = debug
+		debugDir = debug.Dir()
+	}
 
-	// 5. Execute conversation loop
-	result, err := conversation.Execute(ctx, input.ImagePath, input.Duration, input.UserPrompt)
+	// 3. Record intermediate paths from tool traffic so an interrupted run
+	// still leaves usable results in the manifest
+	manifest := NewManifest(pipelineID, input)
+	manifest.recordInputImage()
+	manifest.Result = &PipelineResult{LLMDebugDir: debugDir}
+	manifest.EventsFile = events.Path()
+	extractor := llm.NewResultExtractor(p.fullAIConfig.ResultExtraction, func(field, value string, source *types.ToolProvenance) {
+		if !manifest.Result.SetField(field, value) {
+			log.Printf("[AI Agent] Warning: unknown result field %s", field)
+			return
+		}
+		manifest.Result.SetProvenance(field, source)
+		if err := p.saveManifest(ctx, manifest); err != nil {
+			log.Printf("[AI Agent] Warning: failed to save manifest: %v", err)
+		}
+	})
+	toolAdapter.AddObserver(extractor.Observe)
+
+	// 4. Execute conversation loop, restarting it after transient failures
+	userPrompt := input.UserPrompt
+	if len(input.AnimationPlan) > 0 {
+		plan, err := normalizeAnimationPlan(input.AnimationPlan, input.Duration)
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range plan {
+			if segment.Type == AnimationCustom {
+				return nil, fmt.Errorf("custom animations are rendered by the lightweight pipeline, not the full AI mode's video tools")
+			}
+		}
+		userPrompt = strings.TrimSpace(userPrompt + "\n\n" + animationPlanPrompt(plan))
+	}
+	// The model gets a plainly named copy; results and the trace keep the original path
+	imagePath := input.ImagePath
+	safeInput, err := copySafeInput(input.ImagePath, absTempDir)
 	if err != nil {
+		return nil, err
+	}
+	if safeInput != nil {
+		manifest.SafeInput = safeInput
+		imagePath = safeInput.Path
+	}
+	result, metrics, attempts, err := p.executeConversation(ctx, conversationConfig, toolAdapter, imagePath, input.Duration, userPrompt)
+	manifest.Result.Conversation = &metrics
+	if attempts > 1 {
+		manifest.Result.ConversationAttempts = attempts
+	}
+	if p.traceFile != "" {
+		trace.Finish(result, err, metrics)
+		if saveErr := trace.Save(p.traceFile); saveErr != nil {
+			log.Printf("[AI Agent] Warning: failed to save trace: %v", saveErr)
+		} else {
+			log.Printf("[AI Agent] Conversation trace written to %s", p.traceFile)
+		}
+	}
+	if debugDir != "" {
+		log.Printf("[AI Agent] LLM request/response dumps written to %s", debugDir)
+	}
+	if err != nil {
+		log.Printf("[AI Agent] Conversation failed after %d rounds:\n%s", metrics.Rounds, llm.FormatRoundTable(metrics))
+		if saveErr := p.saveManifest(ctx, manifest); saveErr != nil {
+			log.Printf("Warning: failed to save manifest after error: %v", saveErr)
+		}
 		return nil, fmt.Errorf("AI conversation failed: %w", err)
 	}
 
-	// 6. Log metrics
-	metrics := conversation.GetMetrics()
-	log.Printf("[AI Agent] Conversation completed:")
-	log.Printf("  - Rounds: %d", metrics.Rounds)
-	log.Printf("  - Tool Calls: %d", metrics.ToolCalls)
-	log.Printf("  - Tokens: %d", metrics.TokensUsed)
-	log.Printf("  - Duration: %.2fs", metrics.Duration)
-	log.Printf("  - Cost: $%.4f", metrics.CostUSD)
+	// 5. Log metrics
+	log.Printf("[AI Agent] Conversation completed in %d rounds:\n%s", metrics.Rounds, llm.FormatRoundTable(metrics))
+
+	// 6. Return result
+	// Prefer the path reported via the synthetic report tool, then the path observed
+	// from tool traffic, and finally the LLM's final text output
+	if reported := toolAdapter.ReportedResult(); reported != nil {
+		manifest.Result.FinalOutputPath = reported.VideoPath
+		manifest.Result.ImageDescription = reported.ImageDescription
+	} else if manifest.Result.FinalOutputPath == "" {
+		manifest.Result.FinalOutputPath = result
+	}
+
+	// The video tools always write MP4; convert when another format is configured
+	outputConfig, err := ResolveOutputConfig(p.outputConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output config: %w", err)
+	}
+	if !isDefaultOutput(outputConfig) {
+		converted, err := convertOutput(ctx, manifest.Result.FinalOutputPath, absOutputDir, outputConfig)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Result.FinalOutputPath = converted
+	}
+
+	if p.titleMetadata && manifest.Result.ImageDescription != "" {
+		if err := writeTitleMetadata(ctx, manifest.Result.FinalOutputPath, manifest.Result.ImageDescription); err != nil {
+			log.Printf("[AI Agent] Warning: failed to write title metadata: %v", err)
+		}
+	}
+	if manifest.Result.FinalOutputPath != "" {
+		manifest.Result.CaptionPaths = p.writeCaptions(ctx, manifest, manifest.Result.FinalOutputPath)
+	}
+
+	manifest.CurrentStage = types.StageComplete
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		return nil, fmt.Errorf("failed to save final manifest: %w", err)
+	}
 
-	// 7. Return result
-	// Note: In full AI mode, the result is the LLM's final output
-	// This might include the path to the final video or status message
-	return &PipelineResult{
-		FinalOutputPath: result, // LLM should return video path
-	}, nil
+	return manifest.Result, nil
 }
 
-// executeStageWithRetry executes a single stage with retry logic
+// executeConversation runs a full AI conversation with a new conversation per attempt.
+// One that fails with a retryable error, e.g. a provider outage late in the run, is
+// restarted from scratch up to conversation_retries times, unless the model already
+// reported its result. Returns the last attempt's output and metrics and the number of
+// attempts.
+func (p *Pipeline) executeConversation(ctx context.Context, config *llm.FullAIConversationConfig, toolAdapter *llm.ToolAdapter, imagePath string, duration float64, userPrompt string) (string, llm.FullAIConversationMetrics, int, error) {
+	retries := max(p.fullAIConfig.ConversationRetries, 0)
+	for attempt := 1; ; attempt++ {
+		conversation, err := p.llmProvider.CreateConversation(config)
+		if err != nil {
+			return "", llm.FullAIConversationMetrics{}, attempt, fmt.Errorf("failed to create conversation: %w", err)
+		}
+		conversation.SetToolAdapter(toolAdapter)
+
+		chromeTraceFrom(ctx).startConversation(p.llmProvider.Name())
+		result, err := conversation.Execute(ctx, imagePath, duration, userPrompt)
+		metrics := conversation.GetMetrics()
+		if err == nil || attempt > retries || toolAdapter.ReportedResult() != nil ||
+			ctx.Err() != nil || shutdownRequested(ctx) || !retry.IsRetryable(err) {
+			return result, metrics, attempt, err
+		}
+
+		delay := retry.Backoff(stageRetryBackoff, attempt)
+		log.Printf("[AI Agent] Conversation attempt %d/%d failed after %d rounds ($%.4f): %v; restarting from scratch in %s",
+			attempt, retries+1, metrics.Rounds, metrics.CostUSD, err, delay)
+		if sleepErr := retry.Sleep(ctx, delay); sleepErr != nil {
+			return result, metrics, attempt, err
+		}
+	}
+}
+
+// RecoverySkip is the error recovery action that skips a failed stage and continues the run
+const RecoverySkip = "skip"
+
+// skipsOnFailure reports whether the decision's error recovery skips stage when it fails.
+// Compose writes the output, so it is never skipped.
+func skipsOnFailure(decision *llm.PipelineDecision, stage types.PipelineStage) bool {
+	if decision == nil || stage == types.StageCompose {
+		return false
+	}
+	return decision.ErrorRecovery[string(stage)] == RecoverySkip
+}
+
+// handleStageFailure records a stage that failed with err. An interrupted stage is
+// checkpointed to run again on resume; a skippable one is skipped, clearing its result,
+// and returns nil so the run continues. Otherwise the failure ends the run.
+func (p *Pipeline) handleStageFailure(ctx context.Context, stage types.PipelineStage, manifest *Manifest, err error, skippable bool) error {
+	// Interrupted (signal or shutdown deadline): checkpoint without consuming a retry
+	if ctx.Err() != nil {
+		manifest.InterruptStage(stage)
+		if saveErr := p.saveManifest(ctx, manifest); saveErr != nil {
+			log.Printf("Warning: failed to save manifest after interrupt: %v", saveErr)
+		}
+		return fmt.Errorf("stage %s interrupted: %w", stage, ctx.Err())
+	}
+
+	// Stages whose error recovery is "skip" don't stop the run
+	if skippable {
+		log.Printf("Warning: stage %s failed, skipping it as its error recovery allows: %v", stage, err)
+		manifest.SkipFailedStage(stage, err)
+		clearStageResult(manifest, stage)
+		if err := p.saveManifest(ctx, manifest); err != nil {
+			return fmt.Errorf("failed to save manifest: %w", err)
+		}
+		return nil
+	}
+
+	// Save failed state
+	manifest.FailStage(stage, err)
+	if saveErr := p.saveManifest(ctx, manifest); saveErr != nil {
+		log.Printf("Warning: failed to save manifest after error: %v", saveErr)
+	}
+	return &StageError{Stage: stage, Err: err}
+}
+
+// clearStageResult removes what a skipped stage left in the result, so later stages
+// don't use it
+func clearStageResult(manifest *Manifest, stage types.PipelineStage) {
+	if manifest.Result == nil {
+		return
+	}
+	switch stage {
+	case types.StageSegmentPerson:
+		manifest.Result.SegmentedImagePath = ""
+		manifest.Result.Subjects = nil
+		manifest.Result.StaticSubjectsPath = ""
+		manifest.Result.SubjectArea = 0
+		manifest.Result.SubjectBounds = nil
+	case types.StageLandmarks:
+		manifest.Result.LandmarksData = ""
+		manifest.Result.LandmarksScale = 0
+	}
+}
+
+// executeStageWithRetry executes a single stage, retrying it in this run while it fails
+// with a retryable error (see retry.IsRetryable) and the stage has retries left. Each
+// retried failure counts towards max_retries; the last one is recorded by the caller.
 func (p *Pipeline) executeStageWithRetry(ctx context.Context, stage types.PipelineStage, manifest *Manifest) error {
-	stepFunc, err := GetStepForStage(stage)
+	return p.executeStage(ctx, stage, manifest, func() error { return p.saveManifest(ctx, manifest) })
+}
+
+// executeStage is executeStageWithRetry with the checkpoint run after each retried
+// failure, so a stage running on its own copy of the manifest can merge it first
+func (p *Pipeline) executeStage(ctx context.Context, stage types.PipelineStage, manifest *Manifest, checkpoint func() error) error {
+	stepFunc, err := p.stepForStage(stage)
 	if err != nil {
 		return err
 	}
 
+	for attempt := 1; ; attempt++ {
+		err := p.attemptStage(ctx, stage, manifest, stepFunc)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || shutdownRequested(ctx) || !retry.IsRetryable(err) {
+			return err
+		}
+		if manifest.GetStageState(stage).RetryCount+1 >= p.maxRetries {
+			return err
+		}
+
+		manifest.FailStage(stage, err)
+		if saveErr := checkpoint(); saveErr != nil {
+			log.Printf("Warning: failed to save manifest after error: %v", saveErr)
+		}
+		delay := retry.Backoff(stageRetryBackoff, attempt)
+		log.Printf("Warning: stage %s failed with a retryable error, retrying in %s: %v", stage, delay, err)
+		if sleepErr := retry.Sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// attemptStage runs a stage once, recording its start and outcome in the event log
+func (p *Pipeline) attemptStage(ctx context.Context, stage types.PipelineStage, manifest *Manifest, stepFunc StepFunc) error {
 	// Mark stage as running
 	manifest.StartStage(stage)
+	activity.Default.SetStage(manifest.PipelineID, string(stage))
 	log.Printf("Starting stage: %s", stage)
+	events := eventLogFrom(ctx)
+	attempt := manifest.GetStageState(stage).Attempt
+	events.Emit(EventStageStarted, stage, map[string]interface{}{"attempt": attempt})
+	start := time.Now()
 
 	// Execute the step
-	if err := stepFunc(ctx, p, manifest); err != nil {
-		return err
+	err := stepFunc(ctx, p, manifest)
+	chromeTraceFrom(ctx).stage(stage, attempt, start, err)
+	if err == nil {
+		events.Emit(EventStageCompleted, stage, map[string]interface{}{"duration_ms": time.Since(start).Milliseconds()})
+		return nil
 	}
-
-	return nil
+	events.Emit(EventStageFailed, stage, map[string]interface{}{
+		"error":       err.Error(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	return err
 }
 
 // GetStageOrder returns the ordered list of pipeline stages
@@ -226,6 +825,12 @@ func GetStageOrder() []types.PipelineStage {
 	}
 }
 
+// saveManifest checkpoints the manifest. It still saves once ctx is canceled, since an
+// interrupted run must record where it stopped.
+func (p *Pipeline) saveManifest(ctx context.Context, manifest *Manifest) error {
+	return p.manifestStore.Save(context.WithoutCancel(ctx), manifest)
+}
+
 // ValidateInput checks if the pipeline input is valid
 func ValidateInput(input types.PipelineInput) error {
 	if input.ImagePath == "" {
@@ -234,5 +839,32 @@ func ValidateInput(input types.PipelineInput) error {
 	if input.Duration <= 0 {
 		return fmt.Errorf("duration must be positive")
 	}
+	if input.Intensity < 0 {
+		return fmt.Errorf("intensity must not be negative")
+	}
+	if _, err := CheckInputImage(input.ImagePath); err != nil {
+		return err
+	}
+	if input.AudioPath != "" {
+		if err := checkAudioFile(input.AudioPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveToolSnapshot discovers the adapter's tools and writes them to path
+func saveToolSnapshot(ctx context.Context, toolAdapter *llm.ToolAdapter, path string) error {
+	if _, err := toolAdapter.DiscoverAndConvertTools(ctx); err != nil {
+		return fmt.Errorf("failed to discover tools for snapshot: %w", err)
+	}
+	snapshot, err := toolAdapter.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to build tool snapshot: %w", err)
+	}
+	if err := snapshot.Save(path); err != nil {
+		return err
+	}
+	log.Printf("[AI Agent] Tool snapshot written to %s (%d tools)", path, len(snapshot.Tools))
 	return nil
 }
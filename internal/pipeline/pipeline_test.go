@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/activity"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestLightweightPipelineWithoutProvider runs every stage of the lightweight pipeline
+// with a nil LLM provider against fake MCP servers, then resumes it, checking neither run
+// logs as the AI agent, even with a prompt the rules interpret. It needs ffmpeg and ffprobe.
+func TestLightweightPipelineWithoutProvider(t *testing.T) {
+	musicURL := serveTestTrack(t)
+
+	tests := []struct {
+		name        string
+		prompt      string
+		expectModel string // Model of the stored analysis, "" for none
+	}{
+		{name: "no prompt"},
+		{name: "interpreted prompt", prompt: "slow sad nod", expectModel: PromptRulesModel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			imagePath := filepath.Join(root, "photo.png")
+			writePNG(t, imagePath, 64, 48)
+
+			tools := &batchToolClient{fakeToolClient: newFakeToolClient(), musicURL: musicURL}
+			store := NewMemoryManifestStore()
+			p := NewPipeline(tools, tools, tools, tools, nil, true, 3, "", "lightweight")
+			p.SetManifestStore(store)
+			p.SetEventLog(false)
+
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			input := types.PipelineInput{ImagePath: imagePath, Duration: 2, TempDir: root, OutputDir: root, UserPrompt: tt.prompt}
+			result, err := p.Execute(context.Background(), input, "no-llm-test")
+			if err != nil {
+				t.Fatalf("Execute failed: %v\n%s", err, logs.String())
+			}
+			if result.SegmentedImagePath == "" || result.LandmarksData == "" || result.MotionVideoPath == "" {
+				t.Errorf("Expected segmentation, landmarks and motion results, got %+v", result)
+			}
+			if _, err := os.Stat(result.FinalOutputPath); err != nil {
+				t.Errorf("Expected the final video: %v", err)
+			}
+
+			manifest, err := store.Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if manifest.CurrentStage != types.StageComplete {
+				t.Errorf("Expected a complete run, got stage %s", manifest.CurrentStage)
+			}
+			model := ""
+			if manifest.LLMAnalysis != nil {
+				model = manifest.LLMAnalysis.Model
+			}
+			if model != tt.expectModel {
+				t.Errorf("Expected analysis by %q, got %q", tt.expectModel, model)
+			}
+			for _, stage := range GetStageOrder() {
+				if !manifest.IsStageCompleted(stage) {
+					t.Errorf("Expected stage %s completed, got %+v", stage, manifest.Stages[stage])
+				}
+			}
+
+			// Resuming reuses the stored decision
+			if _, err := p.Execute(context.Background(), input, "no-llm-test"); err != nil {
+				t.Fatalf("Resumed Execute failed: %v", err)
+			}
+			if strings.Contains(logs.String(), "[AI Agent]") {
+				t.Errorf("Expected no AI agent log lines without a provider, got:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+// snapshotToolClient records the running pipelines' activity while a tool call is in flight
+type snapshotToolClient struct {
+	*fakeToolClient
+	seen []activity.Pipeline
+}
+
+func (c *snapshotToolClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	c.seen = activity.Default.Snapshot()
+	return c.fakeToolClient.CallTool(ctx, name, arguments)
+}
+
+// TestExecuteReportsActivity verifies a run registers its stage and in-flight tool calls
+// for status dumps, and is forgotten once it ends
+func TestExecuteReportsActivity(t *testing.T) {
+	dir := t.TempDir()
+	mcpClient := &snapshotToolClient{fakeToolClient: newFakeToolClient()}
+	registry := NewStepRegistry()
+	registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		if _, err := callTool(ctx, "imagesorcery", mcpClient, "detect", nil); err != nil {
+			return err
+		}
+		return manifest.CompleteStage(types.StageCompose, map[string]string{})
+	})
+
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetManifestStore(NewMemoryManifestStore())
+	p.SetEventLog(false)
+	p.SetStepRegistry(registry)
+	p.SetStageOrder([]types.PipelineStage{types.StageCompose})
+
+	input := types.PipelineInput{ImagePath: "input.png", TempDir: dir, OutputDir: dir}
+	if _, err := p.Execute(context.Background(), input, "activity-test"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	var run *activity.Pipeline
+	for i := range mcpClient.seen {
+		if mcpClient.seen[i].ID == "activity-test" {
+			run = &mcpClient.seen[i]
+		}
+	}
+	if run == nil || run.Stage != string(types.StageCompose) || len(run.ToolCalls) != 1 ||
+		run.ToolCalls[0].Server != "imagesorcery" || run.ToolCalls[0].Tool != "detect" {
+		t.Fatalf("Expected compose with imagesorcery/detect in flight, got %+v", mcpClient.seen)
+	}
+	for _, running := range activity.Default.Snapshot() {
+		if running.ID == "activity-test" {
+			t.Errorf("Expected the run to be forgotten once finished, got %+v", running)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultPixFmt is the pixel format of the rendered motion video when none is set;
+// it plays everywhere
+const DefaultPixFmt = "yuv420p"
+
+// pixelFormat describes a pixel format accepted in pipeline.render
+type pixelFormat struct {
+	evenWidth  bool // Chroma subsampling needs an even width
+	evenHeight bool // Chroma subsampling needs an even height
+	alpha      bool // Keeps transparency; rendered as VP9 in Matroska
+}
+
+var renderPixelFormats = map[string]pixelFormat{
+	"yuv420p":  {evenWidth: true, evenHeight: true},
+	"yuv422p":  {evenWidth: true},
+	"yuv444p":  {},
+	"yuva420p": {evenWidth: true, evenHeight: true, alpha: true},
+}
+
+// renderSpec is the format of the rendered animation segments
+type renderSpec struct {
+	width, height int // Source image size; 0 when unknown
+	pixFmt        string
+	pad           bool // Pad odd dimensions up to even when the pixel format needs it
+}
+
+// ResolveRenderConfig fills in the default pixel format and rejects formats that the
+// resolved output config can't carry: transparency survives only VP9 (webm or mkv)
+func ResolveRenderConfig(render types.RenderConfig, output types.OutputConfig) (types.RenderConfig, error) {
+	render.PixFmt = strings.ToLower(strings.TrimSpace(render.PixFmt))
+	if render.PixFmt == "" {
+		render.PixFmt = DefaultPixFmt
+	}
+
+	format, ok := renderPixelFormats[render.PixFmt]
+	if !ok {
+		supported := make([]string, 0, len(renderPixelFormats))
+		for name := range renderPixelFormats {
+			supported = append(supported, name)
+		}
+		sort.Strings(supported)
+		return render, fmt.Errorf("unsupported pix_fmt %q (supported: %s)", render.PixFmt, strings.Join(supported, ", "))
+	}
+	if format.alpha && output.VideoCodec != "vp9" {
+		return render, fmt.Errorf("pix_fmt %s keeps transparency only with output video_codec vp9 (webm or mkv), not %s",
+			render.PixFmt, output.VideoCodec)
+	}
+	return render, nil
+}
+
+// newRenderSpec returns the render format for an image of the given size. Without
+// auto-pad, a size the pixel format can't encode is an error rather than an ffmpeg failure.
+func newRenderSpec(width, height int, render types.RenderConfig) (renderSpec, error) {
+	spec := renderSpec{width: width, height: height, pixFmt: render.PixFmt, pad: !render.DisableAutoPad}
+	if spec.pixFmt == "" {
+		spec.pixFmt = DefaultPixFmt
+	}
+
+	format := renderPixelFormats[spec.pixFmt]
+	if !spec.pad && ((format.evenWidth && width%2 != 0) || (format.evenHeight && height%2 != 0)) {
+		return spec, fmt.Errorf("image is %dx%d but pix_fmt %s needs even dimensions; enable auto-pad or use yuv444p",
+			width, height, spec.pixFmt)
+	}
+	return spec, nil
+}
+
+// padFilter returns the ffmpeg filter padding the frame to dimensions the pixel format
+// can encode, or "" when none is needed. Padding is transparent for alpha formats.
+func (s renderSpec) padFilter() string {
+	format := renderPixelFormats[s.pixFmt]
+	if !s.pad || (!format.evenWidth && !format.evenHeight) {
+		return ""
+	}
+
+	color := "black"
+	if format.alpha {
+		color = "black@0"
+	}
+
+	// Unknown size: let ffmpeg round up whatever the filter chain produces
+	if s.width <= 0 || s.height <= 0 {
+		width, height := "iw", "ih"
+		if format.evenWidth {
+			width = "ceil(iw/2)*2"
+		}
+		if format.evenHeight {
+			height = "ceil(ih/2)*2"
+		}
+		return fmt.Sprintf("pad=%s:%s:0:0:color=%s", width, height, color)
+	}
+
+	width, height := s.width, s.height
+	if format.evenWidth {
+		width += width % 2
+	}
+	if format.evenHeight {
+		height += height % 2
+	}
+	if width == s.width && height == s.height {
+		return ""
+	}
+	return fmt.Sprintf("pad=%d:%d:0:0:color=%s", width, height, color)
+}
+
+// encoderArgs returns the ffmpeg encoding arguments for rendered segments. Alpha formats
+// are encoded as VP9, the default H.264 can't carry transparency.
+func (s renderSpec) encoderArgs() []string {
+	if renderPixelFormats[s.pixFmt].alpha {
+		return []string{"-c:v", "libvpx-vp9", "-pix_fmt", s.pixFmt}
+	}
+	return []string{"-pix_fmt", s.pixFmt}
+}
+
+// motionArtifactName returns the file name of a motion artifact for the pixel format:
+// alpha formats are written to Matroska instead of MP4
+func motionArtifactName(name, pixFmt string) string {
+	if renderPixelFormats[pixFmt].alpha {
+		return strings.TrimSuffix(name, ".mp4") + ".mkv"
+	}
+	return name
+}
+
+// pixelFormatError explains an ffmpeg failure caused by the pixel format, or returns
+// nil when the output shows another cause
+func pixelFormatError(output []byte, pixFmt string) error {
+	text := string(output)
+	switch {
+	case strings.Contains(text, "not divisible by 2"):
+		return fmt.Errorf("ffmpeg rejected an odd frame size for pix_fmt %s; enable auto-pad or use yuv444p", pixFmt)
+	case strings.Contains(text, "is invalid or not supported"), strings.Contains(text, "Unsupported pixel format"):
+		return fmt.Errorf("ffmpeg cannot encode pix_fmt %s with this encoder; choose another pipeline.render.pix_fmt", pixFmt)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveRenderConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		pixFmt    string
+		codec     string
+		expected  string
+		expectErr bool
+	}{
+		{"default", "", "copy", DefaultPixFmt, false},
+		{"quality", "YUV444P", "h264", "yuv444p", false},
+		{"alpha in vp9", "yuva420p", "vp9", "yuva420p", false},
+		{"alpha copied into mp4", "yuva420p", "copy", "", true},
+		{"alpha in h264", "yuva420p", "h264", "", true},
+		{"unknown", "rgb24", "copy", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveRenderConfig(types.RenderConfig{PixFmt: tt.pixFmt}, types.OutputConfig{VideoCodec: tt.codec})
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error for %s with %s", tt.pixFmt, tt.codec)
+				}
+				return
+			}
+			if err != nil || got.PixFmt != tt.expected {
+				t.Errorf("Expected %s, got %s (err: %v)", tt.expected, got.PixFmt, err)
+			}
+		})
+	}
+}
+
+// TestSegmentArgsOddDimensions verifies odd image sizes are padded for subsampled
+// formats with auto-pad, and rejected up front without it
+func TestSegmentArgsOddDimensions(t *testing.T) {
+	segment := types.AnimationSegment{Type: "rotate", Duration: 1, Intensity: 5}
+
+	tests := []struct {
+		name       string
+		render     types.RenderConfig
+		wantPad    string // Expected pad filter, "" for none
+		wantEncode []string
+		expectErr  bool
+	}{
+		{"yuv420p auto-pad", types.RenderConfig{PixFmt: "yuv420p"}, "pad=642:482:0:0:color=black", []string{"-pix_fmt", "yuv420p"}, false},
+		{"yuv422p pads width only", types.RenderConfig{PixFmt: "yuv422p"}, "pad=642:481:0:0:color=black", []string{"-pix_fmt", "yuv422p"}, false},
+		{"yuv444p needs no pad", types.RenderConfig{PixFmt: "yuv444p"}, "", []string{"-pix_fmt", "yuv444p"}, false},
+		{"yuva420p pads transparent", types.RenderConfig{PixFmt: "yuva420p"}, "pad=642:482:0:0:color=black@0", []string{"-c:v", "libvpx-vp9", "-pix_fmt", "yuva420p"}, false},
+		{"yuv420p without auto-pad", types.RenderConfig{PixFmt: "yuv420p", DisableAutoPad: true}, "", nil, true},
+		{"yuv444p without auto-pad", types.RenderConfig{PixFmt: "yuv444p", DisableAutoPad: true}, "", []string{"-pix_fmt", "yuv444p"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := newRenderSpec(641, 481, tt.render)
+			if tt.expectErr {
+				if err == nil || !strings.Contains(err.Error(), "641x481") {
+					t.Errorf("Expected an error naming the odd size, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newRenderSpec failed: %v", err)
+			}
+
+			args, err := segmentArgs("/tmp/in.png", "/tmp/out.mp4", segment, spec)
+			if err != nil {
+				t.Fatalf("segmentArgs failed: %v", err)
+			}
+			joined := strings.Join(args, " ")
+			filter := args[5]
+			if !strings.Contains(filter, "scale=641:481") {
+				t.Errorf("Expected the source size to be kept, got %q", filter)
+			}
+			if tt.wantPad == "" && strings.Contains(filter, "pad=") {
+				t.Errorf("Expected no pad, got %q", filter)
+			}
+			if tt.wantPad != "" && !strings.HasSuffix(filter, ","+tt.wantPad) {
+				t.Errorf("Expected filter ending in %q, got %q", tt.wantPad, filter)
+			}
+			if !strings.Contains(joined, strings.Join(tt.wantEncode, " ")) {
+				t.Errorf("Expected encoder args %v in %v", tt.wantEncode, args)
+			}
+		})
+	}
+}
+
+func TestPixelFormatError(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantErr string
+	}{
+		{"odd size", "[libx264 @ 0x1] width not divisible by 2 (641x481)", "odd frame size"},
+		{"unsupported", "Specified pixel format yuva420p is invalid or not supported", "cannot encode pix_fmt"},
+		{"other failure", "No such file or directory", ""},
+	}
+
+	for _, tt := range tests {
+		err := pixelFormatError([]byte(tt.output), "yuv420p")
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: expected no pixel format error, got %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestMotionArtifactName(t *testing.T) {
+	if got := motionArtifactName(motionFileName, "yuv420p"); got != motionFileName {
+		t.Errorf("Expected %s, got %s", motionFileName, got)
+	}
+	if got := motionArtifactName("motion_segment1.mp4", "yuva420p"); got != "motion_segment1.mkv" {
+		t.Errorf("Expected motion_segment1.mkv, got %s", got)
+	}
+}
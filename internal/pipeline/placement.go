@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Subject fits: how pipeline.placement sizes the subject over the background
+const (
+	SubjectFitCenter = "center" // Keep the subject's size, centered (default)
+	SubjectFitFit    = "fit"    // Largest size showing the whole subject
+	SubjectFitFill   = "fill"   // Smallest size covering the background, cropping the subject
+)
+
+// placedFileName is the segmented image composited over the background; each attempt
+// gets its own file (see attemptFileName)
+const placedFileName = "placed_subject.png"
+
+// SubjectBounds is the animated subject's bounding box in the segmented image's pixels
+type SubjectBounds struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// subjectPlacement is where the segmented image goes over the background: scaled to
+// Width x Height with its top left corner at X, Y, which may be off the background
+type subjectPlacement struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ResolvePlacementConfig fills in the default fit and scale and checks the background is
+// a readable image. The fit and scale only apply over a background.
+func ResolvePlacementConfig(config types.PlacementConfig) (types.PlacementConfig, error) {
+	config.Background = strings.TrimSpace(config.Background)
+	config.SubjectFit = strings.ToLower(strings.TrimSpace(config.SubjectFit))
+	if config.Background == "" {
+		if config.SubjectFit != "" || config.SubjectScale != 0 {
+			return config, fmt.Errorf("subject_fit and subject_scale place the subject over a background; set background too")
+		}
+		return config, nil
+	}
+
+	switch config.SubjectFit {
+	case "":
+		config.SubjectFit = SubjectFitCenter
+	case SubjectFitCenter, SubjectFitFit, SubjectFitFill:
+	default:
+		return config, fmt.Errorf("unknown subject_fit %q (supported: %s, %s, %s)",
+			config.SubjectFit, SubjectFitCenter, SubjectFitFit, SubjectFitFill)
+	}
+
+	if config.SubjectScale < 0 || math.IsNaN(config.SubjectScale) || math.IsInf(config.SubjectScale, 0) {
+		return config, fmt.Errorf("subject_scale must be positive, got %g", config.SubjectScale)
+	}
+	if config.SubjectScale == 0 {
+		config.SubjectScale = 1
+	}
+
+	if _, _, err := readImageSize(config.Background); err != nil {
+		return config, fmt.Errorf("cannot read background image: %w", err)
+	}
+	return config, nil
+}
+
+// polygonSubjectBounds returns the bounding box of a person polygon clamped to a width x
+// height image, or nil when it can't be computed
+func polygonSubjectBounds(polygon []interface{}, width, height int) *SubjectBounds {
+	minX, minY, maxX, maxY, ok := polygonBounds(polygon)
+	if !ok {
+		return nil
+	}
+	if width > 0 {
+		minX, maxX = clampFloat(minX, 0, float64(width)), clampFloat(maxX, 0, float64(width))
+	}
+	if height > 0 {
+		minY, maxY = clampFloat(minY, 0, float64(height)), clampFloat(maxY, 0, float64(height))
+	}
+	x0, y0 := int(math.Max(0, math.Floor(minX))), int(math.Max(0, math.Floor(minY)))
+	x1, y1 := int(math.Ceil(maxX)), int(math.Ceil(maxY))
+	if x1 <= x0 || y1 <= y0 {
+		return nil
+	}
+	return &SubjectBounds{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
+
+// placeSubject computes where an imageWidth x imageHeight segmented image goes over a
+// backgroundWidth x backgroundHeight background so its subject, bounds, sits centered
+// at the size the fit and scale ask for. The image keeps its aspect ratio.
+func placeSubject(bounds SubjectBounds, imageWidth, imageHeight, backgroundWidth, backgroundHeight int, config types.PlacementConfig) subjectPlacement {
+	boxWidth, boxHeight := float64(bounds.Width), float64(bounds.Height)
+	scaleX, scaleY := float64(backgroundWidth)/boxWidth, float64(backgroundHeight)/boxHeight
+
+	scale := 1.0
+	switch config.SubjectFit {
+	case SubjectFitFit:
+		scale = math.Min(scaleX, scaleY)
+	case SubjectFitFill:
+		scale = math.Max(scaleX, scaleY)
+	}
+	if config.SubjectScale > 0 {
+		scale *= config.SubjectScale
+	}
+
+	centerX := (float64(bounds.X) + boxWidth/2) * scale
+	centerY := (float64(bounds.Y) + boxHeight/2) * scale
+	return subjectPlacement{
+		X:      int(math.Round(float64(backgroundWidth)/2 - centerX)),
+		Y:      int(math.Round(float64(backgroundHeight)/2 - centerY)),
+		Width:  max(1, int(math.Round(float64(imageWidth)*scale))),
+		Height: max(1, int(math.Round(float64(imageHeight)*scale))),
+	}
+}
+
+// placementArgs returns the ffmpeg arguments compositing the segmented image at
+// imagePath over the background as placement says, as a single frame the background's size
+func placementArgs(imagePath, backgroundPath, outputPath string, placement subjectPlacement) []string {
+	filter := fmt.Sprintf("[1:v]scale=%d:%d[subject];[0:v][subject]overlay=%d:%d:format=auto",
+		placement.Width, placement.Height, placement.X, placement.Y)
+	return []string{
+		"-i", backgroundPath,
+		"-i", imagePath,
+		"-filter_complex", filter,
+		"-frames:v", "1",
+		"-y", outputPath,
+	}
+}
+
+// compositeOverBackground places the segmented image at imagePath over the configured
+// background for render_motion and returns the composite's path, or imagePath when no
+// background is set, with where the subject went. The subject bounds from segmentation
+// position it; without them the whole image counts as the subject.
+func (p *Pipeline) compositeOverBackground(ctx context.Context, manifest *Manifest, imagePath string) (string, *subjectPlacement, error) {
+	config := p.placementConfig
+	if config.Background == "" {
+		return imagePath, nil, nil
+	}
+	if imagePath == manifest.Input.ImagePath {
+		log.Printf("Warning: no segmented person to place over the background, animating the original image")
+		return imagePath, nil, nil
+	}
+
+	imageWidth, imageHeight, err := readImageSize(imagePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot read the segmented image size for placement: %w", err)
+	}
+	backgroundWidth, backgroundHeight, err := readImageSize(config.Background)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot read background image: %w", err)
+	}
+	bounds := SubjectBounds{Width: imageWidth, Height: imageHeight}
+	if manifest.Result.SubjectBounds != nil {
+		bounds = *manifest.Result.SubjectBounds
+	} else {
+		log.Printf("Warning: no subject bounds from segmentation, placing the whole segmented image")
+	}
+
+	placement := placeSubject(bounds, imageWidth, imageHeight, backgroundWidth, backgroundHeight, config)
+	outputPath, err := stageArtifactPath(manifest, types.StageRenderMotion, manifest.Input.TempDir, placedFileName)
+	if err != nil {
+		return "", nil, err
+	}
+	cmd := procgroup.CommandContext(ctx, "ffmpeg", placementArgs(imagePath, config.Background, outputPath, placement)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		return "", nil, fmt.Errorf("ffmpeg subject placement failed: %w, output: %s", err, output)
+	}
+
+	log.Printf("Placed the subject (%s, scale %.2f) at %d,%d as %dx%d over the %dx%d background",
+		config.SubjectFit, config.SubjectScale, placement.X, placement.Y, placement.Width, placement.Height,
+		backgroundWidth, backgroundHeight)
+	manifest.Result.PlacedImagePath = outputPath
+	cleanSupersededAttempts(manifest.Input.TempDir, placedFileName, outputPath)
+	return outputPath, &placement, nil
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolvePlacementConfig(t *testing.T) {
+	background := filepath.Join(t.TempDir(), "beach.png")
+	writePNG(t, background, 160, 90)
+
+	tests := []struct {
+		name      string
+		config    types.PlacementConfig
+		expected  types.PlacementConfig
+		expectErr bool
+	}{
+		{name: "empty keeps the segmented image", config: types.PlacementConfig{}, expected: types.PlacementConfig{}},
+		{
+			name:     "defaults",
+			config:   types.PlacementConfig{Background: background},
+			expected: types.PlacementConfig{Background: background, SubjectFit: SubjectFitCenter, SubjectScale: 1},
+		},
+		{
+			name:     "fit normalized",
+			config:   types.PlacementConfig{Background: background, SubjectFit: " Fill ", SubjectScale: 0.8},
+			expected: types.PlacementConfig{Background: background, SubjectFit: SubjectFitFill, SubjectScale: 0.8},
+		},
+		{name: "fit without background", config: types.PlacementConfig{SubjectFit: "fit"}, expectErr: true},
+		{name: "scale without background", config: types.PlacementConfig{SubjectScale: 2}, expectErr: true},
+		{name: "unknown fit", config: types.PlacementConfig{Background: background, SubjectFit: "stretch"}, expectErr: true},
+		{name: "negative scale", config: types.PlacementConfig{Background: background, SubjectScale: -1}, expectErr: true},
+		{name: "missing background", config: types.PlacementConfig{Background: filepath.Join(t.TempDir(), "missing.png")}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolvePlacementConfig(tt.config)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolvePlacementConfig failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPolygonSubjectBounds(t *testing.T) {
+	polygon := []interface{}{
+		[]interface{}{10.4, 20.0}, []interface{}{50.0, 15.5}, []interface{}{120.0, 90.0}, []interface{}{-5.0, 60.0},
+	}
+	expected := &SubjectBounds{X: 0, Y: 15, Width: 100, Height: 65}
+	if got := polygonSubjectBounds(polygon, 100, 80); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v clamped to the image, got %+v", expected, got)
+	}
+	if got := polygonSubjectBounds([]interface{}{[]interface{}{"x", 1.0}}, 100, 80); got != nil {
+		t.Errorf("Expected no bounds for a malformed polygon, got %+v", got)
+	}
+}
+
+// TestPlaceSubject verifies the subject's bounding box, not the whole segmented image,
+// is sized by the fit and centered on a background of a different aspect ratio
+func TestPlaceSubject(t *testing.T) {
+	// A 400x300 segmented image with the person in a 100x200 box left of center
+	bounds := SubjectBounds{X: 50, Y: 50, Width: 100, Height: 200}
+
+	tests := []struct {
+		name     string
+		config   types.PlacementConfig
+		expected subjectPlacement
+	}{
+		{
+			name:     "center keeps the size",
+			config:   types.PlacementConfig{SubjectFit: SubjectFitCenter, SubjectScale: 1},
+			expected: subjectPlacement{X: 860, Y: 390, Width: 400, Height: 300},
+		},
+		{
+			name:     "fit to the background height",
+			config:   types.PlacementConfig{SubjectFit: SubjectFitFit, SubjectScale: 1},
+			expected: subjectPlacement{X: 420, Y: -270, Width: 2160, Height: 1620},
+		},
+		{
+			name:     "fill the background width",
+			config:   types.PlacementConfig{SubjectFit: SubjectFitFill, SubjectScale: 1},
+			expected: subjectPlacement{X: -960, Y: -2340, Width: 7680, Height: 5760},
+		},
+		{
+			name:     "scaled fit",
+			config:   types.PlacementConfig{SubjectFit: SubjectFitFit, SubjectScale: 0.5},
+			expected: subjectPlacement{X: 690, Y: 135, Width: 1080, Height: 810},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := placeSubject(bounds, 400, 300, 1920, 1080, tt.config)
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPlacementArgs(t *testing.T) {
+	args := placementArgs("/tmp/segmented.png", "/bg/beach.jpg", "/tmp/placed.png", subjectPlacement{X: -10, Y: 20, Width: 640, Height: 480})
+	joined := strings.Join(args, " ")
+	for _, want := range []string{
+		"-i /bg/beach.jpg -i /tmp/segmented.png",
+		"[1:v]scale=640:480[subject];[0:v][subject]overlay=-10:20:format=auto",
+		"-frames:v 1 -y /tmp/placed.png",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected %q in %s", want, joined)
+		}
+	}
+}
+
+// TestCompositeOverBackgroundSkipped verifies nothing is composited without a background
+// or a segmented person
+func TestCompositeOverBackgroundSkipped(t *testing.T) {
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 1, "", "lightweight")
+	manifest := NewManifest("placement-test", types.PipelineInput{ImagePath: "/in/photo.png", TempDir: t.TempDir()})
+	manifest.Result = &PipelineResult{}
+
+	if path, placement, err := p.compositeOverBackground(context.Background(), manifest, "/tmp/segmented.png"); err != nil || path != "/tmp/segmented.png" || placement != nil {
+		t.Errorf("Expected the segmented image without a background, got %s %+v (%v)", path, placement, err)
+	}
+
+	p.SetPlacementConfig(types.PlacementConfig{Background: "/bg/beach.png", SubjectFit: SubjectFitFit, SubjectScale: 1})
+	if path, placement, err := p.compositeOverBackground(context.Background(), manifest, "/in/photo.png"); err != nil || path != "/in/photo.png" || placement != nil {
+		t.Errorf("Expected the original image when segmentation was skipped, got %s %+v (%v)", path, placement, err)
+	}
+}
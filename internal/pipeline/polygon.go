@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// minPolygonPoints is the fewest points a simplified polygon keeps
+const minPolygonPoints = 3
+
+// polygonSimplifySteps bounds the bisection for the Douglas-Peucker tolerance
+const polygonSimplifySteps = 40
+
+// minPolygonArea is the smallest area, in square pixels, of a polygon worth filling
+const minPolygonArea = 1.0
+
+// ErrDegeneratePolygon is returned when a detected outline isn't a list of points, or
+// has too few distinct points or too little area to fill
+var ErrDegeneratePolygon = errors.New("degenerate person polygon")
+
+// ValidateMaxPolygonPoints validates a max_polygon_points setting; 0 disables simplification
+func ValidateMaxPolygonPoints(maxPoints int) error {
+	if maxPoints != 0 && maxPoints < minPolygonPoints {
+		return fmt.Errorf("max_polygon_points %d must be 0 (no limit) or at least %d", maxPoints, minPolygonPoints)
+	}
+	return nil
+}
+
+// SetMaxPolygonPoints caps the points of each person polygon handed to the fill tool.
+// Longer polygons are simplified with Douglas-Peucker first; 0 disables. Validate it
+// with ValidateMaxPolygonPoints first.
+func (p *Pipeline) SetMaxPolygonPoints(maxPoints int) {
+	p.maxPolygonPoints = maxPoints
+}
+
+// point is a polygon vertex in image pixels
+type point struct{ x, y float64 }
+
+// simplifyPolygon reduces a polygon of [x, y] points to at most maxPoints with the
+// smallest Douglas-Peucker tolerance that gets there, so the outline moves as little
+// as possible. Polygons already within the limit, or that aren't lists of [x, y]
+// points, are returned unchanged; maxPoints 0 disables.
+func simplifyPolygon(polygon []interface{}, maxPoints int) []interface{} {
+	if maxPoints <= 0 || len(polygon) <= maxPoints {
+		return polygon
+	}
+	maxPoints = max(maxPoints, minPolygonPoints)
+
+	points, ok := polygonPoints(polygon)
+	if !ok {
+		return polygon
+	}
+
+	// The kept points only shrink as the tolerance grows: bisect for the smallest one
+	// that fits. A tolerance of the bounding box's diagonal keeps just the ring's anchors.
+	minX, minY, maxX, maxY, _ := polygonBounds(polygon)
+	low, high := 0.0, math.Hypot(maxX-minX, maxY-minY)
+	best := simplifyRing(points, high)
+	for i := 0; i < polygonSimplifySteps; i++ {
+		tolerance := (low + high) / 2
+		kept := simplifyRing(points, tolerance)
+		if len(kept) <= maxPoints {
+			best, high = kept, tolerance
+		} else {
+			low = tolerance
+		}
+	}
+
+	// Degenerate outlines (all points on a line) can collapse below a polygon
+	if len(best) < minPolygonPoints {
+		best = samplePoints(points, maxPoints)
+	}
+
+	simplified := make([]interface{}, len(best))
+	for i, pt := range best {
+		simplified[i] = []interface{}{pt.x, pt.y}
+	}
+	return simplified
+}
+
+// sanitizePolygon normalizes a detected polygon of [x, y] points for the fill tool: points
+// are clamped to a width x height image, when its size is known, then consecutive
+// duplicates and a repeated closing point are dropped. Outlines the fill tool can't use
+// fail with ErrDegeneratePolygon.
+func sanitizePolygon(polygon []interface{}, width, height int) ([]interface{}, error) {
+	points, ok := polygonPoints(polygon)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a list of [x, y] points", ErrDegeneratePolygon)
+	}
+
+	cleaned := make([]point, 0, len(points))
+	for _, pt := range points {
+		if width > 0 && height > 0 {
+			pt = point{clampFloat(pt.x, 0, float64(width)), clampFloat(pt.y, 0, float64(height))}
+		}
+		if len(cleaned) > 0 && cleaned[len(cleaned)-1] == pt {
+			continue
+		}
+		cleaned = append(cleaned, pt)
+	}
+	for len(cleaned) > 1 && cleaned[len(cleaned)-1] == cleaned[0] {
+		cleaned = cleaned[:len(cleaned)-1]
+	}
+
+	if len(cleaned) < minPolygonPoints {
+		return nil, fmt.Errorf("%w: %d distinct points", ErrDegeneratePolygon, len(cleaned))
+	}
+	if area := ringArea(cleaned); area < minPolygonArea {
+		return nil, fmt.Errorf("%w: encloses %.2f square pixels", ErrDegeneratePolygon, area)
+	}
+
+	sanitized := make([]interface{}, len(cleaned))
+	for i, pt := range cleaned {
+		sanitized[i] = []interface{}{pt.x, pt.y}
+	}
+	return sanitized, nil
+}
+
+// sanitizePersons sanitizes the polygon of each person, dropping those whose outline is
+// degenerate. It fails when no person is left.
+func sanitizePersons(persons []personDetection, width, height int) ([]personDetection, error) {
+	var kept []personDetection
+	var firstErr error
+	for i, person := range persons {
+		polygon, err := sanitizePolygon(person.polygon, width, height)
+		if err != nil {
+			log.Printf("Warning: ignoring person %d: %v", i+1, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if removed := len(person.polygon) - len(polygon); removed > 0 {
+			log.Printf("Removed %d duplicate points from person %d's polygon", removed, i+1)
+		}
+		person.polygon = polygon
+		kept = append(kept, person)
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no usable person polygon: %w", firstErr)
+	}
+	return kept, nil
+}
+
+// ringArea returns the area enclosed by a closed ring with the shoelace formula
+func ringArea(points []point) float64 {
+	sum := 0.0
+	for i, pt := range points {
+		next := points[(i+1)%len(points)]
+		sum += pt.x*next.y - next.x*pt.y
+	}
+	return math.Abs(sum) / 2
+}
+
+// polygonPoints converts a polygon of [x, y] points
+func polygonPoints(polygon []interface{}) ([]point, bool) {
+	points := make([]point, len(polygon))
+	for i, raw := range polygon {
+		coords, isList := raw.([]interface{})
+		if !isList || len(coords) < 2 {
+			return nil, false
+		}
+		x, xOK := coords[0].(float64)
+		y, yOK := coords[1].(float64)
+		if !xOK || !yOK {
+			return nil, false
+		}
+		points[i] = point{x, y}
+	}
+	return points, true
+}
+
+// simplifyRing runs Douglas-Peucker on a closed ring: it is split at the first point and
+// the point farthest from it, and both halves are simplified as polylines
+func simplifyRing(points []point, tolerance float64) []point {
+	far, farthest := 0, -1.0
+	for i, pt := range points {
+		if d := math.Hypot(pt.x-points[0].x, pt.y-points[0].y); d > farthest {
+			far, farthest = i, d
+		}
+	}
+	if far == 0 {
+		return points[:1]
+	}
+
+	closed := append(append([]point{}, points...), points[0])
+	first := simplifyPolyline(closed[:far+1], tolerance)
+	second := simplifyPolyline(closed[far:], tolerance)
+	// Both halves share the split point, and the second ends where the ring started
+	return append(first, second[1:len(second)-1]...)
+}
+
+// simplifyPolyline is the Douglas-Peucker algorithm: it keeps the end points and,
+// recursively, the point farthest from the line between them while it is farther
+// than tolerance
+func simplifyPolyline(points []point, tolerance float64) []point {
+	if len(points) < 3 {
+		return append([]point{}, points...)
+	}
+
+	start, end := points[0], points[len(points)-1]
+	index, farthest := 0, -1.0
+	for i := 1; i < len(points)-1; i++ {
+		if d := segmentDistance(points[i], start, end); d > farthest {
+			index, farthest = i, d
+		}
+	}
+	if farthest <= tolerance {
+		return []point{start, end}
+	}
+
+	left := simplifyPolyline(points[:index+1], tolerance)
+	right := simplifyPolyline(points[index:], tolerance)
+	return append(left[:len(left)-1], right...)
+}
+
+// segmentDistance returns the distance from pt to the segment between a and b
+func segmentDistance(pt, a, b point) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(pt.x-a.x, pt.y-a.y)
+	}
+	t := math.Max(0, math.Min(1, ((pt.x-a.x)*dx+(pt.y-a.y)*dy)/lengthSquared))
+	return math.Hypot(pt.x-(a.x+t*dx), pt.y-(a.y+t*dy))
+}
+
+// samplePoints keeps n points spread evenly along points
+func samplePoints(points []point, n int) []point {
+	sampled := make([]point, n)
+	for i := range sampled {
+		sampled[i] = points[i*len(points)/n]
+	}
+	return sampled
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// circlePolygon returns n points on a circle of radius r around (cx, cy)
+func circlePolygon(n int, cx, cy, r float64) []interface{} {
+	polygon := make([]interface{}, n)
+	for i := range polygon {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		polygon[i] = []interface{}{cx + r*math.Cos(angle), cy + r*math.Sin(angle)}
+	}
+	return polygon
+}
+
+// TestSimplifyPolygon verifies detailed polygons are reduced to at most the limit while
+// keeping their outline, and others are left alone
+func TestSimplifyPolygon(t *testing.T) {
+	detailed := circlePolygon(2000, 500, 400, 300)
+
+	tests := []struct {
+		name      string
+		polygon   []interface{}
+		maxPoints int
+		unchanged bool
+	}{
+		{name: "simplified", polygon: detailed, maxPoints: 64},
+		{name: "minimal limit", polygon: detailed, maxPoints: 3},
+		{name: "disabled", polygon: detailed, maxPoints: 0, unchanged: true},
+		{name: "within limit", polygon: circlePolygon(40, 0, 0, 10), maxPoints: 64, unchanged: true},
+		{name: "malformed", polygon: []interface{}{[]interface{}{1.0}, "x", []interface{}{2.0, 3.0}, []interface{}{4.0, 5.0}}, maxPoints: 3, unchanged: true},
+		{name: "collinear", polygon: []interface{}{
+			[]interface{}{0.0, 0.0}, []interface{}{1.0, 0.0}, []interface{}{2.0, 0.0}, []interface{}{3.0, 0.0}, []interface{}{4.0, 0.0},
+		}, maxPoints: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simplified := simplifyPolygon(tt.polygon, tt.maxPoints)
+			if tt.unchanged {
+				if !reflect.DeepEqual(simplified, tt.polygon) {
+					t.Errorf("Expected the polygon unchanged, got %d points", len(simplified))
+				}
+				return
+			}
+			if len(simplified) > tt.maxPoints || len(simplified) < minPolygonPoints {
+				t.Fatalf("Expected %d-%d points, got %d", minPolygonPoints, tt.maxPoints, len(simplified))
+			}
+
+			// Every kept point is one of the originals
+			original := make(map[point]bool)
+			points, _ := polygonPoints(tt.polygon)
+			for _, pt := range points {
+				original[pt] = true
+			}
+			kept, ok := polygonPoints(simplified)
+			if !ok {
+				t.Fatalf("Expected [x, y] points, got %v", simplified)
+			}
+			for _, pt := range kept {
+				if !original[pt] {
+					t.Errorf("Point %v is not on the original polygon", pt)
+				}
+			}
+		})
+	}
+
+	// 64 points keep a radius-300 circle's outline within a few pixels
+	minX, minY, maxX, maxY, _ := polygonBounds(simplifyPolygon(detailed, 64))
+	if math.Abs(minX-200) > 3 || math.Abs(maxX-800) > 3 || math.Abs(minY-100) > 3 || math.Abs(maxY-700) > 3 {
+		t.Errorf("Expected the circle's bounds kept, got (%.1f, %.1f)-(%.1f, %.1f)", minX, minY, maxX, maxY)
+	}
+}
+
+// TestValidateMaxPolygonPoints verifies the limit is 0 or enough points for a polygon
+func TestValidateMaxPolygonPoints(t *testing.T) {
+	for maxPoints, valid := range map[int]bool{0: true, 3: true, 500: true, 2: false, -1: false} {
+		if err := ValidateMaxPolygonPoints(maxPoints); (err == nil) != valid {
+			t.Errorf("max_polygon_points %d: expected valid %v, got %v", maxPoints, valid, err)
+		}
+	}
+}
+
+// pts builds a polygon from x, y pairs
+func pts(coords ...float64) []interface{} {
+	polygon := make([]interface{}, 0, len(coords)/2)
+	for i := 0; i+1 < len(coords); i += 2 {
+		polygon = append(polygon, []interface{}{coords[i], coords[i+1]})
+	}
+	return polygon
+}
+
+// TestSanitizePolygon verifies malformed detect outlines are repaired or rejected
+func TestSanitizePolygon(t *testing.T) {
+	tests := []struct {
+		name     string
+		polygon  []interface{}
+		expected []interface{} // nil when the polygon is rejected
+	}{
+		{name: "clean", polygon: pts(0, 0, 10, 0, 10, 10), expected: pts(0, 0, 10, 0, 10, 10)},
+		{name: "consecutive duplicates", polygon: pts(0, 0, 0, 0, 10, 0, 10, 0, 10, 10), expected: pts(0, 0, 10, 0, 10, 10)},
+		{name: "closing point", polygon: pts(0, 0, 10, 0, 10, 10, 0, 0), expected: pts(0, 0, 10, 0, 10, 10)},
+		{name: "out of bounds", polygon: pts(-5, -5, 150, 0, 50, 120), expected: pts(0, 0, 100, 0, 50, 80)},
+		{name: "clamping merges points", polygon: pts(0, 0, 120, 10, 130, 10, 50, 50), expected: pts(0, 0, 100, 10, 50, 50)},
+		{name: "two points", polygon: pts(0, 0, 10, 10)},
+		{name: "duplicates of too few points", polygon: pts(5, 5, 5, 5, 6, 6, 5, 5)},
+		{name: "collinear", polygon: pts(0, 0, 5, 5, 10, 10)},
+		{name: "outside the image", polygon: pts(200, 200, 300, 200, 300, 300)},
+		{name: "not points", polygon: []interface{}{[]interface{}{1.0}, "x", []interface{}{2.0, 3.0}}},
+		{name: "empty", polygon: []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sanitized, err := sanitizePolygon(tt.polygon, 100, 80)
+			if tt.expected == nil {
+				if !errors.Is(err, ErrDegeneratePolygon) {
+					t.Errorf("Expected ErrDegeneratePolygon, got %v (%v)", err, sanitized)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(sanitized, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, sanitized)
+			}
+		})
+	}
+}
+
+// TestSanitizePolygonUnknownSize verifies points aren't clamped when the image size is unknown
+func TestSanitizePolygonUnknownSize(t *testing.T) {
+	polygon := pts(-5, -5, 150, 0, 50, 120)
+	sanitized, err := sanitizePolygon(polygon, 0, 0)
+	if err != nil || !reflect.DeepEqual(sanitized, polygon) {
+		t.Errorf("Expected %v unchanged, got %v (err: %v)", polygon, sanitized, err)
+	}
+}
+
+// TestSanitizePersons verifies degenerate people are dropped and an error is returned
+// only when nobody is left
+func TestSanitizePersons(t *testing.T) {
+	persons := []personDetection{
+		{polygon: pts(0, 0, 1, 1), score: 0.9},
+		{polygon: pts(0, 0, 10, 0, 10, 10), score: 0.7},
+	}
+	kept, err := sanitizePersons(persons, 100, 100)
+	if err != nil || len(kept) != 1 || kept[0].score != 0.7 {
+		t.Fatalf("Expected only the valid person kept, got %+v (err: %v)", kept, err)
+	}
+
+	if _, err := sanitizePersons(persons[:1], 100, 100); !errors.Is(err, ErrDegeneratePolygon) {
+		t.Errorf("Expected ErrDegeneratePolygon with no valid person, got %v", err)
+	}
+}
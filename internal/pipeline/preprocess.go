@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+)
+
+// DefaultJPEGQuality is the encoding quality of JPEG working copies when none is set
+const DefaultJPEGQuality = 85
+
+// ResolveJPEGQuality validates a jpeg_quality setting; 0 selects DefaultJPEGQuality
+func ResolveJPEGQuality(quality int) (int, error) {
+	switch {
+	case quality == 0:
+		return DefaultJPEGQuality, nil
+	case quality < 1 || quality > 100:
+		return 0, fmt.Errorf("jpeg_quality %d out of range (1-100)", quality)
+	default:
+		return quality, nil
+	}
+}
+
+// jpegQScale maps a 1-100 quality onto ffmpeg's JPEG -q:v scale, where 2 is the best
+// and 31 the worst
+func jpegQScale(quality int) int {
+	if quality <= 0 {
+		quality = DefaultJPEGQuality
+	}
+	if quality > 100 {
+		quality = 100
+	}
+	return 2 + (100-quality)*29/99
+}
+
+// isJPEG reports whether path has a JPEG file extension
+func isJPEG(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// ProcessImage describes the working copy of the input image used for tool calls
+type ProcessImage struct {
+	Path           string  `json:"path"`
+	OriginalWidth  int     `json:"original_width"`
+	OriginalHeight int     `json:"original_height"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	ScaleFactor    float64 `json:"scale_factor"` // Working size divided by original size (1.0 when not resized)
+}
+
+// ToOriginal maps a coordinate on the working copy back to the original image
+func (pi *ProcessImage) ToOriginal(x, y float64) (float64, float64) {
+	if pi == nil || pi.ScaleFactor <= 0 {
+		return x, y
+	}
+	return x / pi.ScaleFactor, y / pi.ScaleFactor
+}
+
+// fitDimensions scales width and height down so the longest side is at most maxDimension.
+// Returns the original size and a scale of 1.0 if no resize is needed.
+func fitDimensions(width, height, maxDimension int) (int, int, float64) {
+	longest := width
+	if height > longest {
+		longest = height
+	}
+	if maxDimension <= 0 || longest <= maxDimension {
+		return width, height, 1.0
+	}
+
+	scale := float64(maxDimension) / float64(longest)
+	newWidth := int(math.Max(1, math.Round(float64(width)*scale)))
+	newHeight := int(math.Max(1, math.Round(float64(height)*scale)))
+	return newWidth, newHeight, scale
+}
+
+// prepareProcessImage returns the image path to hand to the segment and landmark tools.
+// Inputs with unusual names are first copied to a sanitized name. Images larger than the configured max dimension are downscaled into TempDir; the
+// original stays in the manifest input. The result is recorded on the manifest so
+// resumed runs reuse the same working copy.
+func prepareProcessImage(ctx context.Context, p *Pipeline, manifest *Manifest) (string, error) {
+	originalPath, err := toolInputPath(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	if p.maxProcessDimension <= 0 {
+		return originalPath, nil
+	}
+
+	if pi := manifest.ProcessImage; pi != nil {
+		if _, err := os.Stat(pi.Path); err == nil {
+			return pi.Path, nil
+		}
+	}
+
+	width, height, err := readImageSize(originalPath)
+	if err != nil {
+		log.Printf("Warning: cannot read image size, using original for processing: %v", err)
+		return originalPath, nil
+	}
+
+	newWidth, newHeight, scale := fitDimensions(width, height, p.maxProcessDimension)
+	pi := &ProcessImage{
+		Path:           originalPath,
+		OriginalWidth:  width,
+		OriginalHeight: height,
+		Width:          newWidth,
+		Height:         newHeight,
+		ScaleFactor:    scale,
+	}
+
+	if scale < 1.0 {
+		// JPEG inputs stay JPEG so the working copy doesn't grow; others keep a lossless PNG
+		outputName := "process_input.png"
+		if isJPEG(originalPath) {
+			outputName = "process_input.jpg"
+		}
+		outputPath, err := filepath.Abs(filepath.Join(manifest.Input.TempDir, outputName))
+		if err != nil {
+			return "", fmt.Errorf("failed to get absolute output path: %w", err)
+		}
+
+		log.Printf("Downscaling %dx%d image to %dx%d for processing (scale %.3f)",
+			width, height, newWidth, newHeight, scale)
+
+		partialOutputPath := partialPath(outputPath)
+		args := downscaleArgs(originalPath, partialOutputPath, newWidth, newHeight, p.jpegQuality)
+		cmd := procgroup.CommandContext(ctx, "ffmpeg", args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			os.Remove(partialOutputPath)
+			return "", fmt.Errorf("ffmpeg downscale failed: %w, output: %s", err, output)
+		}
+		if err := commitArtifact(partialOutputPath, outputPath); err != nil {
+			return "", err
+		}
+		pi.Path = outputPath
+	}
+
+	manifest.ProcessImage = pi
+	return pi.Path, nil
+}
+
+// downscaleArgs builds the ffmpeg arguments that scale inputPath to width x height.
+// JPEG outputs are encoded at quality.
+func downscaleArgs(inputPath, outputPath string, width, height, quality int) []string {
+	args := []string{
+		"-i", inputPath,
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+	}
+	if isJPEG(outputPath) {
+		args = append(args, "-q:v", fmt.Sprint(jpegQScale(quality)))
+	}
+	return append(args, "-y", outputPath)
+}
+
+// readImageSize decodes only the image header to get its dimensions
+func readImageSize(path string) (int, int, error) {
+	info, err := decodeImageInfo(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Width, info.Height, nil
+}
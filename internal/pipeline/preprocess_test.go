@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestFitDimensions verifies the longest side is clamped while keeping aspect ratio
+func TestFitDimensions(t *testing.T) {
+	tests := []struct {
+		name           string
+		width, height  int
+		maxDimension   int
+		expectedWidth  int
+		expectedHeight int
+		expectedScale  float64
+	}{
+		{name: "disabled", width: 8000, height: 6000, maxDimension: 0, expectedWidth: 8000, expectedHeight: 6000, expectedScale: 1.0},
+		{name: "within limit", width: 1024, height: 768, maxDimension: 2048, expectedWidth: 1024, expectedHeight: 768, expectedScale: 1.0},
+		{name: "landscape", width: 8000, height: 6000, maxDimension: 2000, expectedWidth: 2000, expectedHeight: 1500, expectedScale: 0.25},
+		{name: "portrait", width: 3000, height: 6000, maxDimension: 1500, expectedWidth: 750, expectedHeight: 1500, expectedScale: 0.25},
+		{name: "thin strip keeps one pixel", width: 10000, height: 1, maxDimension: 100, expectedWidth: 100, expectedHeight: 1, expectedScale: 0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, scale := fitDimensions(tt.width, tt.height, tt.maxDimension)
+			if width != tt.expectedWidth || height != tt.expectedHeight || scale != tt.expectedScale {
+				t.Errorf("Expected %dx%d (scale %v), got %dx%d (scale %v)",
+					tt.expectedWidth, tt.expectedHeight, tt.expectedScale, width, height, scale)
+			}
+		})
+	}
+}
+
+// TestProcessImageToOriginal verifies working-copy coordinates map back to the original
+func TestProcessImageToOriginal(t *testing.T) {
+	pi := &ProcessImage{ScaleFactor: 0.25}
+	x, y := pi.ToOriginal(100, 50)
+	if x != 400 || y != 200 {
+		t.Errorf("Expected (400, 200), got (%v, %v)", x, y)
+	}
+
+	var missing *ProcessImage
+	x, y = missing.ToOriginal(100, 50)
+	if x != 100 || y != 50 {
+		t.Errorf("Expected coordinates unchanged, got (%v, %v)", x, y)
+	}
+}
+
+// TestPrepareProcessImageWithinLimit verifies small images are used as-is and recorded
+func TestPrepareProcessImageWithinLimit(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "small.png")
+
+	file, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	if err := png.Encode(file, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	file.Close()
+
+	p := &Pipeline{}
+	p.SetMaxProcessDimension(64)
+	manifest := NewManifest("test", types.PipelineInput{ImagePath: imagePath, TempDir: dir})
+
+	path, err := prepareProcessImage(context.Background(), p, manifest)
+	if err != nil {
+		t.Fatalf("prepareProcessImage failed: %v", err)
+	}
+	if path != imagePath {
+		t.Errorf("Expected original path %s, got %s", imagePath, path)
+	}
+
+	pi := manifest.ProcessImage
+	if pi == nil {
+		t.Fatal("Expected process image to be recorded")
+	}
+	if pi.OriginalWidth != 40 || pi.OriginalHeight != 30 || pi.ScaleFactor != 1.0 {
+		t.Errorf("Unexpected process image: %+v", pi)
+	}
+}
+
+func TestResolveJPEGQuality(t *testing.T) {
+	tests := []struct {
+		quality   int
+		expected  int
+		expectErr bool
+	}{
+		{0, DefaultJPEGQuality, false},
+		{1, 1, false},
+		{60, 60, false},
+		{100, 100, false},
+		{-5, 0, true},
+		{101, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveJPEGQuality(tt.quality)
+		if (err != nil) != tt.expectErr || got != tt.expected {
+			t.Errorf("ResolveJPEGQuality(%d) = %d, %v; want %d (error %v)", tt.quality, got, err, tt.expected, tt.expectErr)
+		}
+	}
+}
+
+// TestDownscaleArgs verifies only JPEG outputs get a quality setting
+func TestDownscaleArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		quality  int
+		expected []string
+	}{
+		{"png", "/tmp/process_input.partial.png", 60, []string{"-i", "in.jpg", "-vf", "scale=200:100", "-y", "/tmp/process_input.partial.png"}},
+		{"jpeg best", "/tmp/process_input.partial.jpg", 100, []string{"-i", "in.jpg", "-vf", "scale=200:100", "-q:v", "2", "-y", "/tmp/process_input.partial.jpg"}},
+		{"jpeg worst", "/tmp/process_input.partial.jpg", 1, []string{"-i", "in.jpg", "-vf", "scale=200:100", "-q:v", "31", "-y", "/tmp/process_input.partial.jpg"}},
+		{"jpeg default", "/tmp/process_input.partial.jpg", 0, []string{"-i", "in.jpg", "-vf", "scale=200:100", "-q:v", "6", "-y", "/tmp/process_input.partial.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := downscaleArgs("in.jpg", tt.output, 200, 100, tt.quality)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || openbsd || dragonfly) && !windows
+
+package pipeline
+
+// processAlive can't check processes here, so owners are assumed alive and only the
+// age of a running stage marks it orphaned
+func processAlive(pid int) bool {
+	return pid > 0
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || openbsd || dragonfly
+
+package pipeline
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// processAlive reports whether a process with pid exists. EPERM means it exists but
+// belongs to another user.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
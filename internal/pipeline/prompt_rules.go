@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// PromptRulesModel names the rule-based prompt interpreter as the model of the analysis
+// it stores in lightweight runs
+const PromptRulesModel = "rules"
+
+// Intensity adjectives the prompt rules recognize
+const (
+	PromptIntensityGentle = "gentle"
+	PromptIntensityStrong = "strong"
+)
+
+// promptIntensityScale multiplies the default intensity of the animation for each
+// intensity adjective
+var promptIntensityScale = map[string]float64{
+	PromptIntensityGentle: 0.5,
+	PromptIntensityStrong: 1.8,
+}
+
+// promptAnimationWords maps words naming an animation to its type
+var promptAnimationWords = map[string]string{
+	"nod": AnimationNod, "nods": AnimationNod, "nodding": AnimationNod,
+	"shake": AnimationShake, "shakes": AnimationShake, "shaking": AnimationShake, "wiggle": AnimationShake,
+	"rotate": AnimationRotate, "rotates": AnimationRotate, "rotating": AnimationRotate, "rotation": AnimationRotate,
+	"tilt": AnimationRotate, "sway": AnimationRotate, "swaying": AnimationRotate,
+	"zoom": AnimationZoom, "zooms": AnimationZoom, "zooming": AnimationZoom,
+}
+
+// promptMoodWords maps mood words to the music mood searched for
+var promptMoodWords = map[string]string{
+	"happy": "happy", "joyful": "happy", "cheerful": "happy",
+	"sad": "sad", "melancholy": "sad", "gloomy": "sad",
+	"calm": "calm", "relaxed": "calm", "peaceful": "calm", "chill": "calm",
+	"energetic": "energetic", "upbeat": "energetic", "exciting": "energetic",
+	"epic": "epic", "dramatic": "epic", "cinematic": "epic",
+	"romantic": "romantic", "funny": "funny", "silly": "funny", "playful": "funny",
+}
+
+// promptIntensityWords maps intensity adjectives and adverbs to their intensity
+var promptIntensityWords = map[string]string{
+	"slow": PromptIntensityGentle, "slowly": PromptIntensityGentle, "gentle": PromptIntensityGentle,
+	"gently": PromptIntensityGentle, "subtle": PromptIntensityGentle, "slight": PromptIntensityGentle,
+	"slightly": PromptIntensityGentle, "soft": PromptIntensityGentle, "small": PromptIntensityGentle,
+	"strong": PromptIntensityStrong, "strongly": PromptIntensityStrong, "big": PromptIntensityStrong,
+	"wild": PromptIntensityStrong, "wildly": PromptIntensityStrong, "intense": PromptIntensityStrong,
+	"vigorous": PromptIntensityStrong, "vigorously": PromptIntensityStrong, "crazy": PromptIntensityStrong,
+	"fast": PromptIntensityStrong, "huge": PromptIntensityStrong,
+}
+
+// promptNegations make the rules ignore the animation named right after them
+var promptNegations = map[string]bool{"no": true, "not": true, "without": true, "dont": true}
+
+// promptNoMusicPhrases turn the music off
+var promptNoMusicPhrases = []string{
+	"no music", "without music", "no soundtrack", "without soundtrack",
+	"no audio", "without audio", "no sound", "silent", "muted",
+}
+
+// PromptOverrides is what the rule-based interpreter understood of a user prompt. Lightweight
+// runs, where no LLM reads the prompt, apply it over the default decision.
+type PromptOverrides struct {
+	Animations []string // Animation types in the order named; empty keeps the default
+	Mood       string   // Music mood; empty keeps the default
+	NoMusic    bool     // The prompt asked for no music
+	Intensity  string   // PromptIntensityGentle or PromptIntensityStrong; empty keeps the default
+}
+
+// InterpretPrompt matches keywords in a user prompt: animation types, mood words,
+// "no music" and intensity adjectives. Words it doesn't know are ignored.
+func InterpretPrompt(prompt string) PromptOverrides {
+	words := promptWords(prompt)
+	joined := " " + strings.Join(words, " ") + " "
+
+	var overrides PromptOverrides
+	for i, word := range words {
+		if animation, ok := promptAnimationWords[word]; ok {
+			negated := i > 0 && promptNegations[words[i-1]]
+			last := len(overrides.Animations) - 1
+			if !negated && (last < 0 || overrides.Animations[last] != animation) {
+				overrides.Animations = append(overrides.Animations, animation)
+			}
+		}
+		if mood, ok := promptMoodWords[word]; ok && overrides.Mood == "" {
+			overrides.Mood = mood
+		}
+		if intensity, ok := promptIntensityWords[word]; ok && overrides.Intensity == "" {
+			overrides.Intensity = intensity
+		}
+	}
+	for _, phrase := range promptNoMusicPhrases {
+		if strings.Contains(joined, " "+phrase+" ") {
+			overrides.NoMusic = true
+			break
+		}
+	}
+	return overrides
+}
+
+// promptWords splits a prompt into lower-case words, dropping apostrophes so "don't"
+// reads as "dont"
+func promptWords(prompt string) []string {
+	prompt = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(prompt))
+	return strings.FieldsFunc(prompt, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// IsEmpty reports whether the prompt changed nothing
+func (o PromptOverrides) IsEmpty() bool {
+	return len(o.Animations) == 0 && o.Mood == "" && !o.NoMusic && o.Intensity == ""
+}
+
+// String describes the overrides for the log, e.g. "animation=nod, mood=sad, music=off"
+func (o PromptOverrides) String() string {
+	var parts []string
+	if len(o.Animations) > 0 {
+		parts = append(parts, "animation="+strings.Join(o.Animations, "+"))
+	}
+	if o.Mood != "" {
+		parts = append(parts, "mood="+o.Mood)
+	}
+	if o.NoMusic {
+		parts = append(parts, "music=off")
+	}
+	if o.Intensity != "" {
+		parts = append(parts, "intensity="+o.Intensity)
+	}
+	if len(parts) == 0 {
+		return "nothing recognized"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Apply overlays the overrides on decision. Animations become its animation plan, split
+// evenly over the run (render_motion scales it to the duration); an intensity alone
+// applies to the default animation. explicitIntensity (--intensity) wins over the
+// prompt's intensity.
+func (o PromptOverrides) Apply(decision *llm.PipelineDecision, explicitIntensity bool) {
+	if len(o.Animations) > 0 || (o.Intensity != "" && !explicitIntensity) {
+		animations := o.Animations
+		if len(animations) == 0 {
+			animations = []string{AnimationRotate}
+		}
+		decision.AnimationPlan = make([]types.AnimationSegment, len(animations))
+		for i, animation := range animations {
+			segment := types.AnimationSegment{Type: animation, Duration: 1}
+			if scale, ok := promptIntensityScale[o.Intensity]; ok && !explicitIntensity {
+				segment.Intensity = defaultAnimationIntensity[animation] * scale
+			}
+			decision.AnimationPlan[i] = segment
+		}
+	}
+	if o.Mood != "" {
+		decision.MusicMood = o.Mood
+	}
+	if o.NoMusic {
+		decision.NeedMusic = false
+	}
+}
+
+// applyPromptRules overlays what the rules understand of the manifest's user prompt on
+// decision. When they understand anything, the decision is stored in the manifest as an
+// analysis by PromptRulesModel, so a resumed run keeps it.
+func applyPromptRules(manifest *Manifest, decision *llm.PipelineDecision) *llm.PipelineDecision {
+	prompt := strings.TrimSpace(manifest.Input.UserPrompt)
+	if prompt == "" {
+		return decision
+	}
+
+	overrides := InterpretPrompt(prompt)
+	log.Printf("Interpreted prompt: %s", overrides)
+	if overrides.IsEmpty() {
+		return decision
+	}
+
+	overrides.Apply(decision, manifest.Input.Intensity > 0)
+	// Rules don't look at the image, so there is no description for the title metadata
+	decision.ImageDescription = ""
+	manifest.LLMAnalysis = &llm.LLMAnalysis{
+		Decision:       decision,
+		ReasoningSteps: []string{fmt.Sprintf("interpreted prompt %q: %s", prompt, overrides)},
+		Model:          PromptRulesModel,
+	}
+	return decision
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestInterpretPrompt verifies animation types, moods, "no music" and intensity
+// adjectives are recognized in free-form prompts
+func TestInterpretPrompt(t *testing.T) {
+	tests := []struct {
+		prompt   string
+		expected PromptOverrides
+		summary  string
+	}{
+		{"slow sad nod, no music", PromptOverrides{Animations: []string{AnimationNod}, Mood: "sad", NoMusic: true, Intensity: PromptIntensityGentle},
+			"animation=nod, mood=sad, music=off, intensity=gentle"},
+		{"Generate a shake animation with the character's head moving left and right",
+			PromptOverrides{Animations: []string{AnimationShake}}, "animation=shake"},
+		{"nod then zoom", PromptOverrides{Animations: []string{AnimationNod, AnimationZoom}}, "animation=nod+zoom"},
+		{"zoom, zoom, zoom!", PromptOverrides{Animations: []string{AnimationZoom}}, "animation=zoom"},
+		{"a happy wiggle", PromptOverrides{Animations: []string{AnimationShake}, Mood: "happy"}, "animation=shake, mood=happy"},
+		{"gentle sway with calm music", PromptOverrides{Animations: []string{AnimationRotate}, Mood: "calm", Intensity: PromptIntensityGentle},
+			"animation=rotate, mood=calm, intensity=gentle"},
+		{"WILD energetic spin", PromptOverrides{Mood: "energetic", Intensity: PromptIntensityStrong}, "mood=energetic, intensity=strong"},
+		{"make it silent", PromptOverrides{NoMusic: true}, "music=off"},
+		{"nodding without audio", PromptOverrides{Animations: []string{AnimationNod}, NoMusic: true}, "animation=nod, music=off"},
+		{"shake but no zoom", PromptOverrides{Animations: []string{AnimationShake}}, "animation=shake"},
+		{"don't zoom, just nod", PromptOverrides{Animations: []string{AnimationNod}}, "animation=nod"},
+		{"epic dramatic rotation, strongly", PromptOverrides{Animations: []string{AnimationRotate}, Mood: "epic", Intensity: PromptIntensityStrong},
+			"animation=rotate, mood=epic, intensity=strong"},
+		{"with music", PromptOverrides{}, "nothing recognized"},
+		{"", PromptOverrides{}, "nothing recognized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			overrides := InterpretPrompt(tt.prompt)
+			if !reflect.DeepEqual(overrides, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, overrides)
+			}
+			if summary := overrides.String(); summary != tt.summary {
+				t.Errorf("Expected summary %q, got %q", tt.summary, summary)
+			}
+		})
+	}
+}
+
+// TestApplyPromptRules verifies the overrides change the default decision and are stored
+// as an analysis by the rules, and an explicit intensity wins over the prompt's
+func TestApplyPromptRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        types.PipelineInput
+		expectPlan   []types.AnimationSegment
+		expectMusic  bool
+		expectMood   string
+		expectStored bool
+	}{
+		{
+			name:         "overrides applied",
+			input:        types.PipelineInput{UserPrompt: "slow sad nod, no music"},
+			expectPlan:   []types.AnimationSegment{{Type: AnimationNod, Duration: 1, Intensity: 5}},
+			expectMood:   "sad",
+			expectStored: true,
+		},
+		{
+			name:         "explicit intensity wins",
+			input:        types.PipelineInput{UserPrompt: "strong shake", Intensity: 3},
+			expectPlan:   []types.AnimationSegment{{Type: AnimationShake, Duration: 1}},
+			expectMusic:  true,
+			expectMood:   "happy",
+			expectStored: true,
+		},
+		{
+			name:        "intensity alone applies to the default animation",
+			input:       types.PipelineInput{UserPrompt: "make it subtle"},
+			expectPlan:  []types.AnimationSegment{{Type: AnimationRotate, Duration: 1, Intensity: 5}},
+			expectMusic: true, expectMood: "happy", expectStored: true,
+		},
+		{
+			name:        "nothing recognized",
+			input:       types.PipelineInput{UserPrompt: "make it pop"},
+			expectMusic: true, expectMood: "happy",
+		},
+		{
+			name:        "no prompt",
+			expectMusic: true, expectMood: "happy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := NewManifest("test", tt.input)
+			decision := applyPromptRules(manifest, llm.GetDefaultDecision())
+
+			if !reflect.DeepEqual(decision.AnimationPlan, tt.expectPlan) {
+				t.Errorf("Expected plan %+v, got %+v", tt.expectPlan, decision.AnimationPlan)
+			}
+			if decision.NeedMusic != tt.expectMusic || decision.MusicMood != tt.expectMood {
+				t.Errorf("Expected music %v (%s), got %v (%s)", tt.expectMusic, tt.expectMood, decision.NeedMusic, decision.MusicMood)
+			}
+			if stored := manifest.LLMAnalysis != nil; stored != tt.expectStored {
+				t.Fatalf("Expected analysis stored: %v, got %+v", tt.expectStored, manifest.LLMAnalysis)
+			}
+			if tt.expectStored && (manifest.LLMAnalysis.Model != PromptRulesModel || manifest.LLMAnalysis.Decision != decision) {
+				t.Errorf("Expected the decision stored by %q, got %+v", PromptRulesModel, manifest.LLMAnalysis)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"encoding/json"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// provenanceCacheKey holds the producing tool in stage cache data, so a cache hit
+// reports the tool that actually made the artifact
+const provenanceCacheKey = "provenance"
+
+// toolProvenance describes a call to tool on the configured server, with the name and
+// version the server reported
+func toolProvenance(server string, mcpClient client.MCPClient, tool string) *types.ToolProvenance {
+	source := &types.ToolProvenance{Server: server, Tool: tool}
+	if mcpClient != nil {
+		source.ServerName, source.ServerVersion = mcpClient.GetServerInfo()
+	}
+	return source
+}
+
+// localProvenance describes an artifact rendered locally by tool, e.g. ffmpeg
+func localProvenance(tool string) *types.ToolProvenance {
+	return &types.ToolProvenance{Tool: tool}
+}
+
+// storeCachedProvenance adds source to stage cache data
+func storeCachedProvenance(data map[string]string, source *types.ToolProvenance) {
+	if encoded, err := json.Marshal(source); err == nil {
+		data[provenanceCacheKey] = string(encoded)
+	}
+}
+
+// cachedProvenance returns the tool recorded with a cache entry, or nil for entries
+// cached before provenance was recorded
+func cachedProvenance(entry *CacheEntry) *types.ToolProvenance {
+	data := entry.Data[provenanceCacheKey]
+	if data == "" {
+		return nil
+	}
+	var source types.ToolProvenance
+	if err := json.Unmarshal([]byte(data), &source); err != nil {
+		return nil
+	}
+	return &source
+}
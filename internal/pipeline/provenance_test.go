@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// stageProvenance returns the provenance recorded in a stage's output
+func stageProvenance(t *testing.T, manifest *Manifest, stage types.PipelineStage) *types.ToolProvenance {
+	t.Helper()
+	var output struct {
+		Provenance *types.ToolProvenance `json:"provenance"`
+	}
+	if err := json.Unmarshal(manifest.Stages[stage].Output, &output); err != nil {
+		t.Fatalf("Failed to parse stage output: %v", err)
+	}
+	return output.Provenance
+}
+
+// TestStepProvenance verifies the segment and landmark stages record the server and tool
+// behind their artifacts, and that cache hits keep the original provenance
+func TestStepProvenance(t *testing.T) {
+	cache, err := NewStageCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewStageCache failed: %v", err)
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tools := newFakeToolClient()
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetStageCache(cache)
+
+	expected := map[string]types.ToolProvenance{
+		ArtifactSegmentedImage: {Server: "imagesorcery", ServerName: "fake", ServerVersion: "1.0.0", Tool: "fill"},
+		ArtifactLandmarks:      {Server: "yolo", ServerName: "fake", ServerVersion: "1.0.0", Tool: "analyze_image_from_path"},
+	}
+	stages := map[string]types.PipelineStage{
+		ArtifactSegmentedImage: types.StageSegmentPerson,
+		ArtifactLandmarks:      types.StageLandmarks,
+	}
+
+	for _, run := range []string{"miss", "hit"} {
+		manifest := newCacheTestManifest(t, imagePath, 0.3)
+		if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+			t.Fatalf("%s: ExecuteSegmentPerson failed: %v", run, err)
+		}
+		if err := ExecuteEstimateLandmarks(context.Background(), p, manifest); err != nil {
+			t.Fatalf("%s: ExecuteEstimateLandmarks failed: %v", run, err)
+		}
+
+		for artifact, want := range expected {
+			if got := manifest.Result.Provenance[artifact]; got == nil || *got != want {
+				t.Errorf("%s: expected result provenance %s=%+v, got %+v", run, artifact, want, got)
+			}
+			if got := stageProvenance(t, manifest, stages[artifact]); got == nil || *got != want {
+				t.Errorf("%s: expected stage provenance %s=%+v, got %+v", run, artifact, want, got)
+			}
+		}
+	}
+	if tools.calls["fill"] != 1 {
+		t.Errorf("Expected the second run to hit the cache, got %v", tools.calls)
+	}
+}
+
+// TestSetProvenance verifies recording and clearing an artifact's provenance
+func TestSetProvenance(t *testing.T) {
+	result := &PipelineResult{}
+	result.SetProvenance(ArtifactMusic, &types.ToolProvenance{Server: "music", Tool: "SearchRecordings", TrackID: "7"})
+	if got := result.Provenance[ArtifactMusic]; got == nil || got.TrackID != "7" {
+		t.Fatalf("Expected music provenance with track 7, got %+v", got)
+	}
+
+	result.SetProvenance(ArtifactMusic, nil)
+	if _, ok := result.Provenance[ArtifactMusic]; ok {
+		t.Error("Expected nil provenance to clear the artifact")
+	}
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Reanalysis records a resume that discarded the manifest's stored decision, and the
+// completed stages it reset because the fresh decision or input changed what they use
+type Reanalysis struct {
+	At          time.Time             `json:"at"`
+	ResetStages []types.PipelineStage `json:"reset_stages,omitempty"`
+}
+
+// stageDependents are the stages consuming a stage's artifacts, reset along with it
+var stageDependents = map[types.PipelineStage][]types.PipelineStage{
+	types.StageSegmentPerson: {types.StageLandmarks, types.StageRenderMotion, types.StageCompose},
+	types.StageRenderMotion:  {types.StageCompose},
+	types.StageSearchMusic:   {types.StageCompose},
+}
+
+// SetReanalyze makes a resumed run discard the manifest's stored decision and compute it
+// again, with the run's prompt and animation. Completed stages are kept unless what
+// they were computed from changed.
+func (p *Pipeline) SetReanalyze(enabled bool) {
+	p.reanalyze = enabled
+}
+
+// discardDecision drops a resumed manifest's stored decision and takes the prompt and
+// animation plan from input. It returns the stage inputs the completed stages ran with,
+// for resetStaleStages to compare against.
+func discardDecision(manifest *Manifest, input types.PipelineInput) map[types.PipelineStage]string {
+	var stored *llm.PipelineDecision
+	if manifest.LLMAnalysis != nil {
+		stored = manifest.LLMAnalysis.Decision
+	}
+	before := stageInputs(stored, stored, manifest.Input)
+
+	manifest.LLMAnalysis = nil
+	if manifest.Result != nil {
+		manifest.Result.ImageDescription = ""
+	}
+	manifest.Input.UserPrompt = input.UserPrompt
+	manifest.Input.AnimationPlan = input.AnimationPlan
+	manifest.Input.Intensity = input.Intensity
+	log.Printf("Re-analyzing pipeline %s: discarded the stored decision", manifest.PipelineID)
+	return before
+}
+
+// resetStaleStages resets the completed stages whose inputs differ from before under
+// the fresh decision, with their dependents, and records the re-analysis
+func resetStaleStages(manifest *Manifest, before map[types.PipelineStage]string, decision *llm.PipelineDecision) {
+	var stepDecision *llm.PipelineDecision
+	if manifest.LLMAnalysis != nil {
+		stepDecision = manifest.LLMAnalysis.Decision
+	}
+	after := stageInputs(stepDecision, decision, manifest.Input)
+
+	stale := make(map[types.PipelineStage]bool)
+	for _, stage := range GetStageOrder() {
+		if before[stage] == after[stage] {
+			continue
+		}
+		stale[stage] = true
+		for _, dependent := range stageDependents[stage] {
+			stale[dependent] = true
+		}
+	}
+
+	reanalysis := Reanalysis{At: time.Now()}
+	for _, stage := range GetStageOrder() {
+		if stale[stage] && manifest.IsStageCompleted(stage) {
+			manifest.ResetStage(stage)
+			reanalysis.ResetStages = append(reanalysis.ResetStages, stage)
+		}
+	}
+	manifest.Reanalyses = append(manifest.Reanalyses, reanalysis)
+
+	if len(reanalysis.ResetStages) > 0 {
+		log.Printf("Re-analysis changed the inputs of %v; running them again", reanalysis.ResetStages)
+	} else {
+		log.Println("Re-analysis left every completed stage valid")
+	}
+}
+
+// stageInputs describes what each stage is computed from: the parameters the step reads
+// from stepDecision (the manifest's stored decision, nil without one), whether plan runs
+// it (the default decision when nil), and the input. Equal descriptions mean the stage
+// would produce the same artifacts.
+func stageInputs(stepDecision, plan *llm.PipelineDecision, input types.PipelineInput) map[types.PipelineStage]string {
+	var parameters map[string]interface{}
+	var decisionPlan []types.AnimationSegment
+	var mood, description string
+	var count int
+	if stepDecision != nil {
+		parameters = stepDecision.Parameters
+		decisionPlan = stepDecision.AnimationPlan
+		mood, count, description = stepDecision.MusicMood, stepDecision.MusicCount, stepDecision.ImageDescription
+	}
+	if plan == nil {
+		plan = llm.GetDefaultDecision()
+	}
+
+	return map[types.PipelineStage]string{
+		types.StageSegmentPerson: fmt.Sprint(plan.NeedSegment, parameters["detect_confidence"]),
+		types.StageLandmarks: fmt.Sprint(plan.NeedLandmarks,
+			parameters["landmark_confidence"], parameters["landmark_model"]),
+		types.StageRenderMotion: fmt.Sprint(plan.EnableMotion, decisionPlan, input.AnimationPlan, input.Intensity),
+		types.StageSearchMusic:  fmt.Sprint(plan.NeedMusic, mood, count),
+		types.StageCompose:      description,
+	}
+}
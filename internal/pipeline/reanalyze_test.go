@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestReanalyze verifies a resume with re-analysis discards the stored decision and only
+// reruns the stages whose inputs it changed, with their dependents
+func TestReanalyze(t *testing.T) {
+	tests := []struct {
+		name      string
+		decision  *llm.PipelineDecision
+		animation []types.AnimationSegment
+		reset     []types.PipelineStage
+	}{
+		{
+			name:     "music mood changed",
+			decision: &llm.PipelineDecision{NeedSegment: true, NeedLandmarks: true, EnableMotion: true, NeedMusic: true, MusicMood: "calm"},
+			reset:    []types.PipelineStage{types.StageSearchMusic, types.StageCompose},
+		},
+		{
+			name: "detect confidence changed",
+			decision: &llm.PipelineDecision{NeedSegment: true, NeedLandmarks: true, EnableMotion: true, NeedMusic: true,
+				Parameters: map[string]interface{}{"detect_confidence": 0.6}},
+			reset: []types.PipelineStage{types.StageSegmentPerson, types.StageLandmarks, types.StageRenderMotion, types.StageCompose},
+		},
+		{
+			name:      "new animation",
+			decision:  &llm.PipelineDecision{NeedSegment: true, NeedLandmarks: true, EnableMotion: true, NeedMusic: true},
+			animation: []types.AnimationSegment{{Type: AnimationNod, Duration: 2}},
+			reset:     []types.PipelineStage{types.StageRenderMotion, types.StageCompose},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := types.PipelineInput{ImagePath: "/tmp/photo.png", Duration: 2, TempDir: t.TempDir()}
+			manifest := NewManifest("run-1", input)
+			manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: tt.decision}
+			for _, stage := range GetStageOrder() {
+				manifest.StartStage(stage)
+				manifest.CompleteStage(stage, nil)
+			}
+			store := NewMemoryManifestStore()
+			store.Save(context.Background(), manifest)
+
+			var ran []types.PipelineStage
+			registry := NewStepRegistry()
+			for _, stage := range GetStageOrder() {
+				registry.Register(stage, func(ctx context.Context, p *Pipeline, m *Manifest) error {
+					ran = append(ran, stage)
+					return m.CompleteStage(stage, nil)
+				})
+			}
+
+			p := NewPipeline(nil, nil, nil, nil, nil, true, 3, "", "lightweight")
+			p.SetManifestStore(store)
+			p.SetEventLog(false)
+			p.SetStepRegistry(registry)
+			p.SetReanalyze(true)
+
+			input.AnimationPlan = tt.animation
+			if _, err := p.Execute(context.Background(), input, "run-1"); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if !reflect.DeepEqual(ran, tt.reset) {
+				t.Errorf("Expected %v to run again, got %v", tt.reset, ran)
+			}
+
+			saved, _ := store.Load(context.Background())
+			if saved.LLMAnalysis != nil {
+				t.Errorf("Expected the stored decision to be discarded")
+			}
+			if len(saved.Reanalyses) != 1 || saved.Reanalyses[0].At.IsZero() ||
+				!reflect.DeepEqual(saved.Reanalyses[0].ResetStages, tt.reset) {
+				t.Errorf("Expected the re-analysis to be recorded with %v, got %+v", tt.reset, saved.Reanalyses)
+			}
+		})
+	}
+}
+
+// TestResumeKeepsDecision verifies a resume without re-analysis reuses the stored decision
+func TestResumeKeepsDecision(t *testing.T) {
+	input := types.PipelineInput{ImagePath: "/tmp/photo.png", Duration: 2, TempDir: t.TempDir()}
+	manifest := NewManifest("run-1", input)
+	manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: &llm.PipelineDecision{NeedMusic: true, MusicMood: "calm"}}
+	store := NewMemoryManifestStore()
+	store.Save(context.Background(), manifest)
+
+	registry := NewStepRegistry()
+	registry.Register(types.StageSearchMusic, noopStep)
+	registry.Register(types.StageCompose, noopStep)
+
+	p := NewPipeline(nil, nil, nil, nil, nil, true, 3, "", "lightweight")
+	p.SetManifestStore(store)
+	p.SetEventLog(false)
+	p.SetStepRegistry(registry)
+	if _, err := p.Execute(context.Background(), input, "run-1"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	saved, _ := store.Load(context.Background())
+	if saved.LLMAnalysis == nil || saved.LLMAnalysis.Decision.MusicMood != "calm" || len(saved.Reanalyses) != 0 {
+		t.Errorf("Expected the stored decision to be kept, got %+v", saved.LLMAnalysis)
+	}
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// StepRegistry maps stages to step functions. Registered steps take precedence over
+// the built-in steps, so integrators can add stages or replace existing ones.
+type StepRegistry struct {
+	mu    sync.RWMutex
+	steps map[types.PipelineStage]StepFunc
+}
+
+// NewStepRegistry creates an empty step registry
+func NewStepRegistry() *StepRegistry {
+	return &StepRegistry{
+		steps: make(map[types.PipelineStage]StepFunc),
+	}
+}
+
+// DefaultStepRegistry is consulted by GetStepForStage before the built-in steps
+var DefaultStepRegistry = NewStepRegistry()
+
+// Register adds or replaces the step for a stage
+func (r *StepRegistry) Register(stage types.PipelineStage, step StepFunc) error {
+	if stage == "" || stage == types.StageInit || stage == types.StageComplete {
+		return fmt.Errorf("invalid stage name: %q", stage)
+	}
+	if step == nil {
+		return fmt.Errorf("step for stage %s is nil", stage)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps[stage] = step
+	return nil
+}
+
+// Lookup returns the registered step for a stage
+func (r *StepRegistry) Lookup(stage types.PipelineStage) (StepFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	step, ok := r.steps[stage]
+	return step, ok
+}
+
+// isBuiltinStage reports whether stage is one of the stages in GetStageOrder
+func isBuiltinStage(stage types.PipelineStage) bool {
+	for _, builtin := range GetStageOrder() {
+		if stage == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// stepForStage returns the step for a stage, checking the pipeline's registry first
+func (p *Pipeline) stepForStage(stage types.PipelineStage) (StepFunc, error) {
+	if p.stepRegistry != nil {
+		if step, ok := p.stepRegistry.Lookup(stage); ok {
+			return step, nil
+		}
+	}
+	return GetStepForStage(stage)
+}
+
+// planStages returns the stages to run for a decision. Built-in stages follow the
+// configured order (default GetStageOrder) and run only when the decision enables them;
+// custom stages always run. Compose is appended if the order leaves it out.
+func (p *Pipeline) planStages(decision *llm.PipelineDecision) ([]types.PipelineStage, error) {
+	order := p.stageOrder
+	if len(order) == 0 {
+		order = GetStageOrder()
+	}
+
+	enabled := map[types.PipelineStage]bool{
+		types.StageSegmentPerson: decision.NeedSegment,
+		types.StageLandmarks:     decision.NeedLandmarks,
+		types.StageRenderMotion:  decision.EnableMotion,
+		types.StageSearchMusic:   decision.NeedMusic,
+		types.StageCompose:       true,
+	}
+
+	var stages []types.PipelineStage
+	seen := make(map[types.PipelineStage]bool)
+	for _, stage := range order {
+		if seen[stage] {
+			return nil, fmt.Errorf("stage %s appears more than once in the stage order", stage)
+		}
+		seen[stage] = true
+
+		if isBuiltinStage(stage) {
+			if enabled[stage] {
+				stages = append(stages, stage)
+			}
+			continue
+		}
+		if _, err := p.stepForStage(stage); err != nil {
+			return nil, fmt.Errorf("invalid stage order: %w", err)
+		}
+		stages = append(stages, stage)
+	}
+
+	if !seen[types.StageCompose] {
+		stages = append(stages, types.StageCompose)
+	}
+	return stages, nil
+}
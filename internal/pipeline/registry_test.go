@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+const stageColorGrade types.PipelineStage = "color_grade"
+
+func noopStep(ctx context.Context, p *Pipeline, manifest *Manifest) error { return nil }
+
+func TestPlanStages(t *testing.T) {
+	allEnabled := &llm.PipelineDecision{NeedSegment: true, NeedLandmarks: true, EnableMotion: true, NeedMusic: true}
+
+	tests := []struct {
+		name      string
+		order     []types.PipelineStage
+		decision  *llm.PipelineDecision
+		expected  []types.PipelineStage
+		expectErr bool
+	}{
+		{
+			name:     "default order",
+			decision: allEnabled,
+			expected: GetStageOrder(),
+		},
+		{
+			name:     "disabled stages skipped",
+			decision: &llm.PipelineDecision{NeedSegment: true, NeedMusic: true},
+			expected: []types.PipelineStage{types.StageSegmentPerson, types.StageSearchMusic, types.StageCompose},
+		},
+		{
+			name:     "custom stage slotted in",
+			order:    []types.PipelineStage{types.StageSegmentPerson, stageColorGrade, types.StageRenderMotion, types.StageCompose},
+			decision: allEnabled,
+			expected: []types.PipelineStage{types.StageSegmentPerson, stageColorGrade, types.StageRenderMotion, types.StageCompose},
+		},
+		{
+			name:     "compose appended",
+			order:    []types.PipelineStage{stageColorGrade},
+			decision: allEnabled,
+			expected: []types.PipelineStage{stageColorGrade, types.StageCompose},
+		},
+		{
+			name:      "unregistered stage",
+			order:     []types.PipelineStage{"sharpen", types.StageCompose},
+			decision:  allEnabled,
+			expectErr: true,
+		},
+		{
+			name:      "duplicate stage",
+			order:     []types.PipelineStage{types.StageSegmentPerson, types.StageSegmentPerson},
+			decision:  allEnabled,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewStepRegistry()
+			if err := registry.Register(stageColorGrade, noopStep); err != nil {
+				t.Fatalf("Register failed: %v", err)
+			}
+
+			p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+			p.SetStepRegistry(registry)
+			p.SetStageOrder(tt.order)
+
+			stages, err := p.planStages(tt.decision)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got stages %v", stages)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planStages failed: %v", err)
+			}
+			if !reflect.DeepEqual(stages, tt.expected) {
+				t.Errorf("Expected stages %v, got %v", tt.expected, stages)
+			}
+		})
+	}
+}
+
+func TestStepRegistryRegisterInvalid(t *testing.T) {
+	registry := NewStepRegistry()
+	if err := registry.Register("", noopStep); err == nil {
+		t.Error("Expected error for empty stage")
+	}
+	if err := registry.Register(types.StageComplete, noopStep); err == nil {
+		t.Error("Expected error for the complete stage")
+	}
+	if err := registry.Register(stageColorGrade, nil); err == nil {
+		t.Error("Expected error for nil step")
+	}
+}
+
+// TestExecuteRunsRegisteredStages verifies custom stages run in the configured order and
+// registered steps replace built-in ones
+func TestExecuteRunsRegisteredStages(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.json")
+
+	// Disable all optional built-in stages so only the custom stage and compose run
+	manifest := NewManifest("registry-test", types.PipelineInput{ImagePath: "input.png", TempDir: dir, OutputDir: dir})
+	manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: &llm.PipelineDecision{}}
+	if err := manifest.Save(manifestPath); err != nil {
+		t.Fatalf("Failed to save manifest: %v", err)
+	}
+
+	var ran []types.PipelineStage
+	record := func(stage types.PipelineStage) StepFunc {
+		return func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+			ran = append(ran, stage)
+			return manifest.CompleteStage(stage, map[string]string{})
+		}
+	}
+
+	registry := NewStepRegistry()
+	registry.Register(stageColorGrade, record(stageColorGrade))
+	registry.Register(types.StageCompose, record(types.StageCompose))
+
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, manifestPath, "lightweight")
+	p.SetStepRegistry(registry)
+	p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson, stageColorGrade, types.StageCompose})
+
+	if _, err := p.Execute(context.Background(), manifest.Input, "registry-test"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	expected := []types.PipelineStage{stageColorGrade, types.StageCompose}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Errorf("Expected stages %v to run, got %v", expected, ran)
+	}
+
+	saved, err := LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if !saved.IsStageCompleted(stageColorGrade) {
+		t.Error("Expected custom stage to be recorded as completed")
+	}
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultRepairMaxCostUSD bounds what a run spends on repair questions when
+// repair.max_cost_usd is unset
+const DefaultRepairMaxCostUSD = 0.05
+
+// Outcomes of a repair
+const (
+	RepairCompleted = "completed" // The stage succeeded with the suggested parameters
+	RepairFailed    = "failed"    // The stage failed again with them
+	RepairDeclined  = "declined"  // The model suggested no change
+	RepairInvalid   = "invalid"   // The answer wasn't a usable parameter patch
+	RepairError     = "error"     // The question couldn't be asked
+)
+
+// Repair records one LLM repair of a stage that ran out of retries
+type Repair struct {
+	At         time.Time              `json:"at"`
+	Stage      types.PipelineStage    `json:"stage"`
+	Error      string                 `json:"error"`                // Failure the model was asked about
+	Parameters map[string]interface{} `json:"parameters,omitempty"` // Decision parameters it changed
+	Reason     string                 `json:"reason,omitempty"`
+	Model      string                 `json:"model,omitempty"`
+	CostUSD    float64                `json:"cost_usd"`
+	Outcome    string                 `json:"outcome"`
+}
+
+// repairAnswer is the JSON the model is asked to reply with
+type repairAnswer struct {
+	Parameters map[string]interface{} `json:"parameters"`
+	Reason     string                 `json:"reason"`
+}
+
+// SetRepairConfig enables LLM repairs of stages that run out of retries, bounded per run
+// by config. They need a provider implementing llm.Advisor.
+func (p *Pipeline) SetRepairConfig(config types.RepairConfig) {
+	p.repairConfig = config
+}
+
+// repairStage asks the provider how to adjust the decision parameters after stage failed
+// with failure and had no retries left, then runs the stage once more with the patched
+// parameters. It repeats while the stage fails and the run's repair budget lasts, and
+// returns nil once the stage succeeds, else the last failure.
+func (p *Pipeline) repairStage(ctx context.Context, stage types.PipelineStage, manifest *Manifest, decision *llm.PipelineDecision, failure error) error {
+	advisor, ok := p.llmProvider.(llm.Advisor)
+	if !ok || p.repairConfig.MaxRepairs <= 0 || decision == nil {
+		return failure
+	}
+	stepFunc, err := p.stepForStage(stage)
+	if err != nil {
+		return failure
+	}
+
+	for ctx.Err() == nil && !shutdownRequested(ctx) {
+		question := repairQuestion(stage, failure, manifest, decision)
+		if reason := p.repairBudgetExhausted(manifest, question); reason != "" {
+			log.Printf("[AI Agent] Not asking to repair stage %s: %s", stage, reason)
+			return failure
+		}
+
+		log.Printf("[AI Agent] Stage %s ran out of retries, asking %s to adjust its parameters", stage, p.llmProvider.Name())
+		repair := Repair{At: time.Now(), Stage: stage, Error: failure.Error()}
+		advice, err := advisor.Ask(ctx, question)
+		if err != nil {
+			repair.Outcome, repair.Reason = RepairError, err.Error()
+			p.recordRepair(ctx, manifest, repair)
+			return failure
+		}
+		repair.Model, repair.CostUSD = advice.Model, advice.CostUSD(p.llmProvider.Name())
+
+		var answer repairAnswer
+		if err := llm.DecodeAdvice(advice.Text, &answer); err != nil {
+			repair.Outcome, repair.Reason = RepairInvalid, err.Error()
+			p.recordRepair(ctx, manifest, repair)
+			return failure
+		}
+		repair.Reason = answer.Reason
+		patch, err := repairPatch(answer.Parameters, decision.Parameters)
+		if err != nil {
+			repair.Outcome, repair.Reason = RepairInvalid, err.Error()
+			p.recordRepair(ctx, manifest, repair)
+			return failure
+		}
+		if len(patch) == 0 {
+			repair.Outcome = RepairDeclined
+			p.recordRepair(ctx, manifest, repair)
+			return failure
+		}
+
+		repair.Parameters = patch
+		applyRepair(manifest, decision, patch)
+		log.Printf("[AI Agent] Retrying stage %s with %s (%s)", stage, describeParameters(patch), answer.Reason)
+		eventLogFrom(ctx).Emit(EventStageRepaired, stage, map[string]interface{}{
+			"parameters": patch,
+			"cost_usd":   repair.CostUSD,
+		})
+
+		if failure = p.attemptStage(ctx, stage, manifest, stepFunc); failure == nil {
+			repair.Outcome = RepairCompleted
+			p.recordRepair(ctx, manifest, repair)
+			return nil
+		}
+		repair.Outcome = RepairFailed
+		p.recordRepair(ctx, manifest, repair)
+	}
+	return failure
+}
+
+// repairBudgetExhausted returns why the run can't afford another repair question, or ""
+func (p *Pipeline) repairBudgetExhausted(manifest *Manifest, question string) string {
+	if len(manifest.Repairs) >= p.repairConfig.MaxRepairs {
+		return fmt.Sprintf("all %d repairs of the run used", p.repairConfig.MaxRepairs)
+	}
+	maxCost := p.repairConfig.MaxCostUSD
+	if maxCost <= 0 {
+		maxCost = DefaultRepairMaxCostUSD
+	}
+	spent := 0.0
+	for _, repair := range manifest.Repairs {
+		spent += repair.CostUSD
+	}
+	if estimate := llm.EstimateAdviceCostUSD(p.llmProvider.Name(), question); spent+estimate > maxCost {
+		return fmt.Sprintf("$%.4f spent, another question may cost $%.4f of the $%.2f budget", spent, estimate, maxCost)
+	}
+	return ""
+}
+
+// recordRepair appends repair to the manifest and checkpoints it
+func (p *Pipeline) recordRepair(ctx context.Context, manifest *Manifest, repair Repair) {
+	if repair.Outcome != RepairCompleted && repair.Outcome != RepairFailed {
+		log.Printf("[AI Agent] Repair of stage %s %s: %s", repair.Stage, repair.Outcome, repair.Reason)
+	}
+	manifest.Repairs = append(manifest.Repairs, repair)
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		log.Printf("Warning: failed to save manifest after repair: %v", err)
+	}
+}
+
+// repairQuestion asks the model for a parameter patch that may let stage succeed
+func repairQuestion(stage types.PipelineStage, failure error, manifest *Manifest, decision *llm.PipelineDecision) string {
+	parameters, _ := json.Marshal(decision.Parameters)
+	var b strings.Builder
+	fmt.Fprintf(&b, "An image animation pipeline stage failed after all its retries.\n\n")
+	fmt.Fprintf(&b, "Stage: %s\nError: %s\nCurrent parameters: %s\n", stage, failure, parameters)
+	// Without an analysis the decision is the default one, which describes no image
+	if manifest.LLMAnalysis != nil {
+		if description := llm.SanitizeDescription(decision.ImageDescription, llm.MaxImageDescriptionLength); description != "" {
+			fmt.Fprintf(&b, "Image: %s\n", description)
+		}
+	}
+	b.WriteString("\nShould any parameter change for one more attempt? For example, a detection that found " +
+		"nothing may succeed with a lower detect_confidence. Reply with only a JSON object: " +
+		`{"parameters": {"<name>": <new value>}, "reason": "<one sentence>"}` +
+		". Only include parameters to change, with number, string or boolean values. " +
+		`Reply {"parameters": {}, "reason": "..."} if no change is likely to help.`)
+	return b.String()
+}
+
+// repairPatch returns the entries of suggested that change current. Values must be
+// scalars of the type the parameter already has.
+func repairPatch(suggested, current map[string]interface{}) (map[string]interface{}, error) {
+	patch := make(map[string]interface{})
+	for name, value := range suggested {
+		switch value.(type) {
+		case float64, string, bool:
+		default:
+			return nil, fmt.Errorf("parameter %s: unsupported value %v", name, value)
+		}
+		old, exists := current[name]
+		if exists {
+			if oldNumber, ok := toFloat(old); ok {
+				if number, ok := value.(float64); !ok {
+					return nil, fmt.Errorf("parameter %s: expected a number, got %v", name, value)
+				} else if number == oldNumber {
+					continue
+				}
+			} else if reflect.TypeOf(old) != reflect.TypeOf(value) {
+				return nil, fmt.Errorf("parameter %s: expected a %T, got %v", name, old, value)
+			} else if old == value {
+				continue
+			}
+		}
+		patch[name] = value
+	}
+	return patch, nil
+}
+
+// toFloat returns a numeric parameter as a float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// applyRepair patches the decision parameters and keeps the decision in the manifest,
+// so a resumed run uses the repaired parameters too
+func applyRepair(manifest *Manifest, decision *llm.PipelineDecision, patch map[string]interface{}) {
+	if decision.Parameters == nil {
+		decision.Parameters = make(map[string]interface{})
+	}
+	maps.Copy(decision.Parameters, patch)
+	if manifest.LLMAnalysis == nil {
+		// The default decision describes no image, so there is nothing for the title metadata
+		decision.ImageDescription = ""
+		manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: decision}
+	}
+	manifest.LLMAnalysis.Decision = decision
+}
+
+// describeParameters formats parameters for the log, e.g. "detect_confidence=0.15"
+func describeParameters(parameters map[string]interface{}) string {
+	names := slices.Sorted(maps.Keys(parameters))
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%v", name, parameters[name])
+	}
+	return strings.Join(parts, ", ")
+}
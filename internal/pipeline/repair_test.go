@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// advisorProvider is a provider that answers repair questions with a fixed reply
+type advisorProvider struct {
+	answer    string
+	questions []string
+}
+
+func (a *advisorProvider) Name() string    { return "anthropic" }
+func (a *advisorProvider) IsEnabled() bool { return true }
+func (a *advisorProvider) CreateConversation(config *llm.FullAIConversationConfig) (llm.Conversation, error) {
+	return nil, errors.New("conversations are not supported")
+}
+
+func (a *advisorProvider) Ask(ctx context.Context, question string) (*llm.Advice, error) {
+	a.questions = append(a.questions, question)
+	return &llm.Advice{Text: a.answer, Model: "claude-3-5-haiku", InputTokens: 400, OutputTokens: 60}, nil
+}
+
+// lowConfidenceStep detects the subject only at a detect_confidence of 0.15 or less
+func lowConfidenceStep(attempts *[]float64) StepFunc {
+	return func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		confidence := 0.3
+		if manifest.LLMAnalysis != nil {
+			confidence = manifest.LLMAnalysis.Decision.Parameters["detect_confidence"].(float64)
+		}
+		*attempts = append(*attempts, confidence)
+		if confidence > 0.15 {
+			return fmt.Errorf("no person with polygon found in image: %w", ErrNoSubjectDetected)
+		}
+		return manifest.CompleteStage(types.StageSegmentPerson, map[string]string{})
+	}
+}
+
+// newRepairPipeline returns a lightweight pipeline running only a low-confidence
+// segment_person, with provider as its LLM
+func newRepairPipeline(t *testing.T, provider llm.Provider, config types.RepairConfig, attempts *[]float64) (*Pipeline, string) {
+	t.Helper()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	registry := NewStepRegistry()
+	registry.Register(types.StageSegmentPerson, lowConfidenceStep(attempts))
+	registry.Register(types.StageCompose, noopStep)
+
+	p := NewPipeline(nil, nil, nil, nil, provider, false, 3, manifestPath, "lightweight")
+	p.SetStepRegistry(registry)
+	p.SetStageOrder([]types.PipelineStage{types.StageSegmentPerson})
+	p.SetRepairConfig(config)
+	return p, manifestPath
+}
+
+// TestRepairLowConfidenceDetection verifies a segmentation that finds nothing at 0.3
+// runs once more at the 0.15 the model suggests, recorded in the manifest
+func TestRepairLowConfidenceDetection(t *testing.T) {
+	provider := &advisorProvider{answer: "```json\n{\"parameters\": {\"detect_confidence\": 0.15}, \"reason\": \"the subject is faint\"}\n```"}
+	var attempts []float64
+	p, manifestPath := newRepairPipeline(t, provider, types.RepairConfig{MaxRepairs: 2}, &attempts)
+
+	if _, err := p.Execute(context.Background(), types.PipelineInput{TempDir: t.TempDir()}, "repair-test"); err != nil {
+		t.Fatalf("Expected the repaired run to succeed, got %v", err)
+	}
+	if len(attempts) != 2 || attempts[0] != 0.3 || attempts[1] != 0.15 {
+		t.Errorf("Expected attempts at 0.3 then 0.15, got %v", attempts)
+	}
+	if len(provider.questions) != 1 {
+		t.Fatalf("Expected one repair question, got %d", len(provider.questions))
+	}
+
+	saved, err := LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if len(saved.Repairs) != 1 {
+		t.Fatalf("Expected one recorded repair, got %+v", saved.Repairs)
+	}
+	repair := saved.Repairs[0]
+	if repair.Stage != types.StageSegmentPerson || repair.Outcome != RepairCompleted ||
+		repair.Parameters["detect_confidence"] != 0.15 || repair.CostUSD <= 0 {
+		t.Errorf("Unexpected repair record %+v", repair)
+	}
+	if confidence := saved.LLMAnalysis.Decision.Parameters["detect_confidence"]; confidence != 0.15 {
+		t.Errorf("Expected the repaired parameter kept for resume, got %v", confidence)
+	}
+}
+
+// TestRepairBudget verifies repairs stop at max_repairs and when the answer changes
+// nothing, leaving the stage failed
+func TestRepairBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		answer    string
+		config    types.RepairConfig
+		questions int
+		outcome   string
+	}{
+		{"disabled", `{"parameters": {"detect_confidence": 0.15}}`, types.RepairConfig{}, 0, ""},
+		{"cost exhausted", `{"parameters": {"detect_confidence": 0.15}}`, types.RepairConfig{MaxRepairs: 1, MaxCostUSD: 0.0001}, 0, ""},
+		{"not enough", `{"parameters": {"detect_confidence": 0.2}}`, types.RepairConfig{MaxRepairs: 1}, 1, RepairFailed},
+		{"declined", `{"parameters": {"detect_confidence": 0.3}, "reason": "nothing to do"}`, types.RepairConfig{MaxRepairs: 2}, 1, RepairDeclined},
+		{"wrong type", `{"parameters": {"detect_confidence": "low"}}`, types.RepairConfig{MaxRepairs: 2}, 1, RepairInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &advisorProvider{answer: tt.answer}
+			var attempts []float64
+			p, manifestPath := newRepairPipeline(t, provider, tt.config, &attempts)
+
+			_, err := p.Execute(context.Background(), types.PipelineInput{TempDir: t.TempDir()}, "repair-test")
+			if !errors.Is(err, ErrNoSubjectDetected) {
+				t.Fatalf("Expected the stage to stay failed, got %v", err)
+			}
+			if len(provider.questions) != tt.questions {
+				t.Errorf("Expected %d repair questions, got %d", tt.questions, len(provider.questions))
+			}
+
+			saved, err := LoadManifest(manifestPath)
+			if err != nil {
+				t.Fatalf("Failed to load manifest: %v", err)
+			}
+			if len(saved.Repairs) != tt.questions {
+				t.Fatalf("Expected %d recorded repairs, got %+v", tt.questions, saved.Repairs)
+			}
+			if tt.questions > 0 && saved.Repairs[len(saved.Repairs)-1].Outcome != tt.outcome {
+				t.Errorf("Expected outcome %s, got %+v", tt.outcome, saved.Repairs)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// MCP server names, matching the keys of the servers config
+const (
+	ServerImageSorcery = "imagesorcery"
+	ServerYOLO         = "yolo"
+	ServerVideo        = "video"
+	ServerMusic        = "music"
+)
+
+// ffmpegBinary is the local executable lightweight mode renders and composes with
+const ffmpegBinary = "ffmpeg"
+
+// AllServers returns every MCP server name, in startup order
+func AllServers() []string {
+	return []string{ServerImageSorcery, ServerYOLO, ServerVideo, ServerMusic}
+}
+
+// stageDependencies maps built-in stages to what their lightweight steps call:
+// render_motion and compose run ffmpeg locally rather than the video server
+var stageDependencies = map[types.PipelineStage]Requirement{
+	types.StageSegmentPerson: {Name: ServerImageSorcery},
+	types.StageLandmarks:     {Name: ServerYOLO},
+	types.StageRenderMotion:  {Name: ffmpegBinary, Binary: true},
+	types.StageSearchMusic:   {Name: ServerMusic},
+	types.StageCompose:       {Name: ffmpegBinary, Binary: true},
+}
+
+// Requirement is an MCP server or local binary that planned stages depend on
+type Requirement struct {
+	Name   string                // Server name in the servers config, or the executable
+	Binary bool                  // Looked up on PATH instead of connected to as an MCP server
+	Stages []types.PipelineStage // Stages that need it; empty in full AI mode, where the model may call any server
+}
+
+// NeededBy describes what needs the requirement, for startup failure messages
+func (r Requirement) NeededBy() string {
+	if len(r.Stages) == 0 {
+		return "needed by full AI mode"
+	}
+	names := make([]string, len(r.Stages))
+	for i, stage := range r.Stages {
+		names[i] = string(stage)
+	}
+	if len(names) == 1 {
+		return "needed by stage " + names[0]
+	}
+	return "needed by stages " + strings.Join(names, ", ")
+}
+
+// ParseStageList parses a comma-separated list of stage names
+func ParseStageList(list string) []types.PipelineStage {
+	var stages []types.PipelineStage
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			stages = append(stages, types.PipelineStage(name))
+		}
+	}
+	return stages
+}
+
+// ResolveStageOrder removes the skipped stages from order (default GetStageOrder). Only
+// stages in the order can be skipped, and compose always runs.
+func ResolveStageOrder(order, skip []types.PipelineStage) ([]types.PipelineStage, error) {
+	if len(skip) == 0 {
+		return order, nil
+	}
+	if len(order) == 0 {
+		order = GetStageOrder()
+	}
+
+	skipped := make(map[types.PipelineStage]bool, len(skip))
+	for _, stage := range skip {
+		if stage == types.StageCompose {
+			return nil, fmt.Errorf("stage %s cannot be skipped", stage)
+		}
+		skipped[stage] = true
+	}
+
+	var resolved []types.PipelineStage
+	for _, stage := range order {
+		if skipped[stage] {
+			delete(skipped, stage)
+			continue
+		}
+		resolved = append(resolved, stage)
+	}
+	for stage := range skipped {
+		return nil, fmt.Errorf("cannot skip stage %s: not in the stage order", stage)
+	}
+	return resolved, nil
+}
+
+// RequiredServers returns the MCP servers and binaries a run needs, in stage order.
+// Full AI mode needs every server, since the model may call any tool; lightweight runs
+// need only what the stages planned from order call. Custom stages need nothing.
+func RequiredServers(fullAI bool, order []types.PipelineStage) ([]Requirement, error) {
+	if fullAI {
+		var requirements []Requirement
+		for _, server := range AllServers() {
+			requirements = append(requirements, Requirement{Name: server})
+		}
+		return requirements, nil
+	}
+
+	// Lightweight runs use the default decision, which enables every built-in stage
+	stages, err := (&Pipeline{stageOrder: order}).planStages(llm.GetDefaultDecision())
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Requirement)
+	var names []string
+	for _, stage := range stages {
+		dependency, ok := stageDependencies[stage]
+		if !ok {
+			continue
+		}
+		if byName[dependency.Name] == nil {
+			byName[dependency.Name] = &Requirement{Name: dependency.Name, Binary: dependency.Binary}
+			names = append(names, dependency.Name)
+		}
+		byName[dependency.Name].Stages = append(byName[dependency.Name].Stages, stage)
+	}
+
+	requirements := make([]Requirement, 0, len(names))
+	for _, name := range names {
+		requirements = append(requirements, *byName[name])
+	}
+	return requirements, nil
+}
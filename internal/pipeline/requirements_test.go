@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveStageOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    []types.PipelineStage
+		skip     string
+		expected []types.PipelineStage
+		wantErr  string
+	}{
+		{name: "nothing skipped keeps the order", skip: ""},
+		{
+			name:     "skip landmarks",
+			skip:     "estimate_landmarks",
+			expected: []types.PipelineStage{types.StageSegmentPerson, types.StageRenderMotion, types.StageSearchMusic, types.StageCompose},
+		},
+		{
+			name:     "skip from configured order",
+			order:    []types.PipelineStage{types.StageLandmarks, types.StageSearchMusic, types.StageCompose},
+			skip:     " search_music , estimate_landmarks",
+			expected: []types.PipelineStage{types.StageCompose},
+		},
+		{name: "compose", skip: "compose", wantErr: "cannot be skipped"},
+		{name: "unknown stage", skip: "estimate_landmark", wantErr: "not in the stage order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ResolveStageOrder(tt.order, ParseStageList(tt.skip))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveStageOrder failed: %v", err)
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, order)
+			}
+		})
+	}
+}
+
+func TestRequiredServers(t *testing.T) {
+	describe := func(requirements []Requirement) string {
+		parts := make([]string, len(requirements))
+		for i, req := range requirements {
+			parts[i] = fmt.Sprintf("%s(%s)", req.Name, req.NeededBy())
+		}
+		return strings.Join(parts, "; ")
+	}
+
+	tests := []struct {
+		name     string
+		fullAI   bool
+		skip     string
+		expected string
+	}{
+		{
+			name: "lightweight",
+			expected: "imagesorcery(needed by stage segment_person); yolo(needed by stage estimate_landmarks); " +
+				"ffmpeg(needed by stages render_motion, compose); music(needed by stage search_music)",
+		},
+		{
+			name: "landmarks skipped",
+			skip: "estimate_landmarks",
+			expected: "imagesorcery(needed by stage segment_person); ffmpeg(needed by stages render_motion, compose); " +
+				"music(needed by stage search_music)",
+		},
+		{
+			name:   "full AI keeps every server",
+			fullAI: true,
+			skip:   "estimate_landmarks",
+			expected: "imagesorcery(needed by full AI mode); yolo(needed by full AI mode); " +
+				"video(needed by full AI mode); music(needed by full AI mode)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ResolveStageOrder(nil, ParseStageList(tt.skip))
+			if err != nil {
+				t.Fatalf("ResolveStageOrder failed: %v", err)
+			}
+			requirements, err := RequiredServers(tt.fullAI, order)
+			if err != nil {
+				t.Fatalf("RequiredServers failed: %v", err)
+			}
+			if got := describe(requirements); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := RequiredServers(false, []types.PipelineStage{"no_such_stage"}); err == nil {
+		t.Error("Expected an unknown stage in the order to be rejected")
+	}
+}
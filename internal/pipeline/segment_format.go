@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Formats of the segmented image, set by pipeline.segment_output_format
+const (
+	SegmentFormatPNG  = "png"  // Transparent background (default)
+	SegmentFormatJPEG = "jpeg" // Background filled with segmentJPEGBackground; much smaller for photos
+	SegmentFormatAuto = "auto" // JPEG unless the render keeps transparency
+)
+
+// segmentJPEGBackground is the solid background color, as BGR for the fill tool, of a
+// JPEG segmented image
+var segmentJPEGBackground = []int{255, 255, 255}
+
+// ResolveSegmentOutputFormat validates a segment_output_format; empty selects png and
+// jpg is read as jpeg
+func ResolveSegmentOutputFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		return SegmentFormatPNG, nil
+	case "jpg":
+		return SegmentFormatJPEG, nil
+	case SegmentFormatPNG, SegmentFormatJPEG, SegmentFormatAuto:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown segment_output_format %q (supported: %s, %s, %s)",
+			format, SegmentFormatPNG, SegmentFormatJPEG, SegmentFormatAuto)
+	}
+}
+
+// SetSegmentOutputFormat sets the format segment_person writes the segmented image in
+// (see ResolveSegmentOutputFormat); empty keeps PNG
+func (p *Pipeline) SetSegmentOutputFormat(format string) {
+	p.segmentOutputFormat = format
+}
+
+// segmentFormat returns the format of the segmented image, resolving auto: the alpha
+// channel is only worth keeping when render_motion renders it into the video
+func (p *Pipeline) segmentFormat() string {
+	switch p.segmentOutputFormat {
+	case SegmentFormatJPEG:
+		return SegmentFormatJPEG
+	case SegmentFormatAuto:
+		if p.renderKeepsAlpha() {
+			return SegmentFormatPNG
+		}
+		return SegmentFormatJPEG
+	default:
+		return SegmentFormatPNG
+	}
+}
+
+// renderKeepsAlpha reports whether the configured pixel format renders transparency
+func (p *Pipeline) renderKeepsAlpha() bool {
+	return renderPixelFormats[strings.ToLower(strings.TrimSpace(p.renderConfig.PixFmt))].alpha
+}
+
+// segmentedArtifactName returns the file name of the segmented image in format
+func segmentedArtifactName(format string) string {
+	if format == SegmentFormatJPEG {
+		return strings.TrimSuffix(segmentedFileName, ".png") + ".jpg"
+	}
+	return segmentedFileName
+}
+
+// segmentBackground returns the fill color of the background for format, or nil to make
+// it transparent
+func segmentBackground(format string) []int {
+	if format == SegmentFormatJPEG {
+		return segmentJPEGBackground
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveSegmentOutputFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+		wantErr  bool
+	}{
+		{"", SegmentFormatPNG, false},
+		{"png", SegmentFormatPNG, false},
+		{"JPG", SegmentFormatJPEG, false},
+		{" jpeg ", SegmentFormatJPEG, false},
+		{"auto", SegmentFormatAuto, false},
+		{"webp", "", true},
+	}
+	for _, tt := range tests {
+		format, err := ResolveSegmentOutputFormat(tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveSegmentOutputFormat(%q) error = %v, wantErr %v", tt.format, err, tt.wantErr)
+			continue
+		}
+		if format != tt.expected {
+			t.Errorf("ResolveSegmentOutputFormat(%q) = %q, expected %q", tt.format, format, tt.expected)
+		}
+	}
+}
+
+// TestSegmentFormatAuto verifies auto keeps PNG only for a render with an alpha channel
+func TestSegmentFormatAuto(t *testing.T) {
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetSegmentOutputFormat(SegmentFormatAuto)
+	if format := p.segmentFormat(); format != SegmentFormatJPEG {
+		t.Errorf("Expected auto to pick jpeg for an opaque render, got %s", format)
+	}
+	p.SetRenderConfig(types.RenderConfig{PixFmt: "yuva420p"})
+	if format := p.segmentFormat(); format != SegmentFormatPNG {
+		t.Errorf("Expected auto to keep png for a transparent render, got %s", format)
+	}
+}
+
+// TestSegmentPersonJPEG verifies a jpeg segment_output_format fills the background with a
+// solid color and writes a .jpg artifact
+func TestSegmentPersonJPEG(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	tools := newFakeToolClient()
+	p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+	p.SetSegmentOutputFormat(SegmentFormatJPEG)
+
+	manifest := newCacheTestManifest(t, imagePath, 0.3)
+	if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+		t.Fatalf("ExecuteSegmentPerson failed: %v", err)
+	}
+	if ext := filepath.Ext(manifest.Result.SegmentedImagePath); ext != ".jpg" {
+		t.Errorf("Expected a .jpg segmented image, got %s", manifest.Result.SegmentedImagePath)
+	}
+	if _, err := os.Stat(manifest.Result.SegmentedImagePath); err != nil {
+		t.Errorf("Expected the segmented image to exist: %v", err)
+	}
+
+	areas, _ := tools.fillArgs["areas"].([]map[string]interface{})
+	if len(areas) != 1 || areas[0]["opacity"] != 1.0 || !reflect.DeepEqual(areas[0]["color"], segmentJPEGBackground) {
+		t.Errorf("Expected the background filled with %v, got %v", segmentJPEGBackground, tools.fillArgs["areas"])
+	}
+}
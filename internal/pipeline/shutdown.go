@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultShutdownGracePeriod is how long a run may finish the stage in progress after a
+// shutdown signal when shutdown_grace_period is unset
+const DefaultShutdownGracePeriod = 30 * time.Second
+
+// ErrShutdownRequested is returned when a shutdown signal stopped a run between stages.
+// The manifest was checkpointed, so resuming the run continues with the next stage.
+var ErrShutdownRequested = errors.New("shutdown requested")
+
+// ResolveShutdownGracePeriod returns the grace period for shutdown_grace_period: the
+// default when unset, and none (cancel at once) when negative
+func ResolveShutdownGracePeriod(grace time.Duration) time.Duration {
+	switch {
+	case grace == 0:
+		return DefaultShutdownGracePeriod
+	case grace < 0:
+		return 0
+	}
+	return grace
+}
+
+type shutdownKey struct{}
+
+// WithShutdown returns ctx carrying stopping. Once stopping is closed, runs let the stage
+// in progress finish its ffmpeg or tool call, then checkpoint and stop before the next
+// stage; cancelling ctx still interrupts the stage in progress.
+func WithShutdown(ctx context.Context, stopping <-chan struct{}) context.Context {
+	return context.WithValue(ctx, shutdownKey{}, stopping)
+}
+
+// shutdownRequested reports whether ctx's run was asked to stop
+func shutdownRequested(ctx context.Context) bool {
+	stopping, _ := ctx.Value(shutdownKey{}).(<-chan struct{})
+	if stopping == nil {
+		return false
+	}
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopIfShutdown checkpoints the manifest and returns ErrShutdownRequested when the run
+// was asked to stop, so next doesn't start
+func (p *Pipeline) stopIfShutdown(ctx context.Context, manifest *Manifest, next types.PipelineStage) error {
+	if !shutdownRequested(ctx) {
+		return nil
+	}
+	log.Printf("Shutdown requested, stopping pipeline %s before stage %s", manifest.PipelineID, next)
+	if err := p.saveManifest(ctx, manifest); err != nil {
+		log.Printf("Warning: failed to save manifest at shutdown: %v", err)
+	}
+	return ErrShutdownRequested
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/llm"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestShutdownStopsBetweenStages verifies a shutdown requested during a stage lets it
+// finish, then saves the manifest and starts no further stage
+func TestShutdownStopsBetweenStages(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.json")
+
+	manifest := NewManifest("shutdown-test", types.PipelineInput{ImagePath: "input.png", TempDir: dir, OutputDir: dir})
+	manifest.LLMAnalysis = &llm.LLMAnalysis{Decision: &llm.PipelineDecision{}}
+	if err := manifest.Save(manifestPath); err != nil {
+		t.Fatalf("Failed to save manifest: %v", err)
+	}
+
+	stopping := make(chan struct{})
+	var ran []types.PipelineStage
+	registry := NewStepRegistry()
+	registry.Register(stageColorGrade, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		close(stopping) // The signal arrives while the stage runs
+		ran = append(ran, stageColorGrade)
+		return manifest.CompleteStage(stageColorGrade, map[string]string{})
+	})
+	registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+		ran = append(ran, types.StageCompose)
+		return manifest.CompleteStage(types.StageCompose, map[string]string{})
+	})
+
+	p := NewPipeline(nil, nil, nil, nil, nil, false, 3, manifestPath, "lightweight")
+	p.SetStepRegistry(registry)
+	p.SetStageOrder([]types.PipelineStage{stageColorGrade, types.StageCompose})
+
+	_, err := p.Execute(WithShutdown(context.Background(), stopping), manifest.Input, "shutdown-test")
+	if !errors.Is(err, ErrShutdownRequested) || FailureKind(err) != FailureInterrupted {
+		t.Fatalf("Expected an interrupted shutdown, got %v", err)
+	}
+	if expected := []types.PipelineStage{stageColorGrade}; !reflect.DeepEqual(ran, expected) {
+		t.Errorf("Expected stages %v to run, got %v", expected, ran)
+	}
+
+	saved, err := LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if !saved.IsStageCompleted(stageColorGrade) || saved.IsStageCompleted(types.StageCompose) {
+		t.Errorf("Expected only %s saved as completed", stageColorGrade)
+	}
+}
+
+func TestResolveShutdownGracePeriod(t *testing.T) {
+	for grace, expected := range map[time.Duration]time.Duration{
+		0:                DefaultShutdownGracePeriod,
+		-time.Second:     0,
+		10 * time.Second: 10 * time.Second,
+	} {
+		if got := ResolveShutdownGracePeriod(grace); got != expected {
+			t.Errorf("ResolveShutdownGracePeriod(%s) = %s, want %s", grace, got, expected)
+		}
+	}
+}
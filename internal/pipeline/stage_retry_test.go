@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// TestExecuteStageWithRetry verifies retryable stage failures are retried in the run
+// within max_retries and other failures are returned at once
+func TestExecuteStageWithRetry(t *testing.T) {
+	defer func(backoff time.Duration) { stageRetryBackoff = backoff }(stageRetryBackoff)
+	stageRetryBackoff = time.Millisecond
+
+	transient := fmt.Errorf("request timeout: %w", context.DeadlineExceeded)
+	permanent := errors.New("invalid arguments")
+
+	tests := []struct {
+		name          string
+		errs          []error // Returned by successive attempts; nil after the list
+		expectedCalls int
+		expectedRetry int // RetryCount recorded before the caller handles the result
+		expectErr     bool
+	}{
+		{"transient failure retried", []error{transient}, 2, 1, false},
+		{"retries exhausted", []error{transient, transient, transient, transient}, 3, 2, true},
+		{"permanent failure", []error{permanent}, 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			registry := NewStepRegistry()
+			err := registry.Register(types.StageCompose, func(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Register failed: %v", err)
+			}
+
+			p := NewPipeline(nil, nil, nil, nil, nil, false, 3, filepath.Join(t.TempDir(), "manifest.json"), "lightweight")
+			p.SetStepRegistry(registry)
+			manifest := NewManifest("test", types.PipelineInput{})
+
+			err = p.executeStageWithRetry(context.Background(), types.StageCompose, manifest)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d attempts, got %d", tt.expectedCalls, calls)
+			}
+			if count := manifest.GetStageState(types.StageCompose).RetryCount; count != tt.expectedRetry {
+				t.Errorf("Expected retry count %d, got %d", tt.expectedRetry, count)
+			}
+		})
+	}
+}
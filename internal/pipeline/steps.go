@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
+	"time"
 
+	"github.com/zhe.chen/agent-funpic-act/internal/activity"
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
 	"github.com/zhe.chen/agent-funpic-act/pkg/types"
 )
 
@@ -18,21 +21,47 @@ type StepFunc func(ctx context.Context, p *Pipeline, manifest *Manifest) error
 
 // ExecuteSegmentPerson - Use ImageSorcery detect + fill to remove background
 func ExecuteSegmentPerson(ctx context.Context, p *Pipeline, manifest *Manifest) error {
-	imagePath := manifest.Input.ImagePath
-
-	// Get absolute path
-	absPath, err := filepath.Abs(imagePath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
-	}
-
 	// Get confidence threshold from LLM decision (AI Agent feature)
 	confidence := 0.3 // default
 	if manifest.LLMAnalysis != nil && manifest.LLMAnalysis.Decision != nil {
 		if conf, ok := manifest.LLMAnalysis.Decision.Parameters["detect_confidence"].(float64); ok {
 			confidence = conf
-			log.Printf("[AI Agent] Using LLM confidence: %.2f", confidence)
+			if p.llmProvider != nil {
+				log.Printf("[AI Agent] Using LLM confidence: %.2f", confidence)
+			}
+		}
+	}
+
+	// Reuse the result from an earlier pipeline that segmented the same image. Per-person
+	// layers aren't cached, so per_person mode always segments.
+	cacheParams := map[string]interface{}{
+		"confidence":            confidence,
+		"max_process_dimension": p.maxProcessDimension,
+		"jpeg_quality":          p.jpegQuality,
+		"entry_version":         segmentCacheVersion,
+	}
+	if p.maxPolygonPoints > 0 {
+		cacheParams["max_polygon_points"] = p.maxPolygonPoints
+	}
+	format := p.segmentFormat()
+	if format != SegmentFormatPNG {
+		cacheParams["format"] = format
+	}
+	segmentedName := segmentedArtifactName(format)
+	cacheKey := p.stageCacheKey(manifest.Input.ImagePath, segmentCacheTool, cacheParams)
+	if entry, ok := p.lookupStageCache(cacheKey); ok && !p.perPerson() {
+		// The threshold isn't part of the key; check the cached detection against it
+		bestScore, _ := strconv.ParseFloat(entry.Data["best_score"], 64)
+		if err := p.checkSubjectConfidence(types.StageSegmentPerson, bestScore); err != nil {
+			return err
 		}
+		return completeSegmentFromCache(manifest, entry, segmentedName)
+	}
+
+	// Use a downscaled working copy for very large inputs
+	absPath, err := prepareProcessImage(ctx, p, manifest)
+	if err != nil {
+		return err
 	}
 
 	// Step 1: Detect person using ImageSorcery's detect tool with segmentation
@@ -43,7 +72,7 @@ func ExecuteSegmentPerson(ctx context.Context, p *Pipeline, manifest *Manifest)
 		"geometry_format": "polygon", // Get polygon coordinates
 	}
 
-	detectResult, err := p.imagesorceryClient.CallTool(ctx, "detect", detectArgs)
+	detectResult, err := callTool(ctx, "imagesorcery", p.imagesorceryClient, "detect", detectArgs)
 	if err != nil {
 		return fmt.Errorf("detect tool failed: %w", err)
 	}
@@ -61,72 +90,184 @@ func ExecuteSegmentPerson(ctx context.Context, p *Pipeline, manifest *Manifest)
 	// Extract detections array
 	detections, ok := response["detections"].([]interface{})
 	if !ok || len(detections) == 0 {
-		return fmt.Errorf("no detections found in image")
+		return fmt.Errorf("no detections found in image: %w", ErrNoSubjectDetected)
 	}
 
-	// Find the first person detection with polygon
-	var personPolygon []interface{}
-	for _, det := range detections {
-		detMap := det.(map[string]interface{})
-		if detMap["class"] == "person" {
-			if poly, exists := detMap["polygon"]; exists {
-				personPolygon = poly.([]interface{})
-				break
-			}
-		}
+	persons, bestScore := personDetections(detections)
+	if len(persons) == 0 {
+		return fmt.Errorf("no person with polygon found in image: %w", ErrNoSubjectDetected)
+	}
+	if err := p.checkSubjectConfidence(types.StageSegmentPerson, bestScore); err != nil {
+		return err
 	}
 
-	if len(personPolygon) == 0 {
-		return fmt.Errorf("no person with polygon found in image")
+	// Clean up the outlines before the fill tool sees them, clamped to the image when
+	// its size can be read
+	width, height, _ := readImageSize(absPath)
+	if persons, err = sanitizePersons(persons, width, height); err != nil {
+		return err
 	}
 
-	// Step 2: Use fill tool to make everything EXCEPT the person transparent
-	// When invert_areas=true with invert, the background is removed
-	// Use opacity=0 to make the background fully transparent
-	outputPath := filepath.Join(manifest.Input.TempDir, "segmented_person.png")
+	// Uniform mode keeps the first person; per_person mode keeps everyone, animating
+	// the max_people best scored and leaving the rest still
+	polygons := [][]interface{}{persons[0].polygon}
+	var animated, static []personDetection
+	subject := persons[0]
+	if p.perPerson() && len(persons) > 1 {
+		animated, static = rankPersons(persons, p.maxPeople())
+		polygons = polygonsOf(persons)
+		subject = animated[0]
+	}
 
-	// Convert to absolute path for ImageSorcery MCP server
-	absOutputPath, err := filepath.Abs(outputPath)
+	// Step 2: Use fill tool to make everything EXCEPT the people transparent
+	outputPath, err := stageArtifactPath(manifest, types.StageSegmentPerson, manifest.Input.TempDir, segmentedName)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute output path: %w", err)
+		return err
+	}
+	if outputPath, err = fillPeople(ctx, p, absPath, polygons, outputPath, segmentBackground(format)); err != nil {
+		return err
 	}
 
-	fillArgs := map[string]interface{}{
-		"input_path":   absPath,
-		"areas":        []map[string]interface{}{
-			{
-				"polygon": personPolygon,
-				"opacity": 0.0, // Fully transparent background
-			},
-		},
-		"invert_areas": true,  // Fill background (everything except person)
-		"output_path":  absOutputPath,
+	var subjects []Subject
+	var staticPath string
+	if len(animated) > 0 {
+		if subjects, staticPath, err = segmentSubjects(ctx, p, manifest, absPath, animated, static); err != nil {
+			return err
+		}
+		log.Printf("Segmented %d people for per-person animation (%d still)", len(subjects), len(static))
+	}
+
+	// The subject's share of the frame tunes the animation intensity, and its bounds
+	// position it over a placement background
+	area := subjectArea(subject.polygon, width, height)
+	bounds := polygonSubjectBounds(subject.polygon, width, height)
+
+	source := toolProvenance("imagesorcery", p.imagesorceryClient, "fill")
+	artifactPaths := []string{outputPath, staticPath}
+	for _, subject := range subjects {
+		artifactPaths = append(artifactPaths, subject.LayerPath)
+	}
+	artifactBytes := fileSizes(artifactPaths...)
+	stageOutput := map[string]interface{}{
+		"segmented_path": outputPath,
+		"provenance":     source,
+		"artifact_bytes": artifactBytes,
 	}
+	if area > 0 {
+		stageOutput["subject_area"] = area
+	}
+	if bounds != nil {
+		stageOutput["subject_bounds"] = bounds
+	}
+	if len(subjects) > 0 {
+		stageOutput["subjects"] = subjects
+		if staticPath != "" {
+			stageOutput["static_subjects_path"] = staticPath
+		}
+	}
+	if err := manifest.CompleteStage(types.StageSegmentPerson, stageOutput); err != nil {
+		return err
+	}
+
+	if manifest.Result == nil {
+		manifest.Result = &PipelineResult{}
+	}
+	manifest.Result.SegmentedImagePath = outputPath
+	manifest.Result.Subjects = subjects
+	manifest.Result.StaticSubjectsPath = staticPath
+	manifest.Result.SubjectArea = area
+	manifest.Result.SubjectBounds = bounds
+	manifest.Result.SetProvenance(ArtifactSegmentedImage, source)
+	manifest.Result.SetArtifactBytes(types.StageSegmentPerson, artifactBytes)
+	cleanSupersededAttempts(manifest.Input.TempDir, segmentedName, outputPath)
+
+	cacheData := map[string]string{
+		"best_score": strconv.FormatFloat(bestScore, 'g', -1, 64),
+	}
+	storeCachedProvenance(cacheData, source)
+	if manifest.ProcessImage != nil {
+		if data, err := json.Marshal(manifest.ProcessImage); err == nil {
+			cacheData["process_image"] = string(data)
+		}
+	}
+	if area > 0 {
+		cacheData["subject_area"] = strconv.FormatFloat(area, 'g', -1, 64)
+	}
+	if bounds != nil {
+		if data, err := json.Marshal(bounds); err == nil {
+			cacheData["subject_bounds"] = string(data)
+		}
+	}
+	if len(subjects) == 0 {
+		p.storeStageCache(cacheKey, segmentCacheTool, outputPath, cacheData)
+	}
+
+	return nil
+}
+
+// Base names of stage artifacts written to TempDir; each attempt gets its own file
+// (see attemptFileName)
+const (
+	segmentedFileName = "segmented_person.png" // .jpg with segment_output_format jpeg
+	motionFileName    = "headshake_animation.mp4"
+	musicFileName     = "music.mp3"
+
+	staticSubjectsFileName = "static_subjects.png" // People beyond max_people in per_person mode
+)
+
+// Cache tool identifiers for the cached stages
+const (
+	segmentCacheTool   = "imagesorcery.detect+fill"
+	landmarksCacheTool = "yolo.analyze_image_from_path"
+)
+
+// segmentCacheVersion is part of the segment cache key and goes up whenever entries
+// start recording data older entries lack, so those miss instead of completing the stage
+// without it. Version 2 records subject_bounds, version 3 best_score.
+const segmentCacheVersion = 3
 
-	fillResult, err := p.imagesorceryClient.CallTool(ctx, "fill", fillArgs)
+// completeSegmentFromCache completes the segment stage from a cached artifact, copied
+// to a file named segmentedName
+func completeSegmentFromCache(manifest *Manifest, entry *CacheEntry, segmentedName string) error {
+	outputPath, err := stageArtifactPath(manifest, types.StageSegmentPerson, manifest.Input.TempDir, segmentedName)
 	if err != nil {
-		return fmt.Errorf("fill tool failed: %w", err)
-	}
-
-	// Fill tool returns the output path as text
-	if len(fillResult.Content) > 0 {
-		resultText := fillResult.Content[0].Text
-		// Try parsing as JSON first
-		var fillResponse map[string]interface{}
-		if err := json.Unmarshal([]byte(resultText), &fillResponse); err == nil {
-			// It's JSON, extract output_path
-			if outputPathStr, ok := fillResponse["output_path"].(string); ok {
-				outputPath = outputPathStr
-			}
-		} else {
-			// It's plain text (file path)
-			outputPath = resultText
+		return err
+	}
+	if err := copyFile(entry.ArtifactPath(), outputPath); err != nil {
+		return fmt.Errorf("failed to copy cached segmentation: %w", err)
+	}
+
+	// Restore the scale so landmarks on the segmented image map back to the original
+	if data := entry.Data["process_image"]; data != "" {
+		var pi ProcessImage
+		if err := json.Unmarshal([]byte(data), &pi); err == nil {
+			manifest.ProcessImage = &pi
+		}
+	}
+
+	area, _ := strconv.ParseFloat(entry.Data["subject_area"], 64)
+	var bounds *SubjectBounds
+	if data := entry.Data["subject_bounds"]; data != "" {
+		if err := json.Unmarshal([]byte(data), &bounds); err != nil {
+			bounds = nil
 		}
 	}
 
-	if err := manifest.CompleteStage(types.StageSegmentPerson, map[string]string{
+	source := cachedProvenance(entry)
+	artifactBytes := fileSizes(outputPath)
+	stageOutput := map[string]interface{}{
 		"segmented_path": outputPath,
-	}); err != nil {
+		"provenance":     source,
+		"artifact_bytes": artifactBytes,
+		"cache_hit":      true,
+	}
+	if area > 0 {
+		stageOutput["subject_area"] = area
+	}
+	if bounds != nil {
+		stageOutput["subject_bounds"] = bounds
+	}
+	if err := manifest.CompleteStage(types.StageSegmentPerson, stageOutput); err != nil {
 		return err
 	}
 
@@ -134,7 +275,11 @@ func ExecuteSegmentPerson(ctx context.Context, p *Pipeline, manifest *Manifest)
 		manifest.Result = &PipelineResult{}
 	}
 	manifest.Result.SegmentedImagePath = outputPath
-
+	manifest.Result.SubjectArea = area
+	manifest.Result.SubjectBounds = bounds
+	manifest.Result.SetProvenance(ArtifactSegmentedImage, source)
+	manifest.Result.SetArtifactBytes(types.StageSegmentPerson, artifactBytes)
+	cleanSupersededAttempts(manifest.Input.TempDir, segmentedName, outputPath)
 	return nil
 }
 
@@ -143,26 +288,61 @@ func ExecuteEstimateLandmarks(ctx context.Context, p *Pipeline, manifest *Manife
 	// Get segmented image from previous stage, fallback to original if not available
 	imagePath := manifest.Result.SegmentedImagePath
 	if imagePath == "" {
-		imagePath = manifest.Input.ImagePath
+		processPath, err := prepareProcessImage(ctx, p, manifest)
+		if err != nil {
+			return err
+		}
+		imagePath = processPath
 	}
 
-	// Get confidence threshold from LLM decision (AI Agent feature)
-	confidence := 0.3 // default
-	if manifest.LLMAnalysis != nil && manifest.LLMAnalysis.Decision != nil {
-		if conf, ok := manifest.LLMAnalysis.Decision.Parameters["landmark_confidence"].(float64); ok {
-			confidence = conf
-			log.Printf("[AI Agent] Using LLM landmark confidence: %.2f", confidence)
-		}
+	// Landmarks are relative to the working copy; record the scale to map them back
+	scaleFactor := 1.0
+	if manifest.ProcessImage != nil {
+		scaleFactor = manifest.ProcessImage.ScaleFactor
 	}
 
+	// Configured pose model and confidence; the LLM decision's parameters win
+	model, confidence := p.landmarksParameters(manifest)
+
 	// Use YOLO's analyze_image_from_path with pose model
 	args := map[string]interface{}{
 		"image_path": imagePath,
-		"model_name": "yolov8n-pose.pt",
-		"confidence": confidence, // Dynamic parameter from LLM
+		"model_name": model,
+		"confidence": confidence,
+	}
+
+	// Reuse landmarks from an earlier pipeline that analyzed the same image
+	cacheKey := p.stageCacheKey(imagePath, landmarksCacheTool, map[string]interface{}{
+		"model_name": args["model_name"],
+		"confidence": confidence,
+	})
+	if entry, ok := p.lookupStageCache(cacheKey); ok {
+		landmarksJSON := entry.Data["landmarks"]
+		if err := p.checkPoseDetections(landmarksJSON); err != nil {
+			return err
+		}
+		source := cachedProvenance(entry)
+		if err := manifest.CompleteStage(types.StageLandmarks, map[string]interface{}{
+			"landmarks":    landmarksJSON,
+			"scale_factor": scaleFactor,
+			"model_name":   model,
+			"confidence":   confidence,
+			"provenance":   source,
+			"cache_hit":    true,
+		}); err != nil {
+			return err
+		}
+		manifest.Result.LandmarksData = landmarksJSON
+		manifest.Result.LandmarksScale = scaleFactor
+		manifest.Result.SetProvenance(ArtifactLandmarks, source)
+		return nil
+	}
+
+	if err := p.checkLandmarksModel(ctx, model); err != nil {
+		return err
 	}
 
-	result, err := p.yoloClient.CallTool(ctx, "analyze_image_from_path", args)
+	result, err := callTool(ctx, "yolo", p.yoloClient, "analyze_image_from_path", args)
 	if err != nil {
 		return fmt.Errorf("analyze_image_from_path (pose) tool failed: %w", err)
 	}
@@ -173,9 +353,17 @@ func ExecuteEstimateLandmarks(ctx context.Context, p *Pipeline, manifest *Manife
 	}
 
 	landmarksJSON := result.Content[0].Text
+	if err := p.checkPoseDetections(landmarksJSON); err != nil {
+		return err
+	}
 
+	source := toolProvenance("yolo", p.yoloClient, "analyze_image_from_path")
 	output := map[string]interface{}{
-		"landmarks": landmarksJSON,
+		"landmarks":    landmarksJSON,
+		"scale_factor": scaleFactor,
+		"model_name":   model,
+		"confidence":   confidence,
+		"provenance":   source,
 	}
 
 	if err := manifest.CompleteStage(types.StageLandmarks, output); err != nil {
@@ -184,52 +372,216 @@ func ExecuteEstimateLandmarks(ctx context.Context, p *Pipeline, manifest *Manife
 
 	// Store in final result
 	manifest.Result.LandmarksData = landmarksJSON
+	manifest.Result.LandmarksScale = scaleFactor
+	manifest.Result.SetProvenance(ArtifactLandmarks, source)
+
+	cacheData := map[string]string{
+		"landmarks": landmarksJSON,
+	}
+	storeCachedProvenance(cacheData, source)
+	p.storeStageCache(cacheKey, landmarksCacheTool, "", cacheData)
 
 	return nil
 }
 
-// ExecuteRenderMotion generates "happy head shake" animation using FFmpeg rotate
+// checkPoseDetections distinguishes "no person" from tool failures when the pose
+// response lists detections, counting only those with min_keypoints visible keypoints
+func (p *Pipeline) checkPoseDetections(landmarksJSON string) error {
+	var landmarksDoc interface{}
+	if err := json.Unmarshal([]byte(landmarksJSON), &landmarksDoc); err != nil {
+		return nil
+	}
+	count, bestScore, ok := poseDetectionStats(landmarksDoc, p.landmarksConfig.MinKeypoints)
+	if !ok {
+		return nil
+	}
+	if count == 0 {
+		if p.landmarksConfig.MinKeypoints > 0 {
+			return fmt.Errorf("pose estimation found no person with %d visible keypoints: %w",
+				p.landmarksConfig.MinKeypoints, ErrNoSubjectDetected)
+		}
+		return fmt.Errorf("pose estimation found no person: %w", ErrNoSubjectDetected)
+	}
+	return p.checkSubjectConfidence(types.StageLandmarks, bestScore)
+}
+
+// ExecuteRenderMotion renders the animation plan with FFmpeg. The default plan is a
+// single "happy head shake" rotation; longer plans are rendered segment by segment
+// and concatenated. FFmpeg runs under the pipeline's stage timeout.
 func ExecuteRenderMotion(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+	return p.withStageTimeout(ctx, types.StageRenderMotion, func(ctx context.Context) error {
+		return renderMotion(ctx, p, manifest)
+	})
+}
+
+// renderMotion renders the animation plan for ExecuteRenderMotion
+func renderMotion(ctx context.Context, p *Pipeline, manifest *Manifest) error {
 	imagePath := manifest.Result.SegmentedImagePath
 	if imagePath == "" {
 		imagePath = manifest.Input.ImagePath
 	}
+	// Put the cutout over the configured background; the frame takes the background's size
+	imagePath, placement, err := p.compositeOverBackground(ctx, manifest, imagePath)
+	if err != nil {
+		return err
+	}
 
-	duration := manifest.Input.Duration
-	outputPath := filepath.Join(manifest.Input.TempDir, "headshake_animation.mp4")
+	duration, durationSource, err := p.motionDuration(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	plan, tuning, err := animationPlanFor(manifest, duration)
+	if err != nil {
+		return err
+	}
+	if tuning.Source == IntensitySourceAuto {
+		log.Printf("Animation intensity scaled by %.2f for a subject covering %.0f%% of the frame",
+			tuning.Factor, tuning.SubjectArea*100)
+	}
 
-	// Use FFmpeg to create rotation animation (head shake effect)
-	// Rotate angle: -10 to +10 degrees, 2 complete cycles
-	rotateExpr := "rotate=10*PI/180*sin(4*PI*t):c=none"
+	// Pin every segment to the same size so they concatenate without re-encoding
+	width, height, err := readImageSize(imagePath)
+	if err != nil {
+		log.Printf("Warning: cannot read image size, keeping ffmpeg's output size: %v", err)
+		width, height = 0, 0
+	}
+	spec, err := newRenderSpec(width, height, p.renderConfig)
+	if err != nil {
+		return err
+	}
+	motionName := motionArtifactName(motionFileName, spec.pixFmt)
 
-	cmd := exec.CommandContext(ctx, "ffmpeg",
-		"-loop", "1",
-		"-i", imagePath,
-		"-vf", rotateExpr,
-		"-t", strconv.FormatFloat(duration, 'f', 1, 64),
-		"-r", "15", // 15 fps
-		"-pix_fmt", "yuv420p",
-		"-y",
-		outputPath,
-	)
+	buildArgs := func(outputPath string, segment types.AnimationSegment) ([]string, error) {
+		return segmentArgs(imagePath, outputPath, segment, spec)
+	}
+	// Per-person mode places each subject's layer on the frame, which needs its size
+	if subjects := manifest.Result.Subjects; len(subjects) > 0 {
+		if width > 0 && height > 0 {
+			staticPath := manifest.Result.StaticSubjectsPath
+			buildArgs = func(outputPath string, segment types.AnimationSegment) ([]string, error) {
+				return subjectSegmentArgs(subjects, staticPath, outputPath, segment, spec)
+			}
+			log.Printf("Animating %d people independently", len(subjects))
+		} else {
+			log.Printf("Warning: animating the whole frame, per-person animation needs the image size")
+		}
+	}
+	segmentName := func(i int) string {
+		return motionArtifactName(fmt.Sprintf("motion_segment%d.mp4", i+1), spec.pixFmt)
+	}
 
-	output, err := cmd.CombinedOutput()
+	outputPath, err := stageArtifactPath(manifest, types.StageRenderMotion, manifest.Input.TempDir, motionName)
 	if err != nil {
-		return fmt.Errorf("ffmpeg head shake failed: %w, output: %s", err, output)
+		return err
 	}
+	partialOutputPath := partialPath(outputPath)
 
-	if err := manifest.CompleteStage(types.StageRenderMotion, map[string]string{
-		"video_path": outputPath,
-	}); err != nil {
+	if err := checkDiskSpace(manifest.Input.TempDir, estimateMotionBytes(width, height, duration, len(plan))); err != nil {
+		return err
+	}
+
+	var segmentPaths []string
+	if len(plan) == 1 {
+		if err := renderSegment(ctx, buildArgs, partialOutputPath, plan[0], spec); err != nil {
+			return err
+		}
+	} else {
+		for i, segment := range plan {
+			segmentPath, err := stageArtifactPath(manifest, types.StageRenderMotion, manifest.Input.TempDir, segmentName(i))
+			if err != nil {
+				return err
+			}
+			log.Printf("Rendering animation segment %d/%d: %s for %.2fs", i+1, len(plan), segment.Type, segment.Duration)
+			if err := renderSegment(ctx, buildArgs, partialPath(segmentPath), segment, spec); err != nil {
+				return err
+			}
+			if err := commitArtifact(partialPath(segmentPath), segmentPath); err != nil {
+				return err
+			}
+			segmentPaths = append(segmentPaths, segmentPath)
+		}
+
+		listPath, err := stageArtifactPath(manifest, types.StageRenderMotion, manifest.Input.TempDir, "motion_segments.txt")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(listPath, []byte(concatListContent(segmentPaths)), 0644); err != nil {
+			return fmt.Errorf("failed to write concat list: %w", err)
+		}
+		cmd := procgroup.CommandContext(ctx, "ffmpeg", concatArgs(listPath, partialOutputPath)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(partialOutputPath)
+			return fmt.Errorf("ffmpeg concat failed: %w, output: %s", err, output)
+		}
+	}
+	if err := commitArtifact(partialOutputPath, outputPath); err != nil {
+		return err
+	}
+
+	source := localProvenance("ffmpeg")
+	artifactBytes := fileSizes(append([]string{outputPath}, segmentPaths...)...)
+	stageOutput := map[string]interface{}{
+		"video_path":      outputPath,
+		"provenance":      source,
+		"plan":            plan,
+		"duration":        duration,
+		"duration_source": durationSource,
+		"artifact_bytes":  artifactBytes,
+		"intensity":       tuning,
+	}
+	if len(segmentPaths) > 0 {
+		stageOutput["segments"] = segmentPaths
+	}
+	if placement != nil {
+		stageOutput["placed_image_path"] = imagePath
+		stageOutput["placement"] = placement
+	}
+	if err := manifest.CompleteStage(types.StageRenderMotion, stageOutput); err != nil {
 		return err
 	}
 
 	manifest.Result.MotionVideoPath = outputPath
+	manifest.Result.SetProvenance(ArtifactMotionVideo, source)
+	manifest.Result.SetArtifactBytes(types.StageRenderMotion, artifactBytes)
+	cleanSupersededAttempts(manifest.Input.TempDir, motionName, outputPath)
+	// Concat lists are only needed while rendering, so every attempt's list goes
+	cleanSupersededAttempts(manifest.Input.TempDir, "motion_segments.txt", "")
+	for i := range segmentPaths {
+		cleanSupersededAttempts(manifest.Input.TempDir, segmentName(i), segmentPaths[i])
+	}
+	return nil
+}
+
+// segmentArgsFunc builds the ffmpeg arguments rendering one animation segment to outputPath
+type segmentArgsFunc func(outputPath string, segment types.AnimationSegment) ([]string, error)
+
+// renderSegment renders one animation segment to outputPath
+func renderSegment(ctx context.Context, buildArgs segmentArgsFunc, outputPath string, segment types.AnimationSegment, spec renderSpec) error {
+	args, err := buildArgs(outputPath, segment)
+	if err != nil {
+		return err
+	}
+	cmd := procgroup.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		if pixErr := pixelFormatError(output, spec.pixFmt); pixErr != nil {
+			return fmt.Errorf("ffmpeg %s animation failed: %w", segment.Type, pixErr)
+		}
+		return fmt.Errorf("ffmpeg %s animation failed: %w, output: %s", segment.Type, err, output)
+	}
 	return nil
 }
 
 // ExecuteSearchMusic searches for happy music from Epidemic Sound
 func ExecuteSearchMusic(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+	// User-supplied audio replaces the search
+	if manifest.Input.AudioPath != "" {
+		log.Printf("Using user-supplied audio %s, skipping music search", manifest.Input.AudioPath)
+		manifest.SkipStage(types.StageSearchMusic)
+		manifest.Result.MusicTracks = []string{}
+		return nil
+	}
+
 	// Get music parameters from LLM decision (AI Agent feature)
 	musicCount := 5 // default
 	musicMood := "happy" // default
@@ -240,7 +592,11 @@ func ExecuteSearchMusic(ctx context.Context, p *Pipeline, manifest *Manifest) er
 		if mood := manifest.LLMAnalysis.Decision.MusicMood; mood != "" {
 			musicMood = mood
 		}
-		log.Printf("[AI Agent] Searching for %s music (count: %d)", musicMood, musicCount)
+		if p.llmProvider != nil {
+			log.Printf("[AI Agent] Searching for %s music (count: %d)", musicMood, musicCount)
+		} else {
+			log.Printf("Searching for %s music (count: %d)", musicMood, musicCount)
+		}
 	} else {
 		log.Println("Searching for music from Epidemic Sound...")
 	}
@@ -253,11 +609,20 @@ func ExecuteSearchMusic(ctx context.Context, p *Pipeline, manifest *Manifest) er
 	}
 
 	log.Printf("Calling Epidemic Sound 'SearchRecordings' tool")
-	result, err := p.musicClient.CallTool(ctx, "SearchRecordings", args)
+	result, err := callTool(ctx, "music", p.musicClient, "SearchRecordings", args)
+	if client.IsAuthError(err) {
+		result, err = retryWithFreshCredentials(ctx, "music", p.musicClient, "SearchRecordings", args, err)
+	}
 	if err != nil {
-		log.Printf("Music search failed (will skip music): %v", err)
 		// If search fails (e.g., token expired), skip music
-		manifest.SkipStage(types.StageSearchMusic)
+		if client.IsAuthError(err) {
+			warning := "Music search was not authorized, so the video has no music: the music credentials need renewal"
+			log.Printf("Warning: %s (%v)", warning, err)
+			manifest.Result.Warnings = append(manifest.Result.Warnings, warning)
+		} else {
+			log.Printf("Music search failed (will skip music): %v", err)
+		}
+		manifest.SkipFailedStage(types.StageSearchMusic, err)
 		manifest.Result.MusicTracks = []string{}
 		return nil
 	}
@@ -287,6 +652,7 @@ func ExecuteSearchMusic(ctx context.Context, p *Pipeline, manifest *Manifest) er
 
 	stageData := map[string]interface{}{
 		"track_count": len(musicTracks),
+		"provenance":  toolProvenance("music", p.musicClient, "SearchRecordings"),
 	}
 	if len(result.Content) > 0 {
 		stageData["data"] = result.Content[0].Text
@@ -299,8 +665,41 @@ func ExecuteSearchMusic(ctx context.Context, p *Pipeline, manifest *Manifest) er
 	return nil
 }
 
-// ExecuteCompose performs final video composition using video-audio-mcp
+// retryWithFreshCredentials calls a tool once more after its server rejected the
+// client's credentials, if refreshing them produced new ones. Otherwise authErr stands.
+func retryWithFreshCredentials(ctx context.Context, server string, mcpClient client.MCPClient, tool string, args map[string]interface{}, authErr error) (*types.ToolCallResult, error) {
+	refreshed, err := client.RefreshCredentials(ctx, mcpClient)
+	if err != nil {
+		log.Printf("Warning: refreshing credentials for %s failed: %v", tool, err)
+		return nil, authErr
+	}
+	if !refreshed {
+		return nil, authErr
+	}
+	log.Printf("%s was not authorized, retrying with refreshed credentials", tool)
+	return callTool(ctx, server, mcpClient, tool, args)
+}
+
+// callTool calls tool on a stage's MCP server, registering the call as in flight
+// for status dumps while it runs
+func callTool(ctx context.Context, server string, mcpClient client.MCPClient, tool string, args map[string]interface{}) (*types.ToolCallResult, error) {
+	defer activity.Default.StartToolCall(activity.PipelineID(ctx), server, tool)()
+	start := time.Now()
+	result, err := mcpClient.CallTool(ctx, tool, args)
+	chromeTraceFrom(ctx).toolCall(server, tool, start, time.Now(), err)
+	return result, err
+}
+
+// ExecuteCompose performs final video composition using video-audio-mcp. The music
+// download and FFmpeg run under the pipeline's stage timeout.
 func ExecuteCompose(ctx context.Context, p *Pipeline, manifest *Manifest) error {
+	return p.withStageTimeout(ctx, types.StageCompose, func(ctx context.Context) error {
+		return compose(ctx, p, manifest)
+	})
+}
+
+// compose builds the final video for ExecuteCompose
+func compose(ctx context.Context, p *Pipeline, manifest *Manifest) error {
 	log.Println("Composing final video with music...")
 
 	// Determine video source
@@ -313,107 +712,215 @@ func ExecuteCompose(ctx context.Context, p *Pipeline, manifest *Manifest) error
 		}
 	}
 
-	outputPath := filepath.Join(manifest.Input.OutputDir, "final_output.mp4")
-
-	// Check if we have music data from the search stage
-	stageData := manifest.Stages[types.StageSearchMusic]
-	if stageData != nil && len(stageData.Output) > 0 {
-		// Parse the Output json.RawMessage into a map
-		var stageOutput map[string]interface{}
-		if err := json.Unmarshal(stageData.Output, &stageOutput); err != nil {
-			log.Printf("Failed to parse stage output: %v", err)
-		} else if musicDataStr, ok := stageOutput["data"].(string); ok && musicDataStr != "" {
-			log.Println("Found music data, extracting track URL...")
-
-			// Parse the JSON to extract the first track's audio URL
-			var musicResp struct {
-				Data struct {
-					Recordings struct {
-						Nodes []struct {
-							Recording struct {
-								Title     string `json:"title"`
-								AudioFile struct {
-									Lqmp3Url string `json:"lqmp3Url"`
-								} `json:"audioFile"`
-							} `json:"recording"`
-						} `json:"nodes"`
-					} `json:"recordings"`
-				} `json:"data"`
+	outputConfig, err := ResolveOutputConfig(p.outputConfig)
+	if err != nil {
+		return fmt.Errorf("invalid output config: %w", err)
+	}
+	outputPath := filepath.Join(manifest.Input.OutputDir, outputFileName(outputConfig))
+	musicQuality := ""
+	var musicSource *types.ToolProvenance
+
+	// Everything is written to a partial file renamed into place at the end, so a
+	// leftover from a failed attempt is never mistaken for a finished output. Only a
+	// partial file the compose progress records as muxed is picked up again.
+	partialOutputPath := partialPath(outputPath)
+	progress := manifest.composeProgress()
+	muxed := progress.MuxedPath == partialOutputPath && fileExists(partialOutputPath)
+	if !muxed {
+		os.Remove(partialOutputPath)
+		progress.MuxedPath, progress.MusicQuality = "", ""
+	}
+
+	titleMetadata := p.titleMetadata && manifest.Result.ImageDescription != ""
+	if !muxed {
+		if err := checkDiskSpace(manifest.Input.OutputDir, estimateComposeBytes(videoSource, manifest.Input.Duration, titleMetadata)); err != nil {
+			return err
+		}
+		if manifest.Input.AudioPath == "" && manifest.Stages[types.StageSearchMusic] != nil && progress.MusicPath == "" {
+			if err := checkDiskSpace(manifest.Input.TempDir, musicDownloadAllowance+diskSpaceMargin); err != nil {
+				return err
 			}
+		}
+	}
 
-			if err := json.Unmarshal([]byte(musicDataStr), &musicResp); err != nil {
-				log.Printf("Failed to parse music data: %v, continuing without music", err)
-			} else if len(musicResp.Data.Recordings.Nodes) > 0 {
-				// Get the first track (could filter for "happy" mood later)
-				track := musicResp.Data.Recordings.Nodes[0].Recording
-				musicURL := track.AudioFile.Lqmp3Url
-				trackTitle := track.Title
-
-				log.Printf("Selected track: '%s'", trackTitle)
-				log.Printf("Downloading music from: %s", musicURL)
-
-				// Download music file
-				musicPath := "/tmp/temp_music.mp3"
-				cmd := exec.CommandContext(ctx, "curl", "-L", "-o", musicPath, musicURL)
-				if err := cmd.Run(); err != nil {
-					log.Printf("Failed to download music: %v, continuing without music", err)
-				} else {
-					log.Println("Music downloaded successfully")
-
-					// Use ffmpeg to add audio to video
-					// -i video.mp4 -i audio.mp3 -c:v copy -c:a aac -shortest output.mp4
-					log.Println("Adding music to video with ffmpeg...")
-					cmd = exec.CommandContext(ctx, "ffmpeg", "-y",
-						"-i", videoSource,
-						"-i", musicPath,
-						"-c:v", "copy",
-						"-c:a", "aac",
-						"-shortest",
-						"-map", "0:v:0",
-						"-map", "1:a:0",
-						outputPath)
-
-					output, err := cmd.CombinedOutput()
-					if err != nil {
-						log.Printf("ffmpeg failed: %v\nOutput: %s", err, string(output))
-						log.Println("Falling back to video without audio")
-						// Copy video without audio as fallback
-						cmd = exec.CommandContext(ctx, "cp", videoSource, outputPath)
-						if err := cmd.Run(); err != nil {
-							return fmt.Errorf("failed to copy output: %w", err)
-						}
-					} else {
-						log.Println("Successfully added music to video!")
-					}
-
-					// Clean up temp music file
-					os.Remove(musicPath)
-				}
+	// addMusic muxes musicPath into the video, falling back to the video alone as the
+	// compose failure policy allows. It reports whether the music made it in.
+	addMusic := func(musicPath string) (bool, error) {
+		// Use ffmpeg to add audio to video
+		// -i video.mp4 -i audio.mp3 -c:v copy -c:a aac -shortest output.mp4
+		log.Println("Adding music to video with ffmpeg...")
+		fallback, err := muxWithPolicy(ctx, p.composeFailure, func() ([]byte, error) {
+			return runMux(ctx, composeArgs(videoSource, musicPath, partialOutputPath, outputConfig))
+		})
+
+		switch {
+		case err != nil:
+			os.Remove(partialOutputPath)
+			return false, err
+		case fallback:
+			// Copy video without audio as fallback
+			return false, writeVideoOnly(ctx, videoSource, partialOutputPath, outputConfig)
+		default:
+			log.Println("Successfully added music to video!")
+			return true, nil
+		}
+	}
+
+	if muxed {
+		log.Printf("Reusing the video muxed by an earlier attempt: %s", partialOutputPath)
+		musicQuality = progress.MusicQuality
+		if musicQuality != "" && musicQuality != MusicQualityUser && progress.Track != nil {
+			musicSource = p.musicProvenance(*progress.Track)
+		}
+	} else if audioPath := manifest.Input.AudioPath; audioPath != "" {
+		// User-supplied audio takes the place of the searched music
+		if err := checkAudioFile(audioPath); err != nil {
+			return err
+		}
+		log.Printf("Using user-supplied audio: %s", audioPath)
+		added, err := addMusic(audioPath)
+		if err != nil {
+			return err
+		}
+		if added {
+			musicQuality = MusicQualityUser
+		}
+	} else {
+		// Music from the search stage, selected and downloaded once across attempts
+		track, musicPath, err := p.prepareComposeMusic(ctx, manifest, progress)
+		if err != nil {
+			return err
+		}
+		if musicPath != "" {
+			added, err := addMusic(musicPath)
+			if err != nil {
+				// The download is kept for the next attempt
+				return err
+			}
+
+			// Clean up temp music file
+			os.Remove(musicPath)
+			progress.MusicPath = ""
+
+			if added {
+				musicQuality = track.Quality
+				musicSource = p.musicProvenance(*track)
 			}
 		}
 	}
 
 	// If no music was added, just copy the video
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+	if _, err := os.Stat(partialOutputPath); os.IsNotExist(err) {
 		log.Println("No music added, using video without audio")
-		cmd := exec.CommandContext(ctx, "cp", videoSource, outputPath)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to copy output: %w", err)
+		if err := writeVideoOnly(ctx, videoSource, partialOutputPath, outputConfig); err != nil {
+			return err
 		}
 	}
+	progress.MuxedPath, progress.MusicQuality = partialOutputPath, musicQuality
 
-	if err := manifest.CompleteStage(types.StageCompose, map[string]string{
-		"final_path": outputPath,
-	}); err != nil {
+	// Custom formats are checked so a silently ignored codec fails the stage
+	if !isDefaultOutput(outputConfig) {
+		if err := verifyOutputCodecs(ctx, partialOutputPath, outputConfig, musicQuality != ""); err != nil {
+			return fmt.Errorf("output verification failed: %w", err)
+		}
+		log.Printf("Verified output codecs: %s/%s in %s", outputConfig.VideoCodec, outputConfig.AudioCodec, outputConfig.Container)
+	}
+
+	if titleMetadata {
+		if err := writeTitleMetadata(ctx, partialOutputPath, manifest.Result.ImageDescription); err != nil {
+			log.Printf("Warning: failed to write title metadata: %v", err)
+		}
+	}
+
+	// Content-hash names change only when the bytes do, so caches never serve a stale file
+	var contentHash string
+	isTemplate := isOutputNameTemplate(outputConfig.Name)
+	if outputConfig.Name == OutputNameContentHash || (isTemplate && templateUsesHash(outputConfig.Name)) {
+		if contentHash, err = HashFile(partialOutputPath); err != nil {
+			return err
+		}
+	}
+	switch {
+	case isTemplate:
+		outputPath = filepath.Join(manifest.Input.OutputDir, renderOutputName(outputConfig.Name, outputNameValues(manifest, musicQuality, contentHash)))
+		log.Printf("Final output named from %q: %s", outputConfig.Name, filepath.Base(outputPath))
+	case contentHash != "":
+		outputPath = filepath.Join(manifest.Input.OutputDir, contentHashFileName(contentHash, outputConfig))
+	}
+	if err := commitArtifact(partialOutputPath, outputPath); err != nil {
+		return err
+	}
+	var latestPath string
+	if outputConfig.Name == OutputNameContentHash {
+		if latestPath, err = linkLatestOutput(outputPath, outputConfig); err != nil {
+			return err
+		}
+		log.Printf("Final output %s (sha256 %s), linked from %s", filepath.Base(outputPath), contentHash, filepath.Base(latestPath))
+	}
+
+	captions := p.writeCaptions(ctx, manifest, outputPath)
+
+	// The comparison is an extra for demos: failing to write it doesn't fail the run
+	var comparison string
+	if p.comparisonConfig.Enabled {
+		comparison, err = writeComparison(ctx, outputPath, manifest.Input.ImagePath, p.comparisonConfig, p.captionConfig)
+		if err != nil {
+			warning := "The before/after comparison video could not be written"
+			log.Printf("Warning: %s: %v", warning, err)
+			manifest.Result.Warnings = append(manifest.Result.Warnings, warning)
+		} else {
+			log.Printf("Wrote before/after comparison: %s", comparison)
+		}
+	}
+
+	source := localProvenance("ffmpeg")
+	artifactBytes := fileSizes(append([]string{outputPath, comparison}, captions...)...)
+	composeOutput := map[string]interface{}{
+		"final_path":     outputPath,
+		"provenance":     source,
+		"artifact_bytes": artifactBytes,
+	}
+	if contentHash != "" {
+		composeOutput["content_hash"] = contentHash
+	}
+	if latestPath != "" {
+		composeOutput["latest_path"] = latestPath
+	}
+	if comparison != "" {
+		composeOutput["comparison_path"] = comparison
+	}
+	if len(captions) > 0 {
+		composeOutput["caption_paths"] = captions
+	}
+	if musicQuality != "" {
+		composeOutput["music_quality"] = musicQuality
+	}
+	if musicSource != nil {
+		composeOutput["music_provenance"] = musicSource
+	}
+	if err := manifest.CompleteStage(types.StageCompose, composeOutput); err != nil {
 		return err
 	}
 
 	manifest.Result.FinalOutputPath = outputPath
+	manifest.Result.ContentHash = contentHash
+	manifest.Result.LatestOutputPath = latestPath
+	manifest.Result.ComparisonPath = comparison
+	manifest.Result.CaptionPaths = captions
+	manifest.Result.MusicQuality = musicQuality
+	manifest.Result.SetProvenance(ArtifactFinalOutput, source)
+	manifest.Result.SetProvenance(ArtifactMusic, musicSource)
+	manifest.Result.SetArtifactBytes(types.StageCompose, artifactBytes)
 	return nil
 }
 
-// GetStepForStage returns the step function for a given stage
+// GetStepForStage returns the step function for a given stage.
+// Steps registered in DefaultStepRegistry take precedence over the built-in steps.
 func GetStepForStage(stage types.PipelineStage) (StepFunc, error) {
+	if step, ok := DefaultStepRegistry.Lookup(stage); ok {
+		return step, nil
+	}
+
 	switch stage {
 	case types.StageSegmentPerson:
 		return ExecuteSegmentPerson, nil
@@ -0,0 +1,331 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Subject modes: how render_motion animates photos with several people
+const (
+	SubjectModeUniform   = "uniform"    // Animate the whole frame as one (default)
+	SubjectModePerPerson = "per_person" // Animate each detected person on their own
+)
+
+// DefaultMaxPeople is how many people per_person mode animates when max_people is unset
+const DefaultMaxPeople = 4
+
+// subjectMargin is the fraction of a person's bounding box added on each side, so
+// motion near the edges isn't clipped by the crop
+const subjectMargin = 0.1
+
+// Subject is one person animated independently in per_person mode. The box is in
+// the segmented image's pixels.
+type Subject struct {
+	Score     float64 `json:"score,omitempty"`
+	X         int     `json:"x"`
+	Y         int     `json:"y"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	LayerPath string  `json:"layer_path"` // The person alone on a transparent background
+}
+
+// personDetection is a person polygon from the detect tool
+type personDetection struct {
+	polygon []interface{}
+	score   float64
+}
+
+// ResolveSubjectConfig fills in the default mode and max_people and rejects unknown modes
+func ResolveSubjectConfig(config types.SubjectConfig) (types.SubjectConfig, error) {
+	config.Mode = strings.ToLower(strings.TrimSpace(config.Mode))
+	switch config.Mode {
+	case "":
+		config.Mode = SubjectModeUniform
+	case SubjectModeUniform, SubjectModePerPerson:
+	default:
+		return config, fmt.Errorf("unknown subjects mode %q (supported: %s, %s)",
+			config.Mode, SubjectModeUniform, SubjectModePerPerson)
+	}
+
+	if config.MaxPeople < 0 {
+		return config, fmt.Errorf("max_people must not be negative, got %d", config.MaxPeople)
+	}
+	if config.MaxPeople == 0 {
+		config.MaxPeople = DefaultMaxPeople
+	}
+	return config, nil
+}
+
+// perPerson reports whether group photos are animated person by person
+func (p *Pipeline) perPerson() bool {
+	return p.subjectConfig.Mode == SubjectModePerPerson
+}
+
+// maxPeople returns how many people per_person mode animates
+func (p *Pipeline) maxPeople() int {
+	if p.subjectConfig.MaxPeople > 0 {
+		return p.subjectConfig.MaxPeople
+	}
+	return DefaultMaxPeople
+}
+
+// personDetections returns the person detections with a polygon, in detection order,
+// and the best person score
+func personDetections(detections []interface{}) ([]personDetection, float64) {
+	var persons []personDetection
+	bestScore := 0.0
+	for _, det := range detections {
+		detMap, ok := det.(map[string]interface{})
+		if !ok || detMap["class"] != "person" {
+			continue
+		}
+		score, _ := detMap["confidence"].(float64)
+		bestScore = math.Max(bestScore, score)
+		if poly, ok := detMap["polygon"].([]interface{}); ok && len(poly) > 0 {
+			persons = append(persons, personDetection{polygon: poly, score: score})
+		}
+	}
+	return persons, bestScore
+}
+
+// rankPersons orders persons by detection score and splits off those beyond max, which
+// stay in the frame without their own motion
+func rankPersons(persons []personDetection, max int) (animated, static []personDetection) {
+	ranked := append([]personDetection(nil), persons...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if len(ranked) <= max {
+		return ranked, nil
+	}
+	return ranked[:max], ranked[max:]
+}
+
+// polygonsOf returns the polygons of persons for the fill tool
+func polygonsOf(persons []personDetection) [][]interface{} {
+	polygons := make([][]interface{}, len(persons))
+	for i, person := range persons {
+		polygons[i] = person.polygon
+	}
+	return polygons
+}
+
+// polygonBounds returns the bounding box of a polygon of [x, y] points
+func polygonBounds(polygon []interface{}) (minX, minY, maxX, maxY float64, ok bool) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, point := range polygon {
+		coords, isList := point.([]interface{})
+		if !isList || len(coords) < 2 {
+			return 0, 0, 0, 0, false
+		}
+		x, xOK := coords[0].(float64)
+		y, yOK := coords[1].(float64)
+		if !xOK || !yOK {
+			return 0, 0, 0, 0, false
+		}
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	return minX, minY, maxX, maxY, len(polygon) > 0
+}
+
+// subjectBox returns a person's crop box: the polygon's bounds widened by subjectMargin
+// and clamped to the image. Without the image size the box is only clamped at 0.
+func subjectBox(polygon []interface{}, width, height int) (Subject, error) {
+	minX, minY, maxX, maxY, ok := polygonBounds(polygon)
+	if !ok {
+		return Subject{}, fmt.Errorf("person polygon is not a list of [x, y] points")
+	}
+	marginX := (maxX - minX) * subjectMargin
+	marginY := (maxY - minY) * subjectMargin
+
+	x0 := int(math.Max(0, math.Floor(minX-marginX)))
+	y0 := int(math.Max(0, math.Floor(minY-marginY)))
+	x1 := int(math.Ceil(maxX + marginX))
+	y1 := int(math.Ceil(maxY + marginY))
+	if width > 0 {
+		x1 = min(x1, width)
+	}
+	if height > 0 {
+		y1 = min(y1, height)
+	}
+	if x1 <= x0 || y1 <= y0 {
+		return Subject{}, fmt.Errorf("person polygon has an empty bounding box")
+	}
+	return Subject{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}, nil
+}
+
+// segmentSubjects cuts each animated person out to their own layer, and the people
+// beyond max_people to one static layer, both in the segmented image's coordinates
+func segmentSubjects(ctx context.Context, p *Pipeline, manifest *Manifest, imagePath string, animated, static []personDetection) ([]Subject, string, error) {
+	width, height, err := readImageSize(imagePath)
+	if err != nil {
+		width, height = 0, 0
+	}
+
+	subjects := make([]Subject, 0, len(animated))
+	for i, person := range animated {
+		subject, err := subjectBox(person.polygon, width, height)
+		if err != nil {
+			return nil, "", fmt.Errorf("subject %d: %w", i+1, err)
+		}
+		layerName := fmt.Sprintf("subject%d.png", i+1)
+		layerPath, err := stageArtifactPath(manifest, types.StageSegmentPerson, manifest.Input.TempDir, layerName)
+		if err != nil {
+			return nil, "", err
+		}
+		if layerPath, err = fillPeople(ctx, p, imagePath, [][]interface{}{person.polygon}, layerPath, nil); err != nil {
+			return nil, "", fmt.Errorf("subject %d: %w", i+1, err)
+		}
+		cleanSupersededAttempts(manifest.Input.TempDir, layerName, layerPath)
+
+		subject.Score = person.score
+		subject.LayerPath = layerPath
+		subjects = append(subjects, subject)
+	}
+
+	if len(static) == 0 {
+		return subjects, "", nil
+	}
+	staticPath, err := stageArtifactPath(manifest, types.StageSegmentPerson, manifest.Input.TempDir, staticSubjectsFileName)
+	if err != nil {
+		return nil, "", err
+	}
+	if staticPath, err = fillPeople(ctx, p, imagePath, polygonsOf(static), staticPath, nil); err != nil {
+		return nil, "", fmt.Errorf("static subjects: %w", err)
+	}
+	cleanSupersededAttempts(manifest.Input.TempDir, staticSubjectsFileName, staticPath)
+	return subjects, staticPath, nil
+}
+
+// fillPeople writes outputPath with everything but the polygons made transparent, or
+// filled with background (BGR) when set, and returns the path the fill tool wrote. The tool writes a partial file that is renamed
+// once it returns, so a retry never picks up a truncated image from a failed attempt.
+func fillPeople(ctx context.Context, p *Pipeline, imagePath string, polygons [][]interface{}, outputPath string, background []int) (string, error) {
+	partialOutputPath := partialPath(outputPath)
+
+	areas := make([]map[string]interface{}, len(polygons))
+	for i, polygon := range polygons {
+		if simplified := simplifyPolygon(polygon, p.maxPolygonPoints); len(simplified) < len(polygon) {
+			log.Printf("Simplified person polygon from %d to %d points for fill", len(polygon), len(simplified))
+			polygon = simplified
+		}
+		areas[i] = map[string]interface{}{
+			"polygon": polygon,
+			"opacity": 0.0, // Fully transparent background
+		}
+		if background != nil {
+			areas[i]["color"] = background
+			areas[i]["opacity"] = 1.0 // Solid background
+		}
+	}
+	fillArgs := map[string]interface{}{
+		"input_path":   imagePath,
+		"areas":        areas,
+		"invert_areas": true, // Fill background (everything except the people)
+		"output_path":  partialOutputPath,
+	}
+
+	fillResult, err := callTool(ctx, "imagesorcery", p.imagesorceryClient, "fill", fillArgs)
+	if err != nil {
+		return "", fmt.Errorf("fill tool failed: %w", err)
+	}
+
+	// Fill tool returns the output path as text, or as JSON with output_path
+	reportedPath := partialOutputPath
+	if len(fillResult.Content) > 0 {
+		resultText := fillResult.Content[0].Text
+		var fillResponse map[string]interface{}
+		if err := json.Unmarshal([]byte(resultText), &fillResponse); err == nil {
+			if outputPathStr, ok := fillResponse["output_path"].(string); ok {
+				reportedPath = outputPathStr
+			}
+		} else {
+			reportedPath = resultText
+		}
+	}
+
+	// A server that chose its own output path keeps it; otherwise commit the partial file
+	if reportedPath != partialOutputPath {
+		return reportedPath, nil
+	}
+	if err := commitArtifact(partialOutputPath, outputPath); err != nil {
+		return "", fmt.Errorf("fill tool output: %w", err)
+	}
+	return outputPath, nil
+}
+
+// subjectSegment returns the motion of the subject at index: neighbours alternate
+// between nodding and shaking, and swing rotations in opposite directions
+func subjectSegment(segment types.AnimationSegment, index int) types.AnimationSegment {
+	if index%2 == 0 {
+		return segment
+	}
+	switch segment.Type {
+	case AnimationNod:
+		segment.Type = AnimationShake
+	case AnimationShake:
+		segment.Type = AnimationNod
+	case AnimationRotate:
+		segment.Intensity = -segment.Intensity
+	}
+	return segment
+}
+
+// subjectSegmentArgs builds the ffmpeg arguments rendering one animation segment person
+// by person: each subject's layer is cropped to its box, animated and overlaid at its
+// position on the static layer, or on a transparent canvas without one
+func subjectSegmentArgs(subjects []Subject, staticPath, outputPath string, segment types.AnimationSegment, spec renderSpec) ([]string, error) {
+	if spec.width <= 0 || spec.height <= 0 {
+		return nil, fmt.Errorf("per-person animation needs the image size")
+	}
+
+	var args []string
+	for _, subject := range subjects {
+		args = append(args, "-loop", "1", "-i", subject.LayerPath)
+	}
+
+	var graph []string
+	if staticPath != "" {
+		args = append(args, "-loop", "1", "-i", staticPath)
+		graph = append(graph, fmt.Sprintf("[%d:v]format=rgba[base]", len(subjects)))
+	} else {
+		graph = append(graph, fmt.Sprintf("color=c=black@0:s=%dx%d:r=%d,format=rgba[base]", spec.width, spec.height, motionFPS))
+	}
+
+	previous := "base"
+	for i, subject := range subjects {
+		filter, err := animationFilter(subjectSegment(segment, i), subject.Width, subject.Height)
+		if err != nil {
+			return nil, err
+		}
+		graph = append(graph, fmt.Sprintf("[%d:v]format=rgba,crop=%d:%d:%d:%d,%s[p%d]",
+			i, subject.Width, subject.Height, subject.X, subject.Y, filter, i))
+
+		overlay := fmt.Sprintf("[%s][p%d]overlay=%d:%d", previous, i, subject.X, subject.Y)
+		previous = fmt.Sprintf("v%d", i)
+		graph = append(graph, overlay+"["+previous+"]")
+	}
+
+	final := "[" + previous + "]null"
+	if pad := spec.padFilter(); pad != "" {
+		final = "[" + previous + "]" + pad
+	}
+	graph = append(graph, final+"[out]")
+
+	args = append(args,
+		"-filter_complex", strings.Join(graph, ";"),
+		"-map", "[out]",
+		"-t", strconv.FormatFloat(segment.Duration, 'f', -1, 64),
+		"-r", strconv.Itoa(motionFPS),
+	)
+	args = append(args, spec.encoderArgs()...)
+	return append(args, "-y", outputPath), nil
+}
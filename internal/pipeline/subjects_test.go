@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveSubjectConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   types.SubjectConfig
+		expected types.SubjectConfig
+		wantErr  bool
+	}{
+		{"defaults", types.SubjectConfig{}, types.SubjectConfig{Mode: SubjectModeUniform, MaxPeople: DefaultMaxPeople}, false},
+		{"per person", types.SubjectConfig{Mode: " Per_Person ", MaxPeople: 2}, types.SubjectConfig{Mode: SubjectModePerPerson, MaxPeople: 2}, false},
+		{"unknown mode", types.SubjectConfig{Mode: "crowd"}, types.SubjectConfig{}, true},
+		{"negative max", types.SubjectConfig{MaxPeople: -1}, types.SubjectConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ResolveSubjectConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && config != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, config)
+			}
+		})
+	}
+}
+
+func TestSubjectBox(t *testing.T) {
+	polygon := []interface{}{
+		[]interface{}{10.0, 20.0},
+		[]interface{}{110.0, 20.0},
+		[]interface{}{110.0, 220.0},
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+		expected      Subject
+	}{
+		{"margin", 1000, 1000, Subject{X: 0, Y: 0, Width: 120, Height: 240}},
+		{"clamped to image", 115, 230, Subject{X: 0, Y: 0, Width: 115, Height: 230}},
+		{"unknown size", 0, 0, Subject{X: 0, Y: 0, Width: 120, Height: 240}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box, err := subjectBox(polygon, tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("subjectBox failed: %v", err)
+			}
+			if box != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, box)
+			}
+		})
+	}
+
+	if _, err := subjectBox([]interface{}{"not a point"}, 100, 100); err == nil {
+		t.Error("Expected malformed polygon to be rejected")
+	}
+}
+
+func TestSubjectSegment(t *testing.T) {
+	tests := []struct {
+		segment  types.AnimationSegment
+		index    int
+		expected types.AnimationSegment
+	}{
+		{types.AnimationSegment{Type: AnimationNod, Intensity: 8}, 0, types.AnimationSegment{Type: AnimationNod, Intensity: 8}},
+		{types.AnimationSegment{Type: AnimationNod, Intensity: 8}, 1, types.AnimationSegment{Type: AnimationShake, Intensity: 8}},
+		{types.AnimationSegment{Type: AnimationShake, Intensity: 8}, 3, types.AnimationSegment{Type: AnimationNod, Intensity: 8}},
+		{types.AnimationSegment{Type: AnimationRotate, Intensity: 10}, 1, types.AnimationSegment{Type: AnimationRotate, Intensity: -10}},
+		{types.AnimationSegment{Type: AnimationZoom, Intensity: 0.1}, 1, types.AnimationSegment{Type: AnimationZoom, Intensity: 0.1}},
+	}
+
+	for _, tt := range tests {
+		if got := subjectSegment(tt.segment, tt.index); got != tt.expected {
+			t.Errorf("subjectSegment(%+v, %d) = %+v, want %+v", tt.segment, tt.index, got, tt.expected)
+		}
+	}
+}
+
+func TestSubjectSegmentArgs(t *testing.T) {
+	subjects := []Subject{
+		{X: 10, Y: 20, Width: 100, Height: 200, LayerPath: "/tmp/subject1.png"},
+		{X: 300, Y: 40, Width: 80, Height: 160, LayerPath: "/tmp/subject2.png"},
+	}
+	segment := types.AnimationSegment{Type: AnimationNod, Duration: 3, Intensity: 5}
+	spec := renderSpec{width: 641, height: 480, pixFmt: "yuv420p", pad: true}
+
+	t.Run("transparent canvas", func(t *testing.T) {
+		args, err := subjectSegmentArgs(subjects, "", "/tmp/out.mp4", segment, spec)
+		if err != nil {
+			t.Fatalf("subjectSegmentArgs failed: %v", err)
+		}
+		graph := args[slices.Index(args, "-filter_complex")+1]
+		expected := []string{
+			"color=c=black@0:s=641x480:r=15,format=rgba[base]",
+			"[0:v]format=rgba,crop=100:200:10:20,pad=iw:ih+2*5:0:5,crop=iw:ih-2*5:0:5+5*sin(4*PI*t),scale=100:200[p0]",
+			"[base][p0]overlay=10:20[v0]",
+			"[1:v]format=rgba,crop=80:160:300:40,pad=iw+2*5:ih:5:0,crop=iw-2*5:ih:5+5*sin(4*PI*t):0,scale=80:160[p1]",
+			"[v0][p1]overlay=300:40[v1]",
+			"[v1]pad=642:480:0:0:color=black[out]",
+		}
+		if graph != strings.Join(expected, ";") {
+			t.Errorf("Unexpected filter graph:\n%s\nwant:\n%s", graph, strings.Join(expected, ";"))
+		}
+		if !slices.Equal(args[:4], []string{"-loop", "1", "-i", "/tmp/subject1.png"}) || !slices.Contains(args, "[out]") {
+			t.Errorf("Unexpected args %v", args)
+		}
+	})
+
+	t.Run("static layer", func(t *testing.T) {
+		args, err := subjectSegmentArgs(subjects, "/tmp/static.png", "/tmp/out.mp4", segment, spec)
+		if err != nil {
+			t.Fatalf("subjectSegmentArgs failed: %v", err)
+		}
+		graph := args[slices.Index(args, "-filter_complex")+1]
+		if !strings.HasPrefix(graph, "[2:v]format=rgba[base];") || args[slices.Index(args, "/tmp/static.png")-1] != "-i" {
+			t.Errorf("Expected the static layer as the base, got %v", args)
+		}
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		if _, err := subjectSegmentArgs(subjects, "", "/tmp/out.mp4", segment, renderSpec{pixFmt: "yuv420p"}); err == nil {
+			t.Error("Expected per-person animation without the image size to fail")
+		}
+	})
+}
+
+// TestSegmentPerPerson verifies per_person mode cuts out the best people to their own
+// layers and leaves the rest to the static layer, while uniform mode keeps one person
+func TestSegmentPerPerson(t *testing.T) {
+	detect := `{"detections":[
+		{"class":"person","confidence":0.5,"polygon":[[0,0],[10,0],[10,10]]},
+		{"class":"dog","confidence":0.99,"polygon":[[5,5],[6,6]]},
+		{"class":"person","confidence":0.9,"polygon":[[20,0],[40,0],[40,30]]},
+		{"class":"person","confidence":0.7,"polygon":[[50,0],[60,0],[60,10]]}
+	]}`
+
+	run := func(t *testing.T, config types.SubjectConfig) (*Manifest, *fakeToolClient) {
+		imagePath := filepath.Join(t.TempDir(), "group.png")
+		if err := os.WriteFile(imagePath, []byte("photo"), 0644); err != nil {
+			t.Fatalf("Failed to write image: %v", err)
+		}
+		tools := newFakeToolClient()
+		tools.detectResponse = detect
+		p := NewPipeline(tools, tools, nil, nil, nil, false, 3, "", "lightweight")
+		p.SetSubjectConfig(config)
+
+		manifest := NewManifest("test", types.PipelineInput{ImagePath: imagePath, TempDir: t.TempDir()})
+		if err := ExecuteSegmentPerson(context.Background(), p, manifest); err != nil {
+			t.Fatalf("ExecuteSegmentPerson failed: %v", err)
+		}
+		return manifest, tools
+	}
+
+	t.Run("uniform", func(t *testing.T) {
+		manifest, tools := run(t, types.SubjectConfig{})
+		if tools.calls["fill"] != 1 || len(manifest.Result.Subjects) != 0 {
+			t.Errorf("Expected a single fill without subjects, got %d fills and %d subjects",
+				tools.calls["fill"], len(manifest.Result.Subjects))
+		}
+	})
+
+	t.Run("per person", func(t *testing.T) {
+		manifest, tools := run(t, types.SubjectConfig{Mode: SubjectModePerPerson, MaxPeople: 2})
+		// One fill for the segmented image, one per animated person, one for the rest
+		if tools.calls["fill"] != 4 {
+			t.Errorf("Expected 4 fills, got %d", tools.calls["fill"])
+		}
+
+		subjects := manifest.Result.Subjects
+		if len(subjects) != 2 {
+			t.Fatalf("Expected 2 subjects, got %d", len(subjects))
+		}
+		if subjects[0].Score != 0.9 || subjects[1].Score != 0.7 {
+			t.Errorf("Expected subjects ordered by score, got %.1f and %.1f", subjects[0].Score, subjects[1].Score)
+		}
+		if subjects[0].X != 18 || subjects[0].Width != 24 {
+			t.Errorf("Expected the first subject's box around x 20-40, got %+v", subjects[0])
+		}
+		for _, subject := range subjects {
+			if _, err := os.Stat(subject.LayerPath); err != nil {
+				t.Errorf("Expected subject layer %s: %v", subject.LayerPath, err)
+			}
+		}
+		if manifest.Result.StaticSubjectsPath == "" {
+			t.Error("Expected the person beyond max_people on the static layer")
+		}
+	})
+}
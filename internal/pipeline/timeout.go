@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// DefaultStageTimeout bounds the ffmpeg stages (render_motion, compose) when no
+// stage_timeout is configured
+const DefaultStageTimeout = 10 * time.Minute
+
+// withStageTimeout runs a stage with the pipeline's stage timeout. Subprocesses are
+// started with procgroup, so hitting the timeout kills their whole tree; the stage then
+// fails with a StageTimeoutError. Cancellation of ctx itself is returned unchanged.
+func (p *Pipeline) withStageTimeout(ctx context.Context, stage types.PipelineStage, run func(ctx context.Context) error) error {
+	timeout := p.stageTimeout
+	if timeout <= 0 {
+		timeout = DefaultStageTimeout
+	}
+
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := run(stageCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		log.Printf("Stage %s hit its %s timeout, subprocesses killed", stage, timeout)
+		return &StageTimeoutError{Stage: stage, Timeout: timeout, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestWithStageTimeout(t *testing.T) {
+	p := &Pipeline{stageTimeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	err := p.withStageTimeout(context.Background(), types.StageCompose, func(ctx context.Context) error {
+		return procgroup.CommandContext(ctx, "sh", "-c", "sleep 30 & wait").Run()
+	})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("stage took %s to stop", elapsed)
+	}
+	if !errors.Is(err, ErrStageTimeout) {
+		t.Fatalf("err = %v, want ErrStageTimeout", err)
+	}
+	if kind := FailureKind(&StageError{Stage: types.StageCompose, Err: err}); kind != FailureTimeout {
+		t.Errorf("FailureKind = %q, want %q", kind, FailureTimeout)
+	}
+}
+
+// TestWithStageTimeoutParentCanceled verifies an interrupted run isn't reported as a timeout
+func TestWithStageTimeoutParentCanceled(t *testing.T) {
+	p := &Pipeline{stageTimeout: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.withStageTimeout(ctx, types.StageCompose, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if errors.Is(err, ErrStageTimeout) {
+		t.Fatalf("err = %v, want no timeout", err)
+	}
+	if kind := FailureKind(err); kind != FailureInterrupted {
+		t.Errorf("FailureKind = %q, want %q", kind, FailureInterrupted)
+	}
+}
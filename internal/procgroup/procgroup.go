@@ -0,0 +1,24 @@
+// Package procgroup starts subprocesses in their own process group so that killing
+// one also kills everything it spawned
+package procgroup
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// waitDelay bounds how long Wait waits for output pipes after the group is killed
+const waitDelay = 5 * time.Second
+
+// CommandContext is exec.CommandContext for a command that runs in its own process
+// group: cancelling ctx kills the whole tree, not just the direct child
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	Set(cmd)
+	cmd.Cancel = func() error {
+		return Kill(cmd.Process.Pid)
+	}
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
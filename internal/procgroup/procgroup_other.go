@@ -0,0 +1,24 @@
+//go:build !unix && !windows
+
+package procgroup
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Set is a no-op where process groups are unavailable
+func Set(cmd *exec.Cmd) {}
+
+// Kill kills the process pid; its children are not reached
+func Kill(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package procgroup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processAlive reports whether pid is running; zombies count as exited
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+// TestCommandContextKillsTree verifies a timeout kills the grandchildren too, the
+// way ffmpeg helpers or shell wrappers would be left behind otherwise
+func TestCommandContextKillsTree(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	cmd := CommandContext(ctx, "sh", "-c", "sleep 60 & echo $! > "+pidFile+"; wait")
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the command to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Run returned after %s, want shortly after the timeout", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("child never started: %v", err)
+	}
+	childPid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(childPid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("grandchild %d survived the timeout", childPid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKillExited(t *testing.T) {
+	cmd := CommandContext(context.Background(), "true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if err := Kill(cmd.Process.Pid); err != nil {
+		t.Errorf("killing an exited group failed: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package procgroup
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Set makes cmd start in a process group of its own
+func Set(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// Kill kills every process in the group led by pid. A group that has already
+// exited is not an error.
+func Kill(pid int) error {
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package procgroup
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// Set makes cmd start in a process group of its own
+func Set(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// Kill kills the process pid and its descendants with taskkill /T. A process that
+// has already exited is not an error.
+func Kill(pid int) error {
+	// taskkill exits with 128 when the process no longer exists
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 128 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+// Package retry defines which errors are worth retrying, so transport, stage and LLM
+// retries share one policy
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/genai"
+)
+
+// MaxBackoff caps the delay between attempts
+const MaxBackoff = 30 * time.Second
+
+// JSON-RPC error codes MCP SDKs use for transient failures
+const (
+	RPCConnectionClosed = -32000
+	RPCRequestTimeout   = -32001
+)
+
+// Classifier reports whether err is retryable. ok is false when it has no opinion,
+// leaving the decision to earlier classifiers and the built-in rules.
+type Classifier func(err error) (retryable, ok bool)
+
+// rpcCoder is implemented by JSON-RPC errors
+type rpcCoder interface {
+	RPCCode() int
+}
+
+var (
+	classifiersMu sync.RWMutex
+	classifiers   []Classifier
+)
+
+// RegisterClassifier extends the classification. Registered classifiers are consulted
+// before the built-in rules, the most recently registered first.
+func RegisterClassifier(classifier Classifier) {
+	classifiersMu.Lock()
+	defer classifiersMu.Unlock()
+	classifiers = append([]Classifier{classifier}, classifiers...)
+}
+
+// Codes returns a classifier treating the given HTTP statuses and JSON-RPC error codes
+// as retryable, in addition to the built-in ones
+func Codes(statusCodes, rpcCodes []int) Classifier {
+	return func(err error) (bool, bool) {
+		if code, ok := statusCode(err); ok && slices.Contains(statusCodes, code) {
+			return true, true
+		}
+		var rpcErr rpcCoder
+		if errors.As(err, &rpcErr) && slices.Contains(rpcCodes, rpcErr.RPCCode()) {
+			return true, true
+		}
+		return false, false
+	}
+}
+
+// IsRetryable reports whether err is transient: a deadline, a reset or refused
+// connection, an HTTP 408, 429 or 5xx response, or a connection-closed or timeout
+// JSON-RPC error. Cancellation is never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	classifiersMu.RLock()
+	registered := classifiers
+	classifiersMu.RUnlock()
+	for _, classify := range registered {
+		if retryable, ok := classify(err); ok {
+			return retryable
+		}
+	}
+
+	if code, ok := statusCode(err); ok {
+		return RetryableStatus(code)
+	}
+	var rpcErr rpcCoder
+	if errors.As(err, &rpcErr) {
+		return RetryableRPCCode(rpcErr.RPCCode())
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RetryableStatus reports whether an HTTP status is transient
+func RetryableStatus(code int) bool {
+	switch {
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code == http.StatusNotImplemented, code == http.StatusHTTPVersionNotSupported:
+		return false
+	default:
+		return code >= 500 && code <= 599
+	}
+}
+
+// RetryableRPCCode reports whether a JSON-RPC error code is transient
+func RetryableRPCCode(code int) bool {
+	return code == RPCConnectionClosed || code == RPCRequestTimeout
+}
+
+// statusCode returns the HTTP status of an LLM API error
+func statusCode(err error) (int, bool) {
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode, true
+	}
+	var openaiErr *openai.APIError
+	if errors.As(err, &openaiErr) && openaiErr.HTTPStatusCode > 0 {
+		return openaiErr.HTTPStatusCode, true
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) && requestErr.HTTPStatusCode > 0 {
+		return requestErr.HTTPStatusCode, true
+	}
+	var genaiErr genai.APIError
+	if errors.As(err, &genaiErr) {
+		return genaiErr.Code, true
+	}
+	return 0, false
+}
+
+// Backoff returns the delay before retry attempt (1-based): base doubled per attempt,
+// capped at MaxBackoff
+func Backoff(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxBackoff)
+}
+
+// Sleep waits for d or until ctx is done, returning ctx's error in that case
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do calls fn up to attempts times while it fails with a retryable error, backing off
+// between attempts. The last error is returned; name labels the retry log lines.
+func Do(ctx context.Context, name string, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+
+		delay := Backoff(backoff, attempt)
+		log.Printf("Warning: %s failed (attempt %d/%d), retrying in %s: %v", name, attempt, attempts, delay, err)
+		if sleepErr := Sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
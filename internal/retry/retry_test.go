@@ -0,0 +1,133 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/genai"
+)
+
+// rpcError mimics client.JSONRPCError
+type rpcError struct{ code int }
+
+func (e *rpcError) Error() string { return fmt.Sprintf("JSON-RPC error %d", e.code) }
+func (e *rpcError) RPCCode() int  { return e.code }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("invalid arguments"), false},
+		{"deadline", fmt.Errorf("request timeout: %w", context.DeadlineExceeded), true},
+		{"canceled", fmt.Errorf("stage interrupted: %w", context.Canceled), false},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"anthropic 429", fmt.Errorf("Claude API error: %w", &anthropic.Error{StatusCode: http.StatusTooManyRequests}), true},
+		{"anthropic 400", &anthropic.Error{StatusCode: http.StatusBadRequest}, false},
+		{"openai 503", &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}, true},
+		{"openai 501", &openai.RequestError{HTTPStatusCode: http.StatusNotImplemented}, false},
+		{"gemini 500", genai.APIError{Code: http.StatusInternalServerError}, true},
+		{"gemini 403", genai.APIError{Code: http.StatusForbidden}, false},
+		{"rpc request timeout", &rpcError{code: RPCRequestTimeout}, true},
+		{"rpc invalid params", &rpcError{code: -32602}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.expected {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRegisterClassifier(t *testing.T) {
+	errBusy := errors.New("server busy")
+	RegisterClassifier(func(err error) (bool, bool) {
+		if errors.Is(err, errBusy) {
+			return true, true
+		}
+		return false, false
+	})
+	RegisterClassifier(Codes([]int{http.StatusConflict}, []int{-32603}))
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"custom error", fmt.Errorf("tools/call: %w", errBusy), true},
+		{"extra status", &openai.APIError{HTTPStatusCode: http.StatusConflict}, true},
+		{"extra rpc code", &rpcError{code: -32603}, true},
+		{"built-in rules still apply", &rpcError{code: RPCConnectionClosed}, true},
+		{"unmatched", errors.New("invalid arguments"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.expected {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, MaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := Backoff(time.Second, tt.attempt); got != tt.expected {
+			t.Errorf("Backoff(1s, %d) = %s, want %s", tt.attempt, got, tt.expected)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	transient := fmt.Errorf("read: %w", syscall.ECONNRESET)
+
+	tests := []struct {
+		name          string
+		errs          []error // Returned by successive calls; nil after the list
+		expectedCalls int
+		expectErr     bool
+	}{
+		{"succeeds after transient failures", []error{transient, transient}, 3, false},
+		{"gives up after attempts", []error{transient, transient, transient, transient}, 3, true},
+		{"permanent error not retried", []error{errors.New("invalid arguments")}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), "test", 3, time.Millisecond, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
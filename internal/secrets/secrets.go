@@ -0,0 +1,133 @@
+// Package secrets resolves API keys given inline, in files, or as secret:// references
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Scheme prefixes a secret reference: secret://<resolver>/<reference>
+const Scheme = "secret://"
+
+// Resolver returns the secret a reference names. The reference is the part of the URI
+// after the resolver name, e.g. "ANTHROPIC_API_KEY" in secret://env/ANTHROPIC_API_KEY.
+type Resolver func(ctx context.Context, reference string) (string, error)
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]Resolver{
+		"env":  resolveEnv,
+		"file": resolveFile,
+	}
+)
+
+// RegisterResolver makes secret://<name>/... references resolve with resolver, e.g. a
+// secrets manager client. It replaces any resolver registered under the same name.
+func RegisterResolver(name string, resolver Resolver) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid secret resolver name %q", name)
+	}
+	if resolver == nil {
+		return fmt.Errorf("secret resolver %s is nil", name)
+	}
+
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	resolvers[name] = resolver
+	return nil
+}
+
+// Resolve returns value itself, or the secret it references when it is a secret:// URI
+func Resolve(ctx context.Context, value string) (string, error) {
+	uri, ok := strings.CutPrefix(value, Scheme)
+	if !ok {
+		return value, nil
+	}
+	name, reference, _ := strings.Cut(uri, "/")
+
+	resolversMu.RLock()
+	resolver, ok := resolvers[name]
+	resolversMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("no secret resolver registered for %s%s/", Scheme, name)
+	}
+
+	secret, err := resolver(ctx, reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s%s/...: %w", Scheme, name, err)
+	}
+	return strings.TrimSpace(secret), nil
+}
+
+// ResolveAPIKey returns the API key from apiKeyFile when set, otherwise from apiKey.
+// Either may be a secret:// reference; file contents are trimmed of whitespace.
+func ResolveAPIKey(ctx context.Context, apiKey, apiKeyFile string) (string, error) {
+	if apiKeyFile == "" {
+		return Resolve(ctx, apiKey)
+	}
+	if apiKey != "" {
+		log.Printf("Warning: both api_key and api_key_file are set, using api_key_file")
+	}
+
+	path, err := Resolve(ctx, apiKeyFile)
+	if err != nil {
+		return "", err
+	}
+	return resolveFile(ctx, path)
+}
+
+// ResolveLLMConfig replaces the selected provider's API key with the resolved secret, so
+// the provider only ever sees a plain key. Other providers' keys are left unresolved: a
+// stale reference in a section the run doesn't use neither fails it nor gets fetched.
+func ResolveLLMConfig(ctx context.Context, config *types.LLMConfig) error {
+	var apiKey *string
+	var keyFile string
+	switch config.Provider {
+	case "anthropic", "claude":
+		apiKey, keyFile = &config.Anthropic.APIKey, config.Anthropic.APIKeyFile
+	case "google", "gemini":
+		apiKey, keyFile = &config.Google.APIKey, config.Google.APIKeyFile
+	case "openai":
+		apiKey, keyFile = &config.OpenAI.APIKey, config.OpenAI.APIKeyFile
+	case "openrouter":
+		apiKey, keyFile = &config.OpenRouter.APIKey, config.OpenRouter.APIKeyFile
+	default:
+		// The mock provider has no key; unknown providers are rejected when created
+		return nil
+	}
+
+	resolved, err := ResolveAPIKey(ctx, *apiKey, keyFile)
+	if err != nil {
+		return fmt.Errorf("llm.%s: %w", config.Provider, err)
+	}
+	*apiKey = resolved
+	return nil
+}
+
+// resolveEnv reads a secret from an environment variable
+func resolveEnv(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveFile reads a secret from a file, such as a mounted Kubernetes secret
+func resolveFile(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("API key file %s is empty", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+func TestResolveAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "api_key")
+	if err := os.WriteFile(keyFile, []byte("  file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_TEST_KEY", "env-key")
+
+	err := RegisterResolver("vault", func(ctx context.Context, reference string) (string, error) {
+		if reference != "llm/anthropic" {
+			return "", errors.New("not found")
+		}
+		return "vault-key", nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterResolver failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		apiKeyFile string
+		expected   string
+		expectErr  bool
+	}{
+		{name: "inline key", apiKey: "inline-key", expected: "inline-key"},
+		{name: "no key", expected: ""},
+		{name: "key file trimmed", apiKeyFile: keyFile, expected: "file-key"},
+		{name: "key file wins", apiKey: "inline-key", apiKeyFile: keyFile, expected: "file-key"},
+		{name: "missing key file", apiKeyFile: filepath.Join(dir, "missing"), expectErr: true},
+		{name: "empty key file", apiKeyFile: emptyFile, expectErr: true},
+		{name: "env reference", apiKey: "secret://env/SECRETS_TEST_KEY", expected: "env-key"},
+		{name: "file reference", apiKey: "secret://file/" + keyFile, expected: "file-key"},
+		{name: "custom resolver", apiKey: "secret://vault/llm/anthropic", expected: "vault-key"},
+		{name: "custom resolver error", apiKey: "secret://vault/llm/openai", expectErr: true},
+		{name: "unknown resolver", apiKey: "secret://aws/llm", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ResolveAPIKey(context.Background(), tt.apiKey, tt.apiKeyFile)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got key %q", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveAPIKey failed: %v", err)
+			}
+			if key != tt.expected {
+				t.Errorf("Expected key %q, got %q", tt.expected, key)
+			}
+		})
+	}
+}
+
+func TestResolveLLMConfig(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "google_key")
+	if err := os.WriteFile(keyFile, []byte("google-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := types.LLMConfig{
+		Provider:   "gemini",
+		Anthropic:  types.AnthropicConfig{APIKey: "secret://env/AGENT_TEST_UNSET_KEY"},
+		Google:     types.GoogleConfig{APIKeyFile: keyFile},
+		OpenRouter: types.OpenRouterConfig{APIKeyFile: filepath.Join(t.TempDir(), "missing")},
+	}
+	if err := ResolveLLMConfig(context.Background(), &config); err != nil {
+		t.Fatalf("Expected stale keys of unused providers to be ignored, got: %v", err)
+	}
+	if config.Google.APIKey != "google-key" {
+		t.Errorf("Expected the selected provider's key resolved, got %q", config.Google.APIKey)
+	}
+	if config.Anthropic.APIKey != "secret://env/AGENT_TEST_UNSET_KEY" {
+		t.Errorf("Expected unused provider's key left unresolved, got %q", config.Anthropic.APIKey)
+	}
+
+	config.Provider = "openrouter"
+	if err := ResolveLLMConfig(context.Background(), &config); err == nil {
+		t.Error("Expected error for a missing openrouter key file")
+	}
+
+	config.Provider = "mock"
+	if err := ResolveLLMConfig(context.Background(), &config); err != nil {
+		t.Errorf("Expected no key to resolve for the mock provider, got: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package selftest runs the lightweight pipeline end to end on a bundled sample image,
+// with in-process fake MCP servers and the real ffmpeg, to check an install without
+// any MCP server or API key
+package selftest
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/internal/procgroup"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// sampleImage is a 160x200 cartoon person on a gradient background
+//
+//go:embed sample.png
+var sampleImage []byte
+
+// DefaultDuration is the length of the self-test video in seconds
+const DefaultDuration = 2.0
+
+// durationTolerance is how far the output's duration may be from the requested one
+const durationTolerance = 0.5
+
+// Options configures a self-test run
+type Options struct {
+	Duration float64 // Seconds of video to render; 0 uses DefaultDuration
+	Dir      string  // Parent of the run's temp directory; "" uses the system temp dir
+	Keep     bool    // Leave the run's directory behind for inspection
+}
+
+// Report describes a successful self-test run
+type Report struct {
+	Dir         string // The run's directory, removed unless Options.Keep was set
+	OutputPath  string
+	OutputBytes int64
+	Duration    float64 // Seconds, as reported by ffprobe
+	Streams     []string
+	Elapsed     time.Duration
+}
+
+// Run renders the sample image with the lightweight pipeline and verifies the output
+// with ffprobe: it must have a video and an audio stream and the requested duration
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	start := time.Now()
+	if opts.Duration <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(binary); err != nil {
+			return nil, fmt.Errorf("%s not found: %w", binary, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp(opts.Dir, "agent-selftest-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the self-test directory: %w", err)
+	}
+	if !opts.Keep {
+		defer os.RemoveAll(dir)
+	}
+	report := &Report{Dir: dir}
+
+	imagePath := filepath.Join(dir, "sample.png")
+	if err := os.WriteFile(imagePath, sampleImage, 0644); err != nil {
+		return report, fmt.Errorf("failed to write the sample image: %w", err)
+	}
+
+	musicURL, stopMusic, err := serveTone(opts.Duration + 1)
+	if err != nil {
+		return report, err
+	}
+	defer stopMusic()
+
+	imagesorcery := &fakeServer{name: "imagesorcery", tools: []string{"detect", "fill"}}
+	yolo := &fakeServer{name: "yolo", tools: []string{"analyze_image_from_path"}}
+	music := &fakeServer{name: "music", tools: []string{"SearchRecordings"}, musicURL: musicURL}
+
+	p := pipeline.NewPipeline(imagesorcery, yolo, nil, music, nil, true, 1, "", "lightweight")
+	p.SetManifestStore(pipeline.NewMemoryManifestStore())
+	p.SetEventLog(false)
+
+	input := types.PipelineInput{
+		ImagePath: imagePath,
+		Duration:  opts.Duration,
+		OutputDir: filepath.Join(dir, "output"),
+		TempDir:   filepath.Join(dir, "tmp"),
+	}
+	for _, d := range []string{input.OutputDir, input.TempDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return report, err
+		}
+	}
+
+	result, err := p.Execute(ctx, input, "selftest")
+	if err != nil {
+		return report, fmt.Errorf("pipeline failed: %w", err)
+	}
+	report.OutputPath = result.FinalOutputPath
+	if info, err := os.Stat(report.OutputPath); err == nil {
+		report.OutputBytes = info.Size()
+	}
+
+	report.Duration, report.Streams, err = probeOutput(ctx, result.FinalOutputPath)
+	if err != nil {
+		return report, err
+	}
+	if err := checkOutput(report.Duration, report.Streams, opts.Duration); err != nil {
+		return report, err
+	}
+	report.Elapsed = time.Since(start)
+	return report, nil
+}
+
+// serveTone serves a WAV tone of seconds on a loopback port and returns its URL and
+// a function stopping the server
+func serveTone(seconds float64) (string, func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start the sample music server: %w", err)
+	}
+	tone := toneWAV(seconds)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		w.Header().Set("Content-Length", strconv.Itoa(len(tone)))
+		w.Write(tone)
+	})}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String() + "/tone.wav", func() { server.Close() }, nil
+}
+
+// probeOutput returns the duration and stream types ffprobe reports for path
+func probeOutput(ctx context.Context, path string) (float64, []string, error) {
+	cmd := procgroup.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "stream=codec_type:format=duration",
+		"-of", "json",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, nil, fmt.Errorf("ffprobe failed on %s: %w", path, err)
+	}
+	return parseProbe(output)
+}
+
+// parseProbe reads the format duration and stream types from ffprobe JSON output
+func parseProbe(probeJSON []byte) (float64, []string, error) {
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(probeJSON, &probe); err != nil {
+		return 0, nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ffprobe reported no duration")
+	}
+	streams := make([]string, len(probe.Streams))
+	for i, stream := range probe.Streams {
+		streams[i] = stream.CodecType
+	}
+	return duration, streams, nil
+}
+
+// checkOutput checks the output has video and audio and lasts about want seconds
+func checkOutput(duration float64, streams []string, want float64) error {
+	for _, required := range []string{"video", "audio"} {
+		found := false
+		for _, stream := range streams {
+			found = found || stream == required
+		}
+		if !found {
+			return fmt.Errorf("output has no %s stream (streams: %v)", required, streams)
+		}
+	}
+	if duration < want-durationTolerance || duration > want+durationTolerance {
+		return fmt.Errorf("output lasts %.2fs, want %.2fs", duration, want)
+	}
+	return nil
+}
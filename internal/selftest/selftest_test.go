@@ -0,0 +1,85 @@
+package selftest
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestRun runs the whole self-test; it needs ffmpeg and ffprobe
+func TestRun(t *testing.T) {
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(binary); err != nil {
+			t.Skipf("%s not installed", binary)
+		}
+	}
+
+	parent := t.TempDir()
+	report, err := Run(context.Background(), Options{Dir: parent})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.OutputPath == "" || len(report.Streams) < 2 {
+		t.Errorf("Expected an output with video and audio, got %+v", report)
+	}
+	if _, err := os.Stat(report.Dir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed without Keep", report.Dir)
+	}
+}
+
+func TestCutOutPerson(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "sample.png")
+	outputPath := filepath.Join(dir, "segmented.png")
+	if err := os.WriteFile(inputPath, sampleImage, 0644); err != nil {
+		t.Fatalf("Failed to write sample: %v", err)
+	}
+	if err := cutOutPerson(inputPath, outputPath); err != nil {
+		t.Fatalf("cutOutPerson failed: %v", err)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("Output is not a PNG: %v", err)
+	}
+	alphaAt := func(p image.Point) uint32 {
+		_, _, _, a := img.At(p.X, p.Y).RGBA()
+		return a
+	}
+	if a := alphaAt(image.Pt(80, 120)); a == 0 {
+		t.Errorf("Expected the body to stay opaque")
+	}
+	if a := alphaAt(image.Pt(5, 5)); a != 0 {
+		t.Errorf("Expected the background to be transparent, alpha %d", a)
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	probe := `{"streams":[{"codec_type":"video"},{"codec_type":"audio"}],"format":{"duration":"2.040000"}}`
+	duration, streams, err := parseProbe([]byte(probe))
+	if err != nil {
+		t.Fatalf("parseProbe failed: %v", err)
+	}
+	if err := checkOutput(duration, streams, 2); err != nil {
+		t.Errorf("Expected the output to pass, got %v", err)
+	}
+
+	if err := checkOutput(duration, []string{"video"}, 2); err == nil {
+		t.Error("Expected an output without audio to fail")
+	}
+	if err := checkOutput(5, streams, 2); err == nil {
+		t.Error("Expected a 5s output to fail a 2s run")
+	}
+	if _, _, err := parseProbe([]byte(`{"format":{}}`)); err == nil {
+		t.Error("Expected a probe without duration to fail")
+	}
+}
@@ -0,0 +1,180 @@
+package selftest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// samplePerson outlines the person in sample.png: head and shoulders over the body
+var samplePerson = [][2]float64{
+	{55, 28}, {105, 28}, {105, 82}, {110, 82}, {110, 180}, {50, 180}, {50, 82}, {55, 82},
+}
+
+// sampleKeypoints are the nose, eyes, shoulders and hips of the person, [x, y, score]
+var sampleKeypoints = [][3]float64{
+	{80, 58, 0.95}, {72, 50, 0.9}, {88, 50, 0.9},
+	{54, 86, 0.85}, {106, 86, 0.85}, {60, 170, 0.8}, {100, 170, 0.8},
+}
+
+// fakeServer is an in-process MCPClient serving the tools the lightweight pipeline
+// calls, with fixed answers for the sample image
+type fakeServer struct {
+	name     string
+	tools    []string
+	musicURL string // Track URL returned by SearchRecordings
+}
+
+func (f *fakeServer) Connect(ctx context.Context) error    { return nil }
+func (f *fakeServer) Initialize(ctx context.Context) error { return nil }
+func (f *fakeServer) Close() error                         { return nil }
+func (f *fakeServer) GetServerInfo() (string, string)      { return "selftest-" + f.name, "1.0.0" }
+
+func (f *fakeServer) ListTools(ctx context.Context) ([]types.Tool, error) {
+	tools := make([]types.Tool, len(f.tools))
+	for i, name := range f.tools {
+		tools[i] = types.Tool{Name: name}
+	}
+	return tools, nil
+}
+
+func (f *fakeServer) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	var response interface{}
+	switch name {
+	case "detect":
+		response = map[string]interface{}{"detections": []map[string]interface{}{{
+			"class":      "person",
+			"confidence": 0.92,
+			"polygon":    samplePerson,
+		}}}
+	case "fill":
+		inputPath, _ := arguments["input_path"].(string)
+		outputPath, _ := arguments["output_path"].(string)
+		if err := cutOutPerson(inputPath, outputPath); err != nil {
+			return nil, err
+		}
+		return textResult(outputPath), nil
+	case "analyze_image_from_path":
+		response = map[string]interface{}{"detections": []map[string]interface{}{{
+			"class":      "person",
+			"confidence": 0.9,
+			"keypoints":  sampleKeypoints,
+		}}}
+	case "SearchRecordings":
+		response = map[string]interface{}{"data": map[string]interface{}{"recordings": map[string]interface{}{
+			"nodes": []map[string]interface{}{{"recording": map[string]interface{}{
+				"id":        "selftest-tone",
+				"title":     "Self-test tone",
+				"audioFile": map[string]interface{}{"lqmp3Url": f.musicURL},
+			}}},
+		}}}
+	default:
+		return nil, fmt.Errorf("selftest %s server has no tool %s", f.name, name)
+	}
+
+	text, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return textResult(string(text)), nil
+}
+
+// textResult wraps text in a tool result
+func textResult(text string) *types.ToolCallResult {
+	return &types.ToolCallResult{Content: []types.ContentBlock{{Type: "text", Text: text}}}
+}
+
+// cutOutPerson writes the image at inputPath to outputPath as a PNG with everything
+// outside samplePerson made transparent, as the fill tool does with invert_areas. A JPEG
+// output path gets a white background instead.
+func cutOutPerson(inputPath, outputPath string) error {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	src, _, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", inputPath, err)
+	}
+
+	bounds := src.Bounds()
+	out := image.NewNRGBA(bounds)
+	draw.Draw(out, bounds, src, bounds.Min, draw.Src)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !insidePolygon(samplePerson, float64(x)+0.5, float64(y)+0.5) {
+				out.SetNRGBA(x, y, color.NRGBA{})
+			}
+		}
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(outputPath)); ext == ".jpg" || ext == ".jpeg" {
+		opaque := image.NewRGBA(bounds)
+		draw.Draw(opaque, bounds, image.White, image.Point{}, draw.Src)
+		draw.Draw(opaque, bounds, out, bounds.Min, draw.Over)
+		err = jpeg.Encode(file, opaque, nil)
+	} else {
+		err = png.Encode(file, out)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// insidePolygon reports whether (x, y) is inside polygon, by ray casting
+func insidePolygon(polygon [][2]float64, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := polygon[i][0], polygon[i][1]
+		xj, yj := polygon[j][0], polygon[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// toneWAV returns a 16-bit mono WAV file of a 440 Hz sine lasting seconds
+func toneWAV(seconds float64) []byte {
+	const sampleRate = 22050
+	samples := int(seconds * sampleRate)
+	dataSize := samples * 2
+
+	wav := make([]byte, 44+dataSize)
+	copy(wav[0:], "RIFF")
+	binary.LittleEndian.PutUint32(wav[4:], uint32(36+dataSize))
+	copy(wav[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(wav[16:], 16)           // fmt chunk size
+	binary.LittleEndian.PutUint16(wav[20:], 1)            // PCM
+	binary.LittleEndian.PutUint16(wav[22:], 1)            // Mono
+	binary.LittleEndian.PutUint32(wav[24:], sampleRate)   // Sample rate
+	binary.LittleEndian.PutUint32(wav[28:], sampleRate*2) // Byte rate
+	binary.LittleEndian.PutUint16(wav[32:], 2)            // Block align
+	binary.LittleEndian.PutUint16(wav[34:], 16)           // Bits per sample
+	copy(wav[36:], "data")
+	binary.LittleEndian.PutUint32(wav[40:], uint32(dataSize))
+	for i := 0; i < samples; i++ {
+		sample := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+		binary.LittleEndian.PutUint16(wav[44+2*i:], uint16(sample))
+	}
+	return wav
+}
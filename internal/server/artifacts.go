@@ -0,0 +1,211 @@
+package server
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Artifact kinds listed by GET /pipelines/{id}/artifacts
+const (
+	ArtifactKindSegmentedImage = "segmented_image"
+	ArtifactKindMotionVideo    = "motion_video"
+	ArtifactKindFinalOutput    = "final_output"
+	ArtifactKindComparison     = "comparison_video"
+	ArtifactKindMusic          = "music" // Metadata only: the track is removed once composed
+)
+
+// artifactKinds are the downloadable kinds in listing order, with the manifest result
+// field recording each one's path and the artifact name keying its provenance
+var artifactKinds = []struct {
+	kind       string
+	provenance string
+	path       func(*pipeline.PipelineResult) string
+}{
+	{ArtifactKindSegmentedImage, pipeline.ArtifactSegmentedImage, func(r *pipeline.PipelineResult) string { return r.SegmentedImagePath }},
+	{ArtifactKindMotionVideo, pipeline.ArtifactMotionVideo, func(r *pipeline.PipelineResult) string { return r.MotionVideoPath }},
+	{ArtifactKindFinalOutput, pipeline.ArtifactFinalOutput, func(r *pipeline.PipelineResult) string { return r.FinalOutputPath }},
+	{ArtifactKindComparison, pipeline.ArtifactFinalOutput, func(r *pipeline.PipelineResult) string { return r.ComparisonPath }},
+}
+
+// artifactContentTypes covers the video containers mime.TypeByExtension doesn't know
+var artifactContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+}
+
+// errArtifactOutsideJob rejects a recorded path that resolves outside the job directory
+var errArtifactOutsideJob = errors.New("artifact is outside the pipeline's directory")
+
+// Artifact is a file a pipeline produced, or the metadata of the music it chose
+type Artifact struct {
+	Kind        string                `json:"kind"`
+	ContentType string                `json:"content_type,omitempty"`
+	Bytes       int64                 `json:"bytes,omitempty"`
+	URL         string                `json:"url,omitempty"` // Download URL; metadata-only artifacts have none
+	Provenance  *types.ToolProvenance `json:"provenance,omitempty"`
+	Quality     string                `json:"quality,omitempty"` // Music quality, "user" for a supplied soundtrack
+}
+
+// handleListArtifacts lists the artifacts recorded in a pipeline's manifest that are
+// still on disk, with their sizes and download URLs
+func (s *Server) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	id, result, ok := s.loadResult(w, r)
+	if !ok {
+		return
+	}
+
+	artifacts := []Artifact{}
+	if result != nil {
+		for _, entry := range artifactKinds {
+			path, err := s.artifactPath(id, entry.path(result))
+			if err != nil {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			artifacts = append(artifacts, Artifact{
+				Kind:        entry.kind,
+				ContentType: artifactContentType(path),
+				Bytes:       info.Size(),
+				URL:         "/pipelines/" + id + "/artifacts/" + entry.kind,
+				Provenance:  result.Provenance[entry.provenance],
+			})
+		}
+		if result.MusicQuality != "" {
+			artifacts = append(artifacts, Artifact{
+				Kind:       ArtifactKindMusic,
+				Provenance: result.Provenance[pipeline.ArtifactMusic],
+				Quality:    result.MusicQuality,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "artifacts": artifacts})
+}
+
+// handleGetArtifact streams one artifact. Only the path the manifest records for the
+// kind is served, and only inside the job's directory; range requests are supported.
+func (s *Server) handleGetArtifact(w http.ResponseWriter, r *http.Request) {
+	id, result, ok := s.loadResult(w, r)
+	if !ok {
+		return
+	}
+
+	kind := r.PathValue("kind")
+	var recorded string
+	known := false
+	for _, entry := range artifactKinds {
+		if entry.kind == kind {
+			known = true
+			if result != nil {
+				recorded = entry.path(result)
+			}
+		}
+	}
+	switch {
+	case kind == ArtifactKindMusic:
+		writeError(w, http.StatusNotFound, "music has no file; see the artifact list for its metadata")
+		return
+	case !known:
+		writeError(w, http.StatusNotFound, "unknown artifact kind: "+kind)
+		return
+	case recorded == "":
+		writeError(w, http.StatusNotFound, "pipeline has no "+kind+" yet")
+		return
+	}
+
+	path, err := s.artifactPath(id, recorded)
+	if err != nil {
+		if errors.Is(err, errArtifactOutsideJob) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeError(w, http.StatusNotFound, kind+" is no longer on disk")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, kind+" is no longer on disk")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, kind+" is no longer on disk")
+		return
+	}
+
+	w.Header().Set("Content-Type", artifactContentType(path))
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), file)
+}
+
+// loadResult validates the pipeline ID and loads the result recorded in its manifest,
+// nil before any stage finished. It writes the error response when it fails.
+func (s *Server) loadResult(w http.ResponseWriter, r *http.Request) (string, *pipeline.PipelineResult, bool) {
+	id, ok := pipelineID(w, r)
+	if !ok {
+		return "", nil, false
+	}
+	if _, err := s.store.Load(id); err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, "pipeline not found")
+			return "", nil, false
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", nil, false
+	}
+
+	manifest, err := pipeline.LoadManifest(s.store.ManifestPath(id))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", nil, false
+	}
+	if manifest == nil {
+		return id, nil, true
+	}
+	return id, manifest.Result, true
+}
+
+// artifactPath resolves a path recorded in a job's manifest, following symlinks, and
+// checks it stays inside the job's directory. Paths reported by the model in full AI
+// mode could point anywhere, so the manifest alone isn't trusted.
+func (s *Server) artifactPath(id, recorded string) (string, error) {
+	if recorded == "" {
+		return "", os.ErrNotExist
+	}
+	jobDir, err := filepath.EvalSymlinks(s.store.JobDir(id))
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(recorded)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(jobDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", errArtifactOutsideJob
+	}
+	return path, nil
+}
+
+// artifactContentType returns the Content-Type for an artifact from its extension
+func artifactContentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if contentType, ok := artifactContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// newArtifactJob creates a job whose manifest records result, after writing files
+// (relative to the job directory) with their contents
+func newArtifactJob(t *testing.T, srv *Server, files map[string]string, result func(jobDir string) *pipeline.PipelineResult) string {
+	t.Helper()
+	job := &Job{ID: "pipeline-1", Priority: PriorityInteractive, Status: JobCompleted, Duration: 2, SubmittedAt: time.Now()}
+	if err := srv.store.Create(job, strings.NewReader("photo"), ".png"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	jobDir := srv.store.JobDir(job.ID)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(jobDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	manifest := pipeline.NewManifest(job.ID, srv.store.PipelineInput(job))
+	manifest.Result = result(jobDir)
+	if err := manifest.Save(srv.store.ManifestPath(job.ID)); err != nil {
+		t.Fatalf("Failed to save manifest: %v", err)
+	}
+	return job.ID
+}
+
+func get(srv *Server, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestListArtifacts(t *testing.T) {
+	srv := newTestServer(t, 4)
+	id := newArtifactJob(t, srv, map[string]string{
+		"tmp/segmented.png": "png-bytes",
+		"output/final.mp4":  "0123456789",
+	}, func(jobDir string) *pipeline.PipelineResult {
+		result := &pipeline.PipelineResult{
+			SegmentedImagePath: filepath.Join(jobDir, "tmp/segmented.png"),
+			MotionVideoPath:    filepath.Join(jobDir, "tmp/motion.mp4"), // Already cleaned up
+			FinalOutputPath:    filepath.Join(jobDir, "output/final.mp4"),
+			MusicQuality:       pipeline.MusicQualityLow,
+		}
+		result.SetProvenance(pipeline.ArtifactMusic, &types.ToolProvenance{Server: "music", Tool: "SearchRecordings", TrackID: "t-1", TrackTitle: "Sunny"})
+		return result
+	})
+
+	rec := get(srv, "/pipelines/"+id+"/artifacts")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var listing struct {
+		Artifacts []Artifact `json:"artifacts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("Failed to parse listing: %v", err)
+	}
+
+	kinds := make(map[string]Artifact)
+	for _, artifact := range listing.Artifacts {
+		kinds[artifact.Kind] = artifact
+	}
+	if len(kinds) != 3 {
+		t.Fatalf("Expected segmented image, final output and music, got %+v", listing.Artifacts)
+	}
+	if a := kinds[ArtifactKindSegmentedImage]; a.ContentType != "image/png" || a.Bytes != 9 {
+		t.Errorf("Unexpected segmented image: %+v", a)
+	}
+	if a := kinds[ArtifactKindFinalOutput]; a.ContentType != "video/mp4" || a.Bytes != 10 || a.URL != "/pipelines/"+id+"/artifacts/final_output" {
+		t.Errorf("Unexpected final output: %+v", a)
+	}
+	if a := kinds[ArtifactKindMusic]; a.URL != "" || a.Quality != "low" || a.Provenance == nil || a.Provenance.TrackTitle != "Sunny" {
+		t.Errorf("Unexpected music: %+v", a)
+	}
+}
+
+func TestGetArtifactRange(t *testing.T) {
+	srv := newTestServer(t, 4)
+	id := newArtifactJob(t, srv, map[string]string{"output/final.mp4": "0123456789"},
+		func(jobDir string) *pipeline.PipelineResult {
+			return &pipeline.PipelineResult{FinalOutputPath: filepath.Join(jobDir, "output/final.mp4")}
+		})
+
+	rec := get(srv, "/pipelines/"+id+"/artifacts/final_output")
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" || rec.Header().Get("Content-Type") != "video/mp4" {
+		t.Errorf("Expected the whole video, got %d %q (%s)", rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+
+	rec = get(srv, "/pipelines/"+id+"/artifacts/final_output", "Range", "bytes=2-5")
+	body, _ := io.ReadAll(rec.Body)
+	if rec.Code != http.StatusPartialContent || string(body) != "2345" || rec.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("Expected bytes 2-5, got %d %q (%s)", rec.Code, body, rec.Header().Get("Content-Range"))
+	}
+}
+
+// TestGetArtifactGuard verifies only paths the manifest records inside the job's
+// directory are served
+func TestGetArtifactGuard(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	srv := newTestServer(t, 4)
+	id := newArtifactJob(t, srv, map[string]string{"tmp/segmented.png": "png"},
+		func(jobDir string) *pipeline.PipelineResult {
+			link := filepath.Join(jobDir, "output", "linked.mp4")
+			if err := os.Symlink(outside, link); err != nil {
+				t.Skipf("symlinks unsupported: %v", err)
+			}
+			return &pipeline.PipelineResult{
+				SegmentedImagePath: filepath.Join(jobDir, "tmp", "..", "..", "..", filepath.Base(filepath.Dir(outside)), "secret.txt"),
+				MotionVideoPath:    outside,
+				FinalOutputPath:    link,
+			}
+		})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/pipelines/" + id + "/artifacts/motion_video", http.StatusForbidden},    // Recorded outside the job
+		{"/pipelines/" + id + "/artifacts/final_output", http.StatusForbidden},    // Symlink out of the job
+		{"/pipelines/" + id + "/artifacts/segmented_image", http.StatusForbidden}, // Dot-dot path out of the job
+		{"/pipelines/" + id + "/artifacts/..%2F..%2Fetc%2Fpasswd", http.StatusNotFound},
+		{"/pipelines/" + id + "/artifacts/manifest.json", http.StatusNotFound},
+		{"/pipelines/" + id + "/artifacts/music", http.StatusNotFound},
+		{"/pipelines/..%2F" + id + "/artifacts/final_output", http.StatusBadRequest},
+		{"/pipelines/missing/artifacts/final_output", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := get(srv, tt.path)
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: expected %d, got %d: %s", tt.path, tt.status, rec.Code, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("GET %s leaked the file outside the job", tt.path)
+		}
+	}
+
+	rec := get(srv, "/pipelines/"+id+"/artifacts")
+	if strings.Contains(rec.Body.String(), "motion_video") || strings.Contains(rec.Body.String(), "final_output") {
+		t.Errorf("Expected the listing to leave out paths outside the job, got %s", rec.Body.String())
+	}
+}
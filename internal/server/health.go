@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+)
+
+// Readiness states reported by /readyz
+const (
+	ReadyStatus    = "ready"     // Every dependency is healthy
+	DegradedStatus = "degraded"  // Only optional dependencies are failing; still ready
+	NotReadyStatus = "not_ready" // A required dependency is failing
+	DrainingStatus = "draining"  // Shutdown has begun
+)
+
+// dependency is something the server needs to run pipelines, checked by /readyz
+type dependency struct {
+	name     string
+	required bool
+	checker  *client.HealthChecker
+}
+
+// DependencyHealth is one dependency's entry in the /readyz response
+type DependencyHealth struct {
+	Name      string    `json:"name"`
+	Required  bool      `json:"required"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Readiness is the /readyz response body
+type Readiness struct {
+	Status       string             `json:"status"`
+	Failing      []string           `json:"failing,omitempty"` // Names of failing dependencies
+	Dependencies []DependencyHealth `json:"dependencies"`
+}
+
+// AddDependency registers a check run by /readyz. Results are reused for the configured
+// health max age. A dependency listed in optional_dependencies only degrades readiness.
+func (s *Server) AddDependency(name string, check func(ctx context.Context) error) {
+	required := true
+	for _, optional := range s.config.OptionalDependencies {
+		if optional == name {
+			required = false
+			break
+		}
+	}
+	s.dependencies = append(s.dependencies, dependency{
+		name:     name,
+		required: required,
+		checker:  client.NewHealthChecker(check, s.config.HealthMaxAge),
+	})
+}
+
+// handleHealthz reports that the process is up
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the server should receive traffic: 200 when every required
+// dependency is healthy, 503 naming the failing dependencies otherwise or while draining
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.coordinator.Closed() {
+		writeJSON(w, http.StatusServiceUnavailable, Readiness{Status: DrainingStatus})
+		return
+	}
+
+	readiness := s.readiness(r.Context())
+	status := http.StatusOK
+	if readiness.Status == NotReadyStatus {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, readiness)
+}
+
+// readiness checks every dependency, reusing fresh cached results
+func (s *Server) readiness(ctx context.Context) Readiness {
+	readiness := Readiness{Status: ReadyStatus, Dependencies: []DependencyHealth{}}
+	for _, dep := range s.dependencies {
+		checkedAt, err := dep.checker.Check(ctx)
+		health := DependencyHealth{
+			Name:      dep.name,
+			Required:  dep.required,
+			Healthy:   err == nil,
+			CheckedAt: checkedAt,
+		}
+		if err != nil {
+			health.Error = err.Error()
+			readiness.Failing = append(readiness.Failing, dep.name)
+			if dep.required {
+				readiness.Status = NotReadyStatus
+			} else if readiness.Status == ReadyStatus {
+				readiness.Status = DegradedStatus
+			}
+		}
+		readiness.Dependencies = append(readiness.Dependencies, health)
+	}
+	return readiness
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// fakeHealthClient is an MCP client whose ping fails with err
+type fakeHealthClient struct {
+	err   error
+	pings int
+}
+
+func (f *fakeHealthClient) Connect(ctx context.Context) error    { return nil }
+func (f *fakeHealthClient) Initialize(ctx context.Context) error { return nil }
+func (f *fakeHealthClient) Close() error                         { return nil }
+func (f *fakeHealthClient) GetServerInfo() (string, string)      { return "fake", "1.0.0" }
+func (f *fakeHealthClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	return nil, nil
+}
+func (f *fakeHealthClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	return nil, nil
+}
+func (f *fakeHealthClient) Ping(ctx context.Context) error {
+	f.pings++
+	return f.err
+}
+
+// newHealthServer creates a server whose dependencies are fake clients
+func newHealthServer(t *testing.T, optional []string, clients map[string]*fakeHealthClient) *Server {
+	t.Helper()
+	srv, err := New(types.ServeConfig{
+		DataDir:              t.TempDir(),
+		OptionalDependencies: optional,
+	}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, name := range []string{"imagesorcery", "music"} {
+		fake := clients[name]
+		srv.AddDependency(name, func(ctx context.Context) error {
+			return client.Ping(ctx, fake)
+		})
+	}
+	return srv
+}
+
+func getReadiness(t *testing.T, srv *Server) (int, Readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var readiness Readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("invalid readiness body %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, readiness
+}
+
+func TestReadyz(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name        string
+		optional    []string
+		musicErr    error
+		wantCode    int
+		wantStatus  string
+		wantFailing []string
+	}{
+		{"healthy", nil, nil, http.StatusOK, ReadyStatus, nil},
+		{"degraded optional", []string{"music"}, down, http.StatusOK, DegradedStatus, []string{"music"}},
+		{"failed required", nil, down, http.StatusServiceUnavailable, NotReadyStatus, []string{"music"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newHealthServer(t, tt.optional, map[string]*fakeHealthClient{
+				"imagesorcery": {},
+				"music":        {err: tt.musicErr},
+			})
+
+			code, readiness := getReadiness(t, srv)
+			if code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", code, tt.wantCode)
+			}
+			if readiness.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", readiness.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(readiness.Failing, tt.wantFailing) {
+				t.Errorf("failing = %v, want %v", readiness.Failing, tt.wantFailing)
+			}
+			if len(readiness.Dependencies) != 2 {
+				t.Fatalf("got %d dependencies, want 2", len(readiness.Dependencies))
+			}
+			music := readiness.Dependencies[1]
+			if music.Healthy != (tt.musicErr == nil) || music.Required != (tt.optional == nil) {
+				t.Errorf("music = %+v", music)
+			}
+			if tt.musicErr != nil && music.Error != tt.musicErr.Error() {
+				t.Errorf("music error = %q, want %q", music.Error, tt.musicErr.Error())
+			}
+		})
+	}
+}
+
+// TestReadyzCachesChecks verifies probes within the max age reuse the last ping
+func TestReadyzCachesChecks(t *testing.T) {
+	imagesorcery := &fakeHealthClient{}
+	srv := newHealthServer(t, nil, map[string]*fakeHealthClient{
+		"imagesorcery": imagesorcery,
+		"music":        {},
+	})
+
+	for i := 0; i < 3; i++ {
+		getReadiness(t, srv)
+	}
+	if imagesorcery.pings != 1 {
+		t.Errorf("pinged %d times, want 1", imagesorcery.pings)
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	srv := newHealthServer(t, nil, map[string]*fakeHealthClient{
+		"imagesorcery": {},
+		"music":        {},
+	})
+	srv.coordinator.Drain(time.Second)
+
+	code, readiness := getReadiness(t, srv)
+	if code != http.StatusServiceUnavailable || readiness.Status != DrainingStatus {
+		t.Errorf("got %d %s, want 503 %s", code, readiness.Status, DrainingStatus)
+	}
+
+	// The process is still up while draining
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// Priority orders queued jobs; interactive jobs run ahead of batch jobs
+type Priority string
+
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityBatch       Priority = "batch"
+)
+
+// rank returns the scheduling rank of a priority (lower runs first)
+func (p Priority) rank() int {
+	if p == PriorityBatch {
+		return 1
+	}
+	return 0
+}
+
+// ParsePriority validates a submitted priority, defaulting to interactive
+func ParsePriority(value string) (Priority, error) {
+	switch Priority(value) {
+	case "", PriorityInteractive:
+		return PriorityInteractive, nil
+	case PriorityBatch:
+		return PriorityBatch, nil
+	default:
+		return "", fmt.Errorf("invalid priority: %s (supported: interactive, batch)", value)
+	}
+}
+
+// JobStatus represents the lifecycle state of a submitted job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a pipeline submission persisted in the job store
+type Job struct {
+	ID          string                   `json:"id"`
+	Priority    Priority                 `json:"priority"`
+	Status      JobStatus                `json:"status"`
+	ImagePath   string                   `json:"image_path"`
+	Duration    float64                  `json:"duration"`
+	UserPrompt  string                   `json:"user_prompt,omitempty"`
+	SubmittedAt time.Time                `json:"submitted_at"`
+	StartedAt   *time.Time               `json:"started_at,omitempty"`
+	FinishedAt  *time.Time               `json:"finished_at,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	FailureKind string                   `json:"failure_kind,omitempty"`
+	Result      *pipeline.PipelineResult `json:"result,omitempty"`
+
+	seq int64 // submission order within a priority, assigned by the queue
+}
+
+// JobStore persists jobs as one directory per job under a data directory
+type JobStore struct {
+	dir string
+}
+
+// NewJobStore creates a job store rooted at dir
+func NewJobStore(dir string) (*JobStore, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data directory: %w", err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	return &JobStore{dir: absDir}, nil
+}
+
+// JobDir returns the directory holding a job's files
+func (s *JobStore) JobDir(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// ManifestPath returns the pipeline manifest path for a job
+func (s *JobStore) ManifestPath(id string) string {
+	return filepath.Join(s.JobDir(id), "manifest.json")
+}
+
+// TempDir returns the intermediate file directory for a job
+func (s *JobStore) TempDir(id string) string {
+	return filepath.Join(s.JobDir(id), "tmp")
+}
+
+// OutputDir returns the final output directory for a job
+func (s *JobStore) OutputDir(id string) string {
+	return filepath.Join(s.JobDir(id), "output")
+}
+
+// Create stores the uploaded image and job record and pre-creates a pending manifest
+func (s *JobStore) Create(job *Job, image io.Reader, ext string) error {
+	jobDir := s.JobDir(job.ID)
+	if err := os.Mkdir(jobDir, 0755); err != nil {
+		return fmt.Errorf("failed to create job directory: %w", err)
+	}
+	for _, dir := range []string{s.TempDir(job.ID), s.OutputDir(job.ID)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create job directory: %w", err)
+		}
+	}
+
+	job.ImagePath = filepath.Join(jobDir, "input"+ext)
+	f, err := os.Create(job.ImagePath)
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+	if _, err := io.Copy(f, image); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to store image: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to store image: %w", err)
+	}
+
+	manifest := pipeline.NewManifest(job.ID, s.PipelineInput(job))
+	if err := manifest.Save(s.ManifestPath(job.ID)); err != nil {
+		return err
+	}
+
+	return s.Save(job)
+}
+
+// PipelineInput builds the pipeline input for a job
+func (s *JobStore) PipelineInput(job *Job) types.PipelineInput {
+	return types.PipelineInput{
+		ImagePath:  job.ImagePath,
+		Duration:   job.Duration,
+		UserPrompt: job.UserPrompt,
+		OutputDir:  s.OutputDir(job.ID),
+		TempDir:    s.TempDir(job.ID),
+	}
+}
+
+// Save writes the job record atomically
+func (s *JobStore) Save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	path := filepath.Join(s.JobDir(job.ID), "job.json")
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write job: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename job: %w", err)
+	}
+	return nil
+}
+
+// Load reads a single job record
+func (s *JobStore) Load(id string) (*Job, error) {
+	data, err := os.ReadFile(filepath.Join(s.JobDir(id), "job.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to parse job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// LoadAll reads every job record in the store, ordered by submission time. A record
+// that can't be read, e.g. one truncated by a crash, is logged and skipped so it doesn't
+// keep the other jobs from loading.
+func (s *JobStore) LoadAll() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		job, err := s.Load(entry.Name())
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("[Server] Warning: skipping job %s: %v", entry.Name(), err)
+			}
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].SubmittedAt.Before(jobs[j].SubmittedAt)
+	})
+	return jobs, nil
+}
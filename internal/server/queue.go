@@ -0,0 +1,196 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when a submission would exceed the queue depth
+var ErrQueueFull = errors.New("job queue is full")
+
+// QueueStats reports the queue state for the /queue endpoint
+type QueueStats struct {
+	Depth    int           `json:"depth"`
+	Capacity int           `json:"capacity"`
+	Workers  int           `json:"workers"`
+	Queued   []QueuedEntry `json:"queued"`
+	InFlight []string      `json:"in_flight"`
+}
+
+// QueuedEntry describes a job waiting in the queue
+type QueuedEntry struct {
+	ID       string   `json:"id"`
+	Priority Priority `json:"priority"`
+}
+
+// JobQueue is a bounded priority queue of jobs consumed by a fixed set of workers
+type JobQueue struct {
+	mu       sync.Mutex
+	pending  jobHeap
+	capacity int
+	workers  int
+	seq      int64
+	inFlight map[string]*Job
+	wake     chan struct{}
+}
+
+// NewJobQueue creates a queue holding at most capacity waiting jobs
+func NewJobQueue(capacity, workers int) *JobQueue {
+	return &JobQueue{
+		capacity: capacity,
+		workers:  workers,
+		inFlight: make(map[string]*Job),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds a job, returning ErrQueueFull when the queue is at capacity
+func (q *JobQueue) Enqueue(job *Job) error {
+	q.mu.Lock()
+	if q.pending.Len() >= q.capacity {
+		q.mu.Unlock()
+		return ErrQueueFull
+	}
+	q.push(job)
+	q.mu.Unlock()
+
+	q.signal()
+	return nil
+}
+
+// IsFull reports whether the queue is at capacity
+func (q *JobQueue) IsFull() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending.Len() >= q.capacity
+}
+
+// Restore re-enqueues a persisted job on startup, ignoring the capacity limit
+func (q *JobQueue) Restore(job *Job) {
+	q.mu.Lock()
+	q.push(job)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// Run starts the workers and blocks until ctx is cancelled and all workers return.
+// Cancelling ctx only stops workers from taking new jobs; in-flight runs finish first.
+func (q *JobQueue) Run(ctx context.Context, run func(job *Job)) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := q.next(ctx)
+				if err != nil {
+					return
+				}
+				run(job)
+				q.finish(job)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Stats returns a snapshot of queued and in-flight jobs
+func (q *JobQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := QueueStats{
+		Depth:    q.pending.Len(),
+		Capacity: q.capacity,
+		Workers:  q.workers,
+		Queued:   []QueuedEntry{},
+		InFlight: []string{},
+	}
+
+	ordered := make(jobHeap, len(q.pending))
+	copy(ordered, q.pending)
+	for ordered.Len() > 0 {
+		job := heap.Pop(&ordered).(*Job)
+		stats.Queued = append(stats.Queued, QueuedEntry{ID: job.ID, Priority: job.Priority})
+	}
+	for id := range q.inFlight {
+		stats.InFlight = append(stats.InFlight, id)
+	}
+
+	return stats
+}
+
+// push adds a job to the heap; caller must hold q.mu
+func (q *JobQueue) push(job *Job) {
+	q.seq++
+	job.seq = q.seq
+	heap.Push(&q.pending, job)
+}
+
+// next blocks until a job is available or ctx is cancelled
+func (q *JobQueue) next(ctx context.Context) (*Job, error) {
+	for {
+		q.mu.Lock()
+		if q.pending.Len() > 0 {
+			job := heap.Pop(&q.pending).(*Job)
+			q.inFlight[job.ID] = job
+			remaining := q.pending.Len()
+			q.mu.Unlock()
+
+			// Pass the wakeup on so idle workers pick up remaining jobs
+			if remaining > 0 {
+				q.signal()
+			}
+			return job, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// finish removes a job from the in-flight set
+func (q *JobQueue) finish(job *Job) {
+	q.mu.Lock()
+	delete(q.inFlight, job.ID)
+	q.mu.Unlock()
+}
+
+// signal wakes one idle worker without blocking
+func (q *JobQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// jobHeap orders jobs by priority rank, then submission order
+type jobHeap []*Job
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].Priority.rank() != h[j].Priority.rank() {
+		return h[i].Priority.rank() < h[j].Priority.rank()
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x interface{}) { *h = append(*h, x.(*Job)) }
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	*h = old[:n-1]
+	return job
+}
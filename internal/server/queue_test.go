@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestJobQueuePriorityOrder verifies interactive jobs run ahead of batch jobs, FIFO within a priority
+func TestJobQueuePriorityOrder(t *testing.T) {
+	queue := NewJobQueue(10, 1)
+
+	submissions := []*Job{
+		{ID: "batch-1", Priority: PriorityBatch},
+		{ID: "interactive-1", Priority: PriorityInteractive},
+		{ID: "batch-2", Priority: PriorityBatch},
+		{ID: "interactive-2", Priority: PriorityInteractive},
+	}
+	for _, job := range submissions {
+		if err := queue.Enqueue(job); err != nil {
+			t.Fatalf("Enqueue %s failed: %v", job.ID, err)
+		}
+	}
+
+	expected := []string{"interactive-1", "interactive-2", "batch-1", "batch-2"}
+
+	stats := queue.Stats()
+	for i, entry := range stats.Queued {
+		if entry.ID != expected[i] {
+			t.Errorf("Stats position %d: expected %s, got %s", i, expected[i], entry.ID)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var order []string
+	go queue.Run(ctx, func(job *Job) {
+		mu.Lock()
+		order = append(order, job.ID)
+		done := len(order) == len(expected)
+		mu.Unlock()
+		if done {
+			cancel()
+		}
+	})
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		cancel()
+		t.Fatal("Timed out waiting for jobs to run")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, id := range expected {
+		if order[i] != id {
+			t.Errorf("Run position %d: expected %s, got %s", i, id, order[i])
+		}
+	}
+}
+
+// TestJobQueueFull verifies submissions beyond capacity are rejected, but restores are not
+func TestJobQueueFull(t *testing.T) {
+	queue := NewJobQueue(2, 1)
+
+	for _, id := range []string{"a", "b"} {
+		if err := queue.Enqueue(&Job{ID: id}); err != nil {
+			t.Fatalf("Enqueue %s failed: %v", id, err)
+		}
+	}
+
+	if !queue.IsFull() {
+		t.Error("Expected queue to report full")
+	}
+
+	if err := queue.Enqueue(&Job{ID: "c"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull, got %v", err)
+	}
+
+	queue.Restore(&Job{ID: "restored"})
+	if depth := queue.Stats().Depth; depth != 3 {
+		t.Errorf("Expected depth 3 after restore, got %d", depth)
+	}
+}
+
+// TestJobQueueInFlight verifies running jobs are reported as in flight
+func TestJobQueueInFlight(t *testing.T) {
+	queue := NewJobQueue(10, 1)
+	queue.Enqueue(&Job{ID: "slow"})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go queue.Run(ctx, func(job *Job) {
+		close(started)
+		<-release
+	})
+
+	<-started
+	stats := queue.Stats()
+	if len(stats.InFlight) != 1 || stats.InFlight[0] != "slow" {
+		t.Errorf("Expected slow in flight, got %v", stats.InFlight)
+	}
+	if stats.Depth != 0 {
+		t.Errorf("Expected empty queue, got depth %d", stats.Depth)
+	}
+	close(release)
+}
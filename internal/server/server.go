@@ -0,0 +1,362 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// maxUploadBytes limits the size of a submitted image
+const maxUploadBytes = 32 << 20
+
+// allowedImageExts are the image extensions accepted for upload
+var allowedImageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".webp": true,
+}
+
+// PipelineFactory builds a pipeline that persists its manifest at manifestPath
+type PipelineFactory func(manifestPath string) *pipeline.Pipeline
+
+// Server exposes pipeline submission over REST with a bounded job queue
+type Server struct {
+	config      types.ServeConfig
+	store       *JobStore
+	queue       *JobQueue
+	coordinator *ShutdownCoordinator
+	newPipeline PipelineFactory
+
+	dependencies []dependency // checked by /readyz, see AddDependency
+}
+
+// New creates a server; zero-valued config fields fall back to defaults
+func New(config types.ServeConfig, newPipeline PipelineFactory) (*Server, error) {
+	if config.Addr == "" {
+		config.Addr = ":8080"
+	}
+	if config.DataDir == "" {
+		config.DataDir = ".pipeline_jobs"
+	}
+	if config.QueueDepth <= 0 {
+		config.QueueDepth = 16
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.RetryAfterSeconds <= 0 {
+		config.RetryAfterSeconds = 30
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = 60 * time.Second
+	}
+
+	store, err := NewJobStore(config.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		config:      config,
+		store:       store,
+		queue:       NewJobQueue(config.QueueDepth, config.Workers),
+		coordinator: NewShutdownCoordinator(),
+		newPipeline: newPipeline,
+	}, nil
+}
+
+// Handler returns the HTTP handler for the REST API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /pipelines", s.handleSubmit)
+	mux.HandleFunc("GET /pipelines/{id}", s.handleGetPipeline)
+	mux.HandleFunc("GET /pipelines/{id}/artifacts", s.handleListArtifacts)
+	mux.HandleFunc("GET /pipelines/{id}/artifacts/{kind}", s.handleGetArtifact)
+	mux.HandleFunc("GET /queue", s.handleQueue)
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	return mux
+}
+
+// Run restores persisted jobs, starts the workers and serves HTTP until ctx is cancelled.
+// On cancellation it drains in-flight runs before returning, so callers can close the
+// MCP clients afterwards.
+func (s *Server) Run(ctx context.Context) error {
+	if err := s.restoreJobs(); err != nil {
+		return err
+	}
+
+	intakeCtx, closeIntake := context.WithCancel(ctx)
+	defer closeIntake()
+
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		s.queue.Run(intakeCtx, s.runJob)
+	}()
+
+	httpServer := &http.Server{
+		Addr:    s.config.Addr,
+		Handler: s.Handler(),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	log.Printf("[Server] Listening on %s (queue depth: %d, workers: %d)", s.config.Addr, s.config.QueueDepth, s.config.Workers)
+
+	var err error
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-ctx.Done():
+	}
+
+	// Stop taking jobs, then let in-flight runs finish; status requests are still served
+	closeIntake()
+	s.drain(workersDone)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("[Server] Warning: HTTP shutdown failed: %v", shutdownErr)
+	}
+
+	return err
+}
+
+// drain waits for in-flight runs up to the drain timeout, then for the workers to exit.
+// Runs still active at the deadline are cancelled and checkpoint their manifests.
+func (s *Server) drain(workersDone <-chan struct{}) {
+	log.Printf("[Server] Shutting down, draining in-flight runs (timeout: %s)", s.config.DrainTimeout)
+	if s.coordinator.Drain(s.config.DrainTimeout) {
+		log.Println("[Server] All in-flight runs finished")
+	} else {
+		log.Println("[Server] Drain timeout reached, interrupted runs will resume on restart")
+	}
+	<-workersDone
+}
+
+// restoreJobs re-enqueues jobs that were queued or running when the server stopped
+func (s *Server) restoreJobs() error {
+	jobs, err := s.store.LoadAll()
+	if err != nil {
+		return fmt.Errorf("failed to load persisted jobs: %w", err)
+	}
+
+	restored := 0
+	for _, job := range jobs {
+		if job.Status != JobQueued && job.Status != JobRunning {
+			continue
+		}
+		job.Status = JobQueued
+		if err := s.store.Save(job); err != nil {
+			return err
+		}
+		s.queue.Restore(job)
+		restored++
+	}
+
+	if restored > 0 {
+		log.Printf("[Server] Re-enqueued %d persisted jobs", restored)
+	}
+	return nil
+}
+
+// runJob executes a job's pipeline and records the outcome
+func (s *Server) runJob(job *Job) {
+	ctx, done, err := s.coordinator.Begin()
+	if err != nil {
+		// Taken off the queue as shutdown began; it is still queued on disk
+		log.Printf("[Server] Job %s not started: %v", job.ID, err)
+		return
+	}
+	defer done()
+
+	started := time.Now()
+	job.Status = JobRunning
+	job.StartedAt = &started
+	if err := s.store.Save(job); err != nil {
+		log.Printf("[Server] Warning: failed to save job %s: %v", job.ID, err)
+	}
+
+	log.Printf("[Server] Running job %s (priority: %s)", job.ID, job.Priority)
+	p := s.newPipeline(s.store.ManifestPath(job.ID))
+	result, err := p.Execute(ctx, s.store.PipelineInput(job), job.ID)
+
+	// Interrupted at the drain deadline: the manifest was checkpointed, so leave the
+	// job running and it resumes on restart
+	if ctx.Err() != nil {
+		log.Printf("[Server] Job %s interrupted, will resume on restart", job.ID)
+		return
+	}
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		job.FailureKind = pipeline.FailureKind(err)
+		log.Printf("[Server] Job %s failed: %v", job.ID, err)
+	} else {
+		job.Status = JobCompleted
+		job.Result = result
+		log.Printf("[Server] Job %s completed", job.ID)
+	}
+
+	if err := s.store.Save(job); err != nil {
+		log.Printf("[Server] Warning: failed to save job %s: %v", job.ID, err)
+	}
+}
+
+// handleSubmit accepts a multipart image upload and enqueues a pipeline job
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	// Reject new work once shutdown has begun
+	if s.coordinator.Closed() {
+		w.Header().Set("Retry-After", strconv.Itoa(s.config.RetryAfterSeconds))
+		writeError(w, http.StatusServiceUnavailable, ErrShuttingDown.Error())
+		return
+	}
+
+	// Reject before reading the upload when the queue is already full
+	if s.queue.IsFull() {
+		s.writeQueueFull(w)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid multipart form: %v", err))
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "image file is required")
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !allowedImageExts[ext] {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported image type: %s", ext))
+		return
+	}
+
+	priority, err := ParsePriority(r.FormValue("priority"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	duration := 10.0
+	if value := r.FormValue("duration"); value != "" {
+		duration, err = strconv.ParseFloat(value, 64)
+		if err != nil || duration <= 0 {
+			writeError(w, http.StatusBadRequest, "duration must be a positive number")
+			return
+		}
+	}
+
+	job := &Job{
+		ID:          fmt.Sprintf("pipeline-%d", time.Now().UnixNano()),
+		Priority:    priority,
+		Status:      JobQueued,
+		Duration:    duration,
+		UserPrompt:  r.FormValue("prompt"),
+		SubmittedAt: time.Now(),
+	}
+
+	if err := s.store.Create(job, file, ext); err != nil {
+		os.RemoveAll(s.store.JobDir(job.ID))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// A worker may start the job as soon as it is queued, so respond with the job as accepted
+	accepted := *job
+	if err := s.queue.Enqueue(job); err != nil {
+		os.RemoveAll(s.store.JobDir(job.ID))
+		if errors.Is(err, ErrQueueFull) {
+			s.writeQueueFull(w)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("[Server] Accepted job %s (priority: %s)", accepted.ID, accepted.Priority)
+	writeJSON(w, http.StatusAccepted, &accepted)
+}
+
+// handleGetPipeline returns the persisted state of a job
+func (s *Server) handleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	id, ok := pipelineID(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := s.store.Load(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, "pipeline not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// pipelineID returns the {id} path value, rejecting IDs that could leave the data
+// directory with a 400 response
+func pipelineID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		writeError(w, http.StatusBadRequest, "invalid pipeline id")
+		return "", false
+	}
+	return id, true
+}
+
+// handleQueue reports queue depth and in-flight jobs
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.queue.Stats())
+}
+
+// writeQueueFull responds with 429 and a Retry-After hint
+func (s *Server) writeQueueFull(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(s.config.RetryAfterSeconds))
+	writeError(w, http.StatusTooManyRequests, ErrQueueFull.Error())
+}
+
+// writeJSON writes a JSON response body
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("[Server] Warning: failed to write response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
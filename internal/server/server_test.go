@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// newTestServer creates a server backed by a temporary data directory
+func newTestServer(t *testing.T, queueDepth int) *Server {
+	t.Helper()
+	srv, err := New(types.ServeConfig{
+		DataDir:           t.TempDir(),
+		QueueDepth:        queueDepth,
+		RetryAfterSeconds: 7,
+	}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return srv
+}
+
+// newSubmission builds a multipart pipeline submission
+func newSubmission(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("image", "photo.png")
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	part.Write([]byte("fake image"))
+
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/pipelines", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// TestSubmitPersistsJob verifies a submission stores the image, job record and pending manifest
+func TestSubmitPersistsJob(t *testing.T) {
+	srv := newTestServer(t, 4)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, newSubmission(t, map[string]string{
+		"priority": "batch",
+		"duration": "5",
+		"prompt":   "make it shake",
+	}))
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var job Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if job.Priority != PriorityBatch || job.Duration != 5 || job.Status != JobQueued {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	if _, err := os.Stat(job.ImagePath); err != nil {
+		t.Errorf("Expected stored image: %v", err)
+	}
+
+	manifest, err := pipeline.LoadManifest(srv.store.ManifestPath(job.ID))
+	if err != nil || manifest == nil {
+		t.Fatalf("Expected pre-created manifest, got %v (err: %v)", manifest, err)
+	}
+	if manifest.CurrentStage != types.StageInit {
+		t.Errorf("Expected manifest in init stage, got %s", manifest.CurrentStage)
+	}
+}
+
+// TestSubmitQueueFull verifies 429 with Retry-After when the queue is at capacity
+func TestSubmitQueueFull(t *testing.T) {
+	srv := newTestServer(t, 1)
+
+	first := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(first, newSubmission(t, nil))
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("Expected first submission accepted, got %d", first.Code)
+	}
+
+	second := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(second, newSubmission(t, nil))
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", second.Code)
+	}
+	if got := second.Header().Get("Retry-After"); got != "7" {
+		t.Errorf("Expected Retry-After 7, got %q", got)
+	}
+}
+
+// TestSubmitInvalidPriority verifies unknown priorities are rejected
+func TestSubmitInvalidPriority(t *testing.T) {
+	srv := newTestServer(t, 4)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, newSubmission(t, map[string]string{"priority": "urgent"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", rec.Code)
+	}
+}
+
+// TestQueueEndpoint verifies /queue reports queued jobs
+func TestQueueEndpoint(t *testing.T) {
+	srv := newTestServer(t, 4)
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), newSubmission(t, nil))
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queue", nil))
+
+	var stats QueueStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if stats.Depth != 1 || stats.Capacity != 4 || len(stats.Queued) != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// TestRestoreJobs verifies queued and running jobs are re-enqueued on startup
+func TestRestoreJobs(t *testing.T) {
+	srv := newTestServer(t, 4)
+
+	now := time.Now()
+	jobs := []*Job{
+		{ID: "queued", Status: JobQueued, SubmittedAt: now},
+		{ID: "running", Status: JobRunning, SubmittedAt: now.Add(time.Second)},
+		{ID: "done", Status: JobCompleted, SubmittedAt: now.Add(2 * time.Second)},
+	}
+	for _, job := range jobs {
+		if err := srv.store.Create(job, bytes.NewReader([]byte("img")), ".png"); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	if err := srv.restoreJobs(); err != nil {
+		t.Fatalf("restoreJobs failed: %v", err)
+	}
+
+	stats := srv.queue.Stats()
+	if stats.Depth != 2 {
+		t.Fatalf("Expected 2 restored jobs, got %d", stats.Depth)
+	}
+
+	running, err := srv.store.Load("running")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if running.Status != JobQueued {
+		t.Errorf("Expected interrupted job to be queued again, got %s", running.Status)
+	}
+}
+
+// TestRestoreJobsSkipsCorruptRecord verifies a job record truncated by a crash doesn't
+// keep the other persisted jobs from being restored
+func TestRestoreJobsSkipsCorruptRecord(t *testing.T) {
+	srv := newTestServer(t, 4)
+
+	now := time.Now()
+	for _, job := range []*Job{
+		{ID: "first", Status: JobQueued, SubmittedAt: now},
+		{ID: "truncated", Status: JobQueued, SubmittedAt: now.Add(time.Second)},
+		{ID: "last", Status: JobRunning, SubmittedAt: now.Add(2 * time.Second)},
+	} {
+		if err := srv.store.Create(job, bytes.NewReader([]byte("img")), ".png"); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	jobPath := filepath.Join(srv.store.JobDir("truncated"), "job.json")
+	if err := os.WriteFile(jobPath, []byte(`{"id": "truncated", "sta`), 0644); err != nil {
+		t.Fatalf("Failed to corrupt job: %v", err)
+	}
+
+	if err := srv.restoreJobs(); err != nil {
+		t.Fatalf("restoreJobs failed: %v", err)
+	}
+	if depth := srv.queue.Stats().Depth; depth != 2 {
+		t.Errorf("Expected the 2 readable jobs restored, got %d", depth)
+	}
+}
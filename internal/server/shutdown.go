@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrShuttingDown is returned when a run is started after shutdown has begun
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// ShutdownCoordinator tracks active pipeline runs so shutdown can drain them
+// before the MCP clients they depend on are closed
+type ShutdownCoordinator struct {
+	mu         sync.Mutex
+	closed     bool
+	active     sync.WaitGroup
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+}
+
+// NewShutdownCoordinator creates a coordinator accepting new runs
+func NewShutdownCoordinator() *ShutdownCoordinator {
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	return &ShutdownCoordinator{
+		runCtx:     runCtx,
+		cancelRuns: cancelRuns,
+	}
+}
+
+// Begin registers an active run. The returned context is only cancelled when the
+// drain deadline passes; call done when the run returns.
+func (c *ShutdownCoordinator) Begin() (context.Context, func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, nil, ErrShuttingDown
+	}
+	c.active.Add(1)
+	return c.runCtx, c.active.Done, nil
+}
+
+// Closed reports whether shutdown has begun
+func (c *ShutdownCoordinator) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Drain stops accepting runs and waits up to timeout for active runs to finish.
+// Runs still active at the deadline are cancelled so they checkpoint their manifest,
+// and Drain waits for them to return. Returns true if every run finished in time.
+func (c *ShutdownCoordinator) Drain(timeout time.Duration) bool {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		c.active.Wait()
+		close(finished)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-finished:
+		c.cancelRuns()
+		return true
+	case <-timer.C:
+		c.cancelRuns()
+		<-finished
+		return false
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhe.chen/agent-funpic-act/internal/client"
+	"github.com/zhe.chen/agent-funpic-act/internal/pipeline"
+	"github.com/zhe.chen/agent-funpic-act/pkg/types"
+)
+
+// stageMCPClient is an MCPClient whose tool calls block like a long-running stage
+type stageMCPClient struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newStageMCPClient() *stageMCPClient {
+	return &stageMCPClient{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *stageMCPClient) Connect(ctx context.Context) error    { return nil }
+func (s *stageMCPClient) Initialize(ctx context.Context) error { return nil }
+func (s *stageMCPClient) Close() error                         { return nil }
+func (s *stageMCPClient) GetServerInfo() (string, string)      { return "stage", "1.0.0" }
+
+func (s *stageMCPClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	return nil, nil
+}
+
+func (s *stageMCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*types.ToolCallResult, error) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-s.release:
+		return nil, fmt.Errorf("%s finished without detections", name)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TestShutdownCoordinatorDrained verifies Drain returns true once active runs finish
+func TestShutdownCoordinatorDrained(t *testing.T) {
+	coordinator := NewShutdownCoordinator()
+
+	ctx, done, err := coordinator.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done()
+	}()
+
+	if !coordinator.Drain(time.Second) {
+		t.Error("Expected drain to finish before the deadline")
+	}
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected run context to be released after drain, got %v", ctx.Err())
+	}
+
+	if _, _, err := coordinator.Begin(); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown after drain, got %v", err)
+	}
+}
+
+// TestShutdownCoordinatorDeadline verifies runs are cancelled at the deadline and awaited
+func TestShutdownCoordinatorDeadline(t *testing.T) {
+	coordinator := NewShutdownCoordinator()
+
+	ctx, done, err := coordinator.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	checkpointed := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(checkpointed)
+		done()
+	}()
+
+	if coordinator.Drain(20 * time.Millisecond) {
+		t.Error("Expected drain to hit the deadline")
+	}
+
+	select {
+	case <-checkpointed:
+	default:
+		t.Error("Expected Drain to wait for the cancelled run to return")
+	}
+}
+
+// newDrainTestServer creates a server whose pipelines run a blocking segment stage
+func newDrainTestServer(t *testing.T, drainTimeout time.Duration, stage *stageMCPClient) *Server {
+	t.Helper()
+	factory := func(manifestPath string) *pipeline.Pipeline {
+		var idle client.MCPClient = newStageMCPClient()
+		return pipeline.NewPipeline(stage, idle, idle, idle, nil, false, 3, manifestPath, "lightweight")
+	}
+
+	srv, err := New(types.ServeConfig{
+		Addr:         "127.0.0.1:0",
+		DataDir:      t.TempDir(),
+		DrainTimeout: drainTimeout,
+	}, factory)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return srv
+}
+
+// startAndShutdown submits a job, starts the server and begins shutdown once the stage
+// is running. The returned channel yields Run's result.
+func startAndShutdown(t *testing.T, srv *Server, stage *stageMCPClient) <-chan error {
+	t.Helper()
+	job := &Job{ID: "job-1", Status: JobQueued, Duration: 5, SubmittedAt: time.Now()}
+	if err := srv.store.Create(job, strings.NewReader("img"), ".png"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx) }()
+
+	select {
+	case <-stage.started:
+	case <-time.After(2 * time.Second):
+		cancel()
+		t.Fatal("Timed out waiting for stage to start")
+	}
+
+	cancel()
+	return runErr
+}
+
+// waitForRun waits for Run to return after shutdown
+func waitForRun(t *testing.T, runErr <-chan error) {
+	t.Helper()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for Run to return")
+	}
+}
+
+// TestServerShutdownDrainsInFlightRuns verifies a run that finishes within the drain
+// timeout completes while new submissions are rejected
+func TestServerShutdownDrainsInFlightRuns(t *testing.T) {
+	stage := newStageMCPClient()
+	srv := newDrainTestServer(t, 5*time.Second, stage)
+
+	runErr := startAndShutdown(t, srv, stage)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !srv.coordinator.Closed() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, newSubmission(t, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while draining, got %d", rec.Code)
+	}
+
+	close(stage.release)
+	waitForRun(t, runErr)
+
+	job, err := srv.store.Load("job-1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if job.Status != JobFailed || job.FinishedAt == nil {
+		t.Errorf("Expected the run to finish during drain, got %s", job.Status)
+	}
+}
+
+// TestServerShutdownCheckpointsAtDeadline verifies runs still active at the deadline are
+// checkpointed and left resumable
+func TestServerShutdownCheckpointsAtDeadline(t *testing.T) {
+	stage := newStageMCPClient()
+	srv := newDrainTestServer(t, 50*time.Millisecond, stage)
+
+	waitForRun(t, startAndShutdown(t, srv, stage))
+
+	job, err := srv.store.Load("job-1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if job.Status != JobRunning {
+		t.Errorf("Expected interrupted job to stay running for restart, got %s", job.Status)
+	}
+
+	manifest, err := pipeline.LoadManifest(srv.store.ManifestPath("job-1"))
+	if err != nil || manifest == nil {
+		t.Fatalf("Expected manifest, got %v (err: %v)", manifest, err)
+	}
+	state := manifest.Stages[types.StageSegmentPerson]
+	if state == nil || state.Status != types.StatusPending || state.RetryCount != 0 || state.Error != "interrupted" {
+		t.Errorf("Expected interrupted checkpoint without a retry, got %+v", state)
+	}
+}
@@ -7,6 +7,33 @@ type Config struct {
 	Servers  map[string]ServerConfig `yaml:"servers"`
 	Pipeline PipelineConfig          `yaml:"pipeline"`
 	LLM      LLMConfig               `yaml:"llm"`
+	Serve    ServeConfig             `yaml:"serve"`
+	Retry    RetryConfig             `yaml:"retry"`
+}
+
+// RetryConfig extends which errors transport, stage and LLM retries treat as transient.
+// 408, 429 and 5xx responses, deadlines, connection resets and JSON-RPC codes -32000
+// and -32001 are always retryable.
+type RetryConfig struct {
+	StatusCodes []int `yaml:"status_codes"` // Additional retryable HTTP statuses
+	RPCCodes    []int `yaml:"rpc_codes"`    // Additional retryable JSON-RPC error codes
+}
+
+// ServeConfig defines REST server mode parameters
+type ServeConfig struct {
+	Addr              string `yaml:"addr"`                // Listen address (default ":8080")
+	DataDir           string `yaml:"data_dir"`            // Job storage directory (default ".pipeline_jobs")
+	QueueDepth        int    `yaml:"queue_depth"`         // Max queued jobs before 429 (default 16)
+	Workers           int    `yaml:"workers"`             // Concurrent pipeline runs (default 1)
+	RetryAfterSeconds int    `yaml:"retry_after_seconds"` // Retry-After hint when the queue is full (default 30)
+
+	// How long shutdown waits for in-flight runs before checkpointing them (default 60s)
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+
+	// How long /readyz reuses a dependency check before running it again (default 15s)
+	HealthMaxAge time.Duration `yaml:"health_max_age"`
+	// Dependencies ("music", "llm", ...) whose failure marks the server degraded but still ready
+	OptionalDependencies []string `yaml:"optional_dependencies"`
 }
 
 // ServerConfig defines MCP server connection parameters
@@ -20,6 +47,63 @@ type ServerConfig struct {
 	Capabilities struct {
 		Tools []string `yaml:"tools"`
 	} `yaml:"capabilities"`
+
+	// Tools advertised to the model in full AI mode; empty advertises all. Unlisted
+	// tools can still be called by name.
+	ExposeTools []string `yaml:"expose_tools,omitempty"`
+	Warmup WarmupConfig `yaml:"warmup,omitempty"` // Call made at startup so models load before real stages
+
+	// Headers before ${VAR} expansion, set by the config loader so rotated credentials
+	// can be re-read from the environment
+	HeaderTemplates map[string]string `yaml:"-"`
+
+	// Send notifications/cancelled for abandoned requests (stdio only; the server must support it)
+	CancelRequests bool `yaml:"cancel_requests"`
+
+	// Lowest level of the server's stderr lines to log: debug, info (default), warn, error or off (stdio only)
+	StderrLevel string `yaml:"stderr_level"`
+
+	// Tools that return a job ID to poll instead of their result, by tool name
+	AsyncTools map[string]AsyncToolConfig `yaml:"async_tools,omitempty"`
+
+	// Stop calling the server for a while after repeated failures
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+}
+
+// AsyncToolConfig declares how to wait for an asynchronous tool. The tool's JSON result
+// carries a job ID; the poll tool is called with it until the job's status is done or
+// failed. A result without a job ID is returned as is.
+type AsyncToolConfig struct {
+	PollTool      string `yaml:"poll_tool"`       // Tool reporting the job's status (required)
+	JobIDField    string `yaml:"job_id_field"`    // Job ID in the tool's result (default "job_id")
+	JobIDArgument string `yaml:"job_id_argument"` // Poll tool argument carrying the job ID (default "job_id")
+	StatusField   string `yaml:"status_field"`    // Status in the poll result (default "status")
+	ResultField   string `yaml:"result_field"`    // Result in the finished poll result (empty = the whole poll result)
+	ErrorField    string `yaml:"error_field"`     // Failure message in the poll result (default "error")
+
+	DoneStatuses   []string `yaml:"done_statuses"`   // default: completed, succeeded, done
+	FailedStatuses []string `yaml:"failed_statuses"` // default: failed, error, cancelled
+
+	PollInterval time.Duration `yaml:"poll_interval"` // Delay between polls (default 2s)
+	MaxWait      time.Duration `yaml:"max_wait"`      // Give up after this long (default 10m)
+}
+
+// WarmupConfig selects the tool called to warm a server up after tool validation.
+// Without a tool, a known model-preparation tool is used if the server exposes one.
+type WarmupConfig struct {
+	Disabled  bool                   `yaml:"disabled"`
+	Tool      string                 `yaml:"tool"`      // e.g. a canary "detect" call
+	Arguments map[string]interface{} `yaml:"arguments"` // "{canary_image}" is replaced with a 32x32 test image
+	Timeout   time.Duration          `yaml:"timeout"`   // Dedicated timeout for the warmup call (default 5m)
+}
+
+// CircuitBreakerConfig sets when calls to a failing server are short-circuited: after
+// FailureThreshold consecutive failures within Window, calls fail at once for Cooldown,
+// then a single call is let through to test the server
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"` // 0 disables the breaker
+	Window           time.Duration `yaml:"window"`            // Failures further apart start a new count (default 1m)
+	Cooldown         time.Duration `yaml:"cooldown"`          // How long the circuit stays open (default 30s)
 }
 
 // PipelineConfig defines pipeline execution parameters
@@ -27,12 +111,187 @@ type PipelineConfig struct {
 	EnableMotion bool   `yaml:"enable_motion"`
 	MaxRetries   int    `yaml:"max_retries"`
 	ManifestPath string `yaml:"manifest_path"`
+
+	// Directory holding one <pipeline ID>.json manifest per run, so concurrent runs don't
+	// share a file. Used instead of manifest_path unless --manifest names a file.
+	ManifestDir string `yaml:"manifest_dir"`
+
+	// Longest image side, in pixels, sent to the segment and landmark tools (0 disables downscaling)
+	MaxProcessDimension int `yaml:"max_process_dimension"`
+
+	// Encoding quality (1-100) of JPEG working copies written by preprocessing (0 = 85)
+	JPEGQuality int `yaml:"jpeg_quality"`
+
+	// Most points per person polygon sent to the fill tool; longer ones are simplified (0 = no limit)
+	MaxPolygonPoints int `yaml:"max_polygon_points"`
+
+	// Format of the segmented image: png (default, transparent background), jpeg (solid
+	// white background, much smaller) or auto (jpeg unless render.pix_fmt keeps transparency)
+	SegmentOutputFormat string `yaml:"segment_output_format"`
+
+	// Lowest person detection score accepted before failing with low_confidence (0 accepts any)
+	MinSubjectConfidence float64 `yaml:"min_subject_confidence"`
+
+	Music MusicConfig `yaml:"music"` // How to read tracks from the music search response
+
+	// Content-addressed cache of segmentation and landmark results shared across runs
+	CacheDir   string `yaml:"cache_dir"`    // Empty disables caching
+	CacheMaxMB int    `yaml:"cache_max_mb"` // Evict least recently used entries above this size (0 = unlimited)
+
+	// Write the detected image description into the final MP4's title metadata
+	TitleMetadata bool `yaml:"title_metadata"`
+
+	// Skip appending run events to events.jsonl in the pipeline's temp directory
+	DisableEventLog bool `yaml:"disable_event_log"`
+
+	// Order stages run in; may include custom registered stages (default: built-in order)
+	Stages []PipelineStage `yaml:"stages,omitempty"`
+
+	// Run segment_person and estimate_landmarks concurrently on the original image when
+	// segmentation may fall back to it (error recovery use_original or skip)
+	ParallelAnalysis bool `yaml:"parallel_analysis"`
+
+	Output OutputConfig `yaml:"output"` // Container and codecs of the final video
+
+	Render RenderConfig `yaml:"render"` // Pixel format of the rendered motion video
+
+	Caption CaptionConfig `yaml:"caption"` // Font for drawtext captions
+
+	Captions CaptionsConfig `yaml:"captions"` // Sidecar .srt/.vtt caption files next to the final video
+
+	Comparison ComparisonConfig `yaml:"comparison"` // Before/after video of the original beside the result
+
+	Subjects SubjectConfig `yaml:"subjects"` // How photos with several people are animated
+
+	Placement PlacementConfig `yaml:"placement"` // Where the segmented person goes over a background image
+
+	Landmarks LandmarksConfig `yaml:"landmarks"` // Pose model used by estimate_landmarks
+
+	// Length of the motion: fixed uses the requested duration (default); match_audio the user-supplied audio's
+	DurationSource string `yaml:"duration_source"`
+
+	// What compose does when muxing music fails: fallback_no_audio (default), fail or retry
+	ComposeFailure string `yaml:"compose_failure"`
+
+	// Upper bound for the ffmpeg stages (render_motion, compose); their process trees are killed at it (default 10m)
+	StageTimeout time.Duration `yaml:"stage_timeout"`
+
+	// How long a run may finish its current stage after SIGINT/SIGTERM before it is cancelled (default 30s, negative cancels at once)
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period"`
+
+	// How long a stage may stay running before a resume marks it orphaned and failed (default 1h)
+	OrphanedStageAge time.Duration `yaml:"orphaned_stage_age"`
+
+	Repair RepairConfig `yaml:"repair"` // LLM-suggested parameters for a stage that ran out of retries
+}
+
+// RepairConfig bounds the LLM repairs of a run: when a stage has used up its retries,
+// the provider is asked once how to adjust the decision parameters and the stage runs
+// once more with its answer. Zero max_repairs disables repairs.
+type RepairConfig struct {
+	MaxRepairs int     `yaml:"max_repairs"`  // Repairs per run, over all stages
+	MaxCostUSD float64 `yaml:"max_cost_usd"` // Spent on repair questions per run (default 0.05)
+}
+
+// RenderConfig controls how the motion video is encoded
+type RenderConfig struct {
+	PixFmt         string `yaml:"pix_fmt"`          // yuv420p (default), yuv422p, yuv444p or yuva420p (transparency; needs vp9 output)
+	DisableAutoPad bool   `yaml:"disable_auto_pad"` // Fail on odd image sizes instead of padding them for subsampled formats
+}
+
+// SubjectConfig controls how render_motion animates group photos
+type SubjectConfig struct {
+	Mode      string `yaml:"mode"`       // uniform (default) animates the whole frame; per_person animates each person on their own
+	MaxPeople int    `yaml:"max_people"` // People animated in per_person mode, best detections first; the rest stay still (default 4)
+}
+
+// PlacementConfig composites the segmented person over a background image before
+// render_motion animates it. The subject is positioned from its bounding box.
+type PlacementConfig struct {
+	Background   string  `yaml:"background"`    // Background image; its size is the frame's. Empty animates the segmented image as is
+	SubjectFit   string  `yaml:"subject_fit"`   // center (default, keeps the subject's size), fit (largest without cropping) or fill (covers the background)
+	SubjectScale float64 `yaml:"subject_scale"` // Multiplies the fitted subject size (default 1)
+}
+
+// LandmarksConfig selects the pose estimation model. The decision's landmark_model and
+// landmark_confidence parameters override it.
+type LandmarksConfig struct {
+	Model        string  `yaml:"model"`         // YOLO pose model file (default "yolov8n-pose.pt")
+	Confidence   float64 `yaml:"confidence"`    // Detection confidence threshold (default 0.3)
+	MinKeypoints int     `yaml:"min_keypoints"` // Visible keypoints a person needs to count (0 = any)
+}
+
+// ComparisonConfig sets up the before/after video compose writes next to the final
+// output: the original still beside the animated result, split by a divider
+type ComparisonConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Layout        string `yaml:"layout"`         // horizontal (default, side by side) or vertical (stacked)
+	DividerWidth  int    `yaml:"divider_width"`  // Pixels between the two panels (default 8)
+	DividerColor  string `yaml:"divider_color"`  // ffmpeg color name or 0xRRGGBB (default white)
+	BeforeLabel   string `yaml:"before_label"`   // Label of the original (default "Before")
+	AfterLabel    string `yaml:"after_label"`    // Label of the result (default "After")
+	DisableLabels bool   `yaml:"disable_labels"` // Leave the panels unlabeled
+}
+
+// CaptionConfig sets how drawtext captions are rendered
+type CaptionConfig struct {
+	FontFile string `yaml:"font_file"` // TrueType/OpenType font covering the caption's characters (empty = fontconfig default)
+	FontSize int    `yaml:"font_size"` // Pixels (default 48)
+}
+
+// CaptionsConfig writes caption files next to the final video, for players and platforms
+// that show a separate caption track rather than text burned into the picture. Set text
+// or cues; neither writes no files.
+type CaptionsConfig struct {
+	Text    string       `yaml:"text"`    // Caption shown for the whole clip
+	Cues    []CaptionCue `yaml:"cues"`    // Timed captions, instead of text
+	Formats []string     `yaml:"formats"` // srt and/or vtt (default: both)
+}
+
+// CaptionCue is a caption shown from Start to End seconds into the clip
+type CaptionCue struct {
+	Text  string  `yaml:"text" json:"text"`
+	Start float64 `yaml:"start" json:"start"`
+	End   float64 `yaml:"end" json:"end"` // 0 = until the end of the clip
+}
+
+// OutputConfig selects the final video format. Empty fields keep today's output:
+// the motion video stream copied with AAC audio into MP4.
+type OutputConfig struct {
+	Container  string `yaml:"container"`   // mp4 (default), mov, mkv or webm
+	VideoCodec string `yaml:"video_codec"` // copy (default), h264, h265, vp9 or prores
+	AudioCodec string `yaml:"audio_codec"` // aac (default), mp3, opus or pcm_s16le
+	CRF        int    `yaml:"crf"`         // Constant rate factor for h264/h265/vp9 (0 = encoder default)
+	Bitrate    string `yaml:"bitrate"`     // Target video bitrate (e.g. "4M"); exclusive with crf
+
+	// Final file name: "fixed" (default, final_output.<container>), "content-hash"
+	// (<sha256 prefix>.<container>, with latest.<container> pointing at it) or a template
+	// like "{id}_{animation}_{mood}.mp4"
+	Name string `yaml:"name"`
+}
+
+// MusicConfig maps a music search response to tracks. Field paths use dotted keys
+// with optional [n] indexes and are resolved relative to each track node.
+type MusicConfig struct {
+	TracksPath string `yaml:"tracks_path"` // Path to the list of track nodes (default "data.recordings.nodes")
+	URLField   string `yaml:"url_field"`   // Audio URL within a node (default "recording.audioFile.lqmp3Url")
+	TitleField string `yaml:"title_field"` // Track title within a node (default "recording.title")
+	IDField    string `yaml:"id_field"`    // Track ID within a node, for provenance (default "recording.id")
+
+	Quality    string `yaml:"quality"`      // "low" (default) or "high"; high falls back to low when missing
+	HQURLField string `yaml:"hq_url_field"` // High-quality audio URL within a node (default "recording.audioFile.mp3Url")
+
+	// Which search result compose uses: "first" (default), "random" or "round_robin"
+	Selection    string `yaml:"selection"`
+	Seed         int64  `yaml:"seed"`          // Makes random picks reproducible per pipeline ID (0 = unseeded)
+	StateFile    string `yaml:"state_file"`    // Recently used tracks for round_robin (default ".music_selection.json")
+	RecentTracks int    `yaml:"recent_tracks"` // How many recent tracks round_robin avoids (default 5)
 }
 
 // LLMConfig defines LLM/AI Agent configuration
 type LLMConfig struct {
 	Enabled  bool          `yaml:"enabled"`
-	Provider string        `yaml:"provider"` // "anthropic", "google", "openai", "openrouter"
+	Provider string        `yaml:"provider"` // "anthropic", "google", "openai", "openrouter", "mock"
 	Mode     string        `yaml:"mode"`     // "lightweight" or "full_ai"
 	FullAI FullAIConfig `yaml:"full_ai"`
 
@@ -41,6 +300,7 @@ type LLMConfig struct {
 	Google     GoogleConfig     `yaml:"google"`
 	OpenAI     OpenAIConfig     `yaml:"openai"`
 	OpenRouter OpenRouterConfig `yaml:"openrouter"`
+	Mock       MockConfig       `yaml:"mock"`
 }
 
 // FullAIConfig defines limits for full AI agent mode
@@ -49,36 +309,114 @@ type FullAIConfig struct {
 	MaxTokens      int     `yaml:"max_tokens"`       // Max total tokens
 	MaxCostUSD     float64 `yaml:"max_cost_usd"`     // Max cost in USD
 	TimeoutSeconds int     `yaml:"timeout_seconds"`  // Global timeout
+
+	BudgetStatus BudgetStatusConfig `yaml:"budget_status"` // Per-round budget reminder for the model
+
+	HistoryCompaction HistoryCompactionConfig `yaml:"history_compaction"` // Elide old tool results from the history
+
+	// Tool calls run from one model response; the rest are answered with a note asking
+	// the model to repeat them next turn (0 = default of 8, negative = no limit)
+	MaxToolResultsPerTurn int `yaml:"max_tool_results_per_turn"`
+
+	// Skip coercing tool arguments to the types declared in each tool's input schema
+	DisableArgumentNormalization bool `yaml:"disable_argument_normalization"`
+
+	// Times a conversation that fails with a transient error, e.g. a provider outage, is
+	// restarted from scratch; each attempt gets the full round, token and cost limits
+	ConversationRetries int `yaml:"conversation_retries"`
+
+	// Summarize verbose tool results (detect/find, SearchRecordings) for the model; it can
+	// fetch the full output with agent__raw_result
+	SummarizeResults bool `yaml:"summarize_results"`
+
+	// Advertise MCP tools by name and a one-line description only; the model fetches a
+	// tool's parameter schema with agent__describe_tool when it needs it
+	LazyToolSchemas bool `yaml:"lazy_tool_schemas"`
+
+	// Separator between server and tool names in tool names shown to the model (default: "__")
+	ToolNameSeparator string `yaml:"tool_name_separator"`
+
+	// Servers listed at once during tool discovery (0 lists all servers at once)
+	DiscoveryConcurrency int `yaml:"discovery_concurrency"`
+
+	// Rules for recording intermediate paths from tool traffic (default: built-in rules)
+	ResultExtraction []ResultExtractionRule `yaml:"result_extraction,omitempty"`
+
+	// Tool arguments naming files the tool writes; relative values are rooted in the temp
+	// directory and values outside the temp and output directories are rejected
+	// (default: every argument matching "output*path")
+	OutputPathArguments []PathArgumentRule `yaml:"output_path_arguments,omitempty"`
+}
+
+// PathArgumentRule matches tool arguments that name files
+type PathArgumentRule struct {
+	Tool     string `yaml:"tool"`     // Glob matched against "server__tool" whatever the separator (e.g. "video__*")
+	Argument string `yaml:"argument"` // Glob matched against the argument name (e.g. "output*path")
+}
+
+// ResultExtractionRule maps a successful tool call to a pipeline result field
+type ResultExtractionRule struct {
+	Tool  string `yaml:"tool"`  // Glob matched against "server__tool" whatever the separator (e.g. "*__fill")
+	Field string `yaml:"field"` // segmented_image_path, motion_video_path or final_output_path
+	Path  string `yaml:"path"`  // JSON path rooted at "args" or "result" (e.g. "result.output_path")
+}
+
+// BudgetStatusConfig controls the budget status line injected into each round
+type BudgetStatusConfig struct {
+	Disabled   bool   `yaml:"disabled"`    // Turn the reminder off entirely
+	StartRound int    `yaml:"start_round"` // First round that carries the reminder (default: 1)
+	Format     string `yaml:"format"`      // Template with {round}, {max_rounds}, {tokens}, {max_tokens}, {cost}, {max_cost}, {remaining}
+}
+
+// HistoryCompactionConfig controls eliding old tool results from the conversation
+// history, so input tokens don't grow with every round
+type HistoryCompactionConfig struct {
+	Disabled   bool `yaml:"disabled"`    // Always resend the full history
+	AfterRound int  `yaml:"after_round"` // First round whose request is compacted (default: 6)
+	KeepRounds int  `yaml:"keep_rounds"` // Most recent rounds whose tool results stay verbatim (default: 3)
 }
 
 // AnthropicConfig for Claude
 type AnthropicConfig struct {
-	APIKey  string        `yaml:"api_key"`
-	Model   string        `yaml:"model"`   // e.g., "claude-3-5-sonnet-20241022"
-	Timeout time.Duration `yaml:"timeout"`
+	APIKey     string            `yaml:"api_key"`
+	APIKeyFile string            `yaml:"api_key_file"` // File holding the key; takes precedence over api_key
+	Model      string            `yaml:"model"`        // e.g., "claude-3-5-sonnet-20241022"
+	Timeout    time.Duration     `yaml:"timeout"`
+	Headers    map[string]string `yaml:"headers,omitempty"` // Sent with every API request, e.g. a gateway trace ID or billing tag
 }
 
 // GoogleConfig for Gemini
 type GoogleConfig struct {
-	APIKey  string        `yaml:"api_key"`
-	Model   string        `yaml:"model"`   // e.g., "gemini-2.0-flash-exp"
-	Project string        `yaml:"project"` // GCP project ID (optional, for Vertex AI)
-	Timeout time.Duration `yaml:"timeout"`
+	APIKey     string            `yaml:"api_key"`
+	APIKeyFile string            `yaml:"api_key_file"` // File holding the key; takes precedence over api_key
+	Model      string            `yaml:"model"`        // e.g., "gemini-2.0-flash-exp"
+	Project    string            `yaml:"project"`      // GCP project ID (optional, for Vertex AI)
+	Timeout    time.Duration     `yaml:"timeout"`
+	Headers    map[string]string `yaml:"headers,omitempty"` // Extra request headers
 }
 
 // OpenAIConfig for GPT models
 type OpenAIConfig struct {
-	APIKey       string        `yaml:"api_key"`
-	Model        string        `yaml:"model"`        // e.g., "gpt-4o"
-	Organization string        `yaml:"organization"` // Optional
-	Timeout      time.Duration `yaml:"timeout"`
+	APIKey       string            `yaml:"api_key"`
+	APIKeyFile   string            `yaml:"api_key_file"` // File holding the key; takes precedence over api_key
+	Model        string            `yaml:"model"`        // e.g., "gpt-4o"
+	Organization string            `yaml:"organization"` // Optional
+	Timeout      time.Duration     `yaml:"timeout"`
+	Headers      map[string]string `yaml:"headers,omitempty"` // Extra request headers
+}
+
+// MockConfig for the mock provider, which replays a recorded conversation trace
+type MockConfig struct {
+	TraceFile string `yaml:"trace_file"` // Trace written with --trace-file
 }
 
 // OpenRouterConfig for OpenRouter proxy service
 type OpenRouterConfig struct {
-	APIKey  string        `yaml:"api_key"`
-	Model   string        `yaml:"model"`   // e.g., "anthropic/claude-3.5-sonnet"
-	Timeout time.Duration `yaml:"timeout"`
+	APIKey     string            `yaml:"api_key"`
+	APIKeyFile string            `yaml:"api_key_file"` // File holding the key; takes precedence over api_key
+	Model      string            `yaml:"model"`        // e.g., "anthropic/claude-3.5-sonnet"
+	Timeout    time.Duration     `yaml:"timeout"`
+	Headers    map[string]string `yaml:"headers,omitempty"` // Extra request headers; override the default HTTP-Referer and X-Title
 }
 
 // Tool represents an MCP tool definition
@@ -96,10 +434,22 @@ type ToolCallResult struct {
 
 // ContentBlock represents a content item in tool result
 type ContentBlock struct {
-	Type string `json:"type"` // "text", "image", "resource"
-	Text string `json:"text,omitempty"`
-	Data string `json:"data,omitempty"`
-	URI  string `json:"uri,omitempty"`
+	Type     string `json:"type"` // "text", "image", "audio", "resource"
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"` // Base64 content of image and audio blocks
+	MimeType string `json:"mimeType,omitempty"`
+	URI      string `json:"uri,omitempty"`
+}
+
+// ToolProvenance identifies the tool that produced a result artifact. Server fields are
+// empty for artifacts rendered locally, e.g. with ffmpeg.
+type ToolProvenance struct {
+	Server        string `json:"server,omitempty"`         // Configured server name (e.g. "imagesorcery")
+	ServerName    string `json:"server_name,omitempty"`    // Name the server reported at initialization
+	ServerVersion string `json:"server_version,omitempty"` // Version the server reported at initialization
+	Tool          string `json:"tool"`
+	TrackID       string `json:"track_id,omitempty"`    // Music track the artifact came from
+	TrackTitle    string `json:"track_title,omitempty"` // Title of that track
 }
 
 // PipelineInput contains the initial pipeline parameters
@@ -109,6 +459,25 @@ type PipelineInput struct {
 	UserPrompt string  // User's request (e.g., "make a shake animation")
 	OutputDir  string  // Output directory for final result files
 	TempDir    string  // Temporary directory for intermediate files
+	AudioPath  string  // User-supplied soundtrack; replaces the music search
+
+	// Motion sequence rendered by render_motion; empty uses the decision's plan or a single head shake
+	AnimationPlan []AnimationSegment
+
+	// Intensity of rotate, shake and nod segments that don't set their own; 0 scales
+	// the defaults with the subject's size in frame
+	Intensity float64
+}
+
+// AnimationSegment is one part of a motion sequence, e.g. a nod for 5 seconds
+type AnimationSegment struct {
+	Type      string  `json:"type" yaml:"type"`                               // rotate, shake, nod, zoom or custom
+	Duration  float64 `json:"duration" yaml:"duration"`                       // Seconds
+	Intensity float64 `json:"intensity,omitempty" yaml:"intensity,omitempty"` // Degrees, pixels or zoom factor (0 = default)
+
+	// FFmpeg filter chain rendering a custom segment, e.g. "rotate='0.1*sin(2*PI*t)'";
+	// t is the time in seconds
+	CustomFilter string `json:"custom_filter,omitempty" yaml:"custom_filter,omitempty"`
 }
 
 // PipelineStage represents a stage in the execution pipeline
@@ -93,14 +93,14 @@ for i in "${!FILES[@]}"; do
     BASENAME=$(basename "$FILE" | sed 's/\.[^.]*$//')
     PIPELINE_ID="batch_${BASENAME}_$(date +%s)"
 
-    # Run agent
-    if ./bin/agent --image "$FILE" --duration "$DURATION" --id "$PIPELINE_ID"; then
+    # Run agent; the final video goes straight to $OUTPUT_DIR/<basename>_final.<ext>, so
+    # each outcome appended to the batch summary points at the file the batch leaves behind
+    if ./bin/agent --image "$FILE" --duration "$DURATION" --id "$PIPELINE_ID" \
+        --output "$OUTPUT_DIR" --output-name '{image}_final' --batch-summary "$OUTPUT_DIR"; then
         echo -e "${GREEN}  ✓ Success${NC}"
         SUCCESS_COUNT=$((SUCCESS_COUNT + 1))
 
-        # Copy output files to organized directory
-        [ -f "/tmp/final_headshake_with_music.mp4" ] && \
-            cp "/tmp/final_headshake_with_music.mp4" "$OUTPUT_DIR/${BASENAME}_final.mp4"
+        # Copy intermediate files to organized directory
         [ -f "/tmp/headshake_animation.mp4" ] && \
             cp "/tmp/headshake_animation.mp4" "$OUTPUT_DIR/${BASENAME}_animation.mp4"
         [ -f "/tmp/segmented_person.png" ] && \
@@ -129,6 +129,7 @@ if [ $FAIL_COUNT -gt 0 ]; then
 fi
 echo ""
 echo "Output directory: $OUTPUT_DIR"
+echo "Summary: $OUTPUT_DIR/batch_summary.csv (and batch_summary.json)"
 
 # Open output directory (macOS)
 if command -v open &> /dev/null; then